@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// runApply applies a diff saved by `diff --out`, or a plan written by plan, to
+// the target project:
+//
+//	apply --diff file | --plan file [--url url] [--token token] [--yes]
+//	      [--interactive] [--only-collections pattern]...
+//	      [--no-backup] [--backup-dir dir|url] [--keep-backups n] [--rollback]
+//	      [--backup-repo [--backup-env env]]
+//	      [--allow-destructive] [--max-deletions n]
+//	      [--record-history [--history-collection name] [--operator name]]
+//	      [--lock [--lock-timeout duration] [--lock-ttl duration] [--lock-collection name]]
+//	      [--hook-timeout duration] [--strict-hooks]
+//	      [--slack-webhook-url url] [--notify-webhook-url url]
+//
+// --interactive and --only-collections narrow the diff to the chosen changes
+// first, see selectFlags. Destructive diffs are refused as by migrate. Unless
+// --yes is given, the diff is shown and has to be confirmed first. The
+// snapshot of the target is backed up before the diff is applied, and the
+// reverse diff saved next to it afterwards for the undo command.
+//
+// Directus rejects the diff when the target schema changed since it was
+// computed, in which case a fresh diff has to be reviewed. A plan is checked
+// before anything else: it is refused when its checksum does not match, when
+// it was computed for another target or when the target schema hash changed
+// since.
+func runApply(ctx context.Context, args []string) (err error) {
+	cmd := newCommand("apply")
+	defer func() { err = cmd.finish(err) }()
+	path := cmd.String("diff", "", "", "diff file written by the diff command")
+	planPath := cmd.String("plan", "", "", "plan file or s3:// URL written by the plan command")
+	target := addClientFlags(cmd, "", "TARGET")
+	yes := addYesFlag(cmd)
+	selection := addSelectFlags(cmd)
+	backups := addBackupFlags(cmd)
+	safety := addSafetyFlags(cmd)
+	history := addHistoryFlags(cmd)
+	locks := addLockFlags(cmd)
+	hooks := addHookFlags(cmd)
+	notify := addNotifyFlags(cmd, nil)
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	switch {
+	case *path != "" && *planPath != "":
+		return fmt.Errorf("--diff and --plan are mutually exclusive")
+	case *path == "" && *planPath == "":
+		cmd.flags.Usage()
+		return fmt.Errorf("missing required configuration:\n  --diff or --plan")
+	}
+	if err := cmd.require(target); err != nil {
+		return err
+	}
+	if err := selection.check(); err != nil {
+		return err
+	}
+	if err := notify.addEnvironment(cmd, *target.environment); err != nil {
+		return err
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	var diff *gomigratedirectus.Diff
+	var plan *gomigratedirectus.Plan
+	if *planPath != "" {
+		store, name, err := gomigratedirectus.OpenStoreFile(*planPath)
+		if err != nil {
+			return fmt.Errorf("Apply failed: %w", err)
+		}
+		if plan, err = gomigratedirectus.ReadPlanFromStore(ctx, store, name); err != nil {
+			return fmt.Errorf("Apply failed: %w", err)
+		}
+		diff, path = plan.Diff, planPath
+	} else {
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			return fmt.Errorf("Apply failed: %w", err)
+		}
+		if diff, err = gomigratedirectus.ParseDiff(data); err != nil {
+			return fmt.Errorf("Apply failed: %s: %w", *path, err)
+		}
+	}
+	if diff.IsEmpty() {
+		slog.Info("diff is empty, nothing to apply", "path", *path)
+		return nil
+	}
+
+	client, err := target.newClient()
+	if err != nil {
+		return err
+	}
+	hooks.add(cmd, client, *target.environment)
+	unlock, err := locks.acquire(ctx, client, *history.operator)
+	if err != nil {
+		return fmt.Errorf("Apply failed: %w", err)
+	}
+	defer unlock()
+	if plan != nil {
+		if err := gomigratedirectus.CheckPlan(ctx, client, plan); err != nil {
+			return fmt.Errorf("Apply failed: %w", err)
+		}
+		slog.Info("target schema matches the plan", "path", *path, "target_hash", plan.TargetHash, "planned_at", plan.CreatedAt)
+	}
+	if len(*selection.onlyCollections) > 0 || *selection.interactive {
+		selected, err := selection.diff(ctx, gomigratedirectus.RedactURL(client.URL), diff)
+		if errors.Is(err, gomigratedirectus.ErrNotConfirmed) {
+			return fmt.Errorf("Apply aborted: %w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("Apply failed: %w", err)
+		}
+		if selected == nil {
+			slog.Info("no selected changes, nothing to apply", "path", *path)
+			return nil
+		}
+		slog.Info("changes selected", "selected", len(gomigratedirectus.ListDiffItems(selected)), "total", len(gomigratedirectus.ListDiffItems(diff)))
+		diff = selected
+		if plan != nil {
+			plan.Diff = selected
+		}
+	}
+	summary := gomigratedirectus.SummarizeDiff(diff)
+	cmd.report.Changed, cmd.report.Summary = true, &summary
+	cmd.report.DestructiveChanges = gomigratedirectus.FindDestructiveChanges(diff)
+	if err := safety.check(diff); err != nil {
+		return fmt.Errorf("Apply failed: %w", err)
+	}
+	if !*yes {
+		ok, err := confirmChanges(os.Stdin, os.Stderr, cmd.color(os.Stderr))(ctx, gomigratedirectus.RedactURL(client.URL), diff, summary)
+		if err != nil {
+			return fmt.Errorf("Apply failed: %w", err)
+		}
+		if !ok {
+			return fmt.Errorf("Apply aborted: %w", gomigratedirectus.ErrNotConfirmed)
+		}
+	}
+	if err := history.ensure(ctx, client); err != nil {
+		return fmt.Errorf("Apply failed: %w", err)
+	}
+	var backup *gomigratedirectus.Snapshot
+	if cmd.report.BackupPath, backup, err = backups.backup(ctx, client); err != nil {
+		return fmt.Errorf("Apply failed: %w", err)
+	}
+	if err := hooks.runStage(ctx, gomigratedirectus.HookPreApply, client, &summary, cmd.report.BackupPath, nil); err != nil {
+		return fmt.Errorf("Apply failed: %w", err)
+	}
+	slog.Info("applying diff", "path", *path, "summary", summary.String())
+	progress := newProgress(cmd)
+	progress.handle(&gomigratedirectus.ApplyStarted{})
+	if plan != nil {
+		err = gomigratedirectus.ApplyPlan(ctx, client, plan)
+	} else {
+		err = client.ApplyDiff(ctx, diff)
+	}
+	progress.stop()
+	var baseHash string
+	if plan != nil {
+		baseHash = plan.BaseHash
+	}
+	history.record(ctx, client, *path, baseHash, summary, err)
+	if err != nil {
+		err = backups.restore(ctx, client, backup, err, cmd.report)
+		hooks.runStage(context.WithoutCancel(ctx), gomigratedirectus.HookOnFailure, client, &summary, cmd.report.BackupPath, err)
+		return fmt.Errorf("Apply failed: %w", err)
+	}
+	cmd.report.Applied = true
+	slog.Info("diff applied", "request_id", client.LastRequestID())
+	backups.recordUndo(ctx, client, backup, cmd.report)
+	if err := hooks.runStage(ctx, gomigratedirectus.HookPostApply, client, &summary, cmd.report.BackupPath, nil); err != nil && *hooks.strict {
+		return fmt.Errorf("Apply failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// backupFlags configures the backup of the target taken before applying and
+// the rollback to it.
+type backupFlags struct {
+	disabled *bool
+	dir      *string
+	keep     *int
+	rollback *bool
+	repo     *bool
+	env      *string
+}
+
+// addBackupFlags registers --no-backup, --backup-dir, --keep-backups,
+// --backup-repo, --backup-env and --rollback.
+func addBackupFlags(cmd *command) backupFlags {
+	return backupFlags{
+		rollback: cmd.Bool("rollback", "ROLLBACK", false, "restore the target snapshot taken before applying if the apply fails"),
+		disabled: cmd.Bool("no-backup", "NO_BACKUP", false, "do not back up the target snapshot before applying"),
+		dir:      cmd.String("backup-dir", "BACKUP_DIR", gomigratedirectus.DefaultBackupDir, "directory, file:// or s3://bucket/prefix URL for target snapshot backups"),
+		keep:     cmd.Int("keep-backups", "KEEP_BACKUPS", gomigratedirectus.DefaultBackupRetention, "number of backups to keep, 0 to keep all"),
+		repo:     cmd.Bool("backup-repo", "BACKUP_REPO", false, "keep the backups in a snapshot repository at --backup-dir, as the snapshots command manages"),
+		env:      cmd.String("backup-env", "BACKUP_ENV", "", "environment of the snapshot repository to back up to (default: the host of the target)"),
+	}
+}
+
+// apply copies the flags to opts.
+func (f backupFlags) apply(opts *gomigratedirectus.MigrationOptions) error {
+	opts.NoBackup = *f.disabled
+	opts.BackupDir = *f.dir
+	opts.BackupRetention = *f.keep
+	if *f.keep <= 0 {
+		opts.BackupRetention = -1
+	}
+	opts.Rollback = *f.rollback
+	if !*f.disabled {
+		store, err := gomigratedirectus.OpenStore(*f.dir)
+		if err != nil {
+			return fmt.Errorf("invalid --backup-dir: %w", err)
+		}
+		opts.BackupStore = store
+		if *f.repo {
+			opts.BackupRepository = gomigratedirectus.NewSnapshotRepository(store)
+			opts.BackupEnv = *f.env
+		}
+	}
+	return nil
+}
+
+// backup takes the target snapshot before applying and saves it unless
+// disabled. The snapshot is only fetched when it is saved or needed for a
+// rollback; the path is empty when it was not saved.
+func (f backupFlags) backup(ctx context.Context, client *gomigratedirectus.DirectusClient) (string, *gomigratedirectus.Snapshot, error) {
+	if *f.disabled && !*f.rollback {
+		return "", nil, nil
+	}
+	var store gomigratedirectus.SnapshotStore
+	if !*f.disabled {
+		var err error
+		if store, err = gomigratedirectus.OpenStore(*f.dir); err != nil {
+			return "", nil, fmt.Errorf("invalid --backup-dir: %w", err)
+		}
+	}
+	snapshot, err := client.GetSnapshot(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to back up target: failed to get target snapshot: %w", err)
+	}
+	if *f.disabled {
+		return "", snapshot, nil
+	}
+
+	if *f.repo {
+		return f.backupToRepository(ctx, gomigratedirectus.NewSnapshotRepository(store), client, snapshot)
+	}
+	path, err := gomigratedirectus.StoreBackup(ctx, store, snapshot)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to back up target: %w", err)
+	}
+	slog.Info("target snapshot backed up", "path", path)
+	if *f.keep > 0 {
+		if err := gomigratedirectus.PruneStoredBackups(ctx, store, *f.keep); err != nil {
+			slog.Warn("failed to remove old backups", "error", err)
+		}
+	}
+	return path, snapshot, nil
+}
+
+// backupToRepository adds snapshot, the backup of client, to the
+// environment --backup-env of repo and prunes the untagged backups beyond
+// --keep-backups.
+func (f backupFlags) backupToRepository(ctx context.Context, repo *gomigratedirectus.SnapshotRepository, client *gomigratedirectus.DirectusClient, snapshot *gomigratedirectus.Snapshot) (string, *gomigratedirectus.Snapshot, error) {
+	env := *f.env
+	if env == "" {
+		env = gomigratedirectus.BackupEnvName(client.URL)
+	}
+	entry, err := repo.Add(ctx, env, snapshot)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to back up target: %w", err)
+	}
+	path := repo.Location(entry)
+	slog.Info("target snapshot backed up", "path", path, "id", entry.ID)
+	if *f.keep > 0 {
+		if _, err := repo.Prune(ctx, gomigratedirectus.RepositoryPruneOptions{Keep: *f.keep, KeepTagged: true, Env: env}); err != nil {
+			slog.Warn("failed to remove old backups", "error", err)
+		}
+	}
+	return path, snapshot, nil
+}
+
+// restore rolls client back to backup after applyErr when --rollback is set,
+// recording the outcome in report, and returns the error to fail with.
+func (f backupFlags) restore(ctx context.Context, client *gomigratedirectus.DirectusClient, backup *gomigratedirectus.Snapshot, applyErr error, report *gomigratedirectus.Report) error {
+	if !*f.rollback {
+		return applyErr
+	}
+	slog.Warn("rolling back target to the snapshot taken before applying")
+	if err := gomigratedirectus.Rollback(context.WithoutCancel(ctx), client, backup); err != nil {
+		return fmt.Errorf("apply failed AND rollback failed: %w", errors.Join(applyErr, err))
+	}
+	slog.Info("rollback complete, target schema restored")
+	report.RolledBack = true
+	return fmt.Errorf("%w (the previous schema was restored)", applyErr)
+}
+
+// recordUndo saves the undo record of the diff just applied to client next to
+// backup, the snapshot taken by backup, and records its path in report. It
+// does nothing when backups are disabled; a failure only logs a warning since
+// the diff was applied.
+func (f backupFlags) recordUndo(ctx context.Context, client *gomigratedirectus.DirectusClient, backup *gomigratedirectus.Snapshot, report *gomigratedirectus.Report) {
+	if *f.disabled || backup == nil {
+		return
+	}
+	store, err := gomigratedirectus.OpenStore(*f.dir)
+	if err != nil {
+		slog.Warn("failed to record undo", "error", err)
+		return
+	}
+	path, err := gomigratedirectus.RecordUndo(context.WithoutCancel(ctx), client, store, backup, report.BackupPath)
+	if err != nil {
+		slog.Warn("failed to record undo", "error", err)
+		return
+	}
+	if path == "" {
+		return
+	}
+	report.UndoPath = path
+	slog.Info("undo recorded", "path", path)
+	if *f.keep > 0 {
+		if err := gomigratedirectus.PruneUndoRecords(ctx, store, *f.keep); err != nil {
+			slog.Warn("failed to remove old undo records", "error", err)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// cacheFlags holds the flags of the schema cache, which skips migrating a
+// target still in sync with the same base snapshot.
+type cacheFlags struct {
+	file     *string
+	disabled *bool
+}
+
+// addCacheFlags registers --cache-file and --no-cache.
+func addCacheFlags(cmd *command) cacheFlags {
+	return cacheFlags{
+		file:     cmd.String("cache-file", "SCHEMA_CACHE_FILE", "", "file remembering the targets found in sync, to skip migrating them again"),
+		disabled: cmd.Bool("no-cache", "NO_CACHE", false, "always diff and apply, ignoring the schema cache"),
+	}
+}
+
+// apply sets the cache of opts: the one saved to --cache-file, or one kept in
+// memory if inMemory is set, unless --no-cache is given.
+func (f cacheFlags) apply(opts *gomigratedirectus.MigrationOptions, inMemory bool) error {
+	switch {
+	case *f.disabled:
+	case *f.file != "":
+		cache, err := gomigratedirectus.OpenSchemaCache(*f.file)
+		if err != nil {
+			return err
+		}
+		opts.Cache = cache
+	case inMemory:
+		opts.Cache = gomigratedirectus.NewSchemaCache()
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// runCheck reports whether the target project drifted from a snapshot file,
+// such as one kept in version control, without ever applying anything:
+//
+//	check --snapshot file [--url url] [--token token] [--force]
+//	      [--include pattern]... [--exclude pattern]... [--exit-code-on-changes code]
+//
+// Every drifted collection, field and relation is printed as missing on the
+// target, unexpected on the target or changed, followed by a summary, and
+// listed under drift in the JSON report. The command exits with status 0 when
+// the target is in sync, 2 (or the --exit-code-on-changes status) when it
+// drifted and 1 on errors.
+func runCheck(ctx context.Context, args []string) (err error) {
+	cmd := newCommand("check")
+	defer func() { err = cmd.finish(err) }()
+	cmd.addExitCodeFlag()
+	cmd.addLoadFlags()
+	path := cmd.String("snapshot", "", "", "snapshot file the target is expected to match")
+	target := addClientFlags(cmd, "", "TARGET")
+	force := cmd.Bool("force", "FORCE", false, "compute the diff even if Directus versions differ")
+	filters := addFilterFlags(cmd)
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		cmd.flags.Usage()
+		return fmt.Errorf("missing required configuration:\n  --snapshot")
+	}
+	if err := cmd.require(target); err != nil {
+		return err
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	snapshot, err := cmd.loadSnapshot(*path)
+	if err != nil {
+		return fmt.Errorf("Check failed: %w", err)
+	}
+	cmd.report.BaseFile = *path
+	client, err := target.newClient()
+	if err != nil {
+		return err
+	}
+	result, err := gomigratedirectus.CheckDrift(ctx, snapshot, client, filters.filter(), *force)
+	if err != nil {
+		return fmt.Errorf("Check failed: %w", err)
+	}
+	cmd.report.Drift = result
+	if result.InSync {
+		slog.Info("target is in sync with the snapshot", "path", *path)
+		return nil
+	}
+	cmd.report.Changed, cmd.report.Summary = true, &result.Summary
+
+	for _, kind := range []struct {
+		noun  string
+		items []gomigratedirectus.DriftedItem
+	}{
+		{"collection", result.Collections},
+		{"field", result.Fields},
+		{"relation", result.Relations},
+	} {
+		for _, item := range kind.items {
+			switch item.Drift {
+			case gomigratedirectus.DriftChanged:
+				fmt.Fprintf(cmd.stdout, "%s %s changed\n", kind.noun, item.Name)
+			default:
+				fmt.Fprintf(cmd.stdout, "%s %s %s on the target\n", kind.noun, item.Name, item.Drift)
+			}
+		}
+	}
+	fmt.Fprintf(cmd.stdout, "\ndrift detected, restoring the snapshot takes: %s.\n", result.Summary)
+	slog.Warn("target drifted from the snapshot", "path", *path, "summary", result.Summary.String())
+	return cmd.changed()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// resumeFlags configure where migrations with sync phases keep their
+// checkpoint and resuming a failed one from it.
+type resumeFlags struct {
+	resume *bool
+	dir    *string
+}
+
+// addResumeFlags registers --resume and --checkpoint-dir.
+func addResumeFlags(cmd *command) resumeFlags {
+	return resumeFlags{
+		resume: cmd.Bool("resume", "RESUME", false, "skip the sync phases the checkpoint of a failed run recorded as completed"),
+		dir:    cmd.String("checkpoint-dir", "CHECKPOINT_DIR", "", "directory, file:// or s3://bucket/prefix URL for checkpoints (default: --backup-dir)"),
+	}
+}
+
+// apply copies the flags to opts, after backupFlags.apply: without
+// --checkpoint-dir the checkpoints are kept in the backup directory, even
+// with --no-backup.
+func (f resumeFlags) apply(opts *gomigratedirectus.MigrationOptions) error {
+	opts.Resume = *f.resume
+	dir := *f.dir
+	if dir == "" {
+		if opts.BackupStore != nil {
+			return nil
+		}
+		dir = opts.BackupDir
+	}
+	store, err := gomigratedirectus.OpenStore(dir)
+	if err != nil {
+		return fmt.Errorf("invalid --checkpoint-dir: %w", err)
+	}
+	opts.CheckpointStore = store
+	return nil
+}
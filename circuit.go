@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// circuitBreakerFromEnv returns the circuit breaker option of the clients,
+// opening after CIRCUIT_BREAKER_FAILURES consecutive failures for
+// CIRCUIT_BREAKER_COOLDOWN, or nil when CIRCUIT_BREAKER_FAILURES is unset or
+// zero.
+func circuitBreakerFromEnv() (gomigratedirectus.ClientOption, error) {
+	value := os.Getenv("CIRCUIT_BREAKER_FAILURES")
+	if value == "" {
+		return nil, nil
+	}
+	failures, err := strconv.Atoi(value)
+	if err != nil || failures < 0 {
+		return nil, fmt.Errorf("invalid CIRCUIT_BREAKER_FAILURES %q, expected a number of failures", value)
+	}
+	if failures == 0 {
+		return nil, nil
+	}
+	var coolDown time.Duration
+	if value := os.Getenv("CIRCUIT_BREAKER_COOLDOWN"); value != "" {
+		if coolDown, err = time.ParseDuration(value); err != nil || coolDown <= 0 {
+			return nil, fmt.Errorf("invalid CIRCUIT_BREAKER_COOLDOWN %q, expected a duration such as 30s", value)
+		}
+	}
+	return gomigratedirectus.WithCircuitBreaker(failures, coolDown), nil
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// defaultEnvFile is loaded when --env-file is not given. Unlike an explicit
+// --env-file it may be missing.
+const defaultEnvFile = ".env"
+
+// command is the flag set of a subcommand. Flags that are not given on the
+// command line fall back to an environment variable, which in turn may come
+// from the env file, and then to the defaults of the config file, so the
+// precedence is flags > environment > env file > config file.
+type command struct {
+	flags      *flag.FlagSet
+	env        map[string]string
+	explicit   map[string]bool
+	envFile    *string
+	configPath *string
+	config     *config
+	timeout    *time.Duration
+	logging    logFlags
+
+	exitCodeOnChanges *int
+	skipVerify        *bool
+	snapshotRepo      *string
+	// insecure is --insecure, shared by the clients of the command, see
+	// addInsecureFlag.
+	insecure *bool
+	// vars is --var; placeholders holds its values and those of the config
+	// file once parsed, see addVarsFlag.
+	vars         *[]string
+	substitute   *bool
+	placeholders map[string]string
+
+	// configRequired loads the default config file even when neither --from
+	// nor --to is given, for commands that select environments otherwise.
+	configRequired bool
+	// standalone skips the env file and the config file, for commands such
+	// as version that connect to no project.
+	standalone bool
+
+	// notify, if set, sends notifications when the command finishes.
+	notify *notifyFlags
+
+	// stopTracing, if set, flushes the spans of the command when it
+	// finishes.
+	stopTracing func()
+
+	// output is --output; report collects the outcome written by finish
+	// in JSON mode, and stdout receives human-readable data otherwise.
+	output     *string
+	jsonOutput bool
+	noColor    *bool
+	noPager    *bool
+	report     *gomigratedirectus.Report
+	stdout     io.Writer
+}
+
+// newCommand creates a command with the flags shared by all subcommands.
+func newCommand(name string) *command {
+	cmd := &command{
+		flags:  flag.NewFlagSet(name, flag.ContinueOnError),
+		env:    map[string]string{},
+		report: &gomigratedirectus.Report{Command: name, StartedAt: time.Now().UTC()},
+		stdout: os.Stdout,
+	}
+	cmd.envFile = cmd.flags.String("env-file", defaultEnvFile, "file to load environment variables from")
+	cmd.configPath = cmd.String("config", "DIRECTUS_MIGRATE_CONFIG", "", "config file with named environments (default "+defaultConfigFile+" when --from or --to is used)")
+	cmd.timeout = cmd.Duration("timeout", "TIMEOUT", 0, "overall deadline for the command, 0 for none")
+	cmd.logging = addLogFlags(cmd)
+	cmd.output = cmd.String("output", "OUTPUT", "text", "output format: text, or json for a single JSON report on stdout")
+	cmd.noColor = cmd.Bool("no-color", "", false, "do not color diffs, as when NO_COLOR is set or the output is not a terminal")
+	cmd.noPager = cmd.Bool("no-pager", "", false, "do not page diffs taller than the terminal through $PAGER")
+	return cmd
+}
+
+// String defines a string flag that falls back to the environment variable
+// env.
+func (c *command) String(name, env, value, usage string) *string {
+	c.bind(name, env)
+	return c.flags.String(name, value, usage+envHint(env))
+}
+
+// Bool defines a bool flag that falls back to the environment variable env.
+func (c *command) Bool(name, env string, value bool, usage string) *bool {
+	c.bind(name, env)
+	return c.flags.Bool(name, value, usage+envHint(env))
+}
+
+// Int defines an int flag that falls back to the environment variable env.
+func (c *command) Int(name, env string, value int, usage string) *int {
+	c.bind(name, env)
+	return c.flags.Int(name, value, usage+envHint(env))
+}
+
+// Duration defines a duration flag that falls back to the environment
+// variable env.
+func (c *command) Duration(name, env string, value time.Duration, usage string) *time.Duration {
+	c.bind(name, env)
+	return c.flags.Duration(name, value, usage+envHint(env))
+}
+
+// Strings defines a repeatable string flag that falls back to the
+// environment variable env. Every value, including that of env, may hold
+// several comma-separated items.
+func (c *command) Strings(name, env, usage string) *[]string {
+	c.bind(name, env)
+	var values stringsValue
+	c.flags.Var(&values, name, usage+" (repeatable, comma-separated)"+envHint(env))
+	return (*[]string)(&values)
+}
+
+// stringsValue is the flag.Value of Strings.
+type stringsValue []string
+
+func (v *stringsValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(*v, ",")
+}
+
+func (v *stringsValue) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+
+func (c *command) bind(name, env string) {
+	if env != "" {
+		c.env[name] = env
+	}
+}
+
+func envHint(env string) string {
+	if env == "" {
+		return ""
+	}
+	return " (env " + env + ")"
+}
+
+// parse parses args, loads the env file, fills unset flags from the
+// environment and the config file and installs the logger. Standalone
+// commands skip the env file and the config file.
+func (c *command) parse(args []string) error {
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	c.explicit = map[string]bool{}
+	c.flags.Visit(func(f *flag.Flag) { c.explicit[f.Name] = true })
+
+	envFileMissing := false
+	if !c.standalone {
+		if err := godotenv.Load(*c.envFile); err != nil {
+			if !errors.Is(err, fs.ErrNotExist) || c.isSet("env-file") {
+				return fmt.Errorf("failed to load env file %s: %w", *c.envFile, err)
+			}
+			envFileMissing = true
+		}
+	}
+
+	for name, env := range c.env {
+		value := os.Getenv(env)
+		if value == "" || c.isSet(name) {
+			continue
+		}
+		if err := c.flags.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", value, env, err)
+		}
+	}
+
+	if !c.standalone {
+		if err := c.loadConfig(); err != nil {
+			return err
+		}
+	}
+	if err := c.parseVars(); err != nil {
+		return err
+	}
+	switch strings.ToLower(*c.output) {
+	case "text":
+	case "json":
+		c.jsonOutput = true
+		c.stdout = io.Discard
+	default:
+		return fmt.Errorf("invalid output format %q, expected text or json", *c.output)
+	}
+	if c.exitCodeOnChanges != nil && (*c.exitCodeOnChanges < 0 || *c.exitCodeOnChanges > 125) {
+		return fmt.Errorf("invalid --exit-code-on-changes %d, expected 0 to 125", *c.exitCodeOnChanges)
+	}
+
+	if err := c.logging.setup(); err != nil {
+		return err
+	}
+	if envFileMissing {
+		slog.Warn("env file not found, using flags and environment only", "path", *c.envFile)
+	}
+	return nil
+}
+
+// loadConfig loads the config file, if one is given or an environment is
+// selected, applies its defaults to the flags that are still unset and adds
+// the filter rules, data collections and webhook URLs of the selected
+// environments.
+func (c *command) loadConfig() error {
+	path := *c.configPath
+	if path == "" && (c.configRequired || c.flagValue("from") != "" || c.flagValue("to") != "") {
+		path = defaultConfigFile
+	}
+	if path == "" {
+		return nil
+	}
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	c.config = cfg
+
+	for name, value := range cfg.Defaults.values() {
+		if c.flags.Lookup(name) == nil || c.isSet(name) || os.Getenv(c.env[name]) != "" {
+			continue
+		}
+		if err := c.flags.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for defaults.%s in %s: %w", value, name, path, err)
+		}
+	}
+	for name, values := range cfg.filters(c.flagValue("from"), c.flagValue("to")) {
+		if c.flags.Lookup(name) == nil || len(values) == 0 {
+			continue
+		}
+		if err := c.flags.Set(name, strings.Join(values, ",")); err != nil {
+			return fmt.Errorf("invalid filters in %s: %w", path, err)
+		}
+	}
+	if c.flags.Lookup("data-collection") != nil && c.flagValue("data-collection") == "" {
+		collections, fields := cfg.data(c.flagValue("from"), c.flagValue("to"))
+		for name, values := range map[string][]string{"data-collection": collections, "data-field": fields} {
+			for _, value := range values {
+				if err := c.flags.Set(name, value); err != nil {
+					return fmt.Errorf("invalid data in %s: %w", path, err)
+				}
+			}
+		}
+	}
+	if c.flags.Lookup("webhook-url") != nil {
+		urls, err := cfg.webhookURLs(c.flagValue("from"), c.flagValue("to"))
+		if err != nil {
+			return err
+		}
+		for _, value := range urls {
+			if err := c.flags.Set("webhook-url", value); err != nil {
+				return fmt.Errorf("invalid webhooks in %s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *command) flagValue(name string) string {
+	if f := c.flags.Lookup(name); f != nil {
+		return f.Value.String()
+	}
+	return ""
+}
+
+// finish writes the JSON report in JSON mode and returns err unchanged. Run
+// functions defer it right after creating the command.
+func (c *command) finish(err error) error {
+	if c.stopTracing != nil {
+		c.stopTracing()
+	}
+	if c.notify != nil {
+		c.notify.send(c, err)
+	}
+	if !c.jsonOutput {
+		return err
+	}
+	c.report.FinishedAt = time.Now().UTC()
+	var changes *changesError
+	if err != nil && !errors.As(err, &changes) {
+		c.report.Error = err.Error()
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if encodeErr := encoder.Encode(c.report); encodeErr != nil && err == nil {
+		return fmt.Errorf("failed to write report: %w", encodeErr)
+	}
+	return err
+}
+
+// addExitCodeFlag registers --exit-code-on-changes on commands whose outcome
+// is either "in sync" or "changes applied or pending".
+func (c *command) addExitCodeFlag() {
+	c.exitCodeOnChanges = c.Int("exit-code-on-changes", "EXIT_CODE_ON_CHANGES", 2,
+		"exit status when changes were applied or are pending, 0 to exit successfully")
+}
+
+// addLoadFlags registers --skip-verify, --snapshot-repo, --substitute and
+// --var on commands that load snapshot files, see loadSnapshot.
+func (c *command) addLoadFlags() {
+	c.skipVerify = c.Bool("skip-verify", "SKIP_VERIFY", false, "load snapshot files that do not match their .sha256 checksum file")
+	c.snapshotRepo = addSnapshotRepoFlag(c)
+	c.substitute = c.Bool("substitute", "SUBSTITUTE_PLACEHOLDERS", false, "replace ${NAME} placeholders in snapshot files with --var values or environment variables")
+	c.addVarsFlag()
+}
+
+// loadOptions returns the options snapshot files are loaded with.
+// Placeholders are substituted with --substitute, or as soon as a value is
+// given with --var or the config file.
+func (c *command) loadOptions() gomigratedirectus.LoadOptions {
+	opts := gomigratedirectus.LoadOptions{SkipVerify: c.skipVerify != nil && *c.skipVerify}
+	if c.snapshotRepo != nil {
+		opts.Repository = *c.snapshotRepo
+	}
+	opts.Substitute = (c.substitute != nil && *c.substitute) || len(c.placeholders) > 0
+	opts.Vars = c.placeholders
+	return opts
+}
+
+// loadSnapshot loads the snapshot file at path, checked against its
+// checksum file unless --skip-verify is given, or the snapshot of the
+// --snapshot-repo repository path refers to as env@tag.
+func (c *command) loadSnapshot(path string) (*gomigratedirectus.Snapshot, error) {
+	return gomigratedirectus.LoadSnapshotWithOptions(path, c.loadOptions())
+}
+
+// changed returns the error that makes the process exit with the status of
+// --exit-code-on-changes, or nil when that status is 0.
+func (c *command) changed() error {
+	if *c.exitCodeOnChanges == 0 {
+		return nil
+	}
+	return &changesError{code: *c.exitCodeOnChanges}
+}
+
+// changesError makes the process exit with code, telling CI that changes were
+// applied or are pending. It is not an error as far as the user is concerned.
+type changesError struct {
+	code int
+}
+
+func (e *changesError) Error() string {
+	return fmt.Sprintf("changes found, exiting with status %d", e.code)
+}
+
+// context applies --timeout to ctx.
+func (c *command) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if *c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, *c.timeout)
+}
+
+// isSet reports whether the flag name was given on the command line.
+func (c *command) isSet(name string) bool {
+	return c.explicit[name]
+}
+
+// require resolves the environments selected with --from and --to and checks
+// that every client has the values it needs to connect, otherwise printing
+// the usage together with exactly what is missing.
+func (c *command) require(clients ...*clientFlags) error {
+	var missing []string
+	for _, client := range clients {
+		if err := client.applyEnvironment(c); err != nil {
+			return err
+		}
+		switch client.prefix {
+		case "BASE":
+			c.report.BaseURL = gomigratedirectus.RedactURL(*client.url)
+		case "TARGET":
+			c.report.TargetURL = gomigratedirectus.RedactURL(*client.url)
+		}
+		missing = append(missing, client.missing()...)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	c.flags.Usage()
+	return fmt.Errorf("missing required configuration:\n  %s", strings.Join(missing, "\n  "))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+
+	"golang.org/x/term"
+)
+
+// color reports whether output written to f is colored: f must be a
+// terminal, and neither --no-color nor NO_COLOR be set.
+func (c *command) color(f *os.File) bool {
+	if *c.noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return !c.jsonOutput && isTerminal(f)
+}
+
+// page writes out to the command output, through $PAGER (less by default)
+// when stdout is a terminal the output does not fit in and --no-pager is not
+// set. The output is written directly if the pager cannot be started.
+func (c *command) page(out []byte) error {
+	if !c.pageable(out) {
+		_, err := c.stdout.Write(out)
+		return err
+	}
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less"
+	}
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = bytes.NewReader(out)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Env = os.Environ()
+	if os.Getenv("LESS") == "" {
+		// Quit if the output fits after all, keep colors, and leave the
+		// output on the screen.
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	// The pager exits with a status of its own when quit early; only a
+	// pager that could not be started is an error, status 127 for sh.
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); err != nil && (!errors.As(err, &exitErr) || exitErr.ExitCode() == 127) {
+		slog.Debug("failed to run pager, writing output directly", "pager", pager, "error", err)
+		_, err := c.stdout.Write(out)
+		return err
+	}
+	return nil
+}
+
+// pageable reports whether out is taller than the terminal on stdout.
+func (c *command) pageable(out []byte) bool {
+	if *c.noPager || c.jsonOutput || c.stdout != io.Writer(os.Stdout) || !isTerminal(os.Stdout) || !isTerminal(os.Stdin) {
+		return false
+	}
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	return err == nil && height > 0 && bytes.Count(out, []byte("\n")) >= height
+}
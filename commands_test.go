@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// newProjects starts a base serving the snapshot of the latest fixture and a
+// target serving its diff without deletions, and runs the test in a temporary
+// directory for the files commands write.
+func newProjects(t *testing.T) (base, target *directustest.Server, f *directustest.Fixture) {
+	t.Helper()
+	versions := directustest.FixtureVersions()
+	f, err := directustest.LoadFixture(versions[len(versions)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	base, target = directustest.NewServer(t), directustest.NewServer(t)
+	base.UseFixture(f)
+	target.SetServerInfo(gomigratedirectus.ServerInfo{Version: f.Snapshot.Directus, Vendor: f.Snapshot.Vendor})
+	f.Diff.Diff.Fields = slices.DeleteFunc(f.Diff.Diff.Fields, func(field gomigratedirectus.FieldDiff) bool {
+		return gomigratedirectus.ClassifyEntries(field.Diff) == gomigratedirectus.ChangeDeleted
+	})
+	target.SetDiff(f.Diff)
+	return base, target, f
+}
+
+// runCommand runs a subcommand with args, ignoring the env file and the
+// connection settings of the environment, see isolate.
+func runCommand(t *testing.T, run func(context.Context, []string) error, args ...string) error {
+	t.Helper()
+	isolate(t)
+	return run(context.Background(), append(commandFlags(), args...))
+}
+
+// commandFlags returns the flags keeping a command from loading an env file
+// and from logging below errors.
+func commandFlags() []string {
+	return []string{"--env-file", os.DevNull, "--log-level", "error"}
+}
+
+// isolate clears the connection settings of the environment for the test, and
+// restores the logger and the shared transports after it.
+func isolate(t *testing.T) {
+	t.Helper()
+	for _, env := range []string{"BASE_URL", "BASE_TOKEN", "TARGET_URL", "TARGET_TOKEN", "EXIT_CODE_ON_CHANGES", "OUTPUT"} {
+		t.Setenv(env, "")
+	}
+	defaultLogger := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+		clear(transports)
+	})
+	clear(transports)
+}
+
+// exitCode returns the status the process exits with for err.
+func exitCode(err error) int {
+	var changes *changesError
+	switch {
+	case errors.As(err, &changes):
+		return changes.code
+	case err != nil:
+		return 1
+	}
+	return 0
+}
+
+func TestSnapshotCommand(t *testing.T) {
+	base, _, f := newProjects(t)
+	out := filepath.Join("schema", "base.json")
+
+	err := runCommand(t, runSnapshot, "--url", base.URL, "--token", directustest.Token, "--out", out, "--checksum")
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	snapshot, err := gomigratedirectus.LoadSnapshot(out)
+	if err != nil {
+		t.Fatalf("LoadSnapshot: %v", err)
+	}
+	if len(snapshot.Collections) != len(f.Snapshot.Collections) || len(snapshot.Fields) != len(f.Snapshot.Fields) {
+		t.Errorf("snapshot has %d collections and %d fields, want %d and %d",
+			len(snapshot.Collections), len(snapshot.Fields), len(f.Snapshot.Collections), len(f.Snapshot.Fields))
+	}
+
+	base.Fail("/schema/snapshot", 2, directustest.Failure{Status: 403})
+	if err := runCommand(t, runSnapshot, "--url", base.URL, "--token", directustest.Token, "--out", out); exitCode(err) != 1 {
+		t.Errorf("snapshot of a forbidden project = %v, want exit status 1", err)
+	}
+}
+
+func TestDiffCommand(t *testing.T) {
+	base, target, f := newProjects(t)
+	project := []string{"--base-url", base.URL, "--base-token", directustest.Token, "--url", target.URL, "--token", directustest.Token}
+
+	err := runCommand(t, runDiff, append(project, "--out", "pending.json")...)
+	if code := exitCode(err); code != 2 {
+		t.Fatalf("diff with changes = %v, want exit status 2", err)
+	}
+	data, err := os.ReadFile("pending.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := gomigratedirectus.ParseDiff(data)
+	if err != nil {
+		t.Fatalf("ParseDiff: %v", err)
+	}
+	if saved.Hash != f.Diff.Hash || len(saved.Diff.Fields) != len(f.Diff.Diff.Fields) {
+		t.Errorf("saved diff = %+v, want the diff of the target", saved)
+	}
+	if n := len(target.ApplyRequests()); n != 0 {
+		t.Errorf("diff applied %d times, want never", n)
+	}
+
+	if err := runCommand(t, runDiff, append(project, "--exit-code-on-changes", "0")...); exitCode(err) != 0 {
+		t.Errorf("diff with --exit-code-on-changes 0 = %v, want exit status 0", err)
+	}
+
+	target.SetDiff(nil)
+	if err := runCommand(t, runDiff, project...); exitCode(err) != 0 {
+		t.Errorf("diff in sync = %v, want exit status 0", err)
+	}
+
+	if err := runCommand(t, runDiff, "--url", target.URL, "--token", directustest.Token); exitCode(err) != 1 {
+		t.Errorf("diff without a base = %v, want exit status 1", err)
+	}
+}
+
+func TestApplyCommand(t *testing.T) {
+	_, target, f := newProjects(t)
+	data, err := json.Marshal(f.Diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("pending.json", data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	project := []string{"--url", target.URL, "--token", directustest.Token}
+
+	if err := runCommand(t, runApply, append(project, "--diff", "pending.json", "--yes")...); exitCode(err) != 0 {
+		t.Fatalf("apply = %v, want exit status 0", err)
+	}
+	applied := target.ApplyRequests()
+	if len(applied) != 1 || applied[0].Hash != f.Diff.Hash {
+		t.Errorf("target applied %+v, want the saved diff once", applied)
+	}
+	backups, _ := filepath.Glob(filepath.Join(gomigratedirectus.DefaultBackupDir, "target-*.json"))
+	if len(backups) == 0 {
+		t.Error("no backup taken before applying")
+	}
+
+	target.Fail("/schema/apply", 2, directustest.Failure{Status: 400, Message: "Invalid payload."})
+	if err := runCommand(t, runApply, append(project, "--diff", "pending.json", "--yes", "--no-backup")...); exitCode(err) != 1 {
+		t.Errorf("apply rejected by Directus = %v, want exit status 1", err)
+	}
+
+	if err := runCommand(t, runApply, project...); exitCode(err) != 1 {
+		t.Errorf("apply without --diff = %v, want exit status 1", err)
+	}
+}
+
+func TestMigrateCommand(t *testing.T) {
+	base, target, f := newProjects(t)
+	project := []string{"--base-url", base.URL, "--base-token", directustest.Token, "--target-url", target.URL, "--target-token", directustest.Token}
+
+	if err := runCommand(t, runMigrate, append(project, "--dry-run")...); exitCode(err) != 2 {
+		t.Errorf("dry run with changes = %v, want exit status 2", err)
+	}
+	if n := len(target.ApplyRequests()); n != 0 {
+		t.Errorf("dry run applied %d times, want never", n)
+	}
+
+	if err := runCommand(t, runMigrate, append(project, "--yes")...); exitCode(err) != 2 {
+		t.Fatalf("migrate with changes = %v, want exit status 2", err)
+	}
+	applied := target.ApplyRequests()
+	if len(applied) != 1 || applied[0].Hash != f.Diff.Hash {
+		t.Errorf("target applied %+v, want the diff once", applied)
+	}
+
+	// The diff was applied, so the target is now in sync.
+	if err := runCommand(t, runMigrate, append(project, "--yes")...); exitCode(err) != 0 {
+		t.Errorf("migrate in sync = %v, want exit status 0", err)
+	}
+
+	target.SetDiff(f.Diff)
+	target.Fail("/schema/apply", 2, directustest.Failure{Status: 400, Message: "Invalid payload."})
+	if err := runCommand(t, runMigrate, append(project, "--yes", "--no-backup")...); exitCode(err) != 1 {
+		t.Errorf("migrate rejected by Directus = %v, want exit status 1", err)
+	}
+}
+
+func TestMigrateCommandSystem(t *testing.T) {
+	s, err := gomigratedirectus.LoadSnapshot(filepath.Join("go-mirgrate-directus", "testdata", "system", "snapshot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, target, _ := newProjects(t)
+	base.SetSnapshot(s)
+	project := []string{"--base-url", base.URL, "--base-token", directustest.Token, "--target-url", target.URL, "--target-token", directustest.Token}
+
+	for _, tt := range []struct {
+		system string
+		want   []string
+	}{
+		{"include", []string{"articles.id", "articles.owner", "departments.id", "departments.name",
+			"directus_files.credit", "directus_users.department", "directus_users.nickname"}},
+		{"exclude", []string{"articles.id", "articles.owner", "departments.id", "departments.name"}},
+		{"ONLY", []string{"directus_files.credit", "directus_users.department", "directus_users.nickname"}},
+	} {
+		err := runCommand(t, runMigrate, append(project, "--dry-run", "--system", tt.system)...)
+		if code := exitCode(err); code != 0 && code != 2 {
+			t.Fatalf("migrate --system %s = %v", tt.system, err)
+		}
+		requests := target.DiffRequests()
+		var got []string
+		for _, field := range requests[len(requests)-1].Fields {
+			got = append(got, field.Collection+"."+field.Field)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("migrate --system %s sent the fields %v, want %v", tt.system, got, tt.want)
+		}
+	}
+
+	n := len(target.Requests())
+	if err := runCommand(t, runMigrate, append(project, "--dry-run", "--system", "some")...); exitCode(err) != 1 || err == nil {
+		t.Errorf("migrate --system some = %v, want an error", err)
+	}
+	if len(target.Requests()) != n {
+		t.Error("migrate with an invalid --system sent requests")
+	}
+}
+
+func TestMigrateCommandPlaceholders(t *testing.T) {
+	s, err := gomigratedirectus.LoadSnapshot(filepath.Join("go-mirgrate-directus", "testdata", "system", "snapshot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, target, _ := newProjects(t)
+	for i, field := range s.Fields {
+		if field.Collection == "departments" && field.Field == "name" {
+			s.Fields[i].Meta["note"] = "Listed on ${TEST_SITE_URL}/departments"
+			s.Fields[i].Meta["validation_message"] = "See ${TEST_DOCS_URL}/naming, not $${TEST_SITE_URL}"
+			s.Fields[i].Schema["default_value"] = "${TEST_SITE_URL}"
+		}
+	}
+	if err := gomigratedirectus.SaveSnapshot("schema.json", s); err != nil {
+		t.Fatal(err)
+	}
+	config := fmt.Sprintf(`environments:
+  staging:
+    url: https://staging.example.com
+  prod:
+    url: %s
+    token: %s
+placeholders:
+  - to: prod
+    vars:
+      TEST_SITE_URL: https://www.example.com
+  - from: staging
+    to: prod
+    vars:
+      TEST_DOCS_URL: https://docs.example.com
+  - to: staging
+    vars:
+      TEST_SITE_URL: https://staging.example.com
+`, target.URL, directustest.Token)
+	if err := os.WriteFile("directus-migrate.yaml", []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	migrate := func(args ...string) []byte {
+		t.Helper()
+		n := len(target.DiffRequests())
+		err := runCommand(t, runMigrate, append([]string{"--from-file", "schema.json", "--to", "prod", "--dry-run"}, args...)...)
+		if code := exitCode(err); code != 0 && code != 2 {
+			t.Fatalf("migrate %q = %v", args, err)
+		}
+		var body []byte
+		for _, req := range target.Requests() {
+			if req.Path == "/schema/diff" {
+				body = req.Body
+			}
+		}
+		if len(target.DiffRequests()) == n {
+			t.Fatalf("migrate %q sent no diff request", args)
+		}
+		return body
+	}
+
+	// The values of the environment pair reach Directus, and the escape
+	// stays a literal placeholder.
+	body := migrate("--from", "staging")
+	for _, want := range []string{
+		`"Listed on https://www.example.com/departments"`,
+		`"See https://docs.example.com/naming, not ${TEST_SITE_URL}"`,
+		`"default_value":"https://www.example.com"`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("diff request body does not contain %s:\n%s", want, body)
+		}
+	}
+
+	// --var wins over the config file.
+	body = migrate("--from", "staging", "--var", "TEST_SITE_URL=https://preview.example.com")
+	if !strings.Contains(string(body), `"default_value":"https://preview.example.com"`) {
+		t.Errorf("diff request body does not use the --var value:\n%s", body)
+	}
+
+	// Without --from the pair's variable is missing, which fails before any
+	// request is sent.
+	n := len(target.Requests())
+	err = runCommand(t, runMigrate, "--from-file", "schema.json", "--to", "prod", "--dry-run")
+	if exitCode(err) != 1 || !strings.Contains(fmt.Sprint(err), "variables not set: TEST_DOCS_URL") {
+		t.Errorf("migrate with a missing variable = %v, want an error naming TEST_DOCS_URL", err)
+	}
+	if len(target.Requests()) != n {
+		t.Error("migrate with a missing variable sent requests")
+	}
+}
+
+func TestVersionCommand(t *testing.T) {
+	isolate(t)
+	t.Chdir(t.TempDir())
+	var logs bytes.Buffer
+	w := stderr.w
+	stderr.w = &logs
+	t.Cleanup(func() { stderr.w = w })
+
+	// Neither the missing env file nor a config file that fails to load
+	// concerns the version.
+	for _, config := range []string{"", "missing.yaml"} {
+		t.Setenv("DIRECTUS_MIGRATE_CONFIG", config)
+		for _, args := range [][]string{{"--version"}, {"version"}} {
+			if code := run(context.Background(), args); code != 0 {
+				t.Errorf("run(%q) with config %q = %d, want 0", args, config, code)
+			}
+		}
+	}
+	if logs.Len() > 0 {
+		t.Errorf("version logged:\n%s", &logs)
+	}
+}
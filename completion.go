@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// runCompletion prints the shell completion script of shell:
+//
+//	completion bash|zsh|fish
+//
+// The scripts complete the commands and, for the flags, run the command with
+// -h and read them from its usage, so that they never fall behind the binary.
+func runCompletion(_ context.Context, args []string) error {
+	shells := []string{"bash", "zsh", "fish"}
+	if len(args) == 0 || !slices.Contains(shells, args[0]) {
+		fmt.Fprint(os.Stderr, "Usage: go-mirgrate-directus completion bash|zsh|fish\n")
+		if len(args) == 0 {
+			return fmt.Errorf("missing shell, bash, zsh or fish")
+		}
+		return fmt.Errorf("unknown shell %q, expected bash, zsh or fish", args[0])
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("unexpected argument %q", args[1])
+	}
+
+	commands := listCommands()
+	var script string
+	switch args[0] {
+	case "bash":
+		names := make([]string, 0, len(commands))
+		for _, c := range commands {
+			names = append(names, c.name)
+		}
+		script = strings.ReplaceAll(bashCompletion, "{{commands}}", strings.Join(names, " "))
+	case "zsh":
+		var described []string
+		for _, c := range commands {
+			described = append(described, "'"+c.name+":"+strings.ReplaceAll(c.description, "'", `'\''`)+"'")
+		}
+		script = strings.ReplaceAll(zshCompletion, "{{commands}}", strings.Join(described, "\n\t\t"))
+	case "fish":
+		var lines []string
+		for _, c := range commands {
+			lines = append(lines, fmt.Sprintf("complete -c go-mirgrate-directus -f -n __fish_use_subcommand -a %s -d %s",
+				c.name, fishQuote(c.description)))
+		}
+		script = strings.ReplaceAll(fishCompletion, "{{commands}}", strings.Join(lines, "\n"))
+	}
+	_, err := fmt.Fprint(os.Stdout, script)
+	return err
+}
+
+// commandInfo is a command listed by usage.
+type commandInfo struct {
+	name, description string
+}
+
+// listCommands returns the commands listed under "Commands:" in usage.
+func listCommands() []commandInfo {
+	_, list, _ := strings.Cut(usage, "Commands:\n")
+	list, _, _ = strings.Cut(list, "\n\n")
+	var commands []commandInfo
+	for _, line := range strings.Split(list, "\n") {
+		name, description, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if name != "" {
+			commands = append(commands, commandInfo{name: name, description: strings.TrimSpace(description)})
+		}
+	}
+	return commands
+}
+
+// fishQuote quotes s for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+const bashCompletion = `# bash completion for go-mirgrate-directus, load it with
+#   source <(go-mirgrate-directus completion bash)
+
+_go_mirgrate_directus() {
+	local cur=${COMP_WORDS[COMP_CWORD]} command=migrate
+	if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then
+		COMPREPLY=($(compgen -W "{{commands}}" -- "$cur"))
+		return
+	fi
+	[[ ${COMP_WORDS[1]} != -* ]] && command=${COMP_WORDS[1]}
+	if [[ $command == completion ]]; then
+		COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"))
+	elif [[ $cur == -* ]]; then
+		local flags=$("${COMP_WORDS[0]}" "$command" -h 2>&1 | sed -n 's/^  -\([a-z0-9-]*\).*/--\1/p')
+		COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+	fi
+}
+
+complete -o default -F _go_mirgrate_directus go-mirgrate-directus
+`
+
+const zshCompletion = `#compdef go-mirgrate-directus
+# zsh completion for go-mirgrate-directus, load it with
+#   source <(go-mirgrate-directus completion zsh)
+# or save it as _go-mirgrate-directus in a directory of $fpath.
+
+_go_mirgrate_directus() {
+	local command=migrate
+	if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then
+		local -a commands=(
+		{{commands}}
+		)
+		_describe command commands
+		return
+	fi
+	[[ $words[2] != -* ]] && command=$words[2]
+	if [[ $command == completion ]]; then
+		compadd bash zsh fish
+	elif [[ $words[CURRENT] == -* ]]; then
+		compadd -- ${(f)"$($words[1] $command -h 2>&1 | sed -n 's/^  -\([a-z0-9-]*\).*/--\1/p')"}
+	else
+		_files
+	fi
+}
+
+if [[ $funcstack[1] == _go-mirgrate-directus ]]; then
+	_go_mirgrate_directus "$@"
+else
+	compdef _go_mirgrate_directus go-mirgrate-directus
+fi
+`
+
+const fishCompletion = `# fish completion for go-mirgrate-directus, load it with
+#   go-mirgrate-directus completion fish | source
+
+function __go_mirgrate_directus_flags
+	set -l words (commandline -opc)
+	set -l command migrate
+	if test (count $words) -ge 2; and not string match -q -- '-*' $words[2]
+		set command $words[2]
+	end
+	$words[1] $command -h 2>&1 | string replace -rf '^  -([a-z0-9-]+).*' '--$1'
+end
+
+{{commands}}
+complete -c go-mirgrate-directus -f -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+complete -c go-mirgrate-directus -n 'string match -q -- "-*" (commandline -ct)' -a '(__go_mirgrate_directus_flags)'
+`
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// defaultConfigFile is loaded when --from or --to is used without --config.
+const defaultConfigFile = "directus-migrate.yaml"
+
+// config is the content of a config file:
+//
+//	defaults:
+//	  force: false
+//	environments:
+//	  dev:
+//	    url: https://dev.example.com
+//	    token: ${DEV_TOKEN}
+//	  prod:
+//	    url: https://prod.example.com
+//	    token_file: /run/secrets/directus-prod
+//	    hooks:
+//	      pre_apply: ./scripts/backup-db.sh
+//	      post_apply: npm run generate:types
+//	    notify:
+//	      slack_webhook_url: ${PROD_SLACK_WEBHOOK_URL}
+//	    overlays: [overlays/prod.yaml]
+//	  prod-eu:
+//	    url: https://eu.prod.example.com
+//	    token: ${PROD_EU_TOKEN}
+//	  all-prod:
+//	    targets: [prod, prod-eu]
+//	filters:
+//	  - from: dev
+//	    to: prod
+//	    exclude_collections: [analytics_*]
+//	    exclude_fields: ["*.webhook_url"]
+//	webhooks:
+//	  - from: dev
+//	    to: prod
+//	    urls:
+//	      https://hooks.dev.example.com: https://hooks.prod.example.com
+//	data:
+//	  - from: dev
+//	    to: prod
+//	    collections:
+//	      countries: {strategy: mirror}
+//	      plans: {fields: [name, price]}
+//	placeholders:
+//	  - to: prod
+//	    vars:
+//	      PUBLIC_URL: https://www.example.com
+//	lint:
+//	  required-fields: {fields: [status, sort]}
+//	  denied-types: {types: [csv]}
+//
+// ${NAME} references in string values are replaced with the environment
+// variable NAME so that secrets can stay out of the file.
+type config struct {
+	path string
+
+	Defaults     configDefaults                `yaml:"defaults"`
+	Environments map[string]*configEnvironment `yaml:"environments"`
+	Filters      []configFilter                `yaml:"filters"`
+	Webhooks     []configWebhooks              `yaml:"webhooks"`
+	Data         []configData                  `yaml:"data"`
+	Placeholders []configPlaceholders          `yaml:"placeholders"`
+	Lint         map[string]configLintRule     `yaml:"lint"`
+}
+
+// configDefaults are used for flags that are neither given on the command
+// line nor set in the environment.
+type configDefaults struct {
+	Force  *bool `yaml:"force"`
+	DryRun *bool `yaml:"dry_run"`
+}
+
+// configEnvironment is a project selected with --from or --to, or a group of
+// environments listed under targets that migrate selects with --to to migrate
+// to all of them.
+type configEnvironment struct {
+	URL       string       `yaml:"url"`
+	Token     string       `yaml:"token"`
+	TokenFile string       `yaml:"token_file"`
+	Email     string       `yaml:"email"`
+	Password  string       `yaml:"password"`
+	Targets   []string     `yaml:"targets"`
+	Hooks     configHooks  `yaml:"hooks"`
+	Notify    configNotify `yaml:"notify"`
+	Overlays  []string     `yaml:"overlays"`
+}
+
+// configNotify holds the notification URLs of migrations to an environment.
+// Values may reference environment variables.
+type configNotify struct {
+	SlackWebhookURL string `yaml:"slack_webhook_url"`
+	WebhookURL      string `yaml:"webhook_url"`
+}
+
+// configHooks are shell commands run at the stages of migrations to an
+// environment, see hookFlags.run.
+type configHooks struct {
+	PreSnapshot string `yaml:"pre_snapshot"`
+	PreApply    string `yaml:"pre_apply"`
+	PostApply   string `yaml:"post_apply"`
+	OnFailure   string `yaml:"on_failure"`
+}
+
+// empty reports whether no hook is configured.
+func (h configHooks) empty() bool {
+	return h == configHooks{}
+}
+
+// command returns the command of the hook stage.
+func (h configHooks) command(stage string) string {
+	switch stage {
+	case gomigratedirectus.HookPreSnapshot:
+		return h.PreSnapshot
+	case gomigratedirectus.HookPreApply:
+		return h.PreApply
+	case gomigratedirectus.HookPostApply:
+		return h.PostApply
+	case gomigratedirectus.HookOnFailure:
+		return h.OnFailure
+	}
+	return ""
+}
+
+// configFilter holds schema filter rules for migrations between the
+// environments selected with --from and --to. An empty from or to matches any
+// environment. The rules are added to those given with flags or environment
+// variables.
+type configFilter struct {
+	From               string   `yaml:"from"`
+	To                 string   `yaml:"to"`
+	IncludeCollections []string `yaml:"include_collections"`
+	ExcludeCollections []string `yaml:"exclude_collections"`
+	ExcludeFields      []string `yaml:"exclude_fields"`
+}
+
+// configWebhooks holds the webhook URL substitutions for migrations between
+// the environments selected with --from and --to, matched like filters.
+type configWebhooks struct {
+	From string            `yaml:"from"`
+	To   string            `yaml:"to"`
+	URLs map[string]string `yaml:"urls"`
+}
+
+// configData selects the collections whose items are synced by migrations
+// between the environments selected with --from and --to, matched like
+// filters.
+type configData struct {
+	From        string                           `yaml:"from"`
+	To          string                           `yaml:"to"`
+	Collections map[string]*configDataCollection `yaml:"collections"`
+}
+
+// configPlaceholders holds the values of the ${NAME} placeholders of
+// snapshot files for migrations between the environments selected with
+// --from and --to, matched like filters.
+type configPlaceholders struct {
+	From string            `yaml:"from"`
+	To   string            `yaml:"to"`
+	Vars map[string]string `yaml:"vars"`
+}
+
+// configLintRule changes a built-in rule of the lint command. Empty values
+// keep the default of the rule.
+type configLintRule struct {
+	Severity string   `yaml:"severity"`
+	Ignore   []string `yaml:"ignore"`
+	Fields   []string `yaml:"fields"`
+	Types    []string `yaml:"types"`
+}
+
+// configDataCollection configures the items synced of one collection. Empty
+// values fall back to --data-strategy and all fields.
+type configDataCollection struct {
+	Strategy string   `yaml:"strategy"`
+	Fields   []string `yaml:"fields"`
+}
+
+// loadConfig reads the config file at path. Environments are only checked
+// when they are selected, so that an unused one does not need its variables.
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	cfg := config{path: path}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to decode config file %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// environment returns the environment called name with its references
+// expanded and its token file read. Errors name the offending key, such as
+// environments.prod.token.
+func (c *config) environment(name string) (*configEnvironment, error) {
+	env, ok := c.Environments[name]
+	if !ok {
+		return nil, fmt.Errorf("environment %q is not defined in %s, available: %s",
+			name, c.path, strings.Join(slices.Sorted(maps.Keys(c.Environments)), ", "))
+	}
+	key := "environments." + name
+	if env == nil {
+		return nil, fmt.Errorf("invalid config file %s: %s: environment is empty", c.path, key)
+	}
+	if len(env.Targets) > 0 {
+		return nil, fmt.Errorf("environment %q in %s is a group of targets, it can only be used with --to of migrate", name, c.path)
+	}
+	resolved := *env
+
+	var problems []error
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{
+		{"url", &resolved.URL}, {"token", &resolved.Token}, {"token_file", &resolved.TokenFile},
+		{"email", &resolved.Email}, {"password", &resolved.Password},
+	} {
+		expanded, err := expandEnv(*field.value)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s.%s: %w", key, field.name, err))
+		}
+		*field.value = expanded
+	}
+	if len(problems) == 0 {
+		if resolved.URL == "" {
+			problems = append(problems, fmt.Errorf("%s.url: is required", key))
+		}
+		switch {
+		case resolved.Token != "" && resolved.TokenFile != "":
+			problems = append(problems, fmt.Errorf("%s: token and token_file are mutually exclusive", key))
+		case resolved.TokenFile != "":
+			tokenFile := resolved.TokenFile
+			if !filepath.IsAbs(tokenFile) {
+				tokenFile = filepath.Join(filepath.Dir(c.path), tokenFile)
+			}
+			token, err := os.ReadFile(tokenFile)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("%s.token_file: %w", key, err))
+			}
+			resolved.Token = strings.TrimSpace(string(token))
+		case resolved.Token == "" && (resolved.Email == "" || resolved.Password == ""):
+			problems = append(problems, fmt.Errorf("%s: either token, token_file or email and password must be set", key))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid config file %s: %w", c.path, errors.Join(problems...))
+	}
+	return &resolved, nil
+}
+
+// targets returns the environments selected by name: the members of a group,
+// or name itself.
+func (c *config) targets(name string) ([]string, error) {
+	env := c.Environments[name]
+	if env == nil || len(env.Targets) == 0 {
+		return []string{name}, nil
+	}
+	for _, member := range env.Targets {
+		if other := c.Environments[member]; other != nil && len(other.Targets) > 0 {
+			return nil, fmt.Errorf("invalid config file %s: environments.%s.targets: %s is a group itself, groups cannot be nested", c.path, name, member)
+		}
+	}
+	return env.Targets, nil
+}
+
+// hooks returns the hooks of the environment name, none if there is no
+// config file or name is empty.
+func (c *config) hooks(name string) configHooks {
+	if c == nil || c.Environments[name] == nil {
+		return configHooks{}
+	}
+	return c.Environments[name].Hooks
+}
+
+// overlays returns the overlay files of the environment name, relative to
+// the directory of the config file, none if there is no config file.
+func (c *config) overlays(name string) []string {
+	if c == nil || c.Environments[name] == nil {
+		return nil
+	}
+	paths := make([]string, len(c.Environments[name].Overlays))
+	for i, path := range c.Environments[name].Overlays {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(c.path), path)
+		}
+		paths[i] = path
+	}
+	return paths
+}
+
+// notify returns the notification URLs of the environment name with their
+// references expanded, none if there is no config file.
+func (c *config) notify(name string) (configNotify, error) {
+	if c == nil || c.Environments[name] == nil {
+		return configNotify{}, nil
+	}
+	notify := c.Environments[name].Notify
+	key := "environments." + name + ".notify"
+	var err error
+	if notify.SlackWebhookURL, err = expandEnv(notify.SlackWebhookURL); err != nil {
+		return configNotify{}, fmt.Errorf("invalid config file %s: %s.slack_webhook_url: %w", c.path, key, err)
+	}
+	if notify.WebhookURL, err = expandEnv(notify.WebhookURL); err != nil {
+		return configNotify{}, fmt.Errorf("invalid config file %s: %s.webhook_url: %w", c.path, key, err)
+	}
+	return notify, nil
+}
+
+// lintRules returns the default lint rules with the changes of the lint
+// section applied, the default rules if there is no config file.
+func (c *config) lintRules() (gomigratedirectus.LintRules, error) {
+	rules := gomigratedirectus.DefaultLintRules()
+	if c == nil {
+		return rules, nil
+	}
+	for id, change := range c.Lint {
+		rule, ok := rules[id]
+		if !ok {
+			return nil, fmt.Errorf("invalid config file %s: lint.%s: unknown rule, expected one of %s", c.path, id, strings.Join(gomigratedirectus.LintRuleIDs, ", "))
+		}
+		if change.Severity != "" {
+			rule.Severity = gomigratedirectus.LintSeverity(change.Severity)
+		}
+		if change.Ignore != nil {
+			rule.Ignore = change.Ignore
+		}
+		if change.Fields != nil {
+			rule.Fields = change.Fields
+		}
+		if change.Types != nil {
+			rule.Types = change.Types
+		}
+		rules[id] = rule
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", c.path, err)
+	}
+	return rules, nil
+}
+
+// filters returns the filter rules for a migration from the environment from
+// to the environment to, keyed by flag name.
+func (c *config) filters(from, to string) map[string][]string {
+	values := map[string][]string{}
+	for _, filter := range c.Filters {
+		if (filter.From != "" && filter.From != from) || (filter.To != "" && filter.To != to) {
+			continue
+		}
+		values["include"] = append(values["include"], filter.IncludeCollections...)
+		values["exclude"] = append(values["exclude"], filter.ExcludeCollections...)
+		values["exclude-field"] = append(values["exclude-field"], filter.ExcludeFields...)
+	}
+	return values
+}
+
+// webhookURLs returns the webhook URL substitutions for a migration from the
+// environment from to the environment to, as values of --webhook-url. Values
+// may reference environment variables.
+func (c *config) webhookURLs(from, to string) ([]string, error) {
+	var values []string
+	for _, webhooks := range c.Webhooks {
+		if (webhooks.From != "" && webhooks.From != from) || (webhooks.To != "" && webhooks.To != to) {
+			continue
+		}
+		for _, old := range slices.Sorted(maps.Keys(webhooks.URLs)) {
+			replacement, err := expandEnv(webhooks.URLs[old])
+			if err != nil {
+				return nil, fmt.Errorf("invalid config file %s: webhooks.urls.%s: %w", c.path, old, err)
+			}
+			values = append(values, old+"="+replacement)
+		}
+	}
+	return values, nil
+}
+
+// placeholders returns the placeholder values for a migration from the
+// environment from to the environment to; later entries win. Values may
+// reference environment variables.
+func (c *config) placeholders(from, to string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, placeholders := range c.Placeholders {
+		if (placeholders.From != "" && placeholders.From != from) || (placeholders.To != "" && placeholders.To != to) {
+			continue
+		}
+		for name, value := range placeholders.Vars {
+			expanded, err := expandEnv(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid config file %s: placeholders.vars.%s: %w", c.path, name, err)
+			}
+			vars[name] = expanded
+		}
+	}
+	return vars, nil
+}
+
+// data returns the data collections for a migration from the environment from
+// to the environment to, as values of --data-collection and --data-field.
+func (c *config) data(from, to string) (collections, fields []string) {
+	for _, data := range c.Data {
+		if (data.From != "" && data.From != from) || (data.To != "" && data.To != to) {
+			continue
+		}
+		for _, name := range slices.Sorted(maps.Keys(data.Collections)) {
+			collection := data.Collections[name]
+			if collection == nil {
+				collection = &configDataCollection{}
+			}
+			value := name
+			if collection.Strategy != "" {
+				value += "=" + collection.Strategy
+			}
+			collections = append(collections, value)
+			for _, field := range collection.Fields {
+				fields = append(fields, name+"."+field)
+			}
+		}
+	}
+	return collections, fields
+}
+
+// values returns the configured defaults keyed by flag name.
+func (d configDefaults) values() map[string]string {
+	values := map[string]string{}
+	if d.Force != nil {
+		values["force"] = strconv.FormatBool(*d.Force)
+	}
+	if d.DryRun != nil {
+		values["dry-run"] = strconv.FormatBool(*d.DryRun)
+	}
+	return values
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} references in value with the environment
+// variable NAME, failing when it is not set.
+func expandEnv(value string) (string, error) {
+	var missing []string
+	expanded := envReference.ReplaceAllStringFunc(value, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// addYesFlag registers --yes and its shorthand -y, falling back to
+// AUTO_APPROVE.
+func addYesFlag(cmd *command) *bool {
+	yes := cmd.Bool("yes", "AUTO_APPROVE", false, "apply without asking for confirmation")
+	cmd.flags.BoolVar(yes, "y", false, "shorthand for --yes")
+	return yes
+}
+
+// errNotInteractive is returned instead of prompting when nobody can answer.
+var errNotInteractive = errors.New("stdin is not a terminal, pass --yes (or set AUTO_APPROVE=true) to apply without confirmation")
+
+// confirmChanges returns a ConfirmFunc that prints the diff and its summary
+// to out, colored if color is set, and asks on in whether to apply it. It
+// fails with errNotInteractive when in is not a terminal.
+func confirmChanges(in *os.File, out io.Writer, color bool) gomigratedirectus.ConfirmFunc {
+	return func(ctx context.Context, target string, diff *gomigratedirectus.Diff, summary gomigratedirectus.DiffSummary) (bool, error) {
+		if !isTerminal(in) {
+			return false, errNotInteractive
+		}
+
+		if err := gomigratedirectus.RenderDiffWithOptions(diff, out, gomigratedirectus.RenderOptions{Color: color}); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(out, "\n%s.\n", summary)
+		if n := summary.Deletions(); n > 0 {
+			fmt.Fprintf(out, "WARNING: %d item(s) will be DELETED, together with the data they hold.\n", n)
+		}
+		fmt.Fprintf(out, "\nApply these changes to %s? [y/N] ", target)
+
+		answer := make(chan string, 1)
+		go func() {
+			line, _ := bufio.NewReader(in).ReadString('\n')
+			answer <- line
+		}()
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(out)
+			return false, ctx.Err()
+		case line := <-answer:
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "y", "yes":
+				return true, nil
+			default:
+				return false, nil
+			}
+		}
+	}
+}
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
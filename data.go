@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// dataFlags configures the sync of collection items after a migration.
+type dataFlags struct {
+	collections *[]string
+	fields      *[]string
+	strategy    *string
+	batchSize   *int
+}
+
+// addDataFlags registers --data-collection, --data-field, --data-strategy and
+// --data-batch-size.
+func addDataFlags(cmd *command) dataFlags {
+	return dataFlags{
+		collections: cmd.Strings("data-collection", "DATA_COLLECTIONS", "collection whose items are synced, as name or name=strategy"),
+		fields:      cmd.Strings("data-field", "DATA_FIELDS", "field to sync of a data collection, as collection.field; unlisted collections sync all fields"),
+		strategy:    cmd.String("data-strategy", "DATA_STRATEGY", string(gomigratedirectus.DataUpsert), "default data strategy: upsert, insert-only or mirror"),
+		batchSize:   cmd.Int("data-batch-size", "DATA_BATCH_SIZE", gomigratedirectus.DefaultDataBatchSize, "items read per page and written per request"),
+	}
+}
+
+// apply copies the flags to opts.
+func (f dataFlags) apply(opts *gomigratedirectus.MigrationOptions) error {
+	opts.DataBatchSize = *f.batchSize
+	if opts.DataBatchSize <= 0 {
+		return fmt.Errorf("invalid --data-batch-size %d, expected a positive number", opts.DataBatchSize)
+	}
+	index := map[string]int{}
+	for _, value := range *f.collections {
+		name, strategy, ok := strings.Cut(value, "=")
+		if !ok {
+			strategy = *f.strategy
+		}
+		collection := gomigratedirectus.DataCollection{
+			Collection: name,
+			Strategy:   gomigratedirectus.DataStrategy(strings.ToLower(strategy)),
+		}
+		switch collection.Strategy {
+		case gomigratedirectus.DataUpsert, gomigratedirectus.DataInsertOnly, gomigratedirectus.DataMirror:
+		default:
+			return fmt.Errorf("invalid data strategy %q for %s, expected upsert, insert-only or mirror", strategy, name)
+		}
+		if _, seen := index[name]; seen || name == "" {
+			return fmt.Errorf("invalid --data-collection %q, expected each collection once as name or name=strategy", value)
+		}
+		index[name] = len(opts.DataCollections)
+		opts.DataCollections = append(opts.DataCollections, collection)
+	}
+	for _, value := range *f.fields {
+		name, field, ok := strings.Cut(value, ".")
+		i, selected := index[name]
+		if !ok || field == "" || !selected {
+			return fmt.Errorf("invalid --data-field %q, expected collection.field of a --data-collection", value)
+		}
+		opts.DataCollections[i].Fields = append(opts.DataCollections[i].Fields, field)
+	}
+	return nil
+}
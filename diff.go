@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// runDiff computes the diff between a snapshot and the target project without
+// applying it. The snapshot is read from --snapshot, or taken from the live
+// base project when no file is given. The diff is printed as a tree followed
+// by a summary, or as the raw JSON returned by Directus with --format json or
+// --raw, or as a Markdown report for a pull request comment with --format
+// markdown, or as an illustrative DDL preview with --format sql, in the
+// --dialect of the database or of the snapshot vendor, and --out saves it
+// for the apply command. --format json-patch and
+// --format merge-patch print instead the RFC 6902 JSON Patch or RFC 7386 JSON
+// Merge Patch that turns the target snapshot into the snapshot, for review:
+//
+//	diff [--snapshot file | --base-url url --base-token token]
+//	     [--url url] [--token token] [--force] [--format format [--dialect name]] [--raw] [--out file]
+//	     [--include pattern]... [--exclude pattern]... [--exit-code-on-changes code]
+//	     [--overlay file]... [--strict-overlays]
+//
+// With --file-a and --file-b it compares two snapshot files offline instead,
+// showing the changes from a to b:
+//
+//	diff --file-a old.yaml --file-b new.yaml [--include pattern]... [--exclude pattern]... [--format format]
+//
+// The command exits with status 0 when the schemas are in sync, 2 (or the
+// --exit-code-on-changes status) when changes are pending and 1 on errors.
+func runDiff(ctx context.Context, args []string) (err error) {
+	cmd := newCommand("diff")
+	defer func() { err = cmd.finish(err) }()
+	cmd.addExitCodeFlag()
+	cmd.addLoadFlags()
+	path := cmd.String("snapshot", "", "", "snapshot file to diff (default: live snapshot of the base project)")
+	base := addClientFlags(cmd, "base", "BASE")
+	target := addClientFlags(cmd, "", "TARGET")
+	force := cmd.Bool("force", "FORCE", false, "compute the diff even if Directus versions differ")
+	format := cmd.String("format", "", "text", "diff format: text, json, markdown, sql, json-patch or merge-patch")
+	dialect := cmd.String("dialect", "", "", "SQL dialect of --format sql: postgres, mysql or sqlite (default: the vendor of the snapshot, or postgres)")
+	raw := cmd.Bool("raw", "", false, "print the diff as raw JSON, like --format json")
+	out := cmd.String("out", "", "", "file to save the diff to for the apply command")
+	fileA := cmd.String("file-a", "", "", "old snapshot file to compare offline with --file-b")
+	fileB := cmd.String("file-b", "", "", "new snapshot file to compare offline with --file-a")
+	filters := addFilterFlags(cmd)
+	overlays := addOverlayFlags(cmd)
+	lenientRelations := addRelationsFlag(cmd)
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	if *raw {
+		*format = diffFormatJSON
+	}
+	if !slices.Contains(diffFormats, *format) {
+		return fmt.Errorf("invalid --format %q, must be one of %s", *format, strings.Join(diffFormats, ", "))
+	}
+	if *dialect != "" && !slices.Contains(sqlDialects, strings.ToLower(*dialect)) {
+		return fmt.Errorf("invalid --dialect %q, must be one of %s", *dialect, strings.Join(sqlDialects, ", "))
+	}
+	if *fileA != "" || *fileB != "" {
+		if *fileA == "" || *fileB == "" {
+			cmd.flags.Usage()
+			return fmt.Errorf("--file-a and --file-b must be given together")
+		}
+		if *out != "" {
+			return fmt.Errorf("--out cannot be used with --file-a and --file-b, offline diffs cannot be applied")
+		}
+		return compareFiles(cmd, *fileA, *fileB, filters, *format, *dialect)
+	}
+	if err := filters.filter().Validate(); err != nil {
+		return err
+	}
+	required := []*clientFlags{target}
+	if *path == "" {
+		required = []*clientFlags{base, target}
+	}
+	if err := cmd.require(required...); err != nil {
+		return err
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	targetClient, err := target.newClient()
+	if err != nil {
+		return err
+	}
+
+	var snapshot *gomigratedirectus.Snapshot
+	if *path != "" {
+		snapshot, err = cmd.loadSnapshot(*path)
+	} else {
+		var baseClient *gomigratedirectus.DirectusClient
+		if baseClient, err = base.newClient(); err != nil {
+			return err
+		}
+		snapshot, err = baseClient.GetSnapshot(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("Diff failed: %w", err)
+	}
+
+	if snapshot, err = overlays.snapshot(cmd, snapshot); err != nil {
+		return fmt.Errorf("Diff failed: %w", err)
+	}
+	snapshot = filters.snapshot(snapshot)
+	if err := checkRelations(snapshot, *lenientRelations); err != nil {
+		return fmt.Errorf("Diff failed: %w", err)
+	}
+	diff, err := targetClient.GetDiff(ctx, snapshot, *force)
+	if err == nil {
+		if diff = filters.diff(diff); diff.IsEmpty() {
+			err = gomigratedirectus.ErrNoChanges
+		}
+	}
+	if errors.Is(err, gomigratedirectus.ErrNoChanges) {
+		var args []any
+		if n := len(filters.filteredFields); n > 0 {
+			args = append(args, "filtered_fields", n)
+		}
+		slog.Info("schemas already in sync", args...)
+		return printInSync(cmd, *format, len(filters.filteredFields))
+	}
+	if err != nil {
+		return fmt.Errorf("Diff failed: %w", err)
+	}
+	summary := filters.summarize(diff)
+	cmd.report.Changed, cmd.report.Summary, cmd.report.Diff = true, &summary, diff
+
+	if *out != "" {
+		data, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Diff failed: %w", err)
+		}
+		if err := os.WriteFile(*out, append(data, '\n'), 0o644); err != nil {
+			return fmt.Errorf("Diff failed: %w", err)
+		}
+		slog.Info("diff written", "path", *out)
+		cmd.report.File = *out
+	}
+
+	if isPatchFormat(*format) {
+		current, err := targetClient.GetSnapshot(ctx)
+		if err != nil {
+			return fmt.Errorf("Diff failed: failed to get target snapshot: %w", err)
+		}
+		if filter := filters.filter(); !filter.IsZero() {
+			current = gomigratedirectus.FilterSnapshot(current, filter).Snapshot
+		}
+		if err := printPatch(cmd, current, snapshot, *format); err != nil {
+			return fmt.Errorf("Diff failed: %w", err)
+		}
+		return cmd.changed()
+	}
+	if *format == diffFormatSQL {
+		if err := printSQL(cmd, diff, *dialect, snapshot.Vendor); err != nil {
+			return fmt.Errorf("Diff failed: %w", err)
+		}
+		return cmd.changed()
+	}
+	if err := printDiff(cmd, diff, summary, *format); err != nil {
+		return err
+	}
+	return cmd.changed()
+}
+
+// compareFiles implements diff --file-a --file-b.
+func compareFiles(cmd *command, pathA, pathB string, filters filterFlags, format, dialect string) error {
+	filter := filters.filter()
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	a, err := cmd.loadSnapshot(pathA)
+	if err != nil {
+		return fmt.Errorf("Diff failed: %w", err)
+	}
+	b, err := cmd.loadSnapshot(pathB)
+	if err != nil {
+		return fmt.Errorf("Diff failed: %w", err)
+	}
+	if !filter.IsZero() {
+		filteredA, filteredB := gomigratedirectus.FilterSnapshot(a, filter), gomigratedirectus.FilterSnapshot(b, filter)
+		filters.countFilteredFields(filteredA.ExcludedFields)
+		filters.countFilteredFields(filteredB.ExcludedFields)
+		a, b = filteredA.Snapshot, filteredB.Snapshot
+	}
+	comparison, err := gomigratedirectus.CompareSnapshots(a, b)
+	if err != nil {
+		return fmt.Errorf("Diff failed: %w", err)
+	}
+	comparison.Summary.FilteredFields = len(filters.filteredFields)
+	if !comparison.Changed() {
+		slog.Info("snapshots are identical", "file_a", pathA, "file_b", pathB)
+		return printInSync(cmd, format, len(filters.filteredFields))
+	}
+
+	cmd.report.Changed, cmd.report.Summary, cmd.report.Diff = true, &comparison.Summary, comparison.Diff
+	if isPatchFormat(format) {
+		if err := printPatch(cmd, a, b, format); err != nil {
+			return fmt.Errorf("Diff failed: %w", err)
+		}
+		return cmd.changed()
+	}
+	if format == diffFormatSQL {
+		if err := printSQL(cmd, comparison.Diff, dialect, b.Vendor); err != nil {
+			return fmt.Errorf("Diff failed: %w", err)
+		}
+		return cmd.changed()
+	}
+	if err := printDiff(cmd, comparison.Diff, comparison.Summary, format); err != nil {
+		return err
+	}
+	return cmd.changed()
+}
+
+// Formats of the diff command.
+const (
+	diffFormatText       = "text"
+	diffFormatJSON       = "json"
+	diffFormatMarkdown   = "markdown"
+	diffFormatSQL        = "sql"
+	diffFormatJSONPatch  = "json-patch"
+	diffFormatMergePatch = "merge-patch"
+)
+
+// diffFormats lists the values of --format.
+var diffFormats = []string{diffFormatText, diffFormatJSON, diffFormatMarkdown, diffFormatSQL, diffFormatJSONPatch, diffFormatMergePatch}
+
+// sqlDialects lists the values of --dialect.
+var sqlDialects = []string{
+	string(gomigratedirectus.DialectPostgres), string(gomigratedirectus.DialectMySQL), string(gomigratedirectus.DialectSQLite),
+}
+
+// isPatchFormat reports whether format prints a patch between snapshots
+// rather than the diff.
+func isPatchFormat(format string) bool {
+	return format == diffFormatJSONPatch || format == diffFormatMergePatch
+}
+
+// printSQL writes the DDL preview of diff in dialect, or by default in the
+// dialect of vendor, the database of the snapshot, falling back to postgres.
+func printSQL(cmd *command, diff *gomigratedirectus.Diff, dialect, vendor string) error {
+	if dialect == "" {
+		dialect = string(gomigratedirectus.DialectPostgres)
+		if d, ok := gomigratedirectus.DialectForVendor(vendor); ok {
+			dialect = string(d)
+		}
+	}
+	return gomigratedirectus.RenderDiffSQL(diff, cmd.stdout, gomigratedirectus.SQLDialect(strings.ToLower(dialect)))
+}
+
+// printPatch writes the JSON Patch or JSON Merge Patch, per format, that
+// turns snapshot from into snapshot to to the command output.
+func printPatch(cmd *command, from, to *gomigratedirectus.Snapshot, format string) error {
+	var patch any
+	var err error
+	if format == diffFormatMergePatch {
+		patch, err = gomigratedirectus.MergePatch(from, to)
+	} else {
+		patch, err = gomigratedirectus.JSONPatch(from, to)
+	}
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(cmd.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(patch)
+}
+
+// printInSync writes the Markdown report of no changes with the markdown
+// format, so that a pull request comment it updates says so, and nothing
+// with the other formats.
+func printInSync(cmd *command, format string, filteredFields int) error {
+	if format != diffFormatMarkdown {
+		return nil
+	}
+	report := gomigratedirectus.RenderMarkdownWithOptions(nil, gomigratedirectus.MarkdownOptions{FilteredFields: filteredFields})
+	_, err := io.WriteString(cmd.stdout, report)
+	return err
+}
+
+// printDiff writes diff to the command output as indented JSON with the json
+// format, as a Markdown report with the markdown format, or as a tree
+// followed by its summary, colored and paged on a terminal.
+func printDiff(cmd *command, diff *gomigratedirectus.Diff, summary gomigratedirectus.DiffSummary, format string) error {
+	if format == diffFormatJSON {
+		encoder := json.NewEncoder(cmd.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	}
+	if format == diffFormatMarkdown {
+		report := gomigratedirectus.RenderMarkdownWithOptions(diff, gomigratedirectus.MarkdownOptions{FilteredFields: summary.FilteredFields})
+		_, err := io.WriteString(cmd.stdout, report)
+		return err
+	}
+	var out bytes.Buffer
+	if err := gomigratedirectus.RenderDiffWithOptions(diff, &out, gomigratedirectus.RenderOptions{Color: cmd.color(os.Stdout)}); err != nil {
+		return err
+	}
+	fmt.Fprintf(&out, "\n%s.\n", summary)
+	return cmd.page(out.Bytes())
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// filterFlags selects the collections and fields a command covers. The config
+// file can add rules per pair of environments.
+type filterFlags struct {
+	include       *[]string
+	exclude       *[]string
+	excludeFields *[]string
+	system        *string
+
+	// filteredFields collects the fields removed by --exclude-field.
+	filteredFields map[string]bool
+}
+
+// addFilterFlags registers --include, --exclude, --exclude-field and --system.
+func addFilterFlags(cmd *command) filterFlags {
+	return filterFlags{
+		include:        cmd.Strings("include", "INCLUDE_COLLECTIONS", "only cover the collections matching this name or glob"),
+		exclude:        cmd.Strings("exclude", "EXCLUDE_COLLECTIONS", "leave out the collections matching this name or glob"),
+		excludeFields:  cmd.Strings("exclude-field", "EXCLUDE_FIELDS", "leave out the fields matching this collection.field pattern"),
+		system:         cmd.String("system", "SYSTEM_COLLECTIONS", string(gomigratedirectus.SystemInclude), "whether to migrate custom fields of directus_* system collections: include, exclude or only"),
+		filteredFields: map[string]bool{},
+	}
+}
+
+// addOnlyFlag registers --only, which limits a migration to the named
+// collections and their junction collections; see
+// MigrationOptions.ScopeCollections.
+func addOnlyFlag(cmd *command) *[]string {
+	return cmd.Strings("only", "ONLY", "only migrate this collection, with the junction collections between the named ones")
+}
+
+// filter returns the SchemaFilter of the flags.
+func (f filterFlags) filter() gomigratedirectus.SchemaFilter {
+	return gomigratedirectus.SchemaFilter{
+		IncludeCollections: *f.include,
+		ExcludeCollections: *f.exclude,
+		ExcludeFields:      *f.excludeFields,
+		SystemCollections:  gomigratedirectus.SystemCollectionsPolicy(strings.ToLower(*f.system)),
+	}
+}
+
+// apply copies the flags to opts.
+func (f filterFlags) apply(opts *gomigratedirectus.MigrationOptions) {
+	filter := f.filter()
+	opts.IncludeCollections = filter.IncludeCollections
+	opts.ExcludeCollections = filter.ExcludeCollections
+	opts.ExcludeFields = filter.ExcludeFields
+	opts.SystemCollections = filter.SystemCollections
+}
+
+// snapshot narrows snapshot to the filtered collections and fields, warning about the
+// relations that are dropped.
+func (f filterFlags) snapshot(snapshot *gomigratedirectus.Snapshot) *gomigratedirectus.Snapshot {
+	filter := f.filter()
+	if filter.IsZero() {
+		return snapshot
+	}
+	filtered := gomigratedirectus.FilterSnapshot(snapshot, filter)
+	slog.Info("snapshot filtered", "collections", len(filtered.Snapshot.Collections), "excluded", len(filtered.ExcludedCollections),
+		"excluded_fields", len(filtered.ExcludedFields))
+	f.countFilteredFields(filtered.ExcludedFields)
+	for _, relation := range filtered.DroppedRelations {
+		slog.Warn("dropping relation between an included and an excluded collection",
+			"collection", relation.Collection, "field", relation.Field, "related_collection", relation.RelatedCollection)
+	}
+	return filtered.Snapshot
+}
+
+// diff narrows diff to the filtered collections and fields.
+func (f filterFlags) diff(diff *gomigratedirectus.Diff) *gomigratedirectus.Diff {
+	filter := f.filter()
+	if filter.IsZero() {
+		return diff
+	}
+	filtered := gomigratedirectus.FilterDiff(diff, filter)
+	f.countFilteredFields(filtered.ExcludedFields)
+	return filtered.Diff
+}
+
+func (f filterFlags) countFilteredFields(fields []string) {
+	for _, field := range fields {
+		f.filteredFields[field] = true
+	}
+}
+
+// summarize summarizes diff, noting the fields removed by --exclude-field.
+func (f filterFlags) summarize(diff *gomigratedirectus.Diff) gomigratedirectus.DiffSummary {
+	summary := gomigratedirectus.SummarizeDiff(diff)
+	summary.FilteredFields = len(f.filteredFields)
+	return summary
+}
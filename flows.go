@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// flowFlags configures the sync of flows and operations after a migration.
+type flowFlags struct {
+	sync        *bool
+	prune       *bool
+	keepOptions *bool
+	secrets     *string
+}
+
+// addFlowFlags registers --with-flows, --prune-flows, --keep-flow-options and
+// --flow-secrets.
+func addFlowFlags(cmd *command) flowFlags {
+	return flowFlags{
+		sync:        cmd.Bool("with-flows", "SYNC_FLOWS", false, "also sync flows and their operations"),
+		prune:       cmd.Bool("prune-flows", "PRUNE_FLOWS", false, "delete inactive target flows that the base does not have"),
+		keepOptions: cmd.Bool("keep-flow-options", "KEEP_FLOW_OPTIONS", false, "keep the options of operations that already exist on the target"),
+		secrets:     cmd.String("flow-secrets", "FLOW_SECRETS", "", "YAML file mapping strings in base operation options to their target values"),
+	}
+}
+
+// apply copies the flags to opts, reading the secrets file.
+func (f flowFlags) apply(opts *gomigratedirectus.MigrationOptions) error {
+	opts.SyncFlows = *f.sync
+	opts.PruneFlows = *f.prune
+	opts.KeepFlowOptions = *f.keepOptions
+	if *f.secrets == "" {
+		return nil
+	}
+	secrets, err := loadFlowSecrets(*f.secrets)
+	if err != nil {
+		return err
+	}
+	opts.FlowSecrets = secrets
+	return nil
+}
+
+// loadFlowSecrets reads a secrets file, a YAML mapping of the strings used in
+// the base to those to use on the target:
+//
+//	https://hooks.example.com/staging: https://hooks.example.com/prod
+//	staging-api-token: ${PROD_API_TOKEN}
+//
+// Values may reference environment variables, so that the file itself holds
+// no secrets of the target.
+func loadFlowSecrets(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flow secrets file: %w", err)
+	}
+
+	var secrets map[string]string
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&secrets); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to decode flow secrets file %s: %w", path, err)
+	}
+	// Keys are not named in errors, as they are secrets of the base.
+	for from, to := range secrets {
+		expanded, err := expandEnv(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flow secrets file %s: %w", path, err)
+		}
+		secrets[from] = expanded
+	}
+	return secrets, nil
+}
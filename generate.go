@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// runGenerate generates code from a snapshot file, or from the live snapshot
+// of the base project when no file is given. The go generator writes a Go
+// struct per collection, the ts generator TypeScript interfaces for the
+// Directus JS SDK, and the erd generator an entity-relationship diagram:
+//
+//	generate go [--snapshot file | --url url --token token]
+//	            [--package name] [--nested-relations] [--out file]
+//	generate ts [--snapshot file | --url url --token token] [--out file]
+//	generate erd [--snapshot file | --url url --token token] [--format mermaid|dot]
+//	             [--include pattern]... [--exclude pattern]... [--system exclude] [--out file]
+func runGenerate(ctx context.Context, args []string) (err error) {
+	if len(args) == 0 || !slices.Contains([]string{"go", "ts", "erd"}, args[0]) {
+		fmt.Fprint(os.Stderr, "Usage: go-mirgrate-directus generate go|ts|erd [flags]\n")
+		if len(args) == 0 {
+			return fmt.Errorf("missing generator, go, ts or erd")
+		}
+		return fmt.Errorf("unknown generator %q, expected go, ts or erd", args[0])
+	}
+	generator := args[0]
+	cmd := newCommand("generate " + generator)
+	defer func() { err = cmd.finish(err) }()
+	path := cmd.String("snapshot", "", "", "snapshot file to generate code from (default: live snapshot of the base project)")
+	cmd.addLoadFlags()
+	base := addClientFlags(cmd, "", "BASE")
+	var goOpts gomigratedirectus.GoOptions
+	if generator == "go" {
+		cmd.flags.StringVar(&goOpts.Package, "package", "models", "package of the generated file")
+		cmd.flags.BoolVar(&goOpts.NestedRelations, "nested-relations", false, "type many-to-one fields as a pointer to the related struct instead of its key")
+	}
+	var erdFormat *string
+	var filters filterFlags
+	if generator == "erd" {
+		erdFormat = cmd.String("format", "", string(gomigratedirectus.ERDMermaid), "diagram format, mermaid or dot")
+		filters = addFilterFlags(cmd)
+	}
+	out := cmd.String("out", "", "", "file to write the generated code to (default stdout)")
+	if err := cmd.parse(args[1:]); err != nil {
+		return err
+	}
+	if cmd.jsonOutput && *out == "" {
+		return fmt.Errorf("--output json needs --out, stdout carries the report")
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	var snapshot *gomigratedirectus.Snapshot
+	if *path != "" {
+		if snapshot, err = cmd.loadSnapshot(*path); err != nil {
+			return fmt.Errorf("Generation failed: %w", err)
+		}
+	} else {
+		if err := cmd.require(base); err != nil {
+			return err
+		}
+		client, err := base.newClient()
+		if err != nil {
+			return err
+		}
+		if snapshot, err = client.GetSnapshot(ctx); err != nil {
+			return fmt.Errorf("Generation failed: %w", err)
+		}
+	}
+
+	var code []byte
+	switch generator {
+	case "go":
+		code, err = gomigratedirectus.GenerateGo(snapshot, goOpts)
+	case "ts":
+		code, err = gomigratedirectus.GenerateTypeScript(snapshot)
+	case "erd":
+		var diagram string
+		diagram, err = gomigratedirectus.GenerateERD(snapshot, gomigratedirectus.ERDOptions{
+			Format: gomigratedirectus.ERDFormat(*erdFormat),
+			Filter: filters.filter(),
+		})
+		code = []byte(diagram)
+	}
+	if err != nil {
+		return fmt.Errorf("Generation failed: %w", err)
+	}
+	if *out == "" {
+		_, err = cmd.stdout.Write(code)
+		return err
+	}
+	if err := os.WriteFile(*out, code, 0o644); err != nil {
+		return fmt.Errorf("Generation failed: %w", err)
+	}
+	slog.Info("code generated", "path", *out)
+	cmd.report.File = *out
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultGitMessage is the default of --git-message.
+const defaultGitMessage = "Update schema snapshot {{.Path}}\n\nBase: {{.BaseURL}}\nDirectus: {{.Directus}}\nSchema hash: {{.Hash}}\n"
+
+// gitFlags configures the commit of the snapshot written by snapshot --out
+// with --git-commit.
+type gitFlags struct {
+	commit  *bool
+	message *string
+	tag     *string
+	branch  *string
+	push    *bool
+	remote  *string
+
+	messageTemplate, tagTemplate *template.Template
+}
+
+// addGitFlags registers --git-commit, --git-message, --git-tag,
+// --git-branch, --git-push and --git-remote.
+func addGitFlags(cmd *command) *gitFlags {
+	return &gitFlags{
+		commit:  cmd.Bool("git-commit", "SNAPSHOT_GIT_COMMIT", false, "commit the snapshot written to --out in its git work tree"),
+		message: cmd.String("git-message", "SNAPSHOT_GIT_MESSAGE", defaultGitMessage, "template of the commit message"),
+		tag:     cmd.String("git-tag", "SNAPSHOT_GIT_TAG", "", "template of a tag to create on the commit, such as schema/v{{.Date}}"),
+		branch:  cmd.String("git-branch", "SNAPSHOT_GIT_BRANCH", "", "branch to commit to, created if missing (default: the current branch)"),
+		push:    cmd.Bool("git-push", "SNAPSHOT_GIT_PUSH", false, "push the commit and the tag to --git-remote"),
+		remote:  cmd.String("git-remote", "SNAPSHOT_GIT_REMOTE", "origin", "remote to push to"),
+	}
+}
+
+// validate parses the templates, so that a broken one fails before the
+// snapshot is taken.
+func (f *gitFlags) validate(out string) error {
+	if !*f.commit {
+		return nil
+	}
+	if out == "" {
+		return fmt.Errorf("--git-commit needs --out")
+	}
+	var err error
+	if f.messageTemplate, err = template.New("git-message").Option("missingkey=error").Parse(*f.message); err != nil {
+		return fmt.Errorf("invalid --git-message: %w", err)
+	}
+	if f.tagTemplate, err = template.New("git-tag").Option("missingkey=error").Parse(*f.tag); err != nil {
+		return fmt.Errorf("invalid --git-tag: %w", err)
+	}
+	// Fields missing from gitInfo only show when a template is executed.
+	if _, err := execute(f.messageTemplate, gitInfo{}); err != nil {
+		return fmt.Errorf("invalid --git-message: %w", err)
+	}
+	if _, err := execute(f.tagTemplate, gitInfo{}); err != nil {
+		return fmt.Errorf("invalid --git-tag: %w", err)
+	}
+	return nil
+}
+
+// gitInfo is the data of the --git-message and --git-tag templates.
+type gitInfo struct {
+	// Path is the snapshot file, relative to the root of the work tree.
+	Path     string
+	BaseURL  string
+	Directus string
+	// Hash is the SnapshotHash of the snapshot, ShortHash its first 12
+	// characters.
+	Hash      string
+	ShortHash string
+	// Date is the day of the commit in UTC, such as 2024.06.01, and Time
+	// the time of the commit.
+	Date string
+	Time time.Time
+}
+
+// gitRepo is the work tree the snapshot is committed in.
+type gitRepo struct {
+	flags *gitFlags
+	root  string
+	// paths are the snapshot file and its checksum file, relative to root.
+	paths []string
+}
+
+// open finds the work tree of the snapshot file path, refuses a work tree
+// with uncommitted changes to other files and switches to --git-branch. It
+// runs before the snapshot is taken, so that a missing or dirty repository
+// fails early.
+func (f *gitFlags) open(ctx context.Context, path string) (*gitRepo, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("--git-commit needs git, which was not found in PATH")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	// The directory of the snapshot may not exist yet; ask git about its
+	// closest existing parent.
+	dir := filepath.Dir(abs)
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	root, err := runGit(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("%s is not in a git work tree: %w", path, err)
+	}
+	// git resolves symbolic links in the root, so resolve them in the path
+	// too before making it relative.
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		rest, _ := filepath.Rel(dir, abs)
+		abs = filepath.Join(resolved, rest)
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("%s is not in the git work tree %s", path, root)
+	}
+	repo := &gitRepo{flags: f, root: root, paths: []string{filepath.ToSlash(rel), filepath.ToSlash(rel) + ".sha256"}}
+
+	status, err := runGit(ctx, root, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return nil, err
+	}
+	var dirty []string
+	for _, line := range strings.Split(status, "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		// Renames are listed as "R  old -> new".
+		name := line[3:]
+		if _, to, ok := strings.Cut(name, " -> "); ok {
+			name = to
+		}
+		if !slices.Contains(repo.paths, strings.Trim(name, `"`)) {
+			dirty = append(dirty, name)
+		}
+	}
+	if len(dirty) > 0 {
+		return nil, fmt.Errorf("git work tree %s has uncommitted changes to %s; commit or stash them first", root, strings.Join(dirty, ", "))
+	}
+
+	if *f.branch != "" {
+		current, _ := runGit(ctx, root, "symbolic-ref", "--quiet", "--short", "HEAD")
+		if current != *f.branch {
+			args := []string{"switch", *f.branch}
+			if _, err := runGit(ctx, root, "rev-parse", "--verify", "--quiet", "refs/heads/"+*f.branch); err != nil {
+				args = []string{"switch", "--create", *f.branch}
+			}
+			if _, err := runGit(ctx, root, args...); err != nil {
+				return nil, err
+			}
+			slog.Info("switched git branch", "branch", *f.branch)
+		}
+	}
+	return repo, nil
+}
+
+// commit commits the snapshot, tags the commit and pushes both as the flags
+// say. Nothing is committed, tagged or pushed if the snapshot did not change,
+// and commit and tag are then empty.
+func (r *gitRepo) commit(ctx context.Context, info gitInfo) (commit, tag string, err error) {
+	info.Path = r.paths[0]
+	var paths []string
+	for _, path := range r.paths {
+		_, statErr := os.Stat(filepath.Join(r.root, path))
+		if _, err := runGit(ctx, r.root, "ls-files", "--error-unmatch", "--", path); statErr == nil || err == nil {
+			paths = append(paths, path)
+		}
+	}
+	if _, err := runGit(ctx, r.root, append([]string{"add", "--all", "--"}, paths...)...); err != nil {
+		return "", "", err
+	}
+	if _, err := runGit(ctx, r.root, append([]string{"diff", "--cached", "--quiet", "--"}, paths...)...); err == nil {
+		slog.Info("snapshot unchanged, nothing to commit", "path", info.Path)
+		return "", "", nil
+	}
+
+	message, err := execute(r.flags.messageTemplate, info)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid --git-message: %w", err)
+	}
+	if strings.TrimSpace(message) == "" {
+		return "", "", fmt.Errorf("--git-message is empty")
+	}
+	if _, err := runGit(ctx, r.root, append([]string{"commit", "--quiet", "--message", message, "--"}, paths...)...); err != nil {
+		return "", "", err
+	}
+	if commit, err = runGit(ctx, r.root, "rev-parse", "HEAD"); err != nil {
+		return "", "", err
+	}
+	slog.Info("snapshot committed", "commit", commit, "path", info.Path)
+
+	if tag, err = execute(r.flags.tagTemplate, info); err != nil {
+		return commit, "", fmt.Errorf("invalid --git-tag: %w", err)
+	}
+	if tag = strings.TrimSpace(tag); tag != "" {
+		subject, _, _ := strings.Cut(message, "\n")
+		if _, err := runGit(ctx, r.root, "tag", "--annotate", "--message", subject, tag); err != nil {
+			return commit, "", err
+		}
+		slog.Info("snapshot tagged", "tag", tag)
+	}
+
+	if *r.flags.push {
+		branch := *r.flags.branch
+		if branch == "" {
+			if branch, err = runGit(ctx, r.root, "symbolic-ref", "--quiet", "--short", "HEAD"); err != nil {
+				return commit, tag, fmt.Errorf("cannot push a detached HEAD, set --git-branch")
+			}
+		}
+		refs := []string{"push", "--quiet", *r.flags.remote, "HEAD:refs/heads/" + branch}
+		if tag != "" {
+			refs = append(refs, "refs/tags/"+tag)
+		}
+		if _, err := runGit(ctx, r.root, refs...); err != nil {
+			return commit, tag, err
+		}
+		slog.Info("snapshot pushed", "remote", *r.flags.remote, "branch", branch)
+	}
+	return commit, tag, nil
+}
+
+// execute renders t with info.
+func execute(t *template.Template, info gitInfo) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, info); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// runGit runs git with args in dir and returns its output without trailing
+// newlines. Errors carry what git printed.
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	git := exec.CommandContext(ctx, "git", args...)
+	git.Dir = dir
+	var stdout, stderr bytes.Buffer
+	git.Stdout, git.Stderr = &stdout, &stderr
+	if err := git.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if msg := strings.TrimSpace(stderr.String()); msg != "" && errors.As(err, &exitErr) {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
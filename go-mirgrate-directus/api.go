@@ -0,0 +1,66 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// doJSON sends payload (when not nil) as JSON to path and decodes the "data"
+// field of the response into out (when not nil). Requests other than POST are
+// idempotent in the Directus API and are therefore retried on transient
+// failures. Responses other than 200 and 204 are reported as *DirectusError.
+func (c *DirectusClient) doJSON(ctx context.Context, op, method, path string, query url.Values, payload, out any) error {
+	var requestBody []byte
+	if payload != nil {
+		var err error
+		if requestBody, err = json.Marshal(payload); err != nil {
+			return fmt.Errorf("failed to marshal %s request: %w", op, err)
+		}
+	}
+
+	resp, err := c.send(ctx, op, method, path, query, requestBody, method != http.MethodPost)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return nil
+	default:
+		return c.newDirectusError(op, resp)
+	}
+	if out == nil {
+		return nil
+	}
+
+	body, err := c.readBody(op, resp)
+	if err != nil {
+		return err
+	}
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w (body: %s)", op, err, c.excerpt(prefixOf(body)))
+	}
+	if len(envelope.Data) == 0 || bytes.Equal(envelope.Data, []byte("null")) {
+		return fmt.Errorf("%s response does not contain 'data' field (body: %s)", op, c.excerpt(prefixOf(body)))
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return fmt.Errorf("failed to decode %s response data: %w", op, err)
+	}
+	return nil
+}
+
+// prefixOf records the start of body for use with excerpt.
+func prefixOf(body []byte) *prefixWriter {
+	head := &prefixWriter{max: maxExcerptBytes}
+	head.Write(body)
+	return head
+}
@@ -0,0 +1,163 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// refreshMargin is how long before expiry an access token is refreshed.
+const refreshMargin = 30 * time.Second
+
+// credentials holds the login state of a client that authenticates with an
+// email and password.
+type credentials struct {
+	email    string
+	password string
+
+	// mu serializes logins and refreshes, so concurrent requests that all
+	// notice an expired token trigger only one refresh.
+	mu           sync.Mutex
+	accessToken  string
+	refreshToken string
+	expiresAt    time.Time
+}
+
+// NewDirectusClientWithCredentials creates a client that logs in to the
+// Directus instance with email and password via /auth/login on its first
+// request, and refreshes the access token via /auth/refresh when it is about
+// to expire or a request is rejected with 401.
+func NewDirectusClientWithCredentials(baseURL, email, password string, opts ...ClientOption) *DirectusClient {
+	c := NewDirectusClient(baseURL, "", opts...)
+	c.auth = &credentials{email: email, password: password}
+	return c
+}
+
+// secrets returns the password and the tokens obtained so far.
+func (a *credentials) secrets() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return []string{a.password, a.accessToken, a.refreshToken}
+}
+
+// token returns a valid access token, logging in or refreshing as needed.
+func (a *credentials) token(ctx context.Context, c *DirectusClient) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case a.accessToken == "":
+		if err := a.login(ctx, c); err != nil {
+			return "", err
+		}
+	case !a.expiresAt.IsZero() && time.Until(a.expiresAt) < refreshMargin:
+		if err := a.renew(ctx, c); err != nil {
+			return "", err
+		}
+	}
+	return a.accessToken, nil
+}
+
+// invalidate discards rejected, the token a request was refused with, and
+// obtains a new one. If another request already replaced rejected in the
+// meantime, the new token is kept as is.
+func (a *credentials) invalidate(ctx context.Context, c *DirectusClient, rejected string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.accessToken != rejected {
+		return nil
+	}
+	return a.renew(ctx, c)
+}
+
+// renew refreshes the access token, falling back to a fresh login when the
+// refresh token is missing or no longer accepted.
+func (a *credentials) renew(ctx context.Context, c *DirectusClient) error {
+	if a.refreshToken != "" {
+		err := a.authenticate(ctx, c, "refresh", "/auth/refresh", map[string]string{
+			"refresh_token": a.refreshToken,
+			"mode":          "json",
+		})
+		if err == nil {
+			return nil
+		}
+	}
+	return a.login(ctx, c)
+}
+
+// login obtains new tokens with the email and password.
+func (a *credentials) login(ctx context.Context, c *DirectusClient) error {
+	return a.authenticate(ctx, c, "login", "/auth/login", map[string]string{
+		"email":    a.email,
+		"password": a.password,
+		"mode":     "json",
+	})
+}
+
+// authenticate posts payload to one of the /auth endpoints and stores the
+// returned tokens. Callers must hold a.mu.
+func (a *credentials) authenticate(ctx context.Context, c *DirectusClient, op, path string, payload map[string]string) error {
+	requestBody, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", op, err)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, path, nil, bytes.NewReader(requestBody), "")
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// c.redact would lock a.mu, which the caller already holds.
+	secrets := []string{a.password, a.accessToken, a.refreshToken}
+
+	if err := c.waitRateLimit(ctx); err != nil {
+		return fmt.Errorf("%s request canceled: %w", op, err)
+	}
+	if err := c.circuitAllow(); err != nil {
+		return fmt.Errorf("%s request not sent: %w", op, err)
+	}
+	start := time.Now()
+	resp, err := c.httpClient(ctx).Do(req)
+	c.Metrics.observeRequest(op, resp, err)
+	c.circuitRecord(ctx, resp, err, secrets)
+	c.dumpExchange(op, req, requestBody, resp, err, time.Since(start), secrets)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("%s request canceled: %w", op, ctxErr)
+		}
+		return fmt.Errorf("failed to execute %s request: %w", op, redactErrorSecrets(err, secrets))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return parseDirectusError(op, req, resp.StatusCode, redactSecrets(readErrorBody(resp), secrets))
+	}
+
+	var result struct {
+		Data struct {
+			AccessToken  string `json:"access_token"`
+			RefreshToken string `json:"refresh_token"`
+			Expires      int64  `json:"expires"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(c.responseBody(op, resp)).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", op, err)
+	}
+	if result.Data.AccessToken == "" {
+		return fmt.Errorf("%s response does not contain an access token", op)
+	}
+
+	a.accessToken = result.Data.AccessToken
+	a.refreshToken = result.Data.RefreshToken
+	a.expiresAt = time.Time{}
+	if result.Data.Expires > 0 {
+		a.expiresAt = time.Now().Add(time.Duration(result.Data.Expires) * time.Millisecond)
+	}
+	return nil
+}
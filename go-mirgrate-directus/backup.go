@@ -0,0 +1,95 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Defaults for the backups MigrateWithOptions takes before applying a diff.
+const (
+	DefaultBackupDir       = "backups"
+	DefaultBackupRetention = 10
+)
+
+// backupPrefix starts the names of backup files, which continue with a UTC
+// timestamp.
+const backupPrefix = "target-"
+
+// BackupSnapshot saves the current snapshot of client to a timestamped file
+// in dir, such as backups/target-2024-06-01T12-00-00.json, and returns its
+// path.
+func BackupSnapshot(ctx context.Context, client *DirectusClient, dir string) (string, error) {
+	snapshot, err := client.GetSnapshot(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get target snapshot: %w", err)
+	}
+	return SaveBackup(dir, snapshot)
+}
+
+// SaveBackup saves snapshot to a timestamped file in dir like BackupSnapshot
+// and returns its path.
+func SaveBackup(dir string, snapshot *Snapshot) (string, error) {
+	return StoreBackup(context.Background(), DirStore(dir), snapshot)
+}
+
+// StoreBackup saves snapshot to store under a timestamped name like
+// BackupSnapshot, normalized as by SaveSnapshot, and returns its location.
+func StoreBackup(ctx context.Context, store SnapshotStore, snapshot *Snapshot) (string, error) {
+	data, err := EncodeSnapshot(NormalizeSnapshot(snapshot), FormatJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	objects, err := store.List(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list backups: %w", err)
+	}
+	name := storedName(objects, backupPrefix, time.Now())
+	if err := store.Put(ctx, name, data); err != nil {
+		return "", fmt.Errorf("failed to save backup: %w", err)
+	}
+	return store.Location(name), nil
+}
+
+// storedName returns a name starting with prefix for now that none of
+// objects has.
+func storedName(objects []StoredObject, prefix string, now time.Time) string {
+	base := prefix + now.UTC().Format("2006-01-02T15-04-05")
+	name := base + ".json"
+	for i := 1; slices.ContainsFunc(objects, func(o StoredObject) bool { return o.Name == name }); i++ {
+		name = fmt.Sprintf("%s-%d.json", base, i)
+	}
+	return name
+}
+
+// PruneBackups removes all but the newest keep backups written to dir by
+// BackupSnapshot, by modification time. Other files are left alone.
+func PruneBackups(dir string, keep int) error {
+	return PruneStoredBackups(context.Background(), DirStore(dir), keep)
+}
+
+// PruneStoredBackups removes all but the newest keep backups saved to store
+// by StoreBackup, like PruneBackups.
+func PruneStoredBackups(ctx context.Context, store SnapshotStore, keep int) error {
+	return pruneStored(ctx, store, backupPrefix, keep)
+}
+
+// pruneStored removes all but the newest keep objects of store named
+// prefix*.json.
+func pruneStored(ctx context.Context, store SnapshotStore, prefix string, keep int) error {
+	objects, err := store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+	objects = storedObjects(objects, prefix)
+	if len(objects) <= keep {
+		return nil
+	}
+	for _, o := range objects[:len(objects)-keep] {
+		if err := store.Delete(ctx, o.Name); err != nil {
+			return fmt.Errorf("failed to remove old backup: %w", err)
+		}
+	}
+	return nil
+}
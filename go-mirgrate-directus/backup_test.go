@@ -0,0 +1,150 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// backups returns the names of the backups in dir.
+func backups(t *testing.T, dir string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "target-*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range names {
+		names[i] = filepath.Base(name)
+	}
+	return names
+}
+
+func TestBackupBeforeApply(t *testing.T) {
+	base, target, _ := newMigration(t)
+	target.Fail("/schema/apply", 1, directustest.Failure{Status: http.StatusBadRequest})
+	targetSnapshot := &gomigratedirectus.Snapshot{Version: 1, Directus: "10.13.1", Vendor: "postgres",
+		Collections: []gomigratedirectus.Collection{}, Fields: []gomigratedirectus.Field{}, Relations: []gomigratedirectus.Relation{}}
+	target.SetSnapshot(targetSnapshot)
+	dir := filepath.Join(t.TempDir(), "backups")
+
+	result, err := gomigratedirectus.MigrateWithOptions(context.Background(), base.Client(quiet()...), target.Client(quiet()...),
+		gomigratedirectus.MigrationOptions{BackupDir: dir})
+	if err == nil || result.Applied {
+		t.Fatalf("MigrateWithOptions = %v, applied %v, want the apply to fail", err, result.Applied)
+	}
+
+	// The backup was taken before the apply was attempted, and is kept.
+	got := paths(target)
+	backup, apply := slices.Index(got, "GET /schema/snapshot"), slices.Index(got, "POST /schema/apply")
+	if backup < 0 || apply < 0 || backup > apply {
+		t.Errorf("target requests = %v, want the snapshot of the backup before the apply", got)
+	}
+	if names := backups(t, dir); len(names) != 1 || result.BackupPath != filepath.Join(dir, names[0]) {
+		t.Fatalf("backups = %v, result.BackupPath = %q, want a single backup", names, result.BackupPath)
+	}
+	saved, err := gomigratedirectus.LoadSnapshot(result.BackupPath)
+	if err != nil {
+		t.Fatalf("LoadSnapshot of the backup: %v", err)
+	}
+	if !reflect.DeepEqual(saved, targetSnapshot) {
+		t.Errorf("backup = %+v, want the target snapshot %+v", saved, targetSnapshot)
+	}
+}
+
+func TestBackupFailureStopsApply(t *testing.T) {
+	base, target, _ := newMigration(t)
+	// A file in place of the backup directory makes the backup fail.
+	dir := filepath.Join(t.TempDir(), "backups")
+	if err := os.WriteFile(dir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := gomigratedirectus.MigrateWithOptions(context.Background(), base.Client(quiet()...), target.Client(quiet()...),
+		gomigratedirectus.MigrationOptions{BackupDir: dir})
+	if err == nil || !strings.Contains(err.Error(), "failed to back up target") {
+		t.Fatalf("MigrateWithOptions = %v, want the backup to fail", err)
+	}
+	if n := len(target.ApplyRequests()); n != 0 {
+		t.Errorf("target received %d apply requests after the backup failed, want none", n)
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	// Names sort in another order than their times, which decide.
+	names := []string{"target-5.json", "target-4.json", "target-3.json", "target-2.json", "target-1.json"}
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(time.Duration(i-len(names)) * time.Hour)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	others := []string{"notes.txt", "target-1.yaml", "undo-1.json"}
+	for _, name := range others {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := gomigratedirectus.PruneBackups(dir, 5); err != nil {
+		t.Fatalf("PruneBackups: %v", err)
+	}
+	if got := backups(t, dir); len(got) != 5 {
+		t.Errorf("PruneBackups of as many backups as kept left %v, want all", got)
+	}
+	if err := gomigratedirectus.PruneBackups(dir, 2); err != nil {
+		t.Fatalf("PruneBackups: %v", err)
+	}
+	if got, want := backups(t, dir), []string{"target-1.json", "target-2.json"}; !slices.Equal(got, want) {
+		t.Errorf("backups after PruneBackups = %v, want the newest %v", got, want)
+	}
+	for _, name := range others {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("PruneBackups removed %s, which is not a backup", name)
+		}
+	}
+}
+
+func TestBackupRetention(t *testing.T) {
+	for _, tt := range []struct {
+		retention int
+		want      int
+	}{
+		{2, 2},
+		{-1, 4},
+	} {
+		base, target, _ := newMigration(t)
+		target.KeepDiff(true)
+		dir := filepath.Join(t.TempDir(), "backups")
+		var paths []string
+		for range 4 {
+			result, err := gomigratedirectus.MigrateWithOptions(context.Background(), base.Client(quiet()...), target.Client(quiet()...),
+				gomigratedirectus.MigrationOptions{BackupDir: dir, BackupRetention: tt.retention, VerifyAfterApply: gomigratedirectus.VerifyOff})
+			if err != nil {
+				t.Fatalf("MigrateWithOptions: %v", err)
+			}
+			paths = append(paths, result.BackupPath)
+		}
+		var want []string
+		for _, path := range paths[len(paths)-tt.want:] {
+			want = append(want, filepath.Base(path))
+		}
+		slices.Sort(want)
+		if got := backups(t, dir); !slices.Equal(got, want) {
+			t.Errorf("backups with a retention of %d = %v, want %v", tt.retention, got, want)
+		}
+	}
+}
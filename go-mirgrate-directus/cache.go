@@ -0,0 +1,181 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SchemaCache remembers, per target, the base snapshot last migrated to it and
+// the schema the target was left with, so that migrating the same snapshot to
+// a target that did not change since can skip the diff and the apply. See
+// MigrationOptions.Cache.
+type SchemaCache struct {
+	// path is the file the entries are saved to, empty for a cache kept in
+	// memory.
+	path string
+
+	mu      sync.Mutex
+	entries map[string]CacheEntry
+}
+
+// CacheEntry is what a SchemaCache knows about a target.
+type CacheEntry struct {
+	// BaseHash is the SnapshotHash of the base snapshot, as diffed, that
+	// the target was last found in sync with.
+	BaseHash string `json:"base_hash"`
+	// TargetHash is the SnapshotHash of the target snapshot at that time.
+	TargetHash string    `json:"target_hash"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// NewSchemaCache returns a cache kept in memory, for the migrations run by a
+// single process such as Watch.
+func NewSchemaCache() *SchemaCache {
+	return &SchemaCache{entries: map[string]CacheEntry{}}
+}
+
+// OpenSchemaCache returns a cache saved to the JSON file at path, keyed by the
+// redacted target URL, for migrations run by successive processes such as CI
+// jobs. A missing file is an empty cache, created on the first update.
+func OpenSchemaCache(path string) (*SchemaCache, error) {
+	c := &SchemaCache{path: path, entries: map[string]CacheEntry{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, fmt.Errorf("failed to decode schema cache %s: %w", path, err)
+	}
+	if c.entries == nil {
+		c.entries = map[string]CacheEntry{}
+	}
+	return c, nil
+}
+
+// Lookup returns the entry of the target at targetURL, if any.
+func (c *SchemaCache) Lookup(targetURL string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[RedactURL(targetURL)]
+	return entry, ok
+}
+
+// Store sets the entry of the target at targetURL.
+func (c *SchemaCache) Store(targetURL string, entry CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[RedactURL(targetURL)] = entry
+	return c.save()
+}
+
+// Forget removes the entry of the target at targetURL, so that its next
+// migration takes the full path.
+func (c *SchemaCache) Forget(targetURL string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := RedactURL(targetURL)
+	if _, ok := c.entries[key]; !ok {
+		return nil
+	}
+	delete(c.entries, key)
+	return c.save()
+}
+
+// save replaces the cache file, if any, atomically. Callers hold c.mu.
+func (c *SchemaCache) save() error {
+	if c.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schema cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), "."+filepath.Base(c.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save schema cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save schema cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save schema cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to save schema cache: %w", err)
+	}
+	return nil
+}
+
+// cachedInSync reports whether opts.Cache shows that targetClient is in sync
+// with snapshot: the cached base hash is the hash of snapshot, the last
+// migration recorded in the history collection, when recorded, applied it,
+// and the schema of the target is still the one cached. Any error, such as a
+// failure to fetch the target snapshot, takes the full path instead.
+func (m *migration) cachedInSync(ctx context.Context, targetClient *DirectusClient, snapshot *Snapshot) bool {
+	hash, err := SnapshotHash(snapshot)
+	if err != nil {
+		return false
+	}
+	m.baseHash = hash
+	entry, ok := m.opts.Cache.Lookup(targetClient.URL)
+	if !ok || entry.BaseHash != hash {
+		return false
+	}
+	if m.opts.RecordHistory {
+		entries, err := targetClient.ListHistory(ctx, m.opts.historyCollection(), 1)
+		if err != nil || len(entries) == 0 || entries[0].Status != HistoryApplied || entries[0].SnapshotHash != hash {
+			return false
+		}
+	}
+	// The target may have been changed by hand or by another tool since;
+	// fetching its snapshot is still much cheaper than a diff.
+	current, err := targetClient.GetSnapshot(ctx)
+	if err != nil {
+		return false
+	}
+	targetHash, err := SnapshotHash(current)
+	return err == nil && targetHash == entry.TargetHash
+}
+
+// rememberInSync stores in opts.Cache that targetClient is now in sync with
+// the base snapshot hashed by cachedInSync.
+func (m *migration) rememberInSync(ctx context.Context, targetClient *DirectusClient) {
+	if m.opts.Cache == nil || m.baseHash == "" {
+		return
+	}
+	err := func() error {
+		current, err := targetClient.GetSnapshot(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get target snapshot: %w", err)
+		}
+		targetHash, err := SnapshotHash(current)
+		if err != nil {
+			return err
+		}
+		return m.opts.Cache.Store(targetClient.URL, CacheEntry{BaseHash: m.baseHash, TargetHash: targetHash, UpdatedAt: time.Now().UTC()})
+	}()
+	m.emit(&CacheUpdated{Err: err})
+}
+
+// forgetInSync drops the entry of targetClient from opts.Cache after a
+// failed apply, which may have left the target anywhere.
+func (m *migration) forgetInSync(targetClient *DirectusClient) {
+	if m.opts.Cache == nil {
+		return
+	}
+	if err := m.opts.Cache.Forget(targetClient.URL); err != nil {
+		m.emit(&CacheUpdated{Err: err})
+	}
+}
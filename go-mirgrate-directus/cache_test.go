@@ -0,0 +1,90 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// diffCount returns the number of diffs target computed.
+func diffCount(target *directustest.Server) int {
+	return len(target.DiffRequests())
+}
+
+func TestSchemaCache(t *testing.T) {
+	ctx := context.Background()
+	base, target, f := newMigration(t)
+	target.SetDiff(nil)
+	path := filepath.Join(t.TempDir(), "cache.json")
+	cache, err := gomigratedirectus.OpenSchemaCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrate := func() *gomigratedirectus.MigrationResult {
+		t.Helper()
+		result, err := gomigratedirectus.MigrateWithOptions(ctx, base.Client(quiet()...), target.Client(quiet()...),
+			gomigratedirectus.MigrationOptions{Cache: cache, NoBackup: true, VerifyAfterApply: gomigratedirectus.VerifyOff})
+		if err != nil {
+			t.Fatalf("MigrateWithOptions: %v", err)
+		}
+		return result
+	}
+
+	migrate()
+	if n := diffCount(target); n != 1 {
+		t.Fatalf("first migration diffed %d times, want 1", n)
+	}
+	if _, ok := cache.Lookup(target.URL); !ok {
+		t.Fatal("target in sync not cached")
+	}
+
+	// Nothing changed, so the diff is skipped.
+	if result := migrate(); result.Changed {
+		t.Errorf("cached migration changed the target: %+v", result)
+	}
+	if n := diffCount(target); n != 1 {
+		t.Errorf("cached migration diffed the target, %d diffs in total, want 1", n)
+	}
+
+	// The target is changed out of band: the cache must not hide it.
+	changed := *f.Snapshot
+	changed.Collections = changed.Collections[:1]
+	target.SetSnapshot(&changed)
+	target.SetDiff(f.Diff)
+	result := migrate()
+	if n := diffCount(target); n != 2 {
+		t.Errorf("migration of a changed target diffed %d times in total, want 2", n)
+	}
+	if !result.Applied {
+		t.Errorf("migration of a changed target = %+v, want the diff applied", result)
+	}
+	if n := len(target.ApplyRequests()); n != 1 {
+		t.Errorf("target received %d applies, want 1", n)
+	}
+
+	// A later process skips the diff of the target in sync again.
+	if cache, err = gomigratedirectus.OpenSchemaCache(path); err != nil {
+		t.Fatal(err)
+	}
+	migrate()
+	if n := diffCount(target); n != 2 {
+		t.Errorf("migration with the reopened cache diffed %d times in total, want 2", n)
+	}
+
+	// So does a change of the base.
+	changedBase := *f.Snapshot
+	changedBase.Collections = slices.Clone(changedBase.Collections)
+	changedBase.Collections[0].Meta = maps.Clone(changedBase.Collections[0].Meta)
+	changedBase.Collections[0].Meta["note"] = "changed on the base"
+	base.SetSnapshot(&changedBase)
+	target.SetDiff(nil)
+	migrate()
+	if n := diffCount(target); n != 3 {
+		t.Errorf("migration of a changed base diffed %d times in total, want 3", n)
+	}
+}
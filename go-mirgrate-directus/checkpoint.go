@@ -0,0 +1,241 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"time"
+)
+
+// CheckpointFormatVersion is the checkpoint format version written by
+// WriteCheckpoint, the only one ReadCheckpoint accepts.
+const CheckpointFormatVersion = 1
+
+// A Checkpoint records the progress of a migration with several phases, such
+// as the schema, permissions, flows and data, against one target, so that a
+// run resuming a failed one with MigrationOptions.Resume skips the work that
+// completed. MigrateWithOptions keeps it up to date after every phase and
+// every data collection, and removes it once the migration succeeded.
+type Checkpoint struct {
+	Version int `json:"version"`
+	// TargetURL is the redacted URL of the target migrated.
+	TargetURL string `json:"target_url"`
+	// BaseHash is the SnapshotHash of the base snapshot migrated, after
+	// overlays, scope and filters. A checkpoint of another one is not
+	// resumed.
+	BaseHash  string            `json:"base_hash"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Phases    []CheckpointPhase `json:"phases"`
+	// DataCollections are the collections whose data was synced, while the
+	// data phase was not completed.
+	DataCollections []string `json:"data_collections,omitempty"`
+}
+
+// CheckpointPhase is a phase completed by the migration of a Checkpoint,
+// PhaseApply for the schema or one of the sync phases such as PhaseFlows.
+type CheckpointPhase struct {
+	Phase string `json:"phase"`
+	// TargetHash is the SnapshotHash of the target schema once the phase
+	// completed.
+	TargetHash  string    `json:"target_hash"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// Completed reports whether phase completed.
+func (c *Checkpoint) Completed(phase string) bool {
+	return slices.ContainsFunc(c.Phases, func(p CheckpointPhase) bool { return p.Phase == phase })
+}
+
+// TargetHash returns the target hash of the last phase completed, the schema
+// hash the target must still have for the checkpoint to be resumed.
+func (c *Checkpoint) TargetHash() string {
+	if len(c.Phases) == 0 {
+		return ""
+	}
+	return c.Phases[len(c.Phases)-1].TargetHash
+}
+
+// CheckpointName returns the name MigrateWithOptions keeps the checkpoint of
+// the target at targetURL under, such as checkpoint-cms.example.com.json.
+func CheckpointName(targetURL string) string {
+	return "checkpoint-" + BackupEnvName(targetURL) + ".json"
+}
+
+// ReadCheckpoint reads the checkpoint name from store. It returns nil without
+// an error when there is none.
+func ReadCheckpoint(ctx context.Context, store SnapshotStore, name string) (*Checkpoint, error) {
+	data, err := store.Get(ctx, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("checkpoint %s is corrupt: %w", store.Location(name), err)
+	}
+	if checkpoint.Version != CheckpointFormatVersion {
+		return nil, fmt.Errorf("checkpoint %s has format version %d, only version %d is supported", store.Location(name), checkpoint.Version, CheckpointFormatVersion)
+	}
+	return &checkpoint, nil
+}
+
+// WriteCheckpoint saves checkpoint to store under name.
+func WriteCheckpoint(ctx context.Context, store SnapshotStore, name string, checkpoint *Checkpoint) error {
+	checkpoint.Version = CheckpointFormatVersion
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	if err := store.Put(ctx, name, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// checkpointState is the checkpoint kept by a migration with sync phases
+// that is not a dry run.
+type checkpointState struct {
+	store SnapshotStore
+	name  string
+	// resumed is the checkpoint of the failed run resumed, nil when there is
+	// none or it was discarded.
+	resumed *Checkpoint
+	current Checkpoint
+}
+
+// openCheckpoint sets up the checkpoint of the migration to targetClient
+// and, with opts.Resume, reads the one left by an earlier run.
+func (m *migration) openCheckpoint(ctx context.Context, targetClient *DirectusClient) error {
+	store, name := m.opts.CheckpointStore, CheckpointName(targetClient.URL)
+	if store == nil {
+		store, _ = m.backupStore()
+	}
+	m.checkpoint = &checkpointState{store: store, name: name, current: Checkpoint{TargetURL: RedactURL(targetClient.URL)}}
+	if !m.opts.Resume {
+		return nil
+	}
+	resumed, err := ReadCheckpoint(ctx, store, name)
+	switch {
+	case err != nil:
+		return err
+	case resumed == nil:
+		m.emit(&CheckpointDiscarded{Path: store.Location(name), Reason: "no checkpoint to resume"})
+	case resumed.TargetURL != m.checkpoint.current.TargetURL:
+		m.emit(&CheckpointDiscarded{Path: store.Location(name), Reason: fmt.Sprintf("the checkpoint is of %s", resumed.TargetURL)})
+	default:
+		m.checkpoint.resumed = resumed
+	}
+	return nil
+}
+
+// runPhase runs the phase, unless the resumed checkpoint recorded it as
+// completed, and records it in the checkpoint once it completed. run is
+// passed ctx carrying the rate limit of the phase in opts.PhaseRateLimits.
+func (m *migration) runPhase(ctx context.Context, targetClient *DirectusClient, phase string, run func(ctx context.Context) error) error {
+	if c := m.checkpoint; c != nil && c.resumed != nil && c.resumed.Completed(phase) {
+		i := slices.IndexFunc(c.resumed.Phases, func(p CheckpointPhase) bool { return p.Phase == phase })
+		c.current.Phases = append(c.current.Phases, c.resumed.Phases[i])
+		m.emit(&PhaseSkipped{Phase: phase, CompletedAt: c.resumed.Phases[i].CompletedAt})
+		return nil
+	}
+	phaseCtx := ctx
+	if limit, ok := m.opts.PhaseRateLimits[phase]; ok {
+		phaseCtx = ContextWithRateLimit(ctx, limit)
+	}
+	if err := run(phaseCtx); err != nil {
+		return err
+	}
+	m.completePhase(ctx, targetClient, phase)
+	return nil
+}
+
+// completePhase records phase in the checkpoint with the current target
+// hash. After the schema phase, which always runs, the resumed checkpoint is
+// discarded unless the base snapshot and the target schema are still those
+// it recorded; otherwise the phases it completed are skipped.
+func (m *migration) completePhase(ctx context.Context, targetClient *DirectusClient, phase string) {
+	c := m.checkpoint
+	if c == nil {
+		return
+	}
+	path := c.store.Location(c.name)
+	hash, err := func() (string, error) {
+		snapshot, err := targetClient.GetSnapshot(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to get target snapshot: %w", err)
+		}
+		return SnapshotHash(snapshot)
+	}()
+	if err != nil {
+		// Without the hash the resumed checkpoint cannot be checked.
+		c.resumed = nil
+		m.emit(&CheckpointSaved{Path: path, Phase: phase, Err: err})
+		return
+	}
+	if phase == PhaseApply {
+		c.current.BaseHash = m.baseHash
+		if resumed := c.resumed; resumed != nil {
+			switch {
+			case resumed.BaseHash != m.baseHash:
+				m.emit(&CheckpointDiscarded{Path: path, Reason: "the base snapshot changed"})
+				c.resumed = nil
+			case resumed.TargetHash() != hash:
+				m.emit(&CheckpointDiscarded{Path: path, Reason: "the target schema changed"})
+				c.resumed = nil
+			default:
+				m.emit(&CheckpointResumed{Path: path, UpdatedAt: resumed.UpdatedAt, Phases: len(resumed.Phases), DataCollections: resumed.DataCollections})
+				c.current.DataCollections = slices.Clone(resumed.DataCollections)
+			}
+		}
+	}
+	if !c.current.Completed(phase) {
+		c.current.Phases = append(c.current.Phases, CheckpointPhase{Phase: phase, TargetHash: hash, CompletedAt: time.Now().UTC()})
+	}
+	if phase == PhaseData {
+		c.current.DataCollections = nil
+	}
+	m.saveCheckpoint(ctx, phase, "")
+}
+
+// completeDataCollection records in the checkpoint that the data of
+// collection was synced.
+func (m *migration) completeDataCollection(ctx context.Context, collection string) {
+	if m.checkpoint == nil {
+		return
+	}
+	m.checkpoint.current.DataCollections = append(m.checkpoint.current.DataCollections, collection)
+	m.saveCheckpoint(ctx, PhaseData, collection)
+}
+
+// resumedDataCollections returns the collections whose data the resumed
+// checkpoint recorded as synced.
+func (m *migration) resumedDataCollections() []string {
+	if m.checkpoint == nil || m.checkpoint.resumed == nil {
+		return nil
+	}
+	return m.checkpoint.resumed.DataCollections
+}
+
+// saveCheckpoint writes the checkpoint. A failure is reported but does not
+// fail the migration, which can still be rerun from the start.
+func (m *migration) saveCheckpoint(ctx context.Context, phase, collection string) {
+	c := m.checkpoint
+	c.current.UpdatedAt = time.Now().UTC()
+	err := WriteCheckpoint(context.WithoutCancel(ctx), c.store, c.name, &c.current)
+	m.emit(&CheckpointSaved{Path: c.store.Location(c.name), Phase: phase, Collection: collection, Err: err})
+}
+
+// removeCheckpoint removes the checkpoint once the migration succeeded.
+func (m *migration) removeCheckpoint(ctx context.Context) {
+	c := m.checkpoint
+	if c == nil || len(c.current.Phases) == 0 {
+		return
+	}
+	err := c.store.Delete(context.WithoutCancel(ctx), c.name)
+	m.emit(&CheckpointRemoved{Path: c.store.Location(c.name), Err: err})
+}
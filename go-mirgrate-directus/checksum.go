@@ -0,0 +1,106 @@
+package gomirgratedirectus
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ChecksumExtension is appended to the path of a snapshot file to name the
+// file holding its checksum, see WriteSnapshotWithChecksum.
+const ChecksumExtension = ".sha256"
+
+// ErrChecksumMismatch is returned by VerifySnapshot and LoadSnapshot when a
+// snapshot file does not match its checksum file.
+var ErrChecksumMismatch = errors.New("snapshot does not match its checksum")
+
+// ErrNoChecksum is returned by VerifySnapshot when a snapshot file has no
+// checksum file.
+var ErrNoChecksum = errors.New("snapshot has no checksum file")
+
+// SnapshotHash returns the hex SHA-256 of snapshot normalized with
+// NormalizeSnapshot and encoded as by SaveSnapshot, so that equal schemas
+// hash equally whatever order they were exported in. Plans, the history and
+// the checksum files of snapshots all use it.
+func SnapshotHash(snapshot *Snapshot) (string, error) {
+	data, err := encodeSnapshot(NormalizeSnapshot(snapshot), FormatJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ChecksumPath returns the path of the checksum file of the snapshot file at
+// path.
+func ChecksumPath(path string) string {
+	return path + ChecksumExtension
+}
+
+// WriteSnapshotWithChecksum saves snapshot to path like SaveSnapshot and its
+// SnapshotHash to the checksum file next to it, so that LoadSnapshot can
+// detect a file corrupted or modified since, for example in an artifact
+// store. The checksum is of the normalized schema rather than of the bytes
+// of the file, so it holds for the JSON and YAML encodings alike, compressed
+// or not.
+func WriteSnapshotWithChecksum(path string, snapshot *Snapshot) error {
+	return SaveSnapshotWithOptions(path, snapshot, SaveOptions{Checksum: true})
+}
+
+// WriteChecksum writes the SnapshotHash of snapshot, as saved to path, to
+// the checksum file of path, for snapshot files written by other means than
+// SaveSnapshot.
+func WriteChecksum(path string, snapshot *Snapshot) error {
+	hash, err := SnapshotHash(snapshot)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(ChecksumPath(path), []byte(hash+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to save snapshot checksum: %w", err)
+	}
+	return nil
+}
+
+// VerifySnapshot checks the snapshot file at path against its checksum file,
+// returning ErrNoChecksum if there is none and ErrChecksumMismatch if the
+// file was changed since the checksum was written.
+func VerifySnapshot(path string) error {
+	snapshot, err := LoadSnapshotWithOptions(path, LoadOptions{SkipVerify: true})
+	if err != nil {
+		return err
+	}
+	return verifyChecksum(path, snapshot, true)
+}
+
+// verifyChecksum compares the SnapshotHash of snapshot, loaded from path,
+// with the checksum file of path. A missing checksum file is an error only
+// if required is set.
+func verifyChecksum(path string, snapshot *Snapshot, required bool) error {
+	data, err := os.ReadFile(ChecksumPath(path))
+	switch {
+	case errors.Is(err, os.ErrNotExist) && !required:
+		return nil
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("%w: %s not found", ErrNoChecksum, ChecksumPath(path))
+	case err != nil:
+		return fmt.Errorf("failed to read snapshot checksum: %w", err)
+	}
+	// Accept the "hash  name" lines of sha256sum too.
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		return fmt.Errorf("checksum file %s does not hold a SHA-256", ChecksumPath(path))
+	}
+	expected := strings.ToLower(fields[0])
+	hash, err := SnapshotHash(snapshot)
+	if err != nil {
+		return err
+	}
+	if hash != expected {
+		return fmt.Errorf("%w: snapshot file %s hashes to %s but %s records %s, it was corrupted or modified after it was written",
+			ErrChecksumMismatch, path, hash, ChecksumPath(path), expected)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultCircuitCoolDown is how long a circuit breaker stays open when
+// NewCircuitBreaker is given no cool-down.
+const DefaultCircuitCoolDown = 30 * time.Second
+
+// ErrCircuitOpen is matched by the errors of the requests a client refused to
+// send because its circuit breaker is open; see CircuitOpenError.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState string
+
+const (
+	// CircuitClosed lets every request through. It is the initial state.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fails every request without sending it, until the
+	// cool-down is over.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single probe request through once the
+	// cool-down is over: its success closes the circuit, its failure opens
+	// it again.
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitBreaker stops a client from hammering an instance that fails every
+// request, such as a target answering 500 to every item of a data sync: after
+// a number of consecutive failed requests, retries included, the circuit
+// opens and requests fail at once with a CircuitOpenError for the cool-down,
+// after which it is half-open. Connection errors and 5xx responses are
+// failures; requests canceled by their context are not counted. It is safe
+// for concurrent use.
+type CircuitBreaker struct {
+	failures int
+	coolDown time.Duration
+
+	mu      sync.Mutex
+	state   CircuitState
+	count   int
+	lastErr error
+	retryAt time.Time
+	probing bool
+}
+
+// NewCircuitBreaker returns a closed circuit breaker opening after failures
+// consecutive failures, for coolDown or DefaultCircuitCoolDown if zero.
+func NewCircuitBreaker(failures int, coolDown time.Duration) *CircuitBreaker {
+	if coolDown <= 0 {
+		coolDown = DefaultCircuitCoolDown
+	}
+	return &CircuitBreaker{failures: max(failures, 1), coolDown: coolDown, state: CircuitClosed}
+}
+
+// WithCircuitBreaker gives the client a circuit breaker opening after
+// failures consecutive failed requests, for coolDown; see NewCircuitBreaker.
+func WithCircuitBreaker(failures int, coolDown time.Duration) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.circuitBreaker = NewCircuitBreaker(failures, coolDown)
+	}
+}
+
+// State returns the state of b. A nil CircuitBreaker is always closed.
+func (b *CircuitBreaker) State() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && !time.Now().Before(b.retryAt) {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// CircuitOpenError is the error of a request refused by an open circuit
+// breaker. It matches ErrCircuitOpen with errors.Is.
+type CircuitOpenError struct {
+	// URL is the redacted URL of the instance.
+	URL string
+	// Failures is the number of consecutive failures that opened the
+	// circuit, and LastErr the last of them.
+	Failures int
+	LastErr  error
+	// RetryAt is when the next probe request will be let through.
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: %s failed %d requests in a row, last with: %v; retrying after %s",
+		ErrCircuitOpen, e.URL, e.Failures, e.LastErr, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Is(target error) bool { return target == ErrCircuitOpen }
+
+// circuitAllow returns a CircuitOpenError when the circuit breaker of c
+// refuses to send a request now. Once the cool-down is over, the first
+// request is let through as the probe.
+func (c *DirectusClient) circuitAllow() error {
+	b := c.CircuitBreaker
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && !time.Now().Before(b.retryAt) {
+		b.state = CircuitHalfOpen
+	}
+	if b.state == CircuitClosed || (b.state == CircuitHalfOpen && !b.probing) {
+		b.probing = b.state == CircuitHalfOpen
+		return nil
+	}
+	return &CircuitOpenError{URL: RedactURL(c.URL), Failures: b.count, LastErr: b.lastErr, RetryAt: b.retryAt}
+}
+
+// circuitRecord records the outcome of a request let through by
+// circuitAllow, logging when it opens or closes the circuit. Secrets are
+// removed from the recorded error; they are passed in rather than read from
+// c because logins record their outcome while holding the credentials lock.
+func (c *DirectusClient) circuitRecord(ctx context.Context, resp *http.Response, err error, secrets []string) {
+	b := c.CircuitBreaker
+	if b == nil {
+		return
+	}
+	var failure error
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// Canceled requests say nothing about the instance; a canceled
+		// probe lets the next request probe instead.
+		b.mu.Lock()
+		b.probing = false
+		b.mu.Unlock()
+		return
+	case err != nil:
+		failure = redactErrorSecrets(err, secrets)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		failure = fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasClosed := b.state == CircuitClosed
+	b.probing = false
+	if failure == nil {
+		b.count, b.lastErr = 0, nil
+		if !wasClosed {
+			b.state = CircuitClosed
+			c.logger().Info("circuit breaker closed, the instance answers again", "url", RedactURL(c.URL))
+		}
+		return
+	}
+	b.count++
+	b.lastErr = failure
+	if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.count >= b.failures) {
+		b.state = CircuitOpen
+		b.retryAt = time.Now().Add(b.coolDown)
+		c.logger().Warn("circuit breaker opened, failing requests without sending them", "url", RedactURL(c.URL),
+			"failures", b.count, "cool_down", b.coolDown, "error", failure)
+	}
+}
@@ -0,0 +1,173 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// noRetry returns the options of a quiet client sending every request once.
+func noRetry(opts ...gomigratedirectus.ClientOption) []gomigratedirectus.ClientOption {
+	return quiet(append([]gomigratedirectus.ClientOption{
+		gomigratedirectus.WithRetryPolicy(gomigratedirectus.RetryPolicy{MaxAttempts: 1}),
+	}, opts...)...)
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	ctx := context.Background()
+	server := directustest.NewServer(t)
+	for n := 1; n <= 3; n++ {
+		server.Fail("/schema/snapshot", n, directustest.Failure{Status: http.StatusInternalServerError})
+	}
+	client := server.Client(noRetry(gomigratedirectus.WithCircuitBreaker(3, time.Hour))...)
+
+	for n := 1; n <= 3; n++ {
+		if _, err := client.GetSnapshot(ctx); err == nil || errors.Is(err, gomigratedirectus.ErrCircuitOpen) {
+			t.Fatalf("request %d: GetSnapshot error = %v, want the 500", n, err)
+		}
+	}
+	if got := client.CircuitBreaker.State(); got != gomigratedirectus.CircuitOpen {
+		t.Fatalf("state after 3 failures = %s, want open", got)
+	}
+
+	_, err := client.GetSnapshot(ctx)
+	var open *gomigratedirectus.CircuitOpenError
+	if !errors.As(err, &open) {
+		t.Fatalf("GetSnapshot error = %v, want a CircuitOpenError", err)
+	}
+	if open.Failures != 3 || open.LastErr == nil {
+		t.Errorf("CircuitOpenError = %+v, want 3 failures and the last error", open)
+	}
+	if n := len(server.Requests()); n != 3 {
+		t.Errorf("server received %d requests, want 3: none while open", n)
+	}
+}
+
+func TestCircuitBreakerSuccessResetsCount(t *testing.T) {
+	ctx := context.Background()
+	server := directustest.NewServer(t)
+	server.Fail("/schema/snapshot", 1, directustest.Failure{Status: http.StatusBadGateway})
+	server.Fail("/schema/snapshot", 3, directustest.Failure{Status: http.StatusBadGateway})
+	client := server.Client(noRetry(gomigratedirectus.WithCircuitBreaker(2, time.Hour))...)
+
+	// Failures are only counted while consecutive.
+	for range 3 {
+		client.GetSnapshot(ctx)
+	}
+	if got := client.CircuitBreaker.State(); got != gomigratedirectus.CircuitClosed {
+		t.Errorf("state = %s, want closed", got)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name      string
+		probeFail bool
+		wantState gomigratedirectus.CircuitState
+	}{
+		{"probe succeeds", false, gomigratedirectus.CircuitClosed},
+		{"probe fails", true, gomigratedirectus.CircuitOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			const coolDown = 50 * time.Millisecond
+			server := directustest.NewServer(t)
+			server.Fail("/schema/snapshot", 1, directustest.Failure{Status: http.StatusServiceUnavailable})
+			if tt.probeFail {
+				server.Fail("/schema/snapshot", 2, directustest.Failure{Status: http.StatusServiceUnavailable})
+			}
+			client := server.Client(noRetry(gomigratedirectus.WithCircuitBreaker(1, coolDown))...)
+
+			client.GetSnapshot(ctx)
+			if got := client.CircuitBreaker.State(); got != gomigratedirectus.CircuitOpen {
+				t.Fatalf("state after the failure = %s, want open", got)
+			}
+			time.Sleep(coolDown)
+			if got := client.CircuitBreaker.State(); got != gomigratedirectus.CircuitHalfOpen {
+				t.Fatalf("state after the cool-down = %s, want half-open", got)
+			}
+
+			_, err := client.GetSnapshot(ctx)
+			if gotErr := err != nil; gotErr != tt.probeFail {
+				t.Errorf("probe error = %v, want error %v", err, tt.probeFail)
+			}
+			if errors.Is(err, gomigratedirectus.ErrCircuitOpen) {
+				t.Errorf("probe was not sent: %v", err)
+			}
+			if got := client.CircuitBreaker.State(); got != tt.wantState {
+				t.Errorf("state after the probe = %s, want %s", got, tt.wantState)
+			}
+			if n := len(server.Requests()); n != 2 {
+				t.Errorf("server received %d requests, want 2", n)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	ctx := context.Background()
+	const coolDown = 50 * time.Millisecond
+	server := directustest.NewServer(t)
+	server.Fail("/schema/snapshot", 1, directustest.Failure{Status: http.StatusInternalServerError})
+	server.Fail("/schema/snapshot", 2, directustest.Failure{Delay: 200 * time.Millisecond})
+	client := server.Client(noRetry(gomigratedirectus.WithCircuitBreaker(1, coolDown))...)
+
+	client.GetSnapshot(ctx)
+	time.Sleep(coolDown)
+
+	probed := make(chan error, 1)
+	go func() {
+		_, err := client.GetSnapshot(ctx)
+		probed <- err
+	}()
+	// While the probe is in flight, other requests are refused.
+	deadline := time.Now().Add(time.Second)
+	for len(server.Requests()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := client.GetSnapshot(ctx); !errors.Is(err, gomigratedirectus.ErrCircuitOpen) {
+		t.Errorf("GetSnapshot during the probe error = %v, want ErrCircuitOpen", err)
+	}
+	if err := <-probed; err != nil {
+		t.Errorf("probe: %v", err)
+	}
+	if got := client.CircuitBreaker.State(); got != gomigratedirectus.CircuitClosed {
+		t.Errorf("state after the probe = %s, want closed", got)
+	}
+}
+
+func TestCircuitBreakerLoginConnectionError(t *testing.T) {
+	// A login failing to connect records its failure while holding the
+	// credentials lock, which must not be taken again to redact the error.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	client := gomigratedirectus.NewDirectusClientWithCredentials(closed.URL, "admin@example.com", "s3cret",
+		noRetry(gomigratedirectus.WithCircuitBreaker(1, time.Hour))...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.GetSnapshot(ctx)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("GetSnapshot of a closed port succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetSnapshot with credentials and a circuit breaker did not return")
+	}
+
+	if _, err := client.GetSnapshot(ctx); !errors.Is(err, gomigratedirectus.ErrCircuitOpen) {
+		t.Errorf("second GetSnapshot error = %v, want ErrCircuitOpen", err)
+	}
+}
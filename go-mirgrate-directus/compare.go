@@ -0,0 +1,192 @@
+package gomirgratedirectus
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// SnapshotComparison is the result of CompareSnapshots.
+type SnapshotComparison struct {
+	// Diff lists the changes in the shape of a Directus diff, so that it
+	// can be passed to RenderDiff. It has no hash and cannot be applied.
+	Diff *Diff
+	// Summary condenses Diff.
+	Summary DiffSummary
+}
+
+// Changed reports whether the snapshots differ.
+func (c *SnapshotComparison) Changed() bool {
+	return !c.Diff.IsEmpty()
+}
+
+// CompareSnapshots computes locally, without any Directus instance, the
+// changes that turn snapshot a into snapshot b: collections, fields and
+// relations that were added or removed, and every property of their meta and
+// schema that changed. Entries follow the deep-diff conventions of Directus
+// with a as the left-hand side, but unlike Directus arrays are compared as a
+// whole.
+func CompareSnapshots(a, b *Snapshot) (*SnapshotComparison, error) {
+	if a == nil || b == nil {
+		return nil, fmt.Errorf("cannot compare a nil snapshot")
+	}
+
+	diff := &Diff{}
+	collections, err := compareItems(a.Collections, b.Collections, func(c Collection) string { return c.Collection })
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range collections {
+		diff.Diff.Collections = append(diff.Diff.Collections, CollectionDiff{Collection: item.value.Collection, Diff: item.entries})
+	}
+
+	fields, err := compareItems(a.Fields, b.Fields, func(f Field) string { return f.Collection + "." + f.Field })
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range fields {
+		diff.Diff.Fields = append(diff.Diff.Fields, FieldDiff{Collection: item.value.Collection, Field: item.value.Field, Diff: item.entries})
+	}
+
+	relations, err := compareItems(a.Relations, b.Relations, func(r Relation) string { return r.Collection + "." + r.Field })
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range relations {
+		diff.Diff.Relations = append(diff.Diff.Relations, RelationDiff{
+			Collection:        item.value.Collection,
+			Field:             item.value.Field,
+			RelatedCollection: item.value.RelatedCollection,
+			Diff:              item.entries,
+		})
+	}
+
+	return &SnapshotComparison{Diff: diff, Summary: SummarizeDiff(diff)}, nil
+}
+
+// itemChanges holds the entries of one changed item; value is the item from
+// b, or from a when it was deleted.
+type itemChanges[T any] struct {
+	value   T
+	entries []DiffEntry
+}
+
+// compareItems matches the items of a and b by key and returns the changes,
+// sorted by key.
+func compareItems[T any](a, b []T, key func(T) string) ([]itemChanges[T], error) {
+	before := make(map[string]T, len(a))
+	for _, item := range a {
+		before[key(item)] = item
+	}
+	after := make(map[string]T, len(b))
+	for _, item := range b {
+		after[key(item)] = item
+	}
+
+	keys := make([]string, 0, len(before)+len(after))
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	var changes []itemChanges[T]
+	for _, k := range keys {
+		lhs, inA := before[k]
+		rhs, inB := after[k]
+		switch {
+		case !inA:
+			raw, err := json.Marshal(rhs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode %s: %w", k, err)
+			}
+			changes = append(changes, itemChanges[T]{rhs, []DiffEntry{{Kind: KindNew, Rhs: raw}}})
+		case !inB:
+			raw, err := json.Marshal(lhs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode %s: %w", k, err)
+			}
+			changes = append(changes, itemChanges[T]{lhs, []DiffEntry{{Kind: KindDeleted, Lhs: raw}}})
+		default:
+			l, err := toGeneric(lhs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode %s: %w", k, err)
+			}
+			r, err := toGeneric(rhs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode %s: %w", k, err)
+			}
+			if entries := deepDiff(nil, l, r); len(entries) > 0 {
+				changes = append(changes, itemChanges[T]{rhs, entries})
+			}
+		}
+	}
+	return changes, nil
+}
+
+// toGeneric converts v to the maps, slices and scalars encoding/json decodes
+// into any.
+func toGeneric(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
+
+// deepDiff returns the entries that turn lhs into rhs. Objects are compared
+// key by key; any other differing values, including arrays, yield a single
+// edit.
+func deepDiff(path []any, lhs, rhs any) []DiffEntry {
+	l, lok := lhs.(map[string]any)
+	r, rok := rhs.(map[string]any)
+	if !lok || !rok {
+		if reflect.DeepEqual(lhs, rhs) {
+			return nil
+		}
+		return []DiffEntry{{Kind: KindEdited, Path: path, Lhs: mustMarshal(lhs), Rhs: mustMarshal(rhs)}}
+	}
+
+	keys := make([]string, 0, len(l)+len(r))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	for k := range r {
+		if _, ok := l[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	var entries []DiffEntry
+	for _, k := range keys {
+		sub := append(slices.Clip(path), k)
+		lv, inL := l[k]
+		rv, inR := r[k]
+		switch {
+		case !inL:
+			entries = append(entries, DiffEntry{Kind: KindNew, Path: sub, Rhs: mustMarshal(rv)})
+		case !inR:
+			entries = append(entries, DiffEntry{Kind: KindDeleted, Path: sub, Lhs: mustMarshal(lv)})
+		default:
+			entries = append(entries, deepDiff(sub, lv, rv)...)
+		}
+	}
+	return entries
+}
+
+// mustMarshal encodes a value produced by toGeneric, which cannot fail.
+func mustMarshal(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
@@ -0,0 +1,64 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// WithCompression makes the client gzip the bodies of /schema/diff and
+// /schema/apply requests. If the server rejects a compressed body with 415,
+// the client falls back to uncompressed bodies for the rest of its lifetime.
+func WithCompression(enabled bool) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.compression = enabled
+	}
+}
+
+// compressBody returns body as gzip.
+func compressBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressResponse replaces the body of resp by its decompressed form when
+// the server answered with Content-Encoding: gzip. The client sets
+// Accept-Encoding itself, so net/http leaves decompression to us.
+func decompressResponse(resp *http.Response) error {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return nil
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		if err == io.EOF {
+			// Empty body, for example on 204 responses.
+			return nil
+		}
+		return err
+	}
+	resp.Body = &gzipBody{Reader: zr, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	return nil
+}
+
+// gzipBody closes both the gzip reader and the underlying response body.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
@@ -0,0 +1,217 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// largeSnapshot returns the snapshot of the latest fixture with its schema
+// repeated copies times under renamed collections, to measure the cost of
+// moving a schema of hundreds of collections.
+func largeSnapshot(tb testing.TB, copies int) *gomigratedirectus.Snapshot {
+	tb.Helper()
+	versions := directustest.FixtureVersions()
+	fixture, err := directustest.LoadFixture(versions[len(versions)-1])
+	if err != nil {
+		tb.Fatal(err)
+	}
+	base := fixture.Snapshot
+	snapshot := &gomigratedirectus.Snapshot{Version: base.Version, Directus: base.Directus, Vendor: base.Vendor}
+	for i := range copies {
+		rename := func(name string) string {
+			if name == "" || strings.HasPrefix(name, "directus_") {
+				return name
+			}
+			return fmt.Sprintf("%s_%d", name, i)
+		}
+		for _, c := range base.Collections {
+			c.Collection = rename(c.Collection)
+			snapshot.Collections = append(snapshot.Collections, c)
+		}
+		for _, f := range base.Fields {
+			f.Collection = rename(f.Collection)
+			snapshot.Fields = append(snapshot.Fields, f)
+		}
+		for _, r := range base.Relations {
+			r.Collection, r.RelatedCollection = rename(r.Collection), rename(r.RelatedCollection)
+			snapshot.Relations = append(snapshot.Relations, r)
+		}
+	}
+	return snapshot
+}
+
+func TestCompression(t *testing.T) {
+	server := directustest.NewServer(t)
+	client := server.Client(quiet(gomigratedirectus.WithCompression(true))...)
+	snapshot := largeSnapshot(t, 10)
+
+	if _, err := client.GetDiff(context.Background(), snapshot, false); err != gomigratedirectus.ErrNoChanges {
+		t.Fatalf("GetDiff = %v, want ErrNoChanges", err)
+	}
+	req := server.Requests()[0]
+	if got := req.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Content-Encoding = %q, want gzip", got)
+	}
+	if received := server.DiffRequests(); len(received) != 1 || len(received[0].Collections) != len(snapshot.Collections) {
+		t.Errorf("server did not receive the snapshot intact")
+	}
+	if sent, _ := client.LastTransferBytes(); sent != int64(len(req.Body)) {
+		t.Errorf("LastTransferBytes sent = %d, want the %d uncompressed bytes", sent, len(req.Body))
+	}
+}
+
+// BenchmarkGetDiff reports, besides the time, the raw-B/op of the diff
+// request body and the wire-B/op sent for it, to show the compression
+// ratio. A single fixture is closer to a real schema than its repeated
+// copies, which compress better.
+func BenchmarkGetDiff(b *testing.B) {
+	for _, copies := range []int{1, 200} {
+		snapshot := largeSnapshot(b, copies)
+		body, err := snapshot.MarshalJSON()
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, compression := range []bool{false, true} {
+			name := "plain"
+			if compression {
+				name = "gzip"
+			}
+			b.Run(fmt.Sprintf("copies=%d/%s", copies, name), func(b *testing.B) {
+				// Unlike a directustest server, this one neither records nor
+				// decompresses the bodies, so only the client is measured.
+				var received atomic.Int64
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					n, _ := io.Copy(io.Discard, r.Body)
+					received.Add(n)
+					w.WriteHeader(http.StatusNoContent)
+				}))
+				defer server.Close()
+				client := gomigratedirectus.NewDirectusClient(server.URL, "token", quiet(gomigratedirectus.WithCompression(compression))...)
+				b.SetBytes(int64(len(body)))
+				b.ReportAllocs()
+				for b.Loop() {
+					if _, err := client.GetDiffRaw(context.Background(), body, false); err != gomigratedirectus.ErrNoChanges {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(body)), "raw-B/op")
+				b.ReportMetric(float64(received.Load())/float64(b.N), "wire-B/op")
+			})
+		}
+	}
+}
+
+func BenchmarkGetSnapshot(b *testing.B) {
+	server := directustest.NewServer(b)
+	snapshot := largeSnapshot(b, 200)
+	server.SetSnapshot(snapshot)
+	client := server.Client(quiet()...)
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := client.GetSnapshot(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSnapshotToDiff moves a large snapshot from a base instance into a
+// diff request along each data path, to compare their allocations: decoded
+// into generic maps as earlier versions did, converted to them with ToMap
+// for compatibility, decoded into a Snapshot, or passed through raw.
+func BenchmarkSnapshotToDiff(b *testing.B) {
+	body, err := largeSnapshot(b, 200).MarshalJSON()
+	if err != nil {
+		b.Fatal(err)
+	}
+	enveloped := []byte(`{"data":` + string(body) + `}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/schema/snapshot":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			if r.URL.Query().Has("export") {
+				w.Write(body)
+			} else {
+				w.Write(enveloped)
+			}
+		case "/schema/diff":
+			io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	client := gomigratedirectus.NewDirectusClient(server.URL, "token", quiet()...)
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name string
+		run  func() error
+	}{
+		{"map", func() error {
+			data, err := client.GetSnapshotRaw(ctx, gomigratedirectus.FormatJSON)
+			if err != nil {
+				return err
+			}
+			var m map[string]any
+			if err := json.Unmarshal(data, &m); err != nil {
+				return err
+			}
+			if data, err = json.Marshal(m); err != nil {
+				return err
+			}
+			_, err = client.GetDiffRaw(ctx, data, false)
+			return err
+		}},
+		{"ToMap", func() error {
+			snapshot, err := client.GetSnapshot(ctx)
+			if err != nil {
+				return err
+			}
+			m, err := snapshot.ToMap()
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(m)
+			if err != nil {
+				return err
+			}
+			_, err = client.GetDiffRaw(ctx, data, false)
+			return err
+		}},
+		{"typed", func() error {
+			snapshot, err := client.GetSnapshot(ctx)
+			if err != nil {
+				return err
+			}
+			_, err = client.GetDiff(ctx, snapshot, false)
+			return err
+		}},
+		{"raw", func() error {
+			data, err := client.GetSnapshotRaw(ctx, gomigratedirectus.FormatJSON)
+			if err != nil {
+				return err
+			}
+			_, err = client.GetDiffRaw(ctx, data, false)
+			return err
+		}},
+	} {
+		b.Run(tt.name, func(b *testing.B) {
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			for b.Loop() {
+				if err := tt.run(); err != gomigratedirectus.ErrNoChanges {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// ConditionalSnapshot is a snapshot fetched by GetSnapshotIfChanged, with what
+// is needed to tell whether a later fetch returns the same one.
+type ConditionalSnapshot struct {
+	Snapshot *Snapshot
+	// ETag and LastModified are the validators sent by the server, if any.
+	ETag         string
+	LastModified string
+	// BodyHash is the SHA-256 of the response body. It is compared when the
+	// server sends no validators or ignores them.
+	BodyHash string
+}
+
+// GetSnapshotIfChanged is like GetSnapshot for polling a snapshot that rarely
+// changes. It sends the validators of prev, if not nil, as If-None-Match and
+// If-Modified-Since; a 304 response returns prev with changed unset, without
+// a body to download. Servers that do not support conditional requests send
+// the snapshot again, which is then only decoded if its body differs from the
+// one of prev, so that callers can skip what they would redo with it.
+func (c *DirectusClient) GetSnapshotIfChanged(ctx context.Context, prev *ConditionalSnapshot) (_ *ConditionalSnapshot, changed bool, err error) {
+	ctx, done := startOperation(ctx, "snapshot", c.Timeouts.Snapshot)
+	defer func() { err = done(err) }()
+
+	if prev != nil {
+		header := http.Header{}
+		if prev.ETag != "" {
+			header.Set("If-None-Match", prev.ETag)
+		} else if prev.LastModified != "" {
+			header.Set("If-Modified-Since", prev.LastModified)
+		}
+		ctx = withRequestHeaders(ctx, header)
+	}
+
+	resp, err := c.send(ctx, "snapshot", http.MethodGet, "/schema/snapshot", nil, nil, true)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		return prev, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, c.newDirectusError("snapshot", resp)
+	}
+
+	body, err := c.readBody("snapshot", resp)
+	if err != nil {
+		return nil, false, err
+	}
+	sum := sha256.Sum256(body)
+	current := &ConditionalSnapshot{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		BodyHash:     hex.EncodeToString(sum[:]),
+	}
+	if prev != nil && prev.BodyHash == current.BodyHash {
+		current.Snapshot = prev.Snapshot
+		return current, false, nil
+	}
+
+	var snapshot Snapshot
+	if err := c.decodeData("snapshot", bytes.NewReader(body), &snapshot); err != nil {
+		return nil, false, err
+	}
+	current.Snapshot = &snapshot
+	return current, true, nil
+}
+
+// requestHeadersKey is the context key of the headers added to the requests
+// of a single operation.
+type requestHeadersKey struct{}
+
+// withRequestHeaders returns ctx carrying header, so that the requests sent
+// with it carry it too.
+func withRequestHeaders(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, requestHeadersKey{}, header)
+}
@@ -0,0 +1,109 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// snapshotRequests returns the requests server received for the snapshot.
+func snapshotRequests(server *directustest.Server) []directustest.Request {
+	var requests []directustest.Request
+	for _, req := range server.Requests() {
+		if req.Path == "/schema/snapshot" {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+func TestGetSnapshotIfChangedETag(t *testing.T) {
+	ctx := context.Background()
+	server := directustest.NewServer(t)
+	server.SetSnapshot(modelsSnapshot(t))
+	server.ConditionalRequests(true)
+	client := server.Client(quiet()...)
+
+	first, changed, err := client.GetSnapshotIfChanged(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || first.Snapshot == nil || first.ETag == "" {
+		t.Fatalf("first fetch = %+v, changed %v, want a snapshot with an ETag", first, changed)
+	}
+
+	// The second request revalidates; the 304 hands back the cached
+	// snapshot itself, with nothing decoded.
+	second, changed, err := client.GetSnapshotIfChanged(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := snapshotRequests(server)
+	if len(requests) != 2 {
+		t.Fatalf("server received %d snapshot requests, want 2", len(requests))
+	}
+	if got := requests[0].Header.Get("If-None-Match"); got != "" {
+		t.Errorf("first request sent If-None-Match %q", got)
+	}
+	if got := requests[1].Header.Get("If-None-Match"); got != first.ETag {
+		t.Errorf("second request sent If-None-Match %q, want %q", got, first.ETag)
+	}
+	if changed || second != first || second.Snapshot != first.Snapshot {
+		t.Errorf("second fetch = %p, changed %v, want the cached %p", second, changed, first)
+	}
+
+	// A changed schema gets a new ETag and is decoded.
+	s := modelsSnapshot(t)
+	s.Collections = s.Collections[1:]
+	server.SetSnapshot(s)
+	third, changed, err := client.GetSnapshotIfChanged(ctx, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || third.ETag == first.ETag || len(third.Snapshot.Collections) != len(s.Collections) {
+		t.Errorf("fetch after a change = %+v, changed %v, want the new snapshot", third, changed)
+	}
+}
+
+func TestGetSnapshotIfChangedBodyHash(t *testing.T) {
+	ctx := context.Background()
+	server := directustest.NewServer(t)
+	server.SetSnapshot(modelsSnapshot(t))
+	client := server.Client(quiet()...)
+
+	first, changed, err := client.GetSnapshotIfChanged(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || first.ETag != "" || first.LastModified != "" || first.BodyHash == "" {
+		t.Fatalf("first fetch = %+v, changed %v, want a body hash and no validators", first, changed)
+	}
+
+	// Without validators the whole body comes again, but its hash tells it
+	// is unchanged and the previous snapshot is reused.
+	second, changed, err := client.GetSnapshotIfChanged(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range snapshotRequests(server) {
+		if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+			t.Errorf("request sent validators: %v", req.Header)
+		}
+	}
+	if changed || second.BodyHash != first.BodyHash || second.Snapshot != first.Snapshot {
+		t.Errorf("second fetch = %+v, changed %v, want the snapshot of the first", second, changed)
+	}
+
+	s := modelsSnapshot(t)
+	s.Collections = s.Collections[1:]
+	server.SetSnapshot(s)
+	third, changed, err := client.GetSnapshotIfChanged(ctx, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || third.BodyHash == first.BodyHash || third.Snapshot == first.Snapshot ||
+		len(third.Snapshot.Collections) != len(s.Collections) {
+		t.Errorf("fetch after a change = %+v, changed %v, want the new snapshot", third, changed)
+	}
+}
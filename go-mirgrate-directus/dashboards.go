@@ -0,0 +1,367 @@
+package gomirgratedirectus
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Dashboard is an Insights dashboard, as listed by /dashboards. Extra holds
+// the remaining properties, such as icon, note and color.
+type Dashboard struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Panel is a panel of a dashboard, as listed by /panels. Extra holds the
+// remaining properties, such as type, position_x, width and options.
+type Panel struct {
+	ID        string `json:"id,omitempty"`
+	Dashboard string `json:"dashboard"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (d Dashboard) MarshalJSON() ([]byte, error) {
+	type plain Dashboard
+	return marshalWithExtra(plain(d), d.Extra)
+}
+
+func (d *Dashboard) UnmarshalJSON(data []byte) error {
+	type plain Dashboard
+	return unmarshalWithExtra(data, (*plain)(d), &d.Extra)
+}
+
+func (p Panel) MarshalJSON() ([]byte, error) {
+	type plain Panel
+	return marshalWithExtra(plain(p), p.Extra)
+}
+
+func (p *Panel) UnmarshalJSON(data []byte) error {
+	type plain Panel
+	return unmarshalWithExtra(data, (*plain)(p), &p.Extra)
+}
+
+// dashboardReadOnlyKeys are the dashboard and panel properties that are not
+// copied: panels are synced separately and the rest is maintained by
+// Directus.
+var dashboardReadOnlyKeys = []string{"panels", "date_created", "user_created"}
+
+// ListDashboards returns all dashboards of the project.
+func (c *DirectusClient) ListDashboards(ctx context.Context) (_ []Dashboard, err error) {
+	ctx, done := startOperation(ctx, "list dashboards", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var dashboards []Dashboard
+	if err := c.doJSON(ctx, "list dashboards", http.MethodGet, "/dashboards", url.Values{"limit": {"-1"}}, nil, &dashboards); err != nil {
+		return nil, err
+	}
+	return dashboards, nil
+}
+
+// CreateDashboard creates dashboard, ignoring its ID, and returns the created
+// dashboard.
+func (c *DirectusClient) CreateDashboard(ctx context.Context, dashboard Dashboard) (_ *Dashboard, err error) {
+	ctx, done := startOperation(ctx, "create dashboard", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	dashboard.ID = ""
+	var created Dashboard
+	if err := c.doJSON(ctx, "create dashboard", http.MethodPost, "/dashboards", nil, dashboard, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateDashboard replaces the properties of the dashboard with the given ID
+// with those of dashboard.
+func (c *DirectusClient) UpdateDashboard(ctx context.Context, id string, dashboard Dashboard) (err error) {
+	ctx, done := startOperation(ctx, "update dashboard", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	dashboard.ID = ""
+	return c.doJSON(ctx, "update dashboard", http.MethodPatch, "/dashboards/"+url.PathEscape(id), nil, dashboard, nil)
+}
+
+// ListPanels returns the panels of all dashboards of the project.
+func (c *DirectusClient) ListPanels(ctx context.Context) (_ []Panel, err error) {
+	ctx, done := startOperation(ctx, "list panels", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var panels []Panel
+	if err := c.doJSON(ctx, "list panels", http.MethodGet, "/panels", url.Values{"limit": {"-1"}}, nil, &panels); err != nil {
+		return nil, err
+	}
+	return panels, nil
+}
+
+// CreatePanel creates panel, ignoring its ID.
+func (c *DirectusClient) CreatePanel(ctx context.Context, panel Panel) (err error) {
+	ctx, done := startOperation(ctx, "create panel", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	panel.ID = ""
+	return c.doJSON(ctx, "create panel", http.MethodPost, "/panels", nil, panel, nil)
+}
+
+// DeletePanel deletes the panel with the given ID.
+func (c *DirectusClient) DeletePanel(ctx context.Context, id string) (err error) {
+	ctx, done := startOperation(ctx, "delete panel", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "delete panel", http.MethodDelete, "/panels/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// DashboardSyncOptions configures SyncDashboards.
+type DashboardSyncOptions struct {
+	// DryRun only computes the changes; nothing is written.
+	DryRun bool
+	// PendingDiff is a diff for the target that has not been applied yet,
+	// as in a dry run. The collections it creates count as existing when
+	// panel references are checked.
+	PendingDiff *Diff
+}
+
+// PanelReference is a panel referencing a collection the target does not
+// have.
+type PanelReference struct {
+	Dashboard string `json:"dashboard"`
+	// Panel is the panel name, or its type if it has none.
+	Panel      string `json:"panel"`
+	Collection string `json:"collection"`
+}
+
+// DashboardsResult is the result of SyncDashboards.
+type DashboardsResult struct {
+	// Dashboards counts the dashboards created and updated; dashboards are
+	// never deleted.
+	Dashboards ChangeCounts `json:"dashboards"`
+	// Panels counts the panels created and deleted. Panels have no stable
+	// identity, so the panels of a dashboard are replaced as a whole when
+	// any of them differs.
+	Panels ChangeCounts `json:"panels"`
+	// MissingCollections lists the panels of the base that reference a
+	// collection the target does not have.
+	MissingCollections []PanelReference `json:"missing_collections,omitempty"`
+	// DryRun reports that the changes were only computed.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Changed reports whether any dashboard or panel changed.
+func (r *DashboardsResult) Changed() bool {
+	return r.Dashboards.Total() > 0 || r.Panels.Total() > 0
+}
+
+// SyncDashboards copies the Insights dashboards of base, with their panels,
+// to target. Dashboards are matched by name and created or updated on the
+// target; dashboards that only exist on the target are left alone. The panels
+// of each synced dashboard are replaced wholesale with those of the base,
+// keeping their position, size and options, unless they already match.
+//
+// Panels reference collections, so the schema should be migrated first.
+// References to collections the target does not have are reported in
+// MissingCollections but do not stop the sync.
+func SyncDashboards(ctx context.Context, base, target *DirectusClient, opts DashboardSyncOptions) (*DashboardsResult, error) {
+	baseDashboards, err := base.ListDashboards(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list base dashboards: %w", err)
+	}
+	basePanels, err := base.ListPanels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list base panels: %w", err)
+	}
+	targetDashboards, err := target.ListDashboards(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target dashboards: %w", err)
+	}
+	targetPanels, err := target.ListPanels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target panels: %w", err)
+	}
+	collections, err := targetCollections(ctx, target, opts.PendingDiff)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DashboardsResult{DryRun: opts.DryRun}
+	slices.SortFunc(baseDashboards, func(a, b Dashboard) int { return strings.Compare(a.Name, b.Name) })
+	targetByName := indexByName(targetDashboards, func(d Dashboard) string { return d.Name })
+	for _, dashboard := range baseDashboards {
+		panels := panelsOf(basePanels, dashboard.ID)
+		for _, panel := range panels {
+			if collection := panelCollection(panel); collection != "" && !collections[collection] {
+				result.MissingCollections = append(result.MissingCollections,
+					PanelReference{Dashboard: dashboard.Name, Panel: panelName(panel), Collection: collection})
+			}
+		}
+
+		targetID, err := syncDashboard(ctx, target, dashboard, targetByName, opts.DryRun, &result.Dashboards)
+		if err != nil {
+			return result, err
+		}
+		var existing []Panel
+		if targetID != "" {
+			existing = panelsOf(targetPanels, targetID)
+		}
+		if err := syncPanels(ctx, target, dashboard.Name, targetID, panels, existing, opts.DryRun, &result.Panels); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// targetCollections returns the names of the collections of target, as they
+// will be once pending, if not nil, has been applied.
+func targetCollections(ctx context.Context, target *DirectusClient, pending *Diff) (map[string]bool, error) {
+	snapshot, err := target.GetSnapshot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get target snapshot: %w", err)
+	}
+	collections := map[string]bool{}
+	for _, collection := range snapshot.Collections {
+		collections[collection.Collection] = true
+	}
+	if pending != nil {
+		for _, item := range pending.Diff.Collections {
+			switch ClassifyEntries(item.Diff) {
+			case ChangeCreated:
+				collections[item.Collection] = true
+			case ChangeDeleted:
+				delete(collections, item.Collection)
+			}
+		}
+	}
+	return collections, nil
+}
+
+// syncDashboard creates or updates dashboard on target and returns its ID
+// there, which is empty when it would only be created in a dry run.
+func syncDashboard(ctx context.Context, target *DirectusClient, dashboard Dashboard, targetByName map[string]Dashboard, dryRun bool, counts *ChangeCounts) (string, error) {
+	dashboard.Extra = withoutKeys(dashboard.Extra, dashboardReadOnlyKeys)
+	existing, ok := targetByName[dashboard.Name]
+	if !ok {
+		counts.Created++
+		if dryRun {
+			return "", nil
+		}
+		created, err := target.CreateDashboard(ctx, dashboard)
+		if err != nil {
+			return "", fmt.Errorf("failed to create dashboard %s: %w", dashboard.Name, err)
+		}
+		return created.ID, nil
+	}
+
+	existing.Extra = withoutKeys(existing.Extra, dashboardReadOnlyKeys)
+	if sameExceptID(dashboard, existing) {
+		return existing.ID, nil
+	}
+	counts.Updated++
+	if !dryRun {
+		if err := target.UpdateDashboard(ctx, existing.ID, dashboard); err != nil {
+			return "", fmt.Errorf("failed to update dashboard %s: %w", dashboard.Name, err)
+		}
+	}
+	return existing.ID, nil
+}
+
+// syncPanels replaces the panels have of the target dashboard with the ID
+// targetID, the dashboard called name, with want unless both already match.
+func syncPanels(ctx context.Context, target *DirectusClient, name, targetID string, want, have []Panel, dryRun bool, counts *ChangeCounts) error {
+	if samePanels(want, have) {
+		return nil
+	}
+	counts.Deleted += len(have)
+	counts.Created += len(want)
+	if dryRun {
+		return nil
+	}
+	for _, panel := range have {
+		if err := target.DeletePanel(ctx, panel.ID); err != nil {
+			return fmt.Errorf("failed to delete panel %s of dashboard %s: %w", panelName(panel), name, err)
+		}
+	}
+	for _, panel := range want {
+		panel.Dashboard = targetID
+		panel.Extra = withoutKeys(panel.Extra, dashboardReadOnlyKeys)
+		if err := target.CreatePanel(ctx, panel); err != nil {
+			return fmt.Errorf("failed to create panel %s of dashboard %s: %w", panelName(panel), name, err)
+		}
+	}
+	return nil
+}
+
+// samePanels reports whether a and b hold the same panels, in any order and
+// regardless of their IDs and dashboards.
+func samePanels(a, b []Panel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	normalize := func(panels []Panel) []string {
+		keys := make([]string, 0, len(panels))
+		for _, panel := range panels {
+			panel.ID, panel.Dashboard = "", ""
+			panel.Extra = withoutKeys(panel.Extra, dashboardReadOnlyKeys)
+			generic, err := toGeneric(panel)
+			if err != nil {
+				return nil
+			}
+			data, _ := json.Marshal(generic)
+			keys = append(keys, string(data))
+		}
+		slices.Sort(keys)
+		return keys
+	}
+	keysA, keysB := normalize(a), normalize(b)
+	return keysA != nil && keysB != nil && slices.Equal(keysA, keysB)
+}
+
+// panelsOf returns the panels of the dashboard with the given ID, sorted by
+// position so that they are created in reading order.
+func panelsOf(panels []Panel, dashboard string) []Panel {
+	var matching []Panel
+	for _, panel := range panels {
+		if panel.Dashboard == dashboard {
+			matching = append(matching, panel)
+		}
+	}
+	slices.SortStableFunc(matching, func(a, b Panel) int {
+		return cmp.Or(cmp.Compare(panelNumber(a, "position_y"), panelNumber(b, "position_y")),
+			cmp.Compare(panelNumber(a, "position_x"), panelNumber(b, "position_x")))
+	})
+	return matching
+}
+
+// panelNumber returns the numeric property key of panel, or 0.
+func panelNumber(panel Panel, key string) float64 {
+	var n float64
+	_ = json.Unmarshal(panel.Extra[key], &n)
+	return n
+}
+
+// panelName returns the name of panel, or its type if it has none.
+func panelName(panel Panel) string {
+	for _, key := range []string{"name", "type"} {
+		var s string
+		if json.Unmarshal(panel.Extra[key], &s) == nil && s != "" {
+			return s
+		}
+	}
+	return panel.ID
+}
+
+// panelCollection returns the collection panel queries, taken from the
+// collection option that the built-in panel types use, or "".
+func panelCollection(panel Panel) string {
+	var options struct {
+		Collection string `json:"collection"`
+	}
+	_ = json.Unmarshal(panel.Extra["options"], &options)
+	return options.Collection
+}
@@ -0,0 +1,495 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultDataBatchSize is the number of items SyncData reads per page and
+// writes per request unless configured otherwise.
+const DefaultDataBatchSize = 100
+
+// Item is an item of a user collection, as raw JSON values by field.
+type Item map[string]json.RawMessage
+
+// ListItems returns all items of collection with the given fields, sorted by
+// sort and read in pages of pageSize items. Timeouts.Metadata bounds each
+// page request, not the whole listing, so large collections are not cut
+// short.
+func (c *DirectusClient) ListItems(ctx context.Context, collection string, fields []string, sort string, pageSize int) ([]Item, error) {
+	if pageSize <= 0 {
+		pageSize = DefaultDataBatchSize
+	}
+	path := "/items/" + url.PathEscape(collection)
+	var items []Item
+	for offset := 0; ; offset += pageSize {
+		query := url.Values{
+			"fields": {strings.Join(fields, ",")},
+			"sort":   {sort},
+			"limit":  {strconv.Itoa(pageSize)},
+			"offset": {strconv.Itoa(offset)},
+		}
+		page, err := c.listItemsPage(ctx, path, query)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+		if len(page) < pageSize {
+			return items, nil
+		}
+	}
+}
+
+// listItemsPage reads one page of ListItems.
+func (c *DirectusClient) listItemsPage(ctx context.Context, path string, query url.Values) (_ []Item, err error) {
+	ctx, done := startOperation(ctx, "list items", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var page []Item
+	if err := c.doJSON(ctx, "list items", http.MethodGet, path, query, nil, &page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// CreateItems creates items in collection in one request.
+func (c *DirectusClient) CreateItems(ctx context.Context, collection string, items []Item) (err error) {
+	ctx, done := startOperation(ctx, "create items", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "create items", http.MethodPost, "/items/"+url.PathEscape(collection), nil, items, nil)
+}
+
+// UpdateItems updates items of collection, each identified by its primary
+// key, in one request.
+func (c *DirectusClient) UpdateItems(ctx context.Context, collection string, items []Item) (err error) {
+	ctx, done := startOperation(ctx, "update items", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "update items", http.MethodPatch, "/items/"+url.PathEscape(collection), nil, items, nil)
+}
+
+// DeleteItems deletes the items of collection with the given primary keys in
+// one request.
+func (c *DirectusClient) DeleteItems(ctx context.Context, collection string, keys []json.RawMessage) (err error) {
+	ctx, done := startOperation(ctx, "delete items", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "delete items", http.MethodDelete, "/items/"+url.PathEscape(collection), nil, keys, nil)
+}
+
+// DataStrategy tells SyncData how to reconcile the items of a collection.
+type DataStrategy string
+
+const (
+	// DataUpsert creates missing items and updates differing ones. It is the
+	// default.
+	DataUpsert DataStrategy = "upsert"
+	// DataInsertOnly only creates missing items; existing items are left
+	// alone even if they differ.
+	DataInsertOnly DataStrategy = "insert-only"
+	// DataMirror upserts like DataUpsert and also deletes the target items
+	// the base does not have.
+	DataMirror DataStrategy = "mirror"
+)
+
+// DataCollection selects a collection whose items SyncData copies.
+type DataCollection struct {
+	Collection string
+	// Fields limits the copied fields. The primary key is always included;
+	// empty means every field with a database column.
+	Fields []string
+	// Strategy defaults to DataUpsert.
+	Strategy DataStrategy
+}
+
+// DataSyncOptions configures SyncData.
+type DataSyncOptions struct {
+	Collections []DataCollection
+	// BatchSize is the number of items read per page and written per
+	// request. It defaults to DefaultDataBatchSize.
+	BatchSize int
+	// DryRun only counts the changes; nothing is written.
+	DryRun bool
+	// PendingDiff is a schema diff that has not been applied to the target
+	// yet, as in a dry run. Collections it creates count as empty instead of
+	// failing the sync.
+	PendingDiff *Diff
+	// OnProgress, if set, is called after every batch written to the
+	// target, with the number of items written so far and the number to
+	// write. It is not called in a dry run.
+	OnProgress func(done, total int)
+	// Skip lists collections of Collections whose data an earlier run
+	// already synced, as recorded by a Checkpoint. They still order the
+	// others but are neither read nor written.
+	Skip []string
+	// OnCollectionDone, if set, is called once all items of a collection
+	// were written to the target. It is not called in a dry run.
+	OnCollectionDone func(collection string)
+}
+
+// DataCollectionResult counts the items of one collection.
+type DataCollectionResult struct {
+	Collection string       `json:"collection"`
+	Strategy   DataStrategy `json:"strategy"`
+	BaseRows   int          `json:"base_rows"`
+	TargetRows int          `json:"target_rows"`
+	// Rows counts the items created, updated and deleted on the target.
+	Rows ChangeCounts `json:"rows"`
+}
+
+// DataResult is the result of SyncData, with the collections in the order
+// they were written.
+type DataResult struct {
+	Collections []DataCollectionResult `json:"collections"`
+	// Skipped lists the collections of DataSyncOptions.Skip.
+	Skipped []string `json:"skipped,omitempty"`
+	// DryRun reports that the changes were only counted.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Changed reports whether any item changed.
+func (r *DataResult) Changed() bool {
+	for _, collection := range r.Collections {
+		if collection.Rows.Total() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncData copies the items of the selected collections from base to target,
+// matched by primary key and reconciled according to each collection's
+// strategy. It is meant for lookup tables, such as countries or plan tiers,
+// that must hold the same rows in every environment.
+//
+// Collections are written in dependency order, derived from the relations of
+// the base schema, so that foreign keys between them resolve. Foreign keys
+// that cannot be ordered, such as a parent field referencing its own
+// collection, are written in a second pass once all items exist. Deletions of
+// DataMirror run last, in reverse order. Relations to collections that are
+// not selected must already resolve on the target.
+func SyncData(ctx context.Context, base, target *DirectusClient, opts DataSyncOptions) (*DataResult, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultDataBatchSize
+	}
+	baseSnapshot, err := base.GetSnapshot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get base snapshot: %w", err)
+	}
+	targetSnapshot, err := target.GetSnapshot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get target snapshot: %w", err)
+	}
+	plans, err := planData(baseSnapshot, opts.Collections)
+	if err != nil {
+		return nil, err
+	}
+
+	targetFields := map[string][]string{}
+	for _, field := range targetSnapshot.Fields {
+		targetFields[field.Collection] = append(targetFields[field.Collection], field.Field)
+	}
+	pending := map[string]bool{}
+	if opts.PendingDiff != nil {
+		for _, item := range opts.PendingDiff.Diff.Collections {
+			if ClassifyEntries(item.Diff) == ChangeCreated {
+				pending[item.Collection] = true
+			}
+		}
+	}
+
+	result := &DataResult{DryRun: opts.DryRun}
+	for i := range plans {
+		plan := &plans[i]
+		if slices.Contains(opts.Skip, plan.collection) {
+			plan.skipped = true
+			result.Skipped = append(result.Skipped, plan.collection)
+			continue
+		}
+		baseItems, err := base.ListItems(ctx, plan.collection, plan.fields, plan.primaryKey, batchSize)
+		if err != nil {
+			return result, fmt.Errorf("failed to list base items of %s: %w", plan.collection, err)
+		}
+		var targetItems []Item
+		switch present := targetFields[plan.collection]; {
+		case len(present) > 0:
+			// In a dry run fields may still be missing on the target; they
+			// are compared as unset.
+			fields := slices.DeleteFunc(slices.Clone(plan.fields), func(field string) bool { return !slices.Contains(present, field) })
+			if targetItems, err = target.ListItems(ctx, plan.collection, fields, plan.primaryKey, batchSize); err != nil {
+				return result, fmt.Errorf("failed to list target items of %s: %w", plan.collection, err)
+			}
+		case !opts.DryRun || !pending[plan.collection]:
+			return result, fmt.Errorf("collection %s does not exist on the target", plan.collection)
+		}
+		plan.compare(baseItems, targetItems)
+		result.Collections = append(result.Collections, DataCollectionResult{
+			Collection: plan.collection,
+			Strategy:   plan.strategy,
+			BaseRows:   len(baseItems),
+			TargetRows: len(targetItems),
+			Rows:       ChangeCounts{Created: len(plan.creates), Updated: plan.updated, Deleted: len(plan.deletes)},
+		})
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	total, done := 0, 0
+	for _, plan := range plans {
+		total += len(plan.creates) + len(plan.updates) + len(plan.deferredUpdates) + len(plan.deletes)
+	}
+	progress := func(n int) {
+		done += n
+		if opts.OnProgress != nil {
+			opts.OnProgress(done, total)
+		}
+	}
+	// A collection is done after the last pass with items of it to write.
+	collectionDone := func(plan dataPlan) {
+		if !plan.skipped && opts.OnCollectionDone != nil {
+			opts.OnCollectionDone(plan.collection)
+		}
+	}
+	for _, plan := range plans {
+		for batch := range slices.Chunk(plan.creates, batchSize) {
+			if err := target.CreateItems(ctx, plan.collection, batch); err != nil {
+				return result, fmt.Errorf("failed to create %d items of %s: %w", len(batch), plan.collection, err)
+			}
+			progress(len(batch))
+		}
+		for batch := range slices.Chunk(plan.updates, batchSize) {
+			if err := target.UpdateItems(ctx, plan.collection, batch); err != nil {
+				return result, fmt.Errorf("failed to update %d items of %s: %w", len(batch), plan.collection, err)
+			}
+			progress(len(batch))
+		}
+		if len(plan.deferredUpdates) == 0 && len(plan.deletes) == 0 {
+			collectionDone(plan)
+		}
+	}
+	for _, plan := range plans {
+		for batch := range slices.Chunk(plan.deferredUpdates, batchSize) {
+			if err := target.UpdateItems(ctx, plan.collection, batch); err != nil {
+				return result, fmt.Errorf("failed to link %d items of %s: %w", len(batch), plan.collection, err)
+			}
+			progress(len(batch))
+		}
+		if len(plan.deferredUpdates) > 0 && len(plan.deletes) == 0 {
+			collectionDone(plan)
+		}
+	}
+	for _, plan := range slices.Backward(plans) {
+		for batch := range slices.Chunk(plan.deletes, batchSize) {
+			if err := target.DeleteItems(ctx, plan.collection, batch); err != nil {
+				return result, fmt.Errorf("failed to delete %d items of %s: %w", len(batch), plan.collection, err)
+			}
+			progress(len(batch))
+		}
+		if len(plan.deletes) > 0 {
+			collectionDone(plan)
+		}
+	}
+	return result, nil
+}
+
+// dataPlan holds what SyncData writes to one collection.
+type dataPlan struct {
+	collection string
+	strategy   DataStrategy
+	primaryKey string
+	// fields starts with the primary key. deferred are the relational
+	// fields written in the second pass.
+	fields   []string
+	deferred []string
+
+	creates         []Item
+	updates         []Item
+	deferredUpdates []Item
+	deletes         []json.RawMessage
+	// updated counts the items updated in either pass.
+	updated int
+	// skipped is set for the collections of DataSyncOptions.Skip.
+	skipped bool
+}
+
+// planData validates the selected collections against the base snapshot and
+// orders them so that collections come after those they reference.
+func planData(snapshot *Snapshot, selected []DataCollection) ([]dataPlan, error) {
+	columns := map[string][]string{}
+	primaryKeys := map[string]string{}
+	for _, field := range snapshot.Fields {
+		if field.Schema == nil {
+			continue
+		}
+		columns[field.Collection] = append(columns[field.Collection], field.Field)
+		if isPrimaryKey, _ := field.Schema["is_primary_key"].(bool); isPrimaryKey {
+			primaryKeys[field.Collection] = field.Field
+		}
+	}
+
+	var plans []dataPlan
+	for _, collection := range selected {
+		name := collection.Collection
+		strategy := collection.Strategy
+		switch strategy {
+		case "":
+			strategy = DataUpsert
+		case DataUpsert, DataInsertOnly, DataMirror:
+		default:
+			return nil, fmt.Errorf("invalid data strategy %q for %s, expected upsert, insert-only or mirror", strategy, name)
+		}
+		if slices.ContainsFunc(plans, func(plan dataPlan) bool { return plan.collection == name }) {
+			return nil, fmt.Errorf("collection %s is selected more than once for data sync", name)
+		}
+		primaryKey, ok := primaryKeys[name]
+		if !ok {
+			return nil, fmt.Errorf("collection %s is not a table of the base schema", name)
+		}
+		fields := []string{primaryKey}
+		wanted := collection.Fields
+		if len(wanted) == 0 {
+			wanted = columns[name]
+		}
+		for _, field := range wanted {
+			if !slices.Contains(columns[name], field) {
+				return nil, fmt.Errorf("field %s.%s is not a column of the base schema", name, field)
+			}
+			if !slices.Contains(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+		plans = append(plans, dataPlan{collection: name, strategy: strategy, primaryKey: primaryKey, fields: fields})
+	}
+
+	// references maps collection and field to the selected collection the
+	// field references.
+	references := map[string]map[string]string{}
+	for _, relation := range snapshot.Relations {
+		if relation.RelatedCollection == "" {
+			continue
+		}
+		for _, plan := range plans {
+			if plan.collection == relation.Collection && slices.Contains(plan.fields, relation.Field) &&
+				slices.ContainsFunc(plans, func(p dataPlan) bool { return p.collection == relation.RelatedCollection }) {
+				if references[plan.collection] == nil {
+					references[plan.collection] = map[string]string{}
+				}
+				references[plan.collection][relation.Field] = relation.RelatedCollection
+			}
+		}
+	}
+
+	// Place each collection once all collections it references are placed,
+	// keeping the configured order otherwise. A cycle is broken by placing
+	// the first remaining collection.
+	ordered := make([]dataPlan, 0, len(plans))
+	placed := map[string]bool{}
+	for len(plans) > 0 {
+		next := slices.IndexFunc(plans, func(plan dataPlan) bool {
+			for _, related := range references[plan.collection] {
+				if related != plan.collection && !placed[related] {
+					return false
+				}
+			}
+			return true
+		})
+		next = max(next, 0)
+		plan := plans[next]
+		for _, field := range plan.fields {
+			if related, ok := references[plan.collection][field]; ok && !placed[related] {
+				plan.deferred = append(plan.deferred, field)
+			}
+		}
+		placed[plan.collection] = true
+		ordered = append(ordered, plan)
+		plans = slices.Delete(plans, next, next+1)
+	}
+	return ordered, nil
+}
+
+// compare fills the writes of p from the base and target items.
+func (p *dataPlan) compare(baseItems, targetItems []Item) {
+	existing := map[string]Item{}
+	for _, item := range targetItems {
+		existing[itemKey(item[p.primaryKey])] = item
+	}
+	for _, item := range baseItems {
+		key := itemKey(item[p.primaryKey])
+		current, ok := existing[key]
+		delete(existing, key)
+		if !ok {
+			p.creates = append(p.creates, withoutFields(item, p.deferred))
+			if linked := p.changed(item, nil, p.deferred); len(linked) > 1 {
+				p.deferredUpdates = append(p.deferredUpdates, linked)
+			}
+			continue
+		}
+		if p.strategy == DataInsertOnly {
+			continue
+		}
+		update := p.changed(item, current, p.fields)
+		for _, field := range p.deferred {
+			delete(update, field)
+		}
+		linked := p.changed(item, current, p.deferred)
+		if len(update) > 1 {
+			p.updates = append(p.updates, update)
+		}
+		if len(linked) > 1 {
+			p.deferredUpdates = append(p.deferredUpdates, linked)
+		}
+		if len(update) > 1 || len(linked) > 1 {
+			p.updated++
+		}
+	}
+	if p.strategy != DataMirror {
+		return
+	}
+	for _, item := range targetItems {
+		if _, stale := existing[itemKey(item[p.primaryKey])]; stale {
+			p.deletes = append(p.deletes, item[p.primaryKey])
+		}
+	}
+}
+
+// changed returns the primary key of want and those of fields whose value
+// differs from have.
+func (p *dataPlan) changed(want, have Item, fields []string) Item {
+	out := Item{p.primaryKey: want[p.primaryKey]}
+	for _, field := range fields {
+		if field != p.primaryKey && !sameJSON(want[field], have[field]) {
+			out[field] = want[field]
+		}
+	}
+	return out
+}
+
+// withoutFields returns a copy of item without fields.
+func withoutFields(item Item, fields []string) Item {
+	out := make(Item, len(item))
+	for field, value := range item {
+		if !slices.Contains(fields, field) {
+			out[field] = value
+		}
+	}
+	return out
+}
+
+// itemKey normalizes a primary key for use as a map key.
+func itemKey(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if json.Compact(&buf, raw) != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
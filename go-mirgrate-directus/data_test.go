@@ -0,0 +1,77 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// slowPagesServer serves total rows at path, built by row from their index,
+// in the pages asked for with limit and offset or page, each after delay.
+func slowPagesServer(t *testing.T, path string, total int, delay time.Duration, row func(i int) map[string]any) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			writeTestError(w, http.StatusNotFound, "ROUTE_NOT_FOUND", "Route "+r.URL.Path+" doesn't exist.")
+			return
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		query := r.URL.Query()
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		offset, _ := strconv.Atoi(query.Get("offset"))
+		if page, err := strconv.Atoi(query.Get("page")); err == nil {
+			offset = (page - 1) * limit
+		}
+		rows := []map[string]any{}
+		for i := offset; i < min(offset+limit, total); i++ {
+			rows = append(rows, row(i))
+		}
+		writeTestData(w, rows)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func country(i int) map[string]any {
+	return map[string]any{"id": i, "code": fmt.Sprintf("c%d", i)}
+}
+
+func TestListItemsPageTimeout(t *testing.T) {
+	ctx := context.Background()
+	timeouts := gomigratedirectus.Timeouts{Metadata: 100 * time.Millisecond}
+
+	// Six pages take longer than the timeout together, but each is fast.
+	server := slowPagesServer(t, "/items/countries", 55, 40*time.Millisecond, country)
+	client := gomigratedirectus.NewDirectusClient(server.URL, "token", quiet(gomigratedirectus.WithTimeouts(timeouts))...)
+	start := time.Now()
+	items, err := client.ListItems(ctx, "countries", []string{"id", "code"}, "id", 10)
+	if err != nil {
+		t.Fatalf("ListItems: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < timeouts.Metadata {
+		t.Fatalf("ListItems took %s, want the pages to outlast the timeout", elapsed)
+	}
+	if len(items) != 55 || string(items[54]["code"]) != `"c54"` {
+		t.Errorf("ListItems returned %d items, want 55", len(items))
+	}
+
+	// A single page slower than the timeout still fails.
+	server = slowPagesServer(t, "/items/countries", 55, 300*time.Millisecond, country)
+	client = gomigratedirectus.NewDirectusClient(server.URL, "token", quiet(gomigratedirectus.WithTimeouts(timeouts))...)
+	_, err = client.ListItems(ctx, "countries", []string{"id", "code"}, "id", 10)
+	var timeoutErr *gomigratedirectus.OperationTimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Operation != "list items" {
+		t.Errorf("ListItems with a slow page = %v, want an OperationTimeoutError", err)
+	}
+}
@@ -0,0 +1,149 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DebugBodyLimit is the number of bytes of a request or response body shown
+// in a debug dump. Longer bodies are truncated with a note.
+const DebugBodyLimit = 8 << 10
+
+// WithDebug writes a dump of every request and its response to w: method,
+// redacted URL, headers, status and bodies, in the format of
+// httputil.DumpRequestOut. Credentials are redacted, bodies longer than
+// DebugBodyLimit are truncated and binary bodies such as file contents are
+// skipped. It is meant for troubleshooting rejected requests and is off by
+// default.
+func WithDebug(w io.Writer) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.debug = w
+	}
+}
+
+// sensitiveFields matches the JSON properties of request and response bodies
+// that hold credentials, such as the tokens returned by /auth/login.
+var sensitiveFields = regexp.MustCompile(`("(?:access_token|refresh_token|password|token|secret)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// dumpExchange writes the dump of req, sent with body, and of its response
+// resp or err to c.Debug. The response body is peeked at and restored, so
+// that it can still be read in full. secrets are redacted from the dump.
+func (c *DirectusClient) dumpExchange(op string, req *http.Request, body []byte, resp *http.Response, err error, duration time.Duration, secrets []string) {
+	if c.Debug == nil {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s request\n", op)
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\n", req.Method, RedactURL(req.URL.String()))
+	writeDumpHeaders(&b, req.Header)
+	size := req.ContentLength
+	if body != nil {
+		size = int64(len(body))
+	}
+	writeDumpBody(&b, req.Header.Get("Content-Type"), body, size)
+
+	if err != nil {
+		fmt.Fprintf(&b, "--- %s failed after %s: %v\n\n", op, duration.Round(time.Millisecond), err)
+	} else {
+		fmt.Fprintf(&b, "--- %s response in %s\n", op, duration.Round(time.Millisecond))
+		fmt.Fprintf(&b, "%s %s\n", resp.Proto, resp.Status)
+		writeDumpHeaders(&b, resp.Header)
+		contentType := resp.Header.Get("Content-Type")
+		if isBinaryContent(contentType) {
+			writeDumpBody(&b, contentType, nil, resp.ContentLength)
+		} else {
+			peeked, readErr := io.ReadAll(io.LimitReader(resp.Body, DebugBodyLimit+1))
+			resp.Body = &peekedBody{Reader: io.MultiReader(bytes.NewReader(peeked), resp.Body), body: resp.Body}
+			if readErr != nil {
+				fmt.Fprintf(&b, "[failed to read body: %v]\n\n", readErr)
+			} else {
+				writeDumpBody(&b, contentType, peeked, resp.ContentLength)
+			}
+		}
+	}
+	io.WriteString(c.Debug, redactSecrets(b.String(), secrets))
+}
+
+// writeDumpHeaders writes header, with credentials redacted, sorted by name.
+func writeDumpHeaders(b *strings.Builder, header http.Header) {
+	header = RedactHeader(header)
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			fmt.Fprintf(b, "%s: %s\n", name, value)
+		}
+	}
+	b.WriteString("\n")
+}
+
+// writeDumpBody writes body, of size bytes if known, truncated to
+// DebugBodyLimit with credentials in JSON properties redacted. Binary bodies
+// are replaced by a note.
+func writeDumpBody(b *strings.Builder, contentType string, body []byte, size int64) {
+	switch {
+	case isBinaryContent(contentType):
+		if size > 0 {
+			fmt.Fprintf(b, "[%d bytes of %s skipped]\n\n", size, contentType)
+		} else {
+			fmt.Fprintf(b, "[body of %s skipped]\n\n", contentType)
+		}
+		return
+	case len(body) == 0:
+		return
+	}
+	truncated := len(body) > DebugBodyLimit
+	if truncated {
+		body = body[:DebugBodyLimit]
+	}
+	b.WriteString(sensitiveFields.ReplaceAllString(string(body), `$1"`+redacted+`"`))
+	b.WriteString("\n")
+	if truncated {
+		if size > 0 {
+			fmt.Fprintf(b, "[truncated, %d of %d bytes shown]\n", DebugBodyLimit, size)
+		} else {
+			fmt.Fprintf(b, "[truncated, first %d bytes shown]\n", DebugBodyLimit)
+		}
+	}
+	b.WriteString("\n")
+}
+
+// isBinaryContent reports whether a body of contentType is not text and is
+// left out of dumps. Bodies without a content type are shown.
+func isBinaryContent(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json",
+		strings.HasSuffix(mediaType, "+json"),
+		mediaType == "application/x-www-form-urlencoded",
+		mediaType == "application/xml",
+		mediaType == "application/yaml":
+		return false
+	}
+	return true
+}
+
+// peekedBody is a response body whose first bytes were read for a dump.
+type peekedBody struct {
+	io.Reader
+	body io.ReadCloser
+}
+
+func (b *peekedBody) Close() error { return b.body.Close() }
@@ -0,0 +1,116 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// debugServer is an instance that logs in with the password "hunter2",
+// returning the given access and refresh tokens, and answers
+// /schema/snapshot with an empty snapshot, or with an error echoing the
+// request URL when the token is missing or sent in the query.
+func debugServer(t *testing.T, accessToken, refreshToken string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		switch r.URL.Path {
+		case "/auth/login":
+			var body map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["password"] != "hunter2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"errors":[{"message":"Invalid user credentials.","extensions":{"code":"INVALID_CREDENTIALS"}}]}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+				"access_token": accessToken, "refresh_token": refreshToken, "expires": 900000,
+			}})
+		case "/schema/snapshot":
+			if r.Header.Get("Authorization") != "Bearer "+accessToken {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]any{"errors": []any{map[string]any{
+					"message": "Invalid request " + r.URL.String(), "extensions": map[string]any{"code": "INVALID_QUERY"},
+				}}})
+				return
+			}
+			w.Write([]byte(`{"data":{"version":1,"directus":"10.13.1","collections":[],"fields":[],"relations":[]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// assertRedacted fails if dump is empty or holds any of secrets.
+func assertRedacted(t *testing.T, dump string, secrets ...string) {
+	t.Helper()
+	if dump == "" {
+		t.Fatal("nothing was dumped")
+	}
+	for _, secret := range secrets {
+		if strings.Contains(dump, secret) {
+			t.Errorf("dump holds the secret %q:\n%s", secret, dump)
+		}
+	}
+}
+
+func TestDebugRedactsAuthorizationHeader(t *testing.T) {
+	const token = "static-token-1234"
+	server := debugServer(t, token, "")
+	var dump strings.Builder
+	client := gomigratedirectus.NewDirectusClient(server.URL, token, append(quiet(), gomigratedirectus.WithDebug(&dump))...)
+	if _, err := client.GetSnapshot(context.Background()); err != nil {
+		t.Fatalf("GetSnapshot: %v", err)
+	}
+	assertRedacted(t, dump.String(), token)
+	if !strings.Contains(dump.String(), "Authorization: ***\n") {
+		t.Errorf("dump does not show the redacted Authorization header:\n%s", dump.String())
+	}
+}
+
+func TestDebugRedactsQueryToken(t *testing.T) {
+	const token = "query-token-5678"
+	server := debugServer(t, token, "")
+	var dump strings.Builder
+	client := gomigratedirectus.NewDirectusClient(server.URL, token, append(quiet(), gomigratedirectus.WithDebug(&dump))...)
+	client.TokenInQuery = true
+	// The server rejects tokens in the query, echoing the URL in its error.
+	if _, err := client.GetSnapshot(context.Background()); err == nil {
+		t.Fatal("GetSnapshot succeeded")
+	}
+	assertRedacted(t, dump.String(), token)
+	if !strings.Contains(dump.String(), "/schema/snapshot?access_token=%2A%2A%2A") {
+		t.Errorf("dump does not show the redacted access_token parameter:\n%s", dump.String())
+	}
+}
+
+func TestDebugRedactsLogin(t *testing.T) {
+	const accessToken, refreshToken = "login-access-token", "login-refresh-token"
+	server := debugServer(t, accessToken, refreshToken)
+	var dump strings.Builder
+	client := gomigratedirectus.NewDirectusClientWithCredentials(server.URL, "admin@example.com", "hunter2",
+		append(quiet(), gomigratedirectus.WithDebug(&dump))...)
+	// The login response is peeked at for the dump and must still decode.
+	if _, err := client.GetSnapshot(context.Background()); err != nil {
+		t.Fatalf("GetSnapshot: %v", err)
+	}
+	got := dump.String()
+	assertRedacted(t, got, "hunter2", accessToken, refreshToken)
+	for _, want := range []string{
+		"--- login request\nPOST " + server.URL + "/auth/login",
+		`"password":"***"`,
+		`"access_token":"***"`,
+		`"refresh_token":"***"`,
+		"Authorization: ***\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("dump does not contain %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package gomirgratedirectus
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Kinds of DestructiveChange.
+const (
+	DestructiveCollectionDeleted = "collection_deleted"
+	DestructiveFieldDeleted      = "field_deleted"
+	DestructiveTypeChanged       = "type_changed"
+	DestructiveLengthReduced     = "length_reduced"
+)
+
+// DestructiveChange is a change in a diff that can lose data.
+type DestructiveChange struct {
+	Kind       string `json:"kind"`
+	Collection string `json:"collection"`
+	Field      string `json:"field,omitempty"`
+	// Detail describes type and length changes, such as "text → string".
+	Detail string `json:"detail,omitempty"`
+}
+
+// IsDeletion reports whether the change deletes a collection or field.
+func (c DestructiveChange) IsDeletion() bool {
+	return c.Kind == DestructiveCollectionDeleted || c.Kind == DestructiveFieldDeleted
+}
+
+func (c DestructiveChange) String() string {
+	switch c.Kind {
+	case DestructiveCollectionDeleted:
+		return fmt.Sprintf("collection %s would be DELETED", c.Collection)
+	case DestructiveFieldDeleted:
+		return fmt.Sprintf("field %s.%s would be DELETED", c.Collection, c.Field)
+	case DestructiveTypeChanged:
+		return fmt.Sprintf("field %s.%s changes type %s", c.Collection, c.Field, c.Detail)
+	case DestructiveLengthReduced:
+		return fmt.Sprintf("field %s.%s shrinks max length %s", c.Collection, c.Field, c.Detail)
+	default:
+		return fmt.Sprintf("%s on %s.%s", c.Kind, c.Collection, c.Field)
+	}
+}
+
+// losslessTypeChanges lists the Directus field type changes that keep all
+// values.
+var losslessTypeChanges = map[[2]string]bool{
+	{"string", "text"}:        true,
+	{"integer", "bigInteger"}: true,
+	{"integer", "float"}:      true,
+	{"integer", "decimal"}:    true,
+	{"uuid", "string"}:        true,
+	{"uuid", "text"}:          true,
+}
+
+// FindDestructiveChanges returns the changes in diff that can lose data:
+// deleted collections and fields, field type changes other than known
+// widenings such as string to text, and reduced maximum lengths. Relation
+// deletions only drop constraints and are not included.
+func FindDestructiveChanges(diff *Diff) []DestructiveChange {
+	if diff == nil {
+		return nil
+	}
+
+	var changes []DestructiveChange
+	for _, item := range diff.Diff.Collections {
+		if ClassifyEntries(item.Diff) == ChangeDeleted {
+			changes = append(changes, DestructiveChange{Kind: DestructiveCollectionDeleted, Collection: item.Collection})
+		}
+	}
+	for _, item := range diff.Diff.Fields {
+		if ClassifyEntries(item.Diff) == ChangeDeleted {
+			changes = append(changes, DestructiveChange{Kind: DestructiveFieldDeleted, Collection: item.Collection, Field: item.Field})
+			continue
+		}
+		for _, entry := range item.Diff {
+			if entry.Kind != KindEdited {
+				continue
+			}
+			change := DestructiveChange{Collection: item.Collection, Field: item.Field}
+			switch formatPath(entry.Path) {
+			case "type":
+				var from, to string
+				if json.Unmarshal(entry.Lhs, &from) != nil || json.Unmarshal(entry.Rhs, &to) != nil || losslessTypeChanges[[2]string{from, to}] {
+					continue
+				}
+				change.Kind, change.Detail = DestructiveTypeChanged, from+" → "+to
+			case "schema.max_length":
+				var from, to *float64
+				if json.Unmarshal(entry.Lhs, &from) != nil || json.Unmarshal(entry.Rhs, &to) != nil || to == nil || (from != nil && *to >= *from) {
+					continue
+				}
+				change.Kind, change.Detail = DestructiveLengthReduced, formatValue(entry.Lhs)+" → "+formatValue(entry.Rhs)
+			default:
+				continue
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// DestructiveChangeError is returned by CheckDestructive when a diff may not
+// be applied. It lists exactly the offending changes.
+type DestructiveChangeError struct {
+	Changes []DestructiveChange
+	// MaxDeletions is set when the deletion threshold was exceeded.
+	MaxDeletions int
+}
+
+func (e *DestructiveChangeError) Error() string {
+	var b strings.Builder
+	if e.MaxDeletions > 0 {
+		fmt.Fprintf(&b, "diff deletes more than %d collections and fields:", e.MaxDeletions)
+	} else {
+		b.WriteString("diff contains destructive changes, allow them explicitly to apply it:")
+	}
+	for _, change := range e.Changes {
+		b.WriteString("\n  ")
+		b.WriteString(change.String())
+	}
+	return b.String()
+}
+
+// CheckDestructive enforces the destructive change policy on diff. Unless
+// allowDestructive is set, any destructive change fails the check. Even when
+// it is set, more than maxDeletions deleted collections and fields fail it;
+// maxDeletions <= 0 means no limit.
+func CheckDestructive(diff *Diff, allowDestructive bool, maxDeletions int) error {
+	changes := FindDestructiveChanges(diff)
+
+	var deletions []DestructiveChange
+	for _, change := range changes {
+		if change.IsDeletion() {
+			deletions = append(deletions, change)
+		}
+	}
+	if maxDeletions > 0 && len(deletions) > maxDeletions {
+		return &DestructiveChangeError{Changes: deletions, MaxDeletions: maxDeletions}
+	}
+	if !allowDestructive && len(changes) > 0 {
+		return &DestructiveChangeError{Changes: changes}
+	}
+	return nil
+}
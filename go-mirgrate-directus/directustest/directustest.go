@@ -0,0 +1,423 @@
+// Package directustest provides a fake Directus instance for testing code that
+// embeds gomirgratedirectus without a real Directus.
+//
+// A Server serves /schema/snapshot, /schema/diff, /schema/apply, /server/info
+// and /server/health from fixtures set on it, records the bodies it receives
+// for assertions, and can inject failures on the Nth request:
+//
+//	base, target := directustest.NewServer(t), directustest.NewServer(t)
+//	target.SetDiff(diff)
+//	target.Fail("/schema/apply", 1, directustest.Failure{Status: http.StatusServiceUnavailable})
+//	err := gomigratedirectus.MigrateClients(ctx, base.Client(), target.Client(), false)
+package directustest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// Token is the access token a Server accepts unless changed with SetToken.
+const Token = "directustest-token"
+
+// Failure describes how a Server fails a request instead of answering it.
+type Failure struct {
+	// Delay is waited before answering, or before failing with Status or
+	// Malformed. A delay alone still answers normally, for timeouts.
+	Delay time.Duration
+	// Status is the status code answered, with a Directus error body of
+	// Message. Zero answers normally.
+	Status int
+	// Message is the error message of a Status failure. It defaults to the
+	// status text.
+	Message string
+	// Malformed answers 200 with a body that is not valid JSON.
+	Malformed bool
+}
+
+// Request is a request received by a Server.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	// Body is the request body, decompressed if it was sent gzipped.
+	Body []byte
+}
+
+// Server is a fake Directus instance. Its fixtures may be changed while it
+// runs; all methods are safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	token    string
+	snapshot *gomigratedirectus.Snapshot
+	diff     *gomigratedirectus.Diff
+	residual *gomigratedirectus.Diff
+	info     gomigratedirectus.ServerInfo
+	health   string
+	keepDiff bool
+	etags    bool
+	requests []Request
+	// counts holds the number of requests received by path, "" for all.
+	counts   map[string]int
+	failures map[failureKey]Failure
+}
+
+// failureKey identifies the Nth request to a path, or to any path if empty.
+type failureKey struct {
+	path string
+	n    int
+}
+
+// NewServer starts a Server, closed when the test ends. It serves an empty
+// snapshot, no diff, version 10.12.1 on postgres, and a healthy status, and
+// requires Token.
+func NewServer(tb testing.TB) *Server {
+	tb.Helper()
+	s := &Server{
+		token: Token,
+		snapshot: &gomigratedirectus.Snapshot{
+			Version:     1,
+			Directus:    "10.12.1",
+			Vendor:      "postgres",
+			Collections: []gomigratedirectus.Collection{},
+			Fields:      []gomigratedirectus.Field{},
+			Relations:   []gomigratedirectus.Relation{},
+		},
+		info:     gomigratedirectus.ServerInfo{Version: "10.12.1", Vendor: "postgres"},
+		health:   "ok",
+		counts:   map[string]int{},
+		failures: map[failureKey]Failure{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Client returns a client for the server, authenticated with its token.
+func (s *Server) Client(opts ...gomigratedirectus.ClientOption) *gomigratedirectus.DirectusClient {
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+	return gomigratedirectus.NewDirectusClient(s.URL, token, opts...)
+}
+
+// SetToken sets the access token the server requires. An empty token accepts
+// any request.
+func (s *Server) SetToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+// SetSnapshot sets the snapshot served by /schema/snapshot.
+func (s *Server) SetSnapshot(snapshot *gomigratedirectus.Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = snapshot
+}
+
+// SetDiff sets the diff served by /schema/diff. A nil diff answers 204, as
+// Directus does when the instance matches the snapshot. Once the diff is
+// applied the server answers 204, unless KeepDiff or SetResidualDiff is set.
+func (s *Server) SetDiff(diff *gomigratedirectus.Diff) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.diff = diff
+}
+
+// KeepDiff makes the server keep serving its diff after it is applied, like
+// an instance that drifts back between runs.
+func (s *Server) KeepDiff(keep bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keepDiff = keep
+}
+
+// SetResidualDiff sets the diff served by /schema/diff once the diff is
+// applied, like an instance that stores some changes differently than they
+// were sent, for the verification after apply. It is served until it is
+// applied in turn; nil restores the default.
+func (s *Server) SetResidualDiff(diff *gomigratedirectus.Diff) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.residual = diff
+}
+
+// ConditionalRequests makes /schema/snapshot send an ETag and answer 304 to a
+// request whose If-None-Match matches it.
+func (s *Server) ConditionalRequests(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.etags = enabled
+}
+
+// SetServerInfo sets the version and database vendor served by /server/info.
+func (s *Server) SetServerInfo(info gomigratedirectus.ServerInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.info = info
+}
+
+// SetHealth sets the status served by /server/health: "ok", "warn" or
+// "error". Statuses other than "ok" answer 503.
+func (s *Server) SetHealth(status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.health = status
+}
+
+// Fail makes the nth request to path, counted from 1, fail as f. An empty path
+// counts the requests to all paths. Requests already received are counted.
+func (s *Server) Fail(path string, n int, f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[failureKey{path: path, n: n}] = f
+}
+
+// Requests returns the requests received so far, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// DiffRequests returns the snapshots received by /schema/diff, in order.
+func (s *Server) DiffRequests() []*gomigratedirectus.Snapshot {
+	var snapshots []*gomigratedirectus.Snapshot
+	for _, req := range s.received("/schema/diff") {
+		var snapshot gomigratedirectus.Snapshot
+		if json.Unmarshal(req.Body, &snapshot) == nil {
+			snapshots = append(snapshots, &snapshot)
+		}
+	}
+	return snapshots
+}
+
+// ApplyRequests returns the diffs received by /schema/apply, in order,
+// including those of failed requests.
+func (s *Server) ApplyRequests() []*gomigratedirectus.Diff {
+	var diffs []*gomigratedirectus.Diff
+	for _, req := range s.received("/schema/apply") {
+		var diff gomigratedirectus.Diff
+		if json.Unmarshal(req.Body, &diff) == nil {
+			diffs = append(diffs, &diff)
+		}
+	}
+	return diffs
+}
+
+// received returns the POST requests received by path.
+func (s *Server) received(path string) []Request {
+	var reqs []Request
+	for _, req := range s.Requests() {
+		if req.Method == http.MethodPost && req.Path == path {
+			reqs = append(reqs, req)
+		}
+	}
+	return reqs
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_PAYLOAD", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Header: r.Header.Clone(), Body: body})
+	s.counts[""]++
+	s.counts[r.URL.Path]++
+	failure, failing := s.failures[failureKey{path: r.URL.Path, n: s.counts[r.URL.Path]}]
+	if !failing {
+		failure, failing = s.failures[failureKey{n: s.counts[""]}]
+	}
+	token := s.token
+	s.mu.Unlock()
+
+	if failing {
+		if failure.Delay > 0 {
+			select {
+			case <-time.After(failure.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		switch {
+		case failure.Status != 0:
+			message := failure.Message
+			if message == "" {
+				message = http.StatusText(failure.Status)
+			}
+			writeError(w, failure.Status, errorCode(failure.Status), message)
+			return
+		case failure.Malformed:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			io.WriteString(w, `{"data": {`)
+			return
+		}
+	}
+
+	if token != "" && !authorized(r, token) {
+		writeError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid user credentials.")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/schema/snapshot":
+		s.mu.Lock()
+		snapshot, etags := s.snapshot, s.etags
+		s.mu.Unlock()
+		if !etags {
+			writeData(w, http.StatusOK, snapshot)
+			return
+		}
+		body, err := json.Marshal(map[string]any{"data": snapshot})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", err.Error())
+			return
+		}
+		sum := sha256.Sum256(body)
+		etag := `W/"` + hex.EncodeToString(sum[:8]) + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(body)
+	case r.Method == http.MethodPost && r.URL.Path == "/schema/diff":
+		var snapshot gomigratedirectus.Snapshot
+		if err := json.Unmarshal(body, &snapshot); err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("Invalid snapshot: %v", err))
+			return
+		}
+		s.mu.Lock()
+		diff := s.diff
+		s.mu.Unlock()
+		if diff == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeData(w, http.StatusOK, diff)
+	case r.Method == http.MethodPost && r.URL.Path == "/schema/apply":
+		var diff gomigratedirectus.Diff
+		if err := json.Unmarshal(body, &diff); err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_PAYLOAD", fmt.Sprintf("Invalid diff: %v", err))
+			return
+		}
+		s.mu.Lock()
+		current := s.diff
+		if current != nil && !s.keepDiff {
+			s.diff, s.residual = s.residual, nil
+		}
+		s.mu.Unlock()
+		if current != nil && diff.Hash != "" && current.Hash != "" && diff.Hash != current.Hash {
+			writeError(w, http.StatusBadRequest, "INVALID_PAYLOAD", "Provided hash does not match the current instance's schema hash, indicating the schema has changed after this diff was generated. Please generate a new diff and try again.")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && r.URL.Path == "/server/info":
+		s.mu.Lock()
+		info := s.info
+		s.mu.Unlock()
+		data := map[string]any{"project": map[string]any{"project_name": "Directus"}}
+		if info.Version != "" {
+			data["version"] = info.Version
+		}
+		if info.Vendor != "" {
+			data["database"] = map[string]any{"vendor": info.Vendor}
+		}
+		writeData(w, http.StatusOK, data)
+	case r.Method == http.MethodGet && r.URL.Path == "/server/health":
+		s.mu.Lock()
+		status := s.health
+		s.mu.Unlock()
+		code := http.StatusOK
+		if status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/health+json; charset=utf-8")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"status": status})
+	default:
+		writeError(w, http.StatusNotFound, "ROUTE_NOT_FOUND", fmt.Sprintf("Route %s doesn't exist.", r.URL.Path))
+	}
+}
+
+// readBody reads the body of r, decompressing it if it is gzipped.
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	if !strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		return body, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress request body: %w", err)
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// authorized reports whether r carries token, as a bearer token or in the
+// access_token query parameter.
+func authorized(r *http.Request, token string) bool {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return bearer == token
+	}
+	return r.URL.Query().Get("access_token") == token
+}
+
+// writeData answers v in the data envelope of Directus responses.
+func writeData(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"data": v})
+}
+
+// writeError answers a Directus error body.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"errors": []any{map[string]any{"message": message, "extensions": map[string]string{"code": code}}},
+	})
+}
+
+// errorCode returns the Directus error code answered with status.
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "INVALID_PAYLOAD"
+	case http.StatusUnauthorized:
+		return "INVALID_CREDENTIALS"
+	case http.StatusForbidden:
+		return "FORBIDDEN"
+	case http.StatusNotFound:
+		return "ROUTE_NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "REQUESTS_EXCEEDED"
+	case http.StatusServiceUnavailable:
+		return "SERVICE_UNAVAILABLE"
+	}
+	return "INTERNAL_SERVER_ERROR"
+}
@@ -0,0 +1,99 @@
+package directustest
+
+import (
+	"cmp"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// fixtures holds, per Directus minor version, the bodies answered by
+// /schema/snapshot and /schema/diff for a small articles and authors schema,
+// in the shape that version returns.
+//
+//go:embed fixtures
+var fixtures embed.FS
+
+// Fixture is a snapshot of an instance and the diff of another schema against
+// it, as answered by a given Directus version.
+type Fixture struct {
+	// Version is the Directus minor version, such as "10.13".
+	Version  string
+	Snapshot *gomigratedirectus.Snapshot
+	Diff     *gomigratedirectus.Diff
+	// SnapshotBody and DiffBody are the raw response bodies, for tests of
+	// decoding.
+	SnapshotBody []byte
+	DiffBody     []byte
+}
+
+// FixtureVersions returns the Directus versions fixtures are available for,
+// oldest first.
+func FixtureVersions() []string {
+	entries, _ := fs.ReadDir(fixtures, "fixtures")
+	var versions []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			versions = append(versions, entry.Name())
+		}
+	}
+	slices.SortFunc(versions, compareVersions)
+	return versions
+}
+
+// compareVersions orders versions by their numeric components.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < min(len(as), len(bs)); i++ {
+		x, _ := strconv.Atoi(as[i])
+		y, _ := strconv.Atoi(bs[i])
+		if c := cmp.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(as), len(bs))
+}
+
+// LoadFixture returns the fixture of a Directus version listed by
+// FixtureVersions.
+func LoadFixture(version string) (*Fixture, error) {
+	f := &Fixture{Version: version}
+	var err error
+	if f.SnapshotBody, err = fixtures.ReadFile(path.Join("fixtures", version, "snapshot.json")); err != nil {
+		return nil, fmt.Errorf("no fixture for Directus %s: %w", version, err)
+	}
+	if f.DiffBody, err = fixtures.ReadFile(path.Join("fixtures", version, "diff.json")); err != nil {
+		return nil, fmt.Errorf("no fixture for Directus %s: %w", version, err)
+	}
+	var snapshot struct {
+		Data *gomigratedirectus.Snapshot `json:"data"`
+	}
+	if err := json.Unmarshal(f.SnapshotBody, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot fixture of Directus %s: %w", version, err)
+	}
+	var diff struct {
+		Data *gomigratedirectus.Diff `json:"data"`
+	}
+	if err := json.Unmarshal(f.DiffBody, &diff); err != nil {
+		return nil, fmt.Errorf("failed to decode diff fixture of Directus %s: %w", version, err)
+	}
+	f.Snapshot, f.Diff = snapshot.Data, diff.Data
+	return f, nil
+}
+
+// UseFixture makes the server answer as the Directus version of f: its
+// snapshot, its diff and its version.
+func (s *Server) UseFixture(f *Fixture) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot, s.diff = f.Snapshot, f.Diff
+	s.info.Version = f.Snapshot.Directus
+	s.info.Vendor = f.Snapshot.Vendor
+}
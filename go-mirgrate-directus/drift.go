@@ -0,0 +1,105 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// How an item of the target drifted from the expected snapshot, see
+// DriftedItem.
+const (
+	// DriftMissing is an item of the snapshot the target does not have.
+	DriftMissing = "missing"
+	// DriftUnexpected is an item of the target the snapshot does not have,
+	// such as a field added by hand.
+	DriftUnexpected = "unexpected"
+	// DriftChanged is an item whose definition differs.
+	DriftChanged = "changed"
+)
+
+// DriftedItem is a collection, field or relation of the target that differs
+// from the snapshot. Name is the collection, or collection.field for fields
+// and relations.
+type DriftedItem struct {
+	Name  string `json:"name"`
+	Drift string `json:"drift"`
+}
+
+// DriftResult is the result of CheckDrift.
+type DriftResult struct {
+	// InSync reports that the target matches the snapshot.
+	InSync bool `json:"in_sync"`
+	// Summary counts the changes that would bring the target back in line
+	// with the snapshot.
+	Summary DiffSummary `json:"summary"`
+	// Collections, Fields and Relations list the drifted items in diff
+	// order.
+	Collections []DriftedItem `json:"collections,omitempty"`
+	Fields      []DriftedItem `json:"fields,omitempty"`
+	Relations   []DriftedItem `json:"relations,omitempty"`
+	// Diff is the diff from the target to the snapshot, nil when in sync.
+	Diff *Diff `json:"-"`
+}
+
+// CheckDrift compares the live schema of target with snapshot, typically one
+// kept in version control, and reports what differs, for example to detect
+// changes made to production by hand. The snapshot and the diff are narrowed
+// by filter. Nothing is ever applied.
+func CheckDrift(ctx context.Context, snapshot *Snapshot, target *DirectusClient, filter SchemaFilter, force bool) (*DriftResult, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	excluded := map[string]bool{}
+	if !filter.IsZero() {
+		filtered := FilterSnapshot(snapshot, filter)
+		snapshot = filtered.Snapshot
+		for _, field := range filtered.ExcludedFields {
+			excluded[field] = true
+		}
+	}
+	diff, err := target.GetDiff(ctx, snapshot, force)
+	if err == nil && !filter.IsZero() {
+		filtered := FilterDiff(diff, filter)
+		diff = filtered.Diff
+		for _, field := range filtered.ExcludedFields {
+			excluded[field] = true
+		}
+		if diff.IsEmpty() {
+			err = ErrNoChanges
+		}
+	}
+	if errors.Is(err, ErrNoChanges) {
+		return &DriftResult{InSync: true, Summary: DiffSummary{FilteredFields: len(excluded)}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diff: %w", err)
+	}
+
+	result := &DriftResult{Summary: SummarizeDiff(diff), Diff: diff}
+	result.Summary.FilteredFields = len(excluded)
+	for _, item := range diff.Diff.Collections {
+		result.Collections = append(result.Collections, DriftedItem{Name: item.Collection, Drift: drift(item.Diff)})
+	}
+	for _, item := range diff.Diff.Fields {
+		result.Fields = append(result.Fields, DriftedItem{Name: item.Collection + "." + item.Field, Drift: drift(item.Diff)})
+	}
+	for _, item := range diff.Diff.Relations {
+		result.Relations = append(result.Relations, DriftedItem{Name: item.Collection + "." + item.Field, Drift: drift(item.Diff)})
+	}
+	return result, nil
+}
+
+// drift describes the entries of one diff item from the point of view of the
+// target: what the diff would create is missing, what it would delete is
+// unexpected.
+func drift(entries []DiffEntry) string {
+	switch ClassifyEntries(entries) {
+	case ChangeCreated:
+		return DriftMissing
+	case ChangeDeleted:
+		return DriftUnexpected
+	default:
+		return DriftChanged
+	}
+}
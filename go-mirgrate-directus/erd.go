@@ -0,0 +1,299 @@
+package gomirgratedirectus
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ERDFormat is a diagram language of GenerateERD.
+type ERDFormat string
+
+// Formats of GenerateERD.
+const (
+	ERDMermaid ERDFormat = "mermaid"
+	ERDDot     ERDFormat = "dot"
+)
+
+// ERDOptions configures GenerateERD.
+type ERDOptions struct {
+	// Format is the diagram language, ERDMermaid by default.
+	Format ERDFormat
+	// Filter limits the diagram to some collections. With
+	// SystemCollections set to SystemExclude, the relations to
+	// directus_* collections such as directus_users are left out too.
+	Filter SchemaFilter
+}
+
+// erdNonWord matches the characters Mermaid does not accept in names.
+var erdNonWord = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// erdEdge is a relation drawn between two entities: from the one side to the
+// many side holding the key, or between both sides of a many-to-many
+// relation.
+type erdEdge struct {
+	from, to       string
+	fromField      string
+	toField        string
+	label          string
+	nullable       bool
+	manyToMany     bool
+	manyToAnyField bool
+}
+
+// GenerateERD returns an entity-relationship diagram of snapshot in the
+// Mermaid erDiagram or Graphviz dot language. Each collection is an entity
+// listing its columns and their Directus types, keys marked. Many-to-one
+// relations, which are also the one-to-many fields of the other side, are
+// edges from the related collection to the collection holding the key.
+// Junction collections holding nothing but the keys of a many-to-many
+// relation and its sort field are drawn as a single many-to-many edge
+// between both sides. Collections and relations are sorted, so that the
+// diagram only changes with the schema.
+func GenerateERD(snapshot *Snapshot, opts ERDOptions) (string, error) {
+	if snapshot == nil {
+		return "", fmt.Errorf("cannot draw a nil snapshot")
+	}
+	switch opts.Format {
+	case "":
+		opts.Format = ERDMermaid
+	case ERDMermaid, ERDDot:
+	default:
+		return "", fmt.Errorf("unknown diagram format %q, expected mermaid or dot", opts.Format)
+	}
+	if err := opts.Filter.Validate(); err != nil {
+		return "", err
+	}
+	if !opts.Filter.IsZero() {
+		snapshot = FilterSnapshot(snapshot, opts.Filter).Snapshot
+	}
+	model := newSchemaModel(snapshot)
+	excludeSystem := opts.Filter.SystemCollections == SystemExclude
+
+	// Junctions are found by their relations pointing at one another.
+	byField := map[string]Relation{}
+	for _, relation := range model.relations {
+		byField[relation.Collection+"."+relation.Field] = relation
+	}
+	junctions := map[string]bool{}
+	var edges []erdEdge
+	for _, relation := range model.relations {
+		junctionField, _ := relation.Meta["junction_field"].(string)
+		partner, ok := byField[relation.Collection+"."+junctionField]
+		if !ok || relation.RelatedCollection == "" || partner.RelatedCollection == "" {
+			continue
+		}
+		if !model.isJunction(relation, partner) {
+			continue
+		}
+		junctions[relation.Collection] = true
+		if relation.Field > partner.Field {
+			continue
+		}
+		var labels []string
+		for _, r := range []Relation{relation, partner} {
+			if oneField, _ := r.Meta["one_field"].(string); oneField != "" {
+				labels = append(labels, r.RelatedCollection+"."+oneField)
+			}
+		}
+		label := strings.Join(labels, " / ")
+		if label == "" {
+			label = "via " + relation.Collection
+		}
+		edges = append(edges, erdEdge{from: relation.RelatedCollection, to: partner.RelatedCollection, label: label, manyToMany: true})
+	}
+
+	for _, relation := range model.relations {
+		if junctions[relation.Collection] {
+			continue
+		}
+		nullable := true
+		for _, field := range model.fields[relation.Collection] {
+			if field.Field == relation.Field && field.Schema != nil {
+				nullable, _ = field.Schema["is_nullable"].(bool)
+			}
+		}
+		label := relation.Field
+		if oneField, _ := relation.Meta["one_field"].(string); oneField != "" {
+			label += " / " + oneField
+		}
+		targets := []string{relation.RelatedCollection}
+		anyField := relation.RelatedCollection == ""
+		if anyField {
+			allowed, _ := relation.Meta["one_allowed_collections"].([]any)
+			targets = targets[:0]
+			for _, name := range allowed {
+				if name, ok := name.(string); ok {
+					targets = append(targets, name)
+				}
+			}
+			slices.Sort(targets)
+		}
+		for _, target := range targets {
+			toField := "id"
+			if key, ok := model.primaryKeys[target]; ok {
+				toField = key.Field
+			}
+			edges = append(edges, erdEdge{from: target, to: relation.Collection, fromField: toField, toField: relation.Field,
+				label: label, nullable: nullable, manyToAnyField: anyField})
+		}
+	}
+	edges = slices.DeleteFunc(edges, func(e erdEdge) bool {
+		return excludeSystem && (IsSystemCollection(e.from) || IsSystemCollection(e.to))
+	})
+
+	// Entities are the collections with a table, bar pure junctions, and
+	// the collections relations point at that the snapshot has no table
+	// for, such as directus_users.
+	var entities []string
+	for _, collection := range model.collections {
+		if !junctions[collection.Collection] {
+			entities = append(entities, collection.Collection)
+		}
+	}
+	for _, edge := range edges {
+		for _, name := range []string{edge.from, edge.to} {
+			if !slices.Contains(entities, name) {
+				entities = append(entities, name)
+			}
+		}
+	}
+	slices.Sort(entities)
+
+	columns := func(name string) []Field {
+		var fields []Field
+		for _, field := range model.fields[name] {
+			if hasColumn(field) {
+				fields = append(fields, field)
+			}
+		}
+		return fields
+	}
+	if opts.Format == ERDDot {
+		return renderDot(entities, columns, model, edges), nil
+	}
+	return renderMermaid(entities, columns, model, edges), nil
+}
+
+// isJunction reports whether the collection of relation and partner, two
+// relations pointing at one another through junction_field, only holds their
+// keys, its primary key and its sort field.
+func (m *schemaModel) isJunction(relation, partner Relation) bool {
+	if partnerJunction, _ := partner.Meta["junction_field"].(string); partnerJunction != relation.Field {
+		return false
+	}
+	sortField, _ := relation.Meta["sort_field"].(string)
+	for _, field := range m.fields[relation.Collection] {
+		switch {
+		case !hasColumn(field), isPrimaryKeyField(field),
+			field.Field == relation.Field, field.Field == partner.Field, field.Field == sortField:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isForeignKey reports whether collection.field holds the key of a relation.
+func (m *schemaModel) isForeignKey(collection, field string) bool {
+	return slices.ContainsFunc(m.relations, func(r Relation) bool { return r.Collection == collection && r.Field == field })
+}
+
+// renderMermaid writes the diagram in the Mermaid erDiagram language.
+func renderMermaid(entities []string, columns func(string) []Field, model *schemaModel, edges []erdEdge) string {
+	name := func(s string) string { return erdNonWord.ReplaceAllString(s, "_") }
+	var b strings.Builder
+	b.WriteString("erDiagram\n")
+	for _, entity := range entities {
+		fields := columns(entity)
+		if len(fields) == 0 {
+			fmt.Fprintf(&b, "    %s {\n    }\n", name(entity))
+			continue
+		}
+		fmt.Fprintf(&b, "    %s {\n", name(entity))
+		for _, field := range fields {
+			var keys []string
+			if isPrimaryKeyField(field) {
+				keys = append(keys, "PK")
+			}
+			if model.isForeignKey(field.Collection, field.Field) {
+				keys = append(keys, "FK")
+			}
+			fmt.Fprintf(&b, "        %s %s", name(field.Type), name(field.Field))
+			if len(keys) > 0 {
+				fmt.Fprintf(&b, " %s", strings.Join(keys, ","))
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("    }\n")
+	}
+	for _, edge := range edges {
+		var shape string
+		switch {
+		case edge.manyToMany:
+			shape = "}o--o{"
+		case edge.manyToAnyField:
+			shape = "|o..o{"
+		case edge.nullable:
+			shape = "|o--o{"
+		default:
+			shape = "||--o{"
+		}
+		fmt.Fprintf(&b, "    %s %s %s : \"%s\"\n", name(edge.from), shape, name(edge.to), strings.ReplaceAll(edge.label, `"`, "'"))
+	}
+	return b.String()
+}
+
+// renderDot writes the diagram in the Graphviz dot language, with a table
+// per entity and edges between the key columns.
+func renderDot(entities []string, columns func(string) []Field, model *schemaModel, edges []erdEdge) string {
+	quote := func(s string) string {
+		return `"` + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), `"`, `\"`) + `"`
+	}
+	var b strings.Builder
+	b.WriteString("digraph erd {\n    graph [rankdir=LR];\n    node [shape=plain, fontname=\"Helvetica\"];\n    edge [fontname=\"Helvetica\", fontsize=10];\n")
+	for _, entity := range entities {
+		fmt.Fprintf(&b, "    %s [label=<<table border=\"0\" cellborder=\"1\" cellspacing=\"0\" cellpadding=\"4\">", quote(entity))
+		fmt.Fprintf(&b, "<tr><td bgcolor=\"lightgrey\"><b>%s</b></td></tr>", html.EscapeString(entity))
+		for _, field := range columns(entity) {
+			text := field.Field + ": " + field.Type
+			if isPrimaryKeyField(field) {
+				text += " (PK)"
+			} else if model.isForeignKey(field.Collection, field.Field) {
+				text += " (FK)"
+			}
+			fmt.Fprintf(&b, "<tr><td align=\"left\" port=%s>%s</td></tr>", quote(field.Field), html.EscapeString(text))
+		}
+		b.WriteString("</table>>];\n")
+	}
+	for _, edge := range edges {
+		if edge.manyToMany {
+			fmt.Fprintf(&b, "    %s -> %s [label=%s, dir=both, arrowhead=crow, arrowtail=crow];\n", quote(edge.from), quote(edge.to), quote(edge.label))
+			continue
+		}
+		from, to := quote(edge.from), quote(edge.to)
+		if hasPort(columns(edge.from), edge.fromField) {
+			from += ":" + quote(edge.fromField)
+		}
+		if hasPort(columns(edge.to), edge.toField) {
+			to += ":" + quote(edge.toField)
+		}
+		attrs := "dir=both, arrowhead=crow, arrowtail=tee"
+		if edge.nullable {
+			attrs = "dir=both, arrowhead=crow, arrowtail=teeodot"
+		}
+		if edge.manyToAnyField {
+			attrs += ", style=dashed"
+		}
+		fmt.Fprintf(&b, "    %s -> %s [label=%s, %s];\n", from, to, quote(edge.label), attrs)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// hasPort reports whether the table of fields has a row for field.
+func hasPort(fields []Field, field string) bool {
+	return slices.ContainsFunc(fields, func(f Field) bool { return f.Field == field })
+}
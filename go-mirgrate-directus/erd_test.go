@@ -0,0 +1,48 @@
+package gomirgratedirectus_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+func TestGenerateERD(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts gomigratedirectus.ERDOptions
+	}{
+		{"erd.mmd.golden", gomigratedirectus.ERDOptions{}},
+		{"erd.dot.golden", gomigratedirectus.ERDOptions{Format: gomigratedirectus.ERDDot}},
+		{"erd-filtered.mmd.golden", gomigratedirectus.ERDOptions{Filter: gomigratedirectus.SchemaFilter{
+			ExcludeCollections: []string{"settings"},
+			SystemCollections:  gomigratedirectus.SystemExclude,
+		}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var first string
+			for i, snapshot := range modelSnapshots(t) {
+				got, err := gomigratedirectus.GenerateERD(snapshot, tt.opts)
+				if err != nil {
+					t.Fatalf("GenerateERD: %v", err)
+				}
+				if i == 0 {
+					first = got
+					golden(t, filepath.Join("models", tt.name), []byte(got))
+				} else if got != first {
+					t.Errorf("GenerateERD depends on the order of the snapshot:\n%s\nwant:\n%s", got, first)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateERDErrors(t *testing.T) {
+	if _, err := gomigratedirectus.GenerateERD(nil, gomigratedirectus.ERDOptions{}); err == nil {
+		t.Error("GenerateERD(nil) succeeded")
+	}
+	s := modelSnapshots(t)[0]
+	if _, err := gomigratedirectus.GenerateERD(s, gomigratedirectus.ERDOptions{Format: "plantuml"}); err == nil {
+		t.Error("GenerateERD with an unknown format succeeded")
+	}
+}
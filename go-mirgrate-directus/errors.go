@@ -0,0 +1,140 @@
+package gomirgratedirectus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Error codes Directus reports in the extensions.code field of an error.
+const (
+	CodeForbidden      = "FORBIDDEN"
+	CodeInvalidPayload = "INVALID_PAYLOAD"
+	CodeInvalidQuery   = "INVALID_QUERY"
+	CodeTokenExpired   = "TOKEN_EXPIRED"
+	CodeInvalidToken   = "INVALID_TOKEN"
+	CodeNotUnique      = "RECORD_NOT_UNIQUE"
+)
+
+// DirectusError is returned when a Directus instance answers a request with
+// an unexpected status code.
+type DirectusError struct {
+	// Operation is the client operation that failed, such as "snapshot".
+	Operation string
+	// Endpoint is the path of the request, such as "/schema/snapshot".
+	Endpoint string
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Errors holds the errors array of the response body, if it had one.
+	Errors []DirectusErrorDetail
+	// Body is the raw response body, truncated to a few KB.
+	Body string
+	// RequestID is the X-Request-ID sent with the failed request. Quote it
+	// when looking the request up in the Directus logs.
+	RequestID string
+}
+
+// DirectusErrorDetail is a single entry of the errors array in a Directus
+// error response.
+type DirectusErrorDetail struct {
+	Message    string `json:"message"`
+	Extensions struct {
+		Code string `json:"code"`
+	} `json:"extensions"`
+}
+
+func (e *DirectusError) Error() string {
+	msg := fmt.Sprintf("%s request failed with status %d: %s", e.Operation, e.StatusCode, e.Body)
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" (request ID %s)", e.RequestID)
+	}
+	return msg
+}
+
+// HasCode reports whether any of the errors in the response carries code.
+func (e *DirectusError) HasCode(code string) bool {
+	for _, detail := range e.Errors {
+		if detail.Extensions.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// newDirectusError builds a DirectusError from an unexpected response. The
+// body is truncated to a few KB and any credential Directus echoes back in it
+// is redacted.
+func (c *DirectusClient) newDirectusError(op string, resp *http.Response) *DirectusError {
+	return parseDirectusError(op, resp.Request, resp.StatusCode, c.redact(readErrorBody(resp)))
+}
+
+// readErrorBody reads at most maxErrorBodyBytes of the body of resp.
+func readErrorBody(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes+1))
+	if len(body) > maxErrorBodyBytes {
+		return string(body[:maxErrorBodyBytes]) + "... (truncated)"
+	}
+	return string(body)
+}
+
+// parseDirectusError builds a DirectusError for a response to req, extracting
+// the errors array from body when it has one.
+func parseDirectusError(op string, req *http.Request, statusCode int, body string) *DirectusError {
+	e := &DirectusError{
+		Operation:  op,
+		Endpoint:   req.URL.Path,
+		StatusCode: statusCode,
+		Body:       body,
+		RequestID:  req.Header.Get(RequestIDHeader),
+	}
+
+	var payload struct {
+		Errors []DirectusErrorDetail `json:"errors"`
+	}
+	if json.Unmarshal([]byte(body), &payload) == nil {
+		e.Errors = payload.Errors
+	}
+	return e
+}
+
+// IsForbidden reports whether err was caused by Directus rejecting a request
+// for lack of permissions.
+func IsForbidden(err error) bool {
+	var de *DirectusError
+	if !errors.As(err, &de) {
+		return false
+	}
+	return de.StatusCode == http.StatusForbidden || de.HasCode(CodeForbidden)
+}
+
+// isNotFound reports whether err is a Directus 404. Directus also answers 403
+// for collections and items that do not exist, but as it does for those the
+// token may not read, a 403 is never taken to mean absent.
+func isNotFound(err error) bool {
+	var directusErr *DirectusError
+	return errors.As(err, &directusErr) && directusErr.StatusCode == http.StatusNotFound
+}
+
+// IsVersionMismatch reports whether err was caused by base and target running
+// different Directus versions or database vendors, either detected by
+// CheckVersions or by Directus refusing the snapshot. Such diffs can be
+// computed anyway by passing force.
+func IsVersionMismatch(err error) bool {
+	if isVersionMismatchError(err) {
+		return true
+	}
+	var de *DirectusError
+	if !errors.As(err, &de) || !de.HasCode(CodeInvalidPayload) {
+		return false
+	}
+	for _, detail := range de.Errors {
+		if strings.Contains(detail.Message, "does not match the current instance") &&
+			!strings.Contains(detail.Message, "hash") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+func TestDirectusErrorRedactsToken(t *testing.T) {
+	const token = "s3cr3t/token+with=chars"
+	server := directustest.NewServer(t)
+	server.SetToken(token)
+	client := server.Client(quiet()...)
+	client.TokenInQuery = true
+	// Directus quotes the request URL, with the token query-escaped, in
+	// some of its error messages.
+	echo := fmt.Sprintf("Route %s/schema/snapshot?access_token=%s is invalid for %s", server.URL, url.QueryEscape(token), token)
+	server.Fail("/schema/snapshot", 1, directustest.Failure{Status: http.StatusBadRequest, Message: echo})
+
+	_, err := client.GetSnapshot(context.Background())
+	var directusErr *gomigratedirectus.DirectusError
+	if !errors.As(err, &directusErr) || directusErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("GetSnapshot = %v, want a DirectusError with status 400", err)
+	}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		for _, v := range []any{err, directusErr, *directusErr} {
+			if s := fmt.Sprintf(format, v); strings.Contains(s, token) || strings.Contains(s, url.QueryEscape(token)) {
+				t.Errorf("%s of %T contains the token: %s", format, v, s)
+			}
+		}
+	}
+	if !strings.Contains(directusErr.Body, "access_token=***") {
+		t.Errorf("Body = %q, want the token replaced by ***", directusErr.Body)
+	}
+	if len(directusErr.Errors) != 1 || directusErr.Errors[0].Extensions.Code != "INVALID_PAYLOAD" {
+		t.Errorf("Errors = %+v, want the parsed INVALID_PAYLOAD error", directusErr.Errors)
+	}
+}
+
+func TestIsForbidden(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"403", &gomigratedirectus.DirectusError{StatusCode: http.StatusForbidden}, true},
+		{"wrapped 403", fmt.Errorf("failed: %w", &gomigratedirectus.DirectusError{StatusCode: http.StatusForbidden}), true},
+		{"FORBIDDEN code", &gomigratedirectus.DirectusError{StatusCode: http.StatusBadRequest, Errors: []gomigratedirectus.DirectusErrorDetail{forbiddenDetail()}}, true},
+		{"404", &gomigratedirectus.DirectusError{StatusCode: http.StatusNotFound}, false},
+		{"other error", errors.New("forbidden"), false},
+	}
+	for _, tt := range tests {
+		if got := gomigratedirectus.IsForbidden(tt.err); got != tt.want {
+			t.Errorf("IsForbidden(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func forbiddenDetail() gomigratedirectus.DirectusErrorDetail {
+	var detail gomigratedirectus.DirectusErrorDetail
+	detail.Extensions.Code = gomigratedirectus.CodeForbidden
+	return detail
+}
@@ -0,0 +1,877 @@
+package gomirgratedirectus
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Phases of a migration, as reported by PhaseFailed.
+const (
+	PhaseWait         = "wait"
+	PhaseLock         = "lock"
+	PhaseVersionCheck = "version_check"
+	PhaseSnapshot     = "snapshot"
+	PhaseBeforeDiff   = "before_diff"
+	PhaseValidate     = "validate"
+	PhaseDiff         = "diff"
+	PhaseBeforeApply  = "before_apply"
+	PhaseSafetyCheck  = "safety_check"
+	PhaseConfirm      = "confirm"
+	PhaseBackup       = "backup"
+	PhaseApply        = "apply"
+	PhaseVerify       = "verify"
+	PhaseAfterApply   = "after_apply"
+	PhaseRollback     = "rollback"
+	PhaseHistory      = "history"
+	PhaseHooks        = "hooks"
+	PhaseFiles        = "files"
+	PhaseData         = "data"
+	PhasePermissions  = "permissions"
+	PhaseUsers        = "users"
+	PhasePresets      = "presets"
+	PhaseTranslations = "translations"
+	PhaseWebhooks     = "webhooks"
+	PhaseSettings     = "settings"
+	PhaseFlows        = "flows"
+	PhaseDashboards   = "dashboards"
+	PhaseCheckpoint   = "checkpoint"
+)
+
+// Event is emitted by MigrateWithOptions as the migration progresses. The
+// concrete types are pointers to the structs in this file, such as
+// *SnapshotCompleted; switch on them to react to specific events.
+type Event interface {
+	// EventTime returns when the event occurred.
+	EventTime() time.Time
+
+	setTime(time.Time)
+}
+
+// EventMeta holds the fields shared by all events.
+type EventMeta struct {
+	Time time.Time
+}
+
+func (e *EventMeta) EventTime() time.Time { return e.Time }
+
+func (e *EventMeta) setTime(t time.Time) { e.Time = t }
+
+// WaitStarted is emitted before waiting for an instance to become ready.
+type WaitStarted struct {
+	EventMeta
+	URL string
+}
+
+// VersionCheckStarted is emitted before the Directus versions are compared.
+type VersionCheckStarted struct{ EventMeta }
+
+// VersionCheckCompleted is emitted once the versions are known. Mismatch is
+// set when they differ but the migration continues because of Force.
+type VersionCheckCompleted struct {
+	EventMeta
+	Base     ServerInfo
+	Target   ServerInfo
+	Mismatch error
+}
+
+// SnapshotStarted is emitted before the base snapshot is fetched.
+type SnapshotStarted struct {
+	EventMeta
+	// Source describes where the snapshot comes from, such as the base
+	// URL or a file path.
+	Source string
+}
+
+// SnapshotCompleted is emitted once the base snapshot has been fetched.
+// Bytes is the size of the snapshot received from a live base project, zero
+// for other sources.
+type SnapshotCompleted struct {
+	EventMeta
+	Collections int
+	Fields      int
+	Relations   int
+	RequestID   string
+	Bytes       int64
+}
+
+// SnapshotScoped is emitted after SnapshotCompleted when the migration is
+// limited with MigrationOptions.ScopeCollections. Collections lists the
+// collections in scope, Junctions the junction collections pulled in.
+type SnapshotScoped struct {
+	EventMeta
+	Collections      []string
+	Junctions        []string
+	DroppedRelations []Relation
+}
+
+// SnapshotFiltered is emitted after SnapshotCompleted when collections are
+// included or excluded. Collections counts the collections that were kept.
+type SnapshotFiltered struct {
+	EventMeta
+	Collections         int
+	ExcludedCollections []string
+	ExcludedFields      []string
+	DroppedRelations    []Relation
+}
+
+// DiffStarted is emitted before the diff is requested from the target.
+type DiffStarted struct{ EventMeta }
+
+// DiffComputed is emitted once the diff is known. InSync is set when there is
+// nothing to apply, in which case Diff is nil. Cached is set when no diff was
+// requested because MigrationOptions.Cache showed the target in sync. Bytes is
+// the size of the snapshot sent and of the diff received.
+type DiffComputed struct {
+	EventMeta
+	InSync    bool
+	Cached    bool
+	Diff      *Diff
+	Summary   DiffSummary
+	RequestID string
+	Bytes     int64
+}
+
+// DiffModified is emitted after DiffComputed when MigrationOptions.BeforeApply
+// returned a different diff, summarized by Summary. InSync is set when it left
+// nothing to apply.
+type DiffModified struct {
+	EventMeta
+	InSync  bool
+	Summary DiffSummary
+}
+
+// ChangesSelected is emitted after DiffComputed when the diff was narrowed
+// with MigrationOptions.OnlyCollections or SelectChanges to Selected of its
+// Total changes, summarized by Summary. InSync is set when it left nothing to
+// apply.
+type ChangesSelected struct {
+	EventMeta
+	InSync   bool
+	Selected int
+	Total    int
+	Summary  DiffSummary
+}
+
+// DestructiveChangesFound is emitted after DiffComputed when the diff can
+// lose data, before the changes are checked against the policy.
+type DestructiveChangesFound struct {
+	EventMeta
+	Changes []DestructiveChange
+}
+
+// DryRunCompleted is emitted instead of ApplyStarted in dry-run mode.
+type DryRunCompleted struct {
+	EventMeta
+	Diff *Diff
+}
+
+// ApplyDeclined is emitted when MigrationOptions.Confirm declined the diff.
+type ApplyDeclined struct{ EventMeta }
+
+// BackupStarted is emitted before the target snapshot is backed up.
+type BackupStarted struct {
+	EventMeta
+	// Dir is the backup directory, or the Location of the backup store.
+	Dir string
+}
+
+// BackupCompleted is emitted once the target snapshot has been saved to
+// Path. PruneErr is set when old backups could not be removed, which does not
+// stop the migration.
+type BackupCompleted struct {
+	EventMeta
+	Path     string
+	PruneErr error
+}
+
+// ApplyStarted is emitted before the diff is applied to the target.
+type ApplyStarted struct{ EventMeta }
+
+// ApplyRetrying is emitted when an apply failed transiently and the diff is
+// recomputed before trying again.
+type ApplyRetrying struct {
+	EventMeta
+	Err error
+}
+
+// ApplyCompleted is emitted once the diff has been applied. Bytes is the size
+// of the diff sent.
+type ApplyCompleted struct {
+	EventMeta
+	RequestID string
+	Bytes     int64
+}
+
+// VerifyStarted is emitted after ApplyCompleted when the target is diffed
+// against the base again; see MigrationOptions.VerifyAfterApply.
+type VerifyStarted struct{ EventMeta }
+
+// VerifyCompleted is emitted once the target was verified. Residual holds the
+// changes still pending, summarized by Summary, nil when the target matches
+// the base. Err is set when the verification itself failed and
+// VerifyAfterApply is VerifyWarn.
+type VerifyCompleted struct {
+	EventMeta
+	Residual *Diff
+	Summary  DiffSummary
+	Err      error
+}
+
+// RollbackStarted is emitted when a failed apply is being rolled back to the
+// target snapshot taken before it, saved at BackupPath if backups are on.
+type RollbackStarted struct {
+	EventMeta
+	BackupPath string
+}
+
+// RollbackCompleted is emitted once the target has been restored.
+type RollbackCompleted struct{ EventMeta }
+
+// FilesSyncStarted is emitted before folders and files are synced, right
+// after the schema migration. Files counts the referenced files unless All is
+// set.
+type FilesSyncStarted struct {
+	EventMeta
+	All    bool
+	Files  int
+	DryRun bool
+}
+
+// FilesSynced is emitted once folders and files have been synced, or only
+// compared in a dry run.
+type FilesSynced struct {
+	EventMeta
+	Result *FilesResult
+}
+
+// DataSyncStarted is emitted before the items of the selected collections are
+// synced, after the schema migration and any files.
+type DataSyncStarted struct {
+	EventMeta
+	Collections []string
+	DryRun      bool
+}
+
+// DataSynced is emitted once the items have been synced, or only counted in
+// a dry run.
+type DataSynced struct {
+	EventMeta
+	Result *DataResult
+}
+
+// PermissionsSyncStarted is emitted before roles and permissions are synced,
+// after the schema migration and any data sync.
+type PermissionsSyncStarted struct {
+	EventMeta
+	DryRun bool
+}
+
+// PermissionsSynced is emitted once roles and permissions have been synced,
+// or only compared in a dry run.
+type PermissionsSynced struct {
+	EventMeta
+	Result *PermissionsResult
+}
+
+// UsersSyncStarted is emitted before users are provisioned, after roles and
+// permissions.
+type UsersSyncStarted struct {
+	EventMeta
+	DryRun bool
+}
+
+// UsersSynced is emitted once users have been provisioned, or only compared
+// in a dry run.
+type UsersSynced struct {
+	EventMeta
+	Result *UsersResult
+}
+
+// PresetsSyncStarted is emitted before shared presets are synced, after roles,
+// permissions and users.
+type PresetsSyncStarted struct {
+	EventMeta
+	DryRun bool
+}
+
+// PresetsSynced is emitted once shared presets have been synced, or only
+// compared in a dry run.
+type PresetsSynced struct {
+	EventMeta
+	Result *PresetsResult
+}
+
+// TranslationsSyncStarted is emitted before custom translations are synced,
+// after presets.
+type TranslationsSyncStarted struct {
+	EventMeta
+	DryRun bool
+}
+
+// TranslationsSynced is emitted once custom translations have been synced,
+// or only compared in a dry run.
+type TranslationsSynced struct {
+	EventMeta
+	Result *TranslationsResult
+}
+
+// WebhooksSyncStarted is emitted before legacy webhooks are synced, after
+// translations.
+type WebhooksSyncStarted struct {
+	EventMeta
+	DryRun bool
+}
+
+// WebhooksSynced is emitted once legacy webhooks have been synced, or only
+// compared in a dry run.
+type WebhooksSynced struct {
+	EventMeta
+	Result *WebhooksResult
+}
+
+// SettingsSyncStarted is emitted before project settings are synced, after
+// webhooks.
+type SettingsSyncStarted struct {
+	EventMeta
+	DryRun bool
+}
+
+// SettingsSynced is emitted once project settings have been synced, or only
+// compared in a dry run.
+type SettingsSynced struct {
+	EventMeta
+	Result *SettingsResult
+}
+
+// FlowsSyncStarted is emitted before flows are synced, after project
+// settings.
+type FlowsSyncStarted struct {
+	EventMeta
+	DryRun bool
+}
+
+// FlowsSynced is emitted once flows have been synced, or only compared in a
+// dry run.
+type FlowsSynced struct {
+	EventMeta
+	Result *FlowsResult
+}
+
+// DashboardsSyncStarted is emitted before dashboards and panels are synced,
+// after flows.
+type DashboardsSyncStarted struct {
+	EventMeta
+	DryRun bool
+}
+
+// DashboardsSynced is emitted once dashboards and panels have been synced, or
+// only compared in a dry run.
+type DashboardsSynced struct {
+	EventMeta
+	Result *DashboardsResult
+}
+
+// LockWaiting is emitted while MigrationOptions.Lock waits for the lock Held
+// by another migration.
+type LockWaiting struct {
+	EventMeta
+	Held Lock
+}
+
+// StaleLockTakenOver is emitted when MigrationOptions.Lock took over the
+// expired lock Stale.
+type StaleLockTakenOver struct {
+	EventMeta
+	Stale Lock
+}
+
+// LockAcquired is emitted once MigrationOptions.Lock took the lock of the
+// target.
+type LockAcquired struct {
+	EventMeta
+	Collection string
+	Lock       Lock
+}
+
+// LockReleased is emitted when the lock of the target was released, or
+// failed to be released with Err.
+type LockReleased struct {
+	EventMeta
+	Collection string
+	Err        error
+}
+
+// HookStarted is emitted before MigrationOptions.Hook is called for Stage.
+type HookStarted struct {
+	EventMeta
+	Stage string
+}
+
+// HookFinished is emitted once the hook of Stage returned, with its error if
+// it failed.
+type HookFinished struct {
+	EventMeta
+	Stage    string
+	Duration time.Duration
+	Err      error
+}
+
+// CheckpointResumed is emitted after the schema phase when the checkpoint of
+// a failed run is resumed: the sync phases and data collections it completed
+// are skipped.
+type CheckpointResumed struct {
+	EventMeta
+	Path            string
+	UpdatedAt       time.Time
+	Phases          int
+	DataCollections []string
+}
+
+// CheckpointDiscarded is emitted when MigrationOptions.Resume is set but the
+// checkpoint at Path, if any, cannot be resumed, and all phases run.
+type CheckpointDiscarded struct {
+	EventMeta
+	Path   string
+	Reason string
+}
+
+// PhaseSkipped is emitted instead of running a phase that the resumed
+// checkpoint recorded as completed at CompletedAt.
+type PhaseSkipped struct {
+	EventMeta
+	Phase       string
+	CompletedAt time.Time
+}
+
+// CheckpointSaved is emitted after the checkpoint was saved to Path once
+// Phase, or the data of Collection, completed, or failed to be with Err.
+type CheckpointSaved struct {
+	EventMeta
+	Path       string
+	Phase      string
+	Collection string
+	Err        error
+}
+
+// CheckpointRemoved is emitted after the checkpoint of a successful
+// migration was removed, or failed to be with Err.
+type CheckpointRemoved struct {
+	EventMeta
+	Path string
+	Err  error
+}
+
+// UndoRecorded is emitted after the undo record of the diff applied was saved
+// to Path, or failed to be with Err. Path is empty when the diff left nothing
+// to revert.
+type UndoRecorded struct {
+	EventMeta
+	Path     string
+	Err      error
+	PruneErr error
+}
+
+// HistoryCollectionCreated is emitted when MigrationOptions.RecordHistory
+// created the history collection on the target.
+type HistoryCollectionCreated struct {
+	EventMeta
+	Collection string
+}
+
+// HistoryRecorded is emitted after an attempt to apply a diff was recorded in
+// the history collection, or failed to be recorded with Err.
+type HistoryRecorded struct {
+	EventMeta
+	Collection string
+	Entry      HistoryEntry
+	Err        error
+}
+
+// CacheUpdated is emitted after MigrationOptions.Cache was updated, or failed
+// to be with Err.
+type CacheUpdated struct {
+	EventMeta
+	Err error
+}
+
+// ProgressTargets is the Progress phase of MigrateToTargets, counting the
+// targets that were migrated.
+const ProgressTargets = "targets"
+
+// Progress is emitted while a phase with a known amount of work runs, such as
+// PhaseFiles, counting files, PhaseData, counting the items written, or
+// ProgressTargets. Done counts the work finished out of Total.
+type Progress struct {
+	EventMeta
+	Phase string
+	Done  int
+	Total int
+}
+
+// PhaseFailed is emitted when a phase fails, right before MigrateWithOptions
+// returns the error.
+type PhaseFailed struct {
+	EventMeta
+	Phase string
+	Err   error
+}
+
+// logReporter logs the progress of a migration. Dry-run diffs are data
+// rather than progress, so they are rendered to out instead of the log.
+type logReporter struct {
+	logger *slog.Logger
+	out    io.Writer
+	color  bool
+}
+
+func (r logReporter) handle(event Event) {
+	log := r.logger
+	switch e := event.(type) {
+	case *WaitStarted:
+		log.Info("waiting for instance to become ready", "url", e.URL)
+	case *VersionCheckStarted:
+		log.Info("checking Directus versions")
+	case *VersionCheckCompleted:
+		switch {
+		case e.Mismatch != nil:
+			log.Warn("continuing despite version mismatch because force is set", "error", e.Mismatch)
+		case e.Base.Version == "" || e.Target.Version == "":
+			log.Info("Directus version not reported by both projects, skipping version check")
+		default:
+			log.Info("both projects run the same Directus version", "version", minorVersion(e.Base.Version))
+		}
+	case *SnapshotStarted:
+		log.Info("retrieving snapshot from base project", "source", e.Source)
+	case *SnapshotCompleted:
+		log.Info("snapshot retrieved", "collections", e.Collections, "fields", e.Fields,
+			"relations", e.Relations, "request_id", e.RequestID)
+	case *SnapshotScoped:
+		for _, junction := range e.Junctions {
+			log.Info("adding junction collection to the scope", "collection", junction)
+		}
+		log.Info("snapshot scoped", "collections", strings.Join(e.Collections, ","))
+		for _, relation := range e.DroppedRelations {
+			log.Warn("dropping relation to a collection out of scope",
+				"collection", relation.Collection, "field", relation.Field, "related_collection", relation.RelatedCollection)
+		}
+	case *SnapshotFiltered:
+		log.Info("snapshot filtered", "collections", e.Collections, "excluded", len(e.ExcludedCollections),
+			"excluded_fields", len(e.ExcludedFields))
+		for _, relation := range e.DroppedRelations {
+			log.Warn("dropping relation between an included and an excluded collection",
+				"collection", relation.Collection, "field", relation.Field, "related_collection", relation.RelatedCollection)
+		}
+	case *DiffStarted:
+		log.Info("retrieving diff from target project")
+	case *DiffComputed:
+		if e.InSync {
+			var args []any
+			if e.Summary.FilteredFields > 0 {
+				args = append(args, "filtered_fields", e.Summary.FilteredFields)
+			}
+			if e.Cached {
+				args = append(args, "cached", true)
+			}
+			log.Info("schemas already in sync, nothing to apply", args...)
+			return
+		}
+		log.Info("diff retrieved", "changes", e.Summary.String(), "request_id", e.RequestID)
+	case *DiffModified:
+		if e.InSync {
+			log.Info("diff emptied by before apply callback, nothing to apply")
+			return
+		}
+		log.Info("diff modified by before apply callback", "changes", e.Summary.String())
+	case *ChangesSelected:
+		if e.InSync {
+			log.Info("no selected changes, nothing to apply")
+			return
+		}
+		log.Info("changes selected", "selected", e.Selected, "total", e.Total, "changes", e.Summary.String())
+	case *DryRunCompleted:
+		RenderDiffWithOptions(e.Diff, r.out, RenderOptions{Color: r.color})
+		log.Info("dry run: no changes were applied")
+	case *DestructiveChangesFound:
+		for _, change := range e.Changes {
+			log.Warn("destructive change: "+change.String(), "kind", change.Kind)
+		}
+	case *ApplyDeclined:
+		log.Warn("changes were not confirmed, nothing applied")
+	case *BackupStarted:
+		log.Info("backing up target snapshot", "dir", e.Dir)
+	case *BackupCompleted:
+		log.Info("target snapshot backed up", "path", e.Path)
+		if e.PruneErr != nil {
+			log.Warn("failed to remove old backups", "error", e.PruneErr)
+		}
+	case *ApplyStarted:
+		log.Info("applying diff to target project")
+	case *Progress:
+		log.Debug("progress", "phase", e.Phase, "done", e.Done, "total", e.Total)
+	case *ApplyRetrying:
+		log.Warn("apply failed, re-checking diff before retrying", "error", e.Err)
+	case *ApplyCompleted:
+		log.Info("diff applied, migration complete", "request_id", e.RequestID)
+	case *VerifyStarted:
+		log.Info("verifying the target matches the base")
+	case *VerifyCompleted:
+		switch {
+		case e.Err != nil:
+			log.Warn("failed to verify target", "error", e.Err)
+		case e.Residual != nil:
+			log.Warn("target still differs from the base after applying", "summary", e.Summary.String())
+			for _, item := range ListDiffItems(e.Residual) {
+				log.Warn("residual difference", "key", item.Key)
+			}
+		default:
+			log.Info("target verified, it matches the base")
+		}
+	case *RollbackStarted:
+		log.Warn("rolling back target to the snapshot taken before applying", "backup", e.BackupPath)
+	case *RollbackCompleted:
+		log.Info("rollback complete, target schema restored")
+	case *FilesSyncStarted:
+		if e.All {
+			log.Info("syncing all files", "dry_run", e.DryRun)
+		} else {
+			log.Info("syncing referenced files", "files", e.Files, "dry_run", e.DryRun)
+		}
+	case *FilesSynced:
+		for _, id := range e.Result.Missing {
+			log.Warn("referenced file does not exist on the base", "id", id)
+		}
+		if e.Result.Changed() {
+			log.Info("files synced", "folders_created", e.Result.Folders.Created, "uploaded", len(e.Result.Uploaded),
+				"replaced", len(e.Result.Replaced), "skipped", e.Result.Skipped, "bytes", e.Result.Bytes, "dry_run", e.Result.DryRun)
+		} else {
+			log.Info("files already in sync", "skipped", e.Result.Skipped)
+		}
+	case *DataSyncStarted:
+		log.Info("syncing data", "collections", e.Collections, "dry_run", e.DryRun)
+	case *DataSynced:
+		for _, collection := range e.Result.Collections {
+			log.Info("data synced", "collection", collection.Collection, "strategy", collection.Strategy,
+				"base_rows", collection.BaseRows, "target_rows", collection.TargetRows, "created", collection.Rows.Created,
+				"updated", collection.Rows.Updated, "deleted", collection.Rows.Deleted, "dry_run", e.Result.DryRun)
+		}
+	case *PermissionsSyncStarted:
+		log.Info("syncing roles and permissions", "dry_run", e.DryRun)
+	case *PermissionsSynced:
+		skipped := "skipping admin role"
+		if e.Result.Model == PermissionModelPolicies {
+			skipped = "skipping admin policy"
+		}
+		for _, name := range e.Result.SkippedAdminRoles {
+			log.Info(skipped, "name", name)
+		}
+		for _, role := range e.Result.Roles {
+			if !role.Changed() {
+				continue
+			}
+			log.Info("role permissions synced", "role", role.Role, "role_created", role.Created, "role_updated", role.Updated,
+				"created", role.Permissions.Created, "updated", role.Permissions.Updated, "deleted", role.Permissions.Deleted,
+				"dry_run", e.Result.DryRun)
+		}
+		for _, policy := range e.Result.Policies {
+			if !policy.Changed() {
+				continue
+			}
+			log.Info("policy permissions synced", "policy", policy.Policy, "policy_created", policy.Created, "policy_updated", policy.Updated,
+				"created", policy.Permissions.Created, "updated", policy.Permissions.Updated, "deleted", policy.Permissions.Deleted,
+				"dry_run", e.Result.DryRun)
+		}
+		if e.Result.Access.Total() > 0 {
+			log.Info("policy access synced", "created", e.Result.Access.Created, "deleted", e.Result.Access.Deleted, "dry_run", e.Result.DryRun)
+		}
+		if !e.Result.Changed() {
+			log.Info("roles and permissions already in sync", "model", e.Result.Model)
+		}
+	case *UsersSyncStarted:
+		log.Info("provisioning users", "dry_run", e.DryRun)
+	case *UsersSynced:
+		for _, email := range e.Result.SkippedAdmin {
+			log.Warn("skipping user with admin access", "email", email)
+		}
+		for _, email := range e.Result.SkippedMissingRole {
+			log.Warn("skipping user, its role does not exist on the target", "email", email)
+		}
+		for _, email := range e.Result.MissingEmails {
+			log.Warn("no base user with email", "email", email)
+		}
+		for _, email := range e.Result.Created {
+			log.Info("user created", "email", email, "dry_run", e.Result.DryRun)
+		}
+		for _, email := range e.Result.Invited {
+			log.Info("user invited", "email", email, "dry_run", e.Result.DryRun)
+		}
+		if len(e.Result.Existing) > 0 {
+			log.Info("users already exist on the target", "count", len(e.Result.Existing))
+		}
+		// Generated passwords go to the output, never to the log.
+		RenderPasswords(e.Result.Passwords, r.out)
+	case *PresetsSyncStarted:
+		log.Info("syncing presets", "dry_run", e.DryRun)
+	case *PresetsSynced:
+		for _, key := range e.Result.SkippedMissingRole {
+			log.Warn("skipping preset, its role does not exist on the target",
+				"collection", key.Collection, "bookmark", key.Bookmark, "role", key.Role)
+		}
+		if e.Result.Changed() {
+			log.Info("presets synced", "created", e.Result.Presets.Created, "updated", e.Result.Presets.Updated,
+				"deleted", e.Result.Presets.Deleted, "dry_run", e.Result.DryRun)
+		} else {
+			log.Info("presets already in sync")
+		}
+	case *TranslationsSyncStarted:
+		log.Info("syncing translations", "dry_run", e.DryRun)
+	case *TranslationsSynced:
+		if e.Result.DryRun {
+			for _, change := range []struct {
+				msg  string
+				keys []TranslationKey
+			}{
+				{"translation would be added", e.Result.Added},
+				{"translation would be updated", e.Result.Updated},
+				{"translation would be removed", e.Result.Removed},
+			} {
+				for _, key := range change.keys {
+					log.Info(change.msg, "language", key.Language, "key", key.Key)
+				}
+			}
+		}
+		if counts := e.Result.Counts(); counts.Total() > 0 {
+			log.Info("translations synced", "created", counts.Created, "updated", counts.Updated, "deleted", counts.Deleted,
+				"dry_run", e.Result.DryRun)
+		} else {
+			log.Info("translations already in sync")
+		}
+	case *WebhooksSyncStarted:
+		log.Info("syncing webhooks", "dry_run", e.DryRun)
+	case *WebhooksSynced:
+		for _, change := range []struct {
+			msg   string
+			names []string
+		}{
+			{"webhook created", e.Result.Created},
+			{"webhook updated", e.Result.Updated},
+			{"webhook deactivated", e.Result.Deactivated},
+			{"webhook deleted", e.Result.Deleted},
+		} {
+			for _, name := range change.names {
+				log.Info(change.msg, "webhook", name, "dry_run", e.Result.DryRun)
+			}
+		}
+		if !e.Result.Changed() {
+			log.Info("webhooks already in sync")
+		}
+	case *SettingsSyncStarted:
+		log.Info("syncing settings", "dry_run", e.DryRun)
+	case *SettingsSynced:
+		for _, skipped := range e.Result.Skipped {
+			log.Warn("skipping setting", "key", skipped.Key, "reason", skipped.Reason)
+		}
+		for _, change := range e.Result.Changes {
+			log.Info("setting synced", "key", change.Key, "before", formatValue(change.Before), "after", formatValue(change.After),
+				"dry_run", e.Result.DryRun)
+		}
+		if !e.Result.Changed() {
+			log.Info("settings already in sync")
+		}
+	case *FlowsSyncStarted:
+		log.Info("syncing flows", "dry_run", e.DryRun)
+	case *FlowsSynced:
+		for _, flow := range e.Result.Flows {
+			if !flow.Changed() {
+				continue
+			}
+			log.Info("flow synced", "flow", flow.Flow, "flow_created", flow.Created, "flow_updated", flow.Updated,
+				"created", flow.Operations.Created, "updated", flow.Operations.Updated, "deleted", flow.Operations.Deleted,
+				"dry_run", e.Result.DryRun)
+		}
+		for _, name := range e.Result.Pruned {
+			log.Info("pruned inactive flow", "flow", name, "dry_run", e.Result.DryRun)
+		}
+		if !e.Result.Changed() {
+			log.Info("flows already in sync")
+		}
+	case *DashboardsSyncStarted:
+		log.Info("syncing dashboards", "dry_run", e.DryRun)
+	case *DashboardsSynced:
+		for _, ref := range e.Result.MissingCollections {
+			log.Warn("panel references a collection that does not exist on the target",
+				"dashboard", ref.Dashboard, "panel", ref.Panel, "collection", ref.Collection)
+		}
+		if e.Result.Changed() {
+			log.Info("dashboards synced", "dashboards_created", e.Result.Dashboards.Created, "dashboards_updated", e.Result.Dashboards.Updated,
+				"panels_created", e.Result.Panels.Created, "panels_deleted", e.Result.Panels.Deleted, "dry_run", e.Result.DryRun)
+		} else {
+			log.Info("dashboards already in sync")
+		}
+	case *LockWaiting:
+		log.Info("target is locked, waiting", "holder", e.Held.Holder, "expires_at", e.Held.ExpiresAt)
+	case *StaleLockTakenOver:
+		log.Warn("took over expired lock", "holder", e.Stale.Holder, "expired_at", e.Stale.ExpiresAt)
+	case *LockAcquired:
+		log.Info("target locked", "collection", e.Collection, "holder", e.Lock.Holder, "expires_at", e.Lock.ExpiresAt)
+	case *LockReleased:
+		if e.Err != nil {
+			log.Warn("failed to release lock, it expires on its own", "collection", e.Collection, "error", e.Err)
+		} else {
+			log.Info("target unlocked", "collection", e.Collection)
+		}
+	case *HookStarted:
+		log.Debug("calling hook", "hook", e.Stage)
+	case *HookFinished:
+		if e.Err != nil {
+			log.Warn("hook failed", "hook", e.Stage, "duration", e.Duration, "error", e.Err)
+		} else {
+			log.Debug("hook returned", "hook", e.Stage, "duration", e.Duration)
+		}
+	case *CheckpointResumed:
+		log.Info("resuming from checkpoint", "path", e.Path, "updated_at", e.UpdatedAt, "phases", e.Phases, "data_collections", len(e.DataCollections))
+	case *CheckpointDiscarded:
+		log.Info("not resuming from checkpoint", "path", e.Path, "reason", e.Reason)
+	case *PhaseSkipped:
+		log.Info("skipping phase completed by the resumed run", "phase", e.Phase, "completed_at", e.CompletedAt)
+	case *CheckpointSaved:
+		if e.Err != nil {
+			log.Warn("failed to save checkpoint", "path", e.Path, "phase", e.Phase, "error", e.Err)
+		} else {
+			log.Debug("checkpoint saved", "path", e.Path, "phase", e.Phase, "collection", e.Collection)
+		}
+	case *CheckpointRemoved:
+		if e.Err != nil {
+			log.Warn("failed to remove checkpoint", "path", e.Path, "error", e.Err)
+		} else {
+			log.Debug("checkpoint removed", "path", e.Path)
+		}
+	case *UndoRecorded:
+		switch {
+		case e.Err != nil:
+			log.Warn("failed to record undo", "error", e.Err)
+		case e.Path != "":
+			log.Info("undo recorded", "path", e.Path)
+		}
+		if e.PruneErr != nil {
+			log.Warn("failed to remove old undo records", "error", e.PruneErr)
+		}
+	case *HistoryCollectionCreated:
+		log.Info("history collection created", "collection", e.Collection)
+	case *HistoryRecorded:
+		if e.Err != nil {
+			log.Warn("failed to record migration history", "collection", e.Collection, "error", e.Err)
+		} else {
+			log.Info("migration recorded in history", "collection", e.Collection, "status", e.Entry.Status)
+		}
+	case *CacheUpdated:
+		if e.Err != nil {
+			log.Warn("failed to update schema cache", "error", e.Err)
+		} else {
+			log.Debug("schema cache updated")
+		}
+	case *PhaseFailed:
+		log.Error("migration failed", "phase", e.Phase, "error", e.Err)
+	}
+}
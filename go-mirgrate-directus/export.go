@@ -0,0 +1,162 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Snapshot export formats supported by GetSnapshotRaw and ParseSnapshot.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// GetSnapshotRaw retrieves the schema snapshot as exported by Directus with
+// /schema/snapshot?export=<format>, where format is FormatJSON or FormatYAML.
+// YAML snapshots diff much more nicely in version control than JSON ones.
+func (c *DirectusClient) GetSnapshotRaw(ctx context.Context, format string) (_ []byte, err error) {
+	ctx, done := startOperation(ctx, "snapshot", c.Timeouts.Snapshot)
+	defer func() { err = done(err) }()
+
+	format, err = normalizeFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{"export": {format}}
+	resp, err := c.send(ctx, "snapshot", http.MethodGet, "/schema/snapshot", query, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.newDirectusError("snapshot", resp)
+	}
+	return c.readBody("snapshot", resp)
+}
+
+// ParseSnapshot decodes a snapshot exported in format. YAML input is converted
+// so that it yields exactly what decoding the equivalent JSON would, meaning
+// the diff request body built from it is the same.
+func ParseSnapshot(data []byte, format string) (*Snapshot, error) {
+	format, err := normalizeFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == FormatYAML {
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to decode YAML snapshot: %w", err)
+		}
+		doc, err := yamlToJSONValue(doc)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("failed to convert YAML snapshot: %w", err)
+		}
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON snapshot: %w", err)
+	}
+	if envelope == nil {
+		return nil, fmt.Errorf("snapshot is empty")
+	}
+	// Accept the envelope returned by /schema/snapshot as well.
+	if inner, ok := envelope["data"]; ok && len(envelope) == 1 {
+		data = inner
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// ParseDiff decodes a JSON diff as returned by GetDiff, with or without the
+// data envelope of /schema/diff, so that a reviewed diff can be applied later.
+func ParseDiff(data []byte) (*Diff, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON diff: %w", err)
+	}
+	if envelope == nil {
+		return nil, fmt.Errorf("diff is empty")
+	}
+	if inner, ok := envelope["data"]; ok && len(envelope) == 1 {
+		data = inner
+	}
+
+	var diff Diff
+	if err := json.Unmarshal(data, &diff); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON diff: %w", err)
+	}
+	if diff.Hash == "" {
+		return nil, fmt.Errorf("diff has no hash, it must be produced by /schema/diff")
+	}
+	return &diff, nil
+}
+
+// yamlToJSONValue converts a value decoded by yaml.v3 into one that
+// encoding/json can marshal, rejecting mapping keys that are not strings.
+func yamlToJSONValue(v any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			converted, err := yamlToJSONValue(value)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+		return v, nil
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("YAML snapshot contains non-string key %v", key)
+			}
+			converted, err := yamlToJSONValue(value)
+			if err != nil {
+				return nil, err
+			}
+			m[name] = converted
+		}
+		return m, nil
+	case []any:
+		for i, value := range v {
+			converted, err := yamlToJSONValue(value)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// normalizeFormat validates a snapshot format name.
+func normalizeFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", FormatJSON:
+		return FormatJSON, nil
+	case FormatYAML, "yml":
+		return FormatYAML, nil
+	default:
+		return "", fmt.Errorf("unsupported snapshot format %q, expected json or yaml", format)
+	}
+}
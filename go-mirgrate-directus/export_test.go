@@ -0,0 +1,61 @@
+package gomirgratedirectus_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// diffRequestBody posts snapshot to a new target answering diff and returns
+// the body the target received.
+func diffRequestBody(t *testing.T, snapshot *gomigratedirectus.Snapshot, diff *gomigratedirectus.Diff) []byte {
+	t.Helper()
+	target := directustest.NewServer(t)
+	target.SetDiff(diff)
+	if _, err := target.Client(quiet()...).GetDiff(context.Background(), snapshot, false); err != nil {
+		t.Fatalf("GetDiff: %v", err)
+	}
+	var bodies [][]byte
+	for _, req := range target.Requests() {
+		if req.Path == "/schema/diff" {
+			bodies = append(bodies, req.Body)
+		}
+	}
+	if len(bodies) != 1 {
+		t.Fatalf("target received %d diff requests, want 1", len(bodies))
+	}
+	return bodies[0]
+}
+
+func TestParseSnapshotYAMLDiffRequest(t *testing.T) {
+	for _, version := range directustest.FixtureVersions() {
+		t.Run(version, func(t *testing.T) {
+			f, err := directustest.LoadFixture(version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fromJSON, err := gomigratedirectus.ParseSnapshot(f.SnapshotBody, gomigratedirectus.FormatJSON)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := gomigratedirectus.EncodeSnapshot(fromJSON, gomigratedirectus.FormatYAML)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fromYAML, err := gomigratedirectus.ParseSnapshot(data, gomigratedirectus.FormatYAML)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Numbers, nulls and nested meta decoded from YAML are sent to
+			// /schema/diff exactly as those decoded from JSON.
+			want := diffRequestBody(t, fromJSON, f.Diff)
+			if got := diffRequestBody(t, fromYAML, f.Diff); !bytes.Equal(got, want) {
+				t.Errorf("diff request from YAML differs from JSON\ngot:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,489 @@
+package gomirgratedirectus
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Folder is a folder of the file library, as listed by /folders.
+type Folder struct {
+	ID     string  `json:"id,omitempty"`
+	Name   string  `json:"name"`
+	Parent *string `json:"parent"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (f Folder) MarshalJSON() ([]byte, error) {
+	type plain Folder
+	return marshalWithExtra(plain(f), f.Extra)
+}
+
+func (f *Folder) UnmarshalJSON(data []byte) error {
+	type plain Folder
+	return unmarshalWithExtra(data, (*plain)(f), &f.Extra)
+}
+
+// File is a file of the file library, as listed by /files. Filesize is a
+// number or, for big integer columns, a numeric string. Extra holds the
+// remaining properties, such as title, description and tags.
+type File struct {
+	ID               string      `json:"id"`
+	Folder           *string     `json:"folder"`
+	FilenameDownload string      `json:"filename_download"`
+	Type             string      `json:"type,omitempty"`
+	Filesize         json.Number `json:"filesize,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (f File) MarshalJSON() ([]byte, error) {
+	type plain File
+	return marshalWithExtra(plain(f), f.Extra)
+}
+
+func (f *File) UnmarshalJSON(data []byte) error {
+	type plain File
+	return unmarshalWithExtra(data, (*plain)(f), &f.Extra)
+}
+
+// fileReadOnlyKeys are the file properties Directus derives from the stored
+// asset, which are never written with UpdateFile.
+var fileReadOnlyKeys = []string{
+	"storage", "filename_disk", "charset", "width", "height", "duration", "metadata",
+	"uploaded_by", "uploaded_on", "created_on", "modified_by", "modified_on", "tus_id", "tus_data",
+}
+
+// ListFolders returns all folders of the file library.
+func (c *DirectusClient) ListFolders(ctx context.Context) (_ []Folder, err error) {
+	ctx, done := startOperation(ctx, "list folders", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var folders []Folder
+	if err := c.doJSON(ctx, "list folders", http.MethodGet, "/folders", url.Values{"limit": {"-1"}}, nil, &folders); err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+// CreateFolder creates folder, keeping its ID.
+func (c *DirectusClient) CreateFolder(ctx context.Context, folder Folder) (err error) {
+	ctx, done := startOperation(ctx, "create folder", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "create folder", http.MethodPost, "/folders", nil, folder, nil)
+}
+
+// ListFiles returns all files of the file library.
+func (c *DirectusClient) ListFiles(ctx context.Context) (_ []File, err error) {
+	ctx, done := startOperation(ctx, "list files", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var files []File
+	if err := c.doJSON(ctx, "list files", http.MethodGet, "/files", url.Values{"limit": {"-1"}}, nil, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// UpdateFile sets the properties of the file with the given ID, leaving the
+// stored asset alone.
+func (c *DirectusClient) UpdateFile(ctx context.Context, id string, properties map[string]json.RawMessage) (err error) {
+	ctx, done := startOperation(ctx, "update file", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "update file", http.MethodPatch, "/files/"+url.PathEscape(id), nil, properties, nil)
+}
+
+// DownloadAsset opens the stored asset of the file with the given ID. The
+// caller must close the returned stream.
+func (c *DirectusClient) DownloadAsset(ctx context.Context, id string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, "download asset", http.MethodGet, "/assets/"+url.PathEscape(id), nil, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, c.newDirectusError("download asset", resp)
+	}
+	return resp.Body, nil
+}
+
+// UploadFile streams content as the asset of file. With replace the asset
+// of the existing file with the same ID is replaced; otherwise the file is
+// created, keeping its ID and folder. It returns the number of bytes read
+// from content. Uploads are not retried, as the stream cannot be replayed.
+func (c *DirectusClient) UploadFile(ctx context.Context, file File, content io.Reader, replace bool) (int64, error) {
+	method, path := http.MethodPost, "/files"
+	if replace {
+		method, path = http.MethodPatch, "/files/"+url.PathEscape(file.ID)
+	}
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	counter := &countingReader{r: content}
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		writer.CloseWithError(writeFileForm(form, file, counter, !replace))
+	}()
+	// Closing the reader stops the writer if the request ends early; the
+	// count is only read once it has returned.
+	defer func() {
+		body.Close()
+		<-written
+	}()
+
+	token, err := c.requestToken(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to authenticate upload file request: %w", err)
+	}
+	req, err := c.newRequest(ctx, method, path, nil, body, token)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create upload file request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if err := c.waitRateLimit(ctx); err != nil {
+		return 0, fmt.Errorf("upload file request canceled: %w", err)
+	}
+	if err := c.circuitAllow(); err != nil {
+		return 0, fmt.Errorf("upload file request not sent: %w", err)
+	}
+	start := time.Now()
+	resp, err := c.httpClient(ctx).Do(req)
+	c.logRequest(ctx, "upload file", req, resp, err, time.Since(start))
+	c.Metrics.observeRequest("upload file", resp, err)
+	c.circuitRecord(ctx, resp, err, c.secrets())
+	c.dumpExchange("upload file", req, nil, resp, err, time.Since(start), c.secrets())
+	body.Close()
+	<-written
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return counter.n, fmt.Errorf("upload file request canceled: %w", ctxErr)
+		}
+		return counter.n, fmt.Errorf("failed to execute upload file request: %w", c.redactError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return counter.n, c.newDirectusError("upload file", resp)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return counter.n, nil
+}
+
+// writeFileForm writes the multipart form of UploadFile. Directus reads the
+// properties of a file from the fields preceding the file part.
+func writeFileForm(form *multipart.Writer, file File, content io.Reader, withID bool) error {
+	if withID {
+		if err := form.WriteField("id", file.ID); err != nil {
+			return err
+		}
+	}
+	if file.Folder != nil {
+		if err := form.WriteField("folder", *file.Folder); err != nil {
+			return err
+		}
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, file.FilenameDownload))
+	header.Set("Content-Type", cmp.Or(file.Type, "application/octet-stream"))
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// FileSyncOptions configures SyncFiles.
+type FileSyncOptions struct {
+	// DryRun only computes the changes; nothing is transferred.
+	DryRun bool
+	// All copies every file of the base. Otherwise only the files in IDs
+	// are copied.
+	All bool
+	IDs []string
+	// OnProgress, if set, is called after each selected file was copied,
+	// skipped or compared, with the number of files handled so far and the
+	// number selected.
+	OnProgress func(done, total int)
+}
+
+// FilesResult is the result of SyncFiles.
+type FilesResult struct {
+	// Folders counts the folders created on the target.
+	Folders ChangeCounts `json:"folders"`
+	// Uploaded and Replaced list the IDs of the files whose asset was
+	// uploaded as a new file or replaced an existing one, sorted.
+	Uploaded []string `json:"uploaded,omitempty"`
+	Replaced []string `json:"replaced,omitempty"`
+	// Skipped counts the files that already exist on the target with the
+	// same size.
+	Skipped int `json:"skipped"`
+	// Missing lists the requested file IDs the base does not have.
+	Missing []string `json:"missing,omitempty"`
+	// Bytes is the size of the transferred assets, or of those that would
+	// be transferred in a dry run.
+	Bytes int64 `json:"bytes"`
+	// DryRun reports that the changes were only computed.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Changed reports whether any folder or file changed.
+func (r *FilesResult) Changed() bool {
+	return r.Folders.Total()+len(r.Uploaded)+len(r.Replaced) > 0
+}
+
+// SyncFiles copies the folder tree of base and the selected files, with their
+// assets, to target. Folders are matched by path and created with the ID of
+// the base; files keep their ID, so that foreign keys to directus_files
+// resolve on the target. A file whose ID already exists on the target is
+// skipped when its size matches and has its asset replaced otherwise; Directus
+// stores no checksums to compare. Assets are streamed from base to target
+// without being buffered, one file at a time, each bounded by the Transfer
+// timeout of target.
+func SyncFiles(ctx context.Context, base, target *DirectusClient, opts FileSyncOptions) (*FilesResult, error) {
+	result := &FilesResult{DryRun: opts.DryRun}
+	folderIDs, err := syncFolders(ctx, base, target, opts.DryRun, &result.Folders)
+	if err != nil {
+		return result, err
+	}
+
+	baseFiles, err := base.ListFiles(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to list base files: %w", err)
+	}
+	targetFiles, err := target.ListFiles(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to list target files: %w", err)
+	}
+	existing := map[string]File{}
+	for _, file := range targetFiles {
+		existing[file.ID] = file
+	}
+
+	selected := baseFiles
+	if !opts.All {
+		byID := map[string]File{}
+		for _, file := range baseFiles {
+			byID[file.ID] = file
+		}
+		selected = nil
+		ids := slices.Clone(opts.IDs)
+		slices.Sort(ids)
+		for _, id := range slices.Compact(ids) {
+			file, ok := byID[id]
+			if !ok {
+				result.Missing = append(result.Missing, id)
+				continue
+			}
+			selected = append(selected, file)
+		}
+	}
+	slices.SortFunc(selected, func(a, b File) int { return strings.Compare(a.ID, b.ID) })
+
+	progress := func(done int) {
+		if opts.OnProgress != nil {
+			opts.OnProgress(done, len(selected))
+		}
+	}
+	for i, file := range selected {
+		if file.Folder != nil {
+			if folder, ok := folderIDs[*file.Folder]; ok {
+				file.Folder = &folder
+			} else {
+				file.Folder = nil
+			}
+		}
+		current, replace := existing[file.ID]
+		switch {
+		case replace && current.Filesize == file.Filesize:
+			result.Skipped++
+			progress(i + 1)
+			continue
+		case replace:
+			result.Replaced = append(result.Replaced, file.ID)
+		default:
+			result.Uploaded = append(result.Uploaded, file.ID)
+		}
+		if opts.DryRun {
+			size, _ := file.Filesize.Int64()
+			result.Bytes += size
+			progress(i + 1)
+			continue
+		}
+		n, err := transferFile(ctx, base, target, file, replace)
+		result.Bytes += n
+		if err != nil {
+			return result, fmt.Errorf("failed to copy file %s (%s): %w", file.ID, file.FilenameDownload, err)
+		}
+		progress(i + 1)
+	}
+	return result, nil
+}
+
+// transferFile streams the asset of file from base to target and then sets
+// its remaining properties, returning the number of bytes transferred.
+func transferFile(ctx context.Context, base, target *DirectusClient, file File, replace bool) (n int64, err error) {
+	ctx, done := startOperation(ctx, "transfer file", target.Timeouts.Transfer)
+	defer func() { err = done(err) }()
+
+	asset, err := base.DownloadAsset(ctx, file.ID)
+	if err != nil {
+		return 0, err
+	}
+	defer asset.Close()
+	if n, err = target.UploadFile(ctx, file, asset, replace); err != nil {
+		return n, err
+	}
+
+	properties := withoutKeys(file.Extra, fileReadOnlyKeys)
+	if len(properties) == 0 {
+		return n, nil
+	}
+	return n, target.UpdateFile(ctx, file.ID, properties)
+}
+
+// syncFolders creates the folders of base that are missing on target, matched
+// by path, parents first. It returns the IDs of the target folders by base
+// folder ID.
+func syncFolders(ctx context.Context, base, target *DirectusClient, dryRun bool, counts *ChangeCounts) (map[string]string, error) {
+	baseFolders, err := base.ListFolders(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list base folders: %w", err)
+	}
+	targetFolders, err := target.ListFolders(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target folders: %w", err)
+	}
+	targetByPath := map[string]string{}
+	for id, path := range folderPaths(targetFolders) {
+		targetByPath[path] = id
+	}
+
+	basePaths := folderPaths(baseFolders)
+	slices.SortFunc(baseFolders, func(a, b Folder) int {
+		return cmp.Or(cmp.Compare(strings.Count(basePaths[a.ID], "/"), strings.Count(basePaths[b.ID], "/")),
+			strings.Compare(basePaths[a.ID], basePaths[b.ID]))
+	})
+	folderIDs := map[string]string{}
+	for _, folder := range baseFolders {
+		path := basePaths[folder.ID]
+		if id, ok := targetByPath[path]; ok {
+			folderIDs[folder.ID] = id
+			continue
+		}
+		if folder.Parent != nil {
+			parent := folderIDs[*folder.Parent]
+			folder.Parent = &parent
+		}
+		counts.Created++
+		folderIDs[folder.ID] = folder.ID
+		targetByPath[path] = folder.ID
+		if dryRun {
+			continue
+		}
+		if err := target.CreateFolder(ctx, folder); err != nil {
+			return nil, fmt.Errorf("failed to create folder %s: %w", path, err)
+		}
+	}
+	return folderIDs, nil
+}
+
+// folderPaths returns the slash-separated path of every folder by ID. A
+// folder whose parent is unknown, or part of a cycle, is treated as a root.
+func folderPaths(folders []Folder) map[string]string {
+	byID := map[string]Folder{}
+	for _, folder := range folders {
+		byID[folder.ID] = folder
+	}
+	paths := map[string]string{}
+	var resolve func(id string, depth int) string
+	resolve = func(id string, depth int) string {
+		if path, ok := paths[id]; ok {
+			return path
+		}
+		folder := byID[id]
+		path := folder.Name
+		if folder.Parent != nil && depth < len(folders) {
+			if parent, ok := byID[*folder.Parent]; ok {
+				path = resolve(parent.ID, depth+1) + "/" + folder.Name
+			}
+		}
+		paths[id] = path
+		return path
+	}
+	for _, folder := range folders {
+		resolve(folder.ID, 0)
+	}
+	return paths
+}
+
+// ReferencedFiles returns the IDs of the files the base items of collections
+// reference through their selected many-to-one fields to directus_files,
+// sorted and without duplicates. Files referenced through a junction
+// collection, as by the files interface, are found when the junction
+// collection is selected.
+func ReferencedFiles(ctx context.Context, base *DirectusClient, collections []DataCollection) ([]string, error) {
+	if len(collections) == 0 {
+		return nil, nil
+	}
+	snapshot, err := base.GetSnapshot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get base snapshot: %w", err)
+	}
+	plans, err := planData(snapshot, collections)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, plan := range plans {
+		var fields []string
+		for _, relation := range snapshot.Relations {
+			if relation.Collection == plan.collection && relation.RelatedCollection == "directus_files" && slices.Contains(plan.fields, relation.Field) {
+				fields = append(fields, relation.Field)
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		items, err := base.ListItems(ctx, plan.collection, fields, plan.primaryKey, DefaultDataBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list base items of %s: %w", plan.collection, err)
+		}
+		for _, item := range items {
+			for _, field := range fields {
+				var id *string
+				if json.Unmarshal(item[field], &id) == nil && id != nil {
+					ids = append(ids, *id)
+				}
+			}
+		}
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids), nil
+}
@@ -0,0 +1,214 @@
+package gomirgratedirectus
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// SystemCollectionsPolicy tells a SchemaFilter what to do with the custom
+// fields and relations of the directus_* system collections, such as a field
+// added to directus_users.
+type SystemCollectionsPolicy string
+
+const (
+	// SystemInclude migrates system collections like any other. It is the
+	// default.
+	SystemInclude SystemCollectionsPolicy = "include"
+	// SystemExclude leaves system collections out of the migration.
+	SystemExclude SystemCollectionsPolicy = "exclude"
+	// SystemOnly migrates nothing but system collections.
+	SystemOnly SystemCollectionsPolicy = "only"
+)
+
+// SchemaFilter selects the part of a schema a migration covers. Patterns are
+// exact names or globs in the syntax of path.Match, such as "analytics_*".
+type SchemaFilter struct {
+	// IncludeCollections, if not empty, limits the schema to the
+	// collections matching one of the patterns.
+	IncludeCollections []string
+	// ExcludeCollections removes the collections matching one of the
+	// patterns, even if they are included.
+	ExcludeCollections []string
+	// ExcludeFields removes the fields matching one of the patterns of the
+	// form collection.field, such as "*.updated_by_script", for fields that
+	// intentionally differ between environments.
+	ExcludeFields []string
+	// SystemCollections decides whether the directus_* system collections
+	// are kept; empty means SystemInclude. Collection patterns only apply to
+	// the collections the policy keeps.
+	SystemCollections SystemCollectionsPolicy
+}
+
+// IsZero reports whether the filter keeps the whole schema.
+func (f SchemaFilter) IsZero() bool {
+	return len(f.IncludeCollections) == 0 && len(f.ExcludeCollections) == 0 && len(f.ExcludeFields) == 0 &&
+		(f.SystemCollections == "" || f.SystemCollections == SystemInclude)
+}
+
+// Validate checks that the policy is known and all patterns are well-formed.
+func (f SchemaFilter) Validate() error {
+	switch f.SystemCollections {
+	case "", SystemInclude, SystemExclude, SystemOnly:
+	default:
+		return fmt.Errorf("invalid system collections policy %q, expected include, exclude or only", f.SystemCollections)
+	}
+	for _, patterns := range [][]string{f.IncludeCollections, f.ExcludeCollections} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid collection pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	for _, pattern := range f.ExcludeFields {
+		collection, field, ok := strings.Cut(pattern, ".")
+		if !ok || collection == "" || field == "" {
+			return fmt.Errorf("invalid field pattern %q, expected collection.field", pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid field pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// KeepsCollection reports whether the filter keeps collection, and with it the
+// fields and relations defined on it.
+func (f SchemaFilter) KeepsCollection(collection string) bool {
+	switch system := IsSystemCollection(collection); {
+	case system && f.SystemCollections == SystemExclude:
+		return false
+	case !system && f.SystemCollections == SystemOnly:
+		return false
+	}
+	if len(f.IncludeCollections) > 0 && !matchesAny(f.IncludeCollections, collection) {
+		return false
+	}
+	return !matchesAny(f.ExcludeCollections, collection)
+}
+
+// KeepsField reports whether the filter keeps field of collection, which
+// requires keeping the collection itself.
+func (f SchemaFilter) KeepsField(collection, field string) bool {
+	return f.KeepsCollection(collection) && !matchesAny(f.ExcludeFields, collection+"."+field)
+}
+
+// keepsRelation reports whether both ends of a relation, including the field
+// holding the foreign key, are kept. Relations without a related collection,
+// such as the many-to-any side, only depend on their own field. System
+// collections exist on every instance, so relations to them are kept even
+// when they are filtered, such as a user collection referencing
+// directus_users.
+func (f SchemaFilter) keepsRelation(collection, field, related string) bool {
+	return f.KeepsField(collection, field) && f.keepsRelated(related)
+}
+
+func (f SchemaFilter) keepsRelated(related string) bool {
+	return related == "" || IsSystemCollection(related) || f.KeepsCollection(related)
+}
+
+// matchesAny reports whether name matches one of patterns. Invalid patterns,
+// which Validate reports, never match.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// FilteredSnapshot is the result of FilterSnapshot.
+type FilteredSnapshot struct {
+	// Snapshot holds the kept collections with their fields and relations.
+	Snapshot *Snapshot
+	// ExcludedCollections lists the collections that were removed.
+	ExcludedCollections []string
+	// ExcludedFields lists, as collection.field, the fields removed by
+	// SchemaFilter.ExcludeFields. Fields of removed collections are not
+	// included.
+	ExcludedFields []string
+	// DroppedRelations lists the relations between a kept and a removed
+	// collection or field. They are dropped because Directus cannot create a
+	// relation to an item it does not know, while whatever is kept of them
+	// stays.
+	DroppedRelations []Relation
+}
+
+// FilterSnapshot returns a copy of snapshot without the collections and
+// fields filter removes and the relations touching them. snapshot itself is
+// not modified.
+func FilterSnapshot(snapshot *Snapshot, filter SchemaFilter) *FilteredSnapshot {
+	filtered := *snapshot
+	filtered.Collections = []Collection{}
+	filtered.Fields = []Field{}
+	filtered.Relations = []Relation{}
+	result := &FilteredSnapshot{Snapshot: &filtered}
+
+	for _, collection := range snapshot.Collections {
+		if filter.KeepsCollection(collection.Collection) {
+			filtered.Collections = append(filtered.Collections, collection)
+		} else {
+			result.ExcludedCollections = append(result.ExcludedCollections, collection.Collection)
+		}
+	}
+	for _, field := range snapshot.Fields {
+		switch {
+		case filter.KeepsField(field.Collection, field.Field):
+			filtered.Fields = append(filtered.Fields, field)
+		case filter.KeepsCollection(field.Collection):
+			result.ExcludedFields = append(result.ExcludedFields, field.Collection+"."+field.Field)
+		}
+	}
+	for _, relation := range snapshot.Relations {
+		switch {
+		case filter.keepsRelation(relation.Collection, relation.Field, relation.RelatedCollection):
+			filtered.Relations = append(filtered.Relations, relation)
+		case filter.KeepsField(relation.Collection, relation.Field) ||
+			(relation.RelatedCollection != "" && filter.KeepsCollection(relation.RelatedCollection)):
+			result.DroppedRelations = append(result.DroppedRelations, relation)
+		}
+	}
+	return result
+}
+
+// FilteredDiff is the result of FilterDiff.
+type FilteredDiff struct {
+	// Diff holds the changes to the kept collections and fields.
+	Diff *Diff
+	// ExcludedFields lists, as collection.field, the fields whose changes
+	// were removed by SchemaFilter.ExcludeFields.
+	ExcludedFields []string
+}
+
+// FilterDiff returns a copy of diff without the changes to the collections
+// and fields filter removes. Directus diffs against the whole target, so
+// without it the items left out of the base snapshot would be deleted. The
+// hash is kept: Directus checks it against the target, not against the diff.
+func FilterDiff(diff *Diff, filter SchemaFilter) *FilteredDiff {
+	filtered := *diff
+	result := &FilteredDiff{Diff: &filtered}
+	filtered.Diff.Collections = []CollectionDiff{}
+	filtered.Diff.Fields = []FieldDiff{}
+	filtered.Diff.Relations = []RelationDiff{}
+
+	for _, item := range diff.Diff.Collections {
+		if filter.KeepsCollection(item.Collection) {
+			filtered.Diff.Collections = append(filtered.Diff.Collections, item)
+		}
+	}
+	for _, item := range diff.Diff.Fields {
+		switch {
+		case filter.KeepsField(item.Collection, item.Field):
+			filtered.Diff.Fields = append(filtered.Diff.Fields, item)
+		case filter.KeepsCollection(item.Collection):
+			result.ExcludedFields = append(result.ExcludedFields, item.Collection+"."+item.Field)
+		}
+	}
+	for _, item := range diff.Diff.Relations {
+		if filter.keepsRelation(item.Collection, item.Field, item.RelatedCollection) {
+			filtered.Diff.Relations = append(filtered.Diff.Relations, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,219 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// analyticsSnapshot returns the snapshot of testdata/models with two
+// analytics collections, one of them related to articles both ways.
+func analyticsSnapshot(t *testing.T) *gomigratedirectus.Snapshot {
+	t.Helper()
+	s, err := gomigratedirectus.LoadSnapshot(filepath.Join("testdata", "models", "snapshot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"analytics_events", "analytics_daily"} {
+		s.Collections = append(s.Collections, gomigratedirectus.Collection{Collection: name,
+			Meta: map[string]any{"collection": name}, Schema: map[string]any{"name": name}})
+		s.Fields = append(s.Fields, gomigratedirectus.Field{Collection: name, Field: "id", Type: "integer",
+			Meta: map[string]any{}, Schema: map[string]any{"is_primary_key": true, "is_nullable": false}})
+	}
+	s.Fields = append(s.Fields,
+		gomigratedirectus.Field{Collection: "analytics_events", Field: "article", Type: "uuid",
+			Meta: map[string]any{}, Schema: map[string]any{"is_nullable": true}},
+		gomigratedirectus.Field{Collection: "articles", Field: "top_event", Type: "integer",
+			Meta: map[string]any{}, Schema: map[string]any{"is_nullable": true}})
+	s.Relations = append(s.Relations,
+		gomigratedirectus.Relation{Collection: "analytics_events", Field: "article", RelatedCollection: "articles",
+			Meta: map[string]any{}, Schema: map[string]any{"on_delete": "SET NULL"}},
+		gomigratedirectus.Relation{Collection: "articles", Field: "top_event", RelatedCollection: "analytics_events",
+			Meta: map[string]any{}, Schema: map[string]any{"on_delete": "SET NULL"}})
+	return s
+}
+
+// snapshotKeys returns the collections, collection.field of the fields and
+// collection.field->related of the relations of s, sorted.
+func snapshotKeys(s *gomigratedirectus.Snapshot) (collections, fields, relations []string) {
+	for _, c := range s.Collections {
+		collections = append(collections, c.Collection)
+	}
+	for _, f := range s.Fields {
+		fields = append(fields, f.Collection+"."+f.Field)
+	}
+	for _, r := range s.Relations {
+		relations = append(relations, r.Collection+"."+r.Field+"->"+r.RelatedCollection)
+	}
+	slices.Sort(collections)
+	slices.Sort(fields)
+	slices.Sort(relations)
+	return collections, fields, relations
+}
+
+// created returns an entry creating v, as in a diff of a new item.
+func created(t *testing.T, v any) []gomigratedirectus.DiffEntry {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []gomigratedirectus.DiffEntry{{Kind: "N", Rhs: data}}
+}
+
+func TestMigrateFilterDiffRequest(t *testing.T) {
+	s := analyticsSnapshot(t)
+	for _, tt := range []struct {
+		name    string
+		opts    gomigratedirectus.MigrationOptions
+		dropped []string
+	}{
+		{"exclude", gomigratedirectus.MigrationOptions{ExcludeCollections: []string{"analytics_*"}},
+			[]string{"analytics_events.article->articles", "articles.top_event->analytics_events"}},
+		{"include", gomigratedirectus.MigrationOptions{IncludeCollections: []string{"articles", "authors", "tags", "articles_tags"}},
+			[]string{"analytics_events.article->articles", "articles.top_event->analytics_events"}},
+		{"include and exclude", gomigratedirectus.MigrationOptions{
+			IncludeCollections: []string{"a*", "tags"}, ExcludeCollections: []string{"analytics_*"}},
+			[]string{"analytics_events.article->articles", "articles.top_event->analytics_events"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			info := gomigratedirectus.ServerInfo{Version: s.Directus, Vendor: s.Vendor}
+			base, target := directustest.NewServer(t), directustest.NewServer(t)
+			base.SetSnapshot(s)
+			base.SetServerInfo(info)
+			target.SetServerInfo(info)
+			// The target reports every collection missing, analytics
+			// included, as Directus diffs against the whole snapshot sent.
+			diff := &gomigratedirectus.Diff{Hash: "hash"}
+			for _, c := range s.Collections {
+				diff.Diff.Collections = append(diff.Diff.Collections,
+					gomigratedirectus.CollectionDiff{Collection: c.Collection, Diff: created(t, c)})
+			}
+			target.SetDiff(diff)
+
+			var filtered *gomigratedirectus.SnapshotFiltered
+			opts := tt.opts
+			opts.VerifyAfterApply = gomigratedirectus.VerifyOff
+			opts.OnEvent = func(e gomigratedirectus.Event) {
+				if e, ok := e.(*gomigratedirectus.SnapshotFiltered); ok {
+					filtered = e
+				}
+			}
+			if _, err := gomigratedirectus.MigrateWithOptions(context.Background(), base.Client(quiet()...), target.Client(quiet()...), opts); err != nil {
+				t.Fatalf("MigrateWithOptions: %v", err)
+			}
+
+			filter := gomigratedirectus.SchemaFilter{IncludeCollections: tt.opts.IncludeCollections, ExcludeCollections: tt.opts.ExcludeCollections}
+			// No diff request, the one of the undo record included, holds a
+			// filtered collection, its fields or the relations touching it.
+			requests := target.DiffRequests()
+			if len(requests) == 0 {
+				t.Fatal("target received no diff request")
+			}
+			for _, request := range requests {
+				collections, fields, relations := snapshotKeys(request)
+				for _, c := range collections {
+					if !filter.KeepsCollection(c) {
+						t.Errorf("diff request holds the filtered collection %s", c)
+					}
+				}
+				for _, f := range fields {
+					if c, _, _ := strings.Cut(f, "."); !filter.KeepsCollection(c) {
+						t.Errorf("diff request holds the field %s of a filtered collection", f)
+					}
+				}
+				for _, r := range relations {
+					if slices.Contains(tt.dropped, r) {
+						t.Errorf("diff request holds the relation %s to a filtered collection", r)
+					}
+				}
+			}
+			// Everything the filter keeps is sent.
+			collections, fields, relations := snapshotKeys(requests[0])
+			wantCollections, wantFields, wantRelations := snapshotKeys(gomigratedirectus.FilterSnapshot(s, filter).Snapshot)
+			if !slices.Equal(collections, wantCollections) || !slices.Equal(fields, wantFields) || !slices.Equal(relations, wantRelations) {
+				t.Errorf("diff request holds %v, %v, %v, want %v, %v, %v", collections, fields, relations, wantCollections, wantFields, wantRelations)
+			}
+			if slices.ContainsFunc(collections, func(c string) bool { return strings.HasPrefix(c, "analytics_") }) {
+				t.Errorf("diff request holds analytics collections: %v", collections)
+			}
+
+			if filtered == nil {
+				t.Fatal("no SnapshotFiltered event")
+			}
+			var dropped []string
+			for _, r := range filtered.DroppedRelations {
+				dropped = append(dropped, r.Collection+"."+r.Field+"->"+r.RelatedCollection)
+			}
+			slices.Sort(dropped)
+			if !slices.Equal(dropped, tt.dropped) {
+				t.Errorf("dropped relations = %v, want %v", dropped, tt.dropped)
+			}
+
+			// Nor are the filtered collections applied.
+			for _, applied := range target.ApplyRequests() {
+				for _, c := range applied.Diff.Collections {
+					if !filter.KeepsCollection(c.Collection) {
+						t.Errorf("apply request creates the filtered collection %s", c.Collection)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateSystemCollections(t *testing.T) {
+	s, err := gomigratedirectus.LoadSnapshot(filepath.Join("testdata", "system", "snapshot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		policy                         gomigratedirectus.SystemCollectionsPolicy
+		collections, fields, relations []string
+	}{
+		{gomigratedirectus.SystemInclude,
+			[]string{"articles", "departments"},
+			[]string{"articles.id", "articles.owner", "departments.id", "departments.name",
+				"directus_files.credit", "directus_users.department", "directus_users.nickname"},
+			[]string{"articles.owner->directus_users", "directus_users.department->departments"}},
+		// Relations to system collections are kept, as those exist on every
+		// instance.
+		{gomigratedirectus.SystemExclude,
+			[]string{"articles", "departments"},
+			[]string{"articles.id", "articles.owner", "departments.id", "departments.name"},
+			[]string{"articles.owner->directus_users"}},
+		{gomigratedirectus.SystemOnly,
+			nil,
+			[]string{"directus_files.credit", "directus_users.department", "directus_users.nickname"},
+			nil},
+	} {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			info := gomigratedirectus.ServerInfo{Version: s.Directus, Vendor: s.Vendor}
+			base, target := directustest.NewServer(t), directustest.NewServer(t)
+			base.SetSnapshot(s)
+			base.SetServerInfo(info)
+			target.SetServerInfo(info)
+			_, err := gomigratedirectus.MigrateWithOptions(context.Background(), base.Client(quiet()...), target.Client(quiet()...),
+				gomigratedirectus.MigrationOptions{SystemCollections: tt.policy, DryRun: true})
+			if err != nil {
+				t.Fatalf("MigrateWithOptions: %v", err)
+			}
+			requests := target.DiffRequests()
+			if len(requests) != 1 {
+				t.Fatalf("target received %d diff requests, want 1", len(requests))
+			}
+			collections, fields, relations := snapshotKeys(requests[0])
+			if !slices.Equal(collections, tt.collections) || !slices.Equal(fields, tt.fields) || !slices.Equal(relations, tt.relations) {
+				t.Errorf("diff request holds\n%v\n%v\n%v\nwant\n%v\n%v\n%v", collections, fields, relations, tt.collections, tt.fields, tt.relations)
+			}
+		})
+	}
+}
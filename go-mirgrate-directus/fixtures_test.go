@@ -0,0 +1,110 @@
+package gomirgratedirectus_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files under testdata")
+
+// golden compares got with the golden file testdata/name, rewriting it
+// instead with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v; run go test -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file; run go test -update if the change is intended\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// fixtureServer answers /schema/snapshot and /schema/diff with the raw
+// response bodies of f.
+func fixtureServer(t *testing.T, f *directustest.Fixture) *gomigratedirectus.DirectusClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		switch r.URL.Path {
+		case "/schema/snapshot":
+			w.Write(f.SnapshotBody)
+		case "/schema/diff":
+			w.Write(f.DiffBody)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return gomigratedirectus.NewDirectusClient(server.URL, "token", quiet()...)
+}
+
+func TestFixtures(t *testing.T) {
+	versions := directustest.FixtureVersions()
+	if len(versions) == 0 {
+		t.Fatal("no fixtures")
+	}
+	for _, version := range versions {
+		t.Run(version, func(t *testing.T) {
+			f, err := directustest.LoadFixture(version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			client := fixtureServer(t, f)
+
+			snapshot, err := client.GetSnapshot(ctx)
+			if err != nil {
+				t.Fatalf("GetSnapshot: %v", err)
+			}
+			golden(t, filepath.Join("fixtures", version, "snapshot.golden"), indent(t, snapshot))
+
+			diff, err := client.GetDiff(ctx, snapshot, false)
+			if err != nil {
+				t.Fatalf("GetDiff: %v", err)
+			}
+			golden(t, filepath.Join("fixtures", version, "diff.golden"), indent(t, diff))
+
+			summary := gomigratedirectus.SummarizeDiff(diff)
+			golden(t, filepath.Join("fixtures", version, "summary.golden"),
+				fmt.Appendf(indent(t, summary), "%s\n", summary))
+
+			var rendered bytes.Buffer
+			if err := gomigratedirectus.RenderDiff(diff, &rendered); err != nil {
+				t.Fatalf("RenderDiff: %v", err)
+			}
+			golden(t, filepath.Join("fixtures", version, "render.golden"), rendered.Bytes())
+		})
+	}
+}
+
+// indent returns v as indented JSON ending with a newline.
+func indent(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(b, '\n')
+}
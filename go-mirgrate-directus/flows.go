@@ -0,0 +1,523 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// FlowStatusInactive is the status of a deactivated flow.
+const FlowStatusInactive = "inactive"
+
+// Flow is a Directus flow with its operations, as listed by
+// /flows?fields=*,operations.*. Operation points to the operation the flow
+// starts with. Extra holds the remaining properties, such as trigger, options
+// and accountability.
+type Flow struct {
+	ID         string      `json:"id,omitempty"`
+	Name       string      `json:"name"`
+	Status     string      `json:"status,omitempty"`
+	Operation  *string     `json:"operation"`
+	Operations []Operation `json:"operations,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Operation is an operation of a flow. Key identifies it within its flow, and
+// Resolve and Reject point to the operations that run next. Extra holds the
+// remaining properties, such as name and position_x.
+type Operation struct {
+	ID      string          `json:"id,omitempty"`
+	Key     string          `json:"key"`
+	Type    string          `json:"type"`
+	Flow    string          `json:"flow,omitempty"`
+	Resolve *string         `json:"resolve"`
+	Reject  *string         `json:"reject"`
+	Options json.RawMessage `json:"options"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (f Flow) MarshalJSON() ([]byte, error) {
+	type plain Flow
+	return marshalWithExtra(plain(f), f.Extra)
+}
+
+func (f *Flow) UnmarshalJSON(data []byte) error {
+	type plain Flow
+	return unmarshalWithExtra(data, (*plain)(f), &f.Extra)
+}
+
+func (o Operation) MarshalJSON() ([]byte, error) {
+	type plain Operation
+	return marshalWithExtra(plain(o), o.Extra)
+}
+
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	type plain Operation
+	return unmarshalWithExtra(data, (*plain)(o), &o.Extra)
+}
+
+// flowReadOnlyKeys are the flow and operation properties Directus maintains
+// itself, which are neither copied nor compared.
+var flowReadOnlyKeys = []string{"date_created", "user_created"}
+
+// ListFlows returns all flows of the project with their operations.
+func (c *DirectusClient) ListFlows(ctx context.Context) (_ []Flow, err error) {
+	ctx, done := startOperation(ctx, "list flows", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var flows []Flow
+	query := url.Values{"fields": {"*,operations.*"}, "limit": {"-1"}}
+	if err := c.doJSON(ctx, "list flows", http.MethodGet, "/flows", query, nil, &flows); err != nil {
+		return nil, err
+	}
+	return flows, nil
+}
+
+// CreateFlow creates flow without its operations. Unlike roles, flows keep
+// their ID, so that a flow created by SyncFlows is matched by ID from then on.
+func (c *DirectusClient) CreateFlow(ctx context.Context, flow Flow) (err error) {
+	ctx, done := startOperation(ctx, "create flow", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	flow.Operations = nil
+	return c.doJSON(ctx, "create flow", http.MethodPost, "/flows", nil, flow, nil)
+}
+
+// UpdateFlow replaces the properties of the flow with the given ID with those
+// of flow, without touching its operations.
+func (c *DirectusClient) UpdateFlow(ctx context.Context, id string, flow Flow) (err error) {
+	ctx, done := startOperation(ctx, "update flow", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	flow.ID, flow.Operations = "", nil
+	return c.doJSON(ctx, "update flow", http.MethodPatch, "/flows/"+url.PathEscape(id), nil, flow, nil)
+}
+
+// DeleteFlow deletes the flow with the given ID and its operations.
+func (c *DirectusClient) DeleteFlow(ctx context.Context, id string) (err error) {
+	ctx, done := startOperation(ctx, "delete flow", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "delete flow", http.MethodDelete, "/flows/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// CreateOperation creates operation, ignoring its ID, and returns the created
+// operation.
+func (c *DirectusClient) CreateOperation(ctx context.Context, operation Operation) (_ *Operation, err error) {
+	ctx, done := startOperation(ctx, "create operation", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	operation.ID = ""
+	var created Operation
+	if err := c.doJSON(ctx, "create operation", http.MethodPost, "/operations", nil, operation, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateOperation replaces the properties of the operation with the given ID
+// with those of operation.
+func (c *DirectusClient) UpdateOperation(ctx context.Context, id string, operation Operation) (err error) {
+	ctx, done := startOperation(ctx, "update operation", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	operation.ID = ""
+	return c.doJSON(ctx, "update operation", http.MethodPatch, "/operations/"+url.PathEscape(id), nil, operation, nil)
+}
+
+// DeleteOperation deletes the operation with the given ID.
+func (c *DirectusClient) DeleteOperation(ctx context.Context, id string) (err error) {
+	ctx, done := startOperation(ctx, "delete operation", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "delete operation", http.MethodDelete, "/operations/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// FlowSyncOptions configures SyncFlows.
+type FlowSyncOptions struct {
+	// DryRun only computes the changes; nothing is written.
+	DryRun bool
+	// Prune deletes the inactive flows of the target that the base does not
+	// have. Active flows are never deleted.
+	Prune bool
+	// Secrets maps strings in the operation options of the base, such as
+	// webhook URLs and tokens, to their replacement on the target. Every
+	// occurrence in a string option is replaced, longer strings first.
+	Secrets map[string]string
+	// KeepOptions leaves the options of operations that already exist on the
+	// target untouched, so that secrets configured there survive the sync;
+	// only new operations get the options of the base.
+	KeepOptions bool
+}
+
+// FlowResult describes what SyncFlows did for one flow.
+type FlowResult struct {
+	// Flow is the flow name.
+	Flow string `json:"flow"`
+	// Created and Updated tell whether the flow itself was created on or
+	// updated in the target, including its entry operation.
+	Created bool `json:"created,omitempty"`
+	Updated bool `json:"updated,omitempty"`
+	// Operations counts the operations created, updated and deleted.
+	Operations ChangeCounts `json:"operations"`
+}
+
+// Changed reports whether anything changed for the flow.
+func (r FlowResult) Changed() bool {
+	return r.Created || r.Updated || r.Operations.Total() > 0
+}
+
+// FlowsResult is the result of SyncFlows.
+type FlowsResult struct {
+	// Flows lists the flows of the base, sorted by name.
+	Flows []FlowResult `json:"flows"`
+	// Pruned lists the inactive target flows deleted with
+	// FlowSyncOptions.Prune.
+	Pruned []string `json:"pruned,omitempty"`
+	// DryRun reports that the changes were only computed.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Changed reports whether any flow or operation changed.
+func (r *FlowsResult) Changed() bool {
+	return slices.ContainsFunc(r.Flows, FlowResult.Changed) || len(r.Pruned) > 0
+}
+
+// SyncFlows copies the flows of base, with their operations, to target.
+// Flows are matched by ID, which flows created by SyncFlows share with the
+// base, and otherwise by name; missing flows are created and differing ones
+// updated. Operations are matched by key within their flow: missing ones are
+// created, differing ones updated and ones the base does not have deleted.
+// Since operations get new IDs on the target, the resolve and reject links
+// between them, the entry operation of the flow and the flow called by a
+// trigger operation are remapped to the target IDs.
+//
+// Flows that only exist on the target are left alone unless opts.Prune is
+// set and they are inactive.
+func SyncFlows(ctx context.Context, base, target *DirectusClient, opts FlowSyncOptions) (*FlowsResult, error) {
+	baseFlows, err := base.ListFlows(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list base flows: %w", err)
+	}
+	targetFlows, err := target.ListFlows(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target flows: %w", err)
+	}
+	slices.SortFunc(baseFlows, func(a, b Flow) int { return strings.Compare(a.Name, b.Name) })
+
+	result := &FlowsResult{DryRun: opts.DryRun}
+	s := &flowSync{target: target, opts: opts, flowIDs: map[string]string{}, secrets: substitutionReplacer(opts.Secrets)}
+
+	// Every flow has to exist before operations are synced, since trigger
+	// operations may call any of them.
+	matched := make([]*Flow, len(baseFlows))
+	used := map[string]bool{}
+	for i, flow := range baseFlows {
+		matched[i] = matchFlow(flow, targetFlows, used)
+		if matched[i] != nil {
+			used[matched[i].ID] = true
+			s.flowIDs[flow.ID] = matched[i].ID
+			continue
+		}
+		if !opts.DryRun {
+			created := flow
+			created.Operation = nil
+			created.Extra = withoutKeys(flow.Extra, flowReadOnlyKeys)
+			if err := target.CreateFlow(ctx, created); err != nil {
+				return result, fmt.Errorf("failed to create flow %s: %w", flow.Name, err)
+			}
+		}
+		s.flowIDs[flow.ID] = flow.ID
+	}
+
+	for i, flow := range baseFlows {
+		flowResult := FlowResult{Flow: flow.Name, Created: matched[i] == nil}
+		err := s.syncFlow(ctx, flow, matched[i], &flowResult)
+		result.Flows = append(result.Flows, flowResult)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if opts.Prune {
+		for _, flow := range targetFlows {
+			if used[flow.ID] || flow.Status != FlowStatusInactive {
+				continue
+			}
+			result.Pruned = append(result.Pruned, flow.Name)
+			if !opts.DryRun {
+				if err := target.DeleteFlow(ctx, flow.ID); err != nil {
+					return result, fmt.Errorf("failed to delete flow %s: %w", flow.Name, err)
+				}
+			}
+		}
+		slices.Sort(result.Pruned)
+	}
+	return result, nil
+}
+
+// matchFlow returns the target flow flow is synced to, by ID and otherwise by
+// name, skipping the flows already used by another base flow.
+func matchFlow(flow Flow, targetFlows []Flow, used map[string]bool) *Flow {
+	for i := range targetFlows {
+		if targetFlows[i].ID == flow.ID && !used[flow.ID] {
+			return &targetFlows[i]
+		}
+	}
+	for i := range targetFlows {
+		if targetFlows[i].Name == flow.Name && !used[targetFlows[i].ID] {
+			return &targetFlows[i]
+		}
+	}
+	return nil
+}
+
+// flowSync holds the state of one SyncFlows run.
+type flowSync struct {
+	target  *DirectusClient
+	opts    FlowSyncOptions
+	secrets *strings.Replacer
+	// flowIDs maps base flow IDs to target flow IDs.
+	flowIDs map[string]string
+}
+
+// syncFlow syncs the operations of flow to existing, the matching target flow
+// or nil if it was just created, and then fixes up the flow itself.
+func (s *flowSync) syncFlow(ctx context.Context, flow Flow, existing *Flow, result *FlowResult) error {
+	targetID := s.flowIDs[flow.ID]
+	var have []Operation
+	if existing != nil {
+		have = existing.Operations
+	}
+	operationIDs, err := s.syncOperations(ctx, flow, targetID, have, &result.Operations)
+	if err != nil {
+		return err
+	}
+
+	want := flow
+	want.ID, want.Operations = "", nil
+	want.Operation = mapID(flow.Operation, operationIDs)
+	want.Extra = withoutKeys(flow.Extra, flowReadOnlyKeys)
+	if existing == nil {
+		if want.Operation == nil || s.opts.DryRun {
+			return nil
+		}
+	} else {
+		current := *existing
+		current.Operations = nil
+		current.Extra = withoutKeys(existing.Extra, flowReadOnlyKeys)
+		if sameExceptID(want, current) {
+			return nil
+		}
+		result.Updated = true
+		if s.opts.DryRun {
+			return nil
+		}
+	}
+	if err := s.target.UpdateFlow(ctx, targetID, want); err != nil {
+		return fmt.Errorf("failed to update flow %s: %w", flow.Name, err)
+	}
+	return nil
+}
+
+// syncOperations makes the operations of the target flow with the ID targetID,
+// currently have, match those of flow and returns the target operation IDs by
+// base operation ID. A target operation row may only be the resolve or reject
+// of one other operation, so links are cleared before they are moved: first
+// stale operations are deleted, then the others are created or updated with
+// changed links cleared, and finally the links are set.
+func (s *flowSync) syncOperations(ctx context.Context, flow Flow, targetID string, have []Operation, counts *ChangeCounts) (map[string]string, error) {
+	operations := slices.Clone(flow.Operations)
+	slices.SortFunc(operations, func(a, b Operation) int { return strings.Compare(a.Key, b.Key) })
+
+	existing := indexByName(have, func(o Operation) string { return o.Key })
+	operationIDs := map[string]string{}
+	for _, operation := range operations {
+		if current, ok := existing[operation.Key]; ok {
+			operationIDs[operation.ID] = current.ID
+		}
+	}
+
+	for _, current := range have {
+		if slices.ContainsFunc(operations, func(o Operation) bool { return o.Key == current.Key }) {
+			continue
+		}
+		counts.Deleted++
+		if !s.opts.DryRun {
+			if err := s.target.DeleteOperation(ctx, current.ID); err != nil {
+				return nil, fmt.Errorf("failed to delete operation %s of flow %s: %w", current.Key, flow.Name, err)
+			}
+		}
+	}
+
+	var relink []Operation
+	for _, operation := range operations {
+		want, err := s.operation(operation, targetID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to map options of operation %s of flow %s: %w", operation.Key, flow.Name, err)
+		}
+		want.Resolve = mapID(operation.Resolve, operationIDs)
+		want.Reject = mapID(operation.Reject, operationIDs)
+		// Links to operations that do not exist yet map to nil and are
+		// always set afterwards.
+		linked := (operation.Resolve == nil || want.Resolve != nil) && (operation.Reject == nil || want.Reject != nil)
+
+		current, ok := existing[operation.Key]
+		if !ok {
+			counts.Created++
+			if operation.Resolve != nil || operation.Reject != nil {
+				relink = append(relink, operation)
+			}
+			if s.opts.DryRun {
+				continue
+			}
+			want.Resolve, want.Reject = nil, nil
+			created, err := s.target.CreateOperation(ctx, want)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create operation %s of flow %s: %w", operation.Key, flow.Name, err)
+			}
+			operationIDs[operation.ID] = created.ID
+			continue
+		}
+
+		if s.opts.KeepOptions {
+			want.Options = current.Options
+		}
+		current.Flow = targetID
+		current.Extra = withoutKeys(current.Extra, flowReadOnlyKeys)
+		relinked := !linked || !sameID(want.Resolve, current.Resolve) || !sameID(want.Reject, current.Reject)
+		if relinked {
+			relink = append(relink, operation)
+			want.Resolve, want.Reject = nil, nil
+		}
+		if sameExceptID(want, current) && !relinked {
+			continue
+		}
+		counts.Updated++
+		if s.opts.DryRun {
+			continue
+		}
+		if err := s.target.UpdateOperation(ctx, current.ID, want); err != nil {
+			return nil, fmt.Errorf("failed to update operation %s of flow %s: %w", operation.Key, flow.Name, err)
+		}
+	}
+
+	if s.opts.DryRun {
+		return operationIDs, nil
+	}
+	for _, operation := range relink {
+		want, err := s.operation(operation, targetID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to map options of operation %s of flow %s: %w", operation.Key, flow.Name, err)
+		}
+		if s.opts.KeepOptions {
+			if current, ok := existing[operation.Key]; ok {
+				want.Options = current.Options
+			}
+		}
+		want.Resolve = mapID(operation.Resolve, operationIDs)
+		want.Reject = mapID(operation.Reject, operationIDs)
+		if err := s.target.UpdateOperation(ctx, operationIDs[operation.ID], want); err != nil {
+			return nil, fmt.Errorf("failed to link operation %s of flow %s: %w", operation.Key, flow.Name, err)
+		}
+	}
+	return operationIDs, nil
+}
+
+// operation returns operation as it is written to the target flow with the
+// ID flowID, with its secrets substituted and the flow a trigger operation
+// calls remapped. Its links still point to base IDs.
+func (s *flowSync) operation(operation Operation, flowID string) (Operation, error) {
+	operation.ID, operation.Flow = "", flowID
+	operation.Extra = withoutKeys(operation.Extra, flowReadOnlyKeys)
+	if len(operation.Options) == 0 {
+		return operation, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(operation.Options))
+	decoder.UseNumber()
+	var options any
+	if err := decoder.Decode(&options); err != nil {
+		return operation, err
+	}
+	if s.secrets != nil {
+		options = replaceStrings(options, s.secrets)
+	}
+	if m, ok := options.(map[string]any); ok && operation.Type == "trigger" {
+		if id, ok := m["flow"].(string); ok && s.flowIDs[id] != "" {
+			m["flow"] = s.flowIDs[id]
+		}
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return operation, err
+	}
+	operation.Options = data
+	return operation, nil
+}
+
+// mapID returns the ID id maps to in ids, or nil if id is nil or unknown.
+func mapID(id *string, ids map[string]string) *string {
+	if id == nil {
+		return nil
+	}
+	mapped, ok := ids[*id]
+	if !ok || mapped == "" {
+		return nil
+	}
+	return &mapped
+}
+
+// substitutionReplacer returns a replacer for substitutions, a map of
+// strings to their replacements, that tries longer strings first, or nil if
+// there are none.
+func substitutionReplacer(substitutions map[string]string) *strings.Replacer {
+	if len(substitutions) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(substitutions))
+	for key := range substitutions {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		if len(a) != len(b) {
+			return len(b) - len(a)
+		}
+		return strings.Compare(a, b)
+	})
+	pairs := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key, substitutions[key])
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// replaceStrings applies replacer to every string value in v, a decoded JSON
+// value, in place where possible.
+func replaceStrings(v any, replacer *strings.Replacer) any {
+	switch v := v.(type) {
+	case string:
+		return replacer.Replace(v)
+	case []any:
+		for i, item := range v {
+			v[i] = replaceStrings(item, replacer)
+		}
+		return v
+	case map[string]any:
+		for key, item := range v {
+			v[key] = replaceStrings(item, replacer)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,300 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// GoOptions configures GenerateGo.
+type GoOptions struct {
+	// Package is the package clause of the generated file, "models" by
+	// default.
+	Package string
+	// NestedRelations types many-to-one fields as a pointer to the struct
+	// of the related collection, for items read with its fields expanded,
+	// instead of as the type of its primary key.
+	NestedRelations bool
+}
+
+// goFieldTypes maps Directus field types to Go types. Dates and times
+// without a time zone are strings, as time.Time only decodes RFC 3339, and
+// so are decimals, which Directus returns as strings to keep their
+// precision.
+var goFieldTypes = map[string]string{
+	"string":     "string",
+	"text":       "string",
+	"uuid":       "string",
+	"hash":       "string",
+	"binary":     "string",
+	"date":       "string",
+	"dateTime":   "string",
+	"time":       "string",
+	"decimal":    "string",
+	"timestamp":  "time.Time",
+	"integer":    "int64",
+	"bigInteger": "int64",
+	"float":      "float64",
+	"boolean":    "bool",
+	"csv":        "[]string",
+	"json":       "json.RawMessage",
+	"geometry":   "json.RawMessage",
+}
+
+// goInitialisms are the words of a name written in capitals in Go.
+var goInitialisms = map[string]bool{
+	"api": true, "css": true, "html": true, "http": true, "https": true, "id": true, "ip": true,
+	"json": true, "sql": true, "ssh": true, "uri": true, "url": true, "uuid": true, "xml": true,
+}
+
+// GenerateGo returns a gofmt-formatted Go file declaring a struct per
+// collection of snapshot, with a field per column tagged with its name for
+// encoding/json. Nullable columns are pointers, except for slices and
+// json.RawMessage which are nil already. Alias fields such as one-to-many
+// relations have no column and are left out, as are collections without a
+// table such as folders. Many-to-one fields take the type of the primary key
+// of the related collection, or a pointer to its struct with
+// NestedRelations. Collections and fields are sorted by name, primary key
+// first, so that the output only changes with the schema.
+func GenerateGo(snapshot *Snapshot, opts GoOptions) ([]byte, error) {
+	if snapshot == nil {
+		return nil, fmt.Errorf("cannot generate code for a nil snapshot")
+	}
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "models"
+	}
+	if !token.IsIdentifier(pkg) {
+		return nil, fmt.Errorf("invalid package name %q", pkg)
+	}
+
+	model := newSchemaModel(snapshot)
+	collections := model.collections
+	structNames := exportedNames(collections, func(c Collection) string { return c.Collection })
+
+	var body bytes.Buffer
+	imports := map[string]bool{}
+	for i, collection := range collections {
+		var columns []Field
+		for _, field := range model.fields[collection.Collection] {
+			if hasColumn(field) {
+				columns = append(columns, field)
+			}
+		}
+		fieldNames := exportedNames(columns, func(f Field) string { return f.Field })
+
+		name := structNames[i]
+		fmt.Fprintf(&body, "\n// %s is an item of the %s collection.", name, collection.Collection)
+		if note := noteComment(collection.Meta["note"]); note != "" {
+			fmt.Fprintf(&body, "\n//\n// %s", note)
+		}
+		fmt.Fprintf(&body, "\ntype %s struct {\n", name)
+		for j, field := range columns {
+			typ := goFieldType(field)
+			if target, ok := model.related[field.Collection+"."+field.Field]; ok {
+				k := model.index(target)
+				if k >= 0 && opts.NestedRelations {
+					typ = "*" + structNames[k]
+				} else if key, ok := model.primaryKeys[target]; ok {
+					typ = goFieldType(key)
+				}
+			}
+			if nullable, _ := field.Schema["is_nullable"].(bool); nullable && !isPrimaryKeyField(field) &&
+				!strings.HasPrefix(typ, "*") && !strings.HasPrefix(typ, "[]") && typ != "json.RawMessage" {
+				typ = "*" + typ
+			}
+			switch {
+			case strings.Contains(typ, "time."):
+				imports["time"] = true
+			case strings.Contains(typ, "json."):
+				imports["encoding/json"] = true
+			}
+			if note := noteComment(field.Meta["note"]); note != "" {
+				fmt.Fprintf(&body, "// %s\n", note)
+			}
+			fmt.Fprintf(&body, "%s %s `json:%q`\n", fieldNames[j], typ, field.Field)
+		}
+		body.WriteString("}\n")
+	}
+
+	var src bytes.Buffer
+	src.WriteString("// Code generated by go-mirgrate-directus from a Directus schema snapshot. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n", pkg)
+	if len(imports) > 0 {
+		paths := make([]string, 0, len(imports))
+		for path := range imports {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		src.WriteString("\nimport (\n")
+		for _, path := range paths {
+			fmt.Fprintf(&src, "%q\n", path)
+		}
+		src.WriteString(")\n")
+	}
+	src.Write(body.Bytes())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w", err)
+	}
+	return formatted, nil
+}
+
+// goFieldType returns the Go type of the values of field, json.RawMessage
+// for types it does not know such as geometry.Point.
+func goFieldType(field Field) string {
+	if typ, ok := goFieldTypes[field.Type]; ok {
+		return typ
+	}
+	return "json.RawMessage"
+}
+
+// schemaModel is the part of a snapshot that code is generated from.
+type schemaModel struct {
+	// collections are the collections with a table, sorted by name.
+	collections []Collection
+	// fields lists the fields of each collection, aliases included, primary
+	// key first and then by name.
+	fields      map[string][]Field
+	primaryKeys map[string]Field
+	// related maps the collection.field of each many-to-one field to the
+	// related collection.
+	related map[string]string
+	// oneFields maps the collection.field of each one-to-many alias field to
+	// the relation of the many side.
+	oneFields map[string]Relation
+	// relations are sorted by collection and field.
+	relations []Relation
+}
+
+func newSchemaModel(snapshot *Snapshot) *schemaModel {
+	m := &schemaModel{
+		fields:      map[string][]Field{},
+		primaryKeys: map[string]Field{},
+		related:     map[string]string{},
+		oneFields:   map[string]Relation{},
+	}
+	for _, collection := range snapshot.Collections {
+		if collection.Schema != nil {
+			m.collections = append(m.collections, collection)
+		}
+	}
+	sort.Slice(m.collections, func(i, j int) bool { return m.collections[i].Collection < m.collections[j].Collection })
+
+	for _, field := range snapshot.Fields {
+		if field.Schema == nil && field.Type != "alias" {
+			continue
+		}
+		m.fields[field.Collection] = append(m.fields[field.Collection], field)
+		if isPrimaryKeyField(field) {
+			m.primaryKeys[field.Collection] = field
+		}
+	}
+	for _, fields := range m.fields {
+		sort.Slice(fields, func(i, j int) bool {
+			if pi, pj := isPrimaryKeyField(fields[i]), isPrimaryKeyField(fields[j]); pi != pj {
+				return pi
+			}
+			return fields[i].Field < fields[j].Field
+		})
+	}
+
+	m.relations = slices.Clone(snapshot.Relations)
+	sort.Slice(m.relations, func(i, j int) bool {
+		a, b := m.relations[i], m.relations[j]
+		if a.Collection != b.Collection {
+			return a.Collection < b.Collection
+		}
+		return a.Field < b.Field
+	})
+	for _, relation := range m.relations {
+		if relation.RelatedCollection == "" {
+			continue
+		}
+		m.related[relation.Collection+"."+relation.Field] = relation.RelatedCollection
+		if oneField, _ := relation.Meta["one_field"].(string); oneField != "" {
+			m.oneFields[relation.RelatedCollection+"."+oneField] = relation
+		}
+	}
+	return m
+}
+
+// index returns the index of the collection name in m.collections, or -1.
+func (m *schemaModel) index(name string) int {
+	return slices.IndexFunc(m.collections, func(c Collection) bool { return c.Collection == name })
+}
+
+// hasColumn reports whether field is a column rather than an alias such as a
+// one-to-many relation.
+func hasColumn(field Field) bool {
+	return field.Schema != nil && field.Type != "alias"
+}
+
+func isPrimaryKeyField(field Field) bool {
+	isPrimaryKey, _ := field.Schema["is_primary_key"].(bool)
+	return isPrimaryKey
+}
+
+// exportedNames returns the exported identifier of each item, made unique
+// with a numeric suffix and different from reserved.
+func exportedNames[T any](items []T, name func(T) string, reserved ...string) []string {
+	names := make([]string, len(items))
+	used := map[string]bool{}
+	for _, name := range reserved {
+		used[name] = true
+	}
+	for i, item := range items {
+		base := exportedIdentifier(name(item))
+		candidate := base
+		for n := 2; used[candidate]; n++ {
+			candidate = fmt.Sprintf("%s%d", base, n)
+		}
+		used[candidate] = true
+		names[i] = candidate
+	}
+	return names
+}
+
+// exportedIdentifier converts a Directus name such as blog_posts or
+// createdAt to an exported identifier such as BlogPosts or CreatedAt, writing
+// initialisms such as id and url in capitals as Go does.
+func exportedIdentifier(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	var b strings.Builder
+	for _, word := range words {
+		// Split camelCase words too, so that authorId becomes AuthorID.
+		start := 0
+		runes := []rune(word)
+		for i := 1; i <= len(runes); i++ {
+			if i < len(runes) && !(unicode.IsUpper(runes[i]) && unicode.IsLower(runes[i-1])) {
+				continue
+			}
+			part := string(runes[start:i])
+			if goInitialisms[strings.ToLower(part)] {
+				b.WriteString(strings.ToUpper(part))
+			} else {
+				r := []rune(part)
+				b.WriteString(string(unicode.ToUpper(r[0])) + string(r[1:]))
+			}
+			start = i
+		}
+	}
+	id := b.String()
+	if id == "" || !unicode.IsUpper([]rune(id)[0]) {
+		id = "X" + id
+	}
+	return id
+}
+
+// noteComment returns note, a string from the meta of a collection or field,
+// on one line.
+func noteComment(note any) string {
+	s, _ := note.(string)
+	return strings.Join(strings.Fields(s), " ")
+}
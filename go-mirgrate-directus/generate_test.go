@@ -0,0 +1,90 @@
+package gomirgratedirectus_test
+
+import (
+	"bytes"
+	"go/format"
+	"math/rand/v2"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// modelSnapshots returns the snapshot of testdata/models and copies of it
+// with its collections, fields and relations in other orders.
+func modelSnapshots(t *testing.T) []*gomigratedirectus.Snapshot {
+	t.Helper()
+	s, err := gomigratedirectus.LoadSnapshot(filepath.Join("testdata", "models", "snapshot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots := []*gomigratedirectus.Snapshot{s}
+	reversed := *s
+	reversed.Collections = slices.Clone(s.Collections)
+	reversed.Fields = slices.Clone(s.Fields)
+	reversed.Relations = slices.Clone(s.Relations)
+	slices.Reverse(reversed.Collections)
+	slices.Reverse(reversed.Fields)
+	slices.Reverse(reversed.Relations)
+	snapshots = append(snapshots, &reversed)
+	r := rand.New(rand.NewPCG(1, 2))
+	for range 3 {
+		shuffled := reversed
+		shuffled.Collections = slices.Clone(s.Collections)
+		shuffled.Fields = slices.Clone(s.Fields)
+		shuffled.Relations = slices.Clone(s.Relations)
+		r.Shuffle(len(shuffled.Collections), func(i, j int) {
+			shuffled.Collections[i], shuffled.Collections[j] = shuffled.Collections[j], shuffled.Collections[i]
+		})
+		r.Shuffle(len(shuffled.Fields), func(i, j int) { shuffled.Fields[i], shuffled.Fields[j] = shuffled.Fields[j], shuffled.Fields[i] })
+		r.Shuffle(len(shuffled.Relations), func(i, j int) {
+			shuffled.Relations[i], shuffled.Relations[j] = shuffled.Relations[j], shuffled.Relations[i]
+		})
+		snapshots = append(snapshots, &shuffled)
+	}
+	return snapshots
+}
+
+func TestGenerateGo(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts gomigratedirectus.GoOptions
+	}{
+		{"models.go.golden", gomigratedirectus.GoOptions{}},
+		{"nested.go.golden", gomigratedirectus.GoOptions{Package: "schema", NestedRelations: true}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var first []byte
+			for i, snapshot := range modelSnapshots(t) {
+				got, err := gomigratedirectus.GenerateGo(snapshot, tt.opts)
+				if err != nil {
+					t.Fatalf("GenerateGo: %v", err)
+				}
+				if i == 0 {
+					first = got
+					formatted, err := format.Source(got)
+					if err != nil {
+						t.Fatalf("generated code does not parse: %v\n%s", err, got)
+					}
+					if !bytes.Equal(formatted, got) {
+						t.Errorf("generated code is not gofmt-formatted:\n%s", got)
+					}
+					golden(t, filepath.Join("models", tt.name), got)
+				} else if !bytes.Equal(got, first) {
+					t.Errorf("GenerateGo depends on the order of the snapshot:\n%s\nwant:\n%s", got, first)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateGoErrors(t *testing.T) {
+	if _, err := gomigratedirectus.GenerateGo(nil, gomigratedirectus.GoOptions{}); err == nil {
+		t.Error("GenerateGo(nil) succeeded")
+	}
+	s := modelSnapshots(t)[0]
+	if _, err := gomigratedirectus.GenerateGo(s, gomigratedirectus.GoOptions{Package: "my-models"}); err == nil {
+		t.Error("GenerateGo with an invalid package name succeeded")
+	}
+}
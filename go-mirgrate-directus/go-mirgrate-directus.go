@@ -3,10 +3,17 @@ package gomirgratedirectus
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // DirectusClient holds the configuration for a Directus instance.
@@ -14,142 +21,468 @@ type DirectusClient struct {
 	URL         string
 	AccessToken string
 	HTTPClient  *http.Client
+
+	// Headers are added to every request sent to the instance.
+	Headers http.Header
+
+	// RetryPolicy controls retries of requests that fail transiently.
+	RetryPolicy RetryPolicy
+
+	// Timeouts bounds the duration of each operation.
+	Timeouts Timeouts
+
+	// MaxResponseBytes is the largest response body the client accepts.
+	// Zero means no limit.
+	MaxResponseBytes int64
+
+	// Compression gzips request bodies sent to the instance.
+	Compression bool
+
+	// TokenInQuery sends the access token as an access_token query parameter
+	// instead of an Authorization header. Only enable it when a proxy in front
+	// of Directus strips the Authorization header, as the token will then show
+	// up in access logs.
+	TokenInQuery bool
+
+	// Logger receives debug logs of every request with its duration and
+	// status code. Nil means slog.Default().
+	Logger *slog.Logger
+
+	// UserAgent is sent with every request. NewDirectusClient sets it to
+	// DefaultUserAgent unless WithUserAgent is given.
+	UserAgent string
+
+	// Debug, if set, receives a dump of every request and its response; see
+	// WithDebug.
+	Debug io.Writer
+
+	// Metrics, if set, counts every request by operation and status code.
+	Metrics *Metrics
+
+	// RateLimiter, if set, spaces the requests sent to the instance, and may
+	// be shared by several clients; see WithRateLimit.
+	RateLimiter *RateLimiter
+
+	// CircuitBreaker, if set, fails requests without sending them while the
+	// instance keeps failing; see WithCircuitBreaker.
+	CircuitBreaker *CircuitBreaker
+
+	// auth is set for clients that log in with email and password.
+	auth *credentials
+
+	// configErr records an invalid option passed to NewDirectusClient. It is
+	// returned by every request.
+	configErr error
+
+	// compressionRejected is set once the server refused a gzip body.
+	compressionRejected atomic.Bool
+
+	mu            sync.Mutex
+	lastRequestID string
+	traced        *tracedClient
+	// lastSent and lastReceived are the body sizes of the most recent
+	// request and of its response read so far, see LastTransferBytes.
+	lastSent, lastReceived int64
 }
 
 // NewDirectusClient creates a new client for a Directus instance.
-func NewDirectusClient(url, accessToken string) *DirectusClient {
+// Without options the client bounds its operations by DefaultTimeouts.
+func NewDirectusClient(baseURL, accessToken string, opts ...ClientOption) *DirectusClient {
+	cfg := &clientConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	retryPolicy := DefaultRetryPolicy()
+	if cfg.retryPolicy != nil {
+		retryPolicy = *cfg.retryPolicy
+	}
+
+	timeouts := DefaultTimeouts()
+	if cfg.timeouts != nil {
+		timeouts = *cfg.timeouts
+	}
+
+	userAgent := cfg.userAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent()
+	}
+
+	maxResponseBytes := cfg.maxResponseBytes
+	if maxResponseBytes == 0 {
+		maxResponseBytes = DefaultMaxResponseBytes
+	}
+
+	httpClient, configErr := cfg.buildHTTPClient()
+	if configErr != nil {
+		httpClient = &http.Client{}
+		configErr = fmt.Errorf("invalid client configuration: %w", configErr)
+	}
+
 	return &DirectusClient{
-		URL:         url,
+		URL:         baseURL,
 		AccessToken: accessToken,
-		HTTPClient:  &http.Client{},
+		HTTPClient:  httpClient,
+		Headers:     cfg.headers,
+		RetryPolicy: retryPolicy,
+		Timeouts:    timeouts,
+		UserAgent:   userAgent,
+		Logger:      cfg.logger,
+		Metrics:     cfg.metrics,
+		Debug:       cfg.debug,
+		RateLimiter: cfg.rateLimiter,
+
+		CircuitBreaker: cfg.circuitBreaker,
+
+		MaxResponseBytes: maxResponseBytes,
+		Compression:      cfg.compression,
+
+		configErr: configErr,
 	}
 }
 
-// GetSnapshot retrieves a schema snapshot from the Directus instance.
-func (c *DirectusClient) GetSnapshot() (map[string]any, error) {
-	url := fmt.Sprintf("%s/schema/snapshot?access_token=%s", c.URL, c.AccessToken)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create snapshot request: %w", err)
+// newRequest builds a request for path on the Directus instance and attaches
+// token, unless it is empty.
+func (c *DirectusClient) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader, token string) (*http.Request, error) {
+	if c.configErr != nil {
+		return nil, c.configErr
+	}
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.TokenInQuery && token != "" {
+		query.Set("access_token", token)
 	}
 
-	resp, err := c.HTTPClient.Do(req)
+	endpoint := c.URL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute snapshot request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	for key, values := range c.Headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	if header, ok := ctx.Value(requestHeadersKey{}).(http.Header); ok {
+		for key, values := range header {
+			req.Header[key] = values
+		}
+	}
+	c.setRequestID(req.Header)
+	if !c.TokenInQuery && token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("snapshot request failed with status %d: %s", resp.StatusCode, string(body))
+// requestToken returns the access token to authenticate the next request
+// with, logging in first if the client uses credentials.
+func (c *DirectusClient) requestToken(ctx context.Context) (string, error) {
+	if c.auth == nil {
+		return c.AccessToken, nil
 	}
+	return c.auth.token(ctx, c)
+}
 
-	var result map[string]any
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode snapshot response: %w", err)
+// logger returns the logger of the client.
+func (c *DirectusClient) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
 	}
+	return slog.Default()
+}
 
-	if data, ok := result["data"]; ok {
-		return data.(map[string]any), nil
+// logRequest logs the outcome of one HTTP request at debug level.
+func (c *DirectusClient) logRequest(ctx context.Context, op string, req *http.Request, resp *http.Response, err error, duration time.Duration) {
+	logger := c.logger()
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return
 	}
+	attrs := []any{
+		"op", op,
+		"method", req.Method,
+		"path", req.URL.Path,
+		"duration", duration,
+		"request_id", req.Header.Get(RequestIDHeader),
+	}
+	if err != nil {
+		attrs = append(attrs, "error", c.redactError(err))
+	} else {
+		attrs = append(attrs, "status", resp.StatusCode)
+	}
+	logger.DebugContext(ctx, "directus request", attrs...)
+}
+
+// send performs a request against the instance and returns the response of
+// the last attempt. When retry is true, connection errors and 502, 503 and 504
+// responses are retried according to c.RetryPolicy. Rate-limited (429)
+// requests were never processed, so they are retried even when retry is
+// false, waiting as long as the Retry-After header asks. Every attempt waits
+// for the rate limiter of the client first, and fails at once while its
+// circuit breaker is open. Clients using
+// credentials refresh their token and resend once when a request comes back
+// 401, and compressed bodies refused with 415 are resent uncompressed. op
+// names the operation in returned errors.
+func (c *DirectusClient) send(ctx context.Context, op, method, path string, query url.Values, body []byte, retry bool) (*http.Response, error) {
+	attempts := c.RetryPolicy.attempts()
+	reauthenticated := false
+
+	var compressed []byte
+	if c.Compression && body != nil && !c.compressionRejected.Load() {
+		var err error
+		if compressed, err = compressBody(body); err != nil {
+			return nil, fmt.Errorf("failed to compress %s request: %w", op, err)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		var reqBody io.Reader
+		if compressed != nil {
+			reqBody = bytes.NewReader(compressed)
+		} else if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+
+		token, err := c.requestToken(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate %s request: %w", op, err)
+		}
 
-	return nil, fmt.Errorf("snapshot response does not contain 'data' field")
+		req, err := c.newRequest(ctx, method, path, query, reqBody, token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s request: %w", op, err)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if compressed != nil {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		req.Header.Set("Accept-Encoding", "gzip")
+
+		if err := c.waitRateLimit(ctx); err != nil {
+			return nil, fmt.Errorf("%s request canceled: %w", op, err)
+		}
+		if err := c.circuitAllow(); err != nil {
+			return nil, fmt.Errorf("%s request not sent: %w", op, err)
+		}
+		c.startTransfer(len(body))
+		start := time.Now()
+		resp, err := c.httpClient(ctx).Do(req)
+		c.logRequest(ctx, op, req, resp, err, time.Since(start))
+		c.Metrics.observeRequest(op, resp, err)
+		c.circuitRecord(ctx, resp, err, c.secrets())
+		if err == nil {
+			if err := decompressResponse(resp); err != nil {
+				resp.Body.Close()
+				return nil, fmt.Errorf("failed to decompress %s response: %w", op, err)
+			}
+		}
+		if c.Debug != nil {
+			c.dumpExchange(op, req, body, resp, err, time.Since(start), c.secrets())
+		}
+		delay := c.RetryPolicy.delay(attempt)
+		switch {
+		case err != nil:
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, fmt.Errorf("%s request canceled: %w", op, ctxErr)
+			}
+			if !retry || attempt >= attempts {
+				return nil, &transientError{fmt.Errorf("failed to execute %s request: %w", op, c.redactError(err))}
+			}
+		case resp.StatusCode == http.StatusUnsupportedMediaType && compressed != nil:
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			// The server does not accept gzip bodies; stop sending them.
+			c.compressionRejected.Store(true)
+			compressed = nil
+			attempt--
+			continue
+		case resp.StatusCode == http.StatusUnauthorized && c.auth != nil && !reauthenticated:
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if err := c.auth.invalidate(ctx, c, token); err != nil {
+				return nil, fmt.Errorf("failed to re-authenticate %s request: %w", op, err)
+			}
+			reauthenticated = true
+			// A rejected token does not count as an attempt.
+			attempt--
+			continue
+		case resp.StatusCode == http.StatusTooManyRequests && attempt < attempts:
+			if d, ok := c.RetryPolicy.retryAfter(resp, time.Now()); ok {
+				delay = d
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		case retry && isRetryableStatus(resp.StatusCode) && attempt < attempts:
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		default:
+			return resp, nil
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, fmt.Errorf("%s request canceled: %w", op, err)
+		}
+	}
 }
 
-// GetDiff retrieves a schema diff between the target instance and the provided snapshot.
-func (c *DirectusClient) GetDiff(snapshot map[string]any, force bool) (map[string]any, error) {
-	url := fmt.Sprintf("%s/schema/diff?access_token=%s", c.URL, c.AccessToken)
-	if force {
-		url += "&force=true"
+// GetSnapshot retrieves a schema snapshot from the Directus instance.
+// Unexpected responses are reported as *DirectusError.
+func (c *DirectusClient) GetSnapshot(ctx context.Context) (_ *Snapshot, err error) {
+	ctx, done := startOperation(ctx, "snapshot", c.Timeouts.Snapshot)
+	defer func() { err = done(err) }()
+
+	resp, err := c.send(ctx, "snapshot", http.MethodGet, "/schema/snapshot", nil, nil, true)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	requestBody, err := json.Marshal(snapshot)
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.newDirectusError("snapshot", resp)
+	}
+
+	var snapshot Snapshot
+	if err := c.decodeData("snapshot", c.responseBody("snapshot", resp), &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// ErrNoChanges is returned by GetDiff when the target instance already matches
+// the snapshot.
+var ErrNoChanges = errors.New("no schema changes")
+
+// GetDiff retrieves a schema diff between the target instance and the provided snapshot.
+// It returns a nil diff and ErrNoChanges when there is nothing to apply.
+func (c *DirectusClient) GetDiff(ctx context.Context, snapshot *Snapshot, force bool) (_ *Diff, err error) {
+	// MarshalJSON is called directly: json.Marshal would copy its output
+	// once more to validate it.
+	requestBody, err := snapshot.MarshalJSON()
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal snapshot for diff request: %w", err)
 	}
+	return c.GetDiffRaw(ctx, requestBody, force)
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create diff request: %w", err)
+// GetDiffRaw is like GetDiff for a snapshot given as JSON, such as one
+// exported by GetSnapshotRaw with FormatJSON or read from a file. The snapshot
+// is sent as is, without being decoded, so that moving a large snapshot
+// between instances holds it only once in memory.
+func (c *DirectusClient) GetDiffRaw(ctx context.Context, snapshot json.RawMessage, force bool) (_ *Diff, err error) {
+	ctx, done := startOperation(ctx, "diff", c.Timeouts.Diff)
+	defer func() { err = done(err) }()
+
+	query := url.Values{}
+	if force {
+		query.Set("force", "true")
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.HTTPClient.Do(req)
+	// Computing a diff does not modify the instance, so it is safe to retry.
+	resp, err := c.send(ctx, "diff", http.MethodPost, "/schema/diff", query, snapshot, true)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute diff request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, ErrNoChanges
+	}
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("diff request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, c.newDirectusError("diff", resp)
 	}
 
-	var result map[string]any
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode diff response: %w", err)
+	body, err := c.readBody("diff", resp)
+	if err != nil {
+		return nil, err
 	}
-
-	if data, ok := result["data"]; ok {
-		return data.(map[string]any), nil
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, ErrNoChanges
 	}
 
-	return nil, fmt.Errorf("diff response does not contain 'data' field")
+	var diff Diff
+	if err := c.decodeData("diff", bytes.NewReader(body), &diff); err != nil {
+		return nil, err
+	}
+	if diff.IsEmpty() {
+		return nil, ErrNoChanges
+	}
+	return &diff, nil
 }
 
 // ApplyDiff applies a schema diff to the Directus instance.
-func (c *DirectusClient) ApplyDiff(diff map[string]any) error {
-	url := fmt.Sprintf("%s/schema/apply?access_token=%s", c.URL, c.AccessToken)
+//
+// The request is sent exactly once: a failed apply may still have reached
+// Directus, so resending the same diff is not safe. Migrate recovers from
+// transient apply failures by recomputing the diff before trying again.
+func (c *DirectusClient) ApplyDiff(ctx context.Context, diff *Diff) (err error) {
+	ctx, done := startOperation(ctx, "apply", c.Timeouts.Apply)
+	defer func() { err = done(err) }()
 
 	requestBody, err := json.Marshal(diff)
 	if err != nil {
 		return fmt.Errorf("failed to marshal diff for apply request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return fmt.Errorf("failed to create apply request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.send(ctx, "apply", http.MethodPost, "/schema/apply", nil, requestBody, false)
 	if err != nil {
-		return fmt.Errorf("failed to execute apply request: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusNoContent {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("apply request failed with status %d: %s", resp.StatusCode, string(body))
+		err := c.newDirectusError("apply", resp)
+		if isRetryableStatus(resp.StatusCode) {
+			return &transientError{err}
+		}
+		return err
 	}
 
 	return nil
 }
 
-// Migrate performs a full schema migration from a base project to a target project.
-func Migrate(baseURL, baseToken, targetURL, targetToken string, force bool) error {
-	baseClient := NewDirectusClient(baseURL, baseToken)
-	targetClient := NewDirectusClient(targetURL, targetToken)
+// applyWithRecheck applies diff and, when the apply fails transiently,
+// recomputes the diff of snapshot against the instance before trying again, so
+// changes that did reach Directus are never applied twice. The recomputed diff
+// is passed through prepare, which narrows it like the original one. onRetry,
+// if not nil, is called with each transient failure.
+func (c *DirectusClient) applyWithRecheck(ctx context.Context, snapshot *Snapshot, diff *Diff, force bool, prepare func(*Diff) (*Diff, error), onRetry func(error)) error {
+	attempts := c.RetryPolicy.attempts()
+	for attempt := 1; ; attempt++ {
+		err := c.ApplyDiff(ctx, diff)
+		if err == nil || !isTransient(err) || attempt >= attempts {
+			return err
+		}
 
-	fmt.Println("Retrieving snapshot from base project...")
-	snapshot, err := baseClient.GetSnapshot()
-	if err != nil {
-		return fmt.Errorf("failed to get snapshot: %w", err)
-	}
-	fmt.Println("Snapshot retrieved successfully.")
+		if onRetry != nil {
+			onRetry(err)
+		}
+		if err := sleepContext(ctx, c.RetryPolicy.delay(attempt)); err != nil {
+			return fmt.Errorf("apply request canceled: %w", err)
+		}
 
-	fmt.Println("Retrieving diff from target project...")
-	diff, err := targetClient.GetDiff(snapshot, force)
-	if err != nil {
-		return fmt.Errorf("failed to get diff: %w", err)
-	}
-	fmt.Println("Diff retrieved successfully.")
-
-	fmt.Println("Applying diff to target project...")
-	if err := targetClient.ApplyDiff(diff); err != nil {
-		return fmt.Errorf("failed to apply diff: %w", err)
+		diff, err = c.GetDiff(ctx, snapshot, force)
+		if errors.Is(err, ErrNoChanges) {
+			// The failed apply did reach Directus after all.
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to re-check diff after apply failure: %w", err)
+		}
+		if diff, err = prepare(diff); err != nil {
+			return err
+		}
+		if diff == nil || diff.IsEmpty() {
+			return nil
+		}
 	}
-	fmt.Println("Diff applied successfully. Migration complete.")
-
-	return nil
 }
@@ -0,0 +1,153 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// quiet returns the options of a client that does not log nor wait between
+// retries.
+func quiet(opts ...gomigratedirectus.ClientOption) []gomigratedirectus.ClientOption {
+	return append([]gomigratedirectus.ClientOption{
+		gomigratedirectus.WithLogger(slog.New(slog.DiscardHandler)),
+		gomigratedirectus.WithRetryPolicy(gomigratedirectus.RetryPolicy{MaxAttempts: 3}),
+	}, opts...)
+}
+
+func TestTokenNotInURL(t *testing.T) {
+	ctx := context.Background()
+	server := directustest.NewServer(t)
+	client := server.Client(quiet()...)
+
+	if _, err := client.GetSnapshot(ctx); err != nil {
+		t.Fatalf("GetSnapshot: %v", err)
+	}
+	if _, err := client.GetDiff(ctx, &gomigratedirectus.Snapshot{}, false); err != gomigratedirectus.ErrNoChanges {
+		t.Fatalf("GetDiff = %v, want ErrNoChanges", err)
+	}
+	for _, req := range server.Requests() {
+		if req.Query.Has("access_token") {
+			t.Errorf("%s %s sent the token in the query", req.Method, req.Path)
+		}
+		if got := req.Header.Get("Authorization"); got != "Bearer "+directustest.Token {
+			t.Errorf("%s %s sent Authorization %q, want the bearer token", req.Method, req.Path, got)
+		}
+	}
+}
+
+func TestTokenNotInErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		tokenInQuery bool
+	}{
+		{"header", false},
+		{"query", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			server := directustest.NewServer(t)
+			client := server.Client(quiet()...)
+			client.TokenInQuery = tt.tokenInQuery
+			echo := "Invalid request " + server.URL + "/schema/snapshot?access_token=" + directustest.Token +
+				" with token " + directustest.Token
+			server.Fail("/schema/snapshot", 1, directustest.Failure{Status: http.StatusBadRequest, Message: echo})
+
+			_, err := client.GetSnapshot(ctx)
+			if err == nil {
+				t.Fatal("GetSnapshot succeeded, want an error")
+			}
+			if strings.Contains(err.Error(), directustest.Token) {
+				t.Errorf("error %q contains the token", err)
+			}
+
+			// The error of a failed connection quotes the URL it was sent to.
+			server.Close()
+			_, err = client.GetSnapshot(ctx)
+			if err == nil {
+				t.Fatal("GetSnapshot of a closed server succeeded, want an error")
+			}
+			if strings.Contains(err.Error(), directustest.Token) {
+				t.Errorf("connection error %q contains the token", err)
+			}
+		})
+	}
+}
+
+func TestTokenInQuery(t *testing.T) {
+	server := directustest.NewServer(t)
+	client := server.Client(quiet()...)
+	client.TokenInQuery = true
+
+	if _, err := client.GetSnapshot(context.Background()); err != nil {
+		t.Fatalf("GetSnapshot: %v", err)
+	}
+	req := server.Requests()[0]
+	if got := req.Query.Get("access_token"); got != directustest.Token {
+		t.Errorf("access_token = %q, want the token", got)
+	}
+	if got := req.Header.Get("Authorization"); got != "" {
+		t.Errorf("Authorization = %q, want none with TokenInQuery", got)
+	}
+}
+
+// staticServer answers every request with status and body.
+func staticServer(t *testing.T, status int, body string) *gomigratedirectus.DirectusClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body != "" {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return gomigratedirectus.NewDirectusClient(server.URL, "token", quiet()...)
+}
+
+func TestGetDiffNoChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+	}{
+		{"204", http.StatusNoContent, "", gomigratedirectus.ErrNoChanges},
+		{"200 without body", http.StatusOK, "", gomigratedirectus.ErrNoChanges},
+		{"200 with empty data", http.StatusOK, `{"data":{"hash":"abc","diff":{"collections":[],"fields":[],"relations":[]}}}`, gomigratedirectus.ErrNoChanges},
+		{"diff", http.StatusOK, `{"data":{"hash":"abc","diff":{"collections":[{"collection":"articles","diff":[{"kind":"N","rhs":{"collection":"articles"}}]}],"fields":[],"relations":[]}}}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := staticServer(t, tt.status, tt.body)
+			check := func(method string, diff *gomigratedirectus.Diff, err error) {
+				t.Helper()
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("%s error = %v, want %v", method, err, tt.wantErr)
+				}
+				if tt.wantErr != nil && diff != nil {
+					t.Errorf("%s = %+v with ErrNoChanges, want nil", method, diff)
+				}
+				if tt.wantErr == nil && (diff == nil || diff.IsEmpty() || diff.Diff.Collections[0].Collection != "articles") {
+					t.Errorf("%s = %+v, want the articles diff", method, diff)
+				}
+			}
+
+			diff, err := client.GetDiff(ctx, &gomigratedirectus.Snapshot{}, false)
+			check("GetDiff", diff, err)
+			diff, err = client.GetDiffRaw(ctx, json.RawMessage(`{"version":1}`), false)
+			check("GetDiffRaw", diff, err)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HealthStatus is the response of /server/health.
+type HealthStatus struct {
+	// Status is "ok", "warn" or "error".
+	Status string `json:"status"`
+	// Checks holds the individual service checks. Directus only reports them
+	// to administrators.
+	Checks map[string]any `json:"checks,omitempty"`
+}
+
+// Health retrieves the health status of the instance from /server/health.
+// Directus answers 503 while unhealthy; that is reported as a status, not an
+// error.
+func (c *DirectusClient) Health(ctx context.Context) (_ *HealthStatus, err error) {
+	ctx, done := startOperation(ctx, "health", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	resp, err := c.send(ctx, "health", http.MethodGet, "/server/health", nil, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, c.newDirectusError("health", resp)
+	}
+
+	body, err := c.readBody("health", resp)
+	if err != nil {
+		return nil, err
+	}
+	var status HealthStatus
+	if err := json.Unmarshal(body, &status); err != nil || status.Status == "" {
+		return nil, fmt.Errorf("unexpected health response with status %d (body: %s)", resp.StatusCode, c.excerpt(prefixOf(body)))
+	}
+	return &status, nil
+}
+
+// WaitForReady polls Health every interval until the instance reports "ok",
+// giving up after timeout or when ctx is done. The last observed status or
+// error is included in the returned error.
+func (c *DirectusClient) WaitForReady(ctx context.Context, interval, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		status, err := c.Health(ctx)
+		if err == nil && status.Status == "ok" {
+			return nil
+		}
+
+		last := err
+		if last == nil {
+			last = fmt.Errorf("status is %q", status.Status)
+		}
+		if err := sleepContext(ctx, interval); err != nil {
+			return fmt.Errorf("%s not ready after %s: %w", RedactURL(c.URL), timeout, last)
+		}
+	}
+}
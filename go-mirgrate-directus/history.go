@@ -0,0 +1,175 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// DefaultHistoryCollection is the collection migrations are recorded in
+// unless MigrationOptions.HistoryCollection says otherwise.
+const DefaultHistoryCollection = "schema_migrations"
+
+// Statuses of a HistoryEntry.
+const (
+	HistoryApplied = "applied"
+	HistoryFailed  = "failed"
+)
+
+// HistoryEntry is a row of the history collection, recording one attempt to
+// apply a diff to the project.
+type HistoryEntry struct {
+	ID        json.Number `json:"id,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	// Status is HistoryApplied or HistoryFailed.
+	Status string `json:"status"`
+	// Base is where the schema came from: the redacted base URL or the
+	// snapshot file.
+	Base string `json:"base"`
+	// SnapshotHash is the SnapshotHash of the applied base snapshot.
+	SnapshotHash string      `json:"snapshot_hash"`
+	Summary      DiffSummary `json:"summary"`
+	// Changes is Summary in words.
+	Changes string `json:"changes"`
+	// ToolVersion is the build that applied the diff, with its commit when
+	// known; see BuildInfo.String.
+	ToolVersion string `json:"tool_version"`
+	Operator    string `json:"operator"`
+	Error       string `json:"error,omitempty"`
+}
+
+// historyFields are the fields of the history collection, created by
+// EnsureHistoryCollection.
+var historyFields = []map[string]any{
+	{"field": "id", "type": "integer", "meta": map[string]any{"hidden": true, "readonly": true}, "schema": map[string]any{"is_primary_key": true, "has_auto_increment": true}},
+	{"field": "timestamp", "type": "timestamp", "meta": map[string]any{"readonly": true, "width": "half"}, "schema": map[string]any{}},
+	{"field": "status", "type": "string", "meta": map[string]any{"readonly": true, "width": "half"}, "schema": map[string]any{}},
+	{"field": "base", "type": "string", "meta": map[string]any{"readonly": true}, "schema": map[string]any{}},
+	{"field": "snapshot_hash", "type": "string", "meta": map[string]any{"readonly": true}, "schema": map[string]any{}},
+	{"field": "summary", "type": "json", "meta": map[string]any{"readonly": true}, "schema": map[string]any{}},
+	{"field": "changes", "type": "text", "meta": map[string]any{"readonly": true}, "schema": map[string]any{}},
+	{"field": "tool_version", "type": "string", "meta": map[string]any{"readonly": true, "width": "half"}, "schema": map[string]any{}},
+	{"field": "operator", "type": "string", "meta": map[string]any{"readonly": true, "width": "half"}, "schema": map[string]any{}},
+	{"field": "error", "type": "text", "meta": map[string]any{"readonly": true}, "schema": map[string]any{}},
+}
+
+// EnsureHistoryCollection creates the history collection with its fields
+// unless the project already has it. It reports whether it was created.
+func (c *DirectusClient) EnsureHistoryCollection(ctx context.Context, collection string) (_ bool, err error) {
+	ctx, done := startOperation(ctx, "ensure history collection", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	meta := map[string]any{
+		"icon":       "history",
+		"note":       "Schema migrations applied by go-mirgrate-directus",
+		"sort_field": "timestamp",
+	}
+	return c.ensureCollection(ctx, collection, meta, historyFields)
+}
+
+// ensureCollection creates collection with meta and fields unless the project
+// already has it, and reports whether it was created.
+func (c *DirectusClient) ensureCollection(ctx context.Context, collection string, meta map[string]any, fields []map[string]any) (bool, error) {
+	var existing struct {
+		Collection string `json:"collection"`
+	}
+	err := c.doJSON(ctx, "get collection", http.MethodGet, "/collections/"+url.PathEscape(collection), nil, nil, &existing)
+	var unreadable error
+	switch {
+	case err == nil:
+		return false, nil
+	case IsForbidden(err):
+		// Directus answers 403 for a collection that does not exist as well
+		// as for one the token may not read; only the list of collections
+		// tells them apart.
+		listed, listErr := c.listCollectionNames(ctx)
+		if listErr != nil || slices.Contains(listed, collection) {
+			return false, fmt.Errorf("collection %s is not readable with this token: %w", collection, err)
+		}
+		unreadable = err
+	case isNotFound(err):
+	default:
+		return false, err
+	}
+
+	payload := map[string]any{
+		"collection": collection,
+		"meta":       meta,
+		"schema":     map[string]any{},
+		"fields":     fields,
+	}
+	if err := c.doJSON(ctx, "create collection", http.MethodPost, "/collections", nil, payload, nil); err != nil {
+		if unreadable != nil && IsForbidden(err) {
+			// Collections the token may not read are not listed either.
+			return false, fmt.Errorf("collection %s is not readable with this token and could not be created: %w", collection, unreadable)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// listCollectionNames returns the names of the collections the token may
+// read.
+func (c *DirectusClient) listCollectionNames(ctx context.Context) ([]string, error) {
+	var collections []struct {
+		Collection string `json:"collection"`
+	}
+	if err := c.doJSON(ctx, "list collections", http.MethodGet, "/collections", nil, nil, &collections); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(collections))
+	for _, collection := range collections {
+		names = append(names, collection.Collection)
+	}
+	return names, nil
+}
+
+// RecordHistory inserts entry into the history collection.
+func (c *DirectusClient) RecordHistory(ctx context.Context, collection string, entry HistoryEntry) (err error) {
+	ctx, done := startOperation(ctx, "record history", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	entry.ID = ""
+	return c.doJSON(ctx, "record history", http.MethodPost, "/items/"+url.PathEscape(collection), nil, entry, nil)
+}
+
+// ListHistory returns the limit most recent entries of the history
+// collection, newest first.
+func (c *DirectusClient) ListHistory(ctx context.Context, collection string, limit int) (_ []HistoryEntry, err error) {
+	ctx, done := startOperation(ctx, "list history", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	query := url.Values{"sort": {"-timestamp,-id"}, "limit": {strconv.Itoa(limit)}}
+	var entries []HistoryEntry
+	if err := c.doJSON(ctx, "list history", http.MethodGet, "/items/"+url.PathEscape(collection), query, nil, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// NewHistoryEntry describes the attempt to apply the diff summarized by
+// summary, computed from snapshot taken from base, which failed with applyErr
+// if not nil.
+func NewHistoryEntry(base string, snapshot *Snapshot, summary DiffSummary, operator string, applyErr error) HistoryEntry {
+	entry := HistoryEntry{
+		Timestamp:   time.Now().UTC(),
+		Status:      HistoryApplied,
+		Base:        base,
+		Summary:     summary,
+		Changes:     summary.String(),
+		ToolVersion: GetBuildInfo().String(),
+		Operator:    operator,
+	}
+	if snapshot != nil {
+		entry.SnapshotHash, _ = SnapshotHash(snapshot)
+	}
+	if applyErr != nil {
+		entry.Status, entry.Error = HistoryFailed, applyErr.Error()
+	}
+	return entry
+}
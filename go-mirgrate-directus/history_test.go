@@ -0,0 +1,59 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+func TestEnsureHistoryCollection(t *testing.T) {
+	ctx := context.Background()
+	server := newItemsServer(t, gomigratedirectus.DefaultHistoryCollection)
+	client := server.client()
+
+	created, err := client.EnsureHistoryCollection(ctx, gomigratedirectus.DefaultHistoryCollection)
+	if err != nil || !created {
+		t.Fatalf("EnsureHistoryCollection = %v, %v, want the collection created", created, err)
+	}
+	created, err = client.EnsureHistoryCollection(ctx, gomigratedirectus.DefaultHistoryCollection)
+	if err != nil || created {
+		t.Fatalf("second EnsureHistoryCollection = %v, %v, want the existing collection kept", created, err)
+	}
+	if n := server.createdCount(); n != 1 {
+		t.Errorf("history collection created %d times, want 1", n)
+	}
+}
+
+func TestEnsureHistoryCollectionNotReadable(t *testing.T) {
+	server := newItemsServer(t, gomigratedirectus.DefaultHistoryCollection)
+	server.setForbidden(true)
+
+	_, err := server.client().EnsureHistoryCollection(context.Background(), gomigratedirectus.DefaultHistoryCollection)
+	if err == nil || !gomigratedirectus.IsForbidden(err) {
+		t.Fatalf("EnsureHistoryCollection = %v, want a forbidden error", err)
+	}
+	if !strings.Contains(err.Error(), "collection schema_migrations is not readable") {
+		t.Errorf("error %q does not say the collection is not readable", err)
+	}
+	if n := server.createdCount(); n != 0 {
+		t.Errorf("history collection created %d times, want 0", n)
+	}
+}
+
+func TestNewHistoryEntry(t *testing.T) {
+	summary := gomigratedirectus.DiffSummary{Collections: gomigratedirectus.ChangeCounts{Created: 1}}
+	entry := gomigratedirectus.NewHistoryEntry("https://base.example.com", nil, summary, "alice", nil)
+	if entry.Status != gomigratedirectus.HistoryApplied || entry.Operator != "alice" || entry.Changes != summary.String() {
+		t.Errorf("NewHistoryEntry = %+v", entry)
+	}
+	if entry.ToolVersion != gomigratedirectus.GetBuildInfo().String() {
+		t.Errorf("ToolVersion = %q, want %q", entry.ToolVersion, gomigratedirectus.GetBuildInfo().String())
+	}
+
+	failed := gomigratedirectus.NewHistoryEntry("schema.yaml", nil, summary, "", context.Canceled)
+	if failed.Status != gomigratedirectus.HistoryFailed || failed.Error != context.Canceled.Error() {
+		t.Errorf("NewHistoryEntry of a failed apply = %+v", failed)
+	}
+}
@@ -0,0 +1,75 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Stages of a migration at which MigrationOptions.Hook is called.
+const (
+	// HookPreSnapshot runs before the base snapshot is taken.
+	HookPreSnapshot = "pre_snapshot"
+	// HookPreApply runs right before the diff is applied, after the backup.
+	HookPreApply = "pre_apply"
+	// HookPostApply runs once a migration that applied a diff succeeded.
+	HookPostApply = "post_apply"
+	// HookOnFailure runs when a migration failed.
+	HookOnFailure = "on_failure"
+)
+
+// HookInfo describes the migration to a hook.
+type HookInfo struct {
+	Stage string
+	// Target is the client of the target project.
+	Target *DirectusClient
+	// Summary summarizes the diff, nil before it was computed.
+	Summary *DiffSummary
+	// BackupPath is the backup of the target, if one was written.
+	BackupPath string
+	// Err is the error the migration failed with, for HookOnFailure.
+	Err error
+}
+
+// HookFunc runs the hook of info.Stage, if any. An error returned by a pre
+// hook aborts the migration; errors of the other hooks are reported, and
+// only fail the migration with MigrationOptions.StrictHooks.
+type HookFunc func(ctx context.Context, info HookInfo) error
+
+// runHook calls opts.Hook for stage, if set.
+func (m *migration) runHook(ctx context.Context, stage string, targetClient *DirectusClient, result *MigrationResult, migrationErr error) error {
+	if m.opts.Hook == nil {
+		return nil
+	}
+	info := HookInfo{Stage: stage, Target: targetClient, BackupPath: result.BackupPath, Err: migrationErr}
+	if result.Changed {
+		info.Summary = &result.Summary
+	}
+	m.emit(&HookStarted{Stage: stage})
+	start := time.Now()
+	err := m.opts.Hook(ctx, info)
+	if err != nil {
+		err = fmt.Errorf("%s hook failed: %w", stage, err)
+	}
+	m.emit(&HookFinished{Stage: stage, Duration: time.Since(start), Err: err})
+	return err
+}
+
+// finishHooks runs the post_apply or on_failure hook once a migration ended
+// with err, and returns the outcome of the migration.
+func (m *migration) finishHooks(ctx context.Context, targetClient *DirectusClient, result *MigrationResult, err error) error {
+	switch {
+	case errors.Is(err, ErrNotConfirmed):
+		return err
+	case err != nil:
+		m.runHook(context.WithoutCancel(ctx), HookOnFailure, targetClient, result, err)
+		return err
+	case !result.Applied:
+		return nil
+	}
+	if err := m.runHook(ctx, HookPostApply, targetClient, result, nil); err != nil && m.opts.StrictHooks {
+		return m.fail(PhaseHooks, err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package gomirgratedirectus
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// LintSeverity is the severity of a lint rule and its findings.
+type LintSeverity string
+
+// Severities of lint rules. The zero value turns a rule off, like
+// LintOff.
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+	LintOff     LintSeverity = "off"
+)
+
+// IDs of the built-in lint rules.
+const (
+	LintRuleCollectionName = "collection-name"
+	LintRuleFieldName      = "field-name"
+	LintRuleRequiredFields = "required-fields"
+	LintRuleTextMaxLength  = "text-max-length"
+	LintRuleDeniedTypes    = "denied-types"
+)
+
+// LintRuleIDs lists the IDs of the built-in lint rules.
+var LintRuleIDs = []string{
+	LintRuleCollectionName,
+	LintRuleFieldName,
+	LintRuleRequiredFields,
+	LintRuleTextMaxLength,
+	LintRuleDeniedTypes,
+}
+
+// DefaultRequiredFields are the fields the required-fields rule expects in
+// every collection by default.
+var DefaultRequiredFields = []string{"status", "sort", "user_created"}
+
+// LintRule configures one lint rule.
+type LintRule struct {
+	Severity LintSeverity `json:"severity"`
+	// Ignore leaves the collections, or for field rules the
+	// collection.field paths, matching one of these path.Match patterns
+	// out of the rule.
+	Ignore []string `json:"ignore,omitempty"`
+	// Fields are the fields the required-fields rule expects.
+	Fields []string `json:"fields,omitempty"`
+	// Types are the field types the denied-types rule reports.
+	Types []string `json:"types,omitempty"`
+}
+
+// enabled reports whether the rule reports findings.
+func (r LintRule) enabled() bool {
+	return r.Severity == LintError || r.Severity == LintWarning
+}
+
+// LintRules configures the rules of LintSnapshot, keyed by rule ID. Rules
+// that are missing are off.
+type LintRules map[string]LintRule
+
+// DefaultLintRules returns the built-in rules with their default
+// configuration: snake_case plural collection names, snake_case field names
+// and the DefaultRequiredFields are errors, text fields without a max length
+// warnings. denied-types is off until it is given types.
+func DefaultLintRules() LintRules {
+	return LintRules{
+		LintRuleCollectionName: {Severity: LintError},
+		LintRuleFieldName:      {Severity: LintError},
+		LintRuleRequiredFields: {Severity: LintError, Fields: slices.Clone(DefaultRequiredFields)},
+		LintRuleTextMaxLength:  {Severity: LintWarning},
+		LintRuleDeniedTypes:    {Severity: LintError},
+	}
+}
+
+// Validate checks that the rules are known and their severities and ignore
+// patterns valid.
+func (rules LintRules) Validate() error {
+	var problems []error
+	for _, id := range sortedKeys(rules) {
+		rule := rules[id]
+		if !slices.Contains(LintRuleIDs, id) {
+			problems = append(problems, fmt.Errorf("unknown lint rule %q, expected one of %s", id, strings.Join(LintRuleIDs, ", ")))
+			continue
+		}
+		switch rule.Severity {
+		case "", LintError, LintWarning, LintOff:
+		default:
+			problems = append(problems, fmt.Errorf("lint rule %s: invalid severity %q, expected error, warning or off", id, rule.Severity))
+		}
+		for _, pattern := range rule.Ignore {
+			if _, err := path.Match(pattern, ""); err != nil {
+				problems = append(problems, fmt.Errorf("lint rule %s: invalid ignore pattern %q: %w", id, pattern, err))
+			}
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// LintFinding is a violation of a lint rule. Path locates it in the
+// snapshot like the paths of ValidationProblem, such as "fields[12]".
+type LintFinding struct {
+	Rule       string       `json:"rule"`
+	Severity   LintSeverity `json:"severity"`
+	Path       string       `json:"path"`
+	Collection string       `json:"collection"`
+	Field      string       `json:"field,omitempty"`
+	Message    string       `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	location := f.Collection
+	if f.Field != "" {
+		location += "." + f.Field
+	}
+	return fmt.Sprintf("%s: %s %s: %s [%s]", f.Severity, f.Path, location, f.Message, f.Rule)
+}
+
+// LintResult holds the findings of LintSnapshot, in snapshot order.
+type LintResult struct {
+	Findings []LintFinding `json:"findings"`
+	Errors   int           `json:"errors"`
+	Warnings int           `json:"warnings"`
+}
+
+var (
+	lintSnakeCase = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+	// lintPluralWords are plural nouns not ending in s.
+	lintPluralWords = []string{"children", "data", "feedback", "info", "media", "metadata", "people", "staff"}
+)
+
+// LintSnapshot checks snapshot against rules, which are usually
+// DefaultLintRules with changes from a config file:
+//
+//   - collection-name: collection names are snake_case and plural, that is
+//     their last word ends in s or is a plural such as people or media;
+//   - field-name: field names are snake_case;
+//   - required-fields: every collection has the fields of the rule, by
+//     default DefaultRequiredFields;
+//   - text-max-length: string and text fields have a max length;
+//   - denied-types: no field has one of the types of the rule.
+//
+// The directus_* system collections and folders, collections without a
+// table, are not linted. Use LintRules.Validate to check rules first.
+func LintSnapshot(snapshot *Snapshot, rules LintRules) *LintResult {
+	result := &LintResult{Findings: []LintFinding{}}
+	report := func(id, path, collection, field, format string, args ...any) {
+		rule := rules[id]
+		if !rule.enabled() {
+			return
+		}
+		name := collection
+		if field != "" {
+			name += "." + field
+		}
+		if matchesAny(rule.Ignore, name) {
+			return
+		}
+		result.Findings = append(result.Findings, LintFinding{
+			Rule:       id,
+			Severity:   rule.Severity,
+			Path:       path,
+			Collection: collection,
+			Field:      field,
+			Message:    fmt.Sprintf(format, args...),
+		})
+		if rule.Severity == LintError {
+			result.Errors++
+		} else {
+			result.Warnings++
+		}
+	}
+
+	fields := map[string][]string{}
+	for _, field := range snapshot.Fields {
+		fields[field.Collection] = append(fields[field.Collection], field.Field)
+	}
+	folders := map[string]bool{}
+	for i, collection := range snapshot.Collections {
+		name := collection.Collection
+		if collection.Schema == nil {
+			folders[name] = true
+		}
+		if IsSystemCollection(name) || folders[name] {
+			continue
+		}
+		p := fmt.Sprintf("collections[%d]", i)
+		if !lintSnakeCase.MatchString(name) {
+			report(LintRuleCollectionName, p, name, "", "collection name is not snake_case")
+		} else if !isPluralName(name) {
+			report(LintRuleCollectionName, p, name, "", "collection name is not plural")
+		}
+		var missing []string
+		for _, required := range rules[LintRuleRequiredFields].Fields {
+			if !slices.Contains(fields[name], required) {
+				missing = append(missing, required)
+			}
+		}
+		if len(missing) > 0 {
+			report(LintRuleRequiredFields, p, name, "", "collection is missing required fields: %s", strings.Join(missing, ", "))
+		}
+	}
+
+	for i, field := range snapshot.Fields {
+		if IsSystemCollection(field.Collection) || folders[field.Collection] {
+			continue
+		}
+		p := fmt.Sprintf("fields[%d]", i)
+		if !lintSnakeCase.MatchString(field.Field) {
+			report(LintRuleFieldName, p, field.Collection, field.Field, "field name is not snake_case")
+		}
+		if (field.Type == "string" || field.Type == "text") && field.Schema != nil && field.Schema["max_length"] == nil {
+			report(LintRuleTextMaxLength, p, field.Collection, field.Field, "%s field has no max length", field.Type)
+		}
+		if slices.Contains(rules[LintRuleDeniedTypes].Types, field.Type) {
+			report(LintRuleDeniedTypes, p, field.Collection, field.Field, "field type %s is not allowed", field.Type)
+		}
+	}
+	return result
+}
+
+// isPluralName reports whether the last word of the snake_case name looks
+// plural.
+func isPluralName(name string) bool {
+	word := name[strings.LastIndex(name, "_")+1:]
+	return (strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss")) || slices.Contains(lintPluralWords, word)
+}
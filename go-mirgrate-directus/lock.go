@@ -0,0 +1,274 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Defaults of LockOptions.
+const (
+	DefaultLockCollection    = "schema_migrations_lock"
+	DefaultLockTTL           = 30 * time.Minute
+	DefaultLockRetryInterval = 2 * time.Second
+)
+
+// lockID is the primary key of the lock item. The collection holds at most
+// this one item, so creating it fails while the lock is held.
+const lockID = "migration"
+
+// ErrLocked is returned, wrapped in a *LockedError, when the target is locked
+// by another migration.
+var ErrLocked = errors.New("target is locked by another migration")
+
+// Lock is the item of the lock collection held while a migration runs.
+type Lock struct {
+	ID string `json:"id"`
+	// Holder identifies the process holding the lock, see NewLockHolder.
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	// ExpiresAt is when the lock becomes stale and can be taken over, in
+	// case its holder died without releasing it.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Expired reports whether the lock is stale at now.
+func (l Lock) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// LockedError is returned when the target is locked by Lock. It matches
+// ErrLocked with errors.Is.
+type LockedError struct {
+	Lock Lock
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("target is locked by %s since %s, until %s", e.Lock.Holder,
+		e.Lock.AcquiredAt.UTC().Format(time.RFC3339), e.Lock.ExpiresAt.UTC().Format(time.RFC3339))
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// LockOptions configures AcquireLock.
+type LockOptions struct {
+	// Collection is the lock collection, created if missing. It defaults to
+	// DefaultLockCollection.
+	Collection string
+	// Holder identifies the caller in the lock. It defaults to
+	// NewLockHolder("").
+	Holder string
+	// TTL is how long the lock is valid, DefaultLockTTL by default. It
+	// should exceed the longest migration, as the lock is not renewed.
+	TTL time.Duration
+	// Timeout is how long to wait for a lock held by someone else. With the
+	// default of 0, AcquireLock fails right away.
+	Timeout time.Duration
+	// RetryInterval is the time between two attempts while waiting, which
+	// defaults to DefaultLockRetryInterval.
+	RetryInterval time.Duration
+	// OnWait, if set, is called with the current lock before every wait.
+	OnWait func(held Lock)
+	// OnTakeover, if set, is called with the expired lock that was taken
+	// over.
+	OnTakeover func(stale Lock)
+}
+
+// collection returns the lock collection configured by opts.
+func (opts LockOptions) collection() string {
+	if opts.Collection == "" {
+		return DefaultLockCollection
+	}
+	return opts.Collection
+}
+
+// NewLockHolder returns a holder ID made of name, if not empty, the host
+// name, the process ID and a random suffix, so that two runs on the same
+// machine are told apart.
+func NewLockHolder(name string) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	var b [4]byte
+	rand.Read(b[:])
+	holder := fmt.Sprintf("%s/%d/%x", host, os.Getpid(), b)
+	if name != "" {
+		holder = name + "@" + holder
+	}
+	return holder
+}
+
+// lockFields are the fields of the lock collection, created by AcquireLock.
+var lockFields = []map[string]any{
+	{"field": "id", "type": "string", "meta": map[string]any{"readonly": true}, "schema": map[string]any{"is_primary_key": true, "length": 64}},
+	{"field": "holder", "type": "string", "meta": map[string]any{"readonly": true}, "schema": map[string]any{}},
+	{"field": "acquired_at", "type": "timestamp", "meta": map[string]any{"readonly": true, "width": "half"}, "schema": map[string]any{}},
+	{"field": "expires_at", "type": "timestamp", "meta": map[string]any{"readonly": true, "width": "half"}, "schema": map[string]any{}},
+}
+
+// AcquireLock locks the project against concurrent migrations by creating the
+// single item of the lock collection, which Directus refuses while it exists.
+// A lock that expired is taken over. A lock held by someone else is waited
+// for up to opts.Timeout, after which a *LockedError is returned.
+//
+// The lock is advisory: it only keeps out migrations that take it too. It
+// must be released with ReleaseLock.
+func (c *DirectusClient) AcquireLock(ctx context.Context, opts LockOptions) (*Lock, error) {
+	collection := opts.collection()
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = DefaultLockTTL
+	}
+	interval := opts.RetryInterval
+	if interval <= 0 {
+		interval = DefaultLockRetryInterval
+	}
+	holder := opts.Holder
+	if holder == "" {
+		holder = NewLockHolder("")
+	}
+	if _, err := c.ensureCollection(ctx, collection, map[string]any{"icon": "lock", "hidden": true, "note": "Held by go-mirgrate-directus while a migration runs"}, lockFields); err != nil {
+		return nil, fmt.Errorf("failed to create lock collection %s: %w", collection, err)
+	}
+
+	deadline := time.Now().Add(opts.Timeout)
+	for {
+		now := time.Now().UTC()
+		lock := Lock{ID: lockID, Holder: holder, AcquiredAt: now, ExpiresAt: now.Add(ttl)}
+		createErr := c.doJSON(ctx, "create lock", http.MethodPost, "/items/"+url.PathEscape(collection), nil, lock, nil)
+		if createErr == nil {
+			return &lock, nil
+		}
+		var directusErr *DirectusError
+		if !errors.As(createErr, &directusErr) || directusErr.StatusCode != http.StatusBadRequest {
+			return nil, fmt.Errorf("failed to create lock: %w", createErr)
+		}
+
+		held, err := c.GetLock(ctx, collection)
+		switch {
+		case err != nil:
+			return nil, err
+		case held == nil && directusErr.HasCode(CodeNotUnique):
+			// Released in the meantime.
+			continue
+		case held == nil:
+			return nil, fmt.Errorf("failed to create lock: %w", createErr)
+		case held.Holder == holder:
+			return held, nil
+		case held.Expired(now):
+			if err := c.takeOverLock(ctx, collection, *held, lock); err != nil {
+				return nil, err
+			}
+			if current, err := c.GetLock(ctx, collection); err != nil {
+				return nil, err
+			} else if current != nil && current.Holder == holder {
+				if opts.OnTakeover != nil {
+					opts.OnTakeover(*held)
+				}
+				return current, nil
+			}
+			// Someone else took it over first.
+			continue
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, &LockedError{Lock: *held}
+		}
+		if opts.OnWait != nil {
+			opts.OnWait(*held)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(min(interval, remaining)):
+		}
+	}
+}
+
+// takeOverLock replaces the expired lock stale with lock, unless stale was
+// taken over or released by someone else in the meantime: the update is
+// filtered on the holder of stale.
+func (c *DirectusClient) takeOverLock(ctx context.Context, collection string, stale, lock Lock) error {
+	payload := map[string]any{
+		"query": map[string]any{"filter": map[string]any{
+			"id":     map[string]any{"_eq": lockID},
+			"holder": map[string]any{"_eq": stale.Holder},
+		}},
+		"data": map[string]any{"holder": lock.Holder, "acquired_at": lock.AcquiredAt, "expires_at": lock.ExpiresAt},
+	}
+	if err := c.doJSON(ctx, "take over lock", http.MethodPatch, "/items/"+url.PathEscape(collection), nil, payload, nil); err != nil {
+		return fmt.Errorf("failed to take over expired lock: %w", err)
+	}
+	return nil
+}
+
+// GetLock returns the lock held on the project, or nil if it is not locked.
+func (c *DirectusClient) GetLock(ctx context.Context, collection string) (*Lock, error) {
+	if collection == "" {
+		collection = DefaultLockCollection
+	}
+	// The lock is listed rather than read by ID: Directus answers 403 both
+	// for a missing item and for a collection the token may not read, while
+	// a list is empty only when the project is not locked.
+	query := url.Values{"filter": {`{"id":{"_eq":"` + lockID + `"}}`}, "limit": {"1"}}
+	var locks []Lock
+	if err := c.doJSON(ctx, "get lock", http.MethodGet, "/items/"+url.PathEscape(collection), query, nil, &locks); err != nil {
+		return nil, fmt.Errorf("failed to get lock: %w", err)
+	}
+	if len(locks) == 0 {
+		return nil, nil
+	}
+	return &locks[0], nil
+}
+
+// ReleaseLock releases lock, acquired by AcquireLock. It does nothing if the
+// lock has since been taken over by someone else.
+func (c *DirectusClient) ReleaseLock(ctx context.Context, collection string, lock *Lock) (err error) {
+	ctx, done := startOperation(ctx, "release lock", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	if collection == "" {
+		collection = DefaultLockCollection
+	}
+	payload := map[string]any{"query": map[string]any{"filter": map[string]any{
+		"id":     map[string]any{"_eq": lockID},
+		"holder": map[string]any{"_eq": lock.Holder},
+	}}}
+	if err := c.doJSON(ctx, "release lock", http.MethodDelete, "/items/"+url.PathEscape(collection), nil, payload, nil); err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	return nil
+}
+
+// Unlock removes the lock held on the project, whoever holds it, and returns
+// it, or nil if the project was not locked. It is meant for locks left behind
+// by a crashed migration; removing a lock in use lets migrations run
+// concurrently.
+func (c *DirectusClient) Unlock(ctx context.Context, collection string) (_ *Lock, err error) {
+	ctx, done := startOperation(ctx, "unlock", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	if collection == "" {
+		collection = DefaultLockCollection
+	}
+	lock, err := c.GetLock(ctx, collection)
+	if err != nil || lock == nil {
+		return nil, err
+	}
+	err = c.doJSON(ctx, "delete lock", http.MethodDelete, "/items/"+url.PathEscape(collection)+"/"+lockID, nil, nil, nil)
+	if err != nil && !isNotFound(err) {
+		// A 403 is not taken as the lock being gone: the token may lack
+		// the delete permission.
+		return nil, fmt.Errorf("failed to delete lock: %w", err)
+	}
+	return lock, nil
+}
@@ -0,0 +1,287 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// itemsServer fakes the collections and items endpoints of Directus for a
+// single collection holding items with a string "id" and "holder". Like
+// Directus, it answers 403 for collections and items that do not exist.
+type itemsServer struct {
+	*httptest.Server
+	collection string
+
+	mu sync.Mutex
+	// exists is set once the collection is created.
+	exists bool
+	// forbidden answers 403 to every request, as for a token without
+	// permissions on the collection.
+	forbidden bool
+	items     map[string]map[string]any
+	created   int
+}
+
+func newItemsServer(t *testing.T, collection string) *itemsServer {
+	t.Helper()
+	s := &itemsServer{collection: collection, items: map[string]map[string]any{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *itemsServer) client() *gomigratedirectus.DirectusClient {
+	return gomigratedirectus.NewDirectusClient(s.URL, "token",
+		gomigratedirectus.WithLogger(slog.New(slog.DiscardHandler)))
+}
+
+func (s *itemsServer) setForbidden(forbidden bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forbidden = forbidden
+}
+
+func (s *itemsServer) createdCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.created
+}
+
+func (s *itemsServer) lock() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.items["migration"]
+}
+
+func (s *itemsServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var body map[string]any
+	json.NewDecoder(r.Body).Decode(&body)
+	forbidden := func() {
+		writeTestError(w, http.StatusForbidden, "FORBIDDEN", "You don't have permission to access this.")
+	}
+	if s.forbidden {
+		forbidden()
+		return
+	}
+	items := "/items/" + s.collection
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/collections/"+s.collection:
+		if !s.exists {
+			forbidden()
+			return
+		}
+		writeTestData(w, map[string]string{"collection": s.collection})
+	case r.Method == http.MethodGet && r.URL.Path == "/collections":
+		list := []map[string]string{{"collection": "articles"}}
+		if s.exists {
+			list = append(list, map[string]string{"collection": s.collection})
+		}
+		writeTestData(w, list)
+	case r.Method == http.MethodPost && r.URL.Path == "/collections":
+		s.exists = true
+		s.created++
+		writeTestData(w, body)
+	case !s.exists && strings.HasPrefix(r.URL.Path, items):
+		forbidden()
+	case r.Method == http.MethodGet && r.URL.Path == items:
+		list := []map[string]any{}
+		var filter map[string]map[string]string
+		json.Unmarshal([]byte(r.URL.Query().Get("filter")), &filter)
+		if item, ok := s.items[filter["id"]["_eq"]]; ok {
+			list = append(list, item)
+		}
+		writeTestData(w, list)
+	case r.Method == http.MethodPost && r.URL.Path == items:
+		id, _ := body["id"].(string)
+		if _, ok := s.items[id]; ok {
+			writeTestError(w, http.StatusBadRequest, "RECORD_NOT_UNIQUE", `Value for field "id" has to be unique.`)
+			return
+		}
+		s.items[id] = body
+		writeTestData(w, body)
+	case (r.Method == http.MethodPatch || r.Method == http.MethodDelete) && r.URL.Path == items:
+		query, _ := body["query"].(map[string]any)
+		filter, _ := query["filter"].(map[string]any)
+		id := filterValue(filter, "id")
+		item, ok := s.items[id]
+		if !ok || item["holder"] != filterValue(filter, "holder") {
+			writeTestData(w, []any{})
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(s.items, id)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		for key, value := range body["data"].(map[string]any) {
+			item[key] = value
+		}
+		writeTestData(w, []any{item})
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, items+"/"):
+		delete(s.items, strings.TrimPrefix(r.URL.Path, items+"/"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeTestError(w, http.StatusNotFound, "ROUTE_NOT_FOUND", "Route "+r.URL.Path+" doesn't exist.")
+	}
+}
+
+// filterValue returns the _eq value of field in a Directus filter.
+func filterValue(filter map[string]any, field string) string {
+	condition, _ := filter[field].(map[string]any)
+	value, _ := condition["_eq"].(string)
+	return value
+}
+
+func writeTestData(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"data": v})
+}
+
+func writeTestError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"errors": []any{map[string]any{"message": message, "extensions": map[string]string{"code": code}}},
+	})
+}
+
+func TestAcquireLock(t *testing.T) {
+	ctx := context.Background()
+	server := newItemsServer(t, gomigratedirectus.DefaultLockCollection)
+	client := server.client()
+
+	lock, err := client.AcquireLock(ctx, gomigratedirectus.LockOptions{Holder: "first"})
+	if err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+	if n := server.createdCount(); n != 1 {
+		t.Errorf("lock collection created %d times, want 1", n)
+	}
+	held, err := client.GetLock(ctx, "")
+	if err != nil || held == nil || held.Holder != "first" {
+		t.Fatalf("GetLock = %+v, %v, want the lock of first", held, err)
+	}
+
+	_, err = client.AcquireLock(ctx, gomigratedirectus.LockOptions{Holder: "second"})
+	var locked *gomigratedirectus.LockedError
+	if !errors.As(err, &locked) || !errors.Is(err, gomigratedirectus.ErrLocked) || locked.Lock.Holder != "first" {
+		t.Fatalf("second AcquireLock = %v, want a LockedError held by first", err)
+	}
+
+	if err := client.ReleaseLock(ctx, "", lock); err != nil {
+		t.Fatalf("ReleaseLock: %v", err)
+	}
+	if held, err := client.GetLock(ctx, ""); err != nil || held != nil {
+		t.Fatalf("GetLock after release = %+v, %v, want no lock", held, err)
+	}
+	if _, err := client.AcquireLock(ctx, gomigratedirectus.LockOptions{Holder: "second"}); err != nil {
+		t.Fatalf("AcquireLock after release: %v", err)
+	}
+}
+
+func TestAcquireLockTakesOverExpiredLock(t *testing.T) {
+	ctx := context.Background()
+	server := newItemsServer(t, gomigratedirectus.DefaultLockCollection)
+	client := server.client()
+	if _, err := client.AcquireLock(ctx, gomigratedirectus.LockOptions{Holder: "crashed", TTL: time.Millisecond}); err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	var stale *gomigratedirectus.Lock
+	lock, err := client.AcquireLock(ctx, gomigratedirectus.LockOptions{
+		Holder:     "next",
+		OnTakeover: func(l gomigratedirectus.Lock) { stale = &l },
+	})
+	if err != nil {
+		t.Fatalf("AcquireLock over an expired lock: %v", err)
+	}
+	if lock.Holder != "next" || server.lock()["holder"] != "next" {
+		t.Errorf("lock held by %v, want next", server.lock()["holder"])
+	}
+	if stale == nil || stale.Holder != "crashed" {
+		t.Errorf("OnTakeover called with %+v, want the lock of crashed", stale)
+	}
+}
+
+func TestAcquireLockWaitsForTimeout(t *testing.T) {
+	ctx := context.Background()
+	server := newItemsServer(t, gomigratedirectus.DefaultLockCollection)
+	client := server.client()
+	held, err := client.AcquireLock(ctx, gomigratedirectus.LockOptions{Holder: "first"})
+	if err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+
+	waits := 0
+	_, err = client.AcquireLock(ctx, gomigratedirectus.LockOptions{
+		Holder:        "second",
+		Timeout:       50 * time.Millisecond,
+		RetryInterval: 10 * time.Millisecond,
+		OnWait: func(gomigratedirectus.Lock) {
+			if waits++; waits == 2 {
+				client.ReleaseLock(ctx, "", held)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("AcquireLock waiting for a release: %v", err)
+	}
+	if server.lock()["holder"] != "second" {
+		t.Errorf("lock held by %v, want second", server.lock()["holder"])
+	}
+}
+
+func TestLockForbidden(t *testing.T) {
+	ctx := context.Background()
+	server := newItemsServer(t, gomigratedirectus.DefaultLockCollection)
+	client := server.client()
+	if _, err := client.AcquireLock(ctx, gomigratedirectus.LockOptions{Holder: "first"}); err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+	server.setForbidden(true)
+
+	// A token that may not read the lock must not be told the project is
+	// unlocked, or two migrations could run at once.
+	if lock, err := client.GetLock(ctx, ""); err == nil || !gomigratedirectus.IsForbidden(err) {
+		t.Errorf("GetLock = %+v, %v, want a forbidden error", lock, err)
+	}
+	if lock, err := client.Unlock(ctx, ""); err == nil || !gomigratedirectus.IsForbidden(err) {
+		t.Errorf("Unlock = %+v, %v, want a forbidden error", lock, err)
+	}
+	if _, err := client.AcquireLock(ctx, gomigratedirectus.LockOptions{Holder: "second"}); err == nil {
+		t.Error("AcquireLock succeeded without permissions")
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	ctx := context.Background()
+	server := newItemsServer(t, gomigratedirectus.DefaultLockCollection)
+	client := server.client()
+	if _, err := client.AcquireLock(ctx, gomigratedirectus.LockOptions{Holder: "crashed"}); err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+
+	lock, err := client.Unlock(ctx, "")
+	if err != nil || lock == nil || lock.Holder != "crashed" {
+		t.Fatalf("Unlock = %+v, %v, want the lock of crashed", lock, err)
+	}
+	if server.lock() != nil {
+		t.Error("lock still held after Unlock")
+	}
+	if lock, err := client.Unlock(ctx, ""); err != nil || lock != nil {
+		t.Errorf("Unlock of an unlocked project = %+v, %v, want nil, nil", lock, err)
+	}
+}
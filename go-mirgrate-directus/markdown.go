@@ -0,0 +1,197 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+)
+
+// MarkdownOptions configures RenderMarkdownWithOptions.
+type MarkdownOptions struct {
+	// Title is the heading of the report, "Schema changes" by default.
+	Title string
+	// FilteredFields is noted below the summary table, as in
+	// DiffSummary.FilteredFields.
+	FilteredFields int
+}
+
+// RenderMarkdown returns a Markdown report of diff, meant to be posted as a
+// pull request comment: a table counting the created, updated and deleted
+// items of each kind, a warning listing the destructive changes if any, and
+// a collapsible section per collection with the changes of the collection,
+// its fields and its relations. Collections, items and changed properties are
+// sorted, so that the report of a diff does not change from one run to the
+// next.
+func RenderMarkdown(diff *Diff) string {
+	return RenderMarkdownWithOptions(diff, MarkdownOptions{})
+}
+
+// RenderMarkdownWithOptions returns the report of diff like RenderMarkdown,
+// as configured by opts.
+func RenderMarkdownWithOptions(diff *Diff, opts MarkdownOptions) string {
+	title := opts.Title
+	if title == "" {
+		title = "Schema changes"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s\n\n", title)
+
+	summary := SummarizeDiff(diff)
+	if !summary.Changed() {
+		b.WriteString("No changes, the schemas are in sync.\n")
+		return b.String()
+	}
+
+	if destructive := FindDestructiveChanges(diff); len(destructive) > 0 {
+		sort.SliceStable(destructive, func(i, j int) bool {
+			x, y := destructive[i], destructive[j]
+			if x.Collection != y.Collection {
+				return x.Collection < y.Collection
+			}
+			return x.Field < y.Field
+		})
+		b.WriteString("> [!WARNING]\n> This migration contains destructive changes that can lose data:\n")
+		for _, change := range destructive {
+			fmt.Fprintf(&b, "> - %s\n", change)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("| | Created | Updated | Deleted |\n| --- | ---: | ---: | ---: |\n")
+	for _, kind := range []struct {
+		name   string
+		counts ChangeCounts
+	}{
+		{"Collections", summary.Collections},
+		{"Fields", summary.Fields},
+		{"Relations", summary.Relations},
+	} {
+		fmt.Fprintf(&b, "| %s | %d | %d | %d |\n", kind.name, kind.counts.Created, kind.counts.Updated, kind.counts.Deleted)
+	}
+	switch opts.FilteredFields {
+	case 0:
+	case 1:
+		b.WriteString("\n_1 field filtered out._\n")
+	default:
+		fmt.Fprintf(&b, "\n_%d fields filtered out._\n", opts.FilteredFields)
+	}
+
+	for _, group := range groupDiff(diff) {
+		var counts DiffSummary
+		if group.collection != nil {
+			count(&counts.Collections, group.collection.Diff)
+		}
+		for _, field := range group.fields {
+			count(&counts.Fields, field.Diff)
+		}
+		for _, relation := range group.relations {
+			count(&counts.Relations, relation.Diff)
+		}
+		fmt.Fprintf(&b, "\n<details>\n<summary><code>%s</code>: %s</summary>\n\n", html.EscapeString(group.name), html.EscapeString(counts.String()))
+
+		if group.collection != nil {
+			change := ClassifyEntries(group.collection.Diff)
+			fmt.Fprintf(&b, "- Collection %s\n", markdownChange(change))
+			if change == ChangeUpdated {
+				markdownEntries(&b, "  ", group.collection.Diff)
+			}
+		}
+		for _, field := range group.fields {
+			change := ClassifyEntries(field.Diff)
+			fmt.Fprintf(&b, "- Field %s %s\n", markdownCode(field.Field), markdownChange(change))
+			if change == ChangeUpdated {
+				markdownEntries(&b, "  ", field.Diff)
+			}
+		}
+		for _, relation := range group.relations {
+			target := relation.RelatedCollection
+			if target == "" {
+				target = "(any)"
+			}
+			change := ClassifyEntries(relation.Diff)
+			fmt.Fprintf(&b, "- Relation %s → %s %s\n", markdownCode(relation.Field), markdownCode(target), markdownChange(change))
+			if change == ChangeUpdated {
+				markdownEntries(&b, "  ", relation.Diff)
+			}
+		}
+		b.WriteString("\n</details>\n")
+	}
+	return b.String()
+}
+
+// markdownChange describes change, in bold for a deletion.
+func markdownChange(change ChangeType) string {
+	switch change {
+	case ChangeCreated:
+		return "created"
+	case ChangeDeleted:
+		return "**deleted**"
+	default:
+		return "updated"
+	}
+}
+
+// markdownEntries writes one list item per deep-diff entry, sorted by path.
+func markdownEntries(b *strings.Builder, indent string, entries []DiffEntry) {
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		lines = append(lines, markdownEntry(entry))
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Fprintf(b, "%s- %s\n", indent, line)
+	}
+}
+
+// markdownEntry formats a single deep-diff entry like describeEntry.
+func markdownEntry(entry DiffEntry) string {
+	path := markdownCode(formatPath(entry.Path))
+	switch entry.Kind {
+	case KindEdited:
+		return fmt.Sprintf("%s: %s → %s", path, markdownValue(entry.Lhs), markdownValue(entry.Rhs))
+	case KindNew:
+		return fmt.Sprintf("%s added: %s", path, markdownValue(entry.Rhs))
+	case KindDeleted:
+		return fmt.Sprintf("%s removed, was %s", path, markdownValue(entry.Lhs))
+	case KindArray:
+		if entry.Item != nil && entry.Index != nil {
+			item := *entry.Item
+			item.Path = append(append([]any{}, entry.Path...), *entry.Index)
+			return markdownEntry(item)
+		}
+	}
+	raw, _ := json.Marshal(entry)
+	return fmt.Sprintf("%s: %s", path, markdownCode(truncate(string(raw))))
+}
+
+// markdownValue formats a raw JSON value as a code span, compacted so that
+// indented values stay on one line.
+func markdownValue(raw json.RawMessage) string {
+	var compact bytes.Buffer
+	if json.Compact(&compact, raw) == nil {
+		raw = compact.Bytes()
+	}
+	return markdownCode(formatValue(raw))
+}
+
+// markdownCode formats s as a code span, with a fence longer than any run of
+// backticks in s.
+func markdownCode(s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if longest > 0 || strings.HasPrefix(s, " ") || strings.HasSuffix(s, " ") {
+		return fence + " " + s + " " + fence
+	}
+	return fence + s + fence
+}
@@ -0,0 +1,139 @@
+package gomirgratedirectus
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Results of a migration, as counted by the migrations_total metric.
+const (
+	MigrationResultApplied  = "applied"
+	MigrationResultInSync   = "in_sync"
+	MigrationResultDryRun   = "dry_run"
+	MigrationResultDeclined = "declined"
+	MigrationResultFailed   = "failed"
+)
+
+// Metrics holds the Prometheus metrics of migrations and of the requests sent
+// to Directus. Pass it as MigrationOptions.Metrics and to the clients with
+// WithMetrics. A nil *Metrics records nothing.
+type Metrics struct {
+	migrations    *prometheus.CounterVec
+	phaseDuration *prometheus.HistogramVec
+	requests      *prometheus.CounterVec
+	lastSuccess   *prometheus.GaugeVec
+}
+
+// NewMetrics creates the metrics and registers them with reg:
+//
+//	migrations_total{result}                     migrations by result, such as applied or failed
+//	migration_duration_seconds{phase}            duration of each phase, such as snapshot, diff or apply
+//	directus_http_requests_total{endpoint,status} requests by operation and status code
+//	last_successful_migration_timestamp{target}  Unix time of the last successful migration
+//
+// endpoint is the client operation, such as snapshot or list roles, rather
+// than the request path so that item IDs do not multiply the series. status
+// is "error" for requests that got no response.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		migrations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "migrations_total",
+			Help: "Number of migrations by result.",
+		}, []string{"result"}),
+		phaseDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "migration_duration_seconds",
+			Help:    "Duration of the phases of a migration.",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		}, []string{"phase"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "directus_http_requests_total",
+			Help: "Number of HTTP requests sent to Directus by operation and status code.",
+		}, []string{"endpoint", "status"}),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "last_successful_migration_timestamp",
+			Help: "Unix time of the last successful migration of each target.",
+		}, []string{"target"}),
+	}
+	for _, c := range []prometheus.Collector{m.migrations, m.phaseDuration, m.requests, m.lastSuccess} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// MetricsHandler returns an http.Handler serving the metrics gathered by g in
+// the Prometheus text format, to mount on /metrics.
+func MetricsHandler(g prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+}
+
+// WithMetrics counts the requests of the client in metrics.
+func WithMetrics(metrics *Metrics) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.metrics = metrics
+	}
+}
+
+// observeRequest counts one request of op, answered by resp or failed with
+// err.
+func (m *Metrics) observeRequest(op string, resp *http.Response, err error) {
+	if m == nil {
+		return
+	}
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	m.requests.WithLabelValues(op, status).Inc()
+}
+
+// migrationMetrics records the phases of one migration.
+type migrationMetrics struct {
+	metrics *Metrics
+}
+
+// track returns the recorder of one migration, nil if m is nil.
+func (m *Metrics) track() *migrationMetrics {
+	if m == nil {
+		return nil
+	}
+	return &migrationMetrics{metrics: m}
+}
+
+// observePhase observes the duration of a phase, as recorded in the
+// MigrationStats of the migration. A failed phase is observed up to the
+// failure.
+func (mm *migrationMetrics) observePhase(phase PhaseStats) {
+	if mm == nil {
+		return
+	}
+	mm.metrics.phaseDuration.WithLabelValues(phase.Phase).Observe(phase.Duration.Seconds())
+}
+
+// finish counts the migration of target by its outcome and, if it succeeded
+// outside of a dry run, records the time as its last successful migration.
+func (mm *migrationMetrics) finish(target string, dryRun bool, result *MigrationResult, err error) {
+	if mm == nil {
+		return
+	}
+	outcome := MigrationResultInSync
+	switch {
+	case errors.Is(err, ErrNotConfirmed):
+		outcome = MigrationResultDeclined
+	case err != nil:
+		outcome = MigrationResultFailed
+	case dryRun:
+		outcome = MigrationResultDryRun
+	case result.Applied:
+		outcome = MigrationResultApplied
+	}
+	mm.metrics.migrations.WithLabelValues(outcome).Inc()
+	if err == nil && !dryRun {
+		mm.metrics.lastSuccess.WithLabelValues(RedactURL(target)).SetToCurrentTime()
+	}
+}
@@ -0,0 +1,1320 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MigrationOptions configures MigrateWithOptions. The zero value performs a
+// plain migration, exactly like Migrate with force set to false.
+type MigrationOptions struct {
+	// Force computes the diff even if the Directus versions or database
+	// vendors of base and target differ.
+	Force bool
+	// DryRun stops after computing and printing the diff; nothing is applied.
+	DryRun bool
+	// Timeout bounds the whole migration. Zero means no limit beyond the
+	// context passed to MigrateWithOptions.
+	Timeout time.Duration
+	// WaitForReady polls the health of both instances for up to this long
+	// before starting. Zero skips the wait.
+	WaitForReady time.Duration
+	// ReadyInterval is the polling interval for WaitForReady. It defaults to
+	// two seconds.
+	ReadyInterval time.Duration
+	// Logger receives the progress messages. It defaults to slog.Default().
+	Logger *slog.Logger
+	// Output receives data explicitly requested from the migration, such as
+	// the rendered diff of a dry run. It defaults to os.Stdout.
+	Output io.Writer
+	// Color renders the diff of a dry run with ANSI colors; see
+	// RenderOptions.
+	Color bool
+	// OnEvent, if set, is called synchronously with every progress event,
+	// including PhaseFailed when the migration fails.
+	OnEvent func(Event)
+	// Source, if set, provides the base snapshot instead of the base
+	// client, which may then be nil; see FileSource.
+	Source SnapshotSource
+	// IncludeCollections, if not empty, limits the migration to the
+	// collections matching one of these exact names or path.Match globs.
+	IncludeCollections []string
+	// ExcludeCollections leaves the collections matching one of these
+	// patterns out of the migration, even if they are included. The
+	// filtered collections are removed from the base snapshot, with their
+	// fields and relations, and from the diff, so they are neither created
+	// nor deleted on the target; see FilterSnapshot.
+	ExcludeCollections []string
+	// ExcludeFields leaves the fields matching one of these collection.field
+	// patterns, such as "*.webhook_url", out of the base snapshot and the
+	// diff. The summary reports how many fields were filtered.
+	ExcludeFields []string
+	// SystemCollections decides whether the custom fields and relations of
+	// the directus_* system collections are migrated: SystemInclude, the
+	// default, SystemExclude or SystemOnly.
+	SystemCollections SystemCollectionsPolicy
+	// Overlays are merged onto the base snapshot in order, before it is
+	// filtered, to account for the differences of the target environment;
+	// see MergeOverlay. Conflicts are logged as warnings, or with
+	// StrictOverlays fail the migration.
+	Overlays       []*Overlay
+	StrictOverlays bool
+	// ScopeCollections, if not empty, limits the migration to these exact
+	// collections and the junction collections between them, which are
+	// pulled in with a SnapshotScoped event; see ScopeCollections. The base
+	// snapshot is pruned to them before the diff and the diff to their
+	// changes, so the apply cannot touch anything else. Unknown names fail
+	// the migration.
+	ScopeCollections []string
+	// OnlyCollections, if not empty, applies only the changes of the diff
+	// to the collections matching one of these names or globs, their fields
+	// and the relations of their fields; see SelectCollections. Unlike
+	// IncludeCollections the base snapshot is not narrowed, so the other
+	// changes stay pending.
+	OnlyCollections []string
+	// SelectChanges, if set, is called with the changes of the diff, after
+	// OnlyCollections, and returns the keys of those to apply, before the
+	// diff is confirmed. Choosing none declines the diff like Confirm.
+	SelectChanges SelectFunc
+	// LenientRelations logs the problems ValidateRelations finds in the base
+	// snapshot as warnings instead of failing the migration before the diff.
+	LenientRelations bool
+	// AllowDestructive lets a diff with destructive changes, as found by
+	// FindDestructiveChanges, be applied. Such diffs are refused by default.
+	AllowDestructive bool
+	// MaxDeletions, if positive, refuses diffs deleting more collections and
+	// fields than this even with AllowDestructive.
+	MaxDeletions int
+	// NoBackup disables the backup of the target snapshot that is saved to
+	// BackupDir right before the diff is applied, and the undo record of
+	// RecordUndo saved next to it once the diff was applied.
+	NoBackup bool
+	// BackupDir defaults to DefaultBackupDir.
+	BackupDir string
+	// BackupStore, if set, keeps the backups instead of BackupDir, such as
+	// an S3Store for CI runners whose disks do not outlive the job.
+	BackupStore SnapshotStore
+	// BackupRepository, if set, keeps the backups instead as snapshots of
+	// the environment BackupEnv of a SnapshotRepository, BackupEnvName of
+	// the target URL by default. Tagged backups are never pruned.
+	BackupRepository *SnapshotRepository
+	BackupEnv        string
+	// BackupRetention is the number of backups kept in BackupDir,
+	// BackupStore or BackupRepository. It defaults to DefaultBackupRetention; a negative value
+	// keeps all.
+	BackupRetention int
+	// Rollback restores the target snapshot taken before applying when the
+	// apply fails, because /schema/apply is not transactional on every
+	// database. The rollback runs even if ctx was canceled, bounded by the
+	// client timeouts.
+	Rollback bool
+	// SyncFiles copies the folders of the base and the files referenced by
+	// the items of DataCollections and by the synced settings, or all files
+	// with AllFiles, to the target with SyncFiles right after the schema
+	// migration, or reports what would change in a dry run. It requires a
+	// base client.
+	SyncFiles bool
+	AllFiles  bool
+	// DataCollections selects the collections whose items are copied from
+	// the base to the target with SyncData after the schema migration and
+	// any files, or counted in a dry run. It requires a base client.
+	DataCollections []DataCollection
+	// DataBatchSize configures SyncData; see DataSyncOptions.
+	DataBatchSize int
+	// SyncPermissions copies the roles and permissions of the base to the
+	// target with SyncPermissions once the schema has been migrated, or
+	// reports what would change in a dry run. It requires a base client.
+	SyncPermissions bool
+	// SyncUsers provisions the non-admin base users selected by UserRoles
+	// and UserEmails on the target with SyncUsers after roles and
+	// permissions, or reports what would change in a dry run. It requires a
+	// base client.
+	SyncUsers bool
+	// UserRoles, UserEmails, UserPassword, InviteUsers and InviteURL
+	// configure SyncUsers; see UserSyncOptions.
+	UserRoles    []string
+	UserEmails   []string
+	UserPassword string
+	InviteUsers  bool
+	InviteURL    string
+	// SyncPresets copies the global and role presets of the base to the
+	// target with SyncPresets after roles and permissions, or reports what
+	// would change in a dry run. PrunePresets also deletes the shared target
+	// presets the base does not have. It requires a base client.
+	SyncPresets  bool
+	PrunePresets bool
+	// SyncTranslations upserts the custom translations of the base on the
+	// target with SyncTranslations after presets, or reports what would
+	// change in a dry run. It requires a base client.
+	SyncTranslations bool
+	// PruneTranslations and TranslationsBatchSize configure
+	// SyncTranslations; see TranslationSyncOptions.
+	PruneTranslations     bool
+	TranslationsBatchSize int
+	// SyncWebhooks copies the legacy webhooks of the base to the target with
+	// SyncWebhooks after translations, or reports what would change in a dry
+	// run. It requires a base client.
+	SyncWebhooks bool
+	// PruneWebhooks and WebhookURLs configure SyncWebhooks; see
+	// WebhookSyncOptions.
+	PruneWebhooks WebhookPrunePolicy
+	WebhookURLs   map[string]string
+	// SyncSettings copies the project settings listed in SettingsKeys, or
+	// DefaultSettingsKeys, from the base to the target with SyncSettings
+	// after webhooks, or reports what would change in a dry run. It requires
+	// a base client.
+	SyncSettings bool
+	SettingsKeys []string
+	// SyncFlows copies the flows and operations of the base to the target
+	// with SyncFlows after project settings, or reports what would change in
+	// a dry run. It requires a base client.
+	SyncFlows bool
+	// PruneFlows, KeepFlowOptions and FlowSecrets configure SyncFlows; see
+	// FlowSyncOptions.
+	PruneFlows      bool
+	KeepFlowOptions bool
+	FlowSecrets     map[string]string
+	// SyncDashboards copies the Insights dashboards and panels of the base to
+	// the target with SyncDashboards last, or reports what would change in a
+	// dry run. It requires a base client.
+	SyncDashboards bool
+	// Resume skips the sync phases, and the data collections, that the
+	// Checkpoint left by a failed run against the same target recorded as
+	// completed, provided the base snapshot and the target schema hash
+	// are still those it recorded. The schema phase always runs; it finds
+	// nothing to apply when the earlier run applied it. The checkpoint is
+	// kept by every migration with sync phases that is not a dry run, and
+	// removed once it succeeded.
+	Resume bool
+	// CheckpointStore keeps the checkpoints, named by CheckpointName. It
+	// defaults to the store of the backups.
+	CheckpointStore SnapshotStore
+	// PhaseRateLimits overrides the rate limit of the base and target
+	// clients during the sync phases it lists, such as PhaseData or
+	// PhaseFiles, each client being limited separately; see
+	// ContextWithRateLimit.
+	PhaseRateLimits map[string]RateLimit
+	// RecordHistory records every attempt to apply a diff, successful or
+	// not, as a HistoryEntry in the HistoryCollection of the target, which
+	// defaults to DefaultHistoryCollection and is created before the first
+	// apply if missing. The collection is left out of the migration. Operator
+	// names who ran the migration in the entries.
+	RecordHistory     bool
+	HistoryCollection string
+	Operator          string
+	// Lock takes the lock of the target with AcquireLock before anything
+	// is changed and releases it once the migration is over, so that two
+	// migrations never apply to the same target at once. It is not taken by
+	// dry runs. LockOptions configures it; its holder defaults to
+	// NewLockHolder(Operator). The lock collection is left out of the
+	// migration.
+	Lock        bool
+	LockOptions LockOptions
+	// Cache, if set, skips the diff and the apply when it shows that the
+	// target is still in sync with the same base snapshot: the last
+	// migration recorded in the history collection, when RecordHistory is
+	// set, applied that snapshot, and the target schema has not changed
+	// since, which costs a fetch of the target snapshot. The cache is
+	// updated after every migration that left the target in sync, with one
+	// more fetch. See NewSchemaCache and OpenSchemaCache.
+	Cache *SchemaCache
+	// Hook, if set, is called at each stage of a migration that is not a
+	// dry run, such as to generate types once a diff was applied; see
+	// HookFunc. StrictHooks fails the migration when a post_apply hook
+	// fails, once the diff is applied.
+	Hook        HookFunc
+	StrictHooks bool
+	// ContinueOnError makes MigrateToTargets migrate the remaining targets
+	// after one failed, instead of skipping them.
+	ContinueOnError bool
+	// Parallel is the number of targets MigrateToTargets migrates at once.
+	// Zero or one migrates them in turn.
+	Parallel int
+	// BeforeDiff, if set, is called with the filtered base snapshot before
+	// it is validated and diffed, and the snapshot it returns is diffed
+	// instead. It is called for dry runs too. An error fails the migration.
+	BeforeDiff func(ctx context.Context, snapshot *Snapshot) (*Snapshot, error)
+	// BeforeApply, if set, is called with the filtered diff as soon as it is
+	// computed, and the diff it returns is what is checked, shown, confirmed
+	// and applied, such as with the changes to a collection owned by another
+	// service stripped. It runs before the dry run ends and before the
+	// destructive change checks, so that both see the diff that would be
+	// sent, again on the recomputed diff if a failed apply is retried, and
+	// on the diff of VerifyAfterApply.
+	// Returning an empty diff leaves nothing to apply; an error vetoes the
+	// migration with ErrVetoed.
+	BeforeApply func(ctx context.Context, diff *Diff) (*Diff, error)
+	// VerifyAfterApply decides what happens once the diff was applied: the
+	// base snapshot is diffed against the target again, narrowed like the
+	// applied diff, and the changes left are reported in
+	// MigrationResult.Residual with a VerifyCompleted event. Empty means
+	// VerifyWarn; see VerifyPolicy.
+	VerifyAfterApply VerifyPolicy
+	// AfterApply, if set, is called once the diff was applied, before the
+	// other phases run. An error fails the migration, which stays applied.
+	AfterApply func(ctx context.Context, result *MigrationResult) error
+	// Confirm, if set, is asked before the diff is applied, so that
+	// embedders can put their own UI in front of destructive changes. It is
+	// not called for dry runs or when the schemas are already in sync.
+	Confirm ConfirmFunc
+	// Metrics, if set, counts the migration by result and times its
+	// snapshot, diff and apply phases; see NewMetrics.
+	Metrics *Metrics
+	// TracerProvider, if set, traces the migration with a Migrate span,
+	// child spans for the snapshot, diff and apply phases, and otelhttp spans
+	// for the requests sent to Directus. Nil adds no tracing at all.
+	TracerProvider trace.TracerProvider
+}
+
+// schemaFilter returns the SchemaFilter configured by opts, which excludes
+// the history collection when it is recorded.
+func (opts MigrationOptions) schemaFilter() SchemaFilter {
+	filter := SchemaFilter{
+		IncludeCollections: opts.IncludeCollections,
+		ExcludeCollections: opts.ExcludeCollections,
+		ExcludeFields:      opts.ExcludeFields,
+		SystemCollections:  opts.SystemCollections,
+	}
+	if opts.RecordHistory {
+		filter.ExcludeCollections = append(slices.Clip(filter.ExcludeCollections), opts.historyCollection())
+	}
+	if opts.Lock {
+		filter.ExcludeCollections = append(slices.Clip(filter.ExcludeCollections), opts.LockOptions.collection())
+	}
+	return filter
+}
+
+// syncPhases reports whether the migration has phases after the schema.
+func (opts MigrationOptions) syncPhases() bool {
+	return opts.SyncFiles || len(opts.DataCollections) > 0 || opts.SyncPermissions || opts.SyncUsers ||
+		opts.SyncPresets || opts.SyncTranslations || opts.SyncWebhooks || opts.SyncSettings ||
+		opts.SyncFlows || opts.SyncDashboards
+}
+
+// SyncPhases lists the phases run after the schema, in order, whose rate
+// limit MigrationOptions.PhaseRateLimits may set.
+var SyncPhases = []string{
+	PhaseFiles, PhaseData, PhasePermissions, PhaseUsers, PhasePresets, PhaseTranslations,
+	PhaseWebhooks, PhaseSettings, PhaseFlows, PhaseDashboards,
+}
+
+// historyCollection returns the collection migrations are recorded in.
+func (opts MigrationOptions) historyCollection() string {
+	if opts.HistoryCollection == "" {
+		return DefaultHistoryCollection
+	}
+	return opts.HistoryCollection
+}
+
+// ConfirmFunc decides whether the diff summarized by summary may be applied
+// to the project at target, whose URL is redacted. Returning false stops the
+// migration with ErrNotConfirmed; an error fails it.
+type ConfirmFunc func(ctx context.Context, target string, diff *Diff, summary DiffSummary) (bool, error)
+
+// SelectFunc chooses the changes of a diff to apply to target, returning the
+// keys of the chosen items; see MigrationOptions.SelectChanges.
+type SelectFunc func(ctx context.Context, target string, items []DiffItem) ([]string, error)
+
+// ErrNotConfirmed is returned by MigrateWithOptions when
+// MigrationOptions.Confirm declined the diff.
+var ErrNotConfirmed = errors.New("changes were not confirmed")
+
+// ErrVetoed is returned by MigrateWithOptions, wrapping the error of the
+// callback, when MigrationOptions.BeforeApply refused the diff.
+var ErrVetoed = errors.New("migration vetoed by hook")
+
+// MigrationResult describes the outcome of MigrateWithOptions.
+type MigrationResult struct {
+	// Diff is the diff computed against the target, nil when the schemas
+	// were already in sync.
+	Diff *Diff
+	// Summary condenses Diff.
+	Summary DiffSummary
+	// Changed reports whether the target differed from the base.
+	Changed bool
+	// DestructiveChanges lists the changes of Diff that can lose data.
+	DestructiveChanges []DestructiveChange
+	// Applied reports whether the diff was applied. It is false for dry runs.
+	Applied bool
+	// BackupPath is the file the target snapshot was saved to before
+	// applying, empty when no backup was taken.
+	BackupPath string
+	// UndoPath is the undo record saved next to the backup after applying,
+	// empty when none was.
+	UndoPath string
+	// RolledBack reports whether the target was restored after a failed
+	// apply.
+	RolledBack bool
+	// Verified reports that the target was diffed against the base again
+	// after applying, as configured by MigrationOptions.VerifyAfterApply.
+	// Residual is what that diff still found, nil when the target matches
+	// the base, and ResidualSummary condenses it.
+	Verified        bool
+	Residual        *Diff
+	ResidualSummary DiffSummary
+	// Files describes the synced folders and files when
+	// MigrationOptions.SyncFiles is set.
+	Files *FilesResult
+	// Data counts the synced items when MigrationOptions.DataCollections is
+	// set.
+	Data *DataResult
+	// Permissions describes the synced roles and permissions when
+	// MigrationOptions.SyncPermissions is set.
+	Permissions *PermissionsResult
+	// Users describes the provisioned users when MigrationOptions.SyncUsers
+	// is set.
+	Users *UsersResult
+	// Presets describes the synced presets when MigrationOptions.SyncPresets
+	// is set.
+	Presets *PresetsResult
+	// Translations describes the synced translations when
+	// MigrationOptions.SyncTranslations is set.
+	Translations *TranslationsResult
+	// Webhooks describes the synced webhooks when
+	// MigrationOptions.SyncWebhooks is set.
+	Webhooks *WebhooksResult
+	// Settings describes the synced project settings when
+	// MigrationOptions.SyncSettings is set.
+	Settings *SettingsResult
+	// Flows describes the synced flows when MigrationOptions.SyncFlows is
+	// set.
+	Flows *FlowsResult
+	// Dashboards describes the synced dashboards when
+	// MigrationOptions.SyncDashboards is set.
+	Dashboards *DashboardsResult
+	// Stats holds the duration of every phase, the size of the snapshot and
+	// the diff transferred, and the totals.
+	Stats MigrationStats
+}
+
+// Migrate performs a full schema migration from a base project to a target project.
+// Canceling ctx aborts any in-flight request; the returned error then wraps ctx.Err().
+// Use MigrateWithOptions to learn whether anything was applied.
+func Migrate(ctx context.Context, baseURL, baseToken, targetURL, targetToken string, force bool) error {
+	return MigrateClients(ctx, NewDirectusClient(baseURL, baseToken), NewDirectusClient(targetURL, targetToken), force)
+}
+
+// MigrateClients performs a full schema migration between two already
+// configured clients, for example clients created with
+// NewDirectusClientWithCredentials.
+func MigrateClients(ctx context.Context, baseClient, targetClient *DirectusClient, force bool) error {
+	_, err := MigrateWithOptions(ctx, baseClient, targetClient, MigrationOptions{Force: force})
+	return err
+}
+
+// DryRun runs a migration up to and including the diff computation, prints
+// the rendered diff and its summary, and returns the pending diff without
+// applying it. It returns a nil diff when the schemas are already in sync.
+// As in a real migration, force only affects how the diff is computed.
+func DryRun(ctx context.Context, baseClient, targetClient *DirectusClient, force bool) (*Diff, error) {
+	result, err := MigrateWithOptions(ctx, baseClient, targetClient, MigrationOptions{Force: force, DryRun: true})
+	if err != nil {
+		return nil, err
+	}
+	return result.Diff, nil
+}
+
+// MigrateWithOptions migrates the schema of baseClient to targetClient.
+//
+// Before fetching the snapshot, the Directus versions of both instances are
+// compared with CheckVersions; a mismatch aborts the migration unless
+// opts.Force is set. The snapshot is checked with ValidateSnapshot and
+// ValidateRelations before it is diffed. When opts.Source is set, it replaces
+// baseClient as the origin of both the snapshot and the base version.
+func MigrateWithOptions(ctx context.Context, baseClient, targetClient *DirectusClient, opts MigrationOptions) (result *MigrationResult, err error) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	result = &MigrationResult{}
+	m := &migration{
+		opts:     opts,
+		filter:   opts.schemaFilter(),
+		reporter: logReporter{logger: logger, out: out, color: opts.Color},
+		metrics:  opts.Metrics.track(),
+		stats:    newStatsRecorder(&result.Stats),
+	}
+	defer func() {
+		m.stats.finish()
+		m.metrics.finish(targetClient.URL, opts.DryRun, result, err)
+	}()
+	if opts.TracerProvider != nil {
+		ctx = withTracerProvider(ctx, opts.TracerProvider)
+	}
+	ctx, span := m.startSpan(ctx, "Migrate",
+		attribute.String("directus.target.url", RedactURL(targetClient.URL)),
+		attribute.Bool("directus.dry_run", opts.DryRun))
+	defer func() {
+		span.SetAttributes(attribute.Bool("directus.changed", result.Changed), attribute.Bool("directus.applied", result.Applied),
+			attribute.Int("directus.diff.entries", result.Stats.DiffEntries), attribute.Int64("directus.bytes", result.Stats.Bytes))
+		endSpan(span, err)
+	}()
+	if err := m.filter.Validate(); err != nil {
+		return result, err
+	}
+	if err := opts.VerifyAfterApply.Validate(); err != nil {
+		return result, err
+	}
+	for phase := range opts.PhaseRateLimits {
+		if !slices.Contains(SyncPhases, phase) {
+			return result, fmt.Errorf("cannot rate limit phase %q, expected one of %s", phase, strings.Join(SyncPhases, ", "))
+		}
+	}
+	if opts.SyncFiles && baseClient == nil {
+		return result, fmt.Errorf("files can only be synced from a live base project")
+	}
+	if len(opts.DataCollections) > 0 && baseClient == nil {
+		return result, fmt.Errorf("data can only be synced from a live base project")
+	}
+	if opts.SyncPermissions && baseClient == nil {
+		return result, fmt.Errorf("permissions can only be synced from a live base project")
+	}
+	if opts.SyncUsers && baseClient == nil {
+		return result, fmt.Errorf("users can only be synced from a live base project")
+	}
+	if opts.SyncPresets && baseClient == nil {
+		return result, fmt.Errorf("presets can only be synced from a live base project")
+	}
+	if opts.SyncTranslations && baseClient == nil {
+		return result, fmt.Errorf("translations can only be synced from a live base project")
+	}
+	if opts.SyncWebhooks && baseClient == nil {
+		return result, fmt.Errorf("webhooks can only be synced from a live base project")
+	}
+	if opts.SyncSettings && baseClient == nil {
+		return result, fmt.Errorf("settings can only be synced from a live base project")
+	}
+	if opts.SyncFlows && baseClient == nil {
+		return result, fmt.Errorf("flows can only be synced from a live base project")
+	}
+	if opts.SyncDashboards && baseClient == nil {
+		return result, fmt.Errorf("dashboards can only be synced from a live base project")
+	}
+
+	source := opts.Source
+	clients := []*DirectusClient{targetClient}
+	if source == nil {
+		source = ClientSource(baseClient)
+		clients = []*DirectusClient{baseClient, targetClient}
+	}
+
+	if opts.WaitForReady > 0 {
+		interval := opts.ReadyInterval
+		if interval <= 0 {
+			interval = 2 * time.Second
+		}
+		for _, client := range clients {
+			m.emit(&WaitStarted{URL: RedactURL(client.URL)})
+			if err := client.WaitForReady(ctx, interval, opts.WaitForReady); err != nil {
+				return result, m.fail(PhaseWait, err)
+			}
+		}
+	}
+
+	if opts.Lock && !opts.DryRun {
+		lock, err := m.acquireLock(ctx, targetClient)
+		if err != nil {
+			return result, m.fail(PhaseLock, err)
+		}
+		defer m.releaseLock(ctx, targetClient, lock)
+	}
+	if opts.Hook != nil && !opts.DryRun {
+		// Hooks run while the target is still locked.
+		defer func() { err = m.finishHooks(ctx, targetClient, result, err) }()
+		if err := m.runHook(ctx, HookPreSnapshot, targetClient, result, nil); err != nil {
+			return result, m.fail(PhaseHooks, err)
+		}
+	}
+
+	if opts.syncPhases() && !opts.DryRun {
+		if err := m.openCheckpoint(ctx, targetClient); err != nil {
+			return result, m.fail(PhaseCheckpoint, err)
+		}
+	}
+	if err := m.migrateSchema(ctx, source, targetClient, result); err != nil {
+		return result, err
+	}
+	m.completePhase(ctx, targetClient, PhaseApply)
+	if opts.SyncFiles {
+		if err := m.runPhase(ctx, targetClient, PhaseFiles, func(ctx context.Context) error { return m.syncFiles(ctx, baseClient, targetClient, result) }); err != nil {
+			return result, err
+		}
+	}
+	if len(opts.DataCollections) > 0 {
+		if err := m.runPhase(ctx, targetClient, PhaseData, func(ctx context.Context) error { return m.syncData(ctx, baseClient, targetClient, result) }); err != nil {
+			return result, err
+		}
+	}
+	if opts.SyncPermissions {
+		if err := m.runPhase(ctx, targetClient, PhasePermissions, func(ctx context.Context) error { return m.syncPermissions(ctx, baseClient, targetClient, result) }); err != nil {
+			return result, err
+		}
+	}
+	if opts.SyncUsers {
+		if err := m.runPhase(ctx, targetClient, PhaseUsers, func(ctx context.Context) error { return m.syncUsers(ctx, baseClient, targetClient, result) }); err != nil {
+			return result, err
+		}
+	}
+	if opts.SyncPresets {
+		if err := m.runPhase(ctx, targetClient, PhasePresets, func(ctx context.Context) error { return m.syncPresets(ctx, baseClient, targetClient, result) }); err != nil {
+			return result, err
+		}
+	}
+	if opts.SyncTranslations {
+		if err := m.runPhase(ctx, targetClient, PhaseTranslations, func(ctx context.Context) error { return m.syncTranslations(ctx, baseClient, targetClient, result) }); err != nil {
+			return result, err
+		}
+	}
+	if opts.SyncWebhooks {
+		if err := m.runPhase(ctx, targetClient, PhaseWebhooks, func(ctx context.Context) error { return m.syncWebhooks(ctx, baseClient, targetClient, result) }); err != nil {
+			return result, err
+		}
+	}
+	if opts.SyncSettings {
+		if err := m.runPhase(ctx, targetClient, PhaseSettings, func(ctx context.Context) error { return m.syncSettings(ctx, baseClient, targetClient, result) }); err != nil {
+			return result, err
+		}
+	}
+	if opts.SyncFlows {
+		if err := m.runPhase(ctx, targetClient, PhaseFlows, func(ctx context.Context) error { return m.syncFlows(ctx, baseClient, targetClient, result) }); err != nil {
+			return result, err
+		}
+	}
+	if opts.SyncDashboards {
+		if err := m.runPhase(ctx, targetClient, PhaseDashboards, func(ctx context.Context) error { return m.syncDashboards(ctx, baseClient, targetClient, result) }); err != nil {
+			return result, err
+		}
+	}
+	m.removeCheckpoint(ctx)
+	return result, nil
+}
+
+// migrateSchema computes the diff of source against targetClient and, unless
+// it is empty or opts.DryRun is set, applies it.
+func (m *migration) migrateSchema(ctx context.Context, source SnapshotSource, targetClient *DirectusClient, result *MigrationResult) error {
+	opts := m.opts
+
+	snapshot, diff, err := m.computeDiff(ctx, source, targetClient)
+	if err != nil || diff == nil {
+		return err
+	}
+	if diff, err = m.selectChanges(ctx, targetClient, diff); err != nil || diff == nil {
+		return err
+	}
+	if diff, err = m.beforeApply(ctx, diff); err != nil {
+		return err
+	}
+	if diff == nil {
+		return nil
+	}
+	result.Diff = diff
+	result.Summary = m.summarize(diff)
+	result.Changed = true
+	result.DestructiveChanges = FindDestructiveChanges(diff)
+	if len(result.DestructiveChanges) > 0 {
+		m.emit(&DestructiveChangesFound{Changes: result.DestructiveChanges})
+	}
+
+	if opts.DryRun {
+		m.emit(&DryRunCompleted{Diff: diff})
+		return nil
+	}
+
+	if err := CheckDestructive(diff, opts.AllowDestructive, opts.MaxDeletions); err != nil {
+		return m.fail(PhaseSafetyCheck, err)
+	}
+
+	if opts.Confirm != nil {
+		ok, err := opts.Confirm(ctx, RedactURL(targetClient.URL), diff, result.Summary)
+		if err != nil {
+			return m.fail(PhaseConfirm, fmt.Errorf("failed to confirm changes: %w", err))
+		}
+		if !ok {
+			m.emit(&ApplyDeclined{})
+			return ErrNotConfirmed
+		}
+	}
+
+	// The history collection is created before the backup, so that a
+	// rollback keeps it.
+	if opts.RecordHistory {
+		created, err := targetClient.EnsureHistoryCollection(ctx, opts.historyCollection())
+		if err != nil {
+			return m.fail(PhaseHistory, fmt.Errorf("failed to prepare migration history: %w", err))
+		}
+		if created {
+			m.emit(&HistoryCollectionCreated{Collection: opts.historyCollection()})
+		}
+	}
+
+	var backup *Snapshot
+	if !opts.NoBackup || opts.Rollback {
+		if result.BackupPath, backup, err = m.backup(ctx, targetClient); err != nil {
+			return m.fail(PhaseBackup, fmt.Errorf("failed to back up target: %w", err))
+		}
+	}
+
+	if err := m.runHook(ctx, HookPreApply, targetClient, result, nil); err != nil {
+		return m.fail(PhaseHooks, err)
+	}
+
+	m.emit(&ApplyStarted{})
+	onRetry := func(err error) { m.emit(&ApplyRetrying{Err: err}) }
+	prepare := func(diff *Diff) (*Diff, error) {
+		return m.beforeApply(ctx, m.narrowDiff(diff))
+	}
+	applyCtx, span := m.startSpan(ctx, "apply", summaryAttributes(result.Summary)...)
+	err = targetClient.applyWithRecheck(applyCtx, snapshot, diff, opts.Force, prepare, onRetry)
+	endSpan(span, err)
+	if err != nil {
+		err = m.fail(PhaseApply, fmt.Errorf("failed to apply diff: %w", err))
+		if opts.Rollback {
+			err = m.rollback(ctx, targetClient, backup, result, err)
+		}
+		m.recordHistory(ctx, source, targetClient, snapshot, result, err)
+		m.forgetInSync(targetClient)
+		return err
+	}
+	result.Applied = true
+	sent, _ := targetClient.LastTransferBytes()
+	m.emit(&ApplyCompleted{RequestID: targetClient.LastRequestID(), Bytes: sent})
+	var verifyErr error
+	if opts.VerifyAfterApply != VerifyOff {
+		verifyErr = m.verify(ctx, snapshot, targetClient, result)
+	}
+	if !opts.NoBackup {
+		m.recordUndo(ctx, targetClient, backup, result)
+	}
+	m.recordHistory(ctx, source, targetClient, snapshot, result, nil)
+	if result.Residual != nil {
+		m.forgetInSync(targetClient)
+	} else {
+		m.rememberInSync(ctx, targetClient)
+	}
+	if verifyErr != nil {
+		return verifyErr
+	}
+	if opts.AfterApply != nil {
+		if err := opts.AfterApply(ctx, result); err != nil {
+			return m.fail(PhaseAfterApply, fmt.Errorf("after apply callback failed: %w", err))
+		}
+	}
+	return nil
+}
+
+// selectChanges narrows diff to opts.OnlyCollections and the changes chosen
+// with opts.SelectChanges, remembering them in m.selected so that a re-diff
+// after a failed apply is narrowed alike. It returns a nil diff when no change
+// is left.
+func (m *migration) selectChanges(ctx context.Context, targetClient *DirectusClient, diff *Diff) (*Diff, error) {
+	if len(m.opts.OnlyCollections) == 0 && m.opts.SelectChanges == nil {
+		return diff, nil
+	}
+	keys, err := ChooseChanges(ctx, RedactURL(targetClient.URL), diff, m.opts.OnlyCollections, m.opts.SelectChanges)
+	if errors.Is(err, ErrNotConfirmed) {
+		m.emit(&ApplyDeclined{})
+		return nil, err
+	}
+	if err != nil {
+		return nil, m.fail(PhaseConfirm, err)
+	}
+	m.selected = keys
+	selected := SelectDiff(diff, keys)
+	total := len(ListDiffItems(diff))
+	if selected.IsEmpty() {
+		m.emit(&ChangesSelected{InSync: true, Total: total})
+		return nil, nil
+	}
+	m.emit(&ChangesSelected{Selected: len(keys), Total: total, Summary: m.summarize(selected)})
+	return selected, nil
+}
+
+// narrowDiff narrows a diff recomputed after the first one to the filters,
+// the scope and the selected changes, like the first.
+func (m *migration) narrowDiff(diff *Diff) *Diff {
+	if !m.filter.IsZero() {
+		diff = FilterDiff(diff, m.filter).Diff
+	}
+	if !m.scope.IsZero() {
+		diff = FilterDiff(diff, m.scope).Diff
+	}
+	if m.selected != nil {
+		diff = SelectDiff(diff, m.selected)
+	}
+	return diff
+}
+
+// beforeApply passes diff through opts.BeforeApply, if set. It returns nil
+// when nothing is left to apply.
+func (m *migration) beforeApply(ctx context.Context, diff *Diff) (*Diff, error) {
+	if m.opts.BeforeApply == nil || diff.IsEmpty() {
+		return diff, nil
+	}
+	modified, err := m.opts.BeforeApply(ctx, diff)
+	if err != nil {
+		return nil, m.fail(PhaseBeforeApply, fmt.Errorf("%w: %w", ErrVetoed, err))
+	}
+	if modified == nil || modified.IsEmpty() {
+		m.emit(&DiffModified{InSync: true})
+		return nil, nil
+	}
+	if modified != diff {
+		m.emit(&DiffModified{Summary: m.summarize(modified)})
+	}
+	return modified, nil
+}
+
+// recordHistory records the attempt to apply the diff of result when
+// opts.RecordHistory is set. A failure to record is reported but does not
+// fail the migration, whose outcome is already settled. It runs even if ctx
+// was canceled.
+func (m *migration) recordHistory(ctx context.Context, source SnapshotSource, targetClient *DirectusClient, snapshot *Snapshot, result *MigrationResult, applyErr error) {
+	if !m.opts.RecordHistory {
+		return
+	}
+	entry := NewHistoryEntry(source.String(), snapshot, result.Summary, m.opts.Operator, applyErr)
+	err := targetClient.RecordHistory(context.WithoutCancel(ctx), m.opts.historyCollection(), entry)
+	m.emit(&HistoryRecorded{Collection: m.opts.historyCollection(), Entry: entry, Err: err})
+}
+
+// acquireLock takes the lock of targetClient as configured by
+// opts.LockOptions.
+func (m *migration) acquireLock(ctx context.Context, targetClient *DirectusClient) (*Lock, error) {
+	lockOpts := m.opts.LockOptions
+	if lockOpts.Holder == "" {
+		lockOpts.Holder = NewLockHolder(m.opts.Operator)
+	}
+	lockOpts.OnWait = func(held Lock) { m.emit(&LockWaiting{Held: held}) }
+	lockOpts.OnTakeover = func(stale Lock) { m.emit(&StaleLockTakenOver{Stale: stale}) }
+	lock, err := targetClient.AcquireLock(ctx, lockOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock target: %w", err)
+	}
+	m.emit(&LockAcquired{Collection: lockOpts.collection(), Lock: *lock})
+	return lock, nil
+}
+
+// releaseLock releases lock, even if ctx was canceled. A failure is reported
+// but does not fail the migration; the lock then expires on its own.
+func (m *migration) releaseLock(ctx context.Context, targetClient *DirectusClient, lock *Lock) {
+	collection := m.opts.LockOptions.collection()
+	err := targetClient.ReleaseLock(context.WithoutCancel(ctx), collection, lock)
+	m.emit(&LockReleased{Collection: collection, Err: err})
+}
+
+// syncFiles runs SyncFiles before the data sync, so that items referencing
+// files can be written, only computing the changes in a dry run.
+func (m *migration) syncFiles(ctx context.Context, baseClient, targetClient *DirectusClient, result *MigrationResult) error {
+	opts := FileSyncOptions{DryRun: m.opts.DryRun, All: m.opts.AllFiles}
+	if !opts.All {
+		ids, err := m.referencedFiles(ctx, baseClient)
+		if err != nil {
+			return m.fail(PhaseFiles, fmt.Errorf("failed to find referenced files: %w", err))
+		}
+		opts.IDs = ids
+	}
+	m.emit(&FilesSyncStarted{All: opts.All, Files: len(opts.IDs), DryRun: opts.DryRun})
+	opts.OnProgress = func(done, total int) { m.emit(&Progress{Phase: PhaseFiles, Done: done, Total: total}) }
+	files, err := SyncFiles(ctx, baseClient, targetClient, opts)
+	result.Files = files
+	if err != nil {
+		return m.fail(PhaseFiles, fmt.Errorf("failed to sync files: %w", err))
+	}
+	m.emit(&FilesSynced{Result: files})
+	return nil
+}
+
+// referencedFiles returns the IDs of the files referenced by the items of the
+// data collections and, when settings are synced, by allowlisted settings
+// such as project_logo.
+func (m *migration) referencedFiles(ctx context.Context, baseClient *DirectusClient) ([]string, error) {
+	ids, err := ReferencedFiles(ctx, baseClient, m.opts.DataCollections)
+	if err != nil || !m.opts.SyncSettings {
+		return ids, err
+	}
+	settings, err := baseClient.GetSettings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get base settings: %w", err)
+	}
+	keys := m.opts.SettingsKeys
+	if len(keys) == 0 {
+		keys = DefaultSettingsKeys
+	}
+	for _, key := range keys {
+		var id *string
+		if slices.Contains(fileSettingsKeys, key) && json.Unmarshal(settings[key], &id) == nil && id != nil {
+			ids = append(ids, *id)
+		}
+	}
+	return ids, nil
+}
+
+// syncData runs SyncData after the schema migration, only counting the changes
+// in a dry run, where collections the unapplied diff creates count as empty.
+func (m *migration) syncData(ctx context.Context, baseClient, targetClient *DirectusClient, result *MigrationResult) error {
+	collections := make([]string, 0, len(m.opts.DataCollections))
+	for _, collection := range m.opts.DataCollections {
+		collections = append(collections, collection.Collection)
+	}
+	m.emit(&DataSyncStarted{Collections: collections, DryRun: m.opts.DryRun})
+	opts := DataSyncOptions{
+		Collections: m.opts.DataCollections,
+		BatchSize:   m.opts.DataBatchSize,
+		DryRun:      m.opts.DryRun,
+		OnProgress:  func(done, total int) { m.emit(&Progress{Phase: PhaseData, Done: done, Total: total}) },
+		Skip:        m.resumedDataCollections(),
+	}
+	if !m.opts.DryRun {
+		opts.OnCollectionDone = func(collection string) { m.completeDataCollection(ctx, collection) }
+	}
+	if !result.Applied {
+		opts.PendingDiff = result.Diff
+	}
+	data, err := SyncData(ctx, baseClient, targetClient, opts)
+	result.Data = data
+	if err != nil {
+		return m.fail(PhaseData, fmt.Errorf("failed to sync data: %w", err))
+	}
+	m.emit(&DataSynced{Result: data})
+	return nil
+}
+
+// syncPermissions runs SyncPermissions after the schema migration, only
+// computing the changes in a dry run.
+func (m *migration) syncPermissions(ctx context.Context, baseClient, targetClient *DirectusClient, result *MigrationResult) error {
+	m.emit(&PermissionsSyncStarted{DryRun: m.opts.DryRun})
+	permissions, err := SyncPermissions(ctx, baseClient, targetClient, m.opts.DryRun)
+	result.Permissions = permissions
+	if err != nil {
+		return m.fail(PhasePermissions, fmt.Errorf("failed to sync permissions: %w", err))
+	}
+	m.emit(&PermissionsSynced{Result: permissions})
+	return nil
+}
+
+// syncUsers runs SyncUsers after roles have been synced, only computing the
+// changes in a dry run.
+func (m *migration) syncUsers(ctx context.Context, baseClient, targetClient *DirectusClient, result *MigrationResult) error {
+	m.emit(&UsersSyncStarted{DryRun: m.opts.DryRun})
+	users, err := SyncUsers(ctx, baseClient, targetClient, UserSyncOptions{
+		DryRun:    m.opts.DryRun,
+		Roles:     m.opts.UserRoles,
+		Emails:    m.opts.UserEmails,
+		Password:  m.opts.UserPassword,
+		Invite:    m.opts.InviteUsers,
+		InviteURL: m.opts.InviteURL,
+	})
+	result.Users = users
+	if err != nil {
+		return m.fail(PhaseUsers, fmt.Errorf("failed to sync users: %w", err))
+	}
+	m.emit(&UsersSynced{Result: users})
+	return nil
+}
+
+// syncPresets runs SyncPresets after roles have been synced, only computing
+// the changes in a dry run.
+func (m *migration) syncPresets(ctx context.Context, baseClient, targetClient *DirectusClient, result *MigrationResult) error {
+	m.emit(&PresetsSyncStarted{DryRun: m.opts.DryRun})
+	presets, err := SyncPresets(ctx, baseClient, targetClient, m.opts.PrunePresets, m.opts.DryRun)
+	result.Presets = presets
+	if err != nil {
+		return m.fail(PhasePresets, fmt.Errorf("failed to sync presets: %w", err))
+	}
+	m.emit(&PresetsSynced{Result: presets})
+	return nil
+}
+
+// syncTranslations runs SyncTranslations, only computing the changes in a dry
+// run.
+func (m *migration) syncTranslations(ctx context.Context, baseClient, targetClient *DirectusClient, result *MigrationResult) error {
+	m.emit(&TranslationsSyncStarted{DryRun: m.opts.DryRun})
+	translations, err := SyncTranslations(ctx, baseClient, targetClient, TranslationSyncOptions{
+		DryRun:    m.opts.DryRun,
+		Prune:     m.opts.PruneTranslations,
+		BatchSize: m.opts.TranslationsBatchSize,
+	})
+	result.Translations = translations
+	if err != nil {
+		return m.fail(PhaseTranslations, fmt.Errorf("failed to sync translations: %w", err))
+	}
+	m.emit(&TranslationsSynced{Result: translations})
+	return nil
+}
+
+// syncWebhooks runs SyncWebhooks, only computing the changes in a dry run.
+func (m *migration) syncWebhooks(ctx context.Context, baseClient, targetClient *DirectusClient, result *MigrationResult) error {
+	m.emit(&WebhooksSyncStarted{DryRun: m.opts.DryRun})
+	webhooks, err := SyncWebhooks(ctx, baseClient, targetClient, WebhookSyncOptions{
+		DryRun: m.opts.DryRun,
+		Prune:  m.opts.PruneWebhooks,
+		URLs:   m.opts.WebhookURLs,
+	})
+	result.Webhooks = webhooks
+	if err != nil {
+		return m.fail(PhaseWebhooks, fmt.Errorf("failed to sync webhooks: %w", err))
+	}
+	m.emit(&WebhooksSynced{Result: webhooks})
+	return nil
+}
+
+// syncSettings runs SyncSettings, only computing the changes in a dry run.
+func (m *migration) syncSettings(ctx context.Context, baseClient, targetClient *DirectusClient, result *MigrationResult) error {
+	m.emit(&SettingsSyncStarted{DryRun: m.opts.DryRun})
+	settings, err := SyncSettings(ctx, baseClient, targetClient, m.opts.SettingsKeys, m.opts.DryRun)
+	result.Settings = settings
+	if err != nil {
+		return m.fail(PhaseSettings, fmt.Errorf("failed to sync settings: %w", err))
+	}
+	m.emit(&SettingsSynced{Result: settings})
+	return nil
+}
+
+// syncFlows runs SyncFlows, only computing the changes in a dry run.
+func (m *migration) syncFlows(ctx context.Context, baseClient, targetClient *DirectusClient, result *MigrationResult) error {
+	m.emit(&FlowsSyncStarted{DryRun: m.opts.DryRun})
+	flows, err := SyncFlows(ctx, baseClient, targetClient, FlowSyncOptions{
+		DryRun:      m.opts.DryRun,
+		Prune:       m.opts.PruneFlows,
+		Secrets:     m.opts.FlowSecrets,
+		KeepOptions: m.opts.KeepFlowOptions,
+	})
+	result.Flows = flows
+	if err != nil {
+		return m.fail(PhaseFlows, fmt.Errorf("failed to sync flows: %w", err))
+	}
+	m.emit(&FlowsSynced{Result: flows})
+	return nil
+}
+
+// syncDashboards runs SyncDashboards last. In a dry run the unapplied diff is
+// taken into account when panel references are checked.
+func (m *migration) syncDashboards(ctx context.Context, baseClient, targetClient *DirectusClient, result *MigrationResult) error {
+	m.emit(&DashboardsSyncStarted{DryRun: m.opts.DryRun})
+	opts := DashboardSyncOptions{DryRun: m.opts.DryRun}
+	if !result.Applied {
+		opts.PendingDiff = result.Diff
+	}
+	dashboards, err := SyncDashboards(ctx, baseClient, targetClient, opts)
+	result.Dashboards = dashboards
+	if err != nil {
+		return m.fail(PhaseDashboards, fmt.Errorf("failed to sync dashboards: %w", err))
+	}
+	m.emit(&DashboardsSynced{Result: dashboards})
+	return nil
+}
+
+// migration holds the state of one MigrateWithOptions run.
+type migration struct {
+	opts     MigrationOptions
+	filter   SchemaFilter
+	reporter logReporter
+	metrics  *migrationMetrics
+	stats    *statsRecorder
+
+	// filteredFields collects, as collection.field, the fields removed by
+	// opts.ExcludeFields from the snapshot or the diff.
+	filteredFields map[string]bool
+	// scope keeps the collections of opts.ScopeCollections once the base
+	// snapshot is known.
+	scope SchemaFilter
+	// selected holds the keys of the changes chosen by selectChanges, nil
+	// if all are applied.
+	selected []string
+	// baseHash is the SnapshotHash of the diffed snapshot when opts.Cache
+	// is set or a checkpoint is kept.
+	baseHash string
+	// checkpoint is the checkpoint kept by a migration with sync phases that
+	// is not a dry run, nil otherwise.
+	checkpoint *checkpointState
+}
+
+// emit stamps event with the current time, logs it, records it in the stats
+// and opts.Metrics and delivers it to opts.OnEvent.
+func (m *migration) emit(event Event) {
+	event.setTime(time.Now())
+	m.reporter.handle(event)
+	if phase := m.stats.handle(event); phase != nil {
+		m.metrics.observePhase(*phase)
+	}
+	if m.opts.OnEvent != nil {
+		m.opts.OnEvent(event)
+	}
+}
+
+// backup takes the target snapshot before applying and, unless disabled,
+// saves it and prunes old backups. The path is empty when it was not saved.
+func (m *migration) backup(ctx context.Context, targetClient *DirectusClient) (string, *Snapshot, error) {
+	store, keep := m.backupStore()
+
+	repo := m.opts.BackupRepository
+	env := m.opts.BackupEnv
+	if env == "" {
+		env = BackupEnvName(targetClient.URL)
+	}
+
+	if !m.opts.NoBackup {
+		dir := store.Location("")
+		if repo != nil {
+			dir = repo.Location(nil)
+		}
+		m.emit(&BackupStarted{Dir: dir})
+	}
+	snapshot, err := targetClient.GetSnapshot(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get target snapshot: %w", err)
+	}
+	if m.opts.NoBackup {
+		return "", snapshot, nil
+	}
+
+	if repo != nil {
+		entry, err := repo.Add(ctx, env, snapshot)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to save backup: %w", err)
+		}
+		completed := &BackupCompleted{Path: repo.Location(entry)}
+		if keep > 0 {
+			_, completed.PruneErr = repo.Prune(ctx, RepositoryPruneOptions{Keep: keep, KeepTagged: true, Env: env})
+		}
+		m.emit(completed)
+		return completed.Path, snapshot, nil
+	}
+	path, err := StoreBackup(ctx, store, snapshot)
+	if err != nil {
+		return "", nil, err
+	}
+	completed := &BackupCompleted{Path: path}
+	if keep > 0 {
+		completed.PruneErr = PruneStoredBackups(ctx, store, keep)
+	}
+	m.emit(completed)
+	return path, snapshot, nil
+}
+
+// backupStore returns the store of the backups and the number of them to
+// keep.
+func (m *migration) backupStore() (SnapshotStore, int) {
+	store := m.opts.BackupStore
+	if store == nil {
+		dir := m.opts.BackupDir
+		if dir == "" {
+			dir = DefaultBackupDir
+		}
+		store = DirStore(dir)
+	}
+	keep := m.opts.BackupRetention
+	if keep == 0 {
+		keep = DefaultBackupRetention
+	}
+	return store, keep
+}
+
+// recordUndo saves the undo record of the diff just applied next to backup.
+// A failure is reported but does not fail the migration, which succeeded.
+func (m *migration) recordUndo(ctx context.Context, targetClient *DirectusClient, backup *Snapshot, result *MigrationResult) {
+	store, keep := m.backupStore()
+	path, err := RecordUndo(context.WithoutCancel(ctx), targetClient, store, backup, result.BackupPath)
+	recorded := &UndoRecorded{Path: path, Err: err}
+	if err == nil && path != "" && keep > 0 {
+		recorded.PruneErr = PruneUndoRecords(ctx, store, keep)
+	}
+	result.UndoPath = path
+	m.emit(recorded)
+}
+
+// transferred returns the bytes sent and received by the last request of
+// client.
+func transferred(client *DirectusClient) int64 {
+	sent, received := client.LastTransferBytes()
+	return sent + received
+}
+
+// rollback restores backup after applyErr and returns the error the
+// migration fails with.
+func (m *migration) rollback(ctx context.Context, targetClient *DirectusClient, backup *Snapshot, result *MigrationResult, applyErr error) error {
+	m.emit(&RollbackStarted{BackupPath: result.BackupPath})
+	if err := Rollback(context.WithoutCancel(ctx), targetClient, backup); err != nil {
+		m.emit(&PhaseFailed{Phase: PhaseRollback, Err: err})
+		return fmt.Errorf("apply failed AND rollback failed: %w", errors.Join(applyErr, err))
+	}
+	result.RolledBack = true
+	m.emit(&RollbackCompleted{})
+	return fmt.Errorf("%w (the previous schema was restored)", applyErr)
+}
+
+// countFilteredFields records fields removed by opts.ExcludeFields.
+func (m *migration) countFilteredFields(fields []string) {
+	if m.filteredFields == nil {
+		m.filteredFields = map[string]bool{}
+	}
+	for _, field := range fields {
+		m.filteredFields[field] = true
+	}
+}
+
+// summarize summarizes diff, noting the filtered fields.
+func (m *migration) summarize(diff *Diff) DiffSummary {
+	summary := SummarizeDiff(diff)
+	summary.FilteredFields = len(m.filteredFields)
+	return summary
+}
+
+// fail emits PhaseFailed for err and returns it.
+func (m *migration) fail(phase string, err error) error {
+	m.emit(&PhaseFailed{Phase: phase, Err: err})
+	return err
+}
+
+// computeDiff performs the pre-flight checks, fetches the base snapshot,
+// merges the overlays onto it, narrows it to the filtered collections, validates it and diffs it against
+// the target. The diff is nil when the schemas are already in sync.
+func (m *migration) computeDiff(ctx context.Context, source SnapshotSource, targetClient *DirectusClient) (*Snapshot, *Diff, error) {
+	m.emit(&VersionCheckStarted{})
+	baseInfo, targetInfo, err := checkSourceVersions(ctx, source, targetClient)
+	switch {
+	case isVersionMismatchError(err) && m.opts.Force:
+		m.emit(&VersionCheckCompleted{Base: *baseInfo, Target: *targetInfo, Mismatch: err})
+	case err != nil:
+		return nil, nil, m.fail(PhaseVersionCheck, fmt.Errorf("pre-flight check failed: %w", err))
+	default:
+		m.emit(&VersionCheckCompleted{Base: *baseInfo, Target: *targetInfo})
+	}
+
+	m.emit(&SnapshotStarted{Source: source.String()})
+	snapshotCtx, span := m.startSpan(ctx, "snapshot", attribute.String("directus.snapshot.source", source.String()))
+	snapshot, err := source.Snapshot(snapshotCtx)
+	if err == nil && span.IsRecording() {
+		if hash, err := SnapshotHash(snapshot); err == nil {
+			span.SetAttributes(attribute.String("directus.snapshot.hash", hash))
+		}
+	}
+	endSpan(span, err)
+	if err != nil {
+		return nil, nil, m.fail(PhaseSnapshot, fmt.Errorf("failed to get snapshot: %w", err))
+	}
+	completed := &SnapshotCompleted{
+		Collections: len(snapshot.Collections),
+		Fields:      len(snapshot.Fields),
+		Relations:   len(snapshot.Relations),
+	}
+	if source, ok := source.(clientSource); ok {
+		completed.RequestID = source.client.LastRequestID()
+		_, completed.Bytes = source.client.LastTransferBytes()
+	}
+	m.emit(completed)
+
+	if len(m.opts.Overlays) > 0 {
+		if snapshot, err = ApplyOverlays(snapshot, m.opts.Overlays, m.opts.StrictOverlays, m.reporter.logger); err != nil {
+			return nil, nil, m.fail(PhaseSnapshot, err)
+		}
+	}
+	if len(m.opts.ScopeCollections) > 0 {
+		scope, err := ScopeCollections(snapshot, m.opts.ScopeCollections)
+		if err != nil {
+			return nil, nil, m.fail(PhaseSnapshot, fmt.Errorf("invalid collection scope: %w", err))
+		}
+		m.scope = scope.Filter()
+		scoped := FilterSnapshot(snapshot, m.scope)
+		snapshot = scoped.Snapshot
+		m.emit(&SnapshotScoped{
+			Collections:      scope.Collections,
+			Junctions:        scope.Junctions,
+			DroppedRelations: scoped.DroppedRelations,
+		})
+	}
+	if !m.filter.IsZero() {
+		filtered := FilterSnapshot(snapshot, m.filter)
+		snapshot = filtered.Snapshot
+		m.emit(&SnapshotFiltered{
+			Collections:         len(snapshot.Collections),
+			ExcludedCollections: filtered.ExcludedCollections,
+			ExcludedFields:      filtered.ExcludedFields,
+			DroppedRelations:    filtered.DroppedRelations,
+		})
+		m.countFilteredFields(filtered.ExcludedFields)
+	}
+
+	if m.opts.BeforeDiff != nil {
+		if snapshot, err = m.opts.BeforeDiff(ctx, snapshot); err != nil {
+			return nil, nil, m.fail(PhaseBeforeDiff, fmt.Errorf("before diff callback failed: %w", err))
+		}
+		if snapshot == nil {
+			return nil, nil, m.fail(PhaseBeforeDiff, fmt.Errorf("before diff callback returned no snapshot"))
+		}
+	}
+
+	if err := ValidateSnapshot(snapshot); err != nil {
+		return nil, nil, m.fail(PhaseValidate, err)
+	}
+	if err := ValidateRelations(snapshot); err != nil {
+		if !m.opts.LenientRelations {
+			return nil, nil, m.fail(PhaseValidate, err)
+		}
+		for _, problem := range err.(*ValidationError).Problems {
+			m.reporter.logger.Warn("relation integrity problem", "path", problem.Path, "problem", problem.Message)
+		}
+	}
+
+	if m.checkpoint != nil {
+		if m.baseHash, err = SnapshotHash(snapshot); err != nil {
+			return nil, nil, m.fail(PhaseSnapshot, err)
+		}
+	}
+	if m.opts.Cache != nil && m.cachedInSync(ctx, targetClient, snapshot) {
+		m.emit(&DiffComputed{InSync: true, Cached: true, Summary: m.summarize(nil)})
+		return snapshot, nil, nil
+	}
+
+	m.emit(&DiffStarted{})
+	diffCtx, span := m.startSpan(ctx, "diff")
+	diff, err := targetClient.GetDiff(diffCtx, snapshot, m.opts.Force)
+	if err == nil && !m.filter.IsZero() {
+		filtered := FilterDiff(diff, m.filter)
+		diff = filtered.Diff
+		m.countFilteredFields(filtered.ExcludedFields)
+		if diff.IsEmpty() {
+			err = ErrNoChanges
+		}
+	}
+	if err == nil && !m.scope.IsZero() {
+		if diff = FilterDiff(diff, m.scope).Diff; diff.IsEmpty() {
+			err = ErrNoChanges
+		}
+	}
+	if errors.Is(err, ErrNoChanges) {
+		endSpan(span, nil)
+		m.emit(&DiffComputed{InSync: true, Summary: m.summarize(nil), RequestID: targetClient.LastRequestID(), Bytes: transferred(targetClient)})
+		m.rememberInSync(ctx, targetClient)
+		return snapshot, nil, nil
+	}
+	if err != nil {
+		endSpan(span, err)
+		return nil, nil, m.fail(PhaseDiff, fmt.Errorf("failed to get diff: %w", err))
+	}
+	span.SetAttributes(summaryAttributes(m.summarize(diff))...)
+	endSpan(span, nil)
+	m.emit(&DiffComputed{Diff: diff, Summary: m.summarize(diff), RequestID: targetClient.LastRequestID(), Bytes: transferred(targetClient)})
+
+	return snapshot, diff, nil
+}
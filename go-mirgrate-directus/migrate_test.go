@@ -0,0 +1,295 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// newMigration starts a base serving the snapshot of the latest fixture and a
+// target serving its diff without deletions, in a temporary working directory
+// for backups. The fixture is returned with the diff served.
+func newMigration(t *testing.T) (base, target *directustest.Server, f *directustest.Fixture) {
+	t.Helper()
+	versions := directustest.FixtureVersions()
+	f, err := directustest.LoadFixture(versions[len(versions)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	base, target = directustest.NewServer(t), directustest.NewServer(t)
+	base.UseFixture(f)
+	target.SetServerInfo(gomigratedirectus.ServerInfo{Version: f.Snapshot.Directus, Vendor: f.Snapshot.Vendor})
+	f.Diff = withoutDeletions(f.Diff)
+	target.SetDiff(f.Diff)
+	return base, target, f
+}
+
+// withoutDeletions returns a copy of diff without the collections, fields and
+// relations it deletes, which migrations refuse by default.
+func withoutDeletions(diff *gomigratedirectus.Diff) *gomigratedirectus.Diff {
+	kept := &gomigratedirectus.Diff{Hash: diff.Hash}
+	for _, c := range diff.Diff.Collections {
+		if gomigratedirectus.ClassifyEntries(c.Diff) != gomigratedirectus.ChangeDeleted {
+			kept.Diff.Collections = append(kept.Diff.Collections, c)
+		}
+	}
+	for _, f := range diff.Diff.Fields {
+		if gomigratedirectus.ClassifyEntries(f.Diff) != gomigratedirectus.ChangeDeleted {
+			kept.Diff.Fields = append(kept.Diff.Fields, f)
+		}
+	}
+	for _, r := range diff.Diff.Relations {
+		if gomigratedirectus.ClassifyEntries(r.Diff) != gomigratedirectus.ChangeDeleted {
+			kept.Diff.Relations = append(kept.Diff.Relations, r)
+		}
+	}
+	return kept
+}
+
+// paths returns the method and path of the requests received by server.
+func paths(server *directustest.Server) []string {
+	var paths []string
+	for _, req := range server.Requests() {
+		paths = append(paths, req.Method+" "+req.Path)
+	}
+	return paths
+}
+
+func TestMigrateWithOptionsZeroValue(t *testing.T) {
+	ctx := context.Background()
+
+	// The zero MigrationOptions migrates like MigrateClients without force.
+	oldBase, oldTarget, _ := newMigration(t)
+	if err := gomigratedirectus.MigrateClients(ctx, oldBase.Client(quiet()...), oldTarget.Client(quiet()...), false); err != nil {
+		t.Fatalf("MigrateClients: %v", err)
+	}
+
+	base, target, f := newMigration(t)
+	result, err := gomigratedirectus.MigrateWithOptions(ctx, base.Client(quiet()...), target.Client(quiet()...), gomigratedirectus.MigrationOptions{})
+	if err != nil {
+		t.Fatalf("MigrateWithOptions: %v", err)
+	}
+	if !result.Changed || !result.Applied {
+		t.Errorf("result changed %v, applied %v, want both", result.Changed, result.Applied)
+	}
+	if !reflect.DeepEqual(result.Summary, gomigratedirectus.SummarizeDiff(f.Diff)) {
+		t.Errorf("Summary = %+v, want the summary of the diff", result.Summary)
+	}
+
+	if got, want := paths(base), paths(oldBase); !reflect.DeepEqual(got, want) {
+		t.Errorf("base received %q, MigrateClients sent %q", got, want)
+	}
+	if got, want := paths(target), paths(oldTarget); !reflect.DeepEqual(got, want) {
+		t.Errorf("target received %q, MigrateClients sent %q", got, want)
+	}
+	diffs := target.DiffRequests()
+	if len(diffs) == 0 || len(diffs[0].Collections) != len(f.Snapshot.Collections) {
+		t.Errorf("target was diffed against %+v, want the base snapshot", diffs)
+	}
+	applied := target.ApplyRequests()
+	if len(applied) != 1 || applied[0].Hash != f.Diff.Hash {
+		t.Errorf("target applied %+v, want the diff once", applied)
+	}
+	for _, req := range target.Requests() {
+		// Later diffs compute the undo diff, which is always forced.
+		if req.Path == "/schema/diff" {
+			if req.Query.Has("force") {
+				t.Errorf("diff requested with force=%s, want no force", req.Query.Get("force"))
+			}
+			break
+		}
+	}
+
+	// Backups are taken by default, to the default directory.
+	if result.BackupPath == "" {
+		t.Fatal("no backup taken")
+	}
+	if dir := filepath.Dir(result.BackupPath); dir != gomigratedirectus.DefaultBackupDir {
+		t.Errorf("backup saved to %s, want %s", dir, gomigratedirectus.DefaultBackupDir)
+	}
+	if _, err := os.Stat(result.BackupPath); err != nil {
+		t.Errorf("backup: %v", err)
+	}
+}
+
+func TestMigrateWithOptionsInSync(t *testing.T) {
+	base, target, _ := newMigration(t)
+	target.SetDiff(nil)
+
+	result, err := gomigratedirectus.MigrateWithOptions(context.Background(), base.Client(quiet()...), target.Client(quiet()...), gomigratedirectus.MigrationOptions{})
+	if err != nil {
+		t.Fatalf("MigrateWithOptions: %v", err)
+	}
+	if result.Changed || result.Applied || result.Diff != nil {
+		t.Errorf("result = %+v, want nothing changed", result)
+	}
+	if n := len(target.ApplyRequests()); n != 0 {
+		t.Errorf("target received %d applies, want none", n)
+	}
+}
+
+// createdOnly is a BeforeApply callback keeping the collections a diff
+// creates and dropping its field and relation changes.
+func createdOnly(calls *int) func(context.Context, *gomigratedirectus.Diff) (*gomigratedirectus.Diff, error) {
+	return func(_ context.Context, diff *gomigratedirectus.Diff) (*gomigratedirectus.Diff, error) {
+		*calls++
+		modified := *diff
+		modified.Diff.Fields, modified.Diff.Relations = nil, nil
+		return &modified, nil
+	}
+}
+
+func TestBeforeApplyMutation(t *testing.T) {
+	base, target, f := newMigration(t)
+	var calls int
+
+	result, err := gomigratedirectus.MigrateWithOptions(context.Background(), base.Client(quiet()...), target.Client(quiet()...),
+		gomigratedirectus.MigrationOptions{NoBackup: true, BeforeApply: createdOnly(&calls)})
+	if err != nil {
+		t.Fatalf("MigrateWithOptions: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("BeforeApply called %d times, want 1", calls)
+	}
+	applied := target.ApplyRequests()
+	if len(applied) != 1 {
+		t.Fatalf("target received %d applies, want 1", len(applied))
+	}
+	if got := applied[0]; len(got.Diff.Collections) != len(f.Diff.Diff.Collections) || len(got.Diff.Fields) != 0 {
+		t.Errorf("applied %d collections and %d fields, want the %d collections only",
+			len(got.Diff.Collections), len(got.Diff.Fields), len(f.Diff.Diff.Collections))
+	}
+	if result.Summary.Fields.Total() != 0 {
+		t.Errorf("Summary = %+v, want the summary of the modified diff", result.Summary)
+	}
+}
+
+func TestBeforeApplyRecomputedDiff(t *testing.T) {
+	base, target, _ := newMigration(t)
+	// The first apply fails transiently, so the diff is computed again and
+	// has to be modified alike before the second apply.
+	target.Fail("/schema/apply", 1, directustest.Failure{Status: http.StatusServiceUnavailable})
+	var calls int
+
+	_, err := gomigratedirectus.MigrateWithOptions(context.Background(), base.Client(quiet()...), target.Client(quiet()...),
+		gomigratedirectus.MigrationOptions{NoBackup: true, VerifyAfterApply: gomigratedirectus.VerifyOff, BeforeApply: createdOnly(&calls)})
+	if err != nil {
+		t.Fatalf("MigrateWithOptions: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("BeforeApply called %d times, want 2: once per computed diff", calls)
+	}
+	if n := len(target.DiffRequests()); n != 2 {
+		t.Errorf("target diffed %d times, want 2", n)
+	}
+	applied := target.ApplyRequests()
+	if len(applied) != 2 {
+		t.Fatalf("target received %d applies, want 2", len(applied))
+	}
+	for i, diff := range applied {
+		if len(diff.Diff.Fields) != 0 {
+			t.Errorf("apply %d sent %d field changes, want those removed by BeforeApply", i+1, len(diff.Diff.Fields))
+		}
+	}
+}
+
+func TestBeforeApplyVeto(t *testing.T) {
+	base, target, _ := newMigration(t)
+	veto := errors.New("not on a Friday")
+
+	_, err := gomigratedirectus.MigrateWithOptions(context.Background(), base.Client(quiet()...), target.Client(quiet()...),
+		gomigratedirectus.MigrationOptions{NoBackup: true, BeforeApply: func(context.Context, *gomigratedirectus.Diff) (*gomigratedirectus.Diff, error) {
+			return nil, veto
+		}})
+	if !errors.Is(err, gomigratedirectus.ErrVetoed) || !errors.Is(err, veto) {
+		t.Fatalf("MigrateWithOptions = %v, want ErrVetoed wrapping the callback error", err)
+	}
+	if n := len(target.ApplyRequests()); n != 0 {
+		t.Errorf("target received %d applies, want none", n)
+	}
+}
+
+// TestMigrateCanceled cancels a migration during the apply, as the CLI does
+// on SIGINT, and checks that it cleans up: the lock is released and the
+// on_failure hook runs, with a context that is not canceled.
+func TestMigrateCanceled(t *testing.T) {
+	base, target, _ := newMigration(t)
+	target.Fail("/schema/apply", 1, directustest.Failure{Delay: time.Minute})
+
+	// The lock lives in the items of a collection, which directustest does
+	// not serve.
+	locks := newItemsServer(t, gomigratedirectus.DefaultLockCollection)
+	targetURL, err := url.Parse(target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	proxy.ErrorLog = log.New(io.Discard, "", 0)
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/items/") || strings.HasPrefix(r.URL.Path, "/collections") {
+			locks.serveHTTP(w, r)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(front.Close)
+
+	cause := errors.New("interrupted by test")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	go func() {
+		for len(target.ApplyRequests()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		if locks.lock() == nil {
+			t.Error("target not locked during the apply")
+		}
+		cancel(cause)
+	}()
+
+	type hookCall struct {
+		stage  string
+		err    error
+		ctxErr error
+	}
+	var calls []hookCall
+	targetClient := gomigratedirectus.NewDirectusClient(front.URL, directustest.Token, quiet()...)
+	_, err = gomigratedirectus.MigrateWithOptions(ctx, base.Client(quiet()...), targetClient, gomigratedirectus.MigrationOptions{
+		Lock: true,
+		Hook: func(ctx context.Context, info gomigratedirectus.HookInfo) error {
+			calls = append(calls, hookCall{info.Stage, info.Err, ctx.Err()})
+			return nil
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("MigrateWithOptions = %v, want it to wrap context.Canceled", err)
+	}
+	if locks.lock() != nil {
+		t.Errorf("lock %v still held after the migration was canceled", locks.lock())
+	}
+	var stages []string
+	for _, call := range calls {
+		stages = append(stages, call.stage)
+	}
+	if want := []string{gomigratedirectus.HookPreSnapshot, gomigratedirectus.HookPreApply, gomigratedirectus.HookOnFailure}; !slices.Equal(stages, want) {
+		t.Fatalf("hooks ran for %v, want %v", stages, want)
+	}
+	if last := calls[len(calls)-1]; !errors.Is(last.err, context.Canceled) || last.ctxErr != nil {
+		t.Errorf("on_failure hook got error %v and a context done with %v, want context.Canceled and a live context", last.err, last.ctxErr)
+	}
+}
@@ -0,0 +1,257 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// TargetResult is the outcome of the migration to one target of
+// MigrateToTargets.
+type TargetResult struct {
+	// URL is the target URL, redacted.
+	URL string
+	// Result is the result of MigrateWithOptions, nil if the target was
+	// skipped.
+	Result *MigrationResult
+	// Err is the error the migration to this target failed with.
+	Err error
+	// Skipped reports that the target was not migrated because an earlier
+	// one failed and MigrationOptions.ContinueOnError is not set.
+	Skipped bool
+	// CircuitOpen reports that the migration stopped because the circuit
+	// breaker of the target client opened; Err is then its
+	// CircuitOpenError.
+	CircuitOpen bool
+}
+
+// MultiResult describes the outcome of MigrateToTargets.
+type MultiResult struct {
+	// Targets holds one result per target, in the order given.
+	Targets []TargetResult
+}
+
+// Err joins the errors of the failed targets, each prefixed with the target
+// URL, or returns nil if every migrated target succeeded.
+func (r *MultiResult) Err() error {
+	var errs []error
+	for _, target := range r.Targets {
+		if target.Err != nil {
+			errs = append(errs, fmt.Errorf("target %s: %w", target.URL, target.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MigrateToTargets migrates the schema, and whatever else opts selects, of
+// baseClient to each of targets, for example to roll a change out to several
+// regional projects. The base snapshot and version are fetched once and every
+// target is diffed against them; the other phases read the base again for
+// each target.
+//
+// Targets are migrated in turn, or up to opts.Parallel at once. A failing
+// target leaves the targets that have not started yet skipped, unless
+// opts.ContinueOnError is set; the migrations already running are finished.
+// Canceling ctx stops the running migrations and skips the remaining ones.
+// The returned error is MultiResult.Err.
+//
+// A target whose client has a circuit breaker that opened fails with the
+// CircuitOpenError alone, whichever request it refused.
+//
+// Progress is logged with a target attribute. With several targets, each
+// target keeps its backups in its own subdirectory of opts.BackupDir, or
+// prefix of opts.BackupStore, or environment of opts.BackupRepository, named
+// after its host, so that the retention applies per target. opts.Timeout bounds each target separately. When
+// targets run in parallel, opts.OnEvent and opts.Confirm are still called by
+// one target at a time, and what a target writes to opts.Output is written
+// at once when it is done.
+func MigrateToTargets(ctx context.Context, baseClient *DirectusClient, targets []*DirectusClient, opts MigrationOptions) (*MultiResult, error) {
+	multi := &MultiResult{Targets: make([]TargetResult, len(targets))}
+	if len(targets) == 0 {
+		return &MultiResult{}, fmt.Errorf("no targets to migrate to")
+	}
+	source := opts.Source
+	if source == nil {
+		source = ClientSource(baseClient)
+	}
+	source = &onceSource{source: source}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	backupDir := opts.BackupDir
+	if backupDir == "" {
+		backupDir = DefaultBackupDir
+	}
+	parallel := min(max(opts.Parallel, 1), len(targets))
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	// mu serializes the callbacks and the output of the targets, and guards
+	// done and failed.
+	var (
+		mu     sync.Mutex
+		done   int
+		failed bool
+	)
+	onEvent := opts.OnEvent
+	if onEvent != nil && parallel > 1 {
+		onEvent = func(event Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			opts.OnEvent(event)
+		}
+	}
+	confirm := opts.Confirm
+	if confirm != nil && parallel > 1 {
+		var confirmMu sync.Mutex
+		confirm = func(ctx context.Context, target string, diff *Diff, summary DiffSummary) (bool, error) {
+			confirmMu.Lock()
+			defer confirmMu.Unlock()
+			return opts.Confirm(ctx, target, diff, summary)
+		}
+	}
+	// finish records result as the outcome of target i. Callers hold mu.
+	finish := func(i int, result TargetResult) {
+		multi.Targets[i] = result
+		failed = failed || result.Err != nil
+		done++
+		if opts.OnEvent != nil {
+			event := &Progress{Phase: ProgressTargets, Done: done, Total: len(targets)}
+			event.setTime(time.Now())
+			opts.OnEvent(event)
+		}
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(parallel)
+	for i, target := range targets {
+		g.Go(func() error {
+			result := TargetResult{URL: RedactURL(target.URL)}
+			mu.Lock()
+			if failed && (!opts.ContinueOnError || gctx.Err() != nil) {
+				result.Skipped = true
+				logger.Warn("skipping target, an earlier target failed", "target", result.URL)
+				finish(i, result)
+				mu.Unlock()
+				return nil
+			}
+			mu.Unlock()
+
+			targetOpts := opts
+			targetOpts.Source = source
+			targetOpts.Logger = logger.With("target", result.URL)
+			targetOpts.OnEvent = onEvent
+			targetOpts.Confirm = confirm
+			if len(targets) > 1 {
+				targetOpts.BackupDir = filepath.Join(backupDir, targetDirName(target.URL))
+				if opts.BackupStore != nil {
+					targetOpts.BackupStore = PrefixStore(opts.BackupStore, targetDirName(target.URL))
+				}
+				// Each target backs up to the environment of its host.
+				targetOpts.BackupEnv = ""
+			}
+			var output bytes.Buffer
+			if parallel > 1 {
+				targetOpts.Output = &output
+			}
+			targetOpts.Logger.Info("migrating target", "index", i+1, "targets", len(targets))
+			result.Result, result.Err = MigrateWithOptions(gctx, baseClient, target, targetOpts)
+			var open *CircuitOpenError
+			if errors.As(result.Err, &open) && open.URL == result.URL {
+				// Whichever request was refused, the target is failing
+				// as a whole.
+				result.CircuitOpen = true
+				result.Err = open
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			out.Write(output.Bytes())
+			finish(i, result)
+			return nil
+		})
+	}
+	g.Wait()
+	return multi, multi.Err()
+}
+
+// targetDirName derives a directory name from the host of rawURL.
+func targetDirName(rawURL string) string {
+	name := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		name = u.Host
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// onceSource fetches the snapshot and server info of source once and hands
+// out copies, so that the migrations to several targets never see each
+// other's changes to the snapshot.
+type onceSource struct {
+	source SnapshotSource
+
+	// mu makes the targets migrated in parallel wait for the first fetch.
+	mu       sync.Mutex
+	snapshot []byte
+	info     *ServerInfo
+}
+
+func (s *onceSource) Snapshot(ctx context.Context) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshot == nil {
+		snapshot, err := s.source.Snapshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode snapshot: %w", err)
+		}
+		s.snapshot = data
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(s.snapshot, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+func (s *onceSource) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.info == nil {
+		info, err := s.source.ServerInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.info = info
+	}
+	info := *s.info
+	return &info, nil
+}
+
+func (s *onceSource) String() string {
+	return s.source.String()
+}
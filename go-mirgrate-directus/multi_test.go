@@ -0,0 +1,103 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// serialized returns a function running f that reports an error when it is
+// entered while already running.
+func serialized(t *testing.T, name string, f func()) func() {
+	var running atomic.Int32
+	return func() {
+		if running.Add(1) > 1 {
+			t.Errorf("%s called concurrently", name)
+		}
+		// Give an overlapping call time to enter.
+		time.Sleep(time.Millisecond)
+		f()
+		running.Add(-1)
+	}
+}
+
+func TestMigrateToTargetsParallel(t *testing.T) {
+	base, first, f := newMigration(t)
+	targets := []*directustest.Server{first}
+	for range 3 {
+		target := directustest.NewServer(t)
+		target.SetServerInfo(gomigratedirectus.ServerInfo{Version: f.Snapshot.Directus, Vendor: f.Snapshot.Vendor})
+		target.SetDiff(f.Diff)
+		targets = append(targets, target)
+	}
+	// The first targets answer last, so they also finish last.
+	const step = 50 * time.Millisecond
+	var clients []*gomigratedirectus.DirectusClient
+	var sum time.Duration
+	for i, target := range targets {
+		delay := time.Duration(len(targets)-i) * step
+		sum += delay
+		target.Fail("/schema/diff", 1, directustest.Failure{Delay: delay})
+		clients = append(clients, target.Client(quiet()...))
+	}
+
+	var events, confirms atomic.Int32
+	opts := gomigratedirectus.MigrationOptions{
+		Parallel:         3,
+		NoBackup:         true,
+		VerifyAfterApply: gomigratedirectus.VerifyOff,
+	}
+	confirm := serialized(t, "Confirm", func() { confirms.Add(1) })
+	opts.Confirm = func(context.Context, string, *gomigratedirectus.Diff, gomigratedirectus.DiffSummary) (bool, error) {
+		confirm()
+		return true, nil
+	}
+	onEvent := serialized(t, "OnEvent", func() { events.Add(1) })
+	opts.OnEvent = func(gomigratedirectus.Event) { onEvent() }
+
+	start := time.Now()
+	multi, err := gomigratedirectus.MigrateToTargets(context.Background(), base.Client(quiet()...), clients, opts)
+	if err != nil {
+		t.Fatalf("MigrateToTargets: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= sum {
+		t.Errorf("migrations took %s, want less than the %s of migrating in turn", elapsed, sum)
+	}
+
+	if len(multi.Targets) != len(clients) {
+		t.Fatalf("got %d results, want %d", len(multi.Targets), len(clients))
+	}
+	for i, result := range multi.Targets {
+		if want := gomigratedirectus.RedactURL(clients[i].URL); result.URL != want {
+			t.Errorf("result %d is of %s, want %s in the order given", i, result.URL, want)
+		}
+		if result.Err != nil || result.Skipped || result.Result == nil || !result.Result.Applied {
+			t.Errorf("result %d = %+v, want applied", i, result)
+		}
+	}
+	for i, target := range targets {
+		if n := len(target.ApplyRequests()); n != 1 {
+			t.Errorf("target %d received %d applies, want 1", i, n)
+		}
+	}
+	if n := confirms.Load(); n != int32(len(clients)) {
+		t.Errorf("Confirm called %d times, want once per target", n)
+	}
+	if events.Load() == 0 {
+		t.Error("OnEvent never called")
+	}
+	// The base snapshot is fetched once for all targets.
+	var snapshots int
+	for _, req := range base.Requests() {
+		if req.Path == "/schema/snapshot" {
+			snapshots++
+		}
+	}
+	if snapshots != 1 {
+		t.Errorf("base snapshot fetched %d times, want 1", snapshots)
+	}
+}
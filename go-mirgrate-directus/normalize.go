@@ -0,0 +1,179 @@
+package gomirgratedirectus
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// VolatileKeys are keys of snapshot entries that change between exports of
+// the same schema, such as the ids of the directus_fields and
+// directus_relations rows, for NormalizeOptions.StripKeys.
+var VolatileKeys = []string{"meta.id"}
+
+// NormalizeOptions configures NormalizeSnapshotWithOptions.
+type NormalizeOptions struct {
+	// StripKeys are dotted paths of keys removed from the collections,
+	// fields and relations of the snapshot, such as meta.id. A path of its
+	// own starts with meta or schema; collections., fields. or relations.
+	// in front limits it to entries of that kind, as in fields.meta.id.
+	StripKeys []string
+}
+
+// Validate reports stripped keys that do not name a key of the meta or
+// schema of an entry.
+func (o NormalizeOptions) Validate() error {
+	for _, key := range o.StripKeys {
+		if _, _, ok := parseStripKey(key); !ok {
+			return fmt.Errorf("invalid key %q to strip, expected a path such as meta.id or fields.meta.id", key)
+		}
+	}
+	return nil
+}
+
+// NormalizeSnapshot returns a copy of snapshot that encodes byte for byte
+// the same however the schema was exported: collections are sorted by name,
+// fields by collection and name and relations by collection and field, and
+// numbers such as 1 and 1.0 take a single form. snapshot itself is not
+// modified.
+func NormalizeSnapshot(snapshot *Snapshot) *Snapshot {
+	return NormalizeSnapshotWithOptions(snapshot, NormalizeOptions{})
+}
+
+// NormalizeSnapshotWithOptions normalizes snapshot like NormalizeSnapshot,
+// additionally removing opts.StripKeys. Invalid keys are ignored, see
+// NormalizeOptions.Validate.
+func NormalizeSnapshotWithOptions(snapshot *Snapshot, opts NormalizeOptions) *Snapshot {
+	normalized := *snapshot
+	normalized.Collections = make([]Collection, len(snapshot.Collections))
+	normalized.Fields = make([]Field, len(snapshot.Fields))
+	normalized.Relations = make([]Relation, len(snapshot.Relations))
+
+	for i, collection := range snapshot.Collections {
+		collection.Meta, collection.Schema = normalizeEntry("collections", collection.Meta, collection.Schema, opts.StripKeys)
+		normalized.Collections[i] = collection
+	}
+	for i, field := range snapshot.Fields {
+		field.Meta, field.Schema = normalizeEntry("fields", field.Meta, field.Schema, opts.StripKeys)
+		normalized.Fields[i] = field
+	}
+	for i, relation := range snapshot.Relations {
+		relation.Meta, relation.Schema = normalizeEntry("relations", relation.Meta, relation.Schema, opts.StripKeys)
+		normalized.Relations[i] = relation
+	}
+
+	sort.SliceStable(normalized.Collections, func(i, j int) bool {
+		return normalized.Collections[i].Collection < normalized.Collections[j].Collection
+	})
+	sort.SliceStable(normalized.Fields, func(i, j int) bool {
+		a, b := normalized.Fields[i], normalized.Fields[j]
+		if a.Collection != b.Collection {
+			return a.Collection < b.Collection
+		}
+		return a.Field < b.Field
+	})
+	sort.SliceStable(normalized.Relations, func(i, j int) bool {
+		a, b := normalized.Relations[i], normalized.Relations[j]
+		if a.Collection != b.Collection {
+			return a.Collection < b.Collection
+		}
+		return a.Field < b.Field
+	})
+	return &normalized
+}
+
+// normalizeEntry returns copies of the meta and schema of an entry of the
+// kind section with numbers normalized and stripKeys removed.
+func normalizeEntry(section string, meta, schema map[string]any, stripKeys []string) (map[string]any, map[string]any) {
+	meta, _ = normalizeValue(meta).(map[string]any)
+	schema, _ = normalizeValue(schema).(map[string]any)
+	for _, key := range stripKeys {
+		kind, path, ok := parseStripKey(key)
+		if !ok || (kind != "" && kind != section) {
+			continue
+		}
+		switch path[0] {
+		case "meta":
+			deleteKey(meta, path[1:])
+		case "schema":
+			deleteKey(schema, path[1:])
+		}
+	}
+	return meta, schema
+}
+
+// parseStripKey splits a key of NormalizeOptions.StripKeys into the kind of
+// entries it applies to, empty for all, and its path from the entry.
+func parseStripKey(key string) (string, []string, bool) {
+	path := strings.Split(key, ".")
+	var kind string
+	if slices.Contains([]string{"collections", "fields", "relations"}, path[0]) {
+		kind, path = path[0], path[1:]
+	}
+	if len(path) < 2 || (path[0] != "meta" && path[0] != "schema") || slices.Contains(path, "") {
+		return "", nil, false
+	}
+	return kind, path, true
+}
+
+// deleteKey removes the key at path from m, if there is one.
+func deleteKey(m map[string]any, path []string) {
+	for len(path) > 1 {
+		next, ok := m[path[0]].(map[string]any)
+		if !ok {
+			return
+		}
+		m, path = next, path[1:]
+	}
+	delete(m, path[0])
+}
+
+// normalizeValue returns a deep copy of v with every integer an int64,
+// floats holding one exactly included, and other numbers float64s, so that
+// values decoded from 1, 1.0 or YAML compare and encode the same.
+func normalizeValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		if v == nil {
+			return v
+		}
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[key] = normalizeValue(value)
+		}
+		return m
+	case []any:
+		if v == nil {
+			return v
+		}
+		s := make([]any, len(v))
+		for i, value := range v {
+			s[i] = normalizeValue(value)
+		}
+		return s
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return normalizeValue(f)
+		}
+		return v
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) <= 1<<53 {
+			return int64(v)
+		}
+		return v
+	case float32:
+		return normalizeValue(float64(v))
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	default:
+		return v
+	}
+}
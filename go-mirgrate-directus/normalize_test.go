@@ -0,0 +1,91 @@
+package gomirgratedirectus_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// TestNormalizeSnapshot checks that two exports of the same schema, with
+// entries and keys in other orders, numbers written otherwise and other
+// meta ids, save byte for byte the same once the ids are stripped.
+func TestNormalizeSnapshot(t *testing.T) {
+	var snapshots []*gomigratedirectus.Snapshot
+	for _, name := range []string{"ordered.json", "shuffled.yaml"} {
+		s, err := gomigratedirectus.LoadSnapshot(filepath.Join("testdata", "normalize", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		snapshots = append(snapshots, s)
+	}
+
+	opts := gomigratedirectus.SaveOptions{Normalize: gomigratedirectus.NormalizeOptions{StripKeys: gomigratedirectus.VolatileKeys}}
+	for _, format := range []string{"json", "yaml", "json.gz"} {
+		t.Run(format, func(t *testing.T) {
+			var saved [][]byte
+			for i, s := range snapshots {
+				path := filepath.Join(t.TempDir(), "schema."+format)
+				if err := gomigratedirectus.SaveSnapshotWithOptions(path, s, opts); err != nil {
+					t.Fatalf("SaveSnapshotWithOptions: %v", err)
+				}
+				loaded, err := gomigratedirectus.LoadSnapshot(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := gomigratedirectus.EncodeSnapshot(loaded, gomigratedirectus.FormatJSON)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if format != "json.gz" {
+					if data, err = os.ReadFile(path); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if i > 0 && !bytes.Equal(data, saved[0]) {
+					t.Errorf("saved snapshots differ:\n%s\nwant:\n%s", data, saved[0])
+				}
+				saved = append(saved, data)
+			}
+			if format != "json.gz" {
+				golden(t, filepath.Join("normalize", "normalized."+format+".golden"), saved[0])
+			}
+		})
+	}
+}
+
+func TestNormalizeSnapshotKeepsIDs(t *testing.T) {
+	a, err := gomigratedirectus.LoadSnapshot(filepath.Join("testdata", "normalize", "ordered.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := gomigratedirectus.LoadSnapshot(filepath.Join("testdata", "normalize", "shuffled.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := gomigratedirectus.EncodeSnapshot(a, gomigratedirectus.FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	na, nb := gomigratedirectus.NormalizeSnapshot(a), gomigratedirectus.NormalizeSnapshot(b)
+	if reflect.DeepEqual(na, nb) {
+		t.Error("snapshots with other meta ids normalize the same without stripping them")
+	}
+	if after, _ := gomigratedirectus.EncodeSnapshot(a, gomigratedirectus.FormatJSON); !bytes.Equal(before, after) {
+		t.Error("NormalizeSnapshot modified its argument")
+	}
+	for i := range nb.Fields {
+		delete(na.Fields[i].Meta, "id")
+		delete(nb.Fields[i].Meta, "id")
+	}
+	for i := range nb.Relations {
+		delete(na.Relations[i].Meta, "id")
+		delete(nb.Relations[i].Meta, "id")
+	}
+	if !reflect.DeepEqual(na, nb) {
+		t.Errorf("normalized snapshots differ beyond their meta ids:\n%+v\nwant:\n%+v", nb, na)
+	}
+}
@@ -0,0 +1,252 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Notification is the outcome of a command, such as a migration, sent by a
+// Notifier.
+type Notification struct {
+	Command string `json:"command"`
+	// Environment is the config file environment of the target, if any.
+	Environment string `json:"environment,omitempty"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Success     bool   `json:"success"`
+	DryRun      bool   `json:"dry_run"`
+	Changed     bool   `json:"changed"`
+	Applied     bool   `json:"applied"`
+	// Summary counts the changes, if a diff was computed.
+	Summary *DiffSummary `json:"summary,omitempty"`
+	// Changes is Summary in words, or one line per target of a command
+	// that migrated several.
+	Changes         string    `json:"changes,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// NewNotification describes the command reported by report, which failed with
+// err if not nil. FinishedAt is now unless report has it.
+func NewNotification(report *Report, dryRun bool, err error) Notification {
+	n := Notification{
+		Command:    report.Command,
+		TargetURL:  report.TargetURL,
+		Success:    err == nil,
+		DryRun:     dryRun,
+		Changed:    report.Changed,
+		Applied:    report.Applied,
+		Summary:    report.Summary,
+		StartedAt:  report.StartedAt,
+		FinishedAt: report.FinishedAt,
+	}
+	if n.FinishedAt.IsZero() {
+		n.FinishedAt = time.Now().UTC()
+	}
+	n.DurationSeconds = n.FinishedAt.Sub(n.StartedAt).Seconds()
+	var changes []string
+	for _, target := range report.Targets {
+		if target.Summary != nil {
+			changes = append(changes, target.TargetURL+": "+target.Summary.String())
+		}
+	}
+	for _, hop := range report.Hops {
+		if hop.Summary != nil {
+			changes = append(changes, hop.Environment+": "+hop.Summary.String())
+		}
+	}
+	switch {
+	case n.Summary != nil:
+		n.Changes = n.Summary.String()
+	case len(changes) > 0:
+		n.Changes = strings.Join(changes, "\n")
+	}
+	if err != nil {
+		n.Error = err.Error()
+	}
+	return n
+}
+
+// Duration returns how long the command ran.
+func (n Notification) Duration() time.Duration {
+	return n.FinishedAt.Sub(n.StartedAt)
+}
+
+// Notifier sends notifications, for example to a chat channel.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// WebhookNotifier posts the Notification as JSON to URL.
+type WebhookNotifier struct {
+	URL string
+	// Headers are added to the request, such as an Authorization header.
+	Headers map[string]string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// RetryPolicy retries failed posts. The zero value tries once; see
+	// DefaultRetryPolicy.
+	RetryPolicy RetryPolicy
+}
+
+// Notify posts n to URL.
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	return postNotification(ctx, w.HTTPClient, w.RetryPolicy, w.URL, w.Headers, n)
+}
+
+// SlackNotifier posts a formatted message to a Slack incoming webhook.
+type SlackNotifier struct {
+	WebhookURL string
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// RetryPolicy retries failed posts. The zero value tries once; see
+	// DefaultRetryPolicy.
+	RetryPolicy RetryPolicy
+}
+
+// Notify posts the Slack message for n.
+func (s *SlackNotifier) Notify(ctx context.Context, n Notification) error {
+	return postNotification(ctx, s.HTTPClient, s.RetryPolicy, s.WebhookURL, nil, SlackMessage(n))
+}
+
+// SlackMessage returns the Slack incoming webhook payload for n: a one-line
+// outcome with an attachment listing the environment, the changes, the
+// duration and the error, colored by outcome.
+func SlackMessage(n Notification) map[string]any {
+	where := n.Environment
+	if where == "" {
+		where = n.TargetURL
+	}
+	outcome, emoji, color := "succeeded", ":white_check_mark:", "good"
+	switch {
+	case !n.Success:
+		outcome, emoji, color = "failed", ":x:", "danger"
+	case n.DryRun:
+		outcome, emoji = "dry run completed", ":mag:"
+	case !n.Changed:
+		outcome = "found nothing to change"
+	}
+	text := fmt.Sprintf("%s `%s` %s", emoji, n.Command, outcome)
+	if where != "" {
+		text = fmt.Sprintf("%s `%s` to *%s* %s", emoji, n.Command, where, outcome)
+	}
+
+	changes := n.Changes
+	switch {
+	case changes == "":
+		changes = "none"
+	case n.Applied:
+		changes += " (applied)"
+	}
+	fields := []map[string]any{
+		{"title": "Environment", "value": orDash(n.Environment), "short": true},
+		{"title": "Duration", "value": n.Duration().Round(100 * time.Millisecond).String(), "short": true},
+		{"title": "Changes", "value": changes, "short": false},
+	}
+	if n.TargetURL != "" {
+		fields = append(fields, map[string]any{"title": "Target", "value": n.TargetURL, "short": false})
+	}
+	if n.Error != "" {
+		fields = append(fields, map[string]any{"title": "Error", "value": "```" + strings.ReplaceAll(n.Error, "```", "'''") + "```", "short": false})
+	}
+	return map[string]any{
+		"text": text,
+		"attachments": []map[string]any{{
+			"color":    color,
+			"fallback": text,
+			"fields":   fields,
+			"ts":       n.FinishedAt.Unix(),
+		}},
+	}
+}
+
+// orDash returns value, or "-" if it is empty.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// postNotification posts payload as JSON to endpoint, retrying network errors,
+// 429 and 5xx responses as configured by policy.
+func postNotification(ctx context.Context, client *http.Client, policy RetryPolicy, endpoint string, headers map[string]string, payload any) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	attempts := policy.attempts()
+	for attempt := 1; ; attempt++ {
+		err := postOnce(ctx, client, endpoint, headers, body)
+		if err == nil {
+			return nil
+		}
+		var statusErr *notificationError
+		if attempt >= attempts || ctx.Err() != nil || (errors.As(err, &statusErr) && !statusErr.retryable()) {
+			return err
+		}
+		if err := sleepContext(ctx, policy.delay(attempt)); err != nil {
+			return fmt.Errorf("notification canceled: %w", err)
+		}
+	}
+}
+
+// notificationError is a notification post answered with an unexpected
+// status.
+type notificationError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *notificationError) Error() string {
+	return fmt.Sprintf("notification request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// retryable reports whether the post may succeed when tried again.
+func (e *notificationError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// redactWebhookURL returns rawURL with everything but its scheme and host
+// redacted.
+func redactWebhookURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	return u.Scheme + "://" + u.Host + "/" + redacted
+}
+
+// postOnce posts body to endpoint.
+func postOnce(ctx context.Context, client *http.Client, endpoint string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", DefaultUserAgent())
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL of a webhook is a secret, keep it out of the error.
+		return fmt.Errorf("failed to send notification: %s", strings.ReplaceAll(err.Error(), endpoint, redactWebhookURL(endpoint)))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &notificationError{StatusCode: resp.StatusCode, Body: readErrorBody(resp)}
+	}
+	return nil
+}
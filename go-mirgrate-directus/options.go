@@ -0,0 +1,141 @@
+package gomirgratedirectus
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ClientOption configures a DirectusClient created by NewDirectusClient.
+type ClientOption func(*clientConfig)
+
+// clientConfig collects option values before the client is assembled, so the
+// order in which options are passed does not matter.
+type clientConfig struct {
+	httpClient *http.Client
+	transport  http.RoundTripper
+	timeout    time.Duration
+	headers    http.Header
+
+	retryPolicy *RetryPolicy
+	timeouts    *Timeouts
+	userAgent   string
+	logger      *slog.Logger
+
+	tls      tlsSettings
+	proxyURL string
+
+	maxResponseBytes int64
+	compression      bool
+
+	metrics *Metrics
+	debug   io.Writer
+
+	rateLimiter    *RateLimiter
+	circuitBreaker *CircuitBreaker
+}
+
+// WithTimeout sets a timeout for every single HTTP request, on top of the
+// per-operation Timeouts.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.timeout = timeout
+	}
+}
+
+// WithHTTPClient makes the client send requests through a copy of httpClient
+// instead of a freshly created one. The copy is what other options such as
+// WithTimeout and WithCACert modify.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.httpClient = httpClient
+	}
+}
+
+// WithHeader adds a header that is sent with every request, for example the
+// CF-Access-Client-Id header required by Cloudflare Access.
+func WithHeader(key, value string) ClientOption {
+	return func(cfg *clientConfig) {
+		if cfg.headers == nil {
+			cfg.headers = http.Header{}
+		}
+		cfg.headers.Add(key, value)
+	}
+}
+
+// WithLogger sets the logger that receives debug logs of every request.
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.logger = logger
+	}
+}
+
+// WithUserAgent overrides the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.userAgent = userAgent
+	}
+}
+
+// buildHTTPClient returns the HTTP client described by cfg.
+func (cfg *clientConfig) buildHTTPClient() (*http.Client, error) {
+	httpClient := &http.Client{}
+	if cfg.httpClient != nil {
+		// Copy the client so options never modify one owned by the caller.
+		*httpClient = *cfg.httpClient
+	}
+	if cfg.timeout != 0 {
+		httpClient.Timeout = cfg.timeout
+	}
+
+	if cfg.transport != nil {
+		httpClient.Transport = cfg.transport
+	}
+
+	if cfg.tls.configured() || cfg.proxyURL != "" {
+		transport, err := cloneTransport(httpClient.Transport)
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.configureTransport(transport); err != nil {
+			return nil, err
+		}
+		httpClient.Transport = transport
+	}
+
+	return httpClient, nil
+}
+
+// configureTransport applies the TLS and proxy options of cfg to transport.
+func (cfg *clientConfig) configureTransport(transport *http.Transport) error {
+	if cfg.tls.configured() {
+		tlsConfig, err := cfg.tls.build()
+		if err != nil {
+			return err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	if cfg.proxyURL != "" {
+		proxyURL, err := parseProxyURL(cfg.proxyURL)
+		if err != nil {
+			return err
+		}
+		transport.Proxy = proxyFunc(proxyURL)
+	}
+	return nil
+}
+
+// cloneTransport returns a copy of rt that can be reconfigured, starting from
+// http.DefaultTransport when rt is nil.
+func cloneTransport(rt http.RoundTripper) (*http.Transport, error) {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	transport, ok := rt.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("cannot configure transport of type %T", rt)
+	}
+	return transport.Clone(), nil
+}
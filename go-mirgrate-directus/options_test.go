@@ -0,0 +1,73 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+func TestWithHeader(t *testing.T) {
+	server := directustest.NewServer(t)
+	client := server.Client(quiet(
+		gomigratedirectus.WithHeader("CF-Access-Client-Id", "client-id"),
+		gomigratedirectus.WithHeader("X-Tenant", "a"),
+		gomigratedirectus.WithHeader("X-Tenant", "b"),
+	)...)
+
+	ctx := context.Background()
+	if _, err := client.GetSnapshot(ctx); err != nil {
+		t.Fatalf("GetSnapshot: %v", err)
+	}
+	if _, err := client.GetDiff(ctx, &gomigratedirectus.Snapshot{}, false); err != gomigratedirectus.ErrNoChanges {
+		t.Fatalf("GetDiff = %v, want ErrNoChanges", err)
+	}
+	for _, req := range server.Requests() {
+		if got := req.Header.Get("CF-Access-Client-Id"); got != "client-id" {
+			t.Errorf("%s %s sent CF-Access-Client-Id %q, want %q", req.Method, req.Path, got, "client-id")
+		}
+		if got := req.Header.Values("X-Tenant"); !slices.Equal(got, []string{"a", "b"}) {
+			t.Errorf("%s %s sent X-Tenant %q, want both values", req.Method, req.Path, got)
+		}
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	server := directustest.NewServer(t)
+	server.Fail("/schema/snapshot", 1, directustest.Failure{Delay: time.Second})
+	client := server.Client(noRetry(gomigratedirectus.WithTimeout(50 * time.Millisecond))...)
+
+	start := time.Now()
+	_, err := client.GetSnapshot(context.Background())
+	if err == nil {
+		t.Fatal("GetSnapshot succeeded, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("GetSnapshot returned after %s, want about 50ms", elapsed)
+	}
+	var timeout interface{ Timeout() bool }
+	if !errors.As(err, &timeout) || !timeout.Timeout() {
+		t.Errorf("GetSnapshot error = %v, want a timeout", err)
+	}
+}
+
+func TestWithHTTPClientNotModified(t *testing.T) {
+	server := directustest.NewServer(t)
+	httpClient := &http.Client{}
+	client := server.Client(quiet(
+		gomigratedirectus.WithHTTPClient(httpClient),
+		gomigratedirectus.WithTimeout(time.Second),
+	)...)
+
+	if _, err := client.GetSnapshot(context.Background()); err != nil {
+		t.Fatalf("GetSnapshot: %v", err)
+	}
+	if httpClient.Timeout != 0 {
+		t.Errorf("WithTimeout set the timeout of the caller's client to %s", httpClient.Timeout)
+	}
+}
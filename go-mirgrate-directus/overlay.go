@@ -0,0 +1,380 @@
+package gomirgratedirectus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// An Overlay holds environment-specific changes merged onto a snapshot with
+// MergeOverlay before it is diffed, such as a field that only staging has.
+// Fields and relations are addressed as collection.field:
+//
+//	add:
+//	  fields:
+//	    - collection: articles
+//	      field: debug_notes
+//	      type: text
+//	      meta: {interface: input-multiline}
+//	      schema: {}
+//	remove:
+//	  collections: [legacy_imports]
+//	  fields: [articles.internal_score]
+//	override:
+//	  fields:
+//	    articles.title:
+//	      meta: {note: Shown on the staging site only}
+//
+// Overrides are merged into the meta and schema of the entry like an RFC 7386
+// JSON Merge Patch: objects are merged key by key and a null value removes
+// the key.
+type Overlay struct {
+	// Source is the file the overlay was loaded from, for messages.
+	Source string `json:"-"`
+
+	Add      OverlayEntries   `json:"add"`
+	Remove   OverlayRemovals  `json:"remove"`
+	Override OverlayOverrides `json:"override"`
+}
+
+// OverlayEntries are the entries an Overlay adds to a snapshot.
+type OverlayEntries struct {
+	Collections []Collection `json:"collections"`
+	Fields      []Field      `json:"fields"`
+	Relations   []Relation   `json:"relations"`
+}
+
+// OverlayRemovals name the entries an Overlay removes from a snapshot.
+// Removing a collection removes its fields and the relations from or to it
+// too, and removing a field removes its relation.
+type OverlayRemovals struct {
+	Collections []string `json:"collections"`
+	Fields      []string `json:"fields"`
+	Relations   []string `json:"relations"`
+}
+
+// OverlayOverrides change entries of a snapshot, keyed by collection or
+// collection.field.
+type OverlayOverrides struct {
+	Collections map[string]OverlayOverride `json:"collections"`
+	Fields      map[string]OverlayOverride `json:"fields"`
+	Relations   map[string]OverlayOverride `json:"relations"`
+}
+
+// OverlayOverride is merged into the meta and schema of an entry. Type, if
+// set, replaces the type of a field.
+type OverlayOverride struct {
+	Type   string         `json:"type,omitempty"`
+	Meta   map[string]any `json:"meta,omitempty"`
+	Schema map[string]any `json:"schema,omitempty"`
+}
+
+// OverlayConflict is a change of an Overlay that does not fit the snapshot,
+// such as an override of a field the snapshot does not have. MergeOverlay
+// skips such changes, except additions of entries the snapshot already has,
+// which replace them.
+type OverlayConflict struct {
+	// Path is the entry, such as fields.articles.title.
+	Path    string
+	Problem string
+}
+
+func (c OverlayConflict) String() string {
+	return c.Path + ": " + c.Problem
+}
+
+// OverlayConflictError is returned by ApplyOverlays in strict mode when an
+// overlay has conflicts.
+type OverlayConflictError struct {
+	// Overlay is the Source of the overlay.
+	Overlay   string
+	Conflicts []OverlayConflict
+}
+
+func (e *OverlayConflictError) Error() string {
+	problems := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		problems[i] = c.String()
+	}
+	return fmt.Sprintf("overlay %s does not fit the snapshot: %s", e.Overlay, strings.Join(problems, "; "))
+}
+
+// LoadOverlay reads an overlay file, as YAML or JSON depending on its
+// extension.
+func LoadOverlay(path string) (*Overlay, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read overlay: %w", err)
+	}
+	if SnapshotFormatFromPath(path) == FormatYAML {
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("overlay file %s is not valid YAML: %w", path, err)
+		}
+		if doc, err = yamlToJSONValue(doc); err != nil {
+			return nil, fmt.Errorf("overlay file %s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("failed to convert overlay file %s: %w", path, err)
+		}
+	}
+	var overlay Overlay
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&overlay); err != nil {
+		return nil, fmt.Errorf("overlay file %s is invalid: %w", path, err)
+	}
+	if err := overlay.validate(); err != nil {
+		return nil, fmt.Errorf("overlay file %s is invalid: %w", path, err)
+	}
+	overlay.Source = path
+	return &overlay, nil
+}
+
+// validate checks that the entries and paths of the overlay are complete.
+func (o *Overlay) validate() error {
+	var problems []error
+	for i, c := range o.Add.Collections {
+		if c.Collection == "" {
+			problems = append(problems, fmt.Errorf("add.collections[%d]: collection is required", i))
+		}
+	}
+	for i, f := range o.Add.Fields {
+		if f.Collection == "" || f.Field == "" {
+			problems = append(problems, fmt.Errorf("add.fields[%d]: collection and field are required", i))
+		}
+	}
+	for i, r := range o.Add.Relations {
+		if r.Collection == "" || r.Field == "" {
+			problems = append(problems, fmt.Errorf("add.relations[%d]: collection and field are required", i))
+		}
+	}
+	for section, paths := range map[string][]string{
+		"remove.fields":    o.Remove.Fields,
+		"remove.relations": o.Remove.Relations,
+	} {
+		for _, path := range paths {
+			if _, _, ok := splitFieldPath(path); !ok {
+				problems = append(problems, fmt.Errorf("%s: %q is not a collection.field path", section, path))
+			}
+		}
+	}
+	for section, overrides := range map[string]map[string]OverlayOverride{
+		"override.fields":    o.Override.Fields,
+		"override.relations": o.Override.Relations,
+	} {
+		for path, override := range overrides {
+			if _, _, ok := splitFieldPath(path); !ok {
+				problems = append(problems, fmt.Errorf("%s: %q is not a collection.field path", section, path))
+			}
+			if override.Type != "" && section != "override.fields" {
+				problems = append(problems, fmt.Errorf("%s.%s: only fields have a type", section, path))
+			}
+		}
+	}
+	for path, override := range o.Override.Collections {
+		if override.Type != "" {
+			problems = append(problems, fmt.Errorf("override.collections.%s: only fields have a type", path))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// splitFieldPath splits a collection.field path. Collection names may not
+// contain dots, field names may.
+func splitFieldPath(path string) (string, string, bool) {
+	collection, field, ok := strings.Cut(path, ".")
+	return collection, field, ok && collection != "" && field != ""
+}
+
+// MergeOverlay returns a copy of snapshot with overlay merged onto it:
+// removals first, then additions, then overrides. The changes that do not
+// fit the snapshot are returned as conflicts; see OverlayConflict. snapshot
+// itself is not modified.
+func MergeOverlay(snapshot *Snapshot, overlay *Overlay) (*Snapshot, []OverlayConflict) {
+	merged := *snapshot
+	merged.Collections = slices.Clone(snapshot.Collections)
+	merged.Fields = slices.Clone(snapshot.Fields)
+	merged.Relations = slices.Clone(snapshot.Relations)
+	var conflicts []OverlayConflict
+	conflict := func(path, format string, args ...any) {
+		conflicts = append(conflicts, OverlayConflict{Path: path, Problem: fmt.Sprintf(format, args...)})
+	}
+
+	for _, name := range overlay.Remove.Collections {
+		if !slices.ContainsFunc(merged.Collections, func(c Collection) bool { return c.Collection == name }) {
+			conflict("collections."+name, "cannot remove, the snapshot has no such collection")
+			continue
+		}
+		merged.Collections = slices.DeleteFunc(merged.Collections, func(c Collection) bool { return c.Collection == name })
+		merged.Fields = slices.DeleteFunc(merged.Fields, func(f Field) bool { return f.Collection == name })
+		merged.Relations = slices.DeleteFunc(merged.Relations, func(r Relation) bool {
+			return r.Collection == name || r.RelatedCollection == name
+		})
+	}
+	for _, path := range overlay.Remove.Fields {
+		collection, field, _ := splitFieldPath(path)
+		if findField(merged.Fields, collection, field) < 0 {
+			conflict("fields."+path, "cannot remove, the snapshot has no such field")
+			continue
+		}
+		merged.Fields = slices.DeleteFunc(merged.Fields, func(f Field) bool { return f.Collection == collection && f.Field == field })
+		merged.Relations = slices.DeleteFunc(merged.Relations, func(r Relation) bool { return r.Collection == collection && r.Field == field })
+	}
+	for _, path := range overlay.Remove.Relations {
+		collection, field, _ := splitFieldPath(path)
+		if findRelation(merged.Relations, collection, field) < 0 {
+			conflict("relations."+path, "cannot remove, the snapshot has no such relation")
+			continue
+		}
+		merged.Relations = slices.DeleteFunc(merged.Relations, func(r Relation) bool { return r.Collection == collection && r.Field == field })
+	}
+
+	for _, c := range overlay.Add.Collections {
+		if i := findCollection(merged.Collections, c.Collection); i >= 0 {
+			conflict("collections."+c.Collection, "already in the snapshot, replaced")
+			merged.Collections[i] = c
+			continue
+		}
+		merged.Collections = append(merged.Collections, c)
+	}
+	for _, f := range overlay.Add.Fields {
+		path := f.Collection + "." + f.Field
+		if findCollection(merged.Collections, f.Collection) < 0 {
+			conflict("fields."+path, "cannot add, the snapshot has no collection %s", f.Collection)
+			continue
+		}
+		if i := findField(merged.Fields, f.Collection, f.Field); i >= 0 {
+			conflict("fields."+path, "already in the snapshot, replaced")
+			merged.Fields[i] = f
+			continue
+		}
+		merged.Fields = append(merged.Fields, f)
+	}
+	for _, r := range overlay.Add.Relations {
+		path := r.Collection + "." + r.Field
+		if findField(merged.Fields, r.Collection, r.Field) < 0 {
+			conflict("relations."+path, "cannot add, the snapshot has no field %s", path)
+			continue
+		}
+		if i := findRelation(merged.Relations, r.Collection, r.Field); i >= 0 {
+			conflict("relations."+path, "already in the snapshot, replaced")
+			merged.Relations[i] = r
+			continue
+		}
+		merged.Relations = append(merged.Relations, r)
+	}
+
+	for _, name := range sortedKeys(overlay.Override.Collections) {
+		override := overlay.Override.Collections[name]
+		i := findCollection(merged.Collections, name)
+		if i < 0 {
+			conflict("collections."+name, "cannot override, the snapshot has no such collection")
+			continue
+		}
+		c := &merged.Collections[i]
+		c.Meta, c.Schema = mergeOverride(c.Meta, override.Meta), mergeOverride(c.Schema, override.Schema)
+	}
+	for _, path := range sortedKeys(overlay.Override.Fields) {
+		override := overlay.Override.Fields[path]
+		collection, field, _ := splitFieldPath(path)
+		i := findField(merged.Fields, collection, field)
+		if i < 0 {
+			conflict("fields."+path, "cannot override, the snapshot has no such field")
+			continue
+		}
+		f := &merged.Fields[i]
+		if override.Type != "" {
+			f.Type = override.Type
+		}
+		f.Meta, f.Schema = mergeOverride(f.Meta, override.Meta), mergeOverride(f.Schema, override.Schema)
+	}
+	for _, path := range sortedKeys(overlay.Override.Relations) {
+		override := overlay.Override.Relations[path]
+		collection, field, _ := splitFieldPath(path)
+		i := findRelation(merged.Relations, collection, field)
+		if i < 0 {
+			conflict("relations."+path, "cannot override, the snapshot has no such relation")
+			continue
+		}
+		r := &merged.Relations[i]
+		r.Meta, r.Schema = mergeOverride(r.Meta, override.Meta), mergeOverride(r.Schema, override.Schema)
+	}
+	return &merged, conflicts
+}
+
+// ApplyOverlays merges overlays onto snapshot in order. Conflicts are
+// logged as warnings to logger, slog.Default() if nil, or with strict fail
+// with an *OverlayConflictError.
+func ApplyOverlays(snapshot *Snapshot, overlays []*Overlay, strict bool, logger *slog.Logger) (*Snapshot, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	for _, overlay := range overlays {
+		merged, conflicts := MergeOverlay(snapshot, overlay)
+		if len(conflicts) > 0 && strict {
+			return nil, &OverlayConflictError{Overlay: overlay.Source, Conflicts: conflicts}
+		}
+		for _, c := range conflicts {
+			logger.Warn("overlay conflict", "overlay", overlay.Source, "path", c.Path, "problem", c.Problem)
+		}
+		snapshot = merged
+	}
+	return snapshot, nil
+}
+
+// mergeOverride merges patch into a copy of m like a JSON Merge Patch.
+func mergeOverride(m, patch map[string]any) map[string]any {
+	if patch == nil {
+		return m
+	}
+	merged, _ := mergeOverrideValue(m, patch).(map[string]any)
+	return merged
+}
+
+func mergeOverrideValue(target, patch any) any {
+	patchMap, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetMap, _ := target.(map[string]any)
+	merged := make(map[string]any, len(targetMap)+len(patchMap))
+	for key, value := range targetMap {
+		merged[key] = value
+	}
+	for key, value := range patchMap {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = mergeOverrideValue(merged[key], value)
+	}
+	return merged
+}
+
+func findCollection(collections []Collection, name string) int {
+	return slices.IndexFunc(collections, func(c Collection) bool { return c.Collection == name })
+}
+
+func findField(fields []Field, collection, field string) int {
+	return slices.IndexFunc(fields, func(f Field) bool { return f.Collection == collection && f.Field == field })
+}
+
+func findRelation(relations []Relation, collection, field string) int {
+	return slices.IndexFunc(relations, func(r Relation) bool { return r.Collection == collection && r.Field == field })
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
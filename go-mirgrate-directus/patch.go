@@ -0,0 +1,233 @@
+package gomirgratedirectus
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PatchOperation is an operation of an RFC 6902 JSON Patch document.
+type PatchOperation struct {
+	// Op is add, remove or replace; JSONPatch emits no other operation.
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	// Value is the value added or replaced, empty for a removal.
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch returns the RFC 6902 JSON Patch that turns the JSON encoding of
+// snapshot from into the one of snapshot to, such as the current snapshot of
+// a target and the base snapshot migrated to it. It is meant for reviewing a
+// migration with JSON tooling; migrations themselves apply a Directus diff.
+//
+// Collections, fields and relations are matched by name rather than by
+// position, so that adding a field yields a single add operation and
+// changing one of its properties a single replace operation. Entries of
+// other arrays, and the entries of a snapshot array whose common entries
+// are ordered differently in both snapshots, are replaced as a whole.
+func JSONPatch(from, to *Snapshot) ([]PatchOperation, error) {
+	if from == nil || to == nil {
+		return nil, fmt.Errorf("cannot patch a nil snapshot")
+	}
+	a, err := toGeneric(from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	b, err := toGeneric(to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	p := &patcher{keys: map[string][]string{
+		"/collections": {"collection"},
+		"/fields":      {"collection", "field"},
+		"/relations":   {"collection", "field"},
+	}, ops: []PatchOperation{}}
+	p.value("", a, b)
+	return p.ops, nil
+}
+
+// MergePatch returns the RFC 7386 JSON Merge Patch that turns the JSON
+// encoding of snapshot from into the one of snapshot to. Merge patches
+// replace arrays as a whole, so a change to any collection, field or
+// relation carries the whole array; JSONPatch is finer grained. A merge
+// patch cannot set a property to null either, as null removes it.
+func MergePatch(from, to *Snapshot) (json.RawMessage, error) {
+	if from == nil || to == nil {
+		return nil, fmt.Errorf("cannot patch a nil snapshot")
+	}
+	a, err := toGeneric(from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	b, err := toGeneric(to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	patch, _ := mergePatch(a, b)
+	if patch == nil {
+		patch = map[string]any{}
+	}
+	return mustMarshal(patch), nil
+}
+
+// patcher collects the operations of JSONPatch.
+type patcher struct {
+	// keys lists, by pointer, the arrays whose entries are matched by the
+	// values of these properties.
+	keys map[string][]string
+	ops  []PatchOperation
+}
+
+// value adds the operations that turn lhs into rhs at path.
+func (p *patcher) value(path string, lhs, rhs any) {
+	if l, ok := lhs.([]any); ok {
+		if r, ok := rhs.([]any); ok && p.keys[path] != nil && p.array(path, l, r) {
+			return
+		}
+	}
+	l, lok := lhs.(map[string]any)
+	r, rok := rhs.(map[string]any)
+	if !lok || !rok {
+		if !reflect.DeepEqual(lhs, rhs) {
+			p.ops = append(p.ops, PatchOperation{Op: "replace", Path: path, Value: mustMarshal(rhs)})
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(l)+len(r))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	for k := range r {
+		if _, ok := l[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		sub := path + "/" + escapePointer(k)
+		lv, inL := l[k]
+		rv, inR := r[k]
+		switch {
+		case !inL:
+			p.ops = append(p.ops, PatchOperation{Op: "add", Path: sub, Value: mustMarshal(rv)})
+		case !inR:
+			p.ops = append(p.ops, PatchOperation{Op: "remove", Path: sub})
+		default:
+			p.value(sub, lv, rv)
+		}
+	}
+}
+
+// array adds the operations that turn the keyed array lhs into rhs at path:
+// removals from the last index down, changes to the remaining entries, then
+// additions at their final index. It reports false, adding nothing, when the
+// entries cannot be matched by key or the common entries are not in the same
+// order in both arrays.
+func (p *patcher) array(path string, lhs, rhs []any) bool {
+	lkeys, ok := entryKeys(lhs, p.keys[path])
+	if !ok {
+		return false
+	}
+	rkeys, ok := entryKeys(rhs, p.keys[path])
+	if !ok {
+		return false
+	}
+	lindex := make(map[string]int, len(lkeys))
+	for i, k := range lkeys {
+		lindex[k] = i
+	}
+	rindex := make(map[string]int, len(rkeys))
+	for i, k := range rkeys {
+		rindex[k] = i
+	}
+
+	var kept []int
+	for i, k := range lkeys {
+		if _, ok := rindex[k]; ok {
+			kept = append(kept, i)
+		}
+	}
+	for j := 0; j+1 < len(kept); j++ {
+		if rindex[lkeys[kept[j]]] > rindex[lkeys[kept[j+1]]] {
+			return false
+		}
+	}
+
+	for i := len(lkeys) - 1; i >= 0; i-- {
+		if _, ok := rindex[lkeys[i]]; !ok {
+			p.ops = append(p.ops, PatchOperation{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+	}
+	for j, i := range kept {
+		p.value(path+"/"+strconv.Itoa(j), lhs[i], rhs[rindex[lkeys[i]]])
+	}
+	for i, k := range rkeys {
+		if _, ok := lindex[k]; !ok {
+			p.ops = append(p.ops, PatchOperation{Op: "add", Path: path + "/" + strconv.Itoa(i), Value: mustMarshal(rhs[i])})
+		}
+	}
+	return true
+}
+
+// entryKeys returns the key of each entry of items, made of the values of
+// props, and reports false if an entry is not an object or a key repeats.
+func entryKeys(items []any, props []string) ([]string, bool) {
+	keys := make([]string, len(items))
+	seen := make(map[string]bool, len(items))
+	for i, item := range items {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		parts := make([]string, len(props))
+		for j, prop := range props {
+			parts[j] = fmt.Sprint(entry[prop])
+		}
+		key := strings.Join(parts, "\x00")
+		if seen[key] {
+			return nil, false
+		}
+		seen[key] = true
+		keys[i] = key
+	}
+	return keys, true
+}
+
+// escapePointer escapes a property name as a JSON Pointer reference token.
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+// mergePatch returns the merge patch that turns lhs into rhs, and reports
+// false if they are equal.
+func mergePatch(lhs, rhs any) (any, bool) {
+	l, lok := lhs.(map[string]any)
+	r, rok := rhs.(map[string]any)
+	if !lok || !rok {
+		return rhs, !reflect.DeepEqual(lhs, rhs)
+	}
+	patch := map[string]any{}
+	for k := range l {
+		if _, ok := r[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	for k, rv := range r {
+		lv, ok := l[k]
+		if !ok {
+			patch[k] = rv
+			continue
+		}
+		if sub, changed := mergePatch(lv, rv); changed {
+			patch[k] = sub
+		}
+	}
+	if len(patch) == 0 {
+		return nil, false
+	}
+	return patch, true
+}
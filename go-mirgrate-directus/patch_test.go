@@ -0,0 +1,297 @@
+package gomirgratedirectus_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// generic returns the JSON encoding of v decoded into maps and slices.
+func generic(t *testing.T, v any) any {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g any
+	if err := json.Unmarshal(data, &g); err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// applyPatch applies the add, remove and replace operations of patch to doc
+// as RFC 6902 specifies.
+func applyPatch(doc any, patch []gomigratedirectus.PatchOperation) (any, error) {
+	for _, op := range patch {
+		var value any
+		if op.Op != "remove" {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", op.Op, op.Path, err)
+			}
+		}
+		var err error
+		if doc, err = applyOperation(doc, splitPointer(op.Path), op.Op, value); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+// splitPointer returns the unescaped reference tokens of a JSON Pointer.
+func splitPointer(pointer string) []string {
+	if pointer == "" {
+		return nil
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens
+}
+
+// applyOperation applies op with value at the location of tokens in doc and
+// returns the changed doc.
+func applyOperation(doc any, tokens []string, op string, value any) (any, error) {
+	if len(tokens) == 0 {
+		if op == "remove" {
+			return nil, fmt.Errorf("cannot remove the document")
+		}
+		return value, nil
+	}
+	token, rest := tokens[0], tokens[1:]
+	switch node := doc.(type) {
+	case map[string]any:
+		if len(rest) > 0 {
+			child, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("no member %q", token)
+			}
+			changed, err := applyOperation(child, rest, op, value)
+			node[token] = changed
+			return node, err
+		}
+		_, exists := node[token]
+		switch {
+		case op == "add":
+			node[token] = value
+		case !exists:
+			return nil, fmt.Errorf("no member %q to %s", token, op)
+		case op == "remove":
+			delete(node, token)
+		default:
+			node[token] = value
+		}
+		return node, nil
+	case []any:
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i > len(node) || (i == len(node) && (op != "add" || len(rest) > 0)) {
+			return nil, fmt.Errorf("index %q out of range of %d elements", token, len(node))
+		}
+		if len(rest) > 0 {
+			node[i], err = applyOperation(node[i], rest, op, value)
+			return node, err
+		}
+		switch op {
+		case "add":
+			return slices.Insert(node, i, value), nil
+		case "remove":
+			return slices.Delete(node, i, i+1), nil
+		default:
+			node[i] = value
+			return node, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot descend into %T", doc)
+}
+
+// patchCases returns pairs of snapshots to patch one into the other, built
+// from the fixtures.
+func patchCases(t *testing.T) map[string][2]*gomigratedirectus.Snapshot {
+	t.Helper()
+	versions := directustest.FixtureVersions()
+	oldest, err := directustest.LoadFixture(versions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := directustest.LoadFixture(versions[len(versions)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := latest.Snapshot
+	field := func(collection, name string) gomigratedirectus.Field {
+		return gomigratedirectus.Field{Collection: collection, Field: name, Type: "string",
+			Meta: map[string]any{"interface": "input"}, Schema: map[string]any{"is_nullable": true}}
+	}
+
+	// Removals at several positions, from the first to the last.
+	removed := *s
+	removed.Fields = []gomigratedirectus.Field{s.Fields[1], s.Fields[3]}
+
+	// Additions between, before and after the kept fields.
+	added := *s
+	added.Fields = slices.Clone(s.Fields)
+	added.Fields = slices.Insert(added.Fields, 0, field("articles", "slug"))
+	added.Fields = slices.Insert(added.Fields, 3, field("articles", "summary"))
+	added.Fields = append(added.Fields, field("authors", "bio"), field("authors", "email"))
+
+	// Removals, additions and changes at once.
+	mixed := *s
+	mixed.Fields = []gomigratedirectus.Field{field("articles", "slug"), s.Fields[1], field("articles", "summary"), s.Fields[4], field("authors", "bio")}
+	mixed.Fields[1].Meta = maps.Clone(s.Fields[1].Meta)
+	mixed.Fields[1].Meta["note"] = "Shown in listings"
+	mixed.Fields[1].Meta["a/b~c"] = true
+	delete(mixed.Fields[1].Meta, "width")
+	mixed.Collections = []gomigratedirectus.Collection{s.Collections[1], {Collection: "tags", Meta: map[string]any{"icon": "label"}}}
+	mixed.Relations = nil
+
+	// Common entries in another order, which are replaced as a whole.
+	reordered := *s
+	reordered.Fields = slices.Clone(s.Fields)
+	slices.Reverse(reordered.Fields)
+
+	empty := &gomigratedirectus.Snapshot{Version: 1, Directus: s.Directus}
+	return map[string][2]*gomigratedirectus.Snapshot{
+		"identical":     {s, s},
+		"versions":      {oldest.Snapshot, s},
+		"removed":       {s, &removed},
+		"added":         {s, &added},
+		"mixed":         {s, &mixed},
+		"mixed reverse": {&mixed, s},
+		"reordered":     {s, &reordered},
+		"from empty":    {empty, s},
+		"to empty":      {s, empty},
+	}
+}
+
+func TestJSONPatchRoundTrip(t *testing.T) {
+	for name, c := range patchCases(t) {
+		t.Run(name, func(t *testing.T) {
+			from, to := c[0], c[1]
+			patch, err := gomigratedirectus.JSONPatch(from, to)
+			if err != nil {
+				t.Fatalf("JSONPatch: %v", err)
+			}
+			got, err := applyPatch(generic(t, from), patch)
+			if err != nil {
+				t.Fatalf("applying the patch: %v\npatch: %s", err, generic(t, patch))
+			}
+			if want := generic(t, to); !reflect.DeepEqual(got, want) {
+				t.Errorf("patched snapshot differs from the target snapshot\npatch: %s", generic(t, patch))
+			}
+		})
+	}
+}
+
+func TestJSONPatchIdentical(t *testing.T) {
+	s := patchCases(t)["identical"][0]
+	patch, err := gomigratedirectus.JSONPatch(s, s)
+	if err != nil {
+		t.Fatalf("JSONPatch: %v", err)
+	}
+	if len(patch) != 0 {
+		t.Errorf("JSONPatch of a snapshot to itself = %+v, want no operation", patch)
+	}
+}
+
+// TestJSONPatchIndexes locks down the array indexes: removals run from the
+// highest index down, then additions insert at their final index.
+func TestJSONPatchIndexes(t *testing.T) {
+	cases := patchCases(t)
+	for _, tt := range []struct {
+		name string
+		want []string
+	}{
+		{"removed", []string{"remove /fields/4", "remove /fields/2", "remove /fields/0"}},
+		{"added", []string{"add /fields/0", "add /fields/3", "add /fields/7", "add /fields/8"}},
+		{"mixed", []string{
+			"remove /collections/0", "add /collections/1",
+			"remove /fields/3", "remove /fields/2", "remove /fields/0",
+			"add /fields/0/meta/a~1b~0c", "replace /fields/0/meta/note", "remove /fields/0/meta/width",
+			"add /fields/0", "add /fields/2", "add /fields/4",
+			"replace /relations",
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := gomigratedirectus.JSONPatch(cases[tt.name][0], cases[tt.name][1])
+			if err != nil {
+				t.Fatalf("JSONPatch: %v", err)
+			}
+			var got []string
+			for _, op := range patch {
+				got = append(got, op.Op+" "+op.Path)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("JSONPatch =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+// withoutNulls removes the null properties of the generic JSON value v.
+func withoutNulls(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if e == nil {
+				delete(v, k)
+			} else {
+				v[k] = withoutNulls(e)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = withoutNulls(e)
+		}
+	}
+	return v
+}
+
+// applyMergePatch applies an RFC 7386 merge patch to doc.
+func applyMergePatch(doc, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	d, ok := doc.(map[string]any)
+	if !ok {
+		d = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(d, k)
+		} else {
+			d[k] = applyMergePatch(d[k], v)
+		}
+	}
+	return d
+}
+
+func TestMergePatchRoundTrip(t *testing.T) {
+	for name, c := range patchCases(t) {
+		t.Run(name, func(t *testing.T) {
+			from, to := c[0], c[1]
+			patch, err := gomigratedirectus.MergePatch(from, to)
+			if err != nil {
+				t.Fatalf("MergePatch: %v", err)
+			}
+			var p any
+			if err := json.Unmarshal(patch, &p); err != nil {
+				t.Fatal(err)
+			}
+			// Merge patches cannot set a property to null, only remove it.
+			got, want := withoutNulls(applyMergePatch(generic(t, from), p)), withoutNulls(generic(t, to))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("patched snapshot differs from the target snapshot\npatch: %s", patch)
+			}
+		})
+	}
+}
@@ -0,0 +1,425 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// PublicRole is the name SyncPermissions reports for the public role, whose
+// permissions have no role ID.
+const PublicRole = "$public"
+
+// Role is a role of a Directus project, as listed by /roles. Extra holds the
+// remaining properties, such as icon and app_access. With the policy model,
+// admin access is granted by policies instead.
+type Role struct {
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name"`
+	AdminAccess bool   `json:"admin_access,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Permission is a permission row, as listed by /permissions. With the role
+// model it belongs to Role, which is nil for the public role; with the policy
+// model it belongs to Policy. Extra holds the rules, such as permissions,
+// validation, presets and fields.
+type Permission struct {
+	ID         json.Number `json:"id,omitempty"`
+	Role       *string     `json:"role,omitempty"`
+	Policy     *string     `json:"policy,omitempty"`
+	Collection string      `json:"collection"`
+	Action     string      `json:"action"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (r Role) MarshalJSON() ([]byte, error) {
+	type plain Role
+	return marshalWithExtra(plain(r), r.Extra)
+}
+
+func (r *Role) UnmarshalJSON(data []byte) error {
+	type plain Role
+	return unmarshalWithExtra(data, (*plain)(r), &r.Extra)
+}
+
+func (p Permission) MarshalJSON() ([]byte, error) {
+	type plain Permission
+	return marshalWithExtra(plain(p), p.Extra)
+}
+
+func (p *Permission) UnmarshalJSON(data []byte) error {
+	type plain Permission
+	return unmarshalWithExtra(data, (*plain)(p), &p.Extra)
+}
+
+// roleReadOnlyKeys are the role properties that are not copied between
+// instances: the users assigned to a role differ per instance, policies are
+// attached through access rows, and nesting is not synced.
+var roleReadOnlyKeys = []string{"users", "policies", "parent", "children"}
+
+// ListRoles returns all roles of the project.
+func (c *DirectusClient) ListRoles(ctx context.Context) (_ []Role, err error) {
+	ctx, done := startOperation(ctx, "list roles", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var roles []Role
+	if err := c.doJSON(ctx, "list roles", http.MethodGet, "/roles", url.Values{"limit": {"-1"}}, nil, &roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// CreateRole creates role, ignoring its ID, and returns the created role.
+func (c *DirectusClient) CreateRole(ctx context.Context, role Role) (_ *Role, err error) {
+	ctx, done := startOperation(ctx, "create role", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	role.ID = ""
+	var created Role
+	if err := c.doJSON(ctx, "create role", http.MethodPost, "/roles", nil, role, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateRole replaces the properties of the role with the given ID with those
+// of role.
+func (c *DirectusClient) UpdateRole(ctx context.Context, id string, role Role) (err error) {
+	ctx, done := startOperation(ctx, "update role", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	role.ID = ""
+	return c.doJSON(ctx, "update role", http.MethodPatch, "/roles/"+url.PathEscape(id), nil, role, nil)
+}
+
+// ListPermissions returns all permission rows of the project.
+func (c *DirectusClient) ListPermissions(ctx context.Context) (_ []Permission, err error) {
+	ctx, done := startOperation(ctx, "list permissions", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var permissions []Permission
+	if err := c.doJSON(ctx, "list permissions", http.MethodGet, "/permissions", url.Values{"limit": {"-1"}}, nil, &permissions); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// CreatePermission creates permission, ignoring its ID.
+func (c *DirectusClient) CreatePermission(ctx context.Context, permission Permission) (err error) {
+	ctx, done := startOperation(ctx, "create permission", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	permission.ID = ""
+	return c.doJSON(ctx, "create permission", http.MethodPost, "/permissions", nil, permission, nil)
+}
+
+// UpdatePermission replaces the permission row with the given ID with
+// permission.
+func (c *DirectusClient) UpdatePermission(ctx context.Context, id string, permission Permission) (err error) {
+	ctx, done := startOperation(ctx, "update permission", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	permission.ID = ""
+	return c.doJSON(ctx, "update permission", http.MethodPatch, "/permissions/"+url.PathEscape(id), nil, permission, nil)
+}
+
+// DeletePermission deletes the permission row with the given ID.
+func (c *DirectusClient) DeletePermission(ctx context.Context, id string) (err error) {
+	ctx, done := startOperation(ctx, "delete permission", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "delete permission", http.MethodDelete, "/permissions/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// RolePermissionsResult describes what SyncPermissions did for one role.
+type RolePermissionsResult struct {
+	// Role is the role name, or PublicRole.
+	Role string `json:"role"`
+	// Created and Updated tell whether the role itself was created on or
+	// updated in the target.
+	Created bool `json:"created,omitempty"`
+	Updated bool `json:"updated,omitempty"`
+	// Permissions counts the permission rows created, updated and deleted.
+	// It stays zero with the policy model, where permissions belong to
+	// policies.
+	Permissions ChangeCounts `json:"permissions"`
+}
+
+// Changed reports whether anything changed for the role.
+func (r RolePermissionsResult) Changed() bool {
+	return r.Created || r.Updated || r.Permissions.Total() > 0
+}
+
+// PermissionsResult is the result of SyncPermissions.
+type PermissionsResult struct {
+	// Model is the permission model of both instances.
+	Model PermissionModel `json:"model"`
+	// Roles lists the synced roles, sorted by name with the public role
+	// first in the role model.
+	Roles []RolePermissionsResult `json:"roles"`
+	// Policies lists the synced policies of the policy model, sorted by
+	// name.
+	Policies []PolicyResult `json:"policies,omitempty"`
+	// Access counts the access rows attaching policies to roles that were
+	// created and deleted in the policy model.
+	Access ChangeCounts `json:"access"`
+	// SkippedAdminRoles lists the roles, or in the policy model the
+	// policies, with admin access, which are not synced because they bypass
+	// permissions.
+	SkippedAdminRoles []string `json:"skipped_admin_roles,omitempty"`
+	// DryRun reports that the changes were only computed.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Changed reports whether any role, policy, permission or access row
+// changed.
+func (r *PermissionsResult) Changed() bool {
+	return slices.ContainsFunc(r.Roles, RolePermissionsResult.Changed) ||
+		slices.ContainsFunc(r.Policies, PolicyResult.Changed) || r.Access.Total() > 0
+}
+
+// SyncPermissions copies the roles and permissions of base to target. Roles
+// are matched by name, since their IDs differ between instances, and created
+// or updated on the target; roles that only exist on the target are left
+// alone. The permission rows of each synced role, including the public role,
+// are matched by collection and action: missing rows are created, differing
+// rows replaced and rows that base does not have deleted. Roles with admin
+// access are skipped. With dryRun nothing is written and the result tells
+// what would change.
+//
+// With the policy model of Directus 11, see PermissionModel, permissions
+// belong to policies instead: policies are matched by name and synced with
+// their permissions the same way, and the access rows granting them to roles
+// and the public are recreated with the IDs of the target. Policies with
+// admin access are skipped. Both instances must use the same model.
+//
+// Permissions reference collections, so the schema should be migrated first.
+func SyncPermissions(ctx context.Context, base, target *DirectusClient, dryRun bool) (*PermissionsResult, error) {
+	baseModel, err := base.PermissionModel(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect base permission model: %w", err)
+	}
+	targetModel, err := target.PermissionModel(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect target permission model: %w", err)
+	}
+	if baseModel != targetModel {
+		return nil, fmt.Errorf("base uses the %s permission model but target uses the %s model, permissions cannot be synced between them", baseModel, targetModel)
+	}
+	if baseModel == PermissionModelPolicies {
+		return syncPolicies(ctx, base, target, dryRun)
+	}
+	return syncRoles(ctx, base, target, dryRun)
+}
+
+// syncRoles implements SyncPermissions for the role model.
+func syncRoles(ctx context.Context, base, target *DirectusClient, dryRun bool) (*PermissionsResult, error) {
+	baseRoles, err := base.ListRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list base roles: %w", err)
+	}
+	basePermissions, err := base.ListPermissions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list base permissions: %w", err)
+	}
+	targetRoles, err := target.ListRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target roles: %w", err)
+	}
+	targetPermissions, err := target.ListPermissions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target permissions: %w", err)
+	}
+
+	result := &PermissionsResult{Model: PermissionModelRoles, DryRun: dryRun}
+	var synced []Role
+	for _, role := range baseRoles {
+		if role.AdminAccess {
+			result.SkippedAdminRoles = append(result.SkippedAdminRoles, role.Name)
+			continue
+		}
+		synced = append(synced, role)
+	}
+	slices.SortFunc(synced, func(a, b Role) int { return strings.Compare(a.Name, b.Name) })
+	slices.Sort(result.SkippedAdminRoles)
+
+	// The public role comes first; its permissions have no role on either
+	// side.
+	public := RolePermissionsResult{Role: PublicRole}
+	err = syncPermissionRows(ctx, target, "role "+PublicRole, func(*Permission) {},
+		ownedBy(basePermissions, nil, byRole), ownedBy(targetPermissions, nil, byRole), dryRun, &public.Permissions)
+	result.Roles = append(result.Roles, public)
+	if err != nil {
+		return result, err
+	}
+
+	targetByName := indexByName(targetRoles, func(r Role) string { return r.Name })
+	for _, role := range synced {
+		roleResult := RolePermissionsResult{Role: role.Name}
+		targetID, err := syncRole(ctx, target, role, targetByName, dryRun, &roleResult)
+		if err == nil {
+			var existing []Permission
+			if targetID != "" {
+				existing = ownedBy(targetPermissions, &targetID, byRole)
+			}
+			err = syncPermissionRows(ctx, target, "role "+role.Name, func(p *Permission) { p.Role = &targetID },
+				ownedBy(basePermissions, &role.ID, byRole), existing, dryRun, &roleResult.Permissions)
+		}
+		result.Roles = append(result.Roles, roleResult)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// syncRole creates or updates role on target and returns its ID there, which
+// is empty when it would only be created in a dry run.
+func syncRole(ctx context.Context, target *DirectusClient, role Role, targetByName map[string]Role, dryRun bool, result *RolePermissionsResult) (string, error) {
+	role.Extra = withoutKeys(role.Extra, roleReadOnlyKeys)
+	existing, ok := targetByName[role.Name]
+	if !ok {
+		result.Created = true
+		if dryRun {
+			return "", nil
+		}
+		created, err := target.CreateRole(ctx, role)
+		if err != nil {
+			return "", fmt.Errorf("failed to create role %s: %w", role.Name, err)
+		}
+		return created.ID, nil
+	}
+
+	existing.Extra = withoutKeys(existing.Extra, roleReadOnlyKeys)
+	if sameExceptID(role, existing) {
+		return existing.ID, nil
+	}
+	result.Updated = true
+	if !dryRun {
+		if err := target.UpdateRole(ctx, existing.ID, role); err != nil {
+			return "", fmt.Errorf("failed to update role %s: %w", role.Name, err)
+		}
+	}
+	return existing.ID, nil
+}
+
+// syncPermissionRows makes the target permissions have of one owner, a role
+// or a policy described by owner in errors, match want. setOwner points a
+// permission of want at the owner on the target.
+func syncPermissionRows(ctx context.Context, target *DirectusClient, owner string, setOwner func(*Permission), want, have []Permission, dryRun bool, counts *ChangeCounts) error {
+	type key struct{ collection, action string }
+	existing := make(map[key]Permission, len(have))
+	for _, permission := range have {
+		existing[key{permission.Collection, permission.Action}] = permission
+	}
+
+	for _, permission := range want {
+		k := key{permission.Collection, permission.Action}
+		setOwner(&permission)
+		current, ok := existing[k]
+		delete(existing, k)
+		switch {
+		case !ok:
+			counts.Created++
+			if !dryRun {
+				if err := target.CreatePermission(ctx, permission); err != nil {
+					return fmt.Errorf("failed to create %s permission on %s for %s: %w", k.action, k.collection, owner, err)
+				}
+			}
+		case !sameExceptID(permission, current):
+			counts.Updated++
+			if !dryRun {
+				if err := target.UpdatePermission(ctx, current.ID.String(), permission); err != nil {
+					return fmt.Errorf("failed to update %s permission on %s for %s: %w", k.action, k.collection, owner, err)
+				}
+			}
+		}
+	}
+
+	// Rows without an ID are computed by Directus rather than stored.
+	stale := make([]Permission, 0, len(existing))
+	for _, permission := range existing {
+		if permission.ID != "" {
+			stale = append(stale, permission)
+		}
+	}
+	slices.SortFunc(stale, func(a, b Permission) int { return strings.Compare(a.ID.String(), b.ID.String()) })
+	for _, permission := range stale {
+		counts.Deleted++
+		if !dryRun {
+			if err := target.DeletePermission(ctx, permission.ID.String()); err != nil {
+				return fmt.Errorf("failed to delete %s permission on %s for %s: %w", permission.Action, permission.Collection, owner, err)
+			}
+		}
+	}
+	return nil
+}
+
+func byRole(p Permission) *string   { return p.Role }
+func byPolicy(p Permission) *string { return p.Policy }
+
+// ownedBy returns the permissions whose owner, the role or policy returned
+// by owner, has the ID id; a nil id matches permissions without an owner.
+func ownedBy(permissions []Permission, id *string, owner func(Permission) *string) []Permission {
+	var matching []Permission
+	for _, permission := range permissions {
+		if sameID(owner(permission), id) {
+			matching = append(matching, permission)
+		}
+	}
+	return matching
+}
+
+// sameID reports whether two optional IDs are both nil or equal.
+func sameID(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// indexByName maps items by the name returned by name.
+func indexByName[T any](items []T, name func(T) string) map[string]T {
+	index := make(map[string]T, len(items))
+	for _, item := range items {
+		index[name(item)] = item
+	}
+	return index
+}
+
+// sameExceptID reports whether a and b, such as two roles or permissions,
+// have the same JSON representation apart from their IDs and owners.
+func sameExceptID(a, b any) bool {
+	ga, errA := toGeneric(a)
+	gb, errB := toGeneric(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	for _, g := range []any{ga, gb} {
+		if m, ok := g.(map[string]any); ok {
+			delete(m, "id")
+			delete(m, "role")
+			delete(m, "policy")
+		}
+	}
+	return reflect.DeepEqual(ga, gb)
+}
+
+// withoutKeys returns a copy of extra without keys.
+func withoutKeys(extra map[string]json.RawMessage, keys []string) map[string]json.RawMessage {
+	out := make(map[string]json.RawMessage, len(extra))
+	for key, value := range extra {
+		if !slices.Contains(keys, key) {
+			out[key] = value
+		}
+	}
+	return out
+}
@@ -0,0 +1,425 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// instanceServer fakes the system collection endpoints of one Directus
+// instance, such as /roles, /permissions, /policies, /access and /presets,
+// serving rows from a fixture. Collections the fixture leaves out answer 404
+// like a Directus version without them.
+type instanceServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	version string
+	rows    map[string][]map[string]any
+	// writes lists the method and path of every write.
+	writes []string
+	// bodies holds the body of every write by method and path.
+	bodies  map[string]map[string]any
+	lastIDs map[string]int
+}
+
+// numericIDs are the collections whose rows have integer IDs, like in
+// Directus; the others use UUIDs.
+var numericIDs = []string{"permissions", "presets"}
+
+// instanceFixture is one instance of a fixture in testdata.
+type instanceFixture struct {
+	Version string `json:"version"`
+	// The remaining keys are collections, such as roles.
+	Rows map[string][]map[string]any `json:"-"`
+}
+
+func (f *instanceFixture) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if version, ok := raw["version"]; ok {
+		if err := json.Unmarshal(version, &f.Version); err != nil {
+			return err
+		}
+		delete(raw, "version")
+	}
+	f.Rows = map[string][]map[string]any{}
+	for collection, rows := range raw {
+		var decoded []map[string]any
+		if err := json.Unmarshal(rows, &decoded); err != nil {
+			return fmt.Errorf("%s: %w", collection, err)
+		}
+		f.Rows[collection] = decoded
+	}
+	return nil
+}
+
+// newInstances serves the base and target instances of the fixture at
+// testdata/name.
+func newInstances(t *testing.T, name string) (base, target *instanceServer) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixture struct {
+		Base   instanceFixture `json:"base"`
+		Target instanceFixture `json:"target"`
+	}
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return newInstanceServer(t, fixture.Base), newInstanceServer(t, fixture.Target)
+}
+
+func newInstanceServer(t *testing.T, fixture instanceFixture) *instanceServer {
+	t.Helper()
+	s := &instanceServer{
+		version: fixture.Version,
+		rows:    fixture.Rows,
+		bodies:  map[string]map[string]any{},
+		lastIDs: map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *instanceServer) client() *gomigratedirectus.DirectusClient {
+	return gomigratedirectus.NewDirectusClient(s.URL, "token", quiet()...)
+}
+
+func (s *instanceServer) setVersion(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = version
+}
+
+// list returns the rows of collection.
+func (s *instanceServer) list(collection string) []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.rows[collection])
+}
+
+func (s *instanceServer) written() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.writes)
+}
+
+func (s *instanceServer) body(request string) map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bodies[request]
+}
+
+func (s *instanceServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var body map[string]any
+	json.NewDecoder(r.Body).Decode(&body)
+
+	if r.Method == http.MethodGet && r.URL.Path == "/server/info" {
+		data := map[string]any{"project": map[string]any{"project_name": "Directus"}}
+		if s.version != "" {
+			data["version"] = s.version
+		}
+		writeTestData(w, data)
+		return
+	}
+
+	collection, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	rows, ok := s.rows[collection]
+	if !ok {
+		writeTestError(w, http.StatusNotFound, "ROUTE_NOT_FOUND", "Route "+r.URL.Path+" doesn't exist.")
+		return
+	}
+	if r.Method != http.MethodGet {
+		request := r.Method + " " + r.URL.Path
+		s.writes = append(s.writes, request)
+		s.bodies[request] = maps.Clone(body)
+	}
+	index := slices.IndexFunc(rows, func(row map[string]any) bool { return fmt.Sprint(row["id"]) == id })
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		writeTestData(w, rows)
+	case r.Method == http.MethodPost && id == "":
+		s.lastIDs[collection]++
+		if slices.Contains(numericIDs, collection) {
+			body["id"] = float64(100 + s.lastIDs[collection])
+		} else {
+			body["id"] = fmt.Sprintf("%s-%d", collection, s.lastIDs[collection])
+		}
+		s.rows[collection] = append(rows, body)
+		writeTestData(w, body)
+	case index < 0:
+		writeTestError(w, http.StatusForbidden, "FORBIDDEN", "You don't have permission to access this.")
+	case r.Method == http.MethodPatch:
+		for key, value := range body {
+			rows[index][key] = value
+		}
+		writeTestData(w, rows[index])
+	case r.Method == http.MethodDelete:
+		s.rows[collection] = slices.Delete(rows, index, index+1)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeTestError(w, http.StatusMethodNotAllowed, "INVALID_PAYLOAD", "Method not allowed.")
+	}
+}
+
+// names maps the IDs of the rows of collection to their names, so that
+// tests can compare references across instances.
+func (s *instanceServer) names(collection string) map[any]string {
+	names := map[any]string{nil: "public"}
+	for _, row := range s.list(collection) {
+		names[row["id"]] = row["name"].(string)
+	}
+	return names
+}
+
+// permissionRows describes the permission rows of s by owner name,
+// collection, action and fields, sorted.
+func permissionRows(s *instanceServer, ownerKey, owners string) []string {
+	names := s.names(owners)
+	var rows []string
+	for _, p := range s.list("permissions") {
+		owner, ok := names[p[ownerKey]]
+		if !ok {
+			owner = fmt.Sprintf("unknown %s %v", ownerKey, p[ownerKey])
+		}
+		rows = append(rows, fmt.Sprintf("%s %s %s %v", owner, p["collection"], p["action"], p["fields"]))
+	}
+	slices.Sort(rows)
+	return rows
+}
+
+func TestSyncPermissionsRoleModel(t *testing.T) {
+	ctx := context.Background()
+	base, target := newInstances(t, "permissions/roles.json")
+
+	result, err := gomigratedirectus.SyncPermissions(ctx, base.client(), target.client(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &gomigratedirectus.PermissionsResult{
+		Model: gomigratedirectus.PermissionModelRoles,
+		Roles: []gomigratedirectus.RolePermissionsResult{
+			{Role: gomigratedirectus.PublicRole},
+			{Role: "Editor", Updated: true, Permissions: gomigratedirectus.ChangeCounts{Updated: 1, Deleted: 1}},
+			{Role: "Viewer", Created: true, Permissions: gomigratedirectus.ChangeCounts{Created: 1}},
+		},
+		SkippedAdminRoles: []string{"Administrator"},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+
+	// The target keeps its own role IDs, and the new role's permission
+	// points at the ID the target gave it.
+	wantRows := []string{
+		"Administrator settings delete [*]",
+		"Editor articles create [*]",
+		"Editor articles update [title body]",
+		"Viewer articles read [*]",
+		"public articles read [*]",
+	}
+	if got := permissionRows(target, "role", "roles"); !reflect.DeepEqual(got, wantRows) {
+		t.Errorf("target permissions = %q, want %q", got, wantRows)
+	}
+	wantWrites := []string{
+		"PATCH /roles/t-editor",
+		"PATCH /permissions/13",
+		"DELETE /permissions/14",
+		"POST /roles",
+		"POST /permissions",
+	}
+	if got := target.written(); !slices.Equal(got, wantWrites) {
+		t.Errorf("target writes = %q, want %q", got, wantWrites)
+	}
+	if got := base.written(); len(got) > 0 {
+		t.Errorf("base writes = %q, want none", got)
+	}
+
+	// Users belong to the instance and IDs are the target's to choose.
+	for _, request := range []string{"PATCH /roles/t-editor", "POST /roles"} {
+		body := target.body(request)
+		for _, key := range []string{"id", "users"} {
+			if _, ok := body[key]; ok {
+				t.Errorf("%s sent %s: %v", request, key, body)
+			}
+		}
+	}
+	if got := target.body("POST /permissions")["role"]; got != "roles-1" {
+		t.Errorf("created permission role = %v, want roles-1", got)
+	}
+}
+
+func TestSyncPermissionsPolicyModel(t *testing.T) {
+	ctx := context.Background()
+	base, target := newInstances(t, "permissions/policies.json")
+
+	result, err := gomigratedirectus.SyncPermissions(ctx, base.client(), target.client(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &gomigratedirectus.PermissionsResult{
+		Model: gomigratedirectus.PermissionModelPolicies,
+		Roles: []gomigratedirectus.RolePermissionsResult{
+			{Role: "Editor"},
+			{Role: "Viewer", Created: true},
+		},
+		Policies: []gomigratedirectus.PolicyResult{
+			{Policy: "$t:public_label"},
+			{Policy: "Editing", Updated: true, Permissions: gomigratedirectus.ChangeCounts{Created: 1, Deleted: 1}},
+			{Policy: "Reading", Created: true, Permissions: gomigratedirectus.ChangeCounts{Created: 1}},
+		},
+		Access:            gomigratedirectus.ChangeCounts{Created: 2, Deleted: 1},
+		SkippedAdminRoles: []string{"Administrator"},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+
+	wantRows := []string{
+		"$t:public_label articles read [*]",
+		"Editing articles create [*]",
+		"Editing articles update [title body]",
+		"Reading articles read [*]",
+	}
+	if got := permissionRows(target, "policy", "policies"); !reflect.DeepEqual(got, wantRows) {
+		t.Errorf("target permissions = %q, want %q", got, wantRows)
+	}
+
+	// Access rows reference the target's roles and policies, including the
+	// ones just created; the public grant of Editing that the base lacks is
+	// revoked and the grant to a single user is left alone.
+	roles, policies := target.names("roles"), target.names("policies")
+	var access []string
+	for _, row := range target.list("access") {
+		grantee := roles[row["role"]]
+		if row["user"] != nil {
+			grantee = fmt.Sprint("user ", row["user"])
+		}
+		access = append(access, grantee+" "+policies[row["policy"]])
+	}
+	slices.Sort(access)
+	wantAccess := []string{
+		"Editor Editing",
+		"Editor Reading",
+		"Viewer Reading",
+		"public $t:public_label",
+		"user t-ed Editing",
+	}
+	if !slices.Equal(access, wantAccess) {
+		t.Errorf("target access = %q, want %q", access, wantAccess)
+	}
+
+	for _, request := range []string{"PATCH /policies/t-editing", "POST /policies"} {
+		body := target.body(request)
+		for _, key := range []string{"id", "permissions", "users", "roles"} {
+			if _, ok := body[key]; ok {
+				t.Errorf("%s sent %s: %v", request, key, body)
+			}
+		}
+	}
+	if body := target.body("POST /roles"); body["policies"] != nil || body["id"] != nil {
+		t.Errorf("POST /roles sent policies or id: %v", body)
+	}
+	if got := base.written(); len(got) > 0 {
+		t.Errorf("base writes = %q, want none", got)
+	}
+}
+
+func TestSyncPermissionsDryRun(t *testing.T) {
+	for _, fixture := range []string{"roles.json", "policies.json"} {
+		t.Run(strings.TrimSuffix(fixture, ".json"), func(t *testing.T) {
+			ctx := context.Background()
+			base, target := newInstances(t, "permissions/"+fixture)
+			dryRun, err := gomigratedirectus.SyncPermissions(ctx, base.client(), target.client(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := target.written(); len(got) > 0 {
+				t.Errorf("dry run wrote %q", got)
+			}
+
+			// A dry run predicts what the real sync does.
+			result, err := gomigratedirectus.SyncPermissions(ctx, base.client(), target.client(), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !dryRun.DryRun || !dryRun.Changed() {
+				t.Errorf("dry run = %+v, want changes", dryRun)
+			}
+			dryRun.DryRun = false
+			if !reflect.DeepEqual(dryRun, result) {
+				t.Errorf("dry run = %+v, sync = %+v", dryRun, result)
+			}
+
+			again, err := gomigratedirectus.SyncPermissions(ctx, base.client(), target.client(), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.Changed() {
+				t.Errorf("second sync = %+v, want no changes", again)
+			}
+		})
+	}
+}
+
+func TestSyncPermissionsModelMismatch(t *testing.T) {
+	ctx := context.Background()
+	base, _ := newInstances(t, "permissions/roles.json")
+	_, target := newInstances(t, "permissions/policies.json")
+
+	_, err := gomigratedirectus.SyncPermissions(ctx, base.client(), target.client(), false)
+	if err == nil || !strings.Contains(err.Error(), "base uses the roles permission model but target uses the policies model") {
+		t.Fatalf("err = %v, want a permission model mismatch", err)
+	}
+	if got := slices.Concat(base.written(), target.written()); len(got) > 0 {
+		t.Errorf("writes = %q, want none", got)
+	}
+}
+
+func TestPermissionModel(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		fixture string
+		version string
+		want    gomigratedirectus.PermissionModel
+	}{
+		{"roles.json", "10.12.1", gomigratedirectus.PermissionModelRoles},
+		{"roles.json", "v9.26.0", gomigratedirectus.PermissionModelRoles},
+		{"policies.json", "11.1.0", gomigratedirectus.PermissionModelPolicies},
+		// Non-admin tokens see no version, so /policies is probed.
+		{"roles.json", "", gomigratedirectus.PermissionModelRoles},
+		{"policies.json", "", gomigratedirectus.PermissionModelPolicies},
+	} {
+		t.Run(tt.fixture+" "+tt.version, func(t *testing.T) {
+			server, _ := newInstances(t, "permissions/"+tt.fixture)
+			server.setVersion(tt.version)
+			got, err := server.client().PermissionModel(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("PermissionModel = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package gomirgratedirectus
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// placeholderPattern matches the ${NAME} placeholders of snapshot values,
+// and the $${NAME} escapes standing for a literal ${NAME}.
+var placeholderPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// MissingVariablesError is returned by SubstitutePlaceholders when
+// placeholders name variables that are neither given nor set in the
+// environment.
+type MissingVariablesError struct {
+	// Names are the missing variables, sorted.
+	Names []string
+}
+
+func (e *MissingVariablesError) Error() string {
+	return fmt.Sprintf("unresolved snapshot placeholders, variables not set: %s", strings.Join(e.Names, ", "))
+}
+
+// SubstitutePlaceholders returns a copy of snapshot with the ${NAME}
+// placeholders in the string values of the meta and schema of its
+// collections, fields and relations replaced with the variable NAME of
+// vars, or of the process environment if vars does not have it, so that
+// field defaults and validation messages can hold environment-specific
+// values such as URLs. $${NAME} stands for a literal ${NAME}. All missing
+// variables are reported at once as a *MissingVariablesError. snapshot
+// itself is not modified.
+func SubstitutePlaceholders(snapshot *Snapshot, vars map[string]string) (*Snapshot, error) {
+	missing := map[string]bool{}
+	substituted := mapSnapshotStrings(snapshot, func(s string) string {
+		return placeholderPattern.ReplaceAllStringFunc(s, func(ref string) string {
+			if strings.HasPrefix(ref, "$$") {
+				return ref[1:]
+			}
+			name := ref[2 : len(ref)-1]
+			if value, ok := vars[name]; ok {
+				return value
+			}
+			if value, ok := os.LookupEnv(name); ok {
+				return value
+			}
+			missing[name] = true
+			return ref
+		})
+	})
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return nil, &MissingVariablesError{Names: names}
+	}
+	return substituted, nil
+}
+
+// TemplatizeSnapshot is the inverse of SubstitutePlaceholders: it returns a
+// copy of snapshot with the values of vars found in its string values
+// replaced with ${NAME} placeholders, longest values first, and existing
+// ${ escaped as $${, so that exporting from one environment gives a snapshot
+// that loads into any other. Empty values are ignored. snapshot itself is
+// not modified.
+func TemplatizeSnapshot(snapshot *Snapshot, vars map[string]string) *Snapshot {
+	type variable struct{ name, value string }
+	var ordered []variable
+	for name, value := range vars {
+		if value != "" {
+			ordered = append(ordered, variable{name, value})
+		}
+	}
+	slices.SortFunc(ordered, func(a, b variable) int {
+		if c := cmp.Compare(len(b.value), len(a.value)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	return mapSnapshotStrings(snapshot, func(s string) string {
+		s = placeholderPattern.ReplaceAllStringFunc(s, func(ref string) string { return "$" + ref })
+		for _, v := range ordered {
+			s = strings.ReplaceAll(s, v.value, "${"+v.name+"}")
+		}
+		return s
+	})
+}
+
+// mapSnapshotStrings returns a copy of snapshot with f applied to every
+// string value of the meta and schema of its entries.
+func mapSnapshotStrings(snapshot *Snapshot, f func(string) string) *Snapshot {
+	mapped := *snapshot
+	mapped.Collections = slices.Clone(snapshot.Collections)
+	mapped.Fields = slices.Clone(snapshot.Fields)
+	mapped.Relations = slices.Clone(snapshot.Relations)
+	for i := range mapped.Collections {
+		c := &mapped.Collections[i]
+		c.Meta, c.Schema = mapStrings(c.Meta, f), mapStrings(c.Schema, f)
+	}
+	for i := range mapped.Fields {
+		field := &mapped.Fields[i]
+		field.Meta, field.Schema = mapStrings(field.Meta, f), mapStrings(field.Schema, f)
+	}
+	for i := range mapped.Relations {
+		r := &mapped.Relations[i]
+		r.Meta, r.Schema = mapStrings(r.Meta, f), mapStrings(r.Schema, f)
+	}
+	return &mapped
+}
+
+// mapStrings returns a deep copy of m with f applied to its string values,
+// in nested maps and lists too.
+func mapStrings(m map[string]any, f func(string) string) map[string]any {
+	if m == nil {
+		return nil
+	}
+	mapped, _ := mapStringValue(m, f).(map[string]any)
+	return mapped
+}
+
+func mapStringValue(v any, f func(string) string) any {
+	switch v := v.(type) {
+	case string:
+		return f(v)
+	case map[string]any:
+		mapped := make(map[string]any, len(v))
+		for key, value := range v {
+			mapped[key] = mapStringValue(value, f)
+		}
+		return mapped
+	case []any:
+		mapped := make([]any, len(v))
+		for i, value := range v {
+			mapped[i] = mapStringValue(value, f)
+		}
+		return mapped
+	default:
+		return v
+	}
+}
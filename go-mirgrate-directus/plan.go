@@ -0,0 +1,188 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// PlanFormatVersion is the plan file format version written by WritePlan,
+// the only one ReadPlan accepts.
+const PlanFormatVersion = 1
+
+// A Plan is a reviewed diff bound to the schemas it was computed from, so
+// that exactly that diff can be applied later, for example after a pull
+// request was approved. See WritePlan, ReadPlan and ApplyPlan.
+type Plan struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// BaseHash is the SnapshotHash of the base snapshot the diff was
+	// computed from, after filtering.
+	BaseHash string `json:"base_hash"`
+	// TargetURL is the redacted URL of the target the plan applies to.
+	TargetURL string `json:"target_url"`
+	// TargetHash is the SnapshotHash of the target schema when the plan
+	// was computed. ApplyPlan refuses to run once it changed.
+	TargetHash string      `json:"target_hash"`
+	Summary    DiffSummary `json:"summary"`
+	Diff       *Diff       `json:"diff"`
+}
+
+// ErrPlanDrifted is returned by CheckPlan and ApplyPlan when the target
+// schema changed since the plan was computed.
+var ErrPlanDrifted = errors.New("target schema changed since the plan was computed")
+
+// NewPlan creates the plan of applying diff, computed from the base snapshot,
+// to the target at targetURL, whose schema was target when diff was computed.
+func NewPlan(base *Snapshot, targetURL string, target *Snapshot, diff *Diff) (*Plan, error) {
+	baseHash, err := SnapshotHash(base)
+	if err != nil {
+		return nil, err
+	}
+	targetHash, err := SnapshotHash(target)
+	if err != nil {
+		return nil, err
+	}
+	return &Plan{
+		Version:    PlanFormatVersion,
+		CreatedAt:  time.Now().UTC(),
+		BaseHash:   baseHash,
+		TargetURL:  RedactURL(targetURL),
+		TargetHash: targetHash,
+		Summary:    SummarizeDiff(diff),
+		Diff:       diff,
+	}, nil
+}
+
+// planFile is the content of a plan file: the plan and the SHA-256 of its
+// compact JSON encoding.
+type planFile struct {
+	Plan   json.RawMessage `json:"plan"`
+	SHA256 string          `json:"sha256"`
+}
+
+// WritePlan writes plan to path as indented JSON, together with a checksum
+// that ReadPlan verifies to detect corrupted or edited plans.
+func WritePlan(path string, plan *Plan) error {
+	file, err := encodePlan(plan)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
+
+// WritePlanToStore writes plan to store under name like WritePlan, for
+// example to keep it in a bucket between the plan and the apply job.
+func WritePlanToStore(ctx context.Context, store SnapshotStore, name string, plan *Plan) error {
+	file, err := encodePlan(plan)
+	if err != nil {
+		return err
+	}
+	if err := store.Put(ctx, name, file); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
+
+// encodePlan returns the content of the plan file of plan.
+func encodePlan(plan *Plan) ([]byte, error) {
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plan: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	file, err := json.MarshalIndent(planFile{Plan: data, SHA256: hex.EncodeToString(sum[:])}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plan: %w", err)
+	}
+	return append(file, '\n'), nil
+}
+
+// ReadPlan reads a plan written by WritePlan. Plans whose checksum does not
+// match their content, or that use another format version, are rejected.
+func ReadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	return decodePlan(path, data)
+}
+
+// ReadPlanFromStore reads the plan name of store, written by
+// WritePlanToStore, like ReadPlan.
+func ReadPlanFromStore(ctx context.Context, store SnapshotStore, name string) (*Plan, error) {
+	data, err := store.Get(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	return decodePlan(store.Location(name), data)
+}
+
+// decodePlan decodes and verifies data, the content of the plan file at
+// path.
+func decodePlan(path string, data []byte) (*Plan, error) {
+	var file planFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("plan file %s is corrupt: %w", path, err)
+	}
+	if file.Plan == nil || file.SHA256 == "" {
+		return nil, fmt.Errorf("plan file %s does not look like a plan, it has no plan or sha256 key", path)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, file.Plan); err != nil {
+		return nil, fmt.Errorf("plan file %s is corrupt: %w", path, err)
+	}
+	sum := sha256.Sum256(compact.Bytes())
+	if hex.EncodeToString(sum[:]) != file.SHA256 {
+		return nil, fmt.Errorf("plan file %s is corrupt or was modified, its checksum does not match", path)
+	}
+
+	var plan Plan
+	if err := json.Unmarshal(file.Plan, &plan); err != nil {
+		return nil, fmt.Errorf("plan file %s is corrupt: %w", path, err)
+	}
+	switch {
+	case plan.Version != PlanFormatVersion:
+		return nil, fmt.Errorf("plan file %s has format version %d, only version %d is supported", path, plan.Version, PlanFormatVersion)
+	case plan.Diff == nil || plan.Diff.Hash == "":
+		return nil, fmt.Errorf("plan file %s has no diff", path)
+	}
+	return &plan, nil
+}
+
+// CheckPlan verifies that plan was computed for target and that the target
+// schema did not change since, returning ErrPlanDrifted if it did.
+func CheckPlan(ctx context.Context, target *DirectusClient, plan *Plan) error {
+	if url := RedactURL(target.URL); url != plan.TargetURL {
+		return fmt.Errorf("plan was computed for %s, not %s", plan.TargetURL, url)
+	}
+	snapshot, err := target.GetSnapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get target snapshot: %w", err)
+	}
+	hash, err := SnapshotHash(snapshot)
+	if err != nil {
+		return err
+	}
+	if hash != plan.TargetHash {
+		return fmt.Errorf("%w: the target schema hash is %s, the plan expects %s", ErrPlanDrifted, hash, plan.TargetHash)
+	}
+	return nil
+}
+
+// ApplyPlan applies the diff of plan to target after CheckPlan succeeded.
+func ApplyPlan(ctx context.Context, target *DirectusClient, plan *Plan) error {
+	if err := CheckPlan(ctx, target, plan); err != nil {
+		return err
+	}
+	return target.ApplyDiff(ctx, plan.Diff)
+}
@@ -0,0 +1,371 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PermissionModel is the way a Directus instance grants permissions.
+type PermissionModel string
+
+const (
+	// PermissionModelRoles attaches permissions directly to roles, as
+	// Directus 9 and 10 do.
+	PermissionModelRoles PermissionModel = "roles"
+	// PermissionModelPolicies attaches permissions to policies, which access
+	// rows grant to roles and users, as Directus 11 does.
+	PermissionModelPolicies PermissionModel = "policies"
+)
+
+// PermissionModel detects the permission model of the instance from the
+// version reported by /server/info. Instances that do not report their
+// version are probed for the /policies endpoint.
+func (c *DirectusClient) PermissionModel(ctx context.Context) (PermissionModel, error) {
+	info, err := c.VersionInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+	if major, _, ok := strings.Cut(strings.TrimPrefix(info.Version, "v"), "."); ok {
+		if n, err := strconv.Atoi(major); err == nil {
+			if n >= 11 {
+				return PermissionModelPolicies, nil
+			}
+			return PermissionModelRoles, nil
+		}
+	}
+
+	probeCtx, done := startOperation(ctx, "list policies", c.Timeouts.Metadata)
+	var policies []Policy
+	err = done(c.doJSON(probeCtx, "list policies", http.MethodGet, "/policies", url.Values{"limit": {"1"}}, nil, &policies))
+	var directusErr *DirectusError
+	switch {
+	case err == nil:
+		return PermissionModelPolicies, nil
+	case errors.As(err, &directusErr) && directusErr.StatusCode == http.StatusNotFound:
+		return PermissionModelRoles, nil
+	default:
+		return "", err
+	}
+}
+
+// Policy is a policy of the Directus 11 permission model, as listed by
+// /policies. Extra holds the remaining properties, such as app_access.
+type Policy struct {
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name"`
+	AdminAccess bool   `json:"admin_access"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Access is an access row granting Policy to Role or User. A row without role
+// and user grants the policy to the public.
+type Access struct {
+	ID     string  `json:"id,omitempty"`
+	Role   *string `json:"role"`
+	User   *string `json:"user"`
+	Policy string  `json:"policy"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (p Policy) MarshalJSON() ([]byte, error) {
+	type plain Policy
+	return marshalWithExtra(plain(p), p.Extra)
+}
+
+func (p *Policy) UnmarshalJSON(data []byte) error {
+	type plain Policy
+	return unmarshalWithExtra(data, (*plain)(p), &p.Extra)
+}
+
+func (a Access) MarshalJSON() ([]byte, error) {
+	type plain Access
+	return marshalWithExtra(plain(a), a.Extra)
+}
+
+func (a *Access) UnmarshalJSON(data []byte) error {
+	type plain Access
+	return unmarshalWithExtra(data, (*plain)(a), &a.Extra)
+}
+
+// policyReadOnlyKeys are the policy properties that are not copied between
+// instances: permissions are synced separately and users and roles are
+// attached through access rows.
+var policyReadOnlyKeys = []string{"permissions", "users", "roles"}
+
+// ListPolicies returns all policies of the project.
+func (c *DirectusClient) ListPolicies(ctx context.Context) (_ []Policy, err error) {
+	ctx, done := startOperation(ctx, "list policies", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var policies []Policy
+	if err := c.doJSON(ctx, "list policies", http.MethodGet, "/policies", url.Values{"limit": {"-1"}}, nil, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// CreatePolicy creates policy, ignoring its ID, and returns the created
+// policy.
+func (c *DirectusClient) CreatePolicy(ctx context.Context, policy Policy) (_ *Policy, err error) {
+	ctx, done := startOperation(ctx, "create policy", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	policy.ID = ""
+	var created Policy
+	if err := c.doJSON(ctx, "create policy", http.MethodPost, "/policies", nil, policy, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdatePolicy replaces the properties of the policy with the given ID with
+// those of policy.
+func (c *DirectusClient) UpdatePolicy(ctx context.Context, id string, policy Policy) (err error) {
+	ctx, done := startOperation(ctx, "update policy", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	policy.ID = ""
+	return c.doJSON(ctx, "update policy", http.MethodPatch, "/policies/"+url.PathEscape(id), nil, policy, nil)
+}
+
+// ListAccess returns all access rows of the project.
+func (c *DirectusClient) ListAccess(ctx context.Context) (_ []Access, err error) {
+	ctx, done := startOperation(ctx, "list access", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var access []Access
+	if err := c.doJSON(ctx, "list access", http.MethodGet, "/access", url.Values{"limit": {"-1"}}, nil, &access); err != nil {
+		return nil, err
+	}
+	return access, nil
+}
+
+// CreateAccess creates access, ignoring its ID.
+func (c *DirectusClient) CreateAccess(ctx context.Context, access Access) (err error) {
+	ctx, done := startOperation(ctx, "create access", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	access.ID = ""
+	return c.doJSON(ctx, "create access", http.MethodPost, "/access", nil, access, nil)
+}
+
+// DeleteAccess deletes the access row with the given ID.
+func (c *DirectusClient) DeleteAccess(ctx context.Context, id string) (err error) {
+	ctx, done := startOperation(ctx, "delete access", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "delete access", http.MethodDelete, "/access/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// PolicyResult describes what SyncPermissions did for one policy.
+type PolicyResult struct {
+	// Policy is the policy name.
+	Policy string `json:"policy"`
+	// Created and Updated tell whether the policy itself was created on or
+	// updated in the target.
+	Created bool `json:"created,omitempty"`
+	Updated bool `json:"updated,omitempty"`
+	// Permissions counts the permission rows created, updated and deleted.
+	Permissions ChangeCounts `json:"permissions"`
+}
+
+// Changed reports whether anything changed for the policy.
+func (r PolicyResult) Changed() bool {
+	return r.Created || r.Updated || r.Permissions.Total() > 0
+}
+
+// syncPolicies implements SyncPermissions for the policy model. Roles are
+// synced as in the role model, then policies are matched by name and synced
+// with their permissions like roles are there. Finally the access rows that
+// grant the synced policies to roles or to the public are created or deleted
+// so that they match the base, with role and policy IDs remapped to the
+// target. Access rows granting policies to single users are instance
+// specific and left alone, as are policies with admin access.
+func syncPolicies(ctx context.Context, base, target *DirectusClient, dryRun bool) (*PermissionsResult, error) {
+	b, err := listPolicyModel(ctx, base, "base")
+	if err != nil {
+		return nil, err
+	}
+	t, err := listPolicyModel(ctx, target, "target")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PermissionsResult{Model: PermissionModelPolicies, DryRun: dryRun}
+
+	// Role IDs on the target by base role ID, empty for roles that would
+	// only be created in a dry run.
+	roleIDs := map[string]string{}
+	slices.SortFunc(b.roles, func(x, y Role) int { return strings.Compare(x.Name, y.Name) })
+	targetRoles := indexByName(t.roles, func(r Role) string { return r.Name })
+	for _, role := range b.roles {
+		roleResult := RolePermissionsResult{Role: role.Name}
+		targetID, err := syncRole(ctx, target, role, targetRoles, dryRun, &roleResult)
+		result.Roles = append(result.Roles, roleResult)
+		if err != nil {
+			return result, err
+		}
+		roleIDs[role.ID] = targetID
+	}
+
+	// Policy IDs on the target by base policy ID, like roleIDs.
+	policyIDs := map[string]string{}
+	slices.SortFunc(b.policies, func(x, y Policy) int { return strings.Compare(x.Name, y.Name) })
+	targetPolicies := indexByName(t.policies, func(p Policy) string { return p.Name })
+	for _, policy := range b.policies {
+		if policy.AdminAccess {
+			result.SkippedAdminRoles = append(result.SkippedAdminRoles, policy.Name)
+			continue
+		}
+		policyResult := PolicyResult{Policy: policy.Name}
+		targetID, err := syncPolicy(ctx, target, policy, targetPolicies, dryRun, &policyResult)
+		if err == nil {
+			var existing []Permission
+			if targetID != "" {
+				existing = ownedBy(t.permissions, &targetID, byPolicy)
+			}
+			err = syncPermissionRows(ctx, target, "policy "+policy.Name, func(p *Permission) { p.Policy = &targetID },
+				ownedBy(b.permissions, &policy.ID, byPolicy), existing, dryRun, &policyResult.Permissions)
+		}
+		result.Policies = append(result.Policies, policyResult)
+		if err != nil {
+			return result, err
+		}
+		policyIDs[policy.ID] = targetID
+	}
+
+	return result, syncAccess(ctx, target, b.access, t.access, roleIDs, policyIDs, dryRun, &result.Access)
+}
+
+// policyModel holds everything syncPolicies reads from one instance.
+type policyModel struct {
+	roles       []Role
+	policies    []Policy
+	permissions []Permission
+	access      []Access
+}
+
+// listPolicyModel lists the roles, policies, permissions and access rows of
+// client, the side of the sync called name.
+func listPolicyModel(ctx context.Context, client *DirectusClient, name string) (*policyModel, error) {
+	var model policyModel
+	var err error
+	if model.roles, err = client.ListRoles(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list %s roles: %w", name, err)
+	}
+	if model.policies, err = client.ListPolicies(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list %s policies: %w", name, err)
+	}
+	if model.permissions, err = client.ListPermissions(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list %s permissions: %w", name, err)
+	}
+	if model.access, err = client.ListAccess(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list %s access: %w", name, err)
+	}
+	return &model, nil
+}
+
+// syncPolicy creates or updates policy on target and returns its ID there,
+// which is empty when it would only be created in a dry run.
+func syncPolicy(ctx context.Context, target *DirectusClient, policy Policy, targetByName map[string]Policy, dryRun bool, result *PolicyResult) (string, error) {
+	policy.Extra = withoutKeys(policy.Extra, policyReadOnlyKeys)
+	existing, ok := targetByName[policy.Name]
+	if !ok {
+		result.Created = true
+		if dryRun {
+			return "", nil
+		}
+		created, err := target.CreatePolicy(ctx, policy)
+		if err != nil {
+			return "", fmt.Errorf("failed to create policy %s: %w", policy.Name, err)
+		}
+		return created.ID, nil
+	}
+
+	existing.Extra = withoutKeys(existing.Extra, policyReadOnlyKeys)
+	if sameExceptID(policy, existing) {
+		return existing.ID, nil
+	}
+	result.Updated = true
+	if !dryRun {
+		if err := target.UpdatePolicy(ctx, existing.ID, policy); err != nil {
+			return "", fmt.Errorf("failed to update policy %s: %w", policy.Name, err)
+		}
+	}
+	return existing.ID, nil
+}
+
+// syncAccess makes the access rows granting the synced policies to roles or
+// the public on the target match those of the base. roleIDs and policyIDs map
+// base IDs to target IDs.
+func syncAccess(ctx context.Context, target *DirectusClient, base, have []Access, roleIDs, policyIDs map[string]string, dryRun bool, counts *ChangeCounts) error {
+	syncedPolicies := map[string]bool{}
+	for _, id := range policyIDs {
+		if id != "" {
+			syncedPolicies[id] = true
+		}
+	}
+
+	type key struct{ role, policy string }
+	keyOf := func(a Access) key {
+		if a.Role == nil {
+			return key{"", a.Policy}
+		}
+		return key{*a.Role, a.Policy}
+	}
+	existing := map[key]Access{}
+	for _, access := range have {
+		if access.User == nil && syncedPolicies[access.Policy] {
+			existing[keyOf(access)] = access
+		}
+	}
+
+	for _, access := range base {
+		policyID, ok := policyIDs[access.Policy]
+		if access.User != nil || !ok {
+			continue
+		}
+		access.Policy = policyID
+		if access.Role != nil {
+			roleID, ok := roleIDs[*access.Role]
+			if !ok {
+				continue
+			}
+			access.Role = &roleID
+		}
+		if _, ok := existing[keyOf(access)]; ok && policyID != "" {
+			delete(existing, keyOf(access))
+			continue
+		}
+		counts.Created++
+		if !dryRun {
+			if err := target.CreateAccess(ctx, access); err != nil {
+				return fmt.Errorf("failed to grant a policy on the target: %w", err)
+			}
+		}
+	}
+
+	stale := make([]Access, 0, len(existing))
+	for _, access := range existing {
+		stale = append(stale, access)
+	}
+	slices.SortFunc(stale, func(a, b Access) int { return strings.Compare(a.ID, b.ID) })
+	for _, access := range stale {
+		counts.Deleted++
+		if !dryRun {
+			if err := target.DeleteAccess(ctx, access.ID); err != nil {
+				return fmt.Errorf("failed to revoke a policy on the target: %w", err)
+			}
+		}
+	}
+	return nil
+}
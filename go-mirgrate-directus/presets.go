@@ -0,0 +1,243 @@
+package gomirgratedirectus
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Preset is a preset or bookmark of a collection, as listed by /presets.
+// Shared presets have no User; role presets apply to Role, and presets
+// without either are global. Bookmark is the name of a bookmark, nil for the
+// default layout of the collection. Extra holds the remaining properties,
+// such as layout, layout_query and filter.
+type Preset struct {
+	ID         json.Number `json:"id,omitempty"`
+	Bookmark   *string     `json:"bookmark"`
+	User       *string     `json:"user"`
+	Role       *string     `json:"role"`
+	Collection string      `json:"collection"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (p Preset) MarshalJSON() ([]byte, error) {
+	type plain Preset
+	return marshalWithExtra(plain(p), p.Extra)
+}
+
+func (p *Preset) UnmarshalJSON(data []byte) error {
+	type plain Preset
+	return unmarshalWithExtra(data, (*plain)(p), &p.Extra)
+}
+
+// ListSharedPresets returns the global and role presets of the project,
+// leaving out the personal presets of users.
+func (c *DirectusClient) ListSharedPresets(ctx context.Context) (_ []Preset, err error) {
+	ctx, done := startOperation(ctx, "list presets", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var presets []Preset
+	query := url.Values{"filter": {`{"user":{"_null":true}}`}, "limit": {"-1"}}
+	if err := c.doJSON(ctx, "list presets", http.MethodGet, "/presets", query, nil, &presets); err != nil {
+		return nil, err
+	}
+	// Guard against instances ignoring the filter; personal presets are
+	// never synced.
+	shared := presets[:0]
+	for _, preset := range presets {
+		if preset.User == nil {
+			shared = append(shared, preset)
+		}
+	}
+	return shared, nil
+}
+
+// CreatePreset creates preset, ignoring its ID.
+func (c *DirectusClient) CreatePreset(ctx context.Context, preset Preset) (err error) {
+	ctx, done := startOperation(ctx, "create preset", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	preset.ID = ""
+	return c.doJSON(ctx, "create preset", http.MethodPost, "/presets", nil, preset, nil)
+}
+
+// UpdatePreset replaces the properties of the preset with the given ID with
+// those of preset.
+func (c *DirectusClient) UpdatePreset(ctx context.Context, id string, preset Preset) (err error) {
+	ctx, done := startOperation(ctx, "update preset", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	preset.ID = ""
+	return c.doJSON(ctx, "update preset", http.MethodPatch, "/presets/"+url.PathEscape(id), nil, preset, nil)
+}
+
+// DeletePreset deletes the preset with the given ID.
+func (c *DirectusClient) DeletePreset(ctx context.Context, id string) (err error) {
+	ctx, done := startOperation(ctx, "delete preset", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "delete preset", http.MethodDelete, "/presets/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// PresetKey identifies a shared preset across instances.
+type PresetKey struct {
+	Collection string `json:"collection"`
+	// Bookmark is empty for the default layout of the collection.
+	Bookmark string `json:"bookmark,omitempty"`
+	// Role is the role name, empty for global presets.
+	Role string `json:"role,omitempty"`
+}
+
+func (k PresetKey) String() string {
+	s := k.Collection
+	if k.Bookmark != "" {
+		s += " bookmark " + k.Bookmark
+	}
+	if k.Role != "" {
+		s += " for role " + k.Role
+	}
+	return s
+}
+
+// PresetsResult is the result of SyncPresets.
+type PresetsResult struct {
+	// Presets counts the shared presets created, updated and deleted.
+	Presets ChangeCounts `json:"presets"`
+	// SkippedMissingRole lists the role presets of the base that were not
+	// synced because the target has no role of that name.
+	SkippedMissingRole []PresetKey `json:"skipped_missing_role,omitempty"`
+	// DryRun reports that the changes were only computed.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Changed reports whether any preset changed.
+func (r *PresetsResult) Changed() bool {
+	return r.Presets.Total() > 0
+}
+
+// SyncPresets copies the shared presets of base, global and role presets but
+// never the personal presets of users, to target. Presets are matched by
+// collection, bookmark name and role name; the role IDs are remapped to the
+// roles of the same name on the target. Missing presets are created and
+// differing ones updated in place. Role presets whose role does not exist on
+// the target are skipped and reported, so roles should be synced first. With
+// prune, shared target presets the base does not have are deleted. With
+// dryRun nothing is written.
+func SyncPresets(ctx context.Context, base, target *DirectusClient, prune, dryRun bool) (*PresetsResult, error) {
+	basePresets, err := base.ListSharedPresets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list base presets: %w", err)
+	}
+	baseRoles, err := base.ListRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list base roles: %w", err)
+	}
+	targetPresets, err := target.ListSharedPresets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target presets: %w", err)
+	}
+	targetRoles, err := target.ListRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target roles: %w", err)
+	}
+
+	baseRoleNames := map[string]string{}
+	for _, role := range baseRoles {
+		baseRoleNames[role.ID] = role.Name
+	}
+	targetRoleNames := map[string]string{}
+	targetRoleIDs := map[string]string{}
+	for _, role := range targetRoles {
+		targetRoleNames[role.ID] = role.Name
+		targetRoleIDs[role.Name] = role.ID
+	}
+
+	existing := map[PresetKey]Preset{}
+	for _, preset := range targetPresets {
+		existing[presetKey(preset, targetRoleNames)] = preset
+	}
+
+	result := &PresetsResult{DryRun: dryRun}
+	keys := make([]PresetKey, 0, len(basePresets))
+	byKey := map[PresetKey]Preset{}
+	for _, preset := range basePresets {
+		key := presetKey(preset, baseRoleNames)
+		keys = append(keys, key)
+		byKey[key] = preset
+	}
+	slices.SortFunc(keys, comparePresetKeys)
+
+	for _, key := range keys {
+		preset := byKey[key]
+		if key.Role != "" {
+			id, ok := targetRoleIDs[key.Role]
+			if !ok {
+				result.SkippedMissingRole = append(result.SkippedMissingRole, key)
+				continue
+			}
+			preset.Role = &id
+		}
+
+		current, ok := existing[key]
+		delete(existing, key)
+		switch {
+		case !ok:
+			result.Presets.Created++
+			if !dryRun {
+				if err := target.CreatePreset(ctx, preset); err != nil {
+					return result, fmt.Errorf("failed to create preset %s: %w", key, err)
+				}
+			}
+		case !samePreset(preset, current):
+			result.Presets.Updated++
+			if !dryRun {
+				if err := target.UpdatePreset(ctx, current.ID.String(), preset); err != nil {
+					return result, fmt.Errorf("failed to update preset %s: %w", key, err)
+				}
+			}
+		}
+	}
+
+	if !prune {
+		return result, nil
+	}
+	for _, key := range slices.SortedFunc(maps.Keys(existing), comparePresetKeys) {
+		result.Presets.Deleted++
+		if !dryRun {
+			if err := target.DeletePreset(ctx, existing[key].ID.String()); err != nil {
+				return result, fmt.Errorf("failed to delete preset %s: %w", key, err)
+			}
+		}
+	}
+	return result, nil
+}
+
+// presetKey returns the key of preset, naming its role with roleNames. A
+// role that is not in roleNames keeps its ID, so that it never matches.
+func presetKey(preset Preset, roleNames map[string]string) PresetKey {
+	key := PresetKey{Collection: preset.Collection}
+	if preset.Bookmark != nil {
+		key.Bookmark = *preset.Bookmark
+	}
+	if preset.Role != nil {
+		key.Role = cmp.Or(roleNames[*preset.Role], *preset.Role)
+	}
+	return key
+}
+
+func comparePresetKeys(a, b PresetKey) int {
+	return cmp.Or(strings.Compare(a.Collection, b.Collection), strings.Compare(a.Bookmark, b.Bookmark), strings.Compare(a.Role, b.Role))
+}
+
+// samePreset reports whether want, with its role already remapped, matches
+// the target preset have.
+func samePreset(want, have Preset) bool {
+	return sameID(want.Role, have.Role) && sameExceptID(want, have)
+}
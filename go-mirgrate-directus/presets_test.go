@@ -0,0 +1,148 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// presetRows describes the presets of s by collection, bookmark and owner,
+// naming roles, sorted.
+func presetRows(s *instanceServer) []string {
+	roles := s.names("roles")
+	var rows []string
+	for _, p := range s.list("presets") {
+		owner, ok := roles[p["role"]]
+		switch {
+		case p["user"] != nil:
+			owner = fmt.Sprint("user ", p["user"])
+		case !ok:
+			owner = fmt.Sprint("unknown role ", p["role"])
+		}
+		rows = append(rows, fmt.Sprintf("%s %v %s %v", p["collection"], p["bookmark"], owner, p["layout"]))
+	}
+	slices.Sort(rows)
+	return rows
+}
+
+func TestSyncPresets(t *testing.T) {
+	ctx := context.Background()
+	base, target := newInstances(t, "presets/presets.json")
+
+	result, err := gomigratedirectus.SyncPresets(ctx, base.client(), target.client(), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &gomigratedirectus.PresetsResult{
+		Presets: gomigratedirectus.ChangeCounts{Created: 1, Updated: 1},
+		SkippedMissingRole: []gomigratedirectus.PresetKey{
+			{Collection: "articles", Bookmark: "To review", Role: "Reviewer"},
+		},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+	if got, want := target.written(), []string{"PATCH /presets/11", "POST /presets"}; !slices.Equal(got, want) {
+		t.Errorf("target writes = %q, want %q", got, want)
+	}
+
+	// Personal presets are not copied, and without prune the target keeps
+	// the presets the base lacks.
+	wantRows := []string{
+		"articles <nil> public tabular",
+		"articles Drafts public tabular",
+		"articles Legacy view Legacy tabular",
+		"articles Mine Editor cards",
+		"articles Old public tabular",
+		"articles Personal user t-ed kanban",
+	}
+	if got := presetRows(target); !slices.Equal(got, wantRows) {
+		t.Errorf("target presets = %q, want %q", got, wantRows)
+	}
+	if got := base.written(); len(got) > 0 {
+		t.Errorf("base writes = %q, want none", got)
+	}
+}
+
+func TestSyncPresetsMissingRole(t *testing.T) {
+	ctx := context.Background()
+	base, target := newInstances(t, "presets/presets.json")
+
+	if _, err := gomigratedirectus.SyncPresets(ctx, base.client(), target.client(), false, false); err != nil {
+		t.Fatal(err)
+	}
+	// The preset of the Reviewer role, which the target lacks, is neither
+	// created with the role ID of the base nor as a global preset.
+	for _, p := range target.list("presets") {
+		if p["bookmark"] == "To review" {
+			t.Errorf("preset of a missing role created: %v", p)
+		}
+	}
+
+	// Once roles are synced, the preset follows with the new role's ID.
+	if _, err := gomigratedirectus.SyncPermissions(ctx, base.client(), target.client(), false); err != nil {
+		t.Fatal(err)
+	}
+	result, err := gomigratedirectus.SyncPresets(ctx, base.client(), target.client(), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &gomigratedirectus.PresetsResult{Presets: gomigratedirectus.ChangeCounts{Created: 1}}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+	roles := target.names("roles")
+	created := target.body("POST /presets")
+	if created["bookmark"] != "To review" || roles[created["role"]] != "Reviewer" {
+		t.Errorf("created preset = %v, want To review for the target's Reviewer role %v", created, roles)
+	}
+}
+
+func TestSyncPresetsPrune(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		t.Run(fmt.Sprint("dryRun=", dryRun), func(t *testing.T) {
+			ctx := context.Background()
+			base, target := newInstances(t, "presets/presets.json")
+			before := presetRows(target)
+
+			result, err := gomigratedirectus.SyncPresets(ctx, base.client(), target.client(), true, dryRun)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := &gomigratedirectus.PresetsResult{
+				Presets: gomigratedirectus.ChangeCounts{Created: 1, Updated: 1, Deleted: 2},
+				SkippedMissingRole: []gomigratedirectus.PresetKey{
+					{Collection: "articles", Bookmark: "To review", Role: "Reviewer"},
+				},
+				DryRun: dryRun,
+			}
+			if !reflect.DeepEqual(result, want) {
+				t.Errorf("result = %+v, want %+v", result, want)
+			}
+
+			if dryRun {
+				if got := target.written(); len(got) > 0 {
+					t.Errorf("dry run wrote %q", got)
+				}
+				if got := presetRows(target); !slices.Equal(got, before) {
+					t.Errorf("target presets = %q, want unchanged %q", got, before)
+				}
+				return
+			}
+			// Personal presets are never pruned.
+			wantRows := []string{
+				"articles <nil> public tabular",
+				"articles Drafts public tabular",
+				"articles Mine Editor cards",
+				"articles Personal user t-ed kanban",
+			}
+			if got := presetRows(target); !slices.Equal(got, wantRows) {
+				t.Errorf("target presets = %q, want %q", got, wantRows)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Hop is the promotion of the source schema to one target of Promote.
+type Hop struct {
+	// URL is the target URL, redacted.
+	URL string
+	// Result is the result of MigrateWithOptions, nil if the hop was
+	// skipped.
+	Result *MigrationResult
+	// Verified reports that the target was diffed against the source after
+	// the hop and found in sync. It is false for dry runs.
+	Verified bool
+	// StartedAt and FinishedAt bracket the hop, including the verification.
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// Err is the error the hop failed with.
+	Err error
+	// Skipped reports that the hop did not run because an earlier one
+	// failed.
+	Skipped bool
+}
+
+// PromotionResult describes the outcome of Promote.
+type PromotionResult struct {
+	// Hops holds one hop per target, in promotion order.
+	Hops []Hop
+}
+
+// ErrNotInSync is returned by Promote when a target still differs from the
+// source after its hop was applied, and by MigrateWithOptions with
+// VerifyFail.
+var ErrNotInSync = errors.New("target is not in sync with the source after applying")
+
+// Promote promotes the schema of baseClient, or of opts.Source, to each of
+// targets in order, for example from dev to staging and then to prod. The
+// source snapshot is taken once, so that every target receives the same
+// schema. After each applied hop the target is diffed against the source
+// again, filtered as by opts, and the chain stops with ErrNotInSync unless
+// the diff is empty. Any failure stops the chain, leaving the remaining hops
+// skipped; the returned error names the failed target.
+//
+// Promote runs the whole migration of MigrateWithOptions for each hop, so the
+// options that sync more than the schema can be used with a base client,
+// which then stays the source of those phases.
+func Promote(ctx context.Context, baseClient *DirectusClient, targets []*DirectusClient, opts MigrationOptions) (*PromotionResult, error) {
+	promotion := &PromotionResult{}
+	if len(targets) == 0 {
+		return promotion, fmt.Errorf("no targets to promote to")
+	}
+	source := opts.Source
+	if source == nil {
+		source = ClientSource(baseClient)
+	}
+	source = &onceSource{source: source}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	var failed error
+	for i, target := range targets {
+		hop := Hop{URL: RedactURL(target.URL)}
+		if failed != nil {
+			hop.Skipped = true
+			logger.Warn("skipping promotion, an earlier hop failed", "target", hop.URL)
+			promotion.Hops = append(promotion.Hops, hop)
+			continue
+		}
+		hopOpts := opts
+		hopOpts.Source = source
+		hopOpts.Logger = logger.With("target", hop.URL)
+		hopOpts.Logger.Info("promoting schema", "hop", i+1, "hops", len(targets))
+
+		hop.StartedAt = time.Now()
+		hop.Result, hop.Err = MigrateWithOptions(ctx, baseClient, target, hopOpts)
+		switch {
+		case hop.Err != nil || opts.DryRun:
+		case hop.Result.Verified && hop.Result.Residual != nil:
+			hop.Err = fmt.Errorf("%w: %s pending", ErrNotInSync, hop.Result.ResidualSummary)
+		case hop.Result.Verified:
+			// The migration verified the target already.
+			hop.Verified = true
+			hopOpts.Logger.Info("target verified in sync with the source")
+		default:
+			hop.Err = verifyInSync(ctx, source, target, opts)
+			hop.Verified = hop.Err == nil
+			if hop.Verified {
+				hopOpts.Logger.Info("target verified in sync with the source")
+			}
+		}
+		hop.FinishedAt = time.Now()
+		if hop.Err != nil {
+			failed = fmt.Errorf("promotion to %s failed: %w", hop.URL, hop.Err)
+		}
+		promotion.Hops = append(promotion.Hops, hop)
+	}
+	return promotion, failed
+}
+
+// verifyInSync diffs target against the snapshot of source, filtered as by
+// opts, and returns ErrNotInSync with the summary of any remaining changes.
+func verifyInSync(ctx context.Context, source SnapshotSource, target *DirectusClient, opts MigrationOptions) error {
+	snapshot, err := source.Snapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get snapshot: %w", err)
+	}
+	filter := opts.schemaFilter()
+	if !filter.IsZero() {
+		snapshot = FilterSnapshot(snapshot, filter).Snapshot
+	}
+	diff, err := target.GetDiff(ctx, snapshot, opts.Force)
+	if errors.Is(err, ErrNoChanges) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to verify target: %w", err)
+	}
+	if !filter.IsZero() {
+		if diff = FilterDiff(diff, filter).Diff; diff.IsEmpty() {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s pending", ErrNotInSync, SummarizeDiff(diff))
+}
@@ -0,0 +1,42 @@
+package gomirgratedirectus
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// WithProxy routes the client's requests through the proxy at proxyURL, which
+// may use the http, https or socks5 scheme. Without this option the proxy is
+// taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+// Base and target clients can use different proxies.
+func WithProxy(proxyURL string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.proxyURL = proxyURL
+	}
+}
+
+// parseProxyURL validates a proxy URL given to WithProxy.
+func parseProxyURL(proxyURL string) (*url.URL, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https or socks5", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", RedactURL(proxyURL))
+	}
+	return u, nil
+}
+
+// proxyFunc returns the Proxy function for a transport using proxyURL.
+func proxyFunc(proxyURL *url.URL) func(*http.Request) (*url.URL, error) {
+	if proxyURL == nil {
+		return http.ProxyFromEnvironment
+	}
+	return http.ProxyURL(proxyURL)
+}
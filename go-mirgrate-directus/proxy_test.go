@@ -0,0 +1,113 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// recordingProxy is an HTTP proxy recording the requests it forwards, with
+// the host of CONNECT requests tunneled to HTTPS servers.
+type recordingProxy struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newRecordingProxy(t *testing.T) *recordingProxy {
+	t.Helper()
+	p := &recordingProxy{}
+	forward := &httputil.ReverseProxy{Rewrite: func(r *httputil.ProxyRequest) {
+		r.Out.URL = r.In.URL
+	}}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.requests = append(p.requests, r.Method+" "+r.RequestURI)
+		p.mu.Unlock()
+		if r.Method != http.MethodConnect {
+			forward.ServeHTTP(w, r)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		go io.Copy(upstream, conn)
+		io.Copy(conn, upstream)
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *recordingProxy) received() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.requests...)
+}
+
+func TestProxyConnect(t *testing.T) {
+	proxy := newRecordingProxy(t)
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"data":{"version":1,"directus":"10.12.1","collections":[],"fields":[],"relations":[]}}`)
+	}))
+	defer target.Close()
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: target.Certificate().Raw})
+
+	client := gomigratedirectus.NewDirectusClient(target.URL, "token", quiet(
+		gomigratedirectus.WithProxy(proxy.URL),
+		gomigratedirectus.WithCACert(caPEM),
+	)...)
+	if _, err := client.GetSnapshot(context.Background()); err != nil {
+		t.Fatalf("GetSnapshot through the proxy: %v", err)
+	}
+	want := "CONNECT " + strings.TrimPrefix(target.URL, "https://")
+	if got := proxy.received(); len(got) != 1 || got[0] != want {
+		t.Errorf("proxy received %q, want %q", got, want)
+	}
+}
+
+func TestProxyHTTP(t *testing.T) {
+	proxy := newRecordingProxy(t)
+	server := directustest.NewServer(t)
+
+	client := server.Client(quiet(gomigratedirectus.WithProxy(proxy.URL))...)
+	if _, err := client.GetSnapshot(context.Background()); err != nil {
+		t.Fatalf("GetSnapshot through the proxy: %v", err)
+	}
+	want := "GET " + server.URL + "/schema/snapshot"
+	if got := proxy.received(); len(got) != 1 || got[0] != want {
+		t.Errorf("proxy received %q, want %q", got, want)
+	}
+	if n := len(server.Requests()); n != 1 {
+		t.Errorf("server received %d requests, want 1 forwarded by the proxy", n)
+	}
+}
+
+func TestProxyInvalid(t *testing.T) {
+	for _, proxyURL := range []string{"ftp://proxy.example.com", "http://"} {
+		client := gomigratedirectus.NewDirectusClient("https://directus.example.com", "token", quiet(gomigratedirectus.WithProxy(proxyURL))...)
+		if _, err := client.GetSnapshot(context.Background()); err == nil || !strings.Contains(err.Error(), "proxy") {
+			t.Errorf("GetSnapshot with proxy %q = %v, want an invalid proxy error", proxyURL, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimit is the rate at which a client sends requests to Directus, so that
+// bulk phases such as data, files and translations do not overwhelm a small
+// instance. It limits every request, retries included; the 429 handling of
+// RetryPolicy still recovers from the limits the server enforces itself.
+type RateLimit struct {
+	// PerSecond is the sustained number of requests per second. Zero or
+	// less means no limit.
+	PerSecond float64
+	// Burst is the number of requests that may be sent at once after a
+	// pause. It defaults to 1.
+	Burst int
+}
+
+// String returns the limit as rate/burst, such as 10/5.
+func (l RateLimit) String() string {
+	if l.PerSecond <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%g/%d", l.PerSecond, l.burst())
+}
+
+// burst returns the bucket size of l.
+func (l RateLimit) burst() int {
+	if l.Burst < 1 {
+		return 1
+	}
+	return l.Burst
+}
+
+// RateLimiter spaces the requests of the clients sharing it as configured by
+// its RateLimit, with a token bucket refilled at PerSecond tokens a second and
+// holding up to Burst. A nil RateLimiter does not limit anything. It is safe
+// for concurrent use.
+type RateLimiter struct {
+	limit RateLimit
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter of limit, whose bucket starts full.
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	return &RateLimiter{limit: limit, tokens: float64(limit.burst())}
+}
+
+// WithRateLimit makes the client wait before every request so that it sends
+// no more than limit, unless the context of a request carries its own limit;
+// see ContextWithRateLimit.
+func WithRateLimit(limit RateLimit) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.rateLimiter = NewRateLimiter(limit)
+	}
+}
+
+// Limit returns the limit of l.
+func (l *RateLimiter) Limit() RateLimit {
+	if l == nil {
+		return RateLimit{}
+	}
+	return l.limit
+}
+
+// Wait blocks until a request may be sent, or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil || l.limit.PerSecond <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens = min(float64(l.limit.burst()), l.tokens+now.Sub(l.last).Seconds()*l.limit.PerSecond)
+	}
+	l.last = now
+	// The token is taken now, so that concurrent waiters queue up behind
+	// each other instead of waking up together.
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.limit.PerSecond * float64(time.Second))
+	l.mu.Unlock()
+
+	if err := sleepContext(ctx, delay); err != nil {
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// rateLimitKey is the context key of the rate limit overriding that of the
+// clients.
+type rateLimitKey struct{}
+
+// contextRateLimit is a rate limit set on a context, with the limiter of each
+// client sending requests with it.
+type contextRateLimit struct {
+	limit RateLimit
+
+	mu       sync.Mutex
+	limiters map[*DirectusClient]*RateLimiter
+}
+
+// ContextWithRateLimit returns ctx overriding the rate limit of the clients
+// for the requests sent with it, such as for one phase of a migration. Each
+// client gets a limiter of its own, so that the base and the target of a phase
+// are limited separately. A zero limit lifts the limit of the clients.
+func ContextWithRateLimit(ctx context.Context, limit RateLimit) context.Context {
+	return context.WithValue(ctx, rateLimitKey{}, &contextRateLimit{limit: limit, limiters: map[*DirectusClient]*RateLimiter{}})
+}
+
+// rateLimiter returns the limiter the requests of c sent with ctx wait on.
+func (c *DirectusClient) rateLimiter(ctx context.Context) *RateLimiter {
+	override, ok := ctx.Value(rateLimitKey{}).(*contextRateLimit)
+	if !ok {
+		return c.RateLimiter
+	}
+	override.mu.Lock()
+	defer override.mu.Unlock()
+	limiter, ok := override.limiters[c]
+	if !ok {
+		limiter = NewRateLimiter(override.limit)
+		override.limiters[c] = limiter
+	}
+	return limiter
+}
+
+// waitRateLimit waits until the rate limit lets c send a request with ctx.
+func (c *DirectusClient) waitRateLimit(ctx context.Context) error {
+	return c.rateLimiter(ctx).Wait(ctx)
+}
@@ -0,0 +1,163 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// arrivals is an instance answering every diff request with no changes and
+// recording when each request arrived.
+type arrivals struct {
+	*httptest.Server
+	mu    sync.Mutex
+	times []time.Time
+}
+
+func newArrivals(t *testing.T) *arrivals {
+	t.Helper()
+	a := &arrivals{}
+	a.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.mu.Lock()
+		a.times = append(a.times, time.Now())
+		a.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(a.Close)
+	return a
+}
+
+// count returns the number of requests received.
+func (a *arrivals) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.times)
+}
+
+// gaps returns the time between consecutive requests, in arrival order.
+func (a *arrivals) gaps() []time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	times := slices.Clone(a.times)
+	slices.SortFunc(times, time.Time.Compare)
+	var gaps []time.Duration
+	for i := 1; i < len(times); i++ {
+		gaps = append(gaps, times[i].Sub(times[i-1]))
+	}
+	return gaps
+}
+
+// diff sends a diff request with client, which the instance answers with
+// no changes.
+func diff(t *testing.T, ctx context.Context, client *gomigratedirectus.DirectusClient) {
+	t.Helper()
+	if _, err := client.GetDiffRaw(ctx, []byte(`{}`), false); err != gomigratedirectus.ErrNoChanges {
+		t.Errorf("GetDiffRaw = %v, want ErrNoChanges", err)
+	}
+}
+
+// checkSpacing fails unless the requests separated by gaps, past the initial
+// burst, were spaced as limit says. They may arrive late, never early; some
+// slack is left for the clock of the server.
+func checkSpacing(t *testing.T, gaps []time.Duration, limit gomigratedirectus.RateLimit) {
+	t.Helper()
+	burst := max(limit.Burst, 1)
+	interval := time.Duration(float64(time.Second) / limit.PerSecond)
+	spaced := gaps[burst-1:]
+	var total time.Duration
+	for _, gap := range spaced {
+		total += gap
+	}
+	if want := time.Duration(len(spaced)) * interval * 9 / 10; total < want {
+		t.Errorf("%d requests after the burst of %d arrived within %s, want at least %s (gaps %v)", len(spaced), burst, total, want, gaps)
+	}
+}
+
+func TestRateLimitSpacing(t *testing.T) {
+	limit := gomigratedirectus.RateLimit{PerSecond: 40, Burst: 3}
+	server := newArrivals(t)
+	client := gomigratedirectus.NewDirectusClient(server.URL, "token", quiet(gomigratedirectus.WithRateLimit(limit))...)
+	for range 9 {
+		diff(t, context.Background(), client)
+	}
+	checkSpacing(t, server.gaps(), limit)
+}
+
+func TestRateLimitSharedConcurrent(t *testing.T) {
+	limit := gomigratedirectus.RateLimit{PerSecond: 40}
+	server := newArrivals(t)
+	limiter := gomigratedirectus.NewRateLimiter(limit)
+	var wg sync.WaitGroup
+	for range 3 {
+		client := gomigratedirectus.NewDirectusClient(server.URL, "token", quiet()...)
+		client.RateLimiter = limiter
+		wg.Go(func() {
+			for range 3 {
+				diff(t, context.Background(), client)
+			}
+		})
+	}
+	wg.Wait()
+	checkSpacing(t, server.gaps(), limit)
+}
+
+func TestContextWithRateLimit(t *testing.T) {
+	server := newArrivals(t)
+	slow := gomigratedirectus.WithRateLimit(gomigratedirectus.RateLimit{PerSecond: 1})
+	base := gomigratedirectus.NewDirectusClient(server.URL, "token", quiet(slow)...)
+	target := gomigratedirectus.NewDirectusClient(server.URL, "token", quiet(slow)...)
+
+	// Lifting the limit of the clients for a phase.
+	start := time.Now()
+	ctx := gomigratedirectus.ContextWithRateLimit(context.Background(), gomigratedirectus.RateLimit{})
+	for range 4 {
+		diff(t, ctx, base)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("requests without a limit took %s, as if the limit of 1 a second of the client applied", elapsed)
+	}
+
+	// Each client is limited separately within the phase: four requests of
+	// each at 10 a second take 300ms, not the 700ms of a shared limit.
+	limit := gomigratedirectus.RateLimit{PerSecond: 10}
+	ctx = gomigratedirectus.ContextWithRateLimit(context.Background(), limit)
+	start = time.Now()
+	for range 4 {
+		diff(t, ctx, base)
+		diff(t, ctx, target)
+	}
+	if elapsed := time.Since(start); elapsed < 270*time.Millisecond || elapsed > 600*time.Millisecond {
+		t.Errorf("four requests of two clients limited to 10 a second each took %s, want about 300ms", elapsed)
+	}
+}
+
+func TestRateLimitCanceled(t *testing.T) {
+	server := newArrivals(t)
+	limiter := gomigratedirectus.NewRateLimiter(gomigratedirectus.RateLimit{PerSecond: 1})
+	client := gomigratedirectus.NewDirectusClient(server.URL, "token", quiet()...)
+	client.RateLimiter = limiter
+	diff(t, context.Background(), client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetDiffRaw(ctx, []byte(`{}`), false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetDiffRaw waiting for the rate limit = %v, want context.DeadlineExceeded", err)
+	}
+	if got := server.count(); got != 1 {
+		t.Errorf("server received %d requests, want the canceled one held back", got)
+	}
+	// The token of the canceled request is given back: the next one waits
+	// for the second after the first request only.
+	start := time.Now()
+	diff(t, context.Background(), client)
+	if elapsed := time.Since(start); elapsed > 1500*time.Millisecond {
+		t.Errorf("request after a canceled one waited %s, want at most a second", elapsed)
+	}
+}
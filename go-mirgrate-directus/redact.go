@@ -0,0 +1,99 @@
+package gomirgratedirectus
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redacted replaces secrets in formatted errors and logs.
+const redacted = "***"
+
+// sensitiveHeaders lists headers whose values are replaced by RedactHeader.
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Cf-Access-Client-Secret"}
+
+// RedactURL returns rawURL with the value of an access_token query parameter
+// replaced by "***". Strings that do not parse as URLs are returned as is.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+	query := u.Query()
+	if !query.Has("access_token") {
+		return rawURL
+	}
+	query.Set("access_token", redacted)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// RedactHeader returns a copy of header with credentials such as the
+// Authorization header replaced by "***".
+func RedactHeader(header http.Header) http.Header {
+	clone := header.Clone()
+	for _, key := range sensitiveHeaders {
+		if clone.Get(key) != "" {
+			clone.Set(key, redacted)
+		}
+	}
+	return clone
+}
+
+// secrets returns the credentials the client currently knows about.
+func (c *DirectusClient) secrets() []string {
+	secrets := []string{c.AccessToken}
+	if c.auth != nil {
+		secrets = append(secrets, c.auth.secrets()...)
+	}
+	return secrets
+}
+
+// redact replaces every credential known to the client in s by "***".
+func (c *DirectusClient) redact(s string) string {
+	return redactSecrets(s, c.secrets())
+}
+
+// redactError returns err with every credential known to the client removed
+// from its message. The returned error still unwraps to err.
+func (c *DirectusClient) redactError(err error) error {
+	return redactErrorSecrets(err, c.secrets())
+}
+
+// redactSecrets replaces every non-empty secret in s by "***".
+func redactSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		s = strings.ReplaceAll(s, secret, redacted)
+		// Tokens in URLs may appear query-escaped.
+		if escaped := url.QueryEscape(secret); escaped != secret {
+			s = strings.ReplaceAll(s, escaped, redacted)
+		}
+	}
+	return s
+}
+
+// redactErrorSecrets returns err with secrets removed from its message.
+func redactErrorSecrets(err error, secrets []string) error {
+	if err == nil {
+		return nil
+	}
+	msg := redactSecrets(err.Error(), secrets)
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+// redactedError carries a sanitized message for an error whose original
+// message contained credentials.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
@@ -0,0 +1,224 @@
+package gomirgratedirectus
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// maxRenderedValue is the longest value RenderDiff prints before truncating.
+const maxRenderedValue = 80
+
+// RenderOptions configures RenderDiffWithOptions.
+type RenderOptions struct {
+	// Color wraps created lines in green, deleted ones in red and updated
+	// ones in yellow ANSI escapes. Only the escapes differ from the plain
+	// output.
+	Color bool
+}
+
+// ANSI escapes used by RenderOptions.Color.
+const (
+	ansiGreen  = "\033[32m"
+	ansiRed    = "\033[31m"
+	ansiYellow = "\033[33m"
+	ansiReset  = "\033[0m"
+)
+
+// RenderDiff writes a human-readable tree of diff to w, grouped by
+// collection. Created items are marked "+", deleted ones "-" and updated ones
+// "~", with one line per changed property showing the old and new value.
+// Entries of unknown shape are printed as raw JSON rather than rejected.
+func RenderDiff(diff *Diff, w io.Writer) error {
+	return RenderDiffWithOptions(diff, w, RenderOptions{})
+}
+
+// RenderDiffWithOptions writes diff to w like RenderDiff, as configured by
+// opts.
+func RenderDiffWithOptions(diff *Diff, w io.Writer, opts RenderOptions) error {
+	r := &diffRenderer{w: bufio.NewWriter(w), color: opts.Color}
+	for _, group := range groupDiff(diff) {
+		marker := "~"
+		if group.collection != nil {
+			marker = changeMarker(ClassifyEntries(group.collection.Diff))
+		}
+		r.line("", marker, "collection "+group.name)
+		if group.collection != nil && marker == "~" {
+			r.entries("    ", group.collection.Diff)
+		}
+
+		for _, field := range group.fields {
+			marker := changeMarker(ClassifyEntries(field.Diff))
+			r.line("  ", marker, fmt.Sprintf("field %s.%s", field.Collection, field.Field))
+			if marker == "~" {
+				r.entries("      ", field.Diff)
+			}
+		}
+
+		for _, relation := range group.relations {
+			marker := changeMarker(ClassifyEntries(relation.Diff))
+			target := relation.RelatedCollection
+			if target == "" {
+				target = "(any)"
+			}
+			r.line("  ", marker, fmt.Sprintf("relation %s.%s -> %s", relation.Collection, relation.Field, target))
+			if marker == "~" {
+				r.entries("      ", relation.Diff)
+			}
+		}
+	}
+	return r.w.Flush()
+}
+
+// diffRenderer writes the lines of a rendered diff.
+type diffRenderer struct {
+	w     *bufio.Writer
+	color bool
+}
+
+// line writes text after indent and marker, colored by marker if enabled.
+func (r *diffRenderer) line(indent, marker, text string) {
+	color := ""
+	if r.color {
+		switch marker {
+		case "+":
+			color = ansiGreen
+		case "-":
+			color = ansiRed
+		case "~":
+			color = ansiYellow
+		}
+	}
+	if color == "" {
+		fmt.Fprintf(r.w, "%s%s %s\n", indent, marker, text)
+		return
+	}
+	fmt.Fprintf(r.w, "%s%s%s %s%s\n", indent, color, marker, text, ansiReset)
+}
+
+// entries writes one line per deep-diff entry.
+func (r *diffRenderer) entries(indent string, entries []DiffEntry) {
+	for _, entry := range entries {
+		marker, text := describeEntry(entry)
+		r.line(indent, marker, text)
+	}
+}
+
+// diffGroup holds the changes of diff that belong to one collection.
+type diffGroup struct {
+	name       string
+	collection *CollectionDiff
+	fields     []FieldDiff
+	relations  []RelationDiff
+}
+
+// groupDiff groups the items of diff by collection, sorted by collection name
+// and then by field name.
+func groupDiff(diff *Diff) []*diffGroup {
+	if diff == nil {
+		return nil
+	}
+
+	groups := map[string]*diffGroup{}
+	group := func(name string) *diffGroup {
+		g, ok := groups[name]
+		if !ok {
+			g = &diffGroup{name: name}
+			groups[name] = g
+		}
+		return g
+	}
+	for i := range diff.Diff.Collections {
+		item := &diff.Diff.Collections[i]
+		group(item.Collection).collection = item
+	}
+	for _, item := range diff.Diff.Fields {
+		g := group(item.Collection)
+		g.fields = append(g.fields, item)
+	}
+	for _, item := range diff.Diff.Relations {
+		g := group(item.Collection)
+		g.relations = append(g.relations, item)
+	}
+
+	sorted := make([]*diffGroup, 0, len(groups))
+	for _, g := range groups {
+		sort.SliceStable(g.fields, func(i, j int) bool { return g.fields[i].Field < g.fields[j].Field })
+		sort.SliceStable(g.relations, func(i, j int) bool { return g.relations[i].Field < g.relations[j].Field })
+		sorted = append(sorted, g)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	return sorted
+}
+
+func changeMarker(change ChangeType) string {
+	switch change {
+	case ChangeCreated:
+		return "+"
+	case ChangeDeleted:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+// describeEntry formats a single deep-diff entry as its marker and text.
+func describeEntry(entry DiffEntry) (string, string) {
+	path := formatPath(entry.Path)
+	switch entry.Kind {
+	case KindEdited:
+		return "~", fmt.Sprintf("%s: %s → %s", path, formatValue(entry.Lhs), formatValue(entry.Rhs))
+	case KindNew:
+		return "+", fmt.Sprintf("%s: %s", path, formatValue(entry.Rhs))
+	case KindDeleted:
+		return "-", fmt.Sprintf("%s: %s", path, formatValue(entry.Lhs))
+	case KindArray:
+		if entry.Item != nil && entry.Index != nil {
+			item := *entry.Item
+			item.Path = append(append([]any{}, entry.Path...), *entry.Index)
+			return describeEntry(item)
+		}
+	}
+	raw, _ := json.Marshal(entry)
+	return "?", fmt.Sprintf("%s: %s", path, truncate(string(raw)))
+}
+
+// formatPath joins a deep-diff path, writing array indexes in brackets.
+func formatPath(path []any) string {
+	if len(path) == 0 {
+		return "(item)"
+	}
+	var b strings.Builder
+	for i, element := range path {
+		switch element := element.(type) {
+		case float64:
+			fmt.Fprintf(&b, "[%d]", int(element))
+		case int:
+			fmt.Fprintf(&b, "[%d]", element)
+		default:
+			if i > 0 {
+				b.WriteByte('.')
+			}
+			fmt.Fprint(&b, element)
+		}
+	}
+	return b.String()
+}
+
+// formatValue renders a raw JSON value compactly.
+func formatValue(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return "(unset)"
+	}
+	return truncate(string(raw))
+}
+
+func truncate(s string) string {
+	if len(s) <= maxRenderedValue {
+		return s
+	}
+	return s[:maxRenderedValue] + "…"
+}
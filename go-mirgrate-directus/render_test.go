@@ -0,0 +1,70 @@
+package gomirgratedirectus_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// ansiEscape matches the SGR escapes colored renderings use.
+var ansiEscape = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// renderDiffs returns the diffs rendered by TestRenderDiff by golden file
+// name: testdata/render/diff.json and the diff of every fixture.
+func renderDiffs(t *testing.T) map[string]*gomigratedirectus.Diff {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "render", "diff.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := gomigratedirectus.ParseDiff(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs := map[string]*gomigratedirectus.Diff{"render/diff.golden": diff}
+	for _, version := range directustest.FixtureVersions() {
+		f, err := directustest.LoadFixture(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		diffs["render/fixture-"+version+".golden"] = f.Diff
+	}
+	return diffs
+}
+
+func TestRenderDiff(t *testing.T) {
+	for name, diff := range renderDiffs(t) {
+		t.Run(name, func(t *testing.T) {
+			var plain, colored bytes.Buffer
+			if err := gomigratedirectus.RenderDiff(diff, &plain); err != nil {
+				t.Fatal(err)
+			}
+			if err := gomigratedirectus.RenderDiffWithOptions(diff, &colored, gomigratedirectus.RenderOptions{Color: true}); err != nil {
+				t.Fatal(err)
+			}
+			golden(t, name, plain.Bytes())
+
+			if ansiEscape.Match(plain.Bytes()) {
+				t.Error("plain rendering holds ANSI escapes")
+			}
+			// Every line is colored by its marker: created green, deleted red
+			// and updated yellow.
+			colors := map[byte]string{'+': "\033[32m", '-': "\033[31m", '~': "\033[33m"}
+			for _, line := range bytes.Split(bytes.TrimSuffix(colored.Bytes(), []byte("\n")), []byte("\n")) {
+				text := bytes.TrimLeft(line, " ")
+				marker := ansiEscape.ReplaceAll(text, nil)[0]
+				if !bytes.HasPrefix(text, []byte(colors[marker]+string(marker))) || !bytes.HasSuffix(line, []byte("\033[0m")) {
+					t.Errorf("colored line %q is not colored for %c", line, marker)
+				}
+			}
+			if stripped := ansiEscape.ReplaceAll(colored.Bytes(), nil); !bytes.Equal(stripped, plain.Bytes()) {
+				t.Errorf("colored rendering without escapes differs from the plain one:\n%s\nwant:\n%s", stripped, &plain)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package gomirgratedirectus
+
+import "time"
+
+// Report is the machine-readable outcome of a CLI command, written to stdout
+// as a single JSON document by --output json. Fields are only ever added, so
+// tooling can rely on the existing ones.
+type Report struct {
+	// Command is the command that ran, such as "migrate" or "diff".
+	Command string `json:"command"`
+	// BaseURL and TargetURL are the projects involved, with secrets in
+	// query strings redacted. Commands that talk to a single project only
+	// set the matching one.
+	BaseURL   string `json:"base_url,omitempty"`
+	TargetURL string `json:"target_url,omitempty"`
+	// BaseFile is the snapshot file used instead of a base project.
+	BaseFile string `json:"base_file,omitempty"`
+	// StartedAt and FinishedAt bracket the command.
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Changed reports whether the target differed from the base.
+	Changed bool `json:"changed"`
+	// Applied reports whether changes were applied to the target.
+	Applied bool `json:"applied"`
+	// Summary counts the changes per category, if a diff was computed or
+	// applied.
+	Summary *DiffSummary `json:"summary,omitempty"`
+	// DestructiveChanges lists the changes that can lose data.
+	DestructiveChanges []DestructiveChange `json:"destructive_changes,omitempty"`
+	// Files describes the synced folders and files.
+	Files *FilesResult `json:"files,omitempty"`
+	// Data counts the synced items per collection.
+	Data *DataResult `json:"data,omitempty"`
+	// Permissions describes the synced roles and permissions.
+	Permissions *PermissionsResult `json:"permissions,omitempty"`
+	// Users lists the provisioned users, without their passwords.
+	Users *UsersResult `json:"users,omitempty"`
+	// Presets describes the synced shared presets.
+	Presets *PresetsResult `json:"presets,omitempty"`
+	// Translations lists the synced custom translations.
+	Translations *TranslationsResult `json:"translations,omitempty"`
+	// Webhooks lists the synced legacy webhooks.
+	Webhooks *WebhooksResult `json:"webhooks,omitempty"`
+	// Settings lists the synced project settings with their values before
+	// and after.
+	Settings *SettingsResult `json:"settings,omitempty"`
+	// Flows describes the synced flows and operations.
+	Flows *FlowsResult `json:"flows,omitempty"`
+	// Dashboards describes the synced dashboards and panels.
+	Dashboards *DashboardsResult `json:"dashboards,omitempty"`
+	// Drift lists the drifted collections, fields and relations found by
+	// check.
+	Drift *DriftResult `json:"drift,omitempty"`
+	// Lint holds the findings of lint.
+	Lint *LintResult `json:"lint,omitempty"`
+	// Build describes the build of the CLI, reported by version.
+	Build *BuildInfo `json:"build,omitempty"`
+	// History lists the recorded migrations read by history.
+	History []HistoryEntry `json:"history,omitempty"`
+	// Snapshots lists the snapshots of a repository listed, tagged, added or
+	// removed by the snapshots command.
+	Snapshots []RepositorySnapshot `json:"snapshots,omitempty"`
+	// Diff is the pending diff reported by diff and dry runs.
+	Diff *Diff `json:"diff,omitempty"`
+	// BackupPath is the backup of the target taken before applying.
+	BackupPath string `json:"backup_path,omitempty"`
+	// UndoPath is the undo record saved after applying, which the undo
+	// command applies to revert the changes.
+	UndoPath string `json:"undo_path,omitempty"`
+	// RolledBack reports whether the target was restored after a failed
+	// apply.
+	RolledBack bool `json:"rolled_back,omitempty"`
+	// Residual summarizes the differences the verification after applying
+	// still found between the target and the base.
+	Residual *DiffSummary `json:"residual,omitempty"`
+	// Stats holds the timings and sizes of the phases of a migration.
+	Stats *MigrationStats `json:"stats,omitempty"`
+	// File is the file the command wrote, such as the output of snapshot.
+	File string `json:"file,omitempty"`
+	// GitCommit and GitTag are the commit and tag snapshot --git-commit
+	// created, empty if the snapshot did not change.
+	GitCommit string `json:"git_commit,omitempty"`
+	GitTag    string `json:"git_tag,omitempty"`
+	// BaseServer and TargetServer are reported by the versions command.
+	BaseServer   *ServerInfo `json:"base_server,omitempty"`
+	TargetServer *ServerInfo `json:"target_server,omitempty"`
+	// Targets holds one entry per target when migrate runs against several
+	// targets. Changed and Applied then cover all targets and the other
+	// target-specific fields above are left empty.
+	Targets []TargetReport `json:"targets,omitempty"`
+	// Hops holds one entry per environment promote promoted to, in order.
+	Hops []HopReport `json:"hops,omitempty"`
+	// Error is the error message if the command failed.
+	Error string `json:"error,omitempty"`
+}
+
+// TargetReport is the outcome of the migration to one of several targets,
+// with the fields of Report that describe a target.
+type TargetReport struct {
+	TargetURL          string              `json:"target_url"`
+	Changed            bool                `json:"changed"`
+	Applied            bool                `json:"applied"`
+	Summary            *DiffSummary        `json:"summary,omitempty"`
+	DestructiveChanges []DestructiveChange `json:"destructive_changes,omitempty"`
+	Files              *FilesResult        `json:"files,omitempty"`
+	Data               *DataResult         `json:"data,omitempty"`
+	Permissions        *PermissionsResult  `json:"permissions,omitempty"`
+	Users              *UsersResult        `json:"users,omitempty"`
+	Presets            *PresetsResult      `json:"presets,omitempty"`
+	Translations       *TranslationsResult `json:"translations,omitempty"`
+	Webhooks           *WebhooksResult     `json:"webhooks,omitempty"`
+	Settings           *SettingsResult     `json:"settings,omitempty"`
+	Flows              *FlowsResult        `json:"flows,omitempty"`
+	Dashboards         *DashboardsResult   `json:"dashboards,omitempty"`
+	Diff               *Diff               `json:"diff,omitempty"`
+	BackupPath         string              `json:"backup_path,omitempty"`
+	UndoPath           string              `json:"undo_path,omitempty"`
+	RolledBack         bool                `json:"rolled_back,omitempty"`
+	Residual           *DiffSummary        `json:"residual,omitempty"`
+	Stats              *MigrationStats     `json:"stats,omitempty"`
+	// Skipped reports that the target was not migrated because an earlier
+	// one failed.
+	Skipped bool `json:"skipped,omitempty"`
+	// CircuitOpen reports that the target kept failing until the circuit
+	// breaker of its client opened.
+	CircuitOpen bool `json:"circuit_open,omitempty"`
+	// Error is the error message if the migration to the target failed.
+	Error string `json:"error,omitempty"`
+}
+
+// HopReport is the outcome of one hop of promote: the fields of TargetReport
+// for the environment, whether it was verified in sync afterwards and when
+// the hop ran.
+type HopReport struct {
+	Environment string `json:"environment"`
+	TargetReport
+	Verified   bool      `json:"verified"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
@@ -0,0 +1,387 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultSnapshotRepository is the directory of the snapshot repository
+// references such as prod@latest resolve in when no other is configured.
+const DefaultSnapshotRepository = "snapshots"
+
+// RepositoryIndexName is the name of the index file at the root of a
+// snapshot repository.
+const RepositoryIndexName = "index.json"
+
+// repositoryIndexVersion is the format version of the index file.
+const repositoryIndexVersion = 1
+
+// LatestTag is the tag every environment of a snapshot repository has
+// implicitly, naming its newest snapshot.
+const LatestTag = "latest"
+
+// ErrSnapshotNotFound is returned when a reference does not match any
+// snapshot of a repository.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// namePattern matches the environment names and tags of a snapshot
+// repository.
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// snapshotRefPattern matches env@tag references.
+var snapshotRefPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*@[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// A SnapshotRepository manages snapshots kept in a SnapshotStore, such as
+// backups, as files named <env>/<timestamp>-<hash>.json and an index file
+// recording the environment, time, hash, size and tags of each. Snapshots
+// are referred to by their ID, the file name without the extension such as
+// prod/20240601T120000Z-0123456789ab, or as env@tag, env@latest naming the
+// newest snapshot of env.
+//
+// The index is rewritten by every change; a repository must not be changed
+// by two processes at the same time.
+type SnapshotRepository struct {
+	store SnapshotStore
+}
+
+// RepositorySnapshot is a snapshot recorded in the index of a
+// SnapshotRepository.
+type RepositorySnapshot struct {
+	ID   string    `json:"id"`
+	Env  string    `json:"env"`
+	Time time.Time `json:"time"`
+	// Hash is the SnapshotHash of the snapshot, checked when it is loaded.
+	Hash string   `json:"hash"`
+	Size int64    `json:"size"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+// file returns the name of the snapshot file in its environment.
+func (s RepositorySnapshot) file() string {
+	return strings.TrimPrefix(s.ID, s.Env+"/") + ".json"
+}
+
+// repositoryIndex is the content of the index file.
+type repositoryIndex struct {
+	Version   int                  `json:"version"`
+	Snapshots []RepositorySnapshot `json:"snapshots"`
+}
+
+// NewSnapshotRepository returns the snapshot repository kept in store.
+func NewSnapshotRepository(store SnapshotStore) *SnapshotRepository {
+	return &SnapshotRepository{store: store}
+}
+
+// OpenSnapshotRepository returns the snapshot repository at location, a
+// directory or URL opened with OpenStore.
+func OpenSnapshotRepository(location string) (*SnapshotRepository, error) {
+	store, err := OpenStore(location)
+	if err != nil {
+		return nil, err
+	}
+	return NewSnapshotRepository(store), nil
+}
+
+// Location returns where the snapshot of the repository is kept, or the
+// repository itself for a nil snapshot.
+func (r *SnapshotRepository) Location(s *RepositorySnapshot) string {
+	if s == nil {
+		return r.store.Location("")
+	}
+	return PrefixStore(r.store, s.Env).Location(s.file())
+}
+
+// BackupEnvName returns the environment the backups of the target at
+// targetURL are kept in by default, named after its host.
+func BackupEnvName(targetURL string) string {
+	return targetDirName(targetURL)
+}
+
+// IsSnapshotRef reports whether s is an env@tag reference to a snapshot of a
+// repository rather than a path.
+func IsSnapshotRef(s string) bool {
+	return snapshotRefPattern.MatchString(s)
+}
+
+// List returns the snapshots of the repository, by environment and from the
+// oldest to the newest.
+func (r *SnapshotRepository) List(ctx context.Context) ([]RepositorySnapshot, error) {
+	index, err := r.readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return index.Snapshots, nil
+}
+
+// Add saves snapshot, normalized as by SaveSnapshot, as the newest snapshot
+// of env. If it has the same schema as the newest snapshot of env nothing is
+// saved and that one is returned.
+func (r *SnapshotRepository) Add(ctx context.Context, env string, snapshot *Snapshot) (*RepositorySnapshot, error) {
+	if !namePattern.MatchString(env) {
+		return nil, fmt.Errorf("invalid environment name %q, expected letters, digits, dots, dashes and underscores", env)
+	}
+	index, err := r.readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := SnapshotHash(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if latest := index.latest(env); latest != nil && latest.Hash == hash {
+		return latest, nil
+	}
+	data, err := EncodeSnapshot(NormalizeSnapshot(snapshot), FormatJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if latest := index.latest(env); latest != nil && !now.After(latest.Time) {
+		// Keep the IDs of an environment in the order of its snapshots.
+		now = latest.Time.Add(time.Second)
+	}
+	entry := RepositorySnapshot{
+		ID:   env + "/" + now.Format("20060102T150405Z") + "-" + hash[:12],
+		Env:  env,
+		Time: now,
+		Hash: hash,
+		Size: int64(len(data)),
+	}
+	if err := PrefixStore(r.store, env).Put(ctx, entry.file(), data); err != nil {
+		return nil, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	index.Snapshots = append(index.Snapshots, entry)
+	if err := r.writeIndex(ctx, index); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Resolve returns the snapshot ref refers to: an ID, a unique prefix of an
+// ID, env@tag or env@latest.
+func (r *SnapshotRepository) Resolve(ctx context.Context, ref string) (*RepositorySnapshot, error) {
+	index, err := r.readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	i, err := index.find(ref)
+	if err != nil {
+		return nil, err
+	}
+	return &index.Snapshots[i], nil
+}
+
+// Load loads the snapshot ref refers to, as resolved by Resolve, checked
+// against the hash recorded in the index unless opts.SkipVerify is set.
+func (r *SnapshotRepository) Load(ctx context.Context, ref string, opts LoadOptions) (*Snapshot, *RepositorySnapshot, error) {
+	entry, err := r.Resolve(ctx, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	location := r.Location(entry)
+	data, err := PrefixStore(r.store, entry.Env).Get(ctx, entry.file())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read snapshot %s: %w", entry.ID, err)
+	}
+	snapshot, err := decodeSnapshotFile(location, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !opts.SkipVerify {
+		hash, err := SnapshotHash(snapshot)
+		if err != nil {
+			return nil, nil, err
+		}
+		if hash != entry.Hash {
+			return nil, nil, fmt.Errorf("%w: snapshot file %s hashes to %s but the repository index records %s, it was corrupted or modified after it was written",
+				ErrChecksumMismatch, location, hash, entry.Hash)
+		}
+	}
+	return snapshot, entry, nil
+}
+
+// Tag tags the snapshot ref refers to with name. A tag names one snapshot
+// per environment, so it is moved from any other snapshot of the
+// environment.
+func (r *SnapshotRepository) Tag(ctx context.Context, ref, name string) (*RepositorySnapshot, error) {
+	if !namePattern.MatchString(name) || name == LatestTag {
+		return nil, fmt.Errorf("invalid tag %q, expected letters, digits, dots, dashes and underscores other than %s", name, LatestTag)
+	}
+	index, err := r.readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	i, err := index.find(ref)
+	if err != nil {
+		return nil, err
+	}
+	env := index.Snapshots[i].Env
+	for j := range index.Snapshots {
+		if j != i && index.Snapshots[j].Env == env {
+			index.Snapshots[j].Tags = slices.DeleteFunc(index.Snapshots[j].Tags, func(tag string) bool { return tag == name })
+		}
+	}
+	if !slices.Contains(index.Snapshots[i].Tags, name) {
+		index.Snapshots[i].Tags = append(index.Snapshots[i].Tags, name)
+		slices.Sort(index.Snapshots[i].Tags)
+	}
+	if err := r.writeIndex(ctx, index); err != nil {
+		return nil, err
+	}
+	return &index.Snapshots[i], nil
+}
+
+// RepositoryPruneOptions configures SnapshotRepository.Prune.
+type RepositoryPruneOptions struct {
+	// Keep is the number of snapshots kept per environment, the newest.
+	Keep int
+	// KeepTagged also keeps the older snapshots that have a tag.
+	KeepTagged bool
+	// Env limits the pruning to one environment.
+	Env string
+	// DryRun returns the snapshots that would be removed without removing
+	// them.
+	DryRun bool
+}
+
+// Prune removes all but the newest opts.Keep snapshots of each environment
+// and returns the removed snapshots. The index is written before the files
+// are deleted, so that an interrupted prune leaves unlisted files rather
+// than entries without a file.
+func (r *SnapshotRepository) Prune(ctx context.Context, opts RepositoryPruneOptions) ([]RepositorySnapshot, error) {
+	if opts.Keep < 0 {
+		return nil, fmt.Errorf("invalid number of snapshots to keep %d", opts.Keep)
+	}
+	index, err := r.readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	kept := make(map[string]int)
+	var removed []RepositorySnapshot
+	var remaining []RepositorySnapshot
+	// Walk from the newest, so that the first opts.Keep of each environment
+	// are kept.
+	for i := len(index.Snapshots) - 1; i >= 0; i-- {
+		entry := index.Snapshots[i]
+		switch {
+		case opts.Env != "" && entry.Env != opts.Env,
+			kept[entry.Env] < opts.Keep,
+			opts.KeepTagged && len(entry.Tags) > 0:
+			kept[entry.Env]++
+			remaining = append(remaining, entry)
+		default:
+			removed = append(removed, entry)
+		}
+	}
+	slices.Reverse(remaining)
+	slices.Reverse(removed)
+	if opts.DryRun || len(removed) == 0 {
+		return removed, nil
+	}
+
+	index.Snapshots = remaining
+	if err := r.writeIndex(ctx, index); err != nil {
+		return nil, err
+	}
+	for _, entry := range removed {
+		if err := PrefixStore(r.store, entry.Env).Delete(ctx, entry.file()); err != nil {
+			return removed, fmt.Errorf("failed to remove snapshot %s: %w", entry.ID, err)
+		}
+	}
+	return removed, nil
+}
+
+// readIndex reads the index, empty if the repository has none yet.
+func (r *SnapshotRepository) readIndex(ctx context.Context) (*repositoryIndex, error) {
+	data, err := r.store.Get(ctx, RepositoryIndexName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &repositoryIndex{Version: repositoryIndexVersion}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot repository index: %w", err)
+	}
+	var index repositoryIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("snapshot repository index %s is corrupt: %w", r.store.Location(RepositoryIndexName), err)
+	}
+	if index.Version != repositoryIndexVersion {
+		return nil, fmt.Errorf("snapshot repository index %s has format version %d, only version %d is supported",
+			r.store.Location(RepositoryIndexName), index.Version, repositoryIndexVersion)
+	}
+	index.sort()
+	return &index, nil
+}
+
+// writeIndex replaces the index.
+func (r *SnapshotRepository) writeIndex(ctx context.Context, index *repositoryIndex) error {
+	index.sort()
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot repository index: %w", err)
+	}
+	if err := r.store.Put(ctx, RepositoryIndexName, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to save snapshot repository index: %w", err)
+	}
+	return nil
+}
+
+// sort orders the snapshots by environment and time.
+func (index *repositoryIndex) sort() {
+	slices.SortStableFunc(index.Snapshots, func(a, b RepositorySnapshot) int {
+		if c := strings.Compare(a.Env, b.Env); c != 0 {
+			return c
+		}
+		if c := a.Time.Compare(b.Time); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
+
+// latest returns the newest snapshot of env, or nil if it has none.
+func (index *repositoryIndex) latest(env string) *RepositorySnapshot {
+	for i := len(index.Snapshots) - 1; i >= 0; i-- {
+		if index.Snapshots[i].Env == env {
+			return &index.Snapshots[i]
+		}
+	}
+	return nil
+}
+
+// find returns the index of the snapshot ref refers to.
+func (index *repositoryIndex) find(ref string) (int, error) {
+	if env, tag, ok := strings.Cut(ref, "@"); ok {
+		for i := len(index.Snapshots) - 1; i >= 0; i-- {
+			s := index.Snapshots[i]
+			if s.Env == env && (tag == LatestTag || slices.Contains(s.Tags, tag)) {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("%w: no snapshot of %s is tagged %s", ErrSnapshotNotFound, env, tag)
+	}
+	var matches []int
+	for i, s := range index.Snapshots {
+		if s.ID == ref {
+			return i, nil
+		}
+		if strings.HasPrefix(s.ID, ref) {
+			matches = append(matches, i)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return -1, fmt.Errorf("%w: no snapshot has ID %s", ErrSnapshotNotFound, ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return -1, fmt.Errorf("snapshot ID %s is ambiguous, it matches %d snapshots", ref, len(matches))
+	}
+}
@@ -0,0 +1,39 @@
+package gomirgratedirectus
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// RequestIDHeader is the header carrying the per-request correlation ID, so
+// requests can be found in the Directus access logs.
+const RequestIDHeader = "X-Request-ID"
+
+// newRequestID returns a random version 4 UUID.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// LastRequestID returns the correlation ID of the most recent request sent by
+// the client, or "" if it has not sent any.
+func (c *DirectusClient) LastRequestID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastRequestID
+}
+
+// setRequestID attaches a new correlation ID to header and
+// records it as the client's last request ID.
+func (c *DirectusClient) setRequestID(header http.Header) {
+	id := newRequestID()
+	header.Set(RequestIDHeader, id)
+
+	c.mu.Lock()
+	c.lastRequestID = id
+	c.mu.Unlock()
+}
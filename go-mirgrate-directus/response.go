@@ -0,0 +1,225 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DefaultMaxResponseBytes is the largest response body a client created by
+// NewDirectusClient accepts.
+const DefaultMaxResponseBytes = 50 << 20
+
+const (
+	// maxExcerptBytes is how much of an unexpected response body is quoted
+	// in error messages.
+	maxExcerptBytes = 256
+	// maxErrorBodyBytes is how much of an error response body is kept in a
+	// DirectusError.
+	maxErrorBodyBytes = 4 << 10
+)
+
+// WithMaxResponseBytes sets the largest response body the client accepts.
+func WithMaxResponseBytes(n int64) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.maxResponseBytes = n
+	}
+}
+
+// ResponseTooLargeError is returned when a response body exceeds the client's
+// MaxResponseBytes.
+type ResponseTooLargeError struct {
+	Operation string
+	Limit     int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("%s too large: response exceeds %d bytes, raise MaxResponseBytes", e.Operation, e.Limit)
+}
+
+// limitedReader fails with a ResponseTooLargeError once the body turns out to
+// be longer than limit bytes, unlike io.LimitReader which silently stops. It
+// reads one byte past the limit to tell, but never returns it, so that a body
+// over the limit cannot be decoded even when it completes with that byte.
+type limitedReader struct {
+	r         io.Reader
+	op        string
+	limit     int64
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, &ResponseTooLargeError{Operation: l.op, Limit: l.limit}
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.remaining {
+		n, l.remaining = int(l.remaining), -1
+		return n, &ResponseTooLargeError{Operation: l.op, Limit: l.limit}
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// responseBody returns the body of resp, limited to c.MaxResponseBytes.
+func (c *DirectusClient) responseBody(op string, resp *http.Response) io.Reader {
+	body := io.Reader(receivedCounter{r: resp.Body, client: c})
+	if c.MaxResponseBytes <= 0 {
+		return body
+	}
+	return &limitedReader{r: body, op: op, limit: c.MaxResponseBytes, remaining: c.MaxResponseBytes}
+}
+
+// LastTransferBytes returns the size of the body of the most recent request
+// sent by the client and of the part of its response read so far, both
+// uncompressed. The migration statistics are built from it.
+func (c *DirectusClient) LastTransferBytes() (sent, received int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastSent, c.lastReceived
+}
+
+// startTransfer resets the counts of LastTransferBytes for a request with a
+// body of size bytes.
+func (c *DirectusClient) startTransfer(size int) {
+	c.mu.Lock()
+	c.lastSent, c.lastReceived = int64(size), 0
+	c.mu.Unlock()
+}
+
+// receivedCounter counts the bytes read from a response body as received by
+// client.
+type receivedCounter struct {
+	r      io.Reader
+	client *DirectusClient
+}
+
+func (r receivedCounter) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.client.mu.Lock()
+	r.client.lastReceived += int64(n)
+	r.client.mu.Unlock()
+	return n, err
+}
+
+// readBody reads the body of resp, limited to c.MaxResponseBytes.
+func (c *DirectusClient) readBody(op string, resp *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(c.responseBody(op, resp))
+	if err != nil {
+		var tooLarge *ResponseTooLargeError
+		if errors.As(err, &tooLarge) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read %s response: %w", op, err)
+	}
+	return body, nil
+}
+
+// decodeData decodes a Directus response body while streaming it and stores
+// the object in its "data" field in out. The data field is decoded in place
+// rather than copied out of the envelope first, so that a large snapshot is
+// only held once as JSON. Bodies that are not JSON or whose data field is
+// missing or not an object, as with some proxy error pages served with status
+// 200, yield an error naming what was received.
+func (c *DirectusClient) decodeData(op string, r io.Reader, out any) error {
+	head := &prefixWriter{max: maxExcerptBytes}
+
+	envelope := struct {
+		Data dataField `json:"data"`
+	}{Data: dataField{out: out}}
+	if err := json.NewDecoder(io.TeeReader(r, head)).Decode(&envelope); err != nil {
+		var tooLarge *ResponseTooLargeError
+		if errors.As(err, &tooLarge) {
+			return err
+		}
+		return fmt.Errorf("failed to decode %s response: %w (body: %s)", op, err, c.excerpt(head))
+	}
+
+	data := envelope.Data
+	if !data.found {
+		return fmt.Errorf("%s response does not contain 'data' field (body: %s)", op, c.excerpt(head))
+	}
+	if data.kind != "object" {
+		return fmt.Errorf("%s response 'data' field is %s, expected object (body: %s)", op, data.kind, c.excerpt(head))
+	}
+	if data.err != nil {
+		return fmt.Errorf("failed to decode %s response data: %w (body: %s)", op, data.err, c.excerpt(head))
+	}
+	return nil
+}
+
+// dataField decodes the data field of a response envelope into out, if it is
+// an object. It records what it found rather than failing the decoding of the
+// envelope, so that decodeData can tell the cases apart.
+type dataField struct {
+	out   any
+	found bool
+	kind  string
+	err   error
+}
+
+func (f *dataField) UnmarshalJSON(data []byte) error {
+	f.found = true
+	if f.kind = rawJSONType(data); f.kind == "object" {
+		f.err = json.Unmarshal(data, f.out)
+	}
+	return nil
+}
+
+// prefixWriter keeps the first max bytes written to it.
+type prefixWriter struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	if room := w.max - len(w.buf); room > 0 {
+		if len(p) > room {
+			w.buf = append(w.buf, p[:room]...)
+			w.truncated = true
+		} else {
+			w.buf = append(w.buf, p...)
+		}
+	} else if len(p) > 0 {
+		w.truncated = true
+	}
+	return len(p), nil
+}
+
+// excerpt returns the recorded start of a response body with credentials
+// redacted, for quoting in error messages.
+func (c *DirectusClient) excerpt(head *prefixWriter) string {
+	if head.truncated {
+		return c.redact(string(head.buf)) + "... (truncated)"
+	}
+	return c.redact(string(head.buf))
+}
+
+// rawJSONType names the JSON type of an encoded value.
+func rawJSONType(data json.RawMessage) string {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return "empty"
+	}
+	switch data[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 'n':
+		return "null"
+	case 't', 'f':
+		return "boolean"
+	default:
+		return "number"
+	}
+}
@@ -0,0 +1,84 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+func TestDecodeDataWrongType(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"null", `{"data":null}`, "'data' field is null, expected object"},
+		{"array", `{"data":[]}`, "'data' field is array, expected object"},
+		{"string", `{"data":"oops"}`, "'data' field is string, expected object"},
+		{"missing", `{"errors":[]}`, "does not contain 'data' field"},
+		{"not JSON", `<html>Bad gateway</html>`, "failed to decode snapshot response"},
+		{"wrong field type", `{"data":{"version":"one"}}`, "failed to decode snapshot response data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := staticServer(t, http.StatusOK, tt.body)
+			snapshot, err := client.GetSnapshot(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("GetSnapshot = %+v, %v, want an error containing %q", snapshot, err, tt.wantErr)
+			}
+			// The error quotes the body, so a proxy page can be recognized.
+			if !strings.Contains(err.Error(), tt.body) {
+				t.Errorf("error %q does not quote the body", err)
+			}
+		})
+	}
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	body := `{"data":{"version":1,"directus":"10.12.1","collections":[],"fields":[],"relations":[]}}`
+	tests := []struct {
+		name    string
+		limit   int64
+		wantErr bool
+	}{
+		{"at the limit", int64(len(body)), false},
+		{"one byte over", int64(len(body)) - 1, true},
+		{"far over", 10, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := staticServer(t, http.StatusOK, body)
+			client.MaxResponseBytes = tt.limit
+
+			_, err := client.GetSnapshot(ctx)
+			checkTooLarge(t, "GetSnapshot", err, tt.limit, tt.wantErr)
+			// Diffs are read whole before being decoded.
+			_, err = client.GetDiff(ctx, &gomigratedirectus.Snapshot{}, false)
+			if !tt.wantErr && errors.Is(err, gomigratedirectus.ErrNoChanges) {
+				err = nil
+			}
+			checkTooLarge(t, "GetDiff", err, tt.limit, tt.wantErr)
+		})
+	}
+}
+
+// checkTooLarge fails t unless err is a ResponseTooLargeError for limit when
+// wantErr is set, and nil otherwise. A truncated body must never be decoded
+// as if it were complete.
+func checkTooLarge(t *testing.T, method string, err error, limit int64, wantErr bool) {
+	t.Helper()
+	var tooLarge *gomigratedirectus.ResponseTooLargeError
+	switch {
+	case !wantErr && err != nil:
+		t.Errorf("%s: %v", method, err)
+	case wantErr && !errors.As(err, &tooLarge):
+		t.Errorf("%s = %v, want a ResponseTooLargeError", method, err)
+	case wantErr && tooLarge.Limit != limit:
+		t.Errorf("%s limit = %d, want %d", method, tooLarge.Limit, limit)
+	}
+}
@@ -0,0 +1,139 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how DirectusClient retries requests that fail because
+// of connection errors, rate limiting (429) or 502, 503 and 504 responses.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// Values below 2 disable retries.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry. It doubles on every
+	// further retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the wait between two attempts.
+	MaxDelay time.Duration
+	// Jitter is the fraction (0 to 1) of each delay that is randomized, so
+	// that concurrent clients do not retry in lockstep.
+	Jitter float64
+	// MaxRetryAfter caps how long the client sleeps when a 429 response asks
+	// it to wait via the Retry-After header. Zero means no cap.
+	MaxRetryAfter time.Duration
+}
+
+// DefaultRetryPolicy returns the policy used by NewDirectusClient.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+		Jitter:      0.2,
+
+		MaxRetryAfter: time.Minute,
+	}
+}
+
+// WithRetryPolicy replaces the default retry policy of the client.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.retryPolicy = &policy
+	}
+}
+
+// attempts returns the total number of attempts allowed by p.
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// delay returns the wait before retry number attempt (starting at 1).
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 && d > 0 {
+		jitter := min(p.Jitter, 1)
+		d -= time.Duration(rand.Float64() * jitter * float64(d))
+	}
+	return d
+}
+
+// isRetryableStatus reports whether a response with the given status code is
+// worth retrying.
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the wait requested by the Retry-After header of resp,
+// capped at p.MaxRetryAfter. The header may hold either a number of seconds or
+// an HTTP date. ok is false when the header is missing or malformed.
+func (p RetryPolicy) retryAfter(resp *http.Response, now time.Time) (d time.Duration, ok bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		d = date.Sub(now)
+	} else {
+		return 0, false
+	}
+
+	if d < 0 {
+		d = 0
+	}
+	if p.MaxRetryAfter > 0 && d > p.MaxRetryAfter {
+		d = p.MaxRetryAfter
+	}
+	return d, true
+}
+
+// transientError marks a failure that may succeed when retried.
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+
+func (e *transientError) Unwrap() error { return e.err }
+
+// isTransient reports whether err was caused by a failure that may succeed
+// when retried.
+func isTransient(err error) bool {
+	var transient *transientError
+	return errors.As(err, &transient)
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
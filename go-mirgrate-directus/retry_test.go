@@ -0,0 +1,114 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		failures     int
+		maxAttempts  int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"succeeds after failures", http.StatusServiceUnavailable, 2, 3, 3, false},
+		{"stops after MaxAttempts", http.StatusBadGateway, 5, 3, 3, true},
+		{"retries disabled", http.StatusGatewayTimeout, 1, 1, 1, true},
+		{"client errors not retried", http.StatusBadRequest, 1, 3, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := directustest.NewServer(t)
+			for n := 1; n <= tt.failures; n++ {
+				server.Fail("/schema/snapshot", n, directustest.Failure{Status: tt.status})
+			}
+			client := server.Client(quiet(gomigratedirectus.WithRetryPolicy(gomigratedirectus.RetryPolicy{
+				MaxAttempts: tt.maxAttempts,
+				BaseDelay:   time.Millisecond,
+			}))...)
+
+			_, err := client.GetSnapshot(context.Background())
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("GetSnapshot error = %v, want error %v", err, tt.wantErr)
+			}
+			if n := len(server.Requests()); n != tt.wantAttempts {
+				t.Errorf("server received %d requests, want %d", n, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestApplyNotRetried(t *testing.T) {
+	server := directustest.NewServer(t)
+	server.Fail("/schema/apply", 1, directustest.Failure{Status: http.StatusServiceUnavailable})
+	client := server.Client(quiet()...)
+
+	// A failed apply may have reached Directus, so it is never resent as is.
+	if err := client.ApplyDiff(context.Background(), &gomigratedirectus.Diff{Hash: "abc"}); err == nil {
+		t.Fatal("ApplyDiff succeeded, want the 503")
+	}
+	if n := len(server.ApplyRequests()); n != 1 {
+		t.Errorf("apply sent %d times, want 1", n)
+	}
+}
+
+// rateLimitedServer answers 429 with a Retry-After of retryAfter to the first
+// limited requests and 204 to the next ones, counting them in requests.
+func rateLimitedServer(t *testing.T, limited int, retryAfter string, requests *atomic.Int32) *gomigratedirectus.DirectusClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= int32(limited) {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return gomigratedirectus.NewDirectusClient(server.URL, "token", quiet(gomigratedirectus.WithRetryPolicy(gomigratedirectus.RetryPolicy{
+		MaxAttempts:   3,
+		BaseDelay:     time.Millisecond,
+		MaxRetryAfter: time.Minute,
+	}))...)
+}
+
+func TestRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	client := rateLimitedServer(t, 2, "1", &requests)
+
+	// Rate-limited requests were never processed, so even an apply is resent.
+	start := time.Now()
+	if err := client.ApplyDiff(context.Background(), &gomigratedirectus.Diff{}); err != nil {
+		t.Fatalf("ApplyDiff: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 2*time.Second {
+		t.Errorf("ApplyDiff returned after %v, want at least the 2s asked by Retry-After", elapsed)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("server received %d requests, want 3", n)
+	}
+}
+
+func TestRetryAfterCapped(t *testing.T) {
+	var requests atomic.Int32
+	client := rateLimitedServer(t, 1, "3600", &requests)
+	client.RetryPolicy.MaxRetryAfter = 10 * time.Millisecond
+
+	start := time.Now()
+	if err := client.ApplyDiff(context.Background(), &gomigratedirectus.Diff{}); err != nil {
+		t.Fatalf("ApplyDiff: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("ApplyDiff returned after %v, want the wait capped by MaxRetryAfter", elapsed)
+	}
+}
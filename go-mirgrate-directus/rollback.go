@@ -0,0 +1,36 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Rollback restores the schema of target to backup, usually the snapshot
+// saved by BackupSnapshot before an apply that failed partway. It diffs the
+// backup against the current target, forcing the diff since both come from
+// the same instance, and applies the result. Nothing is applied when the
+// target still matches the backup.
+func Rollback(ctx context.Context, target *DirectusClient, backup *Snapshot) error {
+	if backup == nil {
+		return fmt.Errorf("no backup snapshot to roll back to")
+	}
+	logger := target.logger()
+
+	logger.Info("computing rollback diff", "target", RedactURL(target.URL))
+	diff, err := target.GetDiff(ctx, backup, true)
+	if errors.Is(err, ErrNoChanges) {
+		logger.Info("target still matches the backup, nothing to roll back")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to compute rollback diff: %w", err)
+	}
+
+	logger.Info("applying rollback diff", "summary", SummarizeDiff(diff).String())
+	if err := target.ApplyDiff(ctx, diff); err != nil {
+		return fmt.Errorf("failed to apply rollback diff: %w", err)
+	}
+	logger.Info("rollback diff applied", "request_id", target.LastRequestID())
+	return nil
+}
@@ -0,0 +1,203 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// fakeS3 is an S3 service holding the objects of a single bucket in memory.
+// It lists two keys per page, to exercise continuation tokens.
+type fakeS3 struct {
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	lists   int
+}
+
+func newFakeS3(t *testing.T, bucket string) (*fakeS3, *httptest.Server) {
+	t.Helper()
+	s := &fakeS3{bucket: bucket, objects: map[string][]byte{}}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") ||
+		r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code><Message>bad signature</Message></Error>", http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+s.bucket)
+	if !ok {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+	key = strings.TrimPrefix(key, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		s.list(w, r.URL.Query())
+	case r.Method == http.MethodPut:
+		s.objects[key] = body
+	case r.Method == http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list answers a ListObjectsV2 request. Callers hold s.mu.
+func (s *fakeS3) list(w http.ResponseWriter, query map[string][]string) {
+	s.lists++
+	get := func(name string) string {
+		if values := query[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	prefix, delimiter := get("prefix"), get("delimiter")
+	var keys []string
+	for key := range s.objects {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if ok && (delimiter == "" || !strings.Contains(rest, delimiter)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	start, _ := strconv.Atoi(get("continuation-token"))
+	end := min(start+2, len(keys))
+
+	type content struct {
+		Key          string
+		Size         int
+		LastModified time.Time
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []content
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{IsTruncated: end < len(keys)}
+	for _, key := range keys[start:end] {
+		result.Contents = append(result.Contents, content{Key: key, Size: len(s.objects[key]), LastModified: time.Now().UTC()})
+	}
+	if result.IsTruncated {
+		result.NextContinuationToken = strconv.Itoa(end)
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func TestS3Store(t *testing.T) {
+	ctx := context.Background()
+	fake, server := newFakeS3(t, "snapshots")
+	store := &gomigratedirectus.S3Store{
+		Endpoint:        server.URL,
+		Bucket:          "snapshots",
+		Prefix:          "/backups/prod/",
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+	}
+
+	names := []string{"target-1.json", "target-2.json", "target 3+$.json", "target-4.json", "target-5.json"}
+	for _, name := range names {
+		if err := store.Put(ctx, name, []byte(`{"name":"`+name+`"}`)); err != nil {
+			t.Fatalf("Put %s: %v", name, err)
+		}
+	}
+	// Objects of other prefixes or below the prefix are not listed.
+	fake.mu.Lock()
+	fake.objects["backups/staging/target-1.json"] = []byte("{}")
+	fake.objects["backups/prod/old/target-0.json"] = []byte("{}")
+	fake.mu.Unlock()
+
+	data, err := store.Get(ctx, "target 3+$.json")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if want := `{"name":"target 3+$.json"}`; string(data) != want {
+		t.Errorf("Get = %s, want %s", data, want)
+	}
+	fake.mu.Lock()
+	if _, ok := fake.objects["backups/prod/target 3+$.json"]; !ok {
+		t.Errorf("objects %v, want the key with the prefix and the name unescaped", fake.objects)
+	}
+	fake.mu.Unlock()
+	if _, err := store.Get(ctx, "missing.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get of a missing object = %v, want fs.ErrNotExist", err)
+	}
+
+	objects, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var listed []string
+	for _, o := range objects {
+		listed = append(listed, o.Name)
+		if o.Size == 0 || o.ModTime.IsZero() {
+			t.Errorf("listed %+v, want its size and modification time", o)
+		}
+	}
+	want := slices.Sorted(slices.Values(names))
+	if !slices.Equal(listed, want) {
+		t.Errorf("List = %q, want %q", listed, want)
+	}
+	fake.mu.Lock()
+	if fake.lists != 3 {
+		t.Errorf("List sent %d requests, want 3 pages of 2 objects", fake.lists)
+	}
+	fake.mu.Unlock()
+
+	if err := store.Delete(ctx, "target-1.json"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := store.Delete(ctx, "target-1.json"); err != nil {
+		t.Errorf("Delete of a deleted object: %v", err)
+	}
+	if _, err := store.Get(ctx, "target-1.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get of a deleted object = %v, want fs.ErrNotExist", err)
+	}
+	if got := store.Location("target-2.json"); got != "s3://snapshots/backups/prod/target-2.json" {
+		t.Errorf("Location = %s", got)
+	}
+}
+
+func TestS3StoreError(t *testing.T) {
+	_, server := newFakeS3(t, "snapshots")
+	store := &gomigratedirectus.S3Store{Endpoint: server.URL, Bucket: "snapshots", AccessKeyID: "other", SecretAccessKey: "secret"}
+
+	err := store.Put(context.Background(), "target-1.json", []byte("{}"))
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch: bad signature") {
+		t.Errorf("Put with rejected credentials = %v, want the S3 error code and message", err)
+	}
+}
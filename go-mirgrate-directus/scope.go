@@ -0,0 +1,72 @@
+package gomirgratedirectus
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SnapshotScope is the result of ScopeCollections.
+type SnapshotScope struct {
+	// Collections are the collections in scope, the named ones and the
+	// junctions, sorted.
+	Collections []string
+	// Junctions lists the junction collections pulled in because they link
+	// collections in scope.
+	Junctions []string
+}
+
+// Filter returns the SchemaFilter keeping only the collections in scope.
+func (s *SnapshotScope) Filter() SchemaFilter {
+	return SchemaFilter{IncludeCollections: s.Collections}
+}
+
+// ScopeCollections returns the scope of a migration limited to the
+// collections names of snapshot: the named collections and the junction
+// collections of the many-to-many relations between them, or to system
+// collections such as directus_files, which are needed to apply those
+// relations. Names are exact collection names; unknown ones fail the scope,
+// listing the collections of the snapshot.
+func ScopeCollections(snapshot *Snapshot, names []string) (*SnapshotScope, error) {
+	known := make([]string, 0, len(snapshot.Collections))
+	for _, collection := range snapshot.Collections {
+		known = append(known, collection.Collection)
+	}
+	slices.Sort(known)
+	var unknown []string
+	for _, name := range names {
+		if !slices.Contains(known, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown collections %s, the snapshot has: %s", strings.Join(unknown, ", "), strings.Join(known, ", "))
+	}
+
+	scope := &SnapshotScope{Collections: slices.Clone(names)}
+	inScope := func(name string) bool {
+		return IsSystemCollection(name) || slices.Contains(scope.Collections, name)
+	}
+	// A junction collection holds the relations of both sides of a
+	// many-to-many relation, pointing at one another through junction_field.
+	linked := map[string][]string{}
+	for _, relation := range snapshot.Relations {
+		if junctionField, _ := relation.Meta["junction_field"].(string); junctionField != "" && relation.RelatedCollection != "" {
+			linked[relation.Collection] = append(linked[relation.Collection], relation.RelatedCollection)
+		}
+	}
+	for _, junction := range sortedKeys(linked) {
+		if inScope(junction) {
+			continue
+		}
+		sides := linked[junction]
+		if slices.ContainsFunc(sides, func(name string) bool { return !IsSystemCollection(name) && slices.Contains(names, name) }) &&
+			!slices.ContainsFunc(sides, func(name string) bool { return !inScope(name) }) {
+			scope.Junctions = append(scope.Junctions, junction)
+		}
+	}
+	scope.Collections = append(scope.Collections, scope.Junctions...)
+	slices.Sort(scope.Collections)
+	scope.Collections = slices.Compact(scope.Collections)
+	return scope, nil
+}
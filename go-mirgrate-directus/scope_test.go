@@ -0,0 +1,208 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// modelsSnapshot loads the snapshot of testdata/models.
+func modelsSnapshot(t *testing.T) *gomigratedirectus.Snapshot {
+	t.Helper()
+	s, err := gomigratedirectus.LoadSnapshot(filepath.Join("testdata", "models", "snapshot.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// creating returns the diff of a target missing everything of s, as
+// Directus reports it for an empty project whatever snapshot it is sent.
+func creating(t *testing.T, s *gomigratedirectus.Snapshot) *gomigratedirectus.Diff {
+	t.Helper()
+	diff := &gomigratedirectus.Diff{Hash: "hash"}
+	for _, c := range s.Collections {
+		diff.Diff.Collections = append(diff.Diff.Collections,
+			gomigratedirectus.CollectionDiff{Collection: c.Collection, Diff: created(t, c)})
+	}
+	for _, f := range s.Fields {
+		diff.Diff.Fields = append(diff.Diff.Fields,
+			gomigratedirectus.FieldDiff{Collection: f.Collection, Field: f.Field, Diff: created(t, f)})
+	}
+	for _, r := range s.Relations {
+		diff.Diff.Relations = append(diff.Diff.Relations,
+			gomigratedirectus.RelationDiff{Collection: r.Collection, Field: r.Field, RelatedCollection: r.RelatedCollection, Diff: created(t, r)})
+	}
+	return diff
+}
+
+func TestScopeCollections(t *testing.T) {
+	s := modelsSnapshot(t)
+	for _, tt := range []struct {
+		names       []string
+		collections []string
+		junctions   []string
+	}{
+		{[]string{"articles"}, []string{"articles"}, nil},
+		{[]string{"tags", "articles"}, []string{"articles", "articles_tags", "tags"}, []string{"articles_tags"}},
+		// Naming the junction itself does not report it as pulled in.
+		{[]string{"articles", "articles_tags", "tags"}, []string{"articles", "articles_tags", "tags"}, nil},
+		{[]string{"tags", "authors"}, []string{"authors", "tags"}, nil},
+	} {
+		scope, err := gomigratedirectus.ScopeCollections(s, tt.names)
+		if err != nil {
+			t.Fatalf("ScopeCollections(%v): %v", tt.names, err)
+		}
+		if !slices.Equal(scope.Collections, tt.collections) || !slices.Equal(scope.Junctions, tt.junctions) {
+			t.Errorf("ScopeCollections(%v) = %v with junctions %v, want %v with %v",
+				tt.names, scope.Collections, scope.Junctions, tt.collections, tt.junctions)
+		}
+	}
+
+	_, err := gomigratedirectus.ScopeCollections(s, []string{"articles", "categories", "users"})
+	want := "unknown collections categories, users, the snapshot has: articles, articles_tags, authors, comments, content, pages, settings, tags"
+	if err == nil || err.Error() != want {
+		t.Errorf("ScopeCollections with unknown names = %v, want %q", err, want)
+	}
+}
+
+func TestMigrateScopeDiffRequest(t *testing.T) {
+	s := modelsSnapshot(t)
+	for _, tt := range []struct {
+		names     []string
+		scope     []string
+		junctions []string
+		relations []string
+	}{
+		{[]string{"articles"}, []string{"articles"}, nil,
+			[]string{"articles.cover->directus_files"}},
+		{[]string{"articles", "tags"}, []string{"articles", "articles_tags", "tags"}, []string{"articles_tags"},
+			[]string{"articles.cover->directus_files", "articles_tags.articles_id->articles", "articles_tags.tags_id->tags"}},
+	} {
+		t.Run(strings.Join(tt.names, ","), func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			info := gomigratedirectus.ServerInfo{Version: s.Directus, Vendor: s.Vendor}
+			base, target := directustest.NewServer(t), directustest.NewServer(t)
+			base.SetSnapshot(s)
+			base.SetServerInfo(info)
+			target.SetServerInfo(info)
+			target.SetDiff(creating(t, s))
+
+			var scoped *gomigratedirectus.SnapshotScoped
+			opts := gomigratedirectus.MigrationOptions{
+				ScopeCollections: tt.names,
+				VerifyAfterApply: gomigratedirectus.VerifyOff,
+				OnEvent: func(e gomigratedirectus.Event) {
+					if e, ok := e.(*gomigratedirectus.SnapshotScoped); ok {
+						scoped = e
+					}
+				},
+			}
+			if _, err := gomigratedirectus.MigrateWithOptions(context.Background(), base.Client(quiet()...), target.Client(quiet()...), opts); err != nil {
+				t.Fatalf("MigrateWithOptions: %v", err)
+			}
+			if scoped == nil || !slices.Equal(scoped.Collections, tt.scope) || !slices.Equal(scoped.Junctions, tt.junctions) {
+				t.Errorf("SnapshotScoped = %+v, want collections %v and junctions %v", scoped, tt.scope, tt.junctions)
+			}
+
+			// The diff request holds the pruned snapshot, and no diff request,
+			// the one of the undo record included, anything out of scope.
+			var wantFields []string
+			for _, f := range s.Fields {
+				if slices.Contains(tt.scope, f.Collection) {
+					wantFields = append(wantFields, f.Collection+"."+f.Field)
+				}
+			}
+			slices.Sort(wantFields)
+			requests := target.DiffRequests()
+			if len(requests) == 0 {
+				t.Fatal("target received no diff request")
+			}
+			collections, fields, relations := snapshotKeys(requests[0])
+			if !slices.Equal(collections, tt.scope) || !slices.Equal(fields, wantFields) || !slices.Equal(relations, tt.relations) {
+				t.Errorf("diff request holds %v, %v, %v, want %v, %v, %v",
+					collections, fields, relations, tt.scope, wantFields, tt.relations)
+			}
+			for _, request := range requests[1:] {
+				collections, fields, relations := snapshotKeys(request)
+				for _, key := range slices.Concat(collections, fields, relations) {
+					if c, _, _ := strings.Cut(key, "."); !slices.Contains(tt.scope, c) {
+						t.Errorf("diff request holds %s, out of scope", key)
+					}
+				}
+			}
+
+			// The target's diff touches every collection, but only the
+			// changes in scope are applied.
+			applied := target.ApplyRequests()
+			if len(applied) != 1 {
+				t.Fatalf("target applied %d diffs, want 1", len(applied))
+			}
+			var touched []string
+			for _, c := range applied[0].Diff.Collections {
+				touched = append(touched, c.Collection)
+			}
+			for _, f := range applied[0].Diff.Fields {
+				touched = append(touched, f.Collection)
+			}
+			for _, r := range applied[0].Diff.Relations {
+				touched = append(touched, r.Collection)
+				if !gomigratedirectus.IsSystemCollection(r.RelatedCollection) {
+					touched = append(touched, r.RelatedCollection)
+				}
+			}
+			slices.Sort(touched)
+			if touched = slices.Compact(touched); !slices.Equal(touched, tt.scope) {
+				t.Errorf("apply request touches %v, want %v", touched, tt.scope)
+			}
+		})
+	}
+}
+
+func TestMigrateScopeFixture(t *testing.T) {
+	base, target, f := newMigration(t)
+	opts := gomigratedirectus.MigrationOptions{ScopeCollections: []string{"articles"}, NoBackup: true, VerifyAfterApply: gomigratedirectus.VerifyOff}
+	if _, err := gomigratedirectus.MigrateWithOptions(context.Background(), base.Client(quiet()...), target.Client(quiet()...), opts); err != nil {
+		t.Fatalf("MigrateWithOptions: %v", err)
+	}
+
+	for _, request := range target.DiffRequests() {
+		if collections, _, _ := snapshotKeys(request); !slices.Equal(collections, []string{"articles"}) {
+			t.Errorf("diff request holds %v, want only articles", collections)
+		}
+	}
+	// The fixture diff also creates tags, which stays out of the apply.
+	applied := target.ApplyRequests()
+	if len(applied) != 1 {
+		t.Fatalf("target applied %d diffs, want 1", len(applied))
+	}
+	var want []string
+	for _, field := range f.Diff.Diff.Fields {
+		if field.Collection == "articles" {
+			want = append(want, field.Collection+"."+field.Field)
+		}
+	}
+	var got []string
+	for _, field := range applied[0].Diff.Fields {
+		got = append(got, field.Collection+"."+field.Field)
+	}
+	if len(applied[0].Diff.Collections) > 0 || len(applied[0].Diff.Relations) > 0 || !slices.Equal(got, want) {
+		t.Errorf("apply request = %+v, want only the fields %v", applied[0].Diff, want)
+	}
+
+	// Unknown names fail before anything is diffed.
+	n := len(target.DiffRequests())
+	opts.ScopeCollections = []string{"articles", "categories"}
+	_, err := gomigratedirectus.MigrateWithOptions(context.Background(), base.Client(quiet()...), target.Client(quiet()...), opts)
+	if err == nil || !strings.Contains(err.Error(), "unknown collections categories, the snapshot has: articles, authors") {
+		t.Errorf("migration scoped to an unknown collection = %v, want an error listing the collections", err)
+	}
+	if len(target.DiffRequests()) != n {
+		t.Error("migration scoped to an unknown collection sent a diff request")
+	}
+}
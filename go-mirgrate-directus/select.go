@@ -0,0 +1,119 @@
+package gomirgratedirectus
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+)
+
+// Kinds of DiffItem.
+const (
+	DiffItemCollection = "collection"
+	DiffItemField      = "field"
+	DiffItemRelation   = "relation"
+)
+
+// DiffItem is one change of a diff, to choose the changes to apply with
+// SelectDiff. Key identifies it within the diff, such as
+// "fields.articles.title".
+type DiffItem struct {
+	Key        string     `json:"key"`
+	Kind       string     `json:"kind"`
+	Collection string     `json:"collection"`
+	Field      string     `json:"field,omitempty"`
+	Change     ChangeType `json:"change"`
+}
+
+// ListDiffItems returns the changes of diff grouped by collection, in the
+// order of the collection names, with the change of the collection itself
+// first, then the fields and then the relations.
+func ListDiffItems(diff *Diff) []DiffItem {
+	if diff == nil {
+		return nil
+	}
+	var items []DiffItem
+	for _, item := range diff.Diff.Collections {
+		items = append(items, DiffItem{Key: "collections." + item.Collection, Kind: DiffItemCollection,
+			Collection: item.Collection, Change: ClassifyEntries(item.Diff)})
+	}
+	for _, item := range diff.Diff.Fields {
+		items = append(items, DiffItem{Key: "fields." + item.Collection + "." + item.Field, Kind: DiffItemField,
+			Collection: item.Collection, Field: item.Field, Change: ClassifyEntries(item.Diff)})
+	}
+	for _, item := range diff.Diff.Relations {
+		items = append(items, DiffItem{Key: "relations." + item.Collection + "." + item.Field, Kind: DiffItemRelation,
+			Collection: item.Collection, Field: item.Field, Change: ClassifyEntries(item.Diff)})
+	}
+	kinds := []string{DiffItemCollection, DiffItemField, DiffItemRelation}
+	slices.SortStableFunc(items, func(a, b DiffItem) int {
+		return cmp.Or(cmp.Compare(a.Collection, b.Collection), cmp.Compare(slices.Index(kinds, a.Kind), slices.Index(kinds, b.Kind)))
+	})
+	return items
+}
+
+// SelectDiff returns a copy of diff with only the changes whose DiffItem key
+// is in keys. The hash is kept: Directus checks it against the target schema
+// to reject stale diffs, and a subset of a diff is as fresh as the diff.
+func SelectDiff(diff *Diff, keys []string) *Diff {
+	selected := *diff
+	selected.Diff.Collections = []CollectionDiff{}
+	selected.Diff.Fields = []FieldDiff{}
+	selected.Diff.Relations = []RelationDiff{}
+	for _, item := range diff.Diff.Collections {
+		if slices.Contains(keys, "collections."+item.Collection) {
+			selected.Diff.Collections = append(selected.Diff.Collections, item)
+		}
+	}
+	for _, item := range diff.Diff.Fields {
+		if slices.Contains(keys, "fields."+item.Collection+"."+item.Field) {
+			selected.Diff.Fields = append(selected.Diff.Fields, item)
+		}
+	}
+	for _, item := range diff.Diff.Relations {
+		if slices.Contains(keys, "relations."+item.Collection+"."+item.Field) {
+			selected.Diff.Relations = append(selected.Diff.Relations, item)
+		}
+	}
+	return &selected
+}
+
+// SelectCollections returns the keys of the changes of diff to the
+// collections matching one of patterns, exact names or path.Match globs: the
+// collections themselves, their fields and the relations of their fields.
+func SelectCollections(diff *Diff, patterns []string) []string {
+	var keys []string
+	for _, item := range ListDiffItems(diff) {
+		if matchesAny(patterns, item.Collection) {
+			keys = append(keys, item.Key)
+		}
+	}
+	return keys
+}
+
+// ChooseChanges returns the keys of the changes of diff to apply to target:
+// those to the collections matching onlyCollections, all if it is empty,
+// narrowed further by choose, if set, which is called with the remaining
+// changes. It fails with ErrNotConfirmed when choose picks none.
+func ChooseChanges(ctx context.Context, target string, diff *Diff, onlyCollections []string, choose SelectFunc) ([]string, error) {
+	items := ListDiffItems(diff)
+	if len(onlyCollections) > 0 {
+		items = slices.DeleteFunc(items, func(item DiffItem) bool { return !matchesAny(onlyCollections, item.Collection) })
+	}
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+	if len(items) == 0 || choose == nil {
+		return keys, nil
+	}
+	chosen, err := choose(ctx, target, items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select changes: %w", err)
+	}
+	keys = slices.DeleteFunc(keys, func(key string) bool { return !slices.Contains(chosen, key) })
+	if len(keys) == 0 {
+		return nil, ErrNotConfirmed
+	}
+	return keys, nil
+}
@@ -0,0 +1,122 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ServerInfo describes a Directus instance as reported by /server/info.
+type ServerInfo struct {
+	// Version is the Directus version, such as "10.12.1". Directus only
+	// reports it to administrators, so it may be empty.
+	Version string `json:"version"`
+	// Vendor is the database vendor, such as "postgres", if reported.
+	Vendor string `json:"vendor"`
+}
+
+// VersionInfo retrieves the Directus version and database vendor of the
+// instance from /server/info.
+func (c *DirectusClient) VersionInfo(ctx context.Context) (_ *ServerInfo, err error) {
+	ctx, done := startOperation(ctx, "server info", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var data struct {
+		Version  string `json:"version"`
+		Directus struct {
+			Version string `json:"version"`
+		} `json:"directus"`
+		Database struct {
+			Vendor string `json:"vendor"`
+			Client string `json:"client"`
+		} `json:"database"`
+	}
+	if err := c.doJSON(ctx, "server info", http.MethodGet, "/server/info", nil, nil, &data); err != nil {
+		return nil, err
+	}
+
+	info := &ServerInfo{Version: data.Version, Vendor: data.Database.Vendor}
+	if info.Version == "" {
+		// Directus 9 nests the version.
+		info.Version = data.Directus.Version
+	}
+	if info.Vendor == "" {
+		info.Vendor = data.Database.Client
+	}
+	return info, nil
+}
+
+// VersionMismatchError is returned by CheckVersions when base and target run
+// different Directus minor versions or database vendors.
+type VersionMismatchError struct {
+	Base   ServerInfo
+	Target ServerInfo
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("version mismatch: base runs Directus %s (%s), target runs Directus %s (%s)",
+		orUnknown(e.Base.Version), orUnknown(e.Base.Vendor), orUnknown(e.Target.Version), orUnknown(e.Target.Vendor))
+}
+
+// CheckVersions compares the Directus versions and database vendors of base
+// and target. It returns a *VersionMismatchError when the major or minor
+// versions differ or both vendors are known and differ. Instances that do not
+// report a version are not compared; the returned infos tell which is which.
+func CheckVersions(ctx context.Context, base, target *DirectusClient) (baseInfo, targetInfo *ServerInfo, err error) {
+	return checkSourceVersions(ctx, ClientSource(base), target)
+}
+
+// checkSourceVersions is CheckVersions for any snapshot source.
+func checkSourceVersions(ctx context.Context, base SnapshotSource, target *DirectusClient) (baseInfo, targetInfo *ServerInfo, err error) {
+	baseInfo, err = base.ServerInfo(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get base server info: %w", err)
+	}
+	targetInfo, err = target.VersionInfo(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get target server info: %w", err)
+	}
+
+	return baseInfo, targetInfo, compareServerInfo(baseInfo, targetInfo)
+}
+
+// compareServerInfo returns a *VersionMismatchError when base and target are
+// known to be incompatible.
+func compareServerInfo(base, target *ServerInfo) error {
+	mismatch := &VersionMismatchError{Base: *base, Target: *target}
+	if base.Version != "" && target.Version != "" && minorVersion(base.Version) != minorVersion(target.Version) {
+		return mismatch
+	}
+	if base.Vendor != "" && target.Vendor != "" && base.Vendor != target.Vendor {
+		return mismatch
+	}
+	return nil
+}
+
+// minorVersion returns the "major.minor" part of a semantic version.
+func minorVersion(version string) string {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return parts[0]
+	}
+	if _, err := strconv.Atoi(parts[1]); err != nil {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// isVersionMismatchError reports whether err is a *VersionMismatchError.
+func isVersionMismatchError(err error) bool {
+	var mismatch *VersionMismatchError
+	return errors.As(err, &mismatch)
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
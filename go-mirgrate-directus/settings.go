@@ -0,0 +1,177 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+)
+
+// DefaultSettingsKeys are the project settings SyncSettings copies unless
+// configured otherwise: appearance and module configuration, but not the
+// project name, URLs or anything referencing files, which usually differ per
+// environment.
+var DefaultSettingsKeys = []string{
+	"custom_css",
+	"module_bar",
+	"basemaps",
+	"default_appearance",
+	"project_color",
+	"default_theme_light",
+	"default_theme_dark",
+	"theme_light_overrides",
+	"theme_dark_overrides",
+}
+
+// fileSettingsKeys are the settings holding the ID of a file in
+// directus_files.
+var fileSettingsKeys = []string{"project_logo", "public_foreground", "public_background", "public_favicon"}
+
+// GetSettings returns the project settings as raw JSON values by key.
+func (c *DirectusClient) GetSettings(ctx context.Context) (_ map[string]json.RawMessage, err error) {
+	ctx, done := startOperation(ctx, "get settings", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var settings map[string]json.RawMessage
+	if err := c.doJSON(ctx, "get settings", http.MethodGet, "/settings", nil, nil, &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// UpdateSettings sets the given project settings, leaving the others alone.
+func (c *DirectusClient) UpdateSettings(ctx context.Context, settings map[string]json.RawMessage) (err error) {
+	ctx, done := startOperation(ctx, "update settings", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "update settings", http.MethodPatch, "/settings", nil, settings, nil)
+}
+
+// hasFile reports whether the project has the file with the given ID.
+func (c *DirectusClient) hasFile(ctx context.Context, id string) (_ bool, err error) {
+	ctx, done := startOperation(ctx, "get file", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var file struct {
+		ID string `json:"id"`
+	}
+	err = c.doJSON(ctx, "get file", http.MethodGet, "/files/"+url.PathEscape(id), url.Values{"fields": {"id"}}, nil, &file)
+	var directusErr *DirectusError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &directusErr) && (directusErr.StatusCode == http.StatusNotFound || directusErr.StatusCode == http.StatusForbidden):
+		// Directus answers 403 for items that do not exist.
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// SettingChange is a project setting SyncSettings changed, with its value on
+// the target before and after.
+type SettingChange struct {
+	Key    string          `json:"key"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// SkippedSetting is an allowlisted setting SyncSettings did not copy.
+type SkippedSetting struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// SettingsResult is the result of SyncSettings.
+type SettingsResult struct {
+	// Changes lists the changed settings in allowlist order.
+	Changes []SettingChange  `json:"changes,omitempty"`
+	Skipped []SkippedSetting `json:"skipped,omitempty"`
+	// DryRun reports that the changes were only computed.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Changed reports whether any setting changed.
+func (r *SettingsResult) Changed() bool {
+	return len(r.Changes) > 0
+}
+
+// SyncSettings copies the project settings listed in keys, or
+// DefaultSettingsKeys if keys is empty, from base to target in a single
+// update. Settings outside the allowlist are never touched. Settings holding
+// a file, such as project_logo, are only copied if the target has a file with
+// the same ID, and skipped otherwise, as are keys the base does not have.
+// With dryRun nothing is written.
+func SyncSettings(ctx context.Context, base, target *DirectusClient, keys []string, dryRun bool) (*SettingsResult, error) {
+	if len(keys) == 0 {
+		keys = DefaultSettingsKeys
+	}
+	baseSettings, err := base.GetSettings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get base settings: %w", err)
+	}
+	targetSettings, err := target.GetSettings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get target settings: %w", err)
+	}
+
+	result := &SettingsResult{DryRun: dryRun}
+	update := map[string]json.RawMessage{}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		value, ok := baseSettings[key]
+		if !ok {
+			result.Skipped = append(result.Skipped, SkippedSetting{Key: key, Reason: "not a setting of the base"})
+			continue
+		}
+		if sameJSON(value, targetSettings[key]) {
+			continue
+		}
+		if slices.Contains(fileSettingsKeys, key) {
+			var id *string
+			if err := json.Unmarshal(value, &id); err != nil {
+				return result, fmt.Errorf("failed to decode setting %s: %w", key, err)
+			}
+			if id != nil {
+				exists, err := target.hasFile(ctx, *id)
+				if err != nil {
+					return result, fmt.Errorf("failed to look up file of setting %s: %w", key, err)
+				}
+				if !exists {
+					result.Skipped = append(result.Skipped, SkippedSetting{Key: key, Reason: "referenced file " + *id + " does not exist on the target"})
+					continue
+				}
+			}
+		}
+		result.Changes = append(result.Changes, SettingChange{Key: key, Before: targetSettings[key], After: value})
+		update[key] = value
+	}
+	if dryRun || len(update) == 0 {
+		return result, nil
+	}
+	if err := target.UpdateSettings(ctx, update); err != nil {
+		return result, fmt.Errorf("failed to update target settings: %w", err)
+	}
+	return result, nil
+}
+
+// sameJSON reports whether two JSON values are equal, treating a missing
+// value as null.
+func sameJSON(a, b json.RawMessage) bool {
+	var ga, gb any
+	if len(a) > 0 && json.Unmarshal(a, &ga) != nil {
+		return false
+	}
+	if len(b) > 0 && json.Unmarshal(b, &gb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(ga, gb)
+}
@@ -0,0 +1,407 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SnapshotFormatVersion is the snapshot format version written by Directus
+// 9 to 11, the only one LoadSnapshot accepts.
+const SnapshotFormatVersion = 1
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// SnapshotFormatFromPath returns the snapshot format implied by the extension
+// of path, ignoring a .gz suffix: FormatYAML for .yaml and .yml, FormatJSON
+// otherwise.
+func SnapshotFormatFromPath(path string) string {
+	if isGzipPath(path) {
+		path = path[:len(path)-len(".gz")]
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	default:
+		return FormatJSON
+	}
+}
+
+// isGzipPath reports whether path names a gzip-compressed file.
+func isGzipPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".gz")
+}
+
+// SaveOptions configures SaveSnapshotWithOptions.
+type SaveOptions struct {
+	// NoNormalize writes the collections, fields and relations in the order
+	// of snapshot instead of normalizing it with NormalizeSnapshot.
+	NoNormalize bool
+	// Normalize configures the normalization, such as keys to strip.
+	Normalize NormalizeOptions
+	// Checksum writes the SnapshotHash of the snapshot to the checksum file
+	// next to it, see WriteSnapshotWithChecksum. Otherwise a checksum file
+	// left by an earlier save is removed, as it would no longer match.
+	Checksum bool
+}
+
+// SaveSnapshot writes snapshot to path as JSON or YAML depending on the
+// extension, gzip-compressed if path ends in .gz as in schema.yaml.gz. The
+// snapshot is normalized with NormalizeSnapshot, the output is indented and
+// all object keys are sorted, so that snapshots kept in version control
+// produce clean diffs. The file is replaced atomically.
+func SaveSnapshot(path string, snapshot *Snapshot) error {
+	return SaveSnapshotWithOptions(path, snapshot, SaveOptions{})
+}
+
+// SaveSnapshotWithOptions saves snapshot like SaveSnapshot, normalized as
+// opts says.
+func SaveSnapshotWithOptions(path string, snapshot *Snapshot, opts SaveOptions) error {
+	if err := opts.Normalize.Validate(); err != nil {
+		return err
+	}
+	if !opts.NoNormalize {
+		snapshot = NormalizeSnapshotWithOptions(snapshot, opts.Normalize)
+	}
+	data, err := EncodeSnapshot(snapshot, SnapshotFormatFromPath(path))
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := WriteSnapshotFile(path, data); err != nil {
+		return err
+	}
+	if opts.Checksum {
+		return WriteChecksum(path, snapshot)
+	}
+	if err := os.Remove(ChecksumPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale snapshot checksum: %w", err)
+	}
+	return nil
+}
+
+// WriteSnapshotFile atomically replaces the file at path with data, an
+// encoded snapshot, streamed through gzip when path ends in .gz.
+func WriteSnapshotFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	var w io.Writer = tmp
+	var zw *gzip.Writer
+	if isGzipPath(path) {
+		zw = gzip.NewWriter(tmp)
+		zw.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		w = zw
+	}
+	if _, err := w.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to save snapshot: %w", err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return nil
+}
+
+// EncodeSnapshot renders snapshot in format, FormatJSON or FormatYAML, as
+// SaveSnapshot writes it, without normalizing it first.
+func EncodeSnapshot(snapshot *Snapshot, format string) ([]byte, error) {
+	format, err := normalizeFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	return encodeSnapshot(snapshot, format)
+}
+
+// encodeSnapshot renders snapshot with sorted keys by round-tripping it
+// through generic maps, which both encoders sort.
+func encodeSnapshot(snapshot *Snapshot, format string) ([]byte, error) {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	if format == FormatYAML {
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(jsonNumbersToYAML(doc)); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// jsonNumbersToYAML replaces json.Number values, which YAML would quote as
+// strings, with integers or floats.
+func jsonNumbersToYAML(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = jsonNumbersToYAML(value)
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = jsonNumbersToYAML(value)
+		}
+		return v
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// LoadOptions configures LoadSnapshotWithOptions.
+type LoadOptions struct {
+	// SkipVerify loads the snapshot even if it does not match its checksum
+	// file.
+	SkipVerify bool
+	// Repository is the location of the SnapshotRepository env@tag
+	// references are resolved in, DefaultSnapshotRepository by default.
+	Repository string
+	// Substitute replaces the ${NAME} placeholders of the snapshot with
+	// SubstitutePlaceholders, from Vars or the process environment, after
+	// the checksum is verified.
+	Substitute bool
+	Vars       map[string]string
+}
+
+// substitute applies the placeholder substitution of opts to snapshot,
+// loaded from path.
+func (opts LoadOptions) substitute(path string, snapshot *Snapshot) (*Snapshot, error) {
+	if !opts.Substitute {
+		return snapshot, nil
+	}
+	substituted, err := SubstitutePlaceholders(snapshot, opts.Vars)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot file %s: %w", path, err)
+	}
+	return substituted, nil
+}
+
+// LoadSnapshot reads a snapshot saved by SaveSnapshot or exported by
+// Directus, as JSON or YAML depending on the extension of path and
+// decompressing gzip files whatever their extension. Files that
+// are corrupt, are not snapshots or use another format version are rejected
+// with an error naming the file and the problem. A snapshot with a checksum
+// file, as written by WriteSnapshotWithChecksum, must match it or
+// ErrChecksumMismatch is returned.
+//
+// A path that is not a file but an env@tag reference, such as prod@latest,
+// loads that snapshot of the DefaultSnapshotRepository.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	return LoadSnapshotWithOptions(path, LoadOptions{})
+}
+
+// LoadSnapshotWithOptions reads a snapshot like LoadSnapshot, skipping the
+// checksum verification with opts.SkipVerify, resolving references in
+// opts.Repository and substituting placeholders with opts.Substitute.
+func LoadSnapshotWithOptions(path string, opts LoadOptions) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && IsSnapshotRef(path) {
+		location := opts.Repository
+		if location == "" {
+			location = DefaultSnapshotRepository
+		}
+		repo, err := OpenSnapshotRepository(location)
+		if err != nil {
+			return nil, err
+		}
+		snapshot, _, err := repo.Load(context.Background(), path, opts)
+		if err != nil {
+			return nil, err
+		}
+		return opts.substitute(path, snapshot)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	snapshot, err := decodeSnapshotFile(path, data)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.SkipVerify {
+		if err := verifyChecksum(path, snapshot, false); err != nil {
+			return nil, err
+		}
+	}
+	return opts.substitute(path, snapshot)
+}
+
+// decodeSnapshotFile decodes data, the content of the snapshot file path,
+// and checks that it is a snapshot of the supported format version.
+func decodeSnapshotFile(path string, data []byte) (*Snapshot, error) {
+	var err error
+	// Compressed files are recognized by their content, so that a renamed
+	// archive still loads.
+	if bytes.HasPrefix(data, gzipMagic) {
+		if data, err = decompressSnapshot(data); err != nil {
+			return nil, fmt.Errorf("snapshot file %s is not a valid gzip file: %w", path, err)
+		}
+	}
+
+	snapshot, err := ParseSnapshot(data, SnapshotFormatFromPath(path))
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line, column := position(data, syntaxErr.Offset)
+			return nil, fmt.Errorf("snapshot file %s is not valid JSON at line %d, column %d: %w", path, line, column, err)
+		}
+		return nil, fmt.Errorf("snapshot file %s is corrupt: %w", path, err)
+	}
+
+	switch {
+	case snapshot.Version == 0 && snapshot.Directus == "" && snapshot.Collections == nil:
+		return nil, fmt.Errorf("snapshot file %s does not look like a Directus schema snapshot, it has no version, directus or collections key", path)
+	case snapshot.Version != SnapshotFormatVersion:
+		return nil, fmt.Errorf("snapshot file %s has format version %d, only version %d is supported; export it again with a matching Directus version",
+			path, snapshot.Version, SnapshotFormatVersion)
+	}
+	return snapshot, nil
+}
+
+// decompressSnapshot returns the content of the gzip file data.
+func decompressSnapshot(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// position converts the offset of a json.SyntaxError, which counts the
+// offending byte, to a 1-based line and column.
+func position(data []byte, offset int64) (line, column int) {
+	index := int(min(max(offset-1, 0), int64(len(data))))
+	before := data[:index]
+	line = bytes.Count(before, []byte("\n")) + 1
+	column = index - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// SnapshotSource provides the base schema of a migration, see
+// MigrationOptions.Source.
+type SnapshotSource interface {
+	// Snapshot returns the schema snapshot.
+	Snapshot(ctx context.Context) (*Snapshot, error)
+	// ServerInfo returns the version and database vendor the snapshot was
+	// taken from, for the pre-flight version check.
+	ServerInfo(ctx context.Context) (*ServerInfo, error)
+	// String describes the source in logs, such as its URL.
+	String() string
+}
+
+// ClientSource returns a SnapshotSource that takes the snapshot from a live
+// project. It is what MigrateWithOptions uses for its base client.
+func ClientSource(client *DirectusClient) SnapshotSource {
+	return clientSource{client}
+}
+
+type clientSource struct {
+	client *DirectusClient
+}
+
+func (s clientSource) Snapshot(ctx context.Context) (*Snapshot, error) {
+	return s.client.GetSnapshot(ctx)
+}
+
+func (s clientSource) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	return s.client.VersionInfo(ctx)
+}
+
+func (s clientSource) String() string {
+	return RedactURL(s.client.URL)
+}
+
+// FileSource returns a SnapshotSource that loads the snapshot at path with
+// LoadSnapshot. The version check uses the Directus version and database
+// vendor recorded in the file.
+func FileSource(path string) SnapshotSource {
+	return FileSourceWithOptions(path, LoadOptions{})
+}
+
+// FileSourceWithOptions returns a FileSource that loads the snapshot with
+// LoadSnapshotWithOptions. The file is loaded once, on the first call to
+// Snapshot.
+func FileSourceWithOptions(path string, opts LoadOptions) SnapshotSource {
+	return &fileSource{path: path, opts: opts}
+}
+
+type fileSource struct {
+	path     string
+	opts     LoadOptions
+	snapshot *Snapshot
+}
+
+func (s *fileSource) Snapshot(context.Context) (*Snapshot, error) {
+	if s.snapshot == nil {
+		snapshot, err := LoadSnapshotWithOptions(s.path, s.opts)
+		if err != nil {
+			return nil, err
+		}
+		s.snapshot = snapshot
+	}
+	return s.snapshot, nil
+}
+
+func (s *fileSource) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	snapshot, err := s.Snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &ServerInfo{Version: snapshot.Directus, Vendor: snapshot.Vendor}, nil
+}
+
+func (s *fileSource) String() string {
+	return s.path
+}
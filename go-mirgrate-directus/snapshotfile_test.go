@@ -0,0 +1,118 @@
+package gomirgratedirectus_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// saveCompressed saves the snapshot of testdata/normalize/ordered.json to a
+// temporary file name and returns the snapshot as saved and the file.
+func saveCompressed(t *testing.T, name string) (*gomigratedirectus.Snapshot, string) {
+	t.Helper()
+	s, err := gomigratedirectus.LoadSnapshot(filepath.Join("testdata", "normalize", "ordered.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := gomigratedirectus.SaveSnapshot(path, s); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	return gomigratedirectus.NormalizeSnapshot(s), path
+}
+
+func TestCompressedSnapshotRoundTrip(t *testing.T) {
+	for _, name := range []string{"schema.json.gz", "schema.yaml.gz", "schema.yml.GZ"} {
+		t.Run(name, func(t *testing.T) {
+			want, path := saveCompressed(t, name)
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			zr, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatalf("saved file is not gzip-compressed: %v", err)
+			}
+			if wantName := strings.TrimSuffix(name, filepath.Ext(name)); zr.Name != wantName {
+				t.Errorf("gzip header name = %q, want %q", zr.Name, wantName)
+			}
+			data, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			format := gomigratedirectus.SnapshotFormatFromPath(path)
+			if encoded, err := gomigratedirectus.EncodeSnapshot(want, format); err != nil || !bytes.Equal(data, encoded) {
+				t.Errorf("decompressed file differs from the encoded snapshot (%v):\n%s\nwant:\n%s", err, data, encoded)
+			}
+
+			got, err := gomigratedirectus.LoadSnapshot(path)
+			if err != nil {
+				t.Fatalf("LoadSnapshot: %v", err)
+			}
+			if !reflect.DeepEqual(gomigratedirectus.NormalizeSnapshot(got), want) {
+				t.Errorf("loaded snapshot = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCompressedSnapshotRenamed(t *testing.T) {
+	want, path := saveCompressed(t, "schema.json.gz")
+	renamed := filepath.Join(filepath.Dir(path), "schema.json")
+	if err := os.Rename(path, renamed); err != nil {
+		t.Fatal(err)
+	}
+	got, err := gomigratedirectus.LoadSnapshot(renamed)
+	if err != nil {
+		t.Fatalf("LoadSnapshot of a renamed archive: %v", err)
+	}
+	if !reflect.DeepEqual(gomigratedirectus.NormalizeSnapshot(got), want) {
+		t.Errorf("loaded snapshot = %+v, want %+v", got, want)
+	}
+}
+
+func TestCompressedSnapshotCorrupt(t *testing.T) {
+	_, path := saveCompressed(t, "schema.json.gz")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	badCRC := bytes.Clone(data)
+	badCRC[len(badCRC)-8] ^= 0xff
+	for _, tt := range []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"truncated header", data[:5], nil},
+		{"truncated body", data[:len(data)/2], io.ErrUnexpectedEOF},
+		{"truncated trailer", data[:len(data)-4], io.ErrUnexpectedEOF},
+		{"checksum mismatch", badCRC, gzip.ErrChecksum},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			corrupt := filepath.Join(t.TempDir(), "schema.json.gz")
+			if err := os.WriteFile(corrupt, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := gomigratedirectus.LoadSnapshot(corrupt)
+			if err == nil {
+				t.Fatal("LoadSnapshot of a corrupt archive succeeded")
+			}
+			if !strings.Contains(err.Error(), "is not a valid gzip file") {
+				t.Errorf("error = %v, want it to say the file is not a valid gzip file", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,488 @@
+package gomirgratedirectus
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// SQLDialect is a database dialect of RenderDiffSQL.
+type SQLDialect string
+
+// Dialects of RenderDiffSQL.
+const (
+	DialectPostgres SQLDialect = "postgres"
+	DialectMySQL    SQLDialect = "mysql"
+	DialectSQLite   SQLDialect = "sqlite"
+)
+
+// DialectForVendor returns the dialect of RenderDiffSQL for a database
+// vendor as reported by Directus, such as Snapshot.Vendor, and reports false
+// for vendors it has no dialect for.
+func DialectForVendor(vendor string) (SQLDialect, bool) {
+	switch vendor {
+	case "postgres", "cockroachdb", "redshift":
+		return DialectPostgres, true
+	case "mysql", "mariadb":
+		return DialectMySQL, true
+	case "sqlite", "sqlite3":
+		return DialectSQLite, true
+	}
+	return "", false
+}
+
+// sqlColumnTypes maps Directus field types to column types per dialect, in
+// the spirit of the types Directus creates. %d in a type is replaced by the
+// length of the column, %d,%d by its precision and scale.
+var sqlColumnTypes = map[SQLDialect]map[string]string{
+	DialectPostgres: {
+		"string": "varchar(%d)", "text": "text", "uuid": "uuid", "hash": "varchar(255)", "csv": "text",
+		"integer": "integer", "bigInteger": "bigint", "float": "real", "decimal": "numeric(%d,%d)",
+		"boolean": "boolean", "timestamp": "timestamp with time zone", "dateTime": "timestamp without time zone",
+		"date": "date", "time": "time without time zone", "json": "json", "binary": "bytea", "geometry": "geometry",
+	},
+	DialectMySQL: {
+		"string": "varchar(%d)", "text": "text", "uuid": "char(36)", "hash": "varchar(255)", "csv": "text",
+		"integer": "int", "bigInteger": "bigint", "float": "float", "decimal": "decimal(%d,%d)",
+		"boolean": "boolean", "timestamp": "timestamp", "dateTime": "datetime",
+		"date": "date", "time": "time", "json": "json", "binary": "blob", "geometry": "geometry",
+	},
+	DialectSQLite: {
+		"string": "varchar(%d)", "text": "text", "uuid": "char(36)", "hash": "varchar(255)", "csv": "text",
+		"integer": "integer", "bigInteger": "bigint", "float": "float", "decimal": "decimal(%d,%d)",
+		"boolean": "boolean", "timestamp": "datetime", "dateTime": "datetime",
+		"date": "date", "time": "time", "json": "json", "binary": "blob", "geometry": "geometry",
+	},
+}
+
+// RenderDiffSQL writes to w an illustrative preview, in dialect, of the DDL
+// that applying diff runs: CREATE TABLE and DROP TABLE for collections, ADD,
+// DROP and ALTER COLUMN for fields, and foreign keys for relations. Directus
+// generates the real statements itself, so the preview is labeled as such
+// and meant for review only. Changes to meta, which only live in the
+// directus_* tables, are noted in comments, as are changes that the dialect
+// cannot make in place, such as altering a SQLite column.
+func RenderDiffSQL(diff *Diff, w io.Writer, dialect SQLDialect) error {
+	types, ok := sqlColumnTypes[dialect]
+	if !ok {
+		return fmt.Errorf("unknown SQL dialect %q, expected postgres, mysql or sqlite", dialect)
+	}
+	r := &sqlRenderer{w: bufio.NewWriter(w), dialect: dialect, types: types}
+	fmt.Fprintf(r.w, "-- Preview of the %s DDL for this diff, for review only.\n", dialect)
+	r.w.WriteString("-- Directus generates and runs the real statements when the diff is applied.\n")
+
+	// Foreign keys are dropped before the tables they reference and added
+	// once every table exists.
+	groups := groupDiff(diff)
+	for _, group := range groups {
+		if group.change() == ChangeDeleted {
+			continue
+		}
+		for _, relation := range group.relations {
+			if ClassifyEntries(relation.Diff) == ChangeDeleted {
+				r.relation(r.ident(group.name), relation)
+			}
+		}
+	}
+	for _, group := range groups {
+		if group.collection == nil && len(group.fields) == 0 {
+			continue
+		}
+		r.w.WriteString("\n")
+		table := r.ident(group.name)
+		switch group.change() {
+		case ChangeCreated:
+			r.createTable(group)
+		case ChangeDeleted:
+			fmt.Fprintf(r.w, "DROP TABLE %s;\n", table)
+		default:
+			if group.collection != nil {
+				if slices.ContainsFunc(group.collection.Diff, isSchemaEntry) {
+					r.comment("collection %s: schema changes, not previewed", group.name)
+				} else {
+					r.comment("collection %s: meta changes only", group.name)
+				}
+			}
+			for _, field := range group.fields {
+				r.field(table, field)
+			}
+		}
+	}
+	var added bool
+	for _, group := range groups {
+		for _, relation := range group.relations {
+			if change := ClassifyEntries(relation.Diff); change != ChangeDeleted {
+				if !added {
+					r.w.WriteString("\n")
+					added = true
+				}
+				r.relation(r.ident(group.name), relation)
+			}
+		}
+	}
+	return r.w.Flush()
+}
+
+// change classifies the changes of the collection of g, which is updated
+// when only its fields or relations change.
+func (g *diffGroup) change() ChangeType {
+	if g.collection == nil {
+		return ChangeUpdated
+	}
+	return ClassifyEntries(g.collection.Diff)
+}
+
+// sqlRenderer writes the statements of RenderDiffSQL.
+type sqlRenderer struct {
+	w       *bufio.Writer
+	dialect SQLDialect
+	types   map[string]string
+}
+
+func (r *sqlRenderer) comment(format string, args ...any) {
+	fmt.Fprintf(r.w, "-- %s\n", strings.ReplaceAll(fmt.Sprintf(format, args...), "\n", " "))
+}
+
+// ident quotes a table or column name.
+func (r *sqlRenderer) ident(name string) string {
+	if r.dialect == DialectMySQL {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// createTable writes the CREATE TABLE of a created collection with the
+// columns of its created fields, primary key first.
+func (r *sqlRenderer) createTable(group *diffGroup) {
+	var collection Collection
+	if err := json.Unmarshal(group.collection.Diff[0].Rhs, &collection); err == nil && collection.Schema == nil {
+		r.comment("collection %s is a folder without a table", group.name)
+		return
+	}
+	fields := slices.Clone(group.fields)
+	slices.SortStableFunc(fields, func(a, b FieldDiff) int {
+		pa, pb := isPrimaryKeyDiff(a), isPrimaryKeyDiff(b)
+		switch {
+		case pa && !pb:
+			return -1
+		case pb && !pa:
+			return 1
+		}
+		return 0
+	})
+	var columns, keys []string
+	for _, item := range fields {
+		field, ok := createdField(item)
+		if !ok {
+			continue
+		}
+		if !hasColumn(field) {
+			r.comment("field %s.%s is an alias without a column", field.Collection, field.Field)
+			continue
+		}
+		columns = append(columns, "  "+r.column(field))
+		if isPrimaryKeyField(field) && !(r.dialect == DialectSQLite && isAutoIncrement(field)) {
+			keys = append(keys, r.ident(field.Field))
+		}
+	}
+	if len(keys) > 0 {
+		columns = append(columns, "  PRIMARY KEY ("+strings.Join(keys, ", ")+")")
+	}
+	if len(columns) == 0 {
+		r.comment("collection %s is created without columns", group.name)
+		return
+	}
+	fmt.Fprintf(r.w, "CREATE TABLE %s (\n%s\n);\n", r.ident(group.name), strings.Join(columns, ",\n"))
+}
+
+// field writes the statements of a field of an existing collection.
+func (r *sqlRenderer) field(table string, item FieldDiff) {
+	name := item.Collection + "." + item.Field
+	column := r.ident(item.Field)
+	switch ClassifyEntries(item.Diff) {
+	case ChangeCreated:
+		field, ok := createdField(item)
+		switch {
+		case !ok:
+			r.comment("field %s is created with an unknown definition", name)
+		case !hasColumn(field):
+			r.comment("field %s is an alias without a column", name)
+		default:
+			fmt.Fprintf(r.w, "ALTER TABLE %s ADD COLUMN %s;\n", table, r.column(field))
+		}
+		return
+	case ChangeDeleted:
+		var field Field
+		if err := json.Unmarshal(item.Diff[0].Lhs, &field); err == nil && !hasColumn(field) {
+			r.comment("field %s is an alias without a column", name)
+			return
+		}
+		fmt.Fprintf(r.w, "ALTER TABLE %s DROP COLUMN %s;\n", table, column)
+		return
+	}
+
+	// An updated field only changes its column through type and schema.
+	changes := map[string]*DiffEntry{}
+	for i := range item.Diff {
+		entry := &item.Diff[i]
+		if entry.Kind == KindArray && entry.Item != nil {
+			entry = entry.Item
+		}
+		switch {
+		case len(item.Diff[i].Path) == 1 && item.Diff[i].Path[0] == "type":
+			changes["type"] = entry
+		case len(item.Diff[i].Path) == 2 && item.Diff[i].Path[0] == "schema":
+			if key, ok := item.Diff[i].Path[1].(string); ok {
+				changes[key] = entry
+			}
+		}
+	}
+	if len(changes) == 0 {
+		r.comment("field %s: meta changes only", name)
+		return
+	}
+
+	if changes["type"] != nil || changes["max_length"] != nil || changes["numeric_precision"] != nil || changes["numeric_scale"] != nil {
+		field := Field{Collection: item.Collection, Field: item.Field, Schema: map[string]any{}}
+		if entry := changes["type"]; entry != nil {
+			json.Unmarshal(entry.Rhs, &field.Type)
+		}
+		for _, key := range []string{"max_length", "numeric_precision", "numeric_scale"} {
+			if entry := changes[key]; entry != nil {
+				var value any
+				json.Unmarshal(entry.Rhs, &value)
+				field.Schema[key] = value
+			}
+		}
+		// A size change alone leaves the type out of the diff; only strings
+		// have a length and only decimals a precision.
+		if field.Type == "" {
+			field.Type = "decimal"
+			if changes["max_length"] != nil {
+				field.Type = "string"
+			}
+		}
+		switch {
+		case r.dialect == DialectPostgres:
+			fmt.Fprintf(r.w, "ALTER TABLE %s ALTER COLUMN %s TYPE %s;\n", table, column, r.columnType(field))
+		case r.dialect == DialectMySQL:
+			fmt.Fprintf(r.w, "ALTER TABLE %s MODIFY COLUMN %s %s; -- repeat NOT NULL and DEFAULT, which MODIFY resets\n", table, column, r.columnType(field))
+		default:
+			r.comment("field %s changes type to %s; SQLite cannot alter a column, Directus recreates the table", name, r.columnType(field))
+		}
+	}
+
+	if entry := changes["is_nullable"]; entry != nil {
+		var nullable bool
+		json.Unmarshal(entry.Rhs, &nullable)
+		clause := "SET NOT NULL"
+		if nullable {
+			clause = "DROP NOT NULL"
+		}
+		switch r.dialect {
+		case DialectPostgres:
+			fmt.Fprintf(r.w, "ALTER TABLE %s ALTER COLUMN %s %s;\n", table, column, clause)
+		case DialectMySQL:
+			r.comment("field %s: MODIFY COLUMN with the full definition to %s", name, strings.ToLower(clause))
+		default:
+			r.comment("field %s: SQLite cannot %s, Directus recreates the table", name, strings.ToLower(clause))
+		}
+	}
+
+	if entry := changes["default_value"]; entry != nil {
+		value := sqlLiteral(entry.Rhs)
+		switch {
+		case r.dialect == DialectSQLite:
+			r.comment("field %s: SQLite cannot change a default, Directus recreates the table", name)
+		case value == "":
+			fmt.Fprintf(r.w, "ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT;\n", table, column)
+		default:
+			fmt.Fprintf(r.w, "ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s;\n", table, column, value)
+		}
+	}
+
+	if entry := changes["is_unique"]; entry != nil {
+		var unique bool
+		json.Unmarshal(entry.Rhs, &unique)
+		index := r.ident(item.Collection + "_" + item.Field + "_unique")
+		switch {
+		case unique:
+			fmt.Fprintf(r.w, "CREATE UNIQUE INDEX %s ON %s (%s);\n", index, table, column)
+		case r.dialect == DialectMySQL:
+			fmt.Fprintf(r.w, "DROP INDEX %s ON %s;\n", index, table)
+		default:
+			fmt.Fprintf(r.w, "DROP INDEX %s;\n", index)
+		}
+	}
+
+	for _, key := range []string{"is_primary_key", "has_auto_increment", "foreign_key_table", "foreign_key_column", "comment"} {
+		if changes[key] != nil {
+			r.comment("field %s: schema.%s changes, not previewed", name, key)
+		}
+	}
+}
+
+// relation writes the foreign key statements of a relation.
+func (r *sqlRenderer) relation(table string, item RelationDiff) {
+	name := item.Collection + "." + item.Field
+	change := ClassifyEntries(item.Diff)
+	if change == ChangeUpdated {
+		if slices.ContainsFunc(item.Diff, isSchemaEntry) {
+			r.comment("relation %s: the foreign key changes, Directus drops and adds it again", name)
+			return
+		}
+		r.comment("relation %s: meta changes only", name)
+		return
+	}
+
+	raw := item.Diff[0].Rhs
+	if change == ChangeDeleted {
+		raw = item.Diff[0].Lhs
+	}
+	var relation Relation
+	if err := json.Unmarshal(raw, &relation); err != nil || relation.Schema == nil {
+		r.comment("relation %s has no foreign key", name)
+		return
+	}
+	constraint, _ := relation.Schema["constraint_name"].(string)
+	if constraint == "" {
+		constraint = item.Collection + "_" + item.Field + "_foreign"
+	}
+	if change == ChangeDeleted {
+		switch r.dialect {
+		case DialectSQLite:
+			r.comment("relation %s: SQLite cannot drop a foreign key, Directus recreates the table", name)
+		case DialectMySQL:
+			fmt.Fprintf(r.w, "ALTER TABLE %s DROP FOREIGN KEY %s;\n", table, r.ident(constraint))
+		default:
+			fmt.Fprintf(r.w, "ALTER TABLE %s DROP CONSTRAINT %s;\n", table, r.ident(constraint))
+		}
+		return
+	}
+	if r.dialect == DialectSQLite {
+		r.comment("relation %s: SQLite cannot add a foreign key, Directus recreates the table", name)
+		return
+	}
+	referenced, _ := relation.Schema["foreign_key_column"].(string)
+	if referenced == "" {
+		referenced = "id"
+	}
+	fmt.Fprintf(r.w, "ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)", table, r.ident(constraint),
+		r.ident(relation.Field), r.ident(relation.RelatedCollection), r.ident(referenced))
+	for _, action := range []string{"on_delete", "on_update"} {
+		if value, _ := relation.Schema[action].(string); value != "" {
+			fmt.Fprintf(r.w, " %s %s", strings.ToUpper(strings.ReplaceAll(action, "_", " ")), value)
+		}
+	}
+	r.w.WriteString(";\n")
+}
+
+// column returns the definition of the column of field.
+func (r *sqlRenderer) column(field Field) string {
+	def := r.ident(field.Field) + " " + r.columnType(field)
+	if isAutoIncrement(field) {
+		switch r.dialect {
+		case DialectPostgres:
+			def += " GENERATED BY DEFAULT AS IDENTITY"
+		case DialectMySQL:
+			def += " AUTO_INCREMENT"
+		case DialectSQLite:
+			return r.ident(field.Field) + " integer PRIMARY KEY AUTOINCREMENT"
+		}
+	}
+	if nullable, ok := field.Schema["is_nullable"].(bool); (ok && !nullable) || isPrimaryKeyField(field) {
+		def += " NOT NULL"
+	}
+	if value := sqlLiteral(mustMarshal(field.Schema["default_value"])); value != "" {
+		def += " DEFAULT " + value
+	}
+	if unique, _ := field.Schema["is_unique"].(bool); unique && !isPrimaryKeyField(field) {
+		def += " UNIQUE"
+	}
+	return def
+}
+
+// columnType returns the column type of field, using its length, precision
+// and scale if known.
+func (r *sqlRenderer) columnType(field Field) string {
+	typ, ok := r.types[field.Type]
+	if !ok {
+		if dataType, _ := field.Schema["data_type"].(string); dataType != "" {
+			return dataType
+		}
+		return "text"
+	}
+	switch strings.Count(typ, "%d") {
+	case 1:
+		return fmt.Sprintf(typ, schemaInt(field.Schema["max_length"], 255))
+	case 2:
+		return fmt.Sprintf(typ, schemaInt(field.Schema["numeric_precision"], 10), schemaInt(field.Schema["numeric_scale"], 5))
+	}
+	return typ
+}
+
+// isSchemaEntry reports whether entry changes the schema of an item rather
+// than its meta.
+func isSchemaEntry(entry DiffEntry) bool {
+	return len(entry.Path) > 0 && entry.Path[0] == "schema"
+}
+
+// isPrimaryKeyDiff reports whether item creates a primary key.
+func isPrimaryKeyDiff(item FieldDiff) bool {
+	field, ok := createdField(item)
+	return ok && isPrimaryKeyField(field)
+}
+
+// createdField decodes the field that item creates.
+func createdField(item FieldDiff) (Field, bool) {
+	if ClassifyEntries(item.Diff) != ChangeCreated {
+		return Field{}, false
+	}
+	var field Field
+	if err := json.Unmarshal(item.Diff[0].Rhs, &field); err != nil {
+		return Field{}, false
+	}
+	return field, true
+}
+
+func isAutoIncrement(field Field) bool {
+	autoIncrement, _ := field.Schema["has_auto_increment"].(bool)
+	return autoIncrement
+}
+
+// schemaInt returns value, a number from the schema of a field, or fallback.
+func schemaInt(value any, fallback int) int {
+	if n, ok := value.(float64); ok && n > 0 {
+		return int(n)
+	}
+	return fallback
+}
+
+// sqlLiteral returns the SQL literal of a default value, or "" for none.
+func sqlLiteral(raw json.RawMessage) string {
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return ""
+	}
+	switch value := value.(type) {
+	case string:
+		if strings.EqualFold(value, "CURRENT_TIMESTAMP") || strings.EqualFold(value, "now()") {
+			return "CURRENT_TIMESTAMP"
+		}
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	case float64:
+		return string(raw)
+	case bool:
+		if value {
+			return "TRUE"
+		}
+		return "FALSE"
+	case nil:
+		return ""
+	default:
+		return "'" + strings.ReplaceAll(string(raw), "'", "''") + "'"
+	}
+}
@@ -0,0 +1,168 @@
+package gomirgratedirectus
+
+import "time"
+
+// PhaseStats is the time a phase of a migration took and the size of what it
+// transferred.
+type PhaseStats struct {
+	Phase           string        `json:"phase"`
+	Duration        time.Duration `json:"-"`
+	DurationSeconds float64       `json:"duration_seconds"`
+	// Bytes is the size of the bodies sent and received by the phase: the
+	// snapshot received for PhaseSnapshot, the snapshot sent and the diff
+	// received for PhaseDiff and the diff sent for PhaseApply. It is zero
+	// for the other phases.
+	Bytes int64 `json:"bytes,omitempty"`
+	// Failed is set when the migration failed in the phase.
+	Failed bool `json:"failed,omitempty"`
+}
+
+// MigrationStats holds the timings and sizes of a migration, see
+// MigrationResult.Stats. The Prometheus metrics of MigrationOptions.Metrics
+// are observed from them.
+type MigrationStats struct {
+	// Phases lists the phases that ran, in the order they finished.
+	Phases []PhaseStats `json:"phases"`
+	// DiffEntries counts the collections, fields and relations changed by
+	// the diff.
+	DiffEntries int `json:"diff_entries"`
+	// Duration is the time the whole migration took and Bytes the sum of
+	// the bytes of the phases.
+	Duration        time.Duration `json:"-"`
+	DurationSeconds float64       `json:"duration_seconds"`
+	Bytes           int64         `json:"bytes"`
+}
+
+// Phase returns the stats of phase, and false if it did not run.
+func (s *MigrationStats) Phase(phase string) (PhaseStats, bool) {
+	for _, p := range s.Phases {
+		if p.Phase == phase {
+			return p, true
+		}
+	}
+	return PhaseStats{}, false
+}
+
+// statsRecorder builds the MigrationStats of one migration from its events.
+type statsRecorder struct {
+	stats   *MigrationStats
+	started map[string]time.Time
+	begun   time.Time
+}
+
+// newStatsRecorder returns a recorder filling stats.
+func newStatsRecorder(stats *MigrationStats) *statsRecorder {
+	return &statsRecorder{stats: stats, started: map[string]time.Time{}, begun: time.Now()}
+}
+
+// handle records the phase event starts or finishes. It returns the stats of
+// the phase it finished, if any.
+func (r *statsRecorder) handle(event Event) *PhaseStats {
+	switch e := event.(type) {
+	case *VersionCheckStarted:
+		r.start(PhaseVersionCheck, e.Time)
+	case *VersionCheckCompleted:
+		return r.stop(PhaseVersionCheck, e.Time, 0, false)
+	case *SnapshotStarted:
+		r.start(PhaseSnapshot, e.Time)
+	case *SnapshotCompleted:
+		return r.stop(PhaseSnapshot, e.Time, e.Bytes, false)
+	case *DiffStarted:
+		r.start(PhaseDiff, e.Time)
+	case *DiffComputed:
+		if e.Diff != nil {
+			r.stats.DiffEntries = len(e.Diff.Diff.Collections) + len(e.Diff.Diff.Fields) + len(e.Diff.Diff.Relations)
+		}
+		return r.stop(PhaseDiff, e.Time, e.Bytes, false)
+	case *BackupStarted:
+		r.start(PhaseBackup, e.Time)
+	case *BackupCompleted:
+		return r.stop(PhaseBackup, e.Time, 0, false)
+	case *ApplyStarted:
+		r.start(PhaseApply, e.Time)
+	case *ApplyCompleted:
+		return r.stop(PhaseApply, e.Time, e.Bytes, false)
+	case *VerifyStarted:
+		r.start(PhaseVerify, e.Time)
+	case *VerifyCompleted:
+		return r.stop(PhaseVerify, e.Time, 0, false)
+	case *FilesSyncStarted:
+		r.start(PhaseFiles, e.Time)
+	case *FilesSynced:
+		return r.stop(PhaseFiles, e.Time, 0, false)
+	case *DataSyncStarted:
+		r.start(PhaseData, e.Time)
+	case *DataSynced:
+		return r.stop(PhaseData, e.Time, 0, false)
+	case *PermissionsSyncStarted:
+		r.start(PhasePermissions, e.Time)
+	case *PermissionsSynced:
+		return r.stop(PhasePermissions, e.Time, 0, false)
+	case *UsersSyncStarted:
+		r.start(PhaseUsers, e.Time)
+	case *UsersSynced:
+		return r.stop(PhaseUsers, e.Time, 0, false)
+	case *PresetsSyncStarted:
+		r.start(PhasePresets, e.Time)
+	case *PresetsSynced:
+		return r.stop(PhasePresets, e.Time, 0, false)
+	case *TranslationsSyncStarted:
+		r.start(PhaseTranslations, e.Time)
+	case *TranslationsSynced:
+		return r.stop(PhaseTranslations, e.Time, 0, false)
+	case *WebhooksSyncStarted:
+		r.start(PhaseWebhooks, e.Time)
+	case *WebhooksSynced:
+		return r.stop(PhaseWebhooks, e.Time, 0, false)
+	case *SettingsSyncStarted:
+		r.start(PhaseSettings, e.Time)
+	case *SettingsSynced:
+		return r.stop(PhaseSettings, e.Time, 0, false)
+	case *FlowsSyncStarted:
+		r.start(PhaseFlows, e.Time)
+	case *FlowsSynced:
+		return r.stop(PhaseFlows, e.Time, 0, false)
+	case *DashboardsSyncStarted:
+		r.start(PhaseDashboards, e.Time)
+	case *DashboardsSynced:
+		return r.stop(PhaseDashboards, e.Time, 0, false)
+	case *PhaseFailed:
+		if n := len(r.stats.Phases); n > 0 && r.stats.Phases[n-1].Phase == e.Phase {
+			// The phase finished before failing the migration, as the
+			// verification does with VerifyFail.
+			r.stats.Phases[n-1].Failed = true
+			return nil
+		}
+		return r.stop(e.Phase, e.Time, 0, true)
+	}
+	return nil
+}
+
+func (r *statsRecorder) start(phase string, t time.Time) {
+	r.started[phase] = t
+}
+
+// stop records the end of phase, unless it was not started.
+func (r *statsRecorder) stop(phase string, t time.Time, bytes int64, failed bool) *PhaseStats {
+	start, ok := r.started[phase]
+	if !ok {
+		return nil
+	}
+	delete(r.started, phase)
+	duration := t.Sub(start)
+	r.stats.Phases = append(r.stats.Phases, PhaseStats{
+		Phase:           phase,
+		Duration:        duration,
+		DurationSeconds: duration.Seconds(),
+		Bytes:           bytes,
+		Failed:          failed,
+	})
+	r.stats.Bytes += bytes
+	return &r.stats.Phases[len(r.stats.Phases)-1]
+}
+
+// finish records the total duration of the migration.
+func (r *statsRecorder) finish() {
+	r.stats.Duration = time.Since(r.begun)
+	r.stats.DurationSeconds = r.stats.Duration.Seconds()
+}
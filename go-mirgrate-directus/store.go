@@ -0,0 +1,220 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A SnapshotStore keeps files such as backups and plans, on the local disk
+// with DirStore or in an S3-compatible bucket with S3Store, so that they can
+// outlive ephemeral CI runners. Names are file names; PrefixStore puts a
+// directory in front of them for stores of other types.
+type SnapshotStore interface {
+	// Put stores data under name, replacing any object of that name.
+	Put(ctx context.Context, name string, data []byte) error
+	// Get returns the data stored under name, or an error wrapping
+	// fs.ErrNotExist if there is none.
+	Get(ctx context.Context, name string) ([]byte, error)
+	// List returns the objects of the store.
+	List(ctx context.Context) ([]StoredObject, error)
+	// Delete removes the object name. Deleting a missing object is not an
+	// error.
+	Delete(ctx context.Context, name string) error
+	// Location returns where the object name is kept, such as a path or an
+	// s3:// URL, for logs and reports. Location("") is the store itself.
+	Location(name string) string
+}
+
+// StoredObject is an object listed by SnapshotStore.List.
+type StoredObject struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// OpenStore returns the store at location: an S3Store for s3://bucket/prefix,
+// configured from the environment like NewS3Store, or a DirStore for
+// file://dir or a plain directory path.
+func OpenStore(location string) (SnapshotStore, error) {
+	scheme, rest, ok := strings.Cut(location, "://")
+	if !ok {
+		return DirStore(location), nil
+	}
+	switch strings.ToLower(scheme) {
+	case "file":
+		// file://./backups and file:///var/backups are both accepted.
+		if rest == "" {
+			return nil, fmt.Errorf("store URL %s has no directory", location)
+		}
+		return DirStore(rest), nil
+	case "s3":
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid store URL %s: %w", location, err)
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("store URL %s has no bucket", location)
+		}
+		return NewS3Store(u.Host, strings.Trim(u.Path, "/"))
+	default:
+		return nil, fmt.Errorf("unsupported store URL %s, expected s3://bucket/prefix, file://dir or a directory", location)
+	}
+}
+
+// OpenStoreFile splits location, the path or URL of a file such as
+// s3://bucket/plans/plan.json, into the store of its directory, opened with
+// OpenStore, and its name.
+func OpenStoreFile(location string) (SnapshotStore, string, error) {
+	var dir, name string
+	if strings.Contains(location, "://") {
+		dir, name = path.Split(location)
+		dir = strings.TrimSuffix(dir, "/")
+		if strings.HasSuffix(dir, ":/") {
+			return nil, "", fmt.Errorf("store URL %s has no file name", location)
+		}
+	} else {
+		dir, name = filepath.Split(location)
+		if dir == "" {
+			dir = "."
+		}
+	}
+	if name == "" {
+		return nil, "", fmt.Errorf("%s has no file name", location)
+	}
+	store, err := OpenStore(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	return store, name, nil
+}
+
+// DirStore returns a SnapshotStore keeping its objects as files in dir,
+// which is created when the first object is stored. Files are replaced
+// atomically.
+func DirStore(dir string) SnapshotStore {
+	return dirStore(dir)
+}
+
+type dirStore string
+
+func (d dirStore) Put(_ context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(string(d), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(string(d), "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.Location(name))
+}
+
+func (d dirStore) Get(_ context.Context, name string) ([]byte, error) {
+	return os.ReadFile(d.Location(name))
+}
+
+func (d dirStore) List(context.Context) ([]StoredObject, error) {
+	entries, err := os.ReadDir(string(d))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var objects []StoredObject
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, StoredObject{Name: entry.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return objects, nil
+}
+
+func (d dirStore) Delete(_ context.Context, name string) error {
+	if err := os.Remove(d.Location(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (d dirStore) Location(name string) string {
+	if name == "" {
+		return string(d)
+	}
+	return filepath.Join(string(d), name)
+}
+
+// PrefixStore returns the part of store whose objects are named
+// prefix/name, as the subdirectory prefix of a DirStore or below the prefix
+// of an S3Store.
+func PrefixStore(store SnapshotStore, prefix string) SnapshotStore {
+	switch s := store.(type) {
+	case dirStore:
+		return dirStore(filepath.Join(string(s), prefix))
+	case *S3Store:
+		sub := *s
+		sub.Prefix = path.Join(s.Prefix, prefix)
+		return &sub
+	}
+	return &prefixStore{store: store, prefix: prefix + "/"}
+}
+
+// prefixStore implements PrefixStore for other stores by prefixing names.
+type prefixStore struct {
+	store  SnapshotStore
+	prefix string
+}
+
+func (p *prefixStore) Put(ctx context.Context, name string, data []byte) error {
+	return p.store.Put(ctx, p.prefix+name, data)
+}
+
+func (p *prefixStore) Get(ctx context.Context, name string) ([]byte, error) {
+	return p.store.Get(ctx, p.prefix+name)
+}
+
+func (p *prefixStore) List(ctx context.Context) ([]StoredObject, error) {
+	all, err := p.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var objects []StoredObject
+	for _, object := range all {
+		if name, ok := strings.CutPrefix(object.Name, p.prefix); ok && !strings.Contains(name, "/") {
+			object.Name = name
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+func (p *prefixStore) Delete(ctx context.Context, name string) error {
+	return p.store.Delete(ctx, p.prefix+name)
+}
+
+func (p *prefixStore) Location(name string) string {
+	return p.store.Location(p.prefix + name)
+}
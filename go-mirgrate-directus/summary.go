@@ -0,0 +1,152 @@
+package gomirgratedirectus
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChangeCounts counts the created, updated and deleted items of one kind.
+type ChangeCounts struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+}
+
+// Total returns the number of changed items.
+func (c ChangeCounts) Total() int {
+	return c.Created + c.Updated + c.Deleted
+}
+
+// DiffSummary condenses a Diff into counts per kind of schema item.
+type DiffSummary struct {
+	Collections ChangeCounts `json:"collections"`
+	Fields      ChangeCounts `json:"fields"`
+	Relations   ChangeCounts `json:"relations"`
+	// AffectedCollections lists, sorted, every collection touched by the
+	// diff, including through its fields and relations.
+	AffectedCollections []string `json:"affected_collections"`
+	// FilteredFields counts the fields left out of the migration by
+	// SchemaFilter.ExcludeFields, so that filtering is never silent.
+	// SummarizeDiff leaves it zero.
+	FilteredFields int `json:"filtered_fields,omitempty"`
+}
+
+// Changed reports whether the summarized diff contains any change.
+func (s DiffSummary) Changed() bool {
+	return s.Collections.Total()+s.Fields.Total()+s.Relations.Total() > 0
+}
+
+// Deletions returns the number of deleted collections, fields and relations.
+func (s DiffSummary) Deletions() int {
+	return s.Collections.Deleted + s.Fields.Deleted + s.Relations.Deleted
+}
+
+// String describes the summary in one line, such as
+// "1 collection created, 12 fields created, 2 fields DELETED". Deletions are
+// capitalized because they are destructive. Filtered fields are noted at the
+// end, as in "no changes (3 fields filtered out)".
+func (s DiffSummary) String() string {
+	var parts []string
+	add := func(n int, noun, verb string) {
+		if n == 0 {
+			return
+		}
+		if n != 1 {
+			noun += "s"
+		}
+		parts = append(parts, fmt.Sprintf("%d %s %s", n, noun, verb))
+	}
+	for _, kind := range []struct {
+		noun   string
+		counts ChangeCounts
+	}{
+		{"collection", s.Collections},
+		{"field", s.Fields},
+		{"relation", s.Relations},
+	} {
+		add(kind.counts.Created, kind.noun, "created")
+		add(kind.counts.Updated, kind.noun, "updated")
+		add(kind.counts.Deleted, kind.noun, "DELETED")
+	}
+	summary := strings.Join(parts, ", ")
+	if len(parts) == 0 {
+		summary = "no changes"
+	}
+	switch s.FilteredFields {
+	case 0:
+	case 1:
+		summary += " (1 field filtered out)"
+	default:
+		summary += fmt.Sprintf(" (%d fields filtered out)", s.FilteredFields)
+	}
+	return summary
+}
+
+// SummarizeDiff counts the changes in diff. An item whose only change is a
+// whole-item "N" entry is created, one whose only change is a whole-item "D"
+// entry is deleted, and anything else is updated.
+func SummarizeDiff(diff *Diff) DiffSummary {
+	var summary DiffSummary
+	if diff == nil {
+		return summary
+	}
+
+	affected := map[string]bool{}
+	for _, item := range diff.Diff.Collections {
+		count(&summary.Collections, item.Diff)
+		affected[item.Collection] = true
+	}
+	for _, item := range diff.Diff.Fields {
+		count(&summary.Fields, item.Diff)
+		affected[item.Collection] = true
+	}
+	for _, item := range diff.Diff.Relations {
+		count(&summary.Relations, item.Diff)
+		affected[item.Collection] = true
+		if item.RelatedCollection != "" {
+			affected[item.RelatedCollection] = true
+		}
+	}
+
+	summary.AffectedCollections = make([]string, 0, len(affected))
+	for name := range affected {
+		summary.AffectedCollections = append(summary.AffectedCollections, name)
+	}
+	sort.Strings(summary.AffectedCollections)
+	return summary
+}
+
+// ChangeType classifies the changes of a single diff item.
+type ChangeType int
+
+const (
+	ChangeUpdated ChangeType = iota
+	ChangeCreated
+	ChangeDeleted
+)
+
+// ClassifyEntries tells whether the entries of one diff item create, delete
+// or update it.
+func ClassifyEntries(entries []DiffEntry) ChangeType {
+	if len(entries) == 1 && len(entries[0].Path) == 0 {
+		switch entries[0].Kind {
+		case KindNew:
+			return ChangeCreated
+		case KindDeleted:
+			return ChangeDeleted
+		}
+	}
+	return ChangeUpdated
+}
+
+func count(counts *ChangeCounts, entries []DiffEntry) {
+	switch ClassifyEntries(entries) {
+	case ChangeCreated:
+		counts.Created++
+	case ChangeDeleted:
+		counts.Deleted++
+	default:
+		counts.Updated++
+	}
+}
@@ -0,0 +1,75 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Timeouts bounds how long each client operation may take, including retries.
+// A zero duration leaves the operation bounded only by the caller's context.
+type Timeouts struct {
+	// Snapshot bounds GetSnapshot. Large schemas can take over a minute.
+	Snapshot time.Duration
+	// Diff bounds GetDiff.
+	Diff time.Duration
+	// Apply bounds ApplyDiff. Applying to big projects can take minutes.
+	Apply time.Duration
+	// Metadata bounds small requests such as server info and health checks.
+	Metadata time.Duration
+	// Transfer bounds copying one file asset, from the start of the download
+	// to the end of the upload.
+	Transfer time.Duration
+}
+
+// DefaultTimeouts returns the timeouts used by NewDirectusClient.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Snapshot: 5 * time.Minute,
+		Diff:     5 * time.Minute,
+		Apply:    30 * time.Minute,
+		Metadata: 10 * time.Second,
+		Transfer: 30 * time.Minute,
+	}
+}
+
+// WithTimeouts replaces the default per-operation timeouts of the client.
+func WithTimeouts(timeouts Timeouts) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.timeouts = &timeouts
+	}
+}
+
+// OperationTimeoutError is returned when a client operation exceeds its own
+// timeout, as opposed to the caller's context expiring.
+type OperationTimeoutError struct {
+	Operation string
+	Timeout   time.Duration
+	Err       error
+}
+
+func (e *OperationTimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s: %v", e.Operation, e.Timeout, e.Err)
+}
+
+func (e *OperationTimeoutError) Unwrap() error { return e.Err }
+
+// startOperation derives the context for operation op from ctx, bounded by
+// timeout when it is positive. The returned function must be called with the
+// operation's error once it is done; it releases the context and reports an
+// expired operation timeout as *OperationTimeoutError.
+func startOperation(ctx context.Context, op string, timeout time.Duration) (context.Context, func(error) error) {
+	if timeout <= 0 {
+		return ctx, func(err error) error { return err }
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, timeout)
+	return opCtx, func(err error) error {
+		defer cancel()
+		if err != nil && ctx.Err() == nil && errors.Is(opCtx.Err(), context.DeadlineExceeded) {
+			return &OperationTimeoutError{Operation: op, Timeout: timeout, Err: err}
+		}
+		return err
+	}
+}
@@ -0,0 +1,78 @@
+package gomirgratedirectus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// tlsSettings collects the TLS related client options.
+type tlsSettings struct {
+	caCerts    [][]byte
+	clientCert []byte
+	clientKey  []byte
+	insecure   bool
+}
+
+// WithCACert trusts the PEM encoded CA certificates in pemBytes in addition to
+// the system roots, for Directus instances served with an internal CA.
+func WithCACert(pemBytes []byte) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.tls.caCerts = append(cfg.tls.caCerts, pemBytes)
+	}
+}
+
+// WithClientCert presents the PEM encoded certificate and key to the server
+// for mutual TLS.
+func WithClientCert(certPEM, keyPEM []byte) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.tls.clientCert = certPEM
+		cfg.tls.clientKey = keyPEM
+	}
+}
+
+// WithInsecureTLS disables verification of the server certificate. It makes
+// the connection vulnerable to interception and is meant for local testing
+// only.
+func WithInsecureTLS() ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.tls.insecure = true
+	}
+}
+
+// configured reports whether any TLS option was given.
+func (s *tlsSettings) configured() bool {
+	return len(s.caCerts) > 0 || s.clientCert != nil || s.insecure
+}
+
+// build returns the tls.Config described by s.
+func (s *tlsSettings) build() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: s.insecure,
+	}
+
+	if len(s.caCerts) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, pemBytes := range s.caCerts {
+			if !pool.AppendCertsFromPEM(pemBytes) {
+				return nil, errors.New("no valid certificates found in CA certificate PEM")
+			}
+		}
+		config.RootCAs = pool
+	}
+
+	if s.clientCert != nil {
+		cert, err := tls.X509KeyPair(s.clientCert, s.clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,89 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the instrumentation scope of the spans of a migration.
+const tracerName = "github.com/SymphonyIceAttack/go-mirgrate-directus"
+
+// tracerProviderKey is the context key of the TracerProvider used for the
+// HTTP client spans of a migration.
+type tracerProviderKey struct{}
+
+// withTracerProvider returns ctx carrying tp, so that the requests sent with
+// it are traced.
+func withTracerProvider(ctx context.Context, tp trace.TracerProvider) context.Context {
+	return context.WithValue(ctx, tracerProviderKey{}, tp)
+}
+
+// startSpan starts the span name as a child of the span in ctx if
+// opts.TracerProvider is set. Without one it returns ctx and a span that
+// records nothing.
+func (m *migration) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if m.opts.TracerProvider == nil {
+		return ctx, noop.Span{}
+	}
+	tracer := m.opts.TracerProvider.Tracer(tracerName, trace.WithInstrumentationVersion(GetBuildInfo().Version))
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span, marking it failed with err if not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// summaryAttributes returns the change counts of summary as span attributes.
+func summaryAttributes(summary DiffSummary) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	add := func(kind string, counts ChangeCounts) {
+		attrs = append(attrs,
+			attribute.Int("directus.diff."+kind+".created", counts.Created),
+			attribute.Int("directus.diff."+kind+".updated", counts.Updated),
+			attribute.Int("directus.diff."+kind+".deleted", counts.Deleted),
+		)
+	}
+	add("collections", summary.Collections)
+	add("fields", summary.Fields)
+	add("relations", summary.Relations)
+	return attrs
+}
+
+// httpClient returns the client to send a request for ctx with: c.HTTPClient,
+// with its transport wrapped by otelhttp when ctx carries a TracerProvider.
+func (c *DirectusClient) httpClient(ctx context.Context) *http.Client {
+	tp, ok := ctx.Value(tracerProviderKey{}).(trace.TracerProvider)
+	if !ok {
+		return c.HTTPClient
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.traced == nil || c.traced.provider != tp || c.traced.base != c.HTTPClient {
+		traced := *c.HTTPClient
+		traced.Transport = otelhttp.NewTransport(c.HTTPClient.Transport,
+			otelhttp.WithTracerProvider(tp),
+			otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+				return "HTTP " + req.Method
+			}))
+		c.traced = &tracedClient{provider: tp, base: c.HTTPClient, client: &traced}
+	}
+	return c.traced.client
+}
+
+// tracedClient caches the traced copy of an HTTP client.
+type tracedClient struct {
+	provider trace.TracerProvider
+	base     *http.Client
+	client   *http.Client
+}
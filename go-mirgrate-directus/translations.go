@@ -0,0 +1,225 @@
+package gomirgratedirectus
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultTranslationBatchSize is the number of translations SyncTranslations
+// reads per page and writes per request unless configured otherwise.
+const DefaultTranslationBatchSize = 100
+
+// Translation is a custom translation string, as listed by /translations.
+// Extra holds any further properties.
+type Translation struct {
+	ID       string `json:"id,omitempty"`
+	Language string `json:"language"`
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (t Translation) MarshalJSON() ([]byte, error) {
+	type plain Translation
+	return marshalWithExtra(plain(t), t.Extra)
+}
+
+func (t *Translation) UnmarshalJSON(data []byte) error {
+	type plain Translation
+	return unmarshalWithExtra(data, (*plain)(t), &t.Extra)
+}
+
+// ListTranslations returns all custom translations of the project, reading
+// them in pages of pageSize rows. Timeouts.Metadata bounds each page request,
+// not the whole listing.
+func (c *DirectusClient) ListTranslations(ctx context.Context, pageSize int) ([]Translation, error) {
+	if pageSize <= 0 {
+		pageSize = DefaultTranslationBatchSize
+	}
+	var translations []Translation
+	for page := 1; ; page++ {
+		query := url.Values{"limit": {strconv.Itoa(pageSize)}, "page": {strconv.Itoa(page)}, "sort": {"id"}}
+		rows, err := c.listTranslationsPage(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		translations = append(translations, rows...)
+		if len(rows) < pageSize {
+			return translations, nil
+		}
+	}
+}
+
+// listTranslationsPage reads one page of ListTranslations.
+func (c *DirectusClient) listTranslationsPage(ctx context.Context, query url.Values) (_ []Translation, err error) {
+	ctx, done := startOperation(ctx, "list translations", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var rows []Translation
+	if err := c.doJSON(ctx, "list translations", http.MethodGet, "/translations", query, nil, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// CreateTranslations creates translations in one request, ignoring their IDs.
+func (c *DirectusClient) CreateTranslations(ctx context.Context, translations []Translation) (err error) {
+	ctx, done := startOperation(ctx, "create translations", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	rows := slices.Clone(translations)
+	for i := range rows {
+		rows[i].ID = ""
+	}
+	return c.doJSON(ctx, "create translations", http.MethodPost, "/translations", nil, rows, nil)
+}
+
+// UpdateTranslations updates translations, identified by their IDs, in one
+// request.
+func (c *DirectusClient) UpdateTranslations(ctx context.Context, translations []Translation) (err error) {
+	ctx, done := startOperation(ctx, "update translations", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "update translations", http.MethodPatch, "/translations", nil, translations, nil)
+}
+
+// DeleteTranslations deletes the translations with the given IDs in one
+// request.
+func (c *DirectusClient) DeleteTranslations(ctx context.Context, ids []string) (err error) {
+	ctx, done := startOperation(ctx, "delete translations", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "delete translations", http.MethodDelete, "/translations", nil, ids, nil)
+}
+
+// TranslationKey identifies a translation across instances.
+type TranslationKey struct {
+	Language string `json:"language"`
+	Key      string `json:"key"`
+}
+
+func (k TranslationKey) String() string {
+	return k.Language + ":" + k.Key
+}
+
+// TranslationSyncOptions configures SyncTranslations.
+type TranslationSyncOptions struct {
+	// DryRun only computes the changes; nothing is written.
+	DryRun bool
+	// Prune deletes the target translations whose key the base does not
+	// have.
+	Prune bool
+	// BatchSize is the number of rows read per page and written per
+	// request. It defaults to DefaultTranslationBatchSize.
+	BatchSize int
+}
+
+// TranslationsResult is the result of SyncTranslations. It lists the keys,
+// sorted, so that a dry run tells exactly what would change.
+type TranslationsResult struct {
+	Added   []TranslationKey `json:"added,omitempty"`
+	Updated []TranslationKey `json:"updated,omitempty"`
+	// Removed is only filled with TranslationSyncOptions.Prune.
+	Removed []TranslationKey `json:"removed,omitempty"`
+	// DryRun reports that the changes were only computed.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Counts returns the number of added, updated and removed translations.
+func (r *TranslationsResult) Counts() ChangeCounts {
+	return ChangeCounts{Created: len(r.Added), Updated: len(r.Updated), Deleted: len(r.Removed)}
+}
+
+// Changed reports whether any translation changed.
+func (r *TranslationsResult) Changed() bool {
+	return r.Counts().Total() > 0
+}
+
+// SyncTranslations upserts the custom translations of base on target, keyed
+// by language and key: missing ones are created and ones with a different
+// value updated, in batches of opts.BatchSize rows. With opts.Prune, target
+// translations whose key the base does not have are deleted.
+func SyncTranslations(ctx context.Context, base, target *DirectusClient, opts TranslationSyncOptions) (*TranslationsResult, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultTranslationBatchSize
+	}
+	baseRows, err := base.ListTranslations(ctx, batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list base translations: %w", err)
+	}
+	targetRows, err := target.ListTranslations(ctx, batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target translations: %w", err)
+	}
+
+	existing := map[TranslationKey]Translation{}
+	for _, row := range targetRows {
+		key := TranslationKey{row.Language, row.Key}
+		if _, seen := existing[key]; !seen {
+			existing[key] = row
+		}
+	}
+
+	result := &TranslationsResult{DryRun: opts.DryRun}
+	want := map[TranslationKey]Translation{}
+	for _, row := range baseRows {
+		want[TranslationKey{row.Language, row.Key}] = row
+	}
+	var creates, updates []Translation
+	for _, key := range slices.SortedFunc(maps.Keys(want), compareTranslationKeys) {
+		row := want[key]
+		current, ok := existing[key]
+		switch {
+		case !ok:
+			result.Added = append(result.Added, key)
+			creates = append(creates, row)
+		case !sameExceptID(row, current):
+			result.Updated = append(result.Updated, key)
+			row.ID = current.ID
+			updates = append(updates, row)
+		}
+	}
+	var deletes []string
+	if opts.Prune {
+		for _, key := range slices.SortedFunc(maps.Keys(existing), compareTranslationKeys) {
+			if _, ok := want[key]; !ok {
+				result.Removed = append(result.Removed, key)
+				deletes = append(deletes, existing[key].ID)
+			}
+		}
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	for batch := range slices.Chunk(creates, batchSize) {
+		if err := target.CreateTranslations(ctx, batch); err != nil {
+			return result, fmt.Errorf("failed to create %d translations: %w", len(batch), err)
+		}
+	}
+	for batch := range slices.Chunk(updates, batchSize) {
+		if err := target.UpdateTranslations(ctx, batch); err != nil {
+			return result, fmt.Errorf("failed to update %d translations: %w", len(batch), err)
+		}
+	}
+	for batch := range slices.Chunk(deletes, batchSize) {
+		if err := target.DeleteTranslations(ctx, batch); err != nil {
+			return result, fmt.Errorf("failed to delete %d translations: %w", len(batch), err)
+		}
+	}
+	return result, nil
+}
+
+func compareTranslationKeys(a, b TranslationKey) int {
+	return cmp.Or(strings.Compare(a.Language, b.Language), strings.Compare(a.Key, b.Key))
+}
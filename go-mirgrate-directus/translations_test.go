@@ -0,0 +1,44 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+func translation(i int) map[string]any {
+	return map[string]any{"id": fmt.Sprintf("t%03d", i), "language": "en-US", "key": fmt.Sprintf("key_%d", i), "value": fmt.Sprint("Value ", i)}
+}
+
+func TestListTranslationsPageTimeout(t *testing.T) {
+	ctx := context.Background()
+	timeouts := gomigratedirectus.Timeouts{Metadata: 100 * time.Millisecond}
+
+	// Six pages take longer than the timeout together, but each is fast.
+	server := slowPagesServer(t, "/translations", 55, 40*time.Millisecond, translation)
+	client := gomigratedirectus.NewDirectusClient(server.URL, "token", quiet(gomigratedirectus.WithTimeouts(timeouts))...)
+	start := time.Now()
+	translations, err := client.ListTranslations(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListTranslations: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < timeouts.Metadata {
+		t.Fatalf("ListTranslations took %s, want the pages to outlast the timeout", elapsed)
+	}
+	if len(translations) != 55 || translations[54].Key != "key_54" {
+		t.Errorf("ListTranslations returned %d translations, want 55", len(translations))
+	}
+
+	// A single page slower than the timeout still fails.
+	server = slowPagesServer(t, "/translations", 55, 300*time.Millisecond, translation)
+	client = gomigratedirectus.NewDirectusClient(server.URL, "token", quiet(gomigratedirectus.WithTimeouts(timeouts))...)
+	_, err = client.ListTranslations(ctx, 10)
+	var timeoutErr *gomigratedirectus.OperationTimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Operation != "list translations" {
+		t.Errorf("ListTranslations with a slow page = %v, want an OperationTimeoutError", err)
+	}
+}
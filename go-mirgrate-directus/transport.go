@@ -0,0 +1,44 @@
+package gomirgratedirectus
+
+import (
+	"net/http"
+	"time"
+)
+
+// DefaultMaxIdleConnsPerHost is the number of idle connections per host kept
+// by a transport created by NewTransport. http.DefaultTransport keeps 2, which
+// makes clients of several targets served by the same host open new
+// connections over and over.
+const DefaultMaxIdleConnsPerHost = 16
+
+// NewTransport returns an HTTP transport for several clients to share with
+// WithTransport, so that they share one connection pool. It is configured by
+// the TLS and proxy options among opts, such as WithCACert and WithProxy;
+// other options are ignored.
+func NewTransport(opts ...ClientOption) (*http.Transport, error) {
+	cfg := &clientConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	transport, err := cloneTransport(nil)
+	if err != nil {
+		return nil, err
+	}
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	transport.IdleConnTimeout = 90 * time.Second
+	if err := cfg.configureTransport(transport); err != nil {
+		return nil, err
+	}
+	return transport, nil
+}
+
+// WithTransport makes the client send requests through transport, which may
+// be shared with other clients. TLS and proxy options given along with it
+// configure a copy of transport that is no longer shared; pass them to
+// NewTransport instead.
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.transport = transport
+	}
+}
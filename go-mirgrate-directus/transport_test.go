@@ -0,0 +1,145 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// connServer is an instance serving the snapshot of the latest fixture and
+// no changes, counting the connections opened to it. With a barrier of n,
+// diff requests are held until n of them are in flight, so that they need
+// n connections.
+type connServer struct {
+	*httptest.Server
+	opened  atomic.Int64
+	barrier chan struct{}
+}
+
+func newConnServer(t *testing.T, n int) *connServer {
+	t.Helper()
+	versions := directustest.FixtureVersions()
+	fixture, err := directustest.LoadFixture(versions[len(versions)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &connServer{}
+	var mu sync.Mutex
+	var waiting []chan struct{}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/schema/snapshot":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write(fixture.SnapshotBody)
+		case "/schema/diff":
+			if n > 1 {
+				release := make(chan struct{})
+				mu.Lock()
+				if waiting = append(waiting, release); len(waiting) == n {
+					for _, c := range waiting {
+						close(c)
+					}
+					waiting = nil
+				}
+				mu.Unlock()
+				<-release
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			s.opened.Add(1)
+		}
+	}
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestSharedTransportSequential(t *testing.T) {
+	server := newConnServer(t, 1)
+	transport, err := gomigratedirectus.NewTransport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.CloseIdleConnections()
+	base := gomigratedirectus.NewDirectusClient(server.URL, "base-token", quiet(gomigratedirectus.WithTransport(transport))...)
+	var targets []*gomigratedirectus.DirectusClient
+	for _, token := range []string{"staging-token", "production-token"} {
+		targets = append(targets, gomigratedirectus.NewDirectusClient(server.URL, token, quiet(gomigratedirectus.WithTransport(transport))...))
+	}
+
+	ctx := context.Background()
+	for range 3 {
+		snapshot, err := base.GetSnapshot(ctx)
+		if err != nil {
+			t.Fatalf("GetSnapshot: %v", err)
+		}
+		for _, target := range targets {
+			if _, err := target.GetDiff(ctx, snapshot, false); err != gomigratedirectus.ErrNoChanges {
+				t.Fatalf("GetDiff = %v, want ErrNoChanges", err)
+			}
+		}
+	}
+	if got := server.opened.Load(); got != 1 {
+		t.Errorf("base and targets opened %d connections for sequential requests, want 1", got)
+	}
+}
+
+func TestSharedTransportConcurrent(t *testing.T) {
+	const clients = 10
+	for _, tt := range []struct {
+		name      string
+		transport func(t *testing.T) *http.Transport
+		want      int64
+	}{
+		// Ten idle connections fit in the pool of NewTransport, so the
+		// second round opens none.
+		{"NewTransport", func(t *testing.T) *http.Transport {
+			transport, err := gomigratedirectus.NewTransport()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return transport
+		}, clients},
+		// The default of two idle connections per host makes the second
+		// round open all but two again.
+		{"two idle connections", func(t *testing.T) *http.Transport {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.MaxIdleConnsPerHost = 2
+			return transport
+		}, 2*clients - 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newConnServer(t, clients)
+			transport := tt.transport(t)
+			defer transport.CloseIdleConnections()
+			targets := make([]*gomigratedirectus.DirectusClient, clients)
+			for i := range targets {
+				targets[i] = gomigratedirectus.NewDirectusClient(server.URL, "token", quiet(gomigratedirectus.WithTransport(transport))...)
+			}
+			for range 2 {
+				var wg sync.WaitGroup
+				for _, target := range targets {
+					wg.Go(func() {
+						if _, err := target.GetDiffRaw(context.Background(), []byte(`{}`), false); err != gomigratedirectus.ErrNoChanges {
+							t.Errorf("GetDiffRaw = %v, want ErrNoChanges", err)
+						}
+					})
+				}
+				wg.Wait()
+			}
+			if got := server.opened.Load(); got != tt.want {
+				t.Errorf("two rounds of %d concurrent requests opened %d connections, want %d", clients, got, tt.want)
+			}
+		})
+	}
+}
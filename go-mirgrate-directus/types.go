@@ -0,0 +1,367 @@
+package gomirgratedirectus
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Snapshot is a Directus schema snapshot as returned by /schema/snapshot.
+// Keys this package does not know about are kept in Extra, so snapshots taken
+// from newer Directus versions survive a round trip unchanged.
+type Snapshot struct {
+	Version     int          `json:"version"`
+	Directus    string       `json:"directus"`
+	Vendor      string       `json:"vendor,omitempty"`
+	Collections []Collection `json:"collections"`
+	Fields      []Field      `json:"fields"`
+	Relations   []Relation   `json:"relations"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Collection is a collection entry of a snapshot.
+type Collection struct {
+	Collection string         `json:"collection"`
+	Meta       map[string]any `json:"meta"`
+	Schema     map[string]any `json:"schema"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Field is a field entry of a snapshot.
+type Field struct {
+	Collection string         `json:"collection"`
+	Field      string         `json:"field"`
+	Type       string         `json:"type"`
+	Meta       map[string]any `json:"meta"`
+	Schema     map[string]any `json:"schema"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Relation is a relation entry of a snapshot. Collection and Field name the
+// many side holding the foreign key; RelatedCollection is the one side.
+type Relation struct {
+	Collection        string         `json:"collection"`
+	Field             string         `json:"field"`
+	RelatedCollection string         `json:"related_collection"`
+	Meta              map[string]any `json:"meta"`
+	Schema            map[string]any `json:"schema"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Diff is a schema diff as returned by /schema/diff and accepted by
+// /schema/apply. Hash identifies the target schema the diff was computed
+// against.
+type Diff struct {
+	Hash string      `json:"hash"`
+	Diff DiffChanges `json:"diff"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// DiffChanges lists the changes of a Diff per kind of schema item.
+type DiffChanges struct {
+	Collections []CollectionDiff `json:"collections"`
+	Fields      []FieldDiff      `json:"fields"`
+	Relations   []RelationDiff   `json:"relations"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// CollectionDiff holds the changes to one collection.
+type CollectionDiff struct {
+	Collection string      `json:"collection"`
+	Diff       []DiffEntry `json:"diff"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// FieldDiff holds the changes to one field.
+type FieldDiff struct {
+	Collection string      `json:"collection"`
+	Field      string      `json:"field"`
+	Diff       []DiffEntry `json:"diff"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// RelationDiff holds the changes to one relation.
+type RelationDiff struct {
+	Collection        string      `json:"collection"`
+	Field             string      `json:"field"`
+	RelatedCollection string      `json:"related_collection"`
+	Diff              []DiffEntry `json:"diff"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Kinds of DiffEntry, as produced by the deep-diff library Directus uses.
+const (
+	KindNew     = "N"
+	KindEdited  = "E"
+	KindDeleted = "D"
+	KindArray   = "A"
+)
+
+// DiffEntry is a single deep-diff change. Lhs and Rhs hold the old and new
+// values as raw JSON, so that an explicit null is kept apart from a missing
+// value.
+type DiffEntry struct {
+	Kind  string          `json:"kind"`
+	Path  []any           `json:"path,omitempty"`
+	Lhs   json.RawMessage `json:"lhs,omitempty"`
+	Rhs   json.RawMessage `json:"rhs,omitempty"`
+	Index *int            `json:"index,omitempty"`
+	Item  *DiffEntry      `json:"item,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// IsEmpty reports whether d contains no changes.
+func (d *Diff) IsEmpty() bool {
+	return d == nil || len(d.Diff.Collections)+len(d.Diff.Fields)+len(d.Diff.Relations) == 0
+}
+
+// ToMap converts s into the untyped structure used by earlier versions of
+// this package.
+func (s *Snapshot) ToMap() (map[string]any, error) { return toMap(s) }
+
+// SnapshotFromMap converts an untyped snapshot into a Snapshot.
+func SnapshotFromMap(m map[string]any) (*Snapshot, error) {
+	var s Snapshot
+	if err := fromMap(m, &s); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	return &s, nil
+}
+
+// ToMap converts d into the untyped structure used by earlier versions of
+// this package.
+func (d *Diff) ToMap() (map[string]any, error) { return toMap(d) }
+
+// DiffFromMap converts an untyped diff into a Diff.
+func DiffFromMap(m map[string]any) (*Diff, error) {
+	var d Diff
+	if err := fromMap(m, &d); err != nil {
+		return nil, fmt.Errorf("invalid diff: %w", err)
+	}
+	return &d, nil
+}
+
+func toMap(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func fromMap(m map[string]any, v any) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// The types above keep unknown keys in their Extra field. Each pair of
+// methods delegates to marshalWithExtra and unmarshalWithExtra through an
+// alias type without methods, to avoid infinite recursion.
+
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	type plain Snapshot
+	return marshalWithExtra(plain(s), s.Extra)
+}
+
+func (s *Snapshot) UnmarshalJSON(data []byte) error {
+	type plain Snapshot
+	return unmarshalWithExtra(data, (*plain)(s), &s.Extra)
+}
+
+func (c Collection) MarshalJSON() ([]byte, error) {
+	type plain Collection
+	return marshalWithExtra(plain(c), c.Extra)
+}
+
+func (c *Collection) UnmarshalJSON(data []byte) error {
+	type plain Collection
+	return unmarshalWithExtra(data, (*plain)(c), &c.Extra)
+}
+
+func (f Field) MarshalJSON() ([]byte, error) {
+	type plain Field
+	return marshalWithExtra(plain(f), f.Extra)
+}
+
+func (f *Field) UnmarshalJSON(data []byte) error {
+	type plain Field
+	return unmarshalWithExtra(data, (*plain)(f), &f.Extra)
+}
+
+func (r Relation) MarshalJSON() ([]byte, error) {
+	type plain Relation
+	return marshalWithExtra(plain(r), r.Extra)
+}
+
+func (r *Relation) UnmarshalJSON(data []byte) error {
+	type plain Relation
+	return unmarshalWithExtra(data, (*plain)(r), &r.Extra)
+}
+
+func (d Diff) MarshalJSON() ([]byte, error) {
+	type plain Diff
+	return marshalWithExtra(plain(d), d.Extra)
+}
+
+func (d *Diff) UnmarshalJSON(data []byte) error {
+	type plain Diff
+	return unmarshalWithExtra(data, (*plain)(d), &d.Extra)
+}
+
+func (d DiffChanges) MarshalJSON() ([]byte, error) {
+	type plain DiffChanges
+	return marshalWithExtra(plain(d), d.Extra)
+}
+
+func (d *DiffChanges) UnmarshalJSON(data []byte) error {
+	type plain DiffChanges
+	return unmarshalWithExtra(data, (*plain)(d), &d.Extra)
+}
+
+func (d CollectionDiff) MarshalJSON() ([]byte, error) {
+	type plain CollectionDiff
+	return marshalWithExtra(plain(d), d.Extra)
+}
+
+func (d *CollectionDiff) UnmarshalJSON(data []byte) error {
+	type plain CollectionDiff
+	return unmarshalWithExtra(data, (*plain)(d), &d.Extra)
+}
+
+func (d FieldDiff) MarshalJSON() ([]byte, error) {
+	type plain FieldDiff
+	return marshalWithExtra(plain(d), d.Extra)
+}
+
+func (d *FieldDiff) UnmarshalJSON(data []byte) error {
+	type plain FieldDiff
+	return unmarshalWithExtra(data, (*plain)(d), &d.Extra)
+}
+
+func (d RelationDiff) MarshalJSON() ([]byte, error) {
+	type plain RelationDiff
+	return marshalWithExtra(plain(d), d.Extra)
+}
+
+func (d *RelationDiff) UnmarshalJSON(data []byte) error {
+	type plain RelationDiff
+	return unmarshalWithExtra(data, (*plain)(d), &d.Extra)
+}
+
+func (e DiffEntry) MarshalJSON() ([]byte, error) {
+	type plain DiffEntry
+	return marshalWithExtra(plain(e), e.Extra)
+}
+
+func (e *DiffEntry) UnmarshalJSON(data []byte) error {
+	type plain DiffEntry
+	return unmarshalWithExtra(data, (*plain)(e), &e.Extra)
+}
+
+// marshalWithExtra marshals v, a struct, and merges the keys of extra into the
+// resulting object. Known fields win over extra keys of the same name.
+func marshalWithExtra(v any, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range extra {
+		if _, known := fields[key]; !known {
+			fields[key] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// unmarshalWithExtra unmarshals data into v, a pointer to a struct, and stores
+// the keys that do not correspond to a field of v in extra.
+func unmarshalWithExtra(data []byte, v any, extra *map[string]json.RawMessage) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	// Only the names of the keys are collected first: copying the values of
+	// the known ones, which hold the whole schema at the top of a snapshot,
+	// would double the memory used by a decode.
+	var keys map[string]skippedValue
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	known := jsonKeys(reflect.TypeOf(v).Elem())
+	for key := range keys {
+		if slices.Contains(known, key) {
+			delete(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		*extra = nil
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, key := range known {
+		delete(fields, key)
+	}
+	*extra = fields
+	return nil
+}
+
+// skippedValue is a JSON value that is parsed but not kept.
+type skippedValue struct{}
+
+func (*skippedValue) UnmarshalJSON([]byte) error { return nil }
+
+var jsonKeysCache sync.Map
+
+// jsonKeys returns the JSON object keys of the fields of struct type t.
+func jsonKeys(t reflect.Type) []string {
+	if keys, ok := jsonKeysCache.Load(t); ok {
+		return keys.([]string)
+	}
+
+	var keys []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+		keys = append(keys, name)
+	}
+	jsonKeysCache.Store(t, keys)
+	return keys
+}
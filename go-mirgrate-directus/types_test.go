@@ -0,0 +1,158 @@
+package gomirgratedirectus_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// sameJSON fails t unless a and b encode the same JSON value, regardless of
+// key order and formatting.
+func sameJSON(t *testing.T, what string, a, b []byte) {
+	t.Helper()
+	var x, y any
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+	if !reflect.DeepEqual(x, y) {
+		t.Errorf("%s changed:\n got %s\nwant %s", what, a, b)
+	}
+}
+
+// fixtureData returns the data field of a fixture response body.
+func fixtureData(t *testing.T, body []byte) json.RawMessage {
+	t.Helper()
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	return envelope.Data
+}
+
+func TestFixtureRoundTrip(t *testing.T) {
+	for _, version := range directustest.FixtureVersions() {
+		t.Run(version, func(t *testing.T) {
+			fixture, err := directustest.LoadFixture(version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			snapshot, err := json.Marshal(fixture.Snapshot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sameJSON(t, "snapshot", snapshot, fixtureData(t, fixture.SnapshotBody))
+			diff, err := json.Marshal(fixture.Diff)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sameJSON(t, "diff", diff, fixtureData(t, fixture.DiffBody))
+		})
+	}
+}
+
+func TestExtraRetained(t *testing.T) {
+	snapshotJSON := []byte(`{
+		"version": 1, "directus": "11.0.0", "vendor": "postgres", "systemFields": [{"collection": "directus_users"}],
+		"collections": [{"collection": "articles", "meta": null, "schema": {"name": "articles"}, "future": true}],
+		"fields": [{"collection": "articles", "field": "id", "type": "integer", "meta": null, "schema": null, "searchable": false}],
+		"relations": [{"collection": "articles", "field": "author", "related_collection": "authors", "meta": null, "schema": null, "embedded": 1}]
+	}`)
+	var snapshot gomigratedirectus.Snapshot
+	if err := json.Unmarshal(snapshotJSON, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	for what, extra := range map[string]map[string]json.RawMessage{
+		"systemFields": snapshot.Extra,
+		"future":       snapshot.Collections[0].Extra,
+		"searchable":   snapshot.Fields[0].Extra,
+		"embedded":     snapshot.Relations[0].Extra,
+	} {
+		if _, ok := extra[what]; !ok {
+			t.Errorf("unknown key %q not kept in Extra", what)
+		}
+	}
+	encoded, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameJSON(t, "snapshot", encoded, snapshotJSON)
+
+	// An explicit null is kept apart from a missing value.
+	diffJSON := []byte(`{
+		"hash": "abc", "origin": "base",
+		"diff": {"collections": [], "fields": [{"collection": "articles", "field": "title", "diff": [
+			{"kind": "E", "path": ["meta", "note"], "lhs": null, "rhs": "Title", "by": "deep-diff"},
+			{"kind": "N", "path": ["meta", "hidden"], "rhs": false}
+		]}], "relations": [], "systemFields": []}
+	}`)
+	var diff gomigratedirectus.Diff
+	if err := json.Unmarshal(diffJSON, &diff); err != nil {
+		t.Fatal(err)
+	}
+	entries := diff.Diff.Fields[0].Diff
+	if string(entries[0].Lhs) != "null" || entries[1].Lhs != nil {
+		t.Errorf("Lhs = %s and %s, want null and missing", entries[0].Lhs, entries[1].Lhs)
+	}
+	if diff.Extra["origin"] == nil || diff.Diff.Extra["systemFields"] == nil || entries[0].Extra["by"] == nil {
+		t.Error("unknown diff keys not kept in Extra")
+	}
+	encoded, err = json.Marshal(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameJSON(t, "diff", encoded, diffJSON)
+}
+
+func TestToMapFromMap(t *testing.T) {
+	fixture, err := directustest.LoadFixture(directustest.FixtureVersions()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := fixture.Snapshot.ToMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if collections, ok := m["collections"].([]any); !ok || len(collections) != len(fixture.Snapshot.Collections) {
+		t.Fatalf("ToMap collections = %v, want %d collections", m["collections"], len(fixture.Snapshot.Collections))
+	}
+	snapshot, err := gomigratedirectus.SnapshotFromMap(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(snapshot, fixture.Snapshot) {
+		t.Error("snapshot changed by ToMap and SnapshotFromMap")
+	}
+
+	dm, err := fixture.Diff.ToMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := gomigratedirectus.DiffFromMap(dm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The raw values of the entries are compacted on the way, so compare
+	// them as JSON.
+	got, err := json.Marshal(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := json.Marshal(fixture.Diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameJSON(t, "diff after ToMap and DiffFromMap", got, want)
+
+	if _, err := gomigratedirectus.SnapshotFromMap(map[string]any{"collections": "articles"}); err == nil {
+		t.Error("SnapshotFromMap accepted collections that are not a list")
+	}
+}
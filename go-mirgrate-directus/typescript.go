@@ -0,0 +1,172 @@
+package gomirgratedirectus
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// tsFieldTypes maps Directus field types to TypeScript types. Dates, times
+// and decimals are strings, as Directus returns them.
+var tsFieldTypes = map[string]string{
+	"string":     "string",
+	"text":       "string",
+	"uuid":       "string",
+	"hash":       "string",
+	"binary":     "string",
+	"date":       "string",
+	"dateTime":   "string",
+	"time":       "string",
+	"timestamp":  "string",
+	"decimal":    "string",
+	"integer":    "number",
+	"bigInteger": "number",
+	"float":      "number",
+	"boolean":    "boolean",
+	"csv":        "string[]",
+	"json":       "unknown",
+}
+
+// tsIdentifier matches the property names that need no quotes.
+var tsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// GenerateTypeScript returns a TypeScript declaration file with an interface
+// per collection of snapshot and a Schema interface mapping each collection
+// name to its items, an array but for singletons, as the Directus JS SDK
+// expects. Nullable fields accept null, and fields with choices are unions
+// of their values. Many-to-one fields are typed as the primary key of the
+// related collection or its interface, one-to-many alias fields as an array
+// of the same, for items read with the relation expanded. Other alias fields
+// are left out. Collections and fields are sorted as for GenerateGo.
+func GenerateTypeScript(snapshot *Snapshot) ([]byte, error) {
+	if snapshot == nil {
+		return nil, fmt.Errorf("cannot generate code for a nil snapshot")
+	}
+	model := newSchemaModel(snapshot)
+	names := exportedNames(model.collections, func(c Collection) string { return c.Collection }, "Schema")
+
+	// keyAndItem returns the type of a reference to an item of collection.
+	keyAndItem := func(collection string, fallback Field) string {
+		key := tsFieldType(fallback)
+		if pk, ok := model.primaryKeys[collection]; ok {
+			key = tsFieldType(pk)
+		}
+		if k := model.index(collection); k >= 0 {
+			return key + " | " + names[k]
+		}
+		return key
+	}
+
+	var b bytes.Buffer
+	b.WriteString("// Generated by go-mirgrate-directus from a Directus schema snapshot. Do not edit.\n")
+	for i, collection := range model.collections {
+		b.WriteString("\n")
+		if note := noteComment(collection.Meta["note"]); note != "" {
+			fmt.Fprintf(&b, "/** %s */\n", tsComment(note))
+		}
+		fmt.Fprintf(&b, "export interface %s {\n", names[i])
+		for _, field := range model.fields[collection.Collection] {
+			var typ string
+			switch {
+			case hasColumn(field):
+				typ = tsFieldType(field)
+				if choices := tsChoices(field); choices != "" {
+					typ = choices
+				}
+				if target, ok := model.related[field.Collection+"."+field.Field]; ok {
+					typ = keyAndItem(target, field)
+				}
+				if nullable, _ := field.Schema["is_nullable"].(bool); nullable && !isPrimaryKeyField(field) {
+					typ += " | null"
+				}
+			default:
+				relation, ok := model.oneFields[field.Collection+"."+field.Field]
+				if !ok {
+					continue
+				}
+				typ = "(" + keyAndItem(relation.Collection, Field{Type: "unknown"}) + ")[]"
+			}
+			if note := noteComment(field.Meta["note"]); note != "" {
+				fmt.Fprintf(&b, "  /** %s */\n", tsComment(note))
+			}
+			fmt.Fprintf(&b, "  %s: %s;\n", tsPropertyName(field.Field), typ)
+		}
+		b.WriteString("}\n")
+	}
+
+	b.WriteString("\nexport interface Schema {\n")
+	for i, collection := range model.collections {
+		typ := names[i] + "[]"
+		if singleton, _ := collection.Meta["singleton"].(bool); singleton {
+			typ = names[i]
+		}
+		fmt.Fprintf(&b, "  %s: %s;\n", tsPropertyName(collection.Collection), typ)
+	}
+	b.WriteString("}\n")
+	return b.Bytes(), nil
+}
+
+// tsFieldType returns the TypeScript type of the values of field, unknown
+// for types it does not know such as geometry.Point.
+func tsFieldType(field Field) string {
+	if typ, ok := tsFieldTypes[field.Type]; ok {
+		return typ
+	}
+	return "unknown"
+}
+
+// tsChoices returns the union of the values of the choices of field, an
+// array of them for csv and json fields such as multiple selections, or ""
+// if field has no choices.
+func tsChoices(field Field) string {
+	options, _ := field.Meta["options"].(map[string]any)
+	choices, _ := options["choices"].([]any)
+	var literals []string
+	for _, choice := range choices {
+		choice, _ := choice.(map[string]any)
+		value, ok := choice["value"]
+		if !ok {
+			continue
+		}
+		switch value.(type) {
+		case string, float64, bool:
+		default:
+			return ""
+		}
+		literal, err := json.Marshal(value)
+		if err != nil {
+			return ""
+		}
+		if !slices.Contains(literals, string(literal)) {
+			literals = append(literals, string(literal))
+		}
+	}
+	if len(literals) == 0 {
+		return ""
+	}
+	union := strings.Join(literals, " | ")
+	if field.Type == "csv" || field.Type == "json" {
+		if len(literals) > 1 {
+			union = "(" + union + ")"
+		}
+		return union + "[]"
+	}
+	return union
+}
+
+// tsPropertyName quotes name unless it is an identifier.
+func tsPropertyName(name string) string {
+	if tsIdentifier.MatchString(name) {
+		return name
+	}
+	quoted, _ := json.Marshal(name)
+	return string(quoted)
+}
+
+// tsComment keeps note from ending a doc comment.
+func tsComment(note string) string {
+	return strings.ReplaceAll(note, "*/", "*\\/")
+}
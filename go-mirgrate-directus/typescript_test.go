@@ -0,0 +1,31 @@
+package gomirgratedirectus_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+func TestGenerateTypeScript(t *testing.T) {
+	var first []byte
+	for i, snapshot := range modelSnapshots(t) {
+		got, err := gomigratedirectus.GenerateTypeScript(snapshot)
+		if err != nil {
+			t.Fatalf("GenerateTypeScript: %v", err)
+		}
+		if i == 0 {
+			first = got
+			golden(t, filepath.Join("models", "models.d.ts.golden"), got)
+		} else if !bytes.Equal(got, first) {
+			t.Errorf("GenerateTypeScript depends on the order of the snapshot:\n%s\nwant:\n%s", got, first)
+		}
+	}
+}
+
+func TestGenerateTypeScriptNil(t *testing.T) {
+	if _, err := gomigratedirectus.GenerateTypeScript(nil); err == nil {
+		t.Error("GenerateTypeScript(nil) succeeded")
+	}
+}
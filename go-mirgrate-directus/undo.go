@@ -0,0 +1,179 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// UndoFormatVersion is the undo record format version written by
+// RecordUndo, the only one ReadUndoRecord accepts.
+const UndoFormatVersion = 1
+
+// undoPrefix starts the names of undo records, which continue like backup
+// names.
+const undoPrefix = "undo-"
+
+// An UndoRecord holds the reverse diff of a migration: the diff that turns
+// the target back into the backup taken before it was applied. It is saved
+// next to the backup by RecordUndo and applied with ApplyUndo.
+type UndoRecord struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// TargetURL is the redacted URL of the migrated target.
+	TargetURL string `json:"target_url"`
+	// BackupPath is where the backup taken before the migration was saved.
+	BackupPath string `json:"backup_path,omitempty"`
+	// TargetHash is the SnapshotHash of the target schema right after the
+	// migration. ApplyUndo refuses to run once it changed.
+	TargetHash string      `json:"target_hash"`
+	Summary    DiffSummary `json:"summary"`
+	Diff       *Diff       `json:"diff"`
+}
+
+// ErrUndoDrifted is returned by CheckUndo and ApplyUndo when the target
+// schema changed since the migration the undo record reverts.
+var ErrUndoDrifted = errors.New("target schema changed since the migration")
+
+// ErrNoUndoRecord is returned by LatestUndoRecord when the store holds no
+// undo record for the target.
+var ErrNoUndoRecord = errors.New("no undo record")
+
+// RecordUndo computes the reverse diff of a migration just applied to target,
+// from backup, the snapshot of the target taken before, and saves it to store
+// under a timestamped name such as undo-2024-06-01T12-00-00.json. It returns
+// the location of the record, or an empty string when the migration changed
+// nothing to revert.
+func RecordUndo(ctx context.Context, target *DirectusClient, store SnapshotStore, backup *Snapshot, backupPath string) (string, error) {
+	diff, err := target.GetDiff(ctx, backup, true)
+	if errors.Is(err, ErrNoChanges) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to compute reverse diff: %w", err)
+	}
+	current, err := target.GetSnapshot(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get target snapshot: %w", err)
+	}
+	hash, err := SnapshotHash(current)
+	if err != nil {
+		return "", err
+	}
+	record := &UndoRecord{
+		Version:    UndoFormatVersion,
+		CreatedAt:  time.Now().UTC(),
+		TargetURL:  RedactURL(target.URL),
+		BackupPath: backupPath,
+		TargetHash: hash,
+		Summary:    SummarizeDiff(diff),
+		Diff:       diff,
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode undo record: %w", err)
+	}
+	objects, err := store.List(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list undo records: %w", err)
+	}
+	name := storedName(objects, undoPrefix, time.Now())
+	if err := store.Put(ctx, name, append(data, '\n')); err != nil {
+		return "", fmt.Errorf("failed to save undo record: %w", err)
+	}
+	return store.Location(name), nil
+}
+
+// ReadUndoRecord reads the undo record name from store.
+func ReadUndoRecord(ctx context.Context, store SnapshotStore, name string) (*UndoRecord, error) {
+	data, err := store.Get(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read undo record: %w", err)
+	}
+	var record UndoRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("undo record %s is corrupt: %w", store.Location(name), err)
+	}
+	switch {
+	case record.Version != UndoFormatVersion:
+		return nil, fmt.Errorf("undo record %s has format version %d, only version %d is supported", store.Location(name), record.Version, UndoFormatVersion)
+	case record.Diff == nil || record.Diff.Hash == "":
+		return nil, fmt.Errorf("undo record %s has no diff", store.Location(name))
+	}
+	return &record, nil
+}
+
+// LatestUndoRecord returns the newest undo record of targetURL in store with
+// its name, or ErrNoUndoRecord if there is none.
+func LatestUndoRecord(ctx context.Context, store SnapshotStore, targetURL string) (*UndoRecord, string, error) {
+	objects, err := store.List(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list undo records: %w", err)
+	}
+	records := storedObjects(objects, undoPrefix)
+	url := RedactURL(targetURL)
+	for i := len(records) - 1; i >= 0; i-- {
+		record, err := ReadUndoRecord(ctx, store, records[i].Name)
+		if err != nil {
+			return nil, "", err
+		}
+		if record.TargetURL == url {
+			return record, records[i].Name, nil
+		}
+	}
+	return nil, "", fmt.Errorf("%w for %s in %s", ErrNoUndoRecord, url, store.Location(""))
+}
+
+// CheckUndo verifies that record was saved for target and that the target
+// schema did not change since, returning ErrUndoDrifted if it did.
+func CheckUndo(ctx context.Context, target *DirectusClient, record *UndoRecord) error {
+	if url := RedactURL(target.URL); url != record.TargetURL {
+		return fmt.Errorf("undo record was saved for %s, not %s", record.TargetURL, url)
+	}
+	snapshot, err := target.GetSnapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get target snapshot: %w", err)
+	}
+	hash, err := SnapshotHash(snapshot)
+	if err != nil {
+		return err
+	}
+	if hash != record.TargetHash {
+		return fmt.Errorf("%w: the target schema hash is %s, the undo record expects %s", ErrUndoDrifted, hash, record.TargetHash)
+	}
+	return nil
+}
+
+// ApplyUndo applies the reverse diff of record to target after CheckUndo
+// succeeded.
+func ApplyUndo(ctx context.Context, target *DirectusClient, record *UndoRecord) error {
+	if err := CheckUndo(ctx, target, record); err != nil {
+		return err
+	}
+	return target.ApplyDiff(ctx, record.Diff)
+}
+
+// PruneUndoRecords removes all but the newest keep undo records saved to
+// store by RecordUndo, like PruneStoredBackups.
+func PruneUndoRecords(ctx context.Context, store SnapshotStore, keep int) error {
+	return pruneStored(ctx, store, undoPrefix, keep)
+}
+
+// storedObjects returns the objects named prefix*.json, oldest first by
+// modification time.
+func storedObjects(objects []StoredObject, prefix string) []StoredObject {
+	objects = slices.DeleteFunc(objects, func(o StoredObject) bool {
+		return !strings.HasPrefix(o.Name, prefix) || !strings.HasSuffix(o.Name, ".json")
+	})
+	slices.SortFunc(objects, func(a, b StoredObject) int {
+		if c := a.ModTime.Compare(b.ModTime); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return objects
+}
@@ -0,0 +1,71 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// migrateWithUndo migrates a target that keeps answering the diff, which then
+// also stands for the reverse diff, and returns the undo record saved.
+func migrateWithUndo(t *testing.T) (target *directustest.Server, record *gomigratedirectus.UndoRecord, f *directustest.Fixture) {
+	t.Helper()
+	ctx := context.Background()
+	base, target, f := newMigration(t)
+	target.KeepDiff(true)
+	result, err := gomigratedirectus.MigrateWithOptions(ctx, base.Client(quiet()...), target.Client(quiet()...),
+		gomigratedirectus.MigrationOptions{VerifyAfterApply: gomigratedirectus.VerifyOff})
+	if err != nil {
+		t.Fatalf("MigrateWithOptions: %v", err)
+	}
+	if result.UndoPath == "" {
+		t.Fatal("no undo record saved")
+	}
+	record, _, err = gomigratedirectus.LatestUndoRecord(ctx, gomigratedirectus.DirStore(gomigratedirectus.DefaultBackupDir), target.URL)
+	if err != nil {
+		t.Fatalf("LatestUndoRecord: %v", err)
+	}
+	return target, record, f
+}
+
+func TestApplyUndo(t *testing.T) {
+	target, record, f := migrateWithUndo(t)
+
+	if err := gomigratedirectus.ApplyUndo(context.Background(), target.Client(quiet()...), record); err != nil {
+		t.Fatalf("ApplyUndo: %v", err)
+	}
+	applied := target.ApplyRequests()
+	if len(applied) != 2 || applied[1].Hash != f.Diff.Hash {
+		t.Errorf("target applied %+v, want the diff and then the reverse diff", applied)
+	}
+}
+
+func TestApplyUndoDrifted(t *testing.T) {
+	target, record, f := migrateWithUndo(t)
+	drifted := *f.Snapshot
+	drifted.Collections = drifted.Collections[:1]
+	target.SetSnapshot(&drifted)
+
+	err := gomigratedirectus.ApplyUndo(context.Background(), target.Client(quiet()...), record)
+	if !errors.Is(err, gomigratedirectus.ErrUndoDrifted) {
+		t.Fatalf("ApplyUndo of a drifted target = %v, want ErrUndoDrifted", err)
+	}
+	if n := len(target.ApplyRequests()); n != 1 {
+		t.Errorf("target received %d applies, want only that of the migration", n)
+	}
+}
+
+func TestApplyUndoOtherTarget(t *testing.T) {
+	_, record, _ := migrateWithUndo(t)
+	other := directustest.NewServer(t)
+
+	if err := gomigratedirectus.ApplyUndo(context.Background(), other.Client(quiet()...), record); err == nil {
+		t.Fatal("ApplyUndo to another target succeeded")
+	}
+	if n := len(other.ApplyRequests()); n != 0 {
+		t.Errorf("other target received %d applies, want none", n)
+	}
+}
@@ -0,0 +1,301 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// User is a user of the project, as listed by /users. Extra holds the
+// remaining properties, such as first_name, last_name and language.
+type User struct {
+	ID     string  `json:"id,omitempty"`
+	Email  string  `json:"email"`
+	Role   *string `json:"role"`
+	Status string  `json:"status,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (u User) MarshalJSON() ([]byte, error) {
+	type plain User
+	return marshalWithExtra(plain(u), u.Extra)
+}
+
+func (u *User) UnmarshalJSON(data []byte) error {
+	type plain User
+	return unmarshalWithExtra(data, (*plain)(u), &u.Extra)
+}
+
+// userPrivateKeys are the user properties that are never copied: secrets,
+// which Directus masks on read anyway, the login provider, policies granted
+// directly, and bookkeeping of the base.
+var userPrivateKeys = []string{
+	"password", "tfa_secret", "token", "auth_data", "provider", "external_identifier",
+	"policies", "last_access", "last_page", "email_notifications",
+}
+
+// ListUsers returns all users of the project.
+func (c *DirectusClient) ListUsers(ctx context.Context) (_ []User, err error) {
+	ctx, done := startOperation(ctx, "list users", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var users []User
+	if err := c.doJSON(ctx, "list users", http.MethodGet, "/users", url.Values{"limit": {"-1"}}, nil, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// CreateUser creates user, ignoring its ID, with the given password.
+func (c *DirectusClient) CreateUser(ctx context.Context, user User, password string) (err error) {
+	ctx, done := startOperation(ctx, "create user", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	user.ID = ""
+	user.Extra = withoutKeys(user.Extra, userPrivateKeys)
+	encoded, err := json.Marshal(password)
+	if err != nil {
+		return fmt.Errorf("failed to marshal create user request: %w", err)
+	}
+	user.Extra["password"] = encoded
+	return c.doJSON(ctx, "create user", http.MethodPost, "/users", nil, user, nil)
+}
+
+// InviteUser has Directus send an invite email to email, which creates the
+// user with role once accepted. inviteURL, if not empty, is the page the
+// email links to; it must be allowed by USER_INVITE_URL_ALLOW_LIST.
+func (c *DirectusClient) InviteUser(ctx context.Context, email, role, inviteURL string) (err error) {
+	ctx, done := startOperation(ctx, "invite user", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	payload := map[string]string{"email": email, "role": role}
+	if inviteURL != "" {
+		payload["invite_url"] = inviteURL
+	}
+	return c.doJSON(ctx, "invite user", http.MethodPost, "/users/invite", nil, payload, nil)
+}
+
+// UserSyncOptions configures SyncUsers.
+type UserSyncOptions struct {
+	// DryRun only computes the changes; nothing is written.
+	DryRun bool
+	// Roles and Emails select the base users to provision: those with a role
+	// of one of these names and those with one of these emails, compared
+	// case-insensitively. At least one must be given.
+	Roles  []string
+	Emails []string
+	// Password is set on every created user. If empty, each user gets a
+	// generated password, returned in UsersResult.Passwords.
+	Password string
+	// Invite sends Directus invite emails instead of creating users with a
+	// password. InviteURL optionally overrides the page the emails link to.
+	Invite    bool
+	InviteURL string
+}
+
+// UsersResult is the result of SyncUsers. It lists the user emails, sorted.
+type UsersResult struct {
+	Created []string `json:"created,omitempty"`
+	Invited []string `json:"invited,omitempty"`
+	// Existing lists the selected users that already exist on the target by
+	// email; they are left alone.
+	Existing []string `json:"existing,omitempty"`
+	// SkippedAdmin lists the selected users with admin access, which are
+	// never provisioned.
+	SkippedAdmin []string `json:"skipped_admin,omitempty"`
+	// SkippedMissingRole lists the selected users whose role does not exist
+	// on the target by name.
+	SkippedMissingRole []string `json:"skipped_missing_role,omitempty"`
+	// MissingEmails lists the requested emails the base has no user for.
+	MissingEmails []string `json:"missing_emails,omitempty"`
+	// Passwords holds the generated passwords by email. It is never part of
+	// the JSON report.
+	Passwords map[string]string `json:"-"`
+	// DryRun reports that the changes were only computed.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Changed reports whether any user was created or invited.
+func (r *UsersResult) Changed() bool {
+	return len(r.Created)+len(r.Invited) > 0
+}
+
+// SyncUsers provisions the selected non-admin users of base on target, mapping
+// their role by name, for example to populate ephemeral review environments.
+// Users that already exist on the target by email are skipped, as are users
+// with admin access and users whose role is missing on the target, so roles
+// should be synced first. Password hashes, two-factor secrets, static tokens
+// and other private properties are never copied: users get opts.Password or
+// a generated password, or an invite email with opts.Invite.
+func SyncUsers(ctx context.Context, base, target *DirectusClient, opts UserSyncOptions) (*UsersResult, error) {
+	if len(opts.Roles) == 0 && len(opts.Emails) == 0 {
+		return nil, fmt.Errorf("no users selected, give roles or emails")
+	}
+	baseUsers, err := base.ListUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list base users: %w", err)
+	}
+	baseRoles, err := base.ListRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list base roles: %w", err)
+	}
+	adminRoles, adminUsers, err := admins(ctx, base, baseRoles)
+	if err != nil {
+		return nil, err
+	}
+	targetUsers, err := target.ListUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target users: %w", err)
+	}
+	targetRoles, err := target.ListRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target roles: %w", err)
+	}
+
+	baseRoleNames := map[string]string{}
+	for _, role := range baseRoles {
+		baseRoleNames[role.ID] = role.Name
+	}
+	targetRoleIDs := map[string]string{}
+	for _, role := range targetRoles {
+		targetRoleIDs[role.Name] = role.ID
+	}
+	existing := map[string]bool{}
+	for _, user := range targetUsers {
+		existing[strings.ToLower(user.Email)] = true
+	}
+	emails := map[string]bool{}
+	for _, email := range opts.Emails {
+		emails[strings.ToLower(email)] = true
+	}
+
+	result := &UsersResult{DryRun: opts.DryRun}
+	slices.SortFunc(baseUsers, func(a, b User) int { return strings.Compare(strings.ToLower(a.Email), strings.ToLower(b.Email)) })
+	for _, user := range baseUsers {
+		email := strings.ToLower(user.Email)
+		roleName := ""
+		if user.Role != nil {
+			roleName = baseRoleNames[*user.Role]
+		}
+		if user.Email == "" || (!emails[email] && (roleName == "" || !slices.Contains(opts.Roles, roleName))) {
+			continue
+		}
+		delete(emails, email)
+		switch {
+		case adminUsers[user.ID] || (user.Role != nil && adminRoles[*user.Role]):
+			result.SkippedAdmin = append(result.SkippedAdmin, user.Email)
+			continue
+		case existing[email]:
+			result.Existing = append(result.Existing, user.Email)
+			continue
+		}
+		if user.Role != nil {
+			id, ok := targetRoleIDs[roleName]
+			if !ok {
+				result.SkippedMissingRole = append(result.SkippedMissingRole, user.Email)
+				continue
+			}
+			user.Role = &id
+		}
+
+		if opts.Invite {
+			result.Invited = append(result.Invited, user.Email)
+			if !opts.DryRun {
+				role := ""
+				if user.Role != nil {
+					role = *user.Role
+				}
+				if err := target.InviteUser(ctx, user.Email, role, opts.InviteURL); err != nil {
+					return result, fmt.Errorf("failed to invite user %s: %w", user.Email, err)
+				}
+			}
+			continue
+		}
+		result.Created = append(result.Created, user.Email)
+		if opts.DryRun {
+			continue
+		}
+		password := opts.Password
+		if password == "" {
+			password = rand.Text()
+			if result.Passwords == nil {
+				result.Passwords = map[string]string{}
+			}
+			result.Passwords[user.Email] = password
+		}
+		if err := target.CreateUser(ctx, user, password); err != nil {
+			return result, fmt.Errorf("failed to create user %s: %w", user.Email, err)
+		}
+	}
+	for _, email := range opts.Emails {
+		if emails[strings.ToLower(email)] {
+			result.MissingEmails = append(result.MissingEmails, email)
+			delete(emails, strings.ToLower(email))
+		}
+	}
+	slices.Sort(result.MissingEmails)
+	return result, nil
+}
+
+// RenderPasswords writes the generated passwords of UsersResult, one
+// "email<TAB>password" line per user, sorted by email.
+func RenderPasswords(passwords map[string]string, w io.Writer) error {
+	for _, email := range slices.Sorted(maps.Keys(passwords)) {
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", email, passwords[email]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// admins returns the IDs of the roles and users with admin access: roles with
+// admin_access with the role model, and the roles and users granted an admin
+// policy with the policy model.
+func admins(ctx context.Context, client *DirectusClient, roles []Role) (adminRoles, adminUsers map[string]bool, err error) {
+	model, err := client.PermissionModel(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to detect base permission model: %w", err)
+	}
+	adminRoles, adminUsers = map[string]bool{}, map[string]bool{}
+	if model == PermissionModelRoles {
+		for _, role := range roles {
+			if role.AdminAccess {
+				adminRoles[role.ID] = true
+			}
+		}
+		return adminRoles, adminUsers, nil
+	}
+
+	policies, err := client.ListPolicies(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list base policies: %w", err)
+	}
+	access, err := client.ListAccess(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list base access: %w", err)
+	}
+	adminPolicies := map[string]bool{}
+	for _, policy := range policies {
+		if policy.AdminAccess {
+			adminPolicies[policy.ID] = true
+		}
+	}
+	for _, row := range access {
+		switch {
+		case !adminPolicies[row.Policy]:
+		case row.Role != nil:
+			adminRoles[*row.Role] = true
+		case row.User != nil:
+			adminUsers[*row.User] = true
+		}
+	}
+	return adminRoles, adminUsers, nil
+}
@@ -0,0 +1,256 @@
+package gomirgratedirectus
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationProblem is a single issue found by ValidateSnapshot. Path locates
+// the offending value in JSON-path-like notation, such as
+// "fields[12].collection".
+type ValidationProblem struct {
+	Path    string
+	Message string
+}
+
+func (p ValidationProblem) String() string {
+	return p.Path + ": " + p.Message
+}
+
+// ValidationError lists every problem found in a snapshot.
+type ValidationError struct {
+	Problems []ValidationProblem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		lines[i] = "  " + problem.String()
+	}
+	return fmt.Sprintf("snapshot is invalid (%d problems):\n%s", len(e.Problems), strings.Join(lines, "\n"))
+}
+
+// IsSystemCollection reports whether name is one of the directus_* system
+// collections, which snapshots reference but never list.
+func IsSystemCollection(name string) bool {
+	return strings.HasPrefix(name, "directus_")
+}
+
+// ValidateSnapshot checks a snapshot for problems that would make
+// /schema/diff fail with an opaque error, typically in hand-edited files: the
+// required top-level keys must be present, collection names must be unique,
+// every field must belong to an existing collection, and every relation must
+// reference existing collections and fields. All problems are reported at once
+// in a *ValidationError.
+func ValidateSnapshot(snapshot *Snapshot) error {
+	var problems []ValidationProblem
+	report := func(path, format string, args ...any) {
+		problems = append(problems, ValidationProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if snapshot == nil {
+		return &ValidationError{Problems: []ValidationProblem{{Path: "$", Message: "snapshot is empty"}}}
+	}
+	if snapshot.Version == 0 {
+		report("version", "required key is missing")
+	}
+	if snapshot.Directus == "" {
+		report("directus", "required key is missing")
+	}
+	if snapshot.Collections == nil {
+		report("collections", "required key is missing")
+	}
+	if snapshot.Fields == nil {
+		report("fields", "required key is missing")
+	}
+	if snapshot.Relations == nil {
+		report("relations", "required key is missing")
+	}
+
+	collections := make(map[string]int, len(snapshot.Collections))
+	for i, collection := range snapshot.Collections {
+		path := fmt.Sprintf("collections[%d].collection", i)
+		if collection.Collection == "" {
+			report(path, "collection name is empty")
+			continue
+		}
+		if first, ok := collections[collection.Collection]; ok {
+			report(path, "duplicate collection %q, first defined at collections[%d]", collection.Collection, first)
+			continue
+		}
+		collections[collection.Collection] = i
+	}
+	collectionExists := func(name string) bool {
+		_, ok := collections[name]
+		return ok || IsSystemCollection(name)
+	}
+
+	fields := make(map[string]int, len(snapshot.Fields))
+	for i, field := range snapshot.Fields {
+		path := fmt.Sprintf("fields[%d]", i)
+		if field.Collection == "" || field.Field == "" {
+			report(path, "field must have both collection and field")
+			continue
+		}
+		if !collectionExists(field.Collection) {
+			report(path+".collection", "field %s.%s references unknown collection %q", field.Collection, field.Field, field.Collection)
+		}
+		key := field.Collection + "." + field.Field
+		if first, ok := fields[key]; ok {
+			report(path+".field", "duplicate field %s, first defined at fields[%d]", key, first)
+			continue
+		}
+		fields[key] = i
+	}
+	fieldExists := func(collection, field string) bool {
+		_, ok := fields[collection+"."+field]
+		return ok || IsSystemCollection(collection)
+	}
+
+	for i, relation := range snapshot.Relations {
+		path := fmt.Sprintf("relations[%d]", i)
+		if !collectionExists(relation.Collection) {
+			report(path+".collection", "relation references unknown collection %q", relation.Collection)
+		} else if !fieldExists(relation.Collection, relation.Field) {
+			report(path+".field", "relation references unknown field %s.%s", relation.Collection, relation.Field)
+		}
+		// related_collection is null for many-to-any relations.
+		if relation.RelatedCollection != "" && !collectionExists(relation.RelatedCollection) {
+			report(path+".related_collection", "relation references unknown collection %q", relation.RelatedCollection)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// systemPrimaryKeyTypes are the primary key types of the system collections
+// relations commonly point at, which snapshots do not list.
+var systemPrimaryKeyTypes = map[string]string{
+	"directus_files":    "uuid",
+	"directus_folders":  "uuid",
+	"directus_policies": "uuid",
+	"directus_roles":    "uuid",
+	"directus_users":    "uuid",
+}
+
+// keyTypeFamily groups the field types that can hold the same keys, so that
+// an integer foreign key may reference a bigInteger primary key.
+func keyTypeFamily(fieldType string) string {
+	switch fieldType {
+	case "integer", "bigInteger":
+		return "integer"
+	case "string", "text":
+		return "string"
+	}
+	return fieldType
+}
+
+// ValidateRelations checks the relation graph of a snapshot more deeply than
+// ValidateSnapshot, typically for hand-merged files in which a collection was
+// renamed: the collections and fields every relation and its meta reference
+// must exist, the foreign key field must have a type compatible with the
+// field it references, by default the primary key of the related collection,
+// and the junction collection of a many-to-many relation must hold both
+// foreign key fields, each with its relation. All problems are reported at
+// once in a *ValidationError.
+func ValidateRelations(snapshot *Snapshot) error {
+	var problems []ValidationProblem
+	report := func(path, format string, args ...any) {
+		problems = append(problems, ValidationProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	collections := make(map[string]bool, len(snapshot.Collections))
+	for _, collection := range snapshot.Collections {
+		collections[collection.Collection] = true
+	}
+	fields := make(map[string]Field, len(snapshot.Fields))
+	primaryKeys := map[string]Field{}
+	for _, field := range snapshot.Fields {
+		fields[field.Collection+"."+field.Field] = field
+		if isPrimaryKey, _ := field.Schema["is_primary_key"].(bool); isPrimaryKey {
+			primaryKeys[field.Collection] = field
+		}
+	}
+	relations := make(map[string]bool, len(snapshot.Relations))
+	for _, relation := range snapshot.Relations {
+		relations[relation.Collection+"."+relation.Field] = true
+	}
+	// checkCollection reports a referenced collection that does not exist.
+	checkCollection := func(path, role, name string) bool {
+		if collections[name] || IsSystemCollection(name) {
+			return true
+		}
+		report(path, "%s collection %q does not exist", role, name)
+		return false
+	}
+	// checkField reports a referenced field that does not exist.
+	checkField := func(path, role, collection, field string) bool {
+		if _, ok := fields[collection+"."+field]; ok || IsSystemCollection(collection) {
+			return true
+		}
+		report(path, "%s field %s.%s does not exist", role, collection, field)
+		return false
+	}
+
+	for i, relation := range snapshot.Relations {
+		path := fmt.Sprintf("relations[%d]", i)
+		if relation.Collection == "" || relation.Field == "" {
+			report(path, "relation must have both collection and field")
+			continue
+		}
+		manyOK := checkCollection(path+".collection", "many", relation.Collection) &&
+			checkField(path+".field", "foreign key", relation.Collection, relation.Field)
+		oneOK := relation.RelatedCollection == "" || checkCollection(path+".related_collection", "one", relation.RelatedCollection)
+
+		if oneField, _ := relation.Meta["one_field"].(string); oneField != "" && relation.RelatedCollection != "" && oneOK {
+			checkField(path+".meta.one_field", "alias", relation.RelatedCollection, oneField)
+		}
+		if allowed, ok := relation.Meta["one_allowed_collections"].([]any); ok {
+			for j, name := range allowed {
+				if name, ok := name.(string); ok {
+					checkCollection(fmt.Sprintf("%s.meta.one_allowed_collections[%d]", path, j), "allowed", name)
+				}
+			}
+		}
+		if field, _ := relation.Meta["one_collection_field"].(string); field != "" && manyOK {
+			checkField(path+".meta.one_collection_field", "collection", relation.Collection, field)
+		}
+		if junctionField, _ := relation.Meta["junction_field"].(string); junctionField != "" && manyOK {
+			if checkField(path+".meta.junction_field", "junction", relation.Collection, junctionField) &&
+				!relations[relation.Collection+"."+junctionField] {
+				report(path+".meta.junction_field", "junction collection %s has no relation for its field %s", relation.Collection, junctionField)
+			}
+		}
+
+		if !manyOK || !oneOK || relation.RelatedCollection == "" {
+			continue
+		}
+		foreignKey := fields[relation.Collection+"."+relation.Field]
+		if IsSystemCollection(relation.Collection) || foreignKey.Type == "alias" {
+			continue
+		}
+		var target, targetType string
+		if column, _ := relation.Schema["foreign_key_column"].(string); column != "" && !IsSystemCollection(relation.RelatedCollection) {
+			if !checkField(path+".schema.foreign_key_column", "referenced", relation.RelatedCollection, column) {
+				continue
+			}
+			target, targetType = relation.RelatedCollection+"."+column, fields[relation.RelatedCollection+"."+column].Type
+		} else if key, ok := primaryKeys[relation.RelatedCollection]; ok {
+			target, targetType = key.Collection+"."+key.Field, key.Type
+		} else if keyType, ok := systemPrimaryKeyTypes[relation.RelatedCollection]; ok {
+			target, targetType = relation.RelatedCollection+".id", keyType
+		}
+		if targetType != "" && keyTypeFamily(foreignKey.Type) != keyTypeFamily(targetType) {
+			report(path+".field", "foreign key %s.%s of type %s cannot reference %s of type %s",
+				relation.Collection, relation.Field, foreignKey.Type, target, targetType)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// VerifyPolicy tells MigrateWithOptions what to do when the target still
+// differs from the base snapshot once the diff was applied, as happens when
+// Directus accepts a change it stores differently, such as enum choices
+// whose case a database vendor folds.
+type VerifyPolicy string
+
+const (
+	// VerifyWarn reports the residual differences and lets the migration
+	// succeed. It is the default.
+	VerifyWarn VerifyPolicy = "warn"
+	// VerifyFail fails the migration with ErrNotInSync, which stays
+	// applied.
+	VerifyFail VerifyPolicy = "fail"
+	// VerifyOff skips the verification.
+	VerifyOff VerifyPolicy = "off"
+)
+
+// Validate reports an unknown policy.
+func (p VerifyPolicy) Validate() error {
+	switch p {
+	case "", VerifyWarn, VerifyFail, VerifyOff:
+		return nil
+	}
+	return fmt.Errorf("unknown verify policy %q, expected %s, %s or %s", p, VerifyWarn, VerifyFail, VerifyOff)
+}
+
+// verify diffs snapshot, the base snapshot just applied, against targetClient
+// again, narrowed like the diff that was applied, and records what is left in
+// result. An error is returned only with VerifyFail.
+func (m *migration) verify(ctx context.Context, snapshot *Snapshot, targetClient *DirectusClient, result *MigrationResult) error {
+	m.emit(&VerifyStarted{})
+	residual, err := m.residualDiff(ctx, snapshot, targetClient)
+	if err != nil {
+		err = fmt.Errorf("failed to verify target: %w", err)
+		if m.opts.VerifyAfterApply == VerifyFail {
+			return m.fail(PhaseVerify, err)
+		}
+		m.emit(&VerifyCompleted{Err: err})
+		return nil
+	}
+	result.Verified = true
+	if residual != nil {
+		result.Residual = residual
+		result.ResidualSummary = m.summarize(residual)
+	}
+	m.emit(&VerifyCompleted{Residual: result.Residual, Summary: result.ResidualSummary})
+	if residual != nil && m.opts.VerifyAfterApply == VerifyFail {
+		return m.fail(PhaseVerify, fmt.Errorf("%w: %s pending", ErrNotInSync, result.ResidualSummary))
+	}
+	return nil
+}
+
+// residualDiff returns the diff of snapshot against targetClient after the
+// filters, the scope, the selected changes and opts.BeforeApply, nil when it
+// is empty.
+func (m *migration) residualDiff(ctx context.Context, snapshot *Snapshot, targetClient *DirectusClient) (*Diff, error) {
+	diff, err := targetClient.GetDiff(ctx, snapshot, m.opts.Force)
+	if errors.Is(err, ErrNoChanges) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if diff = m.narrowDiff(diff); diff.IsEmpty() {
+		return nil, nil
+	}
+	if m.opts.BeforeApply != nil {
+		if diff, err = m.opts.BeforeApply(ctx, diff); err != nil {
+			return nil, fmt.Errorf("before apply callback failed: %w", err)
+		}
+		if diff == nil || diff.IsEmpty() {
+			return nil, nil
+		}
+	}
+	return diff, nil
+}
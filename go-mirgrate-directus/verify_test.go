@@ -0,0 +1,59 @@
+package gomirgratedirectus_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+func TestVerifyAfterApply(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       gomigratedirectus.VerifyPolicy
+		residual     bool
+		wantErr      error
+		wantResidual bool
+		wantDiffs    int
+	}{
+		{"in sync", gomigratedirectus.VerifyWarn, false, nil, false, 2},
+		{"warn", gomigratedirectus.VerifyWarn, true, nil, true, 2},
+		{"default warns", "", true, nil, true, 2},
+		{"fail", gomigratedirectus.VerifyFail, true, gomigratedirectus.ErrNotInSync, true, 2},
+		{"fail in sync", gomigratedirectus.VerifyFail, false, nil, false, 2},
+		{"off", gomigratedirectus.VerifyOff, true, nil, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, target, f := newMigration(t)
+			if tt.residual {
+				// Directus stored one of the fields differently than sent.
+				residual := &gomigratedirectus.Diff{Hash: "residual"}
+				residual.Diff.Fields = f.Diff.Diff.Fields[len(f.Diff.Diff.Fields)-1:]
+				target.SetResidualDiff(residual)
+			}
+
+			result, err := gomigratedirectus.MigrateWithOptions(context.Background(), base.Client(quiet()...), target.Client(quiet()...),
+				gomigratedirectus.MigrationOptions{NoBackup: true, VerifyAfterApply: tt.policy})
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MigrateWithOptions = %v, want %v", err, tt.wantErr)
+			}
+			if !result.Applied {
+				t.Error("diff not applied, want it applied whatever the verification found")
+			}
+			if got := result.Residual != nil; got != tt.wantResidual {
+				t.Errorf("Residual = %+v, want residual %v", result.Residual, tt.wantResidual)
+			}
+			if tt.wantResidual && result.ResidualSummary.Fields.Total() != 1 {
+				t.Errorf("ResidualSummary = %+v, want the one field left", result.ResidualSummary)
+			}
+			if verified := tt.policy != gomigratedirectus.VerifyOff; result.Verified != verified {
+				t.Errorf("Verified = %v, want %v", result.Verified, verified)
+			}
+			if n := len(target.DiffRequests()); n != tt.wantDiffs {
+				t.Errorf("target diffed %d times, want %d", n, tt.wantDiffs)
+			}
+		})
+	}
+}
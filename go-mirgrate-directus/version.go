@@ -0,0 +1,104 @@
+package gomirgratedirectus
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// modulePath is the path of this module, looked up in the build info of the
+// binary.
+const modulePath = "github.com/SymphonyIceAttack/go-mirgrate-directus"
+
+// Version, Commit and BuildDate describe the build, as reported by
+// GetBuildInfo, in the User-Agent header and in the history. Release builds
+// set them with
+// -ldflags "-X github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus.Version=v1.2.3 -X ...Commit=$(git rev-parse HEAD) -X ...BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)".
+// Left unset, they are taken from the module version and the VCS stamp Go
+// records in binaries built with go install or go build.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// BuildInfo describes the build of the binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	// Modified is set when the binary was built from a work tree with
+	// uncommitted changes.
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// String returns the version followed by the short commit, such as
+// "v1.2.3 (0123abcd4567)", as recorded in HistoryEntry.ToolVersion.
+func (b BuildInfo) String() string {
+	if b.Commit == "" {
+		return b.Version
+	}
+	commit := b.Commit
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if b.Modified {
+		commit += "-dirty"
+	}
+	return b.Version + " (" + commit + ")"
+}
+
+// GetBuildInfo returns the build of the binary, from Version, Commit and
+// BuildDate or, when they are unset, from the build info of the binary.
+func GetBuildInfo() BuildInfo {
+	info := embeddedBuildInfo()
+	if Version != "dev" || info.Version == "" {
+		info.Version = Version
+	}
+	if Commit != "" {
+		info.Commit, info.Modified = Commit, false
+	}
+	if BuildDate != "" {
+		info.BuildDate = BuildDate
+	}
+	return info
+}
+
+// embeddedBuildInfo reads the version of this module and, when it is the main
+// module, the VCS stamp from the build info Go embeds in binaries.
+var embeddedBuildInfo = sync.OnceValue(func() BuildInfo {
+	info := BuildInfo{GoVersion: runtime.Version()}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if build.Main.Path != modulePath {
+		for _, dep := range build.Deps {
+			if dep.Path == modulePath {
+				info.Version = dep.Version
+			}
+		}
+		return info
+	}
+	if build.Main.Version != "(devel)" {
+		info.Version = build.Main.Version
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Commit = setting.Value
+		case "vcs.time":
+			info.BuildDate = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+})
+
+// DefaultUserAgent returns the User-Agent sent when no WithUserAgent option is
+// given, such as "go-migrate-directus/v1.2.3 (0123abcd4567)".
+func DefaultUserAgent() string {
+	return "go-migrate-directus/" + GetBuildInfo().String()
+}
@@ -0,0 +1,148 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Defaults of WatchOptions.
+const (
+	DefaultWatchInterval   = 30 * time.Second
+	DefaultWatchMaxBackoff = 5 * time.Minute
+)
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	// Interval is the time between two polls of the base snapshot. It
+	// defaults to DefaultWatchInterval.
+	Interval time.Duration
+	// MaxBackoff caps the delay between polls while the base is
+	// unreachable, which doubles with every failed poll starting from
+	// Interval. It defaults to DefaultWatchMaxBackoff.
+	MaxBackoff time.Duration
+	// MaxRuns, if positive, makes Watch return after this many polls, once
+	// the sync they started has finished.
+	MaxRuns int
+	// Migration configures the syncs, which run MigrateWithOptions. Its
+	// Source must be nil, as the base client is polled.
+	Migration MigrationOptions
+}
+
+// Watch polls the snapshot of baseClient every opts.Interval and migrates
+// targetClient whenever it changed, for example to have a local project track
+// a shared development instance. Changes are detected with SnapshotHash; the
+// first poll always syncs. A sync runs in the background while polling goes
+// on, and changes found while it is still running are only synced once it has
+// finished, by a later poll. A failed sync is logged and retried by the next
+// poll. The snapshot is polled with GetSnapshotIfChanged, so an unchanged one
+// is neither decoded nor hashed again, nor even downloaded when the base
+// supports conditional requests.
+//
+// Watch returns nil once ctx is canceled or opts.MaxRuns polls were made. A
+// sync in progress is finished first rather than interrupted, so that an
+// apply is never cut short.
+func Watch(ctx context.Context, baseClient, targetClient *DirectusClient, opts WatchOptions) error {
+	if opts.Migration.Source != nil {
+		return fmt.Errorf("watch polls the base project, a snapshot source cannot be used")
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	maxBackoff := opts.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultWatchMaxBackoff
+	}
+	logger := opts.Migration.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		running  bool
+		lastHash string
+		// polled is the last snapshot polled, of hash polledHash, which is
+		// only downloaded and hashed again once it changed.
+		polled     *ConditionalSnapshot
+		polledHash string
+	)
+	defer wg.Wait()
+
+	delay, failures := time.Duration(0), 0
+	for polls := 0; opts.MaxRuns <= 0 || polls < opts.MaxRuns; polls++ {
+		if polls > 0 {
+			select {
+			case <-ctx.Done():
+				logger.Info("stopping watch")
+				return nil
+			case <-time.After(delay):
+			}
+		}
+
+		current, modified, err := baseClient.GetSnapshotIfChanged(ctx, polled)
+		if err != nil {
+			if ctx.Err() != nil {
+				logger.Info("stopping watch")
+				return nil
+			}
+			failures++
+			delay = min(interval<<min(failures, 16), maxBackoff)
+			logger.Warn("base project unreachable, backing off", "error", err, "retry_in", delay)
+			continue
+		}
+		failures, delay = 0, interval
+		if modified {
+			if polledHash, err = SnapshotHash(current.Snapshot); err != nil {
+				return err
+			}
+		}
+		polled = current
+		snapshot, hash := current.Snapshot, polledHash
+
+		mu.Lock()
+		changed, busy := hash != lastHash, running
+		if changed && !busy {
+			running = true
+		}
+		mu.Unlock()
+		switch {
+		case !changed:
+			logger.Debug("base schema unchanged", "hash", hash)
+			continue
+		case busy:
+			logger.Warn("base schema changed while the previous sync is still running, syncing later", "hash", hash)
+			continue
+		}
+
+		logger.Info("base schema changed, syncing", "hash", hash)
+		migration := opts.Migration
+		migration.Logger = logger
+		// The sync migrates the snapshot that was polled, not a newer one.
+		source := &onceSource{source: ClientSource(baseClient)}
+		if source.snapshot, err = json.Marshal(snapshot); err != nil {
+			return fmt.Errorf("failed to encode snapshot: %w", err)
+		}
+		migration.Source = source
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := MigrateWithOptions(context.WithoutCancel(ctx), baseClient, targetClient, migration)
+			mu.Lock()
+			defer mu.Unlock()
+			running = false
+			if err != nil {
+				logger.Error("sync failed, retrying on the next poll", "error", err)
+				return
+			}
+			lastHash = hash
+			logger.Info("sync completed", "hash", hash, "changed", result.Changed, "applied", result.Applied)
+		}()
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package gomirgratedirectus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Webhook is a legacy webhook, as listed by /webhooks. Directus 10 deprecated
+// webhooks in favor of flows and Directus 11 removed them. Extra holds the
+// remaining properties, such as method, actions, collections and headers.
+type Webhook struct {
+	ID     json.Number `json:"id,omitempty"`
+	Name   string      `json:"name"`
+	URL    string      `json:"url"`
+	Status string      `json:"status,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+func (w Webhook) MarshalJSON() ([]byte, error) {
+	type plain Webhook
+	return marshalWithExtra(plain(w), w.Extra)
+}
+
+func (w *Webhook) UnmarshalJSON(data []byte) error {
+	type plain Webhook
+	return unmarshalWithExtra(data, (*plain)(w), &w.Extra)
+}
+
+// Webhook statuses.
+const (
+	WebhookStatusActive   = "active"
+	WebhookStatusInactive = "inactive"
+)
+
+// ErrWebhooksUnsupported is returned by ListWebhooks when the instance has no
+// /webhooks endpoint, as with Directus 11.
+var ErrWebhooksUnsupported = errors.New("instance does not support legacy webhooks, migrate them to flows")
+
+// ListWebhooks returns all webhooks of the project.
+func (c *DirectusClient) ListWebhooks(ctx context.Context) (_ []Webhook, err error) {
+	ctx, done := startOperation(ctx, "list webhooks", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	var webhooks []Webhook
+	err = c.doJSON(ctx, "list webhooks", http.MethodGet, "/webhooks", url.Values{"limit": {"-1"}}, nil, &webhooks)
+	var directusErr *DirectusError
+	if errors.As(err, &directusErr) && directusErr.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %w", ErrWebhooksUnsupported, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// CreateWebhook creates webhook, ignoring its ID.
+func (c *DirectusClient) CreateWebhook(ctx context.Context, webhook Webhook) (err error) {
+	ctx, done := startOperation(ctx, "create webhook", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	webhook.ID = ""
+	return c.doJSON(ctx, "create webhook", http.MethodPost, "/webhooks", nil, webhook, nil)
+}
+
+// UpdateWebhook replaces the properties of the webhook with the given ID with
+// those of webhook.
+func (c *DirectusClient) UpdateWebhook(ctx context.Context, id string, webhook Webhook) (err error) {
+	ctx, done := startOperation(ctx, "update webhook", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	webhook.ID = ""
+	return c.doJSON(ctx, "update webhook", http.MethodPatch, "/webhooks/"+url.PathEscape(id), nil, webhook, nil)
+}
+
+// DeleteWebhook deletes the webhook with the given ID.
+func (c *DirectusClient) DeleteWebhook(ctx context.Context, id string) (err error) {
+	ctx, done := startOperation(ctx, "delete webhook", c.Timeouts.Metadata)
+	defer func() { err = done(err) }()
+
+	return c.doJSON(ctx, "delete webhook", http.MethodDelete, "/webhooks/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// WebhookPrunePolicy tells SyncWebhooks what to do with the webhooks that
+// only exist on the target.
+type WebhookPrunePolicy string
+
+const (
+	// WebhookPruneNone leaves target-only webhooks alone. It is the default.
+	WebhookPruneNone WebhookPrunePolicy = "none"
+	// WebhookPruneDeactivate sets target-only webhooks to inactive, so that
+	// they can still be inspected or restored.
+	WebhookPruneDeactivate WebhookPrunePolicy = "deactivate"
+	// WebhookPruneDelete deletes target-only webhooks.
+	WebhookPruneDelete WebhookPrunePolicy = "delete"
+)
+
+// WebhookSyncOptions configures SyncWebhooks.
+type WebhookSyncOptions struct {
+	// DryRun only computes the changes; nothing is written.
+	DryRun bool
+	// Prune decides what happens to target-only webhooks; empty means
+	// WebhookPruneNone.
+	Prune WebhookPrunePolicy
+	// URLs maps parts of base webhook URLs, such as
+	// https://hooks.dev.example.com, to their replacement on the target.
+	// Longer strings are replaced first.
+	URLs map[string]string
+}
+
+// WebhooksResult is the result of SyncWebhooks. It lists the webhook names,
+// sorted.
+type WebhooksResult struct {
+	Created     []string `json:"created,omitempty"`
+	Updated     []string `json:"updated,omitempty"`
+	Deactivated []string `json:"deactivated,omitempty"`
+	Deleted     []string `json:"deleted,omitempty"`
+	// DryRun reports that the changes were only computed.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// Changed reports whether any webhook changed.
+func (r *WebhooksResult) Changed() bool {
+	return len(r.Created)+len(r.Updated)+len(r.Deactivated)+len(r.Deleted) > 0
+}
+
+// SyncWebhooks copies the legacy webhooks of base to target. Webhooks are
+// matched by name: missing ones are created and ones with a different URL,
+// method, collections, actions or other setting are updated. Base URLs are
+// rewritten with opts.URLs first, since webhook receivers usually differ per
+// environment. Target-only webhooks are handled according to opts.Prune.
+func SyncWebhooks(ctx context.Context, base, target *DirectusClient, opts WebhookSyncOptions) (*WebhooksResult, error) {
+	switch opts.Prune {
+	case "", WebhookPruneNone, WebhookPruneDeactivate, WebhookPruneDelete:
+	default:
+		return nil, fmt.Errorf("invalid webhook prune policy %q, expected none, deactivate or delete", opts.Prune)
+	}
+	baseWebhooks, err := base.ListWebhooks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list base webhooks: %w", err)
+	}
+	targetWebhooks, err := target.ListWebhooks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target webhooks: %w", err)
+	}
+
+	result := &WebhooksResult{DryRun: opts.DryRun}
+	replacer := substitutionReplacer(opts.URLs)
+	slices.SortFunc(baseWebhooks, func(a, b Webhook) int { return strings.Compare(a.Name, b.Name) })
+	existing := indexByName(targetWebhooks, func(w Webhook) string { return w.Name })
+	for _, webhook := range baseWebhooks {
+		if replacer != nil {
+			webhook.URL = replacer.Replace(webhook.URL)
+		}
+		current, ok := existing[webhook.Name]
+		delete(existing, webhook.Name)
+		switch {
+		case !ok:
+			result.Created = append(result.Created, webhook.Name)
+			if !opts.DryRun {
+				if err := target.CreateWebhook(ctx, webhook); err != nil {
+					return result, fmt.Errorf("failed to create webhook %s: %w", webhook.Name, err)
+				}
+			}
+		case !sameExceptID(webhook, current):
+			result.Updated = append(result.Updated, webhook.Name)
+			if !opts.DryRun {
+				if err := target.UpdateWebhook(ctx, current.ID.String(), webhook); err != nil {
+					return result, fmt.Errorf("failed to update webhook %s: %w", webhook.Name, err)
+				}
+			}
+		}
+	}
+
+	stale := slices.SortedFunc(maps.Values(existing), func(a, b Webhook) int { return strings.Compare(a.Name, b.Name) })
+	for _, webhook := range stale {
+		switch opts.Prune {
+		case WebhookPruneDeactivate:
+			if webhook.Status == WebhookStatusInactive {
+				continue
+			}
+			result.Deactivated = append(result.Deactivated, webhook.Name)
+			if !opts.DryRun {
+				webhook.Status = WebhookStatusInactive
+				if err := target.UpdateWebhook(ctx, webhook.ID.String(), webhook); err != nil {
+					return result, fmt.Errorf("failed to deactivate webhook %s: %w", webhook.Name, err)
+				}
+			}
+		case WebhookPruneDelete:
+			result.Deleted = append(result.Deleted, webhook.Name)
+			if !opts.DryRun {
+				if err := target.DeleteWebhook(ctx, webhook.ID.String()); err != nil {
+					return result, fmt.Errorf("failed to delete webhook %s: %w", webhook.Name, err)
+				}
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// historyFlags configures the migration history recorded on the target.
+type historyFlags struct {
+	enabled    *bool
+	collection *string
+	operator   *string
+}
+
+// addHistoryFlags registers --record-history, --history-collection and
+// --operator.
+func addHistoryFlags(cmd *command) historyFlags {
+	return historyFlags{
+		enabled:    cmd.Bool("record-history", "RECORD_HISTORY", false, "record every apply in a history collection on the target"),
+		collection: addHistoryCollectionFlag(cmd),
+		operator:   cmd.String("operator", "MIGRATION_OPERATOR", os.Getenv("USER"), "who runs the migration, as recorded in the history"),
+	}
+}
+
+// addHistoryCollectionFlag registers --history-collection.
+func addHistoryCollectionFlag(cmd *command) *string {
+	return cmd.String("history-collection", "HISTORY_COLLECTION", gomigratedirectus.DefaultHistoryCollection, "collection the migration history is recorded in")
+}
+
+// apply copies the flags to opts.
+func (f historyFlags) apply(opts *gomigratedirectus.MigrationOptions) {
+	opts.RecordHistory = *f.enabled
+	opts.HistoryCollection = *f.collection
+	opts.Operator = *f.operator
+}
+
+// ensure creates the history collection on client if it is recorded and
+// missing.
+func (f historyFlags) ensure(ctx context.Context, client *gomigratedirectus.DirectusClient) error {
+	if !*f.enabled {
+		return nil
+	}
+	created, err := client.EnsureHistoryCollection(ctx, *f.collection)
+	if err != nil {
+		return fmt.Errorf("failed to create history collection %s: %w", *f.collection, err)
+	}
+	if created {
+		slog.Info("history collection created", "collection", *f.collection)
+	}
+	return nil
+}
+
+// record records the attempt to apply the diff summarized by summary, read
+// from base, which failed with applyErr if not nil. A failure to record is
+// only logged, as the apply itself is done.
+func (f historyFlags) record(ctx context.Context, client *gomigratedirectus.DirectusClient, base, snapshotHash string, summary gomigratedirectus.DiffSummary, applyErr error) {
+	if !*f.enabled {
+		return
+	}
+	entry := gomigratedirectus.NewHistoryEntry(base, nil, summary, *f.operator, applyErr)
+	entry.SnapshotHash = snapshotHash
+	if err := client.RecordHistory(context.WithoutCancel(ctx), *f.collection, entry); err != nil {
+		slog.Warn("failed to record history", "collection", *f.collection, "error", err)
+		return
+	}
+	slog.Info("history recorded", "collection", *f.collection, "status", entry.Status)
+}
+
+// runHistory lists the most recent migrations recorded on the project by
+// --record-history:
+//
+//	history [--url url] [--token token] [--history-collection name] [--limit n]
+//
+// The entries are printed as a table, newest first, and listed under history
+// in the JSON report.
+func runHistory(ctx context.Context, args []string) (err error) {
+	cmd := newCommand("history")
+	defer func() { err = cmd.finish(err) }()
+	target := addClientFlags(cmd, "", "TARGET")
+	collection := addHistoryCollectionFlag(cmd)
+	limit := cmd.Int("limit", "", 20, "number of entries to list")
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	if *limit <= 0 {
+		return fmt.Errorf("invalid --limit %d, expected a positive number", *limit)
+	}
+	if err := cmd.require(target); err != nil {
+		return err
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	client, err := target.newClient()
+	if err != nil {
+		return err
+	}
+	entries, err := client.ListHistory(ctx, *collection, *limit)
+	if err != nil {
+		return fmt.Errorf("History failed: %w", err)
+	}
+	cmd.report.History = entries
+
+	w := tabwriter.NewWriter(cmd.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSTATUS\tOPERATOR\tBASE\tVERSION\tCHANGES")
+	for _, entry := range entries {
+		changes := entry.Changes
+		if entry.Error != "" {
+			changes += ": " + strings.ReplaceAll(entry.Error, "\n", " ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Timestamp.UTC().Format("2006-01-02 15:04:05"),
+			entry.Status, orUnknown(entry.Operator), entry.Base, entry.ToolVersion, changes)
+	}
+	return w.Flush()
+}
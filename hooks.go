@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// defaultHookTimeout is the default of --hook-timeout.
+const defaultHookTimeout = 5 * time.Minute
+
+// hookFlags configures the shell hooks of the target environments, defined
+// under hooks in the config file.
+type hookFlags struct {
+	timeout *time.Duration
+	strict  *bool
+
+	// targets holds the hooks of each target client.
+	targets map[*gomigratedirectus.DirectusClient]configHooks
+}
+
+// addHookFlags registers --hook-timeout and --strict-hooks.
+func addHookFlags(cmd *command) *hookFlags {
+	return &hookFlags{
+		timeout: cmd.Duration("hook-timeout", "HOOK_TIMEOUT", defaultHookTimeout, "how long a hook may run before it is killed"),
+		strict:  cmd.Bool("strict-hooks", "STRICT_HOOKS", false, "fail when a post_apply hook fails"),
+		targets: map[*gomigratedirectus.DirectusClient]configHooks{},
+	}
+}
+
+// add registers the hooks of the config file environment name, if any, for
+// the target client.
+func (f *hookFlags) add(cmd *command, client *gomigratedirectus.DirectusClient, name string) {
+	if hooks := cmd.config.hooks(name); !hooks.empty() {
+		f.targets[client] = hooks
+	}
+}
+
+// apply copies the flags to opts.
+func (f *hookFlags) apply(opts *gomigratedirectus.MigrationOptions) {
+	if len(f.targets) > 0 {
+		opts.Hook = f.run
+	}
+	opts.StrictHooks = *f.strict
+}
+
+// run runs the shell command configured for info.Stage of info.Target, if
+// any, with sh -c. The command is killed after --hook-timeout, and its output
+// is logged line by line. It gets the details of the migration in its
+// environment:
+//
+//	MIGRATE_HOOK               the stage, such as post_apply
+//	MIGRATE_TARGET_URL         the redacted target URL
+//	MIGRATE_DIFF_SUMMARY_JSON  the diff summary as JSON, once it is known
+//	MIGRATE_BACKUP_PATH        the backup of the target, if one was written
+//	MIGRATE_ERROR              the error of the migration, for on_failure
+func (f *hookFlags) run(ctx context.Context, info gomigratedirectus.HookInfo) error {
+	command := f.targets[info.Target].command(info.Stage)
+	if command == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, *f.timeout)
+	defer cancel()
+
+	target := gomigratedirectus.RedactURL(info.Target.URL)
+	env := []string{
+		"MIGRATE_HOOK=" + info.Stage,
+		"MIGRATE_TARGET_URL=" + target,
+		"MIGRATE_BACKUP_PATH=" + info.BackupPath,
+	}
+	if info.Summary != nil {
+		summary, err := json.Marshal(info.Summary)
+		if err != nil {
+			return fmt.Errorf("failed to encode diff summary: %w", err)
+		}
+		env = append(env, "MIGRATE_DIFF_SUMMARY_JSON="+string(summary))
+	}
+	if info.Err != nil {
+		env = append(env, "MIGRATE_ERROR="+info.Err.Error())
+	}
+
+	slog.Info("running hook", "hook", info.Stage, "target", target, "command", command)
+	start := time.Now()
+	hook := exec.CommandContext(ctx, "sh", "-c", command)
+	hook.Env = append(os.Environ(), env...)
+	// Background processes started by the hook must not keep it running.
+	hook.WaitDelay = time.Second
+	stdout := &hookLog{stage: info.Stage, stream: "stdout", target: target}
+	stderr := &hookLog{stage: info.Stage, stream: "stderr", target: target}
+	hook.Stdout, hook.Stderr = stdout, stderr
+	err := hook.Run()
+	stdout.flush()
+	stderr.flush()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%q did not finish within %s", command, *f.timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%q: %w", command, err)
+	}
+	slog.Info("hook completed", "hook", info.Stage, "target", target, "duration", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// runStage runs the hook of stage for client outside of a migration, as
+// apply does. Errors are logged and returned.
+func (f *hookFlags) runStage(ctx context.Context, stage string, client *gomigratedirectus.DirectusClient, summary *gomigratedirectus.DiffSummary, backupPath string, migrationErr error) error {
+	info := gomigratedirectus.HookInfo{Stage: stage, Target: client, Summary: summary, BackupPath: backupPath, Err: migrationErr}
+	if err := f.run(ctx, info); err != nil {
+		err = fmt.Errorf("%s hook failed: %w", stage, err)
+		slog.Warn("hook failed", "hook", stage, "error", err)
+		return err
+	}
+	return nil
+}
+
+// hookLog logs the output of a hook line by line.
+type hookLog struct {
+	stage, stream, target string
+	partial               []byte
+}
+
+func (l *hookLog) Write(p []byte) (int, error) {
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		l.log(l.partial[:i])
+		l.partial = l.partial[i+1:]
+	}
+}
+
+// flush logs the last line if it did not end with a newline.
+func (l *hookLog) flush() {
+	if len(l.partial) > 0 {
+		l.log(l.partial)
+		l.partial = nil
+	}
+}
+
+func (l *hookLog) log(line []byte) {
+	slog.Info("hook output", "hook", l.stage, "target", l.target, "stream", l.stream, "line", string(bytes.TrimRight(line, "\r")))
+}
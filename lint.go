@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// runLint checks a snapshot file, or the live snapshot of the base project
+// when no file is given, against the naming and structure conventions of
+// gomigratedirectus.LintSnapshot, configured under lint in the config file:
+//
+//	lint [--snapshot file | --url url --token token]
+//
+// Every finding is printed with its severity, location and rule ID, and
+// listed under lint in the JSON report. The command fails when a finding has
+// the error severity; warnings are only printed.
+func runLint(ctx context.Context, args []string) (err error) {
+	cmd := newCommand("lint")
+	defer func() { err = cmd.finish(err) }()
+	path := cmd.String("snapshot", "", "", "snapshot file to lint (default: live snapshot of the base project)")
+	cmd.addLoadFlags()
+	base := addClientFlags(cmd, "", "BASE")
+	if _, err := os.Stat(defaultConfigFile); err == nil {
+		cmd.configRequired = true
+	}
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	rules, err := cmd.config.lintRules()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	var snapshot *gomigratedirectus.Snapshot
+	if *path != "" {
+		if snapshot, err = cmd.loadSnapshot(*path); err != nil {
+			return fmt.Errorf("Lint failed: %w", err)
+		}
+		cmd.report.BaseFile = *path
+	} else {
+		if err := cmd.require(base); err != nil {
+			return err
+		}
+		client, err := base.newClient()
+		if err != nil {
+			return err
+		}
+		if snapshot, err = client.GetSnapshot(ctx); err != nil {
+			return fmt.Errorf("Lint failed: %w", err)
+		}
+	}
+
+	result := gomigratedirectus.LintSnapshot(snapshot, rules)
+	cmd.report.Lint = result
+	for _, finding := range result.Findings {
+		fmt.Fprintln(cmd.stdout, finding)
+	}
+	if result.Errors > 0 {
+		return fmt.Errorf("Lint failed: %d errors, %d warnings", result.Errors, result.Warnings)
+	}
+	slog.Info("snapshot passed lint", "warnings", result.Warnings)
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// lockFlags configures the lock taken on the target while applying.
+type lockFlags struct {
+	enabled    *bool
+	timeout    *time.Duration
+	ttl        *time.Duration
+	collection *string
+}
+
+// addLockFlags registers --lock, --lock-timeout, --lock-ttl and
+// --lock-collection.
+func addLockFlags(cmd *command) lockFlags {
+	return lockFlags{
+		enabled:    cmd.Bool("lock", "MIGRATION_LOCK", false, "lock the target so that no other migration applies to it at the same time"),
+		timeout:    cmd.Duration("lock-timeout", "LOCK_TIMEOUT", 0, "how long to wait for a lock held by another migration, 0 to fail right away"),
+		ttl:        cmd.Duration("lock-ttl", "LOCK_TTL", gomigratedirectus.DefaultLockTTL, "how long the lock is valid, after which another migration can take it over"),
+		collection: addLockCollectionFlag(cmd),
+	}
+}
+
+// addLockCollectionFlag registers --lock-collection.
+func addLockCollectionFlag(cmd *command) *string {
+	return cmd.String("lock-collection", "LOCK_COLLECTION", gomigratedirectus.DefaultLockCollection, "collection holding the lock of the target")
+}
+
+// options returns the LockOptions configured by the flags.
+func (f lockFlags) options() gomigratedirectus.LockOptions {
+	return gomigratedirectus.LockOptions{Collection: *f.collection, TTL: *f.ttl, Timeout: *f.timeout}
+}
+
+// apply copies the flags to opts.
+func (f lockFlags) apply(opts *gomigratedirectus.MigrationOptions) {
+	opts.Lock = *f.enabled
+	opts.LockOptions = f.options()
+}
+
+// acquire takes the lock of client on behalf of operator if --lock is given.
+// The returned function releases it.
+func (f lockFlags) acquire(ctx context.Context, client *gomigratedirectus.DirectusClient, operator string) (func(), error) {
+	if !*f.enabled {
+		return func() {}, nil
+	}
+	opts := f.options()
+	opts.Holder = gomigratedirectus.NewLockHolder(operator)
+	opts.OnWait = func(held gomigratedirectus.Lock) {
+		slog.Info("target is locked, waiting", "holder", held.Holder, "expires_at", held.ExpiresAt)
+	}
+	opts.OnTakeover = func(stale gomigratedirectus.Lock) {
+		slog.Warn("took over expired lock", "holder", stale.Holder, "expired_at", stale.ExpiresAt)
+	}
+	lock, err := client.AcquireLock(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock target: %w", err)
+	}
+	slog.Info("target locked", "collection", *f.collection, "holder", lock.Holder, "expires_at", lock.ExpiresAt)
+	return func() {
+		if err := client.ReleaseLock(context.WithoutCancel(ctx), *f.collection, lock); err != nil {
+			slog.Warn("failed to release lock, it expires on its own", "collection", *f.collection, "error", err)
+			return
+		}
+		slog.Info("target unlocked", "collection", *f.collection)
+	}, nil
+}
+
+// runUnlock shows the lock of a project and removes it:
+//
+//	unlock [--url url] [--token token] [--lock-collection name] [--force]
+//
+// An expired lock is removed right away. A lock that is still valid may
+// belong to a migration in progress and is only removed with --force, as the
+// escape hatch for a holder that crashed.
+func runUnlock(ctx context.Context, args []string) (err error) {
+	cmd := newCommand("unlock")
+	defer func() { err = cmd.finish(err) }()
+	target := addClientFlags(cmd, "", "TARGET")
+	collection := addLockCollectionFlag(cmd)
+	force := cmd.Bool("force", "", false, "remove the lock even if it has not expired")
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	if err := cmd.require(target); err != nil {
+		return err
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	client, err := target.newClient()
+	if err != nil {
+		return err
+	}
+	lock, err := client.GetLock(ctx, *collection)
+	if err != nil {
+		return fmt.Errorf("Unlock failed: %w", err)
+	}
+	if lock == nil {
+		fmt.Fprintln(cmd.stdout, "Target is not locked.")
+		return nil
+	}
+	if !lock.Expired(time.Now()) && !*force {
+		return fmt.Errorf("Unlock failed: %w, use --force to remove the lock anyway", &gomigratedirectus.LockedError{Lock: *lock})
+	}
+	if lock, err = client.Unlock(ctx, *collection); err != nil {
+		return fmt.Errorf("Unlock failed: %w", err)
+	}
+	if lock != nil {
+		cmd.report.Changed = true
+		fmt.Fprintf(cmd.stdout, "Removed the lock held by %s since %s.\n", lock.Holder, lock.AcquiredAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
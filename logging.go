@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// httpDump receives a dump of every request sent to Directus when the log
+// level is trace. It is set by logFlags.setup before any client is created.
+var httpDump io.Writer
+
+// logFlags holds the logging flags shared by all commands.
+type logFlags struct {
+	level  *string
+	format *string
+}
+
+// addLogFlags registers --log-level and --log-format on cmd, falling back to
+// the LOG_LEVEL and LOG_FORMAT environment variables.
+func addLogFlags(cmd *command) logFlags {
+	return logFlags{
+		level:  cmd.String("log-level", "LOG_LEVEL", "info", "log level: trace, debug, info, warn or error; trace also dumps every request"),
+		format: cmd.String("log-format", "LOG_FORMAT", "text", "log format: text or json"),
+	}
+}
+
+// setup installs the configured logger as the slog default. Logs always go to
+// stderr so that stdout only carries requested data.
+func (f logFlags) setup() error {
+	var level slog.Level
+	if strings.EqualFold(*f.level, "trace") {
+		level = slog.LevelDebug
+		httpDump = stderr
+	} else if err := level.UnmarshalText([]byte(*f.level)); err != nil {
+		return fmt.Errorf("invalid log level %q", *f.level)
+	}
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(*f.format) {
+	case "text":
+		handler = slog.NewTextHandler(stderr, options)
+	case "json":
+		handler = slog.NewJSONHandler(stderr, options)
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", *f.format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
@@ -1,33 +1,772 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"slices"
 	"strconv"
-
-	"github.com/joho/godotenv"
+	"strings"
 
 	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
 )
 
 func main() {
-	err := godotenv.Load()
+	ctx, stop := notifyInterrupt()
+	code := run(ctx, os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+// run runs the command given by args, migrate by default, and returns the
+// exit status: 0 when the schemas are in sync, the status of
+// --exit-code-on-changes (2 by default) when changes were applied or are
+// pending, interruptExitCode when ctx was interrupted and 1 on errors, which
+// are printed to stderr.
+func run(ctx context.Context, args []string) int {
+	command := "migrate"
+	if len(args) > 0 && (!strings.HasPrefix(args[0], "-") || args[0] == "-h" || args[0] == "--help") {
+		command, args = args[0], args[1:]
+	} else if len(args) > 0 && (args[0] == "--version" || args[0] == "-version") {
+		command, args = "version", args[1:]
+	}
+
+	var err error
+	switch command {
+	case "migrate":
+		err = runMigrate(ctx, args)
+	case "snapshot":
+		err = runSnapshot(ctx, args)
+	case "snapshots":
+		err = runSnapshots(ctx, args)
+	case "validate":
+		err = runValidate(ctx, args)
+	case "lint":
+		err = runLint(ctx, args)
+	case "check":
+		err = runCheck(ctx, args)
+	case "diff":
+		err = runDiff(ctx, args)
+	case "plan":
+		err = runPlan(ctx, args)
+	case "apply":
+		err = runApply(ctx, args)
+	case "undo":
+		err = runUndo(ctx, args)
+	case "promote":
+		err = runPromote(ctx, args)
+	case "versions":
+		err = runVersions(ctx, args)
+	case "watch":
+		err = runWatch(ctx, args)
+	case "history":
+		err = runHistory(ctx, args)
+	case "unlock":
+		err = runUnlock(ctx, args)
+	case "generate":
+		err = runGenerate(ctx, args)
+	case "version":
+		err = runVersion(ctx, args)
+	case "completion":
+		err = runCompletion(ctx, args)
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stderr, usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		err = fmt.Errorf("unknown command %q", command)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	var changes *changesError
+	if interrupted(ctx) {
+		if err != nil && !errors.As(err, &changes) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return interruptExitCode
+	}
+	if errors.As(err, &changes) {
+		return changes.code
+	}
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
+	return 0
+}
+
+const usage = `Usage: go-mirgrate-directus [command] [flags]
+
+Commands:
+  migrate    migrate the schema from the base to the target project (default)
+  snapshot   export the schema snapshot of a project
+  snapshots  list, add, tag or prune the snapshots of a snapshot repository
+  diff       compute the diff between a snapshot and the target project
+  plan       write the diff to a plan file that apply checks for drift
+  apply      apply a diff saved by the diff command or a plan
+  undo       revert the last migration of the target project
+  promote    promote the schema through several environments in order
+  validate   check a snapshot for problems
+  lint       check a snapshot against naming and structure conventions
+  check      detect drift of the target project from a snapshot file
+  versions   compare the Directus versions of the base and target projects
+  watch      migrate the target whenever the base schema changes
+  history    list the migrations recorded on a project
+  unlock     remove the lock left on a project by a crashed migration
+  generate   generate Go or TypeScript types or an ER diagram from a snapshot
+  version    print the version, commit and build date of the binary
+  completion print the shell completion script for bash, zsh or fish
 
-	baseURL := os.Getenv("BASE_URL")
-	baseToken := os.Getenv("BASE_TOKEN")
-	targetURL := os.Getenv("TARGET_URL")
-	targetToken := os.Getenv("TARGET_TOKEN")
-	force, err := strconv.ParseBool(os.Getenv("FORCE"))
+Run a command with -h to list its flags, or --version to print the version.
+`
+
+// runMigrate migrates the schema from the base to the target project:
+//
+//	migrate [--base-url url] [--base-token token | --from-file file]
+//	        [--target-url url] [--target-token token] [--force] [--dry-run]
+//	        [--include pattern]... [--exclude pattern]...
+//	        [--only collection]...
+//	        [--overlay file]... [--strict-overlays]
+//	        [--interactive] [--only-collections pattern]...
+//	        [--with-files [--all-files]]
+//	        [--data-collection name[=strategy]]... [--data-field collection.field]...
+//	        [--with-permissions]
+//	        [--with-users [--user-role name]... [--user-email email]... [--invite-users [--invite-url url]]]
+//	        [--with-presets [--prune-presets]]
+//	        [--with-translations [--prune-translations] [--translations-batch-size n]]
+//	        [--with-webhooks [--prune-webhooks none|deactivate|delete] [--webhook-url old=new]...]
+//	        [--with-settings [--settings-key key]...]
+//	        [--with-flows [--prune-flows] [--flow-secrets file]] [--with-dashboards]
+//	        [--yes] [--no-backup] [--backup-dir dir|url] [--keep-backups n] [--rollback]
+//	        [--backup-repo [--backup-env env]] [--resume] [--checkpoint-dir dir|url]
+//	        [--allow-destructive] [--max-deletions n] [--exit-code-on-changes code]
+//	        [--record-history [--history-collection name] [--operator name]]
+//	        [--lock [--lock-timeout duration] [--lock-ttl duration] [--lock-collection name]]
+//	        [--cache-file file] [--no-cache]
+//	        [--hook-timeout duration] [--strict-hooks]
+//	        [--slack-webhook-url url] [--notify-webhook-url url]
+//	        [--to env[,env]... [--continue-on-error] [--parallel n]]
+//
+// --include and --exclude limit the migration to the collections matching
+// the given names or globs, such as --exclude 'analytics_*'.
+//
+// --with-files copies the folder tree and the files referenced by the data
+// collections and synced settings, or all files with --all-files, streaming
+// their assets and keeping their IDs.
+//
+// --data-collection copies the items of lookup tables right after the schema,
+// matched by primary key and written in dependency order. The strategy is
+// upsert, insert-only or mirror, which also deletes target items the base does
+// not have; --data-field limits the copied fields.
+//
+// --with-permissions also copies roles and permissions, matching roles by
+// name, once the schema has been migrated.
+//
+// --with-users then creates the non-admin base users of the roles given with
+// --user-role, or with the emails given with --user-email, that the target
+// does not have, mapping roles by name. They get the password in
+// USER_PASSWORD or a generated one, printed once, or with --invite-users an
+// invite email. Password hashes, two-factor secrets and tokens are never
+// copied.
+//
+// --with-presets copies global and role presets, such as shared bookmarks,
+// remapping roles by name; --prune-presets deletes the shared target presets
+// the base does not have.
+//
+// --with-translations upserts custom translation strings by language and key;
+// --prune-translations deletes those the base does not have.
+//
+// --with-webhooks copies legacy webhooks by name, replacing parts of their URLs
+// as given by --webhook-url or the webhooks section of the config file.
+//
+// --with-settings copies an allowlist of project settings, by default the
+// appearance and module settings; --settings-key replaces the allowlist.
+//
+// --with-flows then copies flows and their operations. Strings in operation
+// options, such as webhook URLs, are replaced as mapped by --flow-secrets, and
+// --prune-flows deletes inactive target flows that the base does not have.
+// --with-dashboards copies Insights dashboards, replacing their panels.
+//
+// --phase-rate-limit data=5 limits the requests each client sends during a
+// sync phase, overriding the <PREFIX>_RATE_LIMIT of the connection.
+//
+// A migration with any of these sync phases keeps a checkpoint in the backup
+// directory, or --checkpoint-dir, recording the phases and data collections
+// completed. When it fails, --resume reruns it skipping them, unless the base
+// snapshot or the target schema changed since. The checkpoint is removed once
+// the migration succeeded.
+//
+// --to may select several environments of the config file, or a group of
+// them, to migrate to each in turn with the base snapshot fetched once, or to
+// --parallel of them at once. A failing target skips the remaining ones
+// unless --continue-on-error is given.
+//
+// Diffs that delete collections or fields, or change field types in ways
+// that can lose data, are refused unless --allow-destructive is given.
+//
+// Once applied, the target is diffed against the base snapshot again, and
+// the differences Directus left, if any, are logged and reported under
+// residual. --verify fail then fails the migration, --verify off skips the
+// check.
+//
+// The snapshot of the target is backed up before anything is applied.
+// --record-history records every apply, and its failure, in a collection of
+// the target, which the history command lists. --lock keeps other migrations
+// from applying to the target at the same time. --cache-file remembers the
+// targets found in sync, so that a later run of the same base snapshot skips
+// the diff and the apply of a target whose schema has not changed since;
+// --no-cache ignores it. The hooks of the --to
+// environment in the config file run before and after the apply, and the
+// outcome is notified to Slack or a webhook when configured.
+//
+// With --from-file the base schema is read from a snapshot file, such as one
+// written by the snapshot command, instead of a live project.
+//
+// Unless --yes is given, the diff is shown and has to be confirmed before it
+// is applied.
+//
+// Once the migration of a single target ended, the duration of each phase and
+// the size of the snapshot and the diff transferred are printed as a table on
+// stderr, or reported under stats with --output json.
+//
+// It exits with status 0 when the schemas were already in sync, 2 (or the
+// --exit-code-on-changes status) when changes were applied, or pending in a
+// dry run, and 1 on errors.
+func runMigrate(ctx context.Context, args []string) (err error) {
+	cmd := newCommand("migrate")
+	defer func() { err = cmd.finish(err) }()
+	cmd.addExitCodeFlag()
+	cmd.addLoadFlags()
+	base := addClientFlags(cmd, "base", "BASE")
+	target := addClientFlags(cmd, "target", "TARGET")
+	fromFile := cmd.String("from-file", "", "", "snapshot file to migrate from instead of the base project")
+	force := cmd.Bool("force", "FORCE", false, "migrate even if Directus versions differ")
+	dryRun := cmd.Bool("dry-run", "DRY_RUN", false, "compute and print the diff without applying it")
+	waitForReady := cmd.Duration("wait-for-ready", "WAIT_FOR_READY", 0, "wait up to this long for both projects to become ready")
+	yes := addYesFlag(cmd)
+	selection := addSelectFlags(cmd)
+	backups := addBackupFlags(cmd)
+	resume := addResumeFlags(cmd)
+	rateLimits := addRateLimitFlags(cmd)
+	safety := addSafetyFlags(cmd)
+	filters := addFilterFlags(cmd)
+	lenientRelations := addRelationsFlag(cmd)
+	only := addOnlyFlag(cmd)
+	overlays := addOverlayFlags(cmd)
+	history := addHistoryFlags(cmd)
+	locks := addLockFlags(cmd)
+	cache := addCacheFlags(cmd)
+	hooks := addHookFlags(cmd)
+	notify := addNotifyFlags(cmd, dryRun)
+	withFiles := cmd.Bool("with-files", "SYNC_FILES", false, "also sync folders and the files referenced by synced items and settings")
+	allFiles := cmd.Bool("all-files", "ALL_FILES", false, "with --with-files, sync every file of the base")
+	data := addDataFlags(cmd)
+	withPermissions := cmd.Bool("with-permissions", "SYNC_PERMISSIONS", false, "also sync roles and permissions, matched by role name")
+	users := addUserFlags(cmd)
+	withPresets := cmd.Bool("with-presets", "SYNC_PRESETS", false, "also sync global and role presets, remapping roles by name")
+	prunePresets := cmd.Bool("prune-presets", "PRUNE_PRESETS", false, "delete shared target presets that the base does not have")
+	withTranslations := cmd.Bool("with-translations", "SYNC_TRANSLATIONS", false, "also sync custom translations, keyed by language and key")
+	pruneTranslations := cmd.Bool("prune-translations", "PRUNE_TRANSLATIONS", false, "delete target translations that the base does not have")
+	translationsBatchSize := cmd.Int("translations-batch-size", "TRANSLATIONS_BATCH_SIZE", gomigratedirectus.DefaultTranslationBatchSize, "translations read per page and written per request")
+	webhooks := addWebhookFlags(cmd)
+	withSettings := cmd.Bool("with-settings", "SYNC_SETTINGS", false, "also sync an allowlist of project settings")
+	settingsKeys := cmd.Strings("settings-key", "SETTINGS_KEYS", "project setting to sync instead of the default allowlist: "+strings.Join(gomigratedirectus.DefaultSettingsKeys, ", "))
+	flows := addFlowFlags(cmd)
+	withDashboards := cmd.Bool("with-dashboards", "SYNC_DASHBOARDS", false, "also sync Insights dashboards and panels, matched by dashboard name")
+	verify := cmd.String("verify", "VERIFY_AFTER_APPLY", string(gomigratedirectus.VerifyWarn), "after applying, diff the target again and warn about what is left (warn), fail the migration (fail) or skip it (off)")
+	continueOnError := cmd.Bool("continue-on-error", "CONTINUE_ON_ERROR", false, "with several targets, migrate the remaining ones after one failed")
+	parallel := cmd.Int("parallel", "PARALLEL", 1, "with several targets, how many to migrate at once")
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	if *parallel < 1 {
+		return fmt.Errorf("invalid --parallel %d, expected at least 1", *parallel)
+	}
+	verifyPolicy := gomigratedirectus.VerifyPolicy(strings.ToLower(*verify))
+	switch verifyPolicy {
+	case gomigratedirectus.VerifyWarn, gomigratedirectus.VerifyFail, gomigratedirectus.VerifyOff:
+	default:
+		return fmt.Errorf("invalid --verify %q, expected warn, fail or off", *verify)
+	}
+	if err := selection.check(); err != nil {
+		return err
+	}
+	targets, err := target.expand(cmd)
 	if err != nil {
-		log.Fatal("Error parsing FORCE from .env file")
+		return err
+	}
+	for _, target := range targets {
+		if err := notify.addEnvironment(cmd, *target.environment); err != nil {
+			return err
+		}
+	}
+	required := append([]*clientFlags{base}, targets...)
+	if *fromFile != "" {
+		required = targets
+	}
+	if err := cmd.require(required...); err != nil {
+		return err
 	}
+	if len(targets) > 1 {
+		// Every target is reported in cmd.report.Targets instead.
+		cmd.report.TargetURL = ""
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
 
-	if err := gomigratedirectus.Migrate(baseURL, baseToken, targetURL, targetToken, force); err != nil {
-		fmt.Fprintf(os.Stderr, "Migration failed: %v\n", err)
-		os.Exit(1)
+	opts := gomigratedirectus.MigrationOptions{
+		Force:                 *force,
+		DryRun:                *dryRun,
+		WaitForReady:          *waitForReady,
+		SyncPermissions:       *withPermissions,
+		SyncPresets:           *withPresets,
+		PrunePresets:          *prunePresets,
+		SyncDashboards:        *withDashboards,
+		SyncTranslations:      *withTranslations,
+		PruneTranslations:     *pruneTranslations,
+		TranslationsBatchSize: *translationsBatchSize,
+		SyncSettings:          *withSettings,
+		SyncFiles:             *withFiles,
+		AllFiles:              *allFiles,
+		SettingsKeys:          *settingsKeys,
+		VerifyAfterApply:      verifyPolicy,
+		ContinueOnError:       *continueOnError,
+		Parallel:              *parallel,
+		Output:                cmd.stdout,
+		Color:                 cmd.color(os.Stdout),
+	}
+	var baseClient *gomigratedirectus.DirectusClient
+	if *fromFile != "" {
+		opts.Source = gomigratedirectus.FileSourceWithOptions(*fromFile, cmd.loadOptions())
+		cmd.report.BaseFile = *fromFile
+		// Load the file now, so that a snapshot not matching its checksum
+		// fails before any request is sent.
+		if _, err := opts.Source.Snapshot(ctx); err != nil {
+			return fmt.Errorf("Migration failed: %w", err)
+		}
+	} else if baseClient, err = base.newClient(); err != nil {
+		return err
+	}
+	targetClients := make([]*gomigratedirectus.DirectusClient, 0, len(targets))
+	for _, target := range targets {
+		client, err := target.newClient()
+		if err != nil {
+			return err
+		}
+		targetClients = append(targetClients, client)
+		hooks.add(cmd, client, *target.environment)
+	}
+
+	if !*yes {
+		opts.Confirm = confirmChanges(os.Stdin, os.Stderr, cmd.color(os.Stderr))
+	}
+	if err := backups.apply(&opts); err != nil {
+		return err
+	}
+	if err := resume.apply(&opts); err != nil {
+		return err
+	}
+	if err := rateLimits.apply(&opts); err != nil {
+		return err
+	}
+	safety.apply(&opts)
+	filters.apply(&opts)
+	opts.LenientRelations = *lenientRelations
+	opts.ScopeCollections = *only
+	selection.apply(&opts)
+	if err := overlays.apply(cmd, &opts); err != nil {
+		return fmt.Errorf("Migration failed: %w", err)
+	}
+	history.apply(&opts)
+	locks.apply(&opts)
+	hooks.apply(&opts)
+	if err := cache.apply(&opts, false); err != nil {
+		return fmt.Errorf("Migration failed: %w", err)
+	}
+	if err := data.apply(&opts); err != nil {
+		return fmt.Errorf("Migration failed: %w", err)
 	}
+	if err := users.apply(&opts, cmd.jsonOutput); err != nil {
+		return fmt.Errorf("Migration failed: %w", err)
+	}
+	if err := webhooks.apply(&opts); err != nil {
+		return fmt.Errorf("Migration failed: %w", err)
+	}
+	if err := flows.apply(&opts); err != nil {
+		return fmt.Errorf("Migration failed: %w", err)
+	}
+	if err := cmd.trace(ctx, &opts); err != nil {
+		return fmt.Errorf("Migration failed: %w", err)
+	}
+	// The stats are printed once the progress line is gone.
+	var stats *gomigratedirectus.MigrationStats
+	defer func() {
+		if stats != nil && !cmd.jsonOutput {
+			printStats(os.Stderr, stats)
+		}
+	}()
+	progress := newProgress(cmd)
+	defer progress.stop()
+	opts.OnEvent = progress.handle
+	if len(targetClients) > 1 {
+		return migrateToTargets(ctx, cmd, baseClient, targetClients, opts)
+	}
+	result, err := gomigratedirectus.MigrateWithOptions(ctx, baseClient, targetClients[0], opts)
+	if result != nil {
+		stats = &result.Stats
+		cmd.report.Stats = stats
+		cmd.report.Changed, cmd.report.Applied = result.Changed, result.Applied
+		cmd.report.BackupPath, cmd.report.RolledBack = result.BackupPath, result.RolledBack
+		cmd.report.UndoPath = result.UndoPath
+		if result.Residual != nil {
+			cmd.report.Residual = &result.ResidualSummary
+		}
+		if result.Changed {
+			cmd.report.Summary = &result.Summary
+		}
+		cmd.report.DestructiveChanges = result.DestructiveChanges
+		cmd.report.Files = result.Files
+		cmd.report.Data = result.Data
+		cmd.report.Permissions = result.Permissions
+		cmd.report.Users = result.Users
+		cmd.report.Presets = result.Presets
+		cmd.report.Translations = result.Translations
+		cmd.report.Webhooks = result.Webhooks
+		cmd.report.Settings = result.Settings
+		cmd.report.Flows = result.Flows
+		cmd.report.Dashboards = result.Dashboards
+		if opts.DryRun {
+			cmd.report.Diff = result.Diff
+		}
+	}
+	if err != nil {
+		if opts.DryRun {
+			return fmt.Errorf("Dry run failed: %w", err)
+		}
+		if errors.Is(err, gomigratedirectus.ErrNotConfirmed) {
+			return fmt.Errorf("Migration aborted: %w", err)
+		}
+		return fmt.Errorf("Migration failed: %w", err)
+	}
+	if resultChanged(result) {
+		return cmd.changed()
+	}
+	return nil
+}
+
+// migrateToTargets migrates to several targets with MigrateToTargets,
+// reporting each of them.
+func migrateToTargets(ctx context.Context, cmd *command, baseClient *gomigratedirectus.DirectusClient, targets []*gomigratedirectus.DirectusClient, opts gomigratedirectus.MigrationOptions) error {
+	multi, err := gomigratedirectus.MigrateToTargets(ctx, baseClient, targets, opts)
+	changed := false
+	for _, target := range multi.Targets {
+		report := targetReport(target.URL, target.Result, target.Err, opts.DryRun)
+		report.Skipped = target.Skipped
+		report.CircuitOpen = target.CircuitOpen
+		changed = changed || (target.Result != nil && resultChanged(target.Result))
+		cmd.report.Changed = cmd.report.Changed || report.Changed
+		cmd.report.Applied = cmd.report.Applied || report.Applied
+		cmd.report.Targets = append(cmd.report.Targets, report)
+	}
+	if err != nil {
+		if opts.DryRun {
+			return fmt.Errorf("Dry run failed: %w", err)
+		}
+		return fmt.Errorf("Migration failed: %w", err)
+	}
+	if changed {
+		return cmd.changed()
+	}
+	return nil
+}
+
+// targetReport reports the migration to the target at url, which failed
+// with err if not nil. result may be nil.
+func targetReport(url string, result *gomigratedirectus.MigrationResult, err error, dryRun bool) gomigratedirectus.TargetReport {
+	report := gomigratedirectus.TargetReport{TargetURL: url}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	if result == nil {
+		return report
+	}
+	report.Changed, report.Applied = result.Changed, result.Applied
+	report.BackupPath, report.RolledBack = result.BackupPath, result.RolledBack
+	report.UndoPath = result.UndoPath
+	if result.Residual != nil {
+		report.Residual = &result.ResidualSummary
+	}
+	report.Stats = &result.Stats
+	if result.Changed {
+		report.Summary = &result.Summary
+	}
+	report.DestructiveChanges = result.DestructiveChanges
+	report.Files = result.Files
+	report.Data = result.Data
+	report.Permissions = result.Permissions
+	report.Users = result.Users
+	report.Presets = result.Presets
+	report.Translations = result.Translations
+	report.Webhooks = result.Webhooks
+	report.Settings = result.Settings
+	report.Flows = result.Flows
+	report.Dashboards = result.Dashboards
+	if dryRun {
+		report.Diff = result.Diff
+	}
+	return report
+}
+
+// resultChanged reports whether a migration changed the target, or would in a
+// dry run, in any of its phases.
+func resultChanged(result *gomigratedirectus.MigrationResult) bool {
+	return result.Changed ||
+		(result.Files != nil && result.Files.Changed()) ||
+		(result.Data != nil && result.Data.Changed()) ||
+		(result.Permissions != nil && result.Permissions.Changed()) ||
+		(result.Users != nil && result.Users.Changed()) ||
+		(result.Presets != nil && result.Presets.Changed()) ||
+		(result.Translations != nil && result.Translations.Changed()) ||
+		(result.Webhooks != nil && result.Webhooks.Changed()) ||
+		(result.Settings != nil && result.Settings.Changed()) ||
+		(result.Flows != nil && result.Flows.Changed()) ||
+		(result.Dashboards != nil && result.Dashboards.Changed())
+}
+
+// clientFlags holds the connection settings of one project. The URL and
+// static token can be given as flags, for example --base-url, or as
+// <PREFIX>_URL and <PREFIX>_TOKEN; credentials are read from <PREFIX>_EMAIL
+// and <PREFIX>_PASSWORD only, to keep passwords out of the process list.
+// Alternatively --from (base) or --to (target) selects an environment of the
+// config file, which takes precedence over the environment variables.
+type clientFlags struct {
+	flag        string
+	prefix      string
+	url         *string
+	token       *string
+	environment *string
+	insecure    *bool
+
+	// configured is set when the credentials come from the config file.
+	configured      bool
+	email, password string
+}
+
+// addClientFlags registers --<name>-url and --<name>-token on cmd, or plain
+// --url and --token when name is empty, for commands that talk to a single
+// project, together with --from or --to.
+func addClientFlags(cmd *command, name, prefix string) *clientFlags {
+	project := name
+	if name == "" {
+		project = strings.ToLower(prefix)
+	} else {
+		name += "-"
+	}
+	selector := "from"
+	if prefix == "TARGET" {
+		selector = "to"
+	}
+	return &clientFlags{
+		flag:        name,
+		prefix:      prefix,
+		url:         cmd.String(name+"url", prefix+"_URL", "", "URL of the "+project+" Directus project"),
+		token:       cmd.String(name+"token", prefix+"_TOKEN", "", "static access token for the "+project+" project"),
+		environment: cmd.String(selector, "", "", "config file environment to use as the "+project+" project"),
+		insecure:    cmd.addInsecureFlag(),
+	}
+}
+
+// addInsecureFlag registers --insecure on cmd, unless a previous call did,
+// and returns it.
+func (c *command) addInsecureFlag() *bool {
+	if c.insecure == nil {
+		c.insecure = c.Bool("insecure", "INSECURE_TLS", false, "do not verify the TLS certificates of the Directus projects, which lets connections be intercepted")
+	}
+	return c.insecure
+}
+
+// applyEnvironment fills the settings from the environment selected in the
+// config file, keeping values given on the command line.
+func (f *clientFlags) applyEnvironment(cmd *command) error {
+	if *f.environment == "" {
+		return nil
+	}
+	env, err := cmd.config.environment(*f.environment)
+	if err != nil {
+		return err
+	}
+	if !cmd.isSet(f.flag + "url") {
+		*f.url = env.URL
+	}
+	if !cmd.isSet(f.flag + "token") {
+		*f.token = env.Token
+		f.configured = true
+		f.email, f.password = env.Email, env.Password
+	}
+	return nil
+}
+
+// expand returns one clientFlags per project selected with --to, which may
+// list several comma-separated environments or name a group of them in the
+// config file. It returns f itself when a single project is selected.
+func (f *clientFlags) expand(cmd *command) ([]*clientFlags, error) {
+	if *f.environment == "" {
+		return []*clientFlags{f}, nil
+	}
+	var names []string
+	for _, name := range strings.Split(*f.environment, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		members, err := cmd.config.targets(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if slices.Contains(names, member) {
+				return nil, fmt.Errorf("environment %q is selected more than once", member)
+			}
+			names = append(names, member)
+		}
+	}
+	if len(names) == 1 {
+		*f.environment = names[0]
+		return []*clientFlags{f}, nil
+	}
+	if cmd.isSet(f.flag+"url") || cmd.isSet(f.flag+"token") {
+		return nil, fmt.Errorf("--%[1]surl and --%[1]stoken cannot be combined with several environments", f.flag)
+	}
+	expanded := make([]*clientFlags, 0, len(names))
+	for _, name := range names {
+		url, token, environment := *f.url, *f.token, name
+		expanded = append(expanded, &clientFlags{flag: f.flag, prefix: f.prefix, url: &url, token: &token, environment: &environment, insecure: f.insecure})
+	}
+	return expanded, nil
+}
+
+// credentials returns the email and password from the config file or the
+// environment.
+func (f *clientFlags) credentials() (email, password string) {
+	if f.configured {
+		return f.email, f.password
+	}
+	return os.Getenv(f.prefix + "_EMAIL"), os.Getenv(f.prefix + "_PASSWORD")
+}
+
+// missing describes every required value that has not been configured.
+func (f *clientFlags) missing() []string {
+	var missing []string
+	if *f.url == "" {
+		missing = append(missing, fmt.Sprintf("--%surl or %s_URL", f.flag, f.prefix))
+	}
+	if email, password := f.credentials(); *f.token == "" && (email == "" || password == "") {
+		missing = append(missing, fmt.Sprintf("--%[1]stoken or %[2]s_TOKEN (or %[2]s_EMAIL and %[2]s_PASSWORD)", f.flag, f.prefix))
+	}
+	return missing
+}
+
+// newClient creates the configured client. TLS settings are read from
+// <PREFIX>_CA_CERT_FILE, <PREFIX>_CLIENT_CERT_FILE, <PREFIX>_CLIENT_KEY_FILE
+// and --insecure, an explicit proxy from <PREFIX>_PROXY, a rate limit from
+// <PREFIX>_RATE_LIMIT and <PREFIX>_RATE_BURST, a circuit breaker from
+// CIRCUIT_BREAKER_FAILURES and CIRCUIT_BREAKER_COOLDOWN, and request
+// compression from COMPRESSION. Requests are dumped at the trace log level.
+func (f *clientFlags) newClient() (*gomigratedirectus.DirectusClient, error) {
+	transport, err := transportFor(f.prefix, *f.insecure)
+	if err != nil {
+		return nil, err
+	}
+	if *f.insecure {
+		slog.Warn("TLS certificate verification is DISABLED, connections can be intercepted", "url", gomigratedirectus.RedactURL(*f.url))
+	}
+	opts := []gomigratedirectus.ClientOption{gomigratedirectus.WithTransport(transport)}
+	limit, err := rateLimitFromEnv(f.prefix)
+	if err != nil {
+		return nil, err
+	}
+	if limit.PerSecond > 0 {
+		opts = append(opts, gomigratedirectus.WithRateLimit(limit))
+	}
+	breaker, err := circuitBreakerFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if breaker != nil {
+		opts = append(opts, breaker)
+	}
+	if compress, _ := strconv.ParseBool(os.Getenv("COMPRESSION")); compress {
+		opts = append(opts, gomigratedirectus.WithCompression(true))
+	}
+	if httpDump != nil {
+		opts = append(opts, gomigratedirectus.WithDebug(httpDump))
+	}
+
+	if *f.token != "" {
+		return gomigratedirectus.NewDirectusClient(*f.url, *f.token, opts...), nil
+	}
+	email, password := f.credentials()
+	return gomigratedirectus.NewDirectusClientWithCredentials(*f.url, email, password, opts...), nil
+}
+
+// transports holds the transport shared by the clients of each prefix, such
+// as the several targets of an environment group.
+var transports = map[string]*http.Transport{}
+
+// transportFor returns the transport of the clients of prefix, configured by
+// its TLS and proxy settings. insecure disables the verification of server
+// certificates.
+func transportFor(prefix string, insecure bool) (*http.Transport, error) {
+	if transport, ok := transports[prefix]; ok {
+		return transport, nil
+	}
+	opts, err := tlsOptionsFromEnv(prefix, insecure)
+	if err != nil {
+		return nil, err
+	}
+	if proxy := os.Getenv(prefix + "_PROXY"); proxy != "" {
+		opts = append(opts, gomigratedirectus.WithProxy(proxy))
+	}
+	transport, err := gomigratedirectus.NewTransport(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s connection settings: %w", prefix, err)
+	}
+	transports[prefix] = transport
+	return transport, nil
+}
+
+// tlsOptionsFromEnv returns the TLS client options configured for prefix.
+func tlsOptionsFromEnv(prefix string, insecure bool) ([]gomigratedirectus.ClientOption, error) {
+	var opts []gomigratedirectus.ClientOption
+
+	if path := os.Getenv(prefix + "_CA_CERT_FILE"); path != "" {
+		pemBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s_CA_CERT_FILE: %w", prefix, err)
+		}
+		opts = append(opts, gomigratedirectus.WithCACert(pemBytes))
+	}
+
+	certPath := os.Getenv(prefix + "_CLIENT_CERT_FILE")
+	keyPath := os.Getenv(prefix + "_CLIENT_KEY_FILE")
+	if certPath != "" || keyPath != "" {
+		certPEM, err := os.ReadFile(certPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s_CLIENT_CERT_FILE: %w", prefix, err)
+		}
+		keyPEM, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s_CLIENT_KEY_FILE: %w", prefix, err)
+		}
+		opts = append(opts, gomigratedirectus.WithClientCert(certPEM, keyPEM))
+	}
+
+	if insecure {
+		opts = append(opts, gomigratedirectus.WithInsecureTLS())
+	}
+
+	return opts, nil
 }
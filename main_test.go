@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus/directustest"
+)
+
+// newTLSServer starts a Directus health endpoint serving a certificate signed
+// by a CA generated for the test, and returns it with the PEM of the CA.
+func newTLSServer(t *testing.T) (*httptest.Server, []byte) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "directus test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca, err = x509.ParseCertificate(caDER); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/health+json")
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leafDER}, PrivateKey: key}}}
+	// Rejected handshakes are logged by the server; keep them out of the
+	// default logger, whose output the tests read.
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+}
+
+func TestClientTLS(t *testing.T) {
+	server, caPEM := newTLSServer(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		caFile   string
+		insecure bool
+		wantErr  string
+	}{
+		{"untrusted", "", false, "certificate signed by unknown authority"},
+		{"CA_CERT_FILE", caFile, false, ""},
+		{"insecure", "", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TARGET_CA_CERT_FILE", tt.caFile)
+			clear(transports)
+			t.Cleanup(func() { clear(transports) })
+			var logs bytes.Buffer
+			defaultLogger := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+			t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+			url, token, environment := server.URL, "token", ""
+			f := &clientFlags{prefix: "TARGET", url: &url, token: &token, environment: &environment, insecure: &tt.insecure}
+			client, err := f.newClient()
+			if err != nil {
+				t.Fatalf("newClient: %v", err)
+			}
+			_, err = client.Health(context.Background())
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Health: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("Health = %v, want an error containing %q", err, tt.wantErr)
+			}
+
+			warned := strings.Contains(logs.String(), "TLS certificate verification is DISABLED")
+			if warned != tt.insecure {
+				t.Errorf("warned about disabled verification: %v, want %v; logs:\n%s", warned, tt.insecure, logs.String())
+			}
+			if tt.insecure && !strings.Contains(logs.String(), "url="+server.URL) {
+				t.Errorf("warning does not name %s:\n%s", server.URL, logs.String())
+			}
+		})
+	}
+}
+
+func TestInsecureFlag(t *testing.T) {
+	defaultLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+	tests := []struct {
+		args []string
+		env  string
+		want bool
+	}{
+		{nil, "", false},
+		{[]string{"--insecure"}, "", true},
+		{nil, "true", true},
+		{[]string{"--insecure=false"}, "true", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("INSECURE_TLS", tt.env)
+		cmd := newCommand("migrate")
+		base := addClientFlags(cmd, "base", "BASE")
+		target := addClientFlags(cmd, "target", "TARGET")
+		if err := cmd.parse(append([]string{"--env-file", os.DevNull}, tt.args...)); err != nil {
+			t.Fatalf("parse %q: %v", tt.args, err)
+		}
+		if *base.insecure != tt.want || *target.insecure != tt.want {
+			t.Errorf("args %q with INSECURE_TLS=%q: insecure = %v, %v, want %v", tt.args, tt.env, *base.insecure, *target.insecure, tt.want)
+		}
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+		setup   func(base, target *directustest.Server)
+		want    int
+	}{
+		{"diff in sync", "diff", nil, func(_, target *directustest.Server) { target.SetDiff(nil) }, 0},
+		{"diff pending", "diff", nil, nil, 2},
+		{"diff pending with custom status", "diff", []string{"--exit-code-on-changes", "3"}, nil, 3},
+		{"diff pending with status 0", "diff", []string{"--exit-code-on-changes", "0"}, nil, 0},
+		{"diff failing", "diff", nil, func(_, target *directustest.Server) {
+			target.Fail("/schema/diff", 1, directustest.Failure{Status: http.StatusForbidden})
+		}, 1},
+		{"migrate in sync", "migrate", []string{"--yes"}, func(_, target *directustest.Server) { target.SetDiff(nil) }, 0},
+		{"migrate applied", "migrate", []string{"--yes"}, nil, 2},
+		{"migrate dry run pending", "migrate", []string{"--dry-run"}, nil, 2},
+		{"migrate failing", "migrate", []string{"--yes", "--no-backup"}, func(_, target *directustest.Server) {
+			target.Fail("/schema/apply", 1, directustest.Failure{Status: http.StatusBadRequest})
+		}, 1},
+		{"default command", "", []string{"--yes"}, nil, 2},
+		{"unknown command", "frobnicate", nil, nil, 1},
+		{"invalid flag", "diff", []string{"--no-such-flag"}, nil, 1},
+		{"help", "help", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, target, _ := newProjects(t)
+			if tt.setup != nil {
+				tt.setup(base, target)
+			}
+			isolate(t)
+			var args []string
+			if tt.command != "" {
+				args = append(args, tt.command)
+			}
+			args = append(args, commandFlags()...)
+			switch tt.command {
+			case "diff":
+				args = append(args, "--base-url", base.URL, "--base-token", directustest.Token, "--url", target.URL, "--token", directustest.Token)
+			case "migrate", "":
+				args = append(args, "--base-url", base.URL, "--base-token", directustest.Token, "--target-url", target.URL, "--target-token", directustest.Token)
+			}
+			if got := run(context.Background(), append(args, tt.args...)); got != tt.want {
+				t.Errorf("run(%q) = %d, want %d", args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	base, target, _ := newProjects(t)
+	isolate(t)
+	target.Fail("/schema/diff", 1, directustest.Failure{Delay: time.Minute})
+	ctx, cancel := context.WithCancelCause(context.Background())
+	go func() {
+		for len(target.Requests()) == 0 || len(target.DiffRequests()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel(fmt.Errorf("%w by interrupt", errInterrupted))
+	}()
+
+	args := append([]string{"migrate"}, commandFlags()...)
+	args = append(args, "--yes", "--base-url", base.URL, "--base-token", directustest.Token, "--target-url", target.URL, "--target-token", directustest.Token)
+	if got := run(ctx, args); got != interruptExitCode {
+		t.Errorf("run of an interrupted migration = %d, want %d", got, interruptExitCode)
+	}
+}
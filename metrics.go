@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// metricsFlags configures the Prometheus endpoint of long-running commands.
+type metricsFlags struct {
+	addr *string
+}
+
+// addMetricsFlags registers --metrics-addr.
+func addMetricsFlags(cmd *command) metricsFlags {
+	return metricsFlags{
+		addr: cmd.String("metrics-addr", "METRICS_ADDR", "", "address such as :9090 to serve Prometheus metrics on at /metrics"),
+	}
+}
+
+// serve starts serving the metrics of the migrations run with opts and of
+// the requests of clients if --metrics-addr is given. The returned function
+// stops the server.
+func (f metricsFlags) serve(opts *gomigratedirectus.MigrationOptions, clients ...*gomigratedirectus.DirectusClient) (func(), error) {
+	if *f.addr == "" {
+		return func() {}, nil
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	metrics, err := gomigratedirectus.NewMetrics(reg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register metrics: %w", err)
+	}
+	opts.Metrics = metrics
+	for _, client := range clients {
+		client.Metrics = metrics
+	}
+
+	listener, err := net.Listen("tcp", *f.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serve metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", gomigratedirectus.MetricsHandler(reg))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("metrics server stopped", "error", err)
+		}
+	}()
+	slog.Info("serving metrics", "addr", listener.Addr().String())
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
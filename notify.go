@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// notifyTimeout bounds the time spent sending the notifications of a command,
+// retries included.
+const notifyTimeout = 30 * time.Second
+
+// notifyFlags configures the notifications sent when a command finishes, to
+// the URLs given as flags and those of the target environments in the config
+// file.
+type notifyFlags struct {
+	slack   *string
+	webhook *string
+	dryRun  *bool
+
+	// environment names the target environments, slackURLs and webhookURLs
+	// collect the URLs of the flags and of the environments.
+	environment string
+	slackURLs   []string
+	webhookURLs []string
+}
+
+// addNotifyFlags registers --slack-webhook-url and --notify-webhook-url.
+// Nothing is sent when dryRun, if not nil, is set.
+func addNotifyFlags(cmd *command, dryRun *bool) *notifyFlags {
+	f := &notifyFlags{
+		slack:   cmd.String("slack-webhook-url", "SLACK_WEBHOOK_URL", "", "Slack incoming webhook notified when the command finishes"),
+		webhook: cmd.String("notify-webhook-url", "NOTIFY_WEBHOOK_URL", "", "URL the outcome is posted to as JSON when the command finishes"),
+		dryRun:  dryRun,
+	}
+	cmd.notify = f
+	return f
+}
+
+// addEnvironment adds the notification URLs of the target environment name
+// of the config file, if any.
+func (f *notifyFlags) addEnvironment(cmd *command, name string) error {
+	if name == "" {
+		return nil
+	}
+	if f.environment != "" {
+		f.environment += ", "
+	}
+	f.environment += name
+	notify, err := cmd.config.notify(name)
+	if err != nil {
+		return err
+	}
+	f.slackURLs = appendNew(f.slackURLs, notify.SlackWebhookURL)
+	f.webhookURLs = appendNew(f.webhookURLs, notify.WebhookURL)
+	return nil
+}
+
+// appendNew appends value to values unless it is empty or already listed.
+func appendNew(values []string, value string) []string {
+	if value == "" || slices.Contains(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+// send notifies the outcome of cmd, which failed with err if not nil. Dry runs
+// and declined confirmations are not notified. Failures are only logged, so
+// that a notification never changes the exit status.
+func (f *notifyFlags) send(cmd *command, err error) {
+	slackURLs, webhookURLs := appendNew(f.slackURLs, *f.slack), appendNew(f.webhookURLs, *f.webhook)
+	if len(slackURLs)+len(webhookURLs) == 0 || (f.dryRun != nil && *f.dryRun) || errors.Is(err, gomigratedirectus.ErrNotConfirmed) {
+		return
+	}
+	var changes *changesError
+	if errors.As(err, &changes) {
+		err = nil
+	}
+	n := gomigratedirectus.NewNotification(cmd.report, false, err)
+	n.Environment = f.environment
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	policy := gomigratedirectus.DefaultRetryPolicy()
+	for _, url := range slackURLs {
+		notifier := &gomigratedirectus.SlackNotifier{WebhookURL: url, RetryPolicy: policy}
+		if err := notifier.Notify(ctx, n); err != nil {
+			slog.Warn("failed to send Slack notification", "error", err)
+		}
+	}
+	for _, url := range webhookURLs {
+		notifier := &gomigratedirectus.WebhookNotifier{URL: url, RetryPolicy: policy}
+		if err := notifier.Notify(ctx, n); err != nil {
+			slog.Warn("failed to send webhook notification", "error", err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log/slog"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// overlayFlags selects the overlay files merged onto the base snapshot. The
+// overlays of the --to environment in the config file come first.
+type overlayFlags struct {
+	paths  *[]string
+	strict *bool
+}
+
+// addOverlayFlags registers --overlay and --strict-overlays.
+func addOverlayFlags(cmd *command) overlayFlags {
+	return overlayFlags{
+		paths:  cmd.Strings("overlay", "OVERLAYS", "overlay file to merge onto the base snapshot, in order"),
+		strict: cmd.Bool("strict-overlays", "STRICT_OVERLAYS", false, "fail instead of warning when an overlay does not fit the snapshot"),
+	}
+}
+
+// load reads the overlay files.
+func (f overlayFlags) load(cmd *command) ([]*gomigratedirectus.Overlay, error) {
+	paths := append(cmd.config.overlays(cmd.flagValue("to")), *f.paths...)
+	overlays := make([]*gomigratedirectus.Overlay, 0, len(paths))
+	for _, path := range paths {
+		overlay, err := gomigratedirectus.LoadOverlay(path)
+		if err != nil {
+			return nil, err
+		}
+		overlays = append(overlays, overlay)
+	}
+	return overlays, nil
+}
+
+// apply loads the overlay files into opts.
+func (f overlayFlags) apply(cmd *command, opts *gomigratedirectus.MigrationOptions) error {
+	overlays, err := f.load(cmd)
+	if err != nil {
+		return err
+	}
+	opts.Overlays, opts.StrictOverlays = overlays, *f.strict
+	return nil
+}
+
+// snapshot merges the overlay files onto snapshot.
+func (f overlayFlags) snapshot(cmd *command, snapshot *gomigratedirectus.Snapshot) (*gomigratedirectus.Snapshot, error) {
+	overlays, err := f.load(cmd)
+	if err != nil || len(overlays) == 0 {
+		return snapshot, err
+	}
+	if snapshot, err = gomigratedirectus.ApplyOverlays(snapshot, overlays, *f.strict, nil); err != nil {
+		return nil, err
+	}
+	slog.Info("overlays merged", "overlays", len(overlays), "collections", len(snapshot.Collections), "fields", len(snapshot.Fields))
+	return snapshot, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// addVarsFlag registers --var, the values of the ${NAME} placeholders of
+// snapshot files.
+func (c *command) addVarsFlag() {
+	c.vars = c.Strings("var", "SNAPSHOT_VARS", "NAME=value of a ${NAME} placeholder in snapshot files")
+}
+
+// parseVars fills c.placeholders with the placeholders section of the config
+// file for the selected environments and the --var values, which win.
+func (c *command) parseVars() error {
+	if c.vars == nil {
+		return nil
+	}
+	c.placeholders = map[string]string{}
+	if c.config != nil {
+		vars, err := c.config.placeholders(c.flagValue("from"), c.flagValue("to"))
+		if err != nil {
+			return err
+		}
+		c.placeholders = vars
+	}
+	for _, item := range *c.vars {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid --var %q, expected NAME=value", item)
+		}
+		c.placeholders[name] = value
+	}
+	return nil
+}
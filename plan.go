@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// runPlan computes the diff between the base and the target project, like
+// diff, and writes it to a plan file for `apply --plan`:
+//
+//	plan --out file|s3://bucket/key [--snapshot file | --base-url url --base-token token]
+//	     [--url url] [--token token] [--force]
+//	     [--include pattern]... [--exclude pattern]... [--exit-code-on-changes code]
+//	     [--overlay file]... [--strict-overlays]
+//
+// Besides the diff the plan records the target URL and the hashes of the base
+// snapshot and the target schema, and a checksum of its own content, so that
+// apply can refuse a plan that was edited or whose target drifted since. No
+// plan is written when the schemas are in sync.
+//
+// The command exits with status 0 when the schemas are in sync, 2 (or the
+// --exit-code-on-changes status) when a plan was written and 1 on errors.
+func runPlan(ctx context.Context, args []string) (err error) {
+	cmd := newCommand("plan")
+	defer func() { err = cmd.finish(err) }()
+	cmd.addExitCodeFlag()
+	cmd.addLoadFlags()
+	out := cmd.String("out", "", "", "file or s3:// URL to write the plan to")
+	path := cmd.String("snapshot", "", "", "snapshot file to plan from (default: live snapshot of the base project)")
+	base := addClientFlags(cmd, "base", "BASE")
+	target := addClientFlags(cmd, "", "TARGET")
+	force := cmd.Bool("force", "FORCE", false, "compute the diff even if Directus versions differ")
+	filters := addFilterFlags(cmd)
+	overlays := addOverlayFlags(cmd)
+	lenientRelations := addRelationsFlag(cmd)
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		cmd.flags.Usage()
+		return fmt.Errorf("missing required configuration:\n  --out")
+	}
+	store, name, err := gomigratedirectus.OpenStoreFile(*out)
+	if err != nil {
+		return fmt.Errorf("invalid --out: %w", err)
+	}
+	if err := filters.filter().Validate(); err != nil {
+		return err
+	}
+	required := []*clientFlags{target}
+	if *path == "" {
+		required = []*clientFlags{base, target}
+	}
+	if err := cmd.require(required...); err != nil {
+		return err
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	targetClient, err := target.newClient()
+	if err != nil {
+		return err
+	}
+	var snapshot *gomigratedirectus.Snapshot
+	if *path != "" {
+		snapshot, err = cmd.loadSnapshot(*path)
+		cmd.report.BaseFile = *path
+	} else {
+		var baseClient *gomigratedirectus.DirectusClient
+		if baseClient, err = base.newClient(); err != nil {
+			return err
+		}
+		snapshot, err = baseClient.GetSnapshot(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("Plan failed: %w", err)
+	}
+	if snapshot, err = overlays.snapshot(cmd, snapshot); err != nil {
+		return fmt.Errorf("Plan failed: %w", err)
+	}
+	snapshot = filters.snapshot(snapshot)
+	if err := checkRelations(snapshot, *lenientRelations); err != nil {
+		return fmt.Errorf("Plan failed: %w", err)
+	}
+
+	// The target schema is read before the diff, so that a change made in
+	// between makes the plan drift rather than go unnoticed.
+	targetSnapshot, err := targetClient.GetSnapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("Plan failed: failed to get target snapshot: %w", err)
+	}
+	diff, err := targetClient.GetDiff(ctx, snapshot, *force)
+	if err == nil {
+		if diff = filters.diff(diff); diff.IsEmpty() {
+			err = gomigratedirectus.ErrNoChanges
+		}
+	}
+	if errors.Is(err, gomigratedirectus.ErrNoChanges) {
+		slog.Info("schemas already in sync, no plan written")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Plan failed: %w", err)
+	}
+
+	plan, err := gomigratedirectus.NewPlan(snapshot, targetClient.URL, targetSnapshot, diff)
+	if err != nil {
+		return fmt.Errorf("Plan failed: %w", err)
+	}
+	plan.Summary = filters.summarize(diff)
+	if err := gomigratedirectus.WritePlanToStore(ctx, store, name, plan); err != nil {
+		return fmt.Errorf("Plan failed: %w", err)
+	}
+	slog.Info("plan written", "path", *out, "target_hash", plan.TargetHash)
+	cmd.report.Changed, cmd.report.Summary, cmd.report.Diff, cmd.report.File = true, &plan.Summary, diff, *out
+
+	if err := printDiff(cmd, diff, plan.Summary, diffFormatText); err != nil {
+		return err
+	}
+	return cmd.changed()
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// stderr is where logs are written. It keeps the status line of a
+// terminalProgress below them.
+var stderr = &statusLine{w: os.Stderr}
+
+// progressLogInterval is how often logProgress reports a phase that is still
+// running.
+const progressLogInterval = 30 * time.Second
+
+// progress shows the progress of the migrations of a command, fed with their
+// events. The library only emits events; rendering them is up to the CLI.
+type progress interface {
+	handle(event gomigratedirectus.Event)
+	// stop ends the display once the command is done.
+	stop()
+}
+
+// newProgress returns a terminalProgress when stdout and stderr are
+// terminals and the output is text, and a logProgress otherwise.
+func newProgress(cmd *command) progress {
+	if !cmd.jsonOutput && isTerminal(os.Stdout) && isTerminal(os.Stderr) {
+		width, _, err := term.GetSize(int(os.Stderr.Fd()))
+		if err != nil || width <= 0 {
+			width = 80
+		}
+		return newTerminalProgress(stderr, width)
+	}
+	return newLogProgress()
+}
+
+// phaseStarted returns the label of the phase event starts, if it starts one.
+func phaseStarted(event gomigratedirectus.Event) (string, bool) {
+	switch e := event.(type) {
+	case *gomigratedirectus.WaitStarted:
+		return "Waiting for " + e.URL, true
+	case *gomigratedirectus.LockWaiting:
+		return "Waiting for the lock held by " + e.Held.Holder, true
+	case *gomigratedirectus.SnapshotStarted:
+		return "Fetching snapshot", true
+	case *gomigratedirectus.DiffStarted:
+		return "Computing diff", true
+	case *gomigratedirectus.BackupStarted:
+		return "Backing up target", true
+	case *gomigratedirectus.ApplyStarted:
+		return "Applying diff", true
+	case *gomigratedirectus.VerifyStarted:
+		return "Verifying target", true
+	case *gomigratedirectus.RollbackStarted:
+		return "Rolling back", true
+	case *gomigratedirectus.FilesSyncStarted:
+		return "Syncing files", true
+	case *gomigratedirectus.DataSyncStarted:
+		return "Syncing data", true
+	case *gomigratedirectus.PermissionsSyncStarted:
+		return "Syncing permissions", true
+	case *gomigratedirectus.UsersSyncStarted:
+		return "Syncing users", true
+	case *gomigratedirectus.PresetsSyncStarted:
+		return "Syncing presets", true
+	case *gomigratedirectus.TranslationsSyncStarted:
+		return "Syncing translations", true
+	case *gomigratedirectus.WebhooksSyncStarted:
+		return "Syncing webhooks", true
+	case *gomigratedirectus.SettingsSyncStarted:
+		return "Syncing settings", true
+	case *gomigratedirectus.FlowsSyncStarted:
+		return "Syncing flows", true
+	case *gomigratedirectus.DashboardsSyncStarted:
+		return "Syncing dashboards", true
+	case *gomigratedirectus.HookStarted:
+		return "Running " + e.Stage + " hook", true
+	}
+	return "", false
+}
+
+// phaseKeepsRunning reports whether event happens within the current phase
+// rather than ending it.
+func phaseKeepsRunning(event gomigratedirectus.Event) bool {
+	switch event.(type) {
+	case *gomigratedirectus.Progress, *gomigratedirectus.ApplyRetrying:
+		return true
+	}
+	return false
+}
+
+// phaseState tracks the running phase of a migration.
+type phaseState struct {
+	label       string
+	started     time.Time
+	done, total int
+	// targets counts the targets of MigrateToTargets, if several.
+	target, targets int
+}
+
+// update applies event to the state and reports whether it changed phase.
+func (s *phaseState) update(event gomigratedirectus.Event, now time.Time) bool {
+	if e, ok := event.(*gomigratedirectus.Progress); ok {
+		if e.Phase == gomigratedirectus.ProgressTargets {
+			s.target, s.targets = e.Done, e.Total
+			return false
+		}
+		s.done, s.total = e.Done, e.Total
+		return false
+	}
+	if label, ok := phaseStarted(event); ok {
+		if label != s.label {
+			s.label, s.started, s.done, s.total = label, now, 0, 0
+		}
+		return true
+	}
+	if !phaseKeepsRunning(event) && s.label != "" {
+		s.label = ""
+		return true
+	}
+	return false
+}
+
+// terminalProgress draws a spinner with the elapsed time of the running
+// phase, or a progress bar for phases with a known total, on a status line.
+type terminalProgress struct {
+	line  *statusLine
+	width int
+
+	mu    sync.Mutex
+	state phaseState
+	frame int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// spinnerFrames are drawn in turn, one per tick.
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// progressBarWidth is the number of cells of a progress bar.
+const progressBarWidth = 30
+
+func newTerminalProgress(line *statusLine, width int) *terminalProgress {
+	p := &terminalProgress{line: line, width: width, done: make(chan struct{})}
+	p.wg.Add(1)
+	go p.tick()
+	return p
+}
+
+func (p *terminalProgress) handle(event gomigratedirectus.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.update(event, time.Now())
+	p.draw()
+}
+
+func (p *terminalProgress) stop() {
+	close(p.done)
+	p.wg.Wait()
+	p.line.set("")
+}
+
+// tick redraws the status line ten times per second.
+func (p *terminalProgress) tick() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.frame++
+			p.draw()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// draw renders the state on the status line. Callers hold p.mu.
+func (p *terminalProgress) draw() {
+	s := p.state
+	if s.label == "" {
+		p.line.set("")
+		return
+	}
+	var b strings.Builder
+	if s.targets > 1 {
+		fmt.Fprintf(&b, "[%d/%d] ", min(s.target+1, s.targets), s.targets)
+	}
+	elapsed := time.Since(s.started).Truncate(time.Second)
+	if s.total > 0 {
+		filled := progressBarWidth * s.done / s.total
+		fmt.Fprintf(&b, "%s [%s%s] %d/%d %3d%% %s", s.label,
+			strings.Repeat("█", filled), strings.Repeat("░", progressBarWidth-filled),
+			s.done, s.total, 100*s.done/s.total, elapsed)
+	} else {
+		fmt.Fprintf(&b, "%s %s %s", spinnerFrames[p.frame%len(spinnerFrames)], s.label, elapsed)
+	}
+	status := []rune(b.String())
+	if len(status) >= p.width {
+		// A wrapped status line could not be erased in place.
+		status = status[:max(p.width-1, 0)]
+	}
+	p.line.set(string(status))
+}
+
+// logProgress logs phases that run for a long time every
+// progressLogInterval, for output that is not a terminal.
+type logProgress struct {
+	mu      sync.Mutex
+	state   phaseState
+	lastLog time.Time
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newLogProgress() *logProgress {
+	p := &logProgress{done: make(chan struct{})}
+	p.wg.Add(1)
+	go p.tick()
+	return p
+}
+
+func (p *logProgress) handle(event gomigratedirectus.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if p.state.update(event, now) {
+		p.lastLog = now
+	}
+}
+
+func (p *logProgress) stop() {
+	close(p.done)
+	p.wg.Wait()
+}
+
+// tick logs the running phase once it has not been logged for
+// progressLogInterval.
+func (p *logProgress) tick() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			if p.state.label != "" && now.Sub(p.lastLog) >= progressLogInterval {
+				p.log(now)
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// log logs the running phase. Callers hold p.mu.
+func (p *logProgress) log(now time.Time) {
+	s := p.state
+	p.lastLog = now
+	attrs := []any{"phase", s.label, "elapsed", now.Sub(s.started).Truncate(time.Second)}
+	if s.total > 0 {
+		attrs = append(attrs, "done", s.done, "total", s.total)
+	}
+	slog.Info("still running", attrs...)
+}
+
+// statusLine writes lines to w while keeping a status line, such as a
+// spinner, drawn in place below them.
+type statusLine struct {
+	mu     sync.Mutex
+	w      io.Writer
+	status string
+}
+
+// clearLine moves the cursor back to the start of the line and erases it.
+const clearLine = "\r\033[K"
+
+func (l *statusLine) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.status == "" {
+		return l.w.Write(p)
+	}
+	io.WriteString(l.w, clearLine)
+	n, err := l.w.Write(p)
+	io.WriteString(l.w, l.status)
+	return n, err
+}
+
+// set replaces the status line by status, or erases it if status is empty.
+func (l *statusLine) set(status string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if status == l.status {
+		return
+	}
+	if l.status != "" {
+		io.WriteString(l.w, clearLine)
+	}
+	io.WriteString(l.w, status)
+	l.status = status
+}
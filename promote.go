@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// runPromote promotes the schema of the first of several config file
+// environments through the others, in order:
+//
+//	promote [--config file] [--from-file file] [--until env] [--force] [--dry-run]
+//	        [--include pattern]... [--exclude pattern]... [--only collection]...
+//	        [--yes] [--no-backup] [--backup-dir dir|url] [--keep-backups n] [--rollback]
+//	        [--backup-repo [--backup-env env]]
+//	        [--allow-destructive] [--max-deletions n] [--exit-code-on-changes code]
+//	        [--record-history ...] [--lock ...] [--strict-hooks] [--slack-webhook-url url]
+//	        env env...
+//
+// The snapshot of the first environment, or of --from-file, in which case
+// every environment is a target, is taken once and migrated to each target in
+// turn, as by migrate. After each hop the target is diffed against the
+// snapshot again and the chain only continues if it is in sync. --until stops
+// after the given environment. Any failure stops the chain.
+//
+// Every hop, with its outcome and duration, is printed at the end and listed
+// under hops in the JSON report. The exit status is that of migrate.
+func runPromote(ctx context.Context, args []string) (err error) {
+	cmd := newCommand("promote")
+	defer func() { err = cmd.finish(err) }()
+	cmd.configRequired = true
+	cmd.addExitCodeFlag()
+	cmd.addLoadFlags()
+	cmd.addInsecureFlag()
+	fromFile := cmd.String("from-file", "", "", "snapshot file to promote instead of the first environment")
+	until := cmd.String("until", "", "", "last environment to promote to")
+	force := cmd.Bool("force", "FORCE", false, "promote even if Directus versions differ")
+	dryRun := cmd.Bool("dry-run", "DRY_RUN", false, "compute and print the diff of every hop without applying it")
+	yes := addYesFlag(cmd)
+	backups := addBackupFlags(cmd)
+	safety := addSafetyFlags(cmd)
+	filters := addFilterFlags(cmd)
+	lenientRelations := addRelationsFlag(cmd)
+	only := addOnlyFlag(cmd)
+	history := addHistoryFlags(cmd)
+	locks := addLockFlags(cmd)
+	hooks := addHookFlags(cmd)
+	notify := addNotifyFlags(cmd, dryRun)
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	envs := cmd.flags.Args()
+	targets := envs
+	if *fromFile == "" && len(envs) > 0 {
+		targets = envs[1:]
+	}
+	if len(targets) == 0 {
+		cmd.flags.Usage()
+		return fmt.Errorf("missing required configuration:\n  environments to promote through, such as: promote dev staging prod")
+	}
+	if *until != "" {
+		i := slices.Index(targets, *until)
+		if i < 0 {
+			return fmt.Errorf("--until %q is not one of the environments to promote to", *until)
+		}
+		targets = targets[:i+1]
+	}
+	for _, name := range targets {
+		if err := notify.addEnvironment(cmd, name); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	opts := gomigratedirectus.MigrationOptions{
+		Force:  *force,
+		DryRun: *dryRun,
+		Output: cmd.stdout,
+		Color:  cmd.color(os.Stdout),
+	}
+	var baseClient *gomigratedirectus.DirectusClient
+	if *fromFile != "" {
+		opts.Source = gomigratedirectus.FileSourceWithOptions(*fromFile, cmd.loadOptions())
+		cmd.report.BaseFile = *fromFile
+		// Load the file now, so that a snapshot not matching its checksum
+		// fails before any request is sent.
+		if _, err := opts.Source.Snapshot(ctx); err != nil {
+			return fmt.Errorf("Promotion failed: %w", err)
+		}
+	} else {
+		if baseClient, err = environmentClient(cmd, "BASE", envs[0]); err != nil {
+			return err
+		}
+		cmd.report.BaseURL = gomigratedirectus.RedactURL(baseClient.URL)
+	}
+	targetClients := make([]*gomigratedirectus.DirectusClient, 0, len(targets))
+	for _, name := range targets {
+		client, err := environmentClient(cmd, "TARGET", name)
+		if err != nil {
+			return err
+		}
+		targetClients = append(targetClients, client)
+		hooks.add(cmd, client, name)
+	}
+
+	if !*yes {
+		opts.Confirm = confirmChanges(os.Stdin, os.Stderr, cmd.color(os.Stderr))
+	}
+	if err := backups.apply(&opts); err != nil {
+		return err
+	}
+	safety.apply(&opts)
+	filters.apply(&opts)
+	opts.LenientRelations = *lenientRelations
+	opts.ScopeCollections = *only
+	history.apply(&opts)
+	locks.apply(&opts)
+	hooks.apply(&opts)
+	if err := cmd.trace(ctx, &opts); err != nil {
+		return fmt.Errorf("Promotion failed: %w", err)
+	}
+	progress := newProgress(cmd)
+	opts.OnEvent = progress.handle
+	promotion, err := gomigratedirectus.Promote(ctx, baseClient, targetClients, opts)
+	progress.stop()
+	changed := false
+	for i, hop := range promotion.Hops {
+		report := gomigratedirectus.HopReport{
+			Environment:  targets[i],
+			TargetReport: targetReport(hop.URL, hop.Result, hop.Err, opts.DryRun),
+			Verified:     hop.Verified,
+			StartedAt:    hop.StartedAt.UTC(),
+			FinishedAt:   hop.FinishedAt.UTC(),
+		}
+		report.Skipped = hop.Skipped
+		changed = changed || (hop.Result != nil && resultChanged(hop.Result))
+		cmd.report.Changed = cmd.report.Changed || report.Changed
+		cmd.report.Applied = cmd.report.Applied || report.Applied
+		cmd.report.Hops = append(cmd.report.Hops, report)
+	}
+	printHops(cmd, targets, promotion.Hops)
+	if err != nil {
+		if opts.DryRun {
+			return fmt.Errorf("Dry run failed: %w", err)
+		}
+		if errors.Is(err, gomigratedirectus.ErrNotConfirmed) {
+			return fmt.Errorf("Promotion aborted: %w", err)
+		}
+		return fmt.Errorf("Promotion failed: %w", err)
+	}
+	if changed {
+		return cmd.changed()
+	}
+	return nil
+}
+
+// environmentClient creates the client of the config file environment name,
+// with the TLS and proxy settings of prefix.
+func environmentClient(cmd *command, prefix, name string) (*gomigratedirectus.DirectusClient, error) {
+	url, token := "", ""
+	f := &clientFlags{prefix: prefix, url: &url, token: &token, environment: &name, insecure: cmd.insecure}
+	if err := f.applyEnvironment(cmd); err != nil {
+		return nil, err
+	}
+	return f.newClient()
+}
+
+// printHops prints one line per hop with its outcome and duration.
+func printHops(cmd *command, envs []string, hops []gomigratedirectus.Hop) {
+	width := 0
+	for _, env := range envs {
+		width = max(width, len(env))
+	}
+	for i, hop := range hops {
+		var status string
+		switch {
+		case hop.Skipped:
+			fmt.Fprintf(cmd.stdout, "%-*s  skipped\n", width, envs[i])
+			continue
+		case hop.Err != nil:
+			status = "failed"
+		case hop.Result.Applied && hop.Verified:
+			status = "applied, verified in sync (" + hop.Result.Summary.String() + ")"
+		case hop.Result.Changed:
+			status = "pending (" + hop.Result.Summary.String() + ")"
+		default:
+			status = "already in sync"
+		}
+		duration := hop.FinishedAt.Sub(hop.StartedAt).Round(time.Millisecond)
+		fmt.Fprintf(cmd.stdout, "%-*s  %s in %s\n", width, envs[i], status, duration)
+	}
+}
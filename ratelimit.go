@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// rateLimitFromEnv returns the rate limit of the clients of prefix, read from
+// <PREFIX>_RATE_LIMIT in requests per second and <PREFIX>_RATE_BURST. The
+// limit is zero when <PREFIX>_RATE_LIMIT is unset.
+func rateLimitFromEnv(prefix string) (gomigratedirectus.RateLimit, error) {
+	var limit gomigratedirectus.RateLimit
+	if value := os.Getenv(prefix + "_RATE_LIMIT"); value != "" {
+		perSecond, err := strconv.ParseFloat(value, 64)
+		if err != nil || perSecond < 0 {
+			return limit, fmt.Errorf("invalid %s_RATE_LIMIT %q, expected requests per second", prefix, value)
+		}
+		limit.PerSecond = perSecond
+	}
+	if value := os.Getenv(prefix + "_RATE_BURST"); value != "" {
+		burst, err := strconv.Atoi(value)
+		if err != nil || burst < 1 {
+			return limit, fmt.Errorf("invalid %s_RATE_BURST %q, expected a positive number of requests", prefix, value)
+		}
+		limit.Burst = burst
+	}
+	return limit, nil
+}
+
+// rateLimitFlags override the rate limit of the clients during sync phases.
+type rateLimitFlags struct {
+	limits *[]string
+}
+
+// addRateLimitFlags registers --phase-rate-limit.
+func addRateLimitFlags(cmd *command) rateLimitFlags {
+	return rateLimitFlags{
+		limits: cmd.Strings("phase-rate-limit", "PHASE_RATE_LIMITS", "requests per second of each client during a sync phase, as phase=rate or phase=rate/burst, such as data=5"),
+	}
+}
+
+// apply copies the flags to opts.
+func (f rateLimitFlags) apply(opts *gomigratedirectus.MigrationOptions) error {
+	for _, value := range *f.limits {
+		phase, spec, ok := strings.Cut(value, "=")
+		if !ok {
+			return fmt.Errorf("invalid --phase-rate-limit %q, expected phase=rate", value)
+		}
+		rate, burst, hasBurst := strings.Cut(spec, "/")
+		var limit gomigratedirectus.RateLimit
+		var err error
+		if limit.PerSecond, err = strconv.ParseFloat(rate, 64); err != nil || limit.PerSecond < 0 {
+			return fmt.Errorf("invalid --phase-rate-limit %q, expected requests per second", value)
+		}
+		if hasBurst {
+			if limit.Burst, err = strconv.Atoi(burst); err != nil || limit.Burst < 1 {
+				return fmt.Errorf("invalid --phase-rate-limit %q, expected a positive burst", value)
+			}
+		}
+		if opts.PhaseRateLimits == nil {
+			opts.PhaseRateLimits = map[string]gomigratedirectus.RateLimit{}
+		}
+		opts.PhaseRateLimits[phase] = limit
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// safetyFlags configures which destructive changes may be applied.
+type safetyFlags struct {
+	allowDestructive *bool
+	maxDeletions     *int
+}
+
+// addSafetyFlags registers --allow-destructive and --max-deletions.
+func addSafetyFlags(cmd *command) safetyFlags {
+	return safetyFlags{
+		allowDestructive: cmd.Bool("allow-destructive", "ALLOW_DESTRUCTIVE", false, "apply diffs that delete collections or fields or narrow field types"),
+		maxDeletions:     cmd.Int("max-deletions", "MAX_DELETIONS", 0, "refuse diffs deleting more collections and fields than this even with --allow-destructive, 0 for no limit"),
+	}
+}
+
+// apply copies the flags to opts.
+func (f safetyFlags) apply(opts *gomigratedirectus.MigrationOptions) {
+	opts.AllowDestructive = *f.allowDestructive
+	opts.MaxDeletions = *f.maxDeletions
+}
+
+// check enforces the flags on diff.
+func (f safetyFlags) check(diff *gomigratedirectus.Diff) error {
+	return gomigratedirectus.CheckDestructive(diff, *f.allowDestructive, *f.maxDeletions)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// errSelectNotInteractive is returned by --interactive when nobody can
+// answer.
+var errSelectNotInteractive = errors.New("stdin is not a terminal, --interactive needs one; pass --only-collections to select changes without prompting")
+
+// selectFlags select the changes of a diff to apply.
+type selectFlags struct {
+	interactive     *bool
+	onlyCollections *[]string
+}
+
+// addSelectFlags registers --interactive and --only-collections.
+func addSelectFlags(cmd *command) selectFlags {
+	return selectFlags{
+		interactive:     cmd.Bool("interactive", "", false, "choose the changes of the diff to apply"),
+		onlyCollections: cmd.Strings("only-collections", "ONLY_COLLECTIONS", "only apply the changes to the collections matching this name or glob"),
+	}
+}
+
+// check fails with errSelectNotInteractive when --interactive is given and
+// stdin is not a terminal, before any request is sent.
+func (f selectFlags) check() error {
+	if *f.interactive && !isTerminal(os.Stdin) {
+		return errSelectNotInteractive
+	}
+	return nil
+}
+
+// apply copies the flags to opts.
+func (f selectFlags) apply(opts *gomigratedirectus.MigrationOptions) {
+	opts.OnlyCollections = *f.onlyCollections
+	if *f.interactive {
+		opts.SelectChanges = selectChanges(os.Stdin, os.Stderr)
+	}
+}
+
+// diff narrows diff like MigrateWithOptions does with the options of apply,
+// for the apply command. It returns a nil diff when no change is left.
+func (f selectFlags) diff(ctx context.Context, target string, diff *gomigratedirectus.Diff) (*gomigratedirectus.Diff, error) {
+	if len(*f.onlyCollections) == 0 && !*f.interactive {
+		return diff, nil
+	}
+	var choose gomigratedirectus.SelectFunc
+	if *f.interactive {
+		choose = selectChanges(os.Stdin, os.Stderr)
+	}
+	keys, err := gomigratedirectus.ChooseChanges(ctx, target, diff, *f.onlyCollections, choose)
+	if err != nil {
+		return nil, err
+	}
+	if selected := gomigratedirectus.SelectDiff(diff, keys); !selected.IsEmpty() {
+		return selected, nil
+	}
+	return nil, nil
+}
+
+// selectChanges returns a SelectFunc that lists the changes on out, grouped
+// by collection, and lets the operator check the ones to apply on in. It
+// fails with errSelectNotInteractive when in is not a terminal.
+func selectChanges(in *os.File, out io.Writer) gomigratedirectus.SelectFunc {
+	return func(ctx context.Context, target string, items []gomigratedirectus.DiffItem) ([]string, error) {
+		if !isTerminal(in) {
+			return nil, errSelectNotInteractive
+		}
+		checked := make([]bool, len(items))
+		reader := bufio.NewReader(in)
+		message := ""
+		for {
+			printSelection(out, target, items, checked)
+			if message != "" {
+				fmt.Fprintln(out, message)
+			}
+			fmt.Fprint(out, "Toggle numbers, ranges (2-5) or collections, a for all, n for none, empty line when done, q to quit: ")
+			line, err := readLine(ctx, reader)
+			if err != nil {
+				fmt.Fprintln(out)
+				return nil, err
+			}
+			message = ""
+			switch strings.ToLower(line) {
+			case "":
+				var keys []string
+				for i, item := range items {
+					if checked[i] {
+						keys = append(keys, item.Key)
+					}
+				}
+				return keys, nil
+			case "q", "quit":
+				return nil, nil
+			case "a", "all":
+				for i := range checked {
+					checked[i] = true
+				}
+				continue
+			case "n", "none":
+				clear(checked)
+				continue
+			}
+			for _, word := range strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == ',' }) {
+				if err := toggleSelection(items, checked, word); err != nil {
+					message = err.Error()
+				}
+			}
+		}
+	}
+}
+
+// toggleSelection toggles the items word names: a number, a range of numbers
+// or a collection, all of whose changes are checked unless they all are.
+func toggleSelection(items []gomigratedirectus.DiffItem, checked []bool, word string) error {
+	first, last, isRange := strings.Cut(word, "-")
+	from, err := strconv.Atoi(first)
+	if err != nil {
+		var indexes []int
+		for i, item := range items {
+			if item.Collection == word {
+				indexes = append(indexes, i)
+			}
+		}
+		if len(indexes) == 0 {
+			return fmt.Errorf("no change numbered or in a collection called %q", word)
+		}
+		all := !slices.ContainsFunc(indexes, func(i int) bool { return !checked[i] })
+		for _, i := range indexes {
+			checked[i] = !all
+		}
+		return nil
+	}
+	to := from
+	if isRange {
+		if to, err = strconv.Atoi(last); err != nil {
+			return fmt.Errorf("invalid range %q", word)
+		}
+	}
+	if from < 1 || to > len(items) || from > to {
+		return fmt.Errorf("invalid selection %q, expected numbers from 1 to %d", word, len(items))
+	}
+	for i := from - 1; i < to; i++ {
+		checked[i] = !checked[i]
+	}
+	return nil
+}
+
+// printSelection prints the changes with their checkboxes, grouped by
+// collection.
+func printSelection(out io.Writer, target string, items []gomigratedirectus.DiffItem, checked []bool) {
+	fmt.Fprintf(out, "\nChanges to %s:\n", target)
+	collection := ""
+	for i, item := range items {
+		if i == 0 || item.Collection != collection {
+			collection = item.Collection
+			fmt.Fprintf(out, "\n%s\n", collection)
+		}
+		box := "[ ]"
+		if checked[i] {
+			box = "[x]"
+		}
+		name := item.Kind
+		if item.Field != "" {
+			name += " " + item.Field
+		}
+		fmt.Fprintf(out, "  %3d %s %s %s\n", i+1, box, changeVerb(item.Change), name)
+	}
+	fmt.Fprintln(out)
+}
+
+// changeVerb describes a change type.
+func changeVerb(change gomigratedirectus.ChangeType) string {
+	switch change {
+	case gomigratedirectus.ChangeCreated:
+		return "create"
+	case gomigratedirectus.ChangeDeleted:
+		return "delete"
+	}
+	return "update"
+}
+
+// readLine reads a line from reader, trimmed, unless ctx is done first.
+func readLine(ctx context.Context, reader *bufio.Reader) (string, error) {
+	answer := make(chan string, 1)
+	go func() {
+		line, _ := reader.ReadString('\n')
+		answer <- line
+	}()
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case line := <-answer:
+		return strings.TrimSpace(line), nil
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// interruptExitCode is the exit status of a command stopped by SIGINT or
+// SIGTERM, the status shells give processes killed by SIGINT.
+const interruptExitCode = 130
+
+// errInterrupted is the cause of the cancellation of the context returned by
+// notifyInterrupt.
+var errInterrupted = errors.New("interrupted")
+
+// notifyInterrupt returns a context canceled with errInterrupted by the first
+// SIGINT or SIGTERM. The command then stops like on any canceled context: the
+// requests in flight are aborted, the lock is released, the on-failure hooks
+// run and the summary and report are written. A second signal exits at once
+// with interruptExitCode, for cleanups that hang. stop stops catching
+// signals.
+func notifyInterrupt() (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			slog.Warn("interrupted, stopping; interrupt again to exit at once", "signal", sig)
+			cancel(fmt.Errorf("%w by %s", errInterrupted, sig))
+		case <-done:
+			return
+		}
+		select {
+		case <-signals:
+			fmt.Fprintln(os.Stderr, "Interrupted again, exiting without cleaning up")
+			os.Exit(interruptExitCode)
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel(nil)
+	}
+}
+
+// interrupted reports whether ctx, returned by notifyInterrupt, was canceled
+// by a signal.
+func interrupted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errInterrupted)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// runSnapshot exports the schema snapshot of a project, the base project
+// unless --url is given, normalized unless --no-normalize is given:
+//
+//	snapshot [--url url] [--token token] [--format json|yaml] [--out file]
+//	         [--no-normalize] [--strip-key path]... [--checksum]
+//	         [--templatize [--var NAME=value]...]
+//	         [--git-commit [--git-message template] [--git-tag template]
+//	          [--git-branch branch] [--git-push [--git-remote remote]]]
+func runSnapshot(ctx context.Context, args []string) (err error) {
+	cmd := newCommand("snapshot")
+	defer func() { err = cmd.finish(err) }()
+	base := addClientFlags(cmd, "", "BASE")
+	format := cmd.String("format", "", "json", "snapshot format, json or yaml")
+	out := cmd.String("out", "", "", "file to write the snapshot to (default stdout)")
+	noNormalize := cmd.Bool("no-normalize", "NO_NORMALIZE", false, "write the snapshot as exported by Directus instead of sorting it and normalizing numbers")
+	checksum := cmd.Bool("checksum", "SNAPSHOT_CHECKSUM", false, "write the SHA-256 of the snapshot to a .sha256 file next to --out")
+	stripKeys := cmd.Strings("strip-key", "STRIP_KEYS", "key to remove from every collection, field and relation, such as meta.id")
+	templatize := cmd.Bool("templatize", "SNAPSHOT_TEMPLATIZE", false, "replace the --var values found in the snapshot with ${NAME} placeholders")
+	cmd.addVarsFlag()
+	git := addGitFlags(cmd)
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	if err := cmd.require(base); err != nil {
+		return err
+	}
+	if cmd.jsonOutput && *out == "" {
+		return fmt.Errorf("--output json needs --out, stdout carries the report")
+	}
+	if *checksum && *out == "" {
+		return fmt.Errorf("--checksum needs --out")
+	}
+	if err := git.validate(*out); err != nil {
+		return err
+	}
+	normalize := gomigratedirectus.NormalizeOptions{StripKeys: *stripKeys}
+	if err := normalize.Validate(); err != nil {
+		return err
+	}
+	if *noNormalize && len(normalize.StripKeys) > 0 {
+		return fmt.Errorf("--strip-key cannot be used with --no-normalize")
+	}
+	if *templatize && *noNormalize {
+		return fmt.Errorf("--templatize cannot be used with --no-normalize")
+	}
+	if *templatize && len(cmd.placeholders) == 0 {
+		return fmt.Errorf("--templatize needs values to replace, set with --var or the placeholders of the config file")
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	client, err := base.newClient()
+	if err != nil {
+		return err
+	}
+
+	var repo *gitRepo
+	if *git.commit {
+		if repo, err = git.open(ctx, *out); err != nil {
+			return fmt.Errorf("Snapshot failed: %w", err)
+		}
+	}
+
+	data, err := client.GetSnapshotRaw(ctx, *format)
+	if err != nil {
+		return fmt.Errorf("Snapshot failed: %w", err)
+	}
+	var snapshot *gomigratedirectus.Snapshot
+	if !*noNormalize || *checksum || repo != nil {
+		if snapshot, err = gomigratedirectus.ParseSnapshot(data, *format); err != nil {
+			return fmt.Errorf("Snapshot failed: %w", err)
+		}
+	}
+	if !*noNormalize {
+		snapshot = gomigratedirectus.NormalizeSnapshotWithOptions(snapshot, normalize)
+		if *templatize {
+			snapshot = gomigratedirectus.TemplatizeSnapshot(snapshot, cmd.placeholders)
+		}
+		if data, err = gomigratedirectus.EncodeSnapshot(snapshot, *format); err != nil {
+			return fmt.Errorf("Snapshot failed: %w", err)
+		}
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(*out), 0o755); err != nil {
+		return fmt.Errorf("Snapshot failed: failed to create directory: %w", err)
+	}
+	if err := gomigratedirectus.WriteSnapshotFile(*out, data); err != nil {
+		return fmt.Errorf("Snapshot failed: %w", err)
+	}
+	if *checksum {
+		if err := gomigratedirectus.WriteChecksum(*out, snapshot); err != nil {
+			return fmt.Errorf("Snapshot failed: %w", err)
+		}
+	} else if err := os.Remove(gomigratedirectus.ChecksumPath(*out)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("Snapshot failed: failed to remove stale checksum: %w", err)
+	}
+	slog.Info("snapshot written", "path", *out)
+	cmd.report.File = *out
+
+	if repo != nil {
+		hash, err := gomigratedirectus.SnapshotHash(snapshot)
+		if err != nil {
+			return fmt.Errorf("Snapshot failed: %w", err)
+		}
+		now := time.Now()
+		cmd.report.GitCommit, cmd.report.GitTag, err = repo.commit(ctx, gitInfo{
+			BaseURL:   gomigratedirectus.RedactURL(client.URL),
+			Directus:  snapshot.Directus,
+			Hash:      hash,
+			ShortHash: hash[:12],
+			Date:      now.UTC().Format("2006.01.02"),
+			Time:      now,
+		})
+		if err != nil {
+			return fmt.Errorf("Snapshot failed: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// addSnapshotRepoFlag registers --snapshot-repo.
+func addSnapshotRepoFlag(cmd *command) *string {
+	return cmd.String("snapshot-repo", "SNAPSHOT_REPO", gomigratedirectus.DefaultSnapshotRepository,
+		"directory, file:// or s3://bucket/prefix URL of the snapshot repository env@tag references resolve in")
+}
+
+// runSnapshots manages the snapshots of a snapshot repository, such as the
+// backups written with --backup-repo:
+//
+//	snapshots list [--snapshot-repo dir|url] [--env env]
+//	snapshots add [--snapshot-repo dir|url] --env env file
+//	snapshots tag [--snapshot-repo dir|url] id|env@tag name
+//	snapshots prune [--snapshot-repo dir|url] [--keep n] [--keep-tagged] [--env env] [--dry-run]
+//
+// list prints a table of the snapshots, by environment and from the oldest.
+// prune keeps the newest --keep snapshots of each environment, and with
+// --keep-tagged the older ones that have a tag. The snapshots listed, added,
+// tagged or removed are listed under snapshots in the JSON report.
+func runSnapshots(ctx context.Context, args []string) (err error) {
+	actions := []string{"list", "add", "tag", "prune"}
+	if len(args) == 0 || !slices.Contains(actions, args[0]) {
+		fmt.Fprint(os.Stderr, "Usage: go-mirgrate-directus snapshots list|add|tag|prune [flags]\n")
+		if len(args) == 0 {
+			return fmt.Errorf("missing action, list, add, tag or prune")
+		}
+		return fmt.Errorf("unknown action %q, expected list, add, tag or prune", args[0])
+	}
+	action := args[0]
+	cmd := newCommand("snapshots " + action)
+	defer func() { err = cmd.finish(err) }()
+	location := addSnapshotRepoFlag(cmd)
+	cmd.snapshotRepo = location
+	env := cmd.String("env", "", "", "environment of the snapshots")
+	var keep *int
+	var keepTagged, dryRun *bool
+	if action == "add" {
+		cmd.skipVerify = cmd.Bool("skip-verify", "SKIP_VERIFY", false, "add a snapshot file that does not match its .sha256 checksum file")
+	}
+	if action == "prune" {
+		keep = cmd.Int("keep", "", 20, "number of snapshots to keep per environment")
+		keepTagged = cmd.Bool("keep-tagged", "", false, "also keep the older snapshots that have a tag")
+		dryRun = cmd.Bool("dry-run", "DRY_RUN", false, "list the snapshots that would be removed without removing them")
+	}
+	if err := cmd.parse(args[1:]); err != nil {
+		return err
+	}
+	positional := cmd.flags.Args()
+	switch action {
+	case "add":
+		if *env == "" || len(positional) != 1 {
+			return fmt.Errorf("usage: snapshots add --env env file")
+		}
+	case "tag":
+		if len(positional) != 2 {
+			return fmt.Errorf("usage: snapshots tag id|env@tag name")
+		}
+	default:
+		if len(positional) > 0 {
+			return fmt.Errorf("unexpected argument %q", positional[0])
+		}
+	}
+	if keep != nil && *keep < 0 {
+		return fmt.Errorf("invalid --keep %d, expected 0 or more", *keep)
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	repo, err := gomigratedirectus.OpenSnapshotRepository(*location)
+	if err != nil {
+		return fmt.Errorf("invalid --snapshot-repo: %w", err)
+	}
+	switch action {
+	case "list":
+		snapshots, err := repo.List(ctx)
+		if err != nil {
+			return fmt.Errorf("Snapshots failed: %w", err)
+		}
+		if *env != "" {
+			snapshots = slices.DeleteFunc(snapshots, func(s gomigratedirectus.RepositorySnapshot) bool { return s.Env != *env })
+		}
+		cmd.report.Snapshots = snapshots
+		return printSnapshots(cmd, snapshots)
+	case "add":
+		snapshot, err := cmd.loadSnapshot(positional[0])
+		if err != nil {
+			return fmt.Errorf("Snapshots failed: %w", err)
+		}
+		entry, err := repo.Add(ctx, *env, snapshot)
+		if err != nil {
+			return fmt.Errorf("Snapshots failed: %w", err)
+		}
+		slog.Info("snapshot added", "id", entry.ID, "path", repo.Location(entry))
+		cmd.report.Snapshots = []gomigratedirectus.RepositorySnapshot{*entry}
+	case "tag":
+		entry, err := repo.Tag(ctx, positional[0], positional[1])
+		if err != nil {
+			return fmt.Errorf("Snapshots failed: %w", err)
+		}
+		slog.Info("snapshot tagged", "id", entry.ID, "tag", positional[1])
+		cmd.report.Snapshots = []gomigratedirectus.RepositorySnapshot{*entry}
+	case "prune":
+		removed, err := repo.Prune(ctx, gomigratedirectus.RepositoryPruneOptions{
+			Keep:       *keep,
+			KeepTagged: *keepTagged,
+			Env:        *env,
+			DryRun:     *dryRun,
+		})
+		cmd.report.Snapshots = removed
+		if err != nil {
+			return fmt.Errorf("Snapshots failed: %w", err)
+		}
+		verb := "removed"
+		if *dryRun {
+			verb = "would remove"
+		}
+		for _, entry := range removed {
+			fmt.Fprintf(cmd.stdout, "%s %s\n", verb, entry.ID)
+		}
+		slog.Info("snapshots pruned", "removed", len(removed), "dry_run", *dryRun)
+	}
+	return nil
+}
+
+// printSnapshots prints snapshots as a table.
+func printSnapshots(cmd *command, snapshots []gomigratedirectus.RepositorySnapshot) error {
+	w := tabwriter.NewWriter(cmd.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tENV\tTIME\tHASH\tSIZE\tTAGS")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", s.ID, s.Env, s.Time.UTC().Format("2006-01-02 15:04:05"),
+			s.Hash[:min(len(s.Hash), 12)], s.Size, strings.Join(s.Tags, ","))
+	}
+	return w.Flush()
+}
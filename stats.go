@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// printStats prints the duration and size of each phase of a migration and
+// the totals as a table.
+func printStats(w io.Writer, stats *gomigratedirectus.MigrationStats) error {
+	if len(stats.Phases) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tDURATION\tBYTES")
+	for _, phase := range stats.Phases {
+		name := phase.Phase
+		if phase.Failed {
+			name += " (failed)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, formatDuration(phase.Duration), formatBytes(phase.Bytes))
+	}
+	fmt.Fprintf(tw, "total\t%s\t%s\n", formatDuration(stats.Duration), formatBytes(stats.Bytes))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "diff entries: %d\n", stats.DiffEntries)
+	return err
+}
+
+// formatDuration rounds d to milliseconds, or microseconds below one.
+func formatDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// formatBytes formats n, or "-" for phases that transfer no payload.
+func formatBytes(n int64) string {
+	if n == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(n, 10)
+}
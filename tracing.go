@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// tracingShutdownTimeout bounds the time spent flushing spans when a command
+// finishes.
+const tracingShutdownTimeout = 10 * time.Second
+
+// trace makes the migrations run with opts export their spans over OTLP/HTTP
+// when OTEL_EXPORTER_OTLP_ENDPOINT is set. The exporter and the resource are
+// configured by the standard OTEL_* variables, such as OTEL_SERVICE_NAME and
+// OTEL_EXPORTER_OTLP_HEADERS. Spans are flushed when the command finishes.
+func (c *command) trace(ctx context.Context, opts *gomigratedirectus.MigrationOptions) error {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "go-mirgrate-directus"), attribute.String("service.version", gomigratedirectus.GetBuildInfo().Version)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK())
+	if err != nil {
+		return fmt.Errorf("failed to describe trace resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	opts.TracerProvider = provider
+	c.stopTracing = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			slog.Warn("failed to export traces", "error", err)
+		}
+	}
+	return nil
+}
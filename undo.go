@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// runUndo reverts the last migration of the target project by applying the
+// reverse diff that migrate and apply saved next to their backup:
+//
+//	undo [--url url] [--token token] [--undo file] [--yes]
+//	     [--no-backup] [--backup-dir dir|url] [--keep-backups n] [--rollback]
+//	     [--backup-repo [--backup-env env]]
+//	     [--allow-destructive] [--max-deletions n]
+//	     [--lock [--lock-timeout duration] [--lock-ttl duration] [--lock-collection name]]
+//
+// The newest undo record of the target in --backup-dir is used unless --undo
+// names one. It is refused when the target schema hash changed since the
+// migration, and, since reverting the creation of collections deletes them,
+// when it is destructive without --allow-destructive, as by apply. The undo
+// is itself backed up and recorded, so running undo again redoes the
+// migration.
+func runUndo(ctx context.Context, args []string) (err error) {
+	cmd := newCommand("undo")
+	defer func() { err = cmd.finish(err) }()
+	path := cmd.String("undo", "", "", "undo record file or s3:// URL to apply (default: the newest one of the target in --backup-dir)")
+	target := addClientFlags(cmd, "", "TARGET")
+	yes := addYesFlag(cmd)
+	backups := addBackupFlags(cmd)
+	safety := addSafetyFlags(cmd)
+	locks := addLockFlags(cmd)
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	if err := cmd.require(target); err != nil {
+		return err
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	client, err := target.newClient()
+	if err != nil {
+		return err
+	}
+	unlock, err := locks.acquire(ctx, client, "")
+	if err != nil {
+		return fmt.Errorf("Undo failed: %w", err)
+	}
+	defer unlock()
+
+	var record *gomigratedirectus.UndoRecord
+	var location string
+	if *path != "" {
+		store, name, err := gomigratedirectus.OpenStoreFile(*path)
+		if err != nil {
+			return fmt.Errorf("Undo failed: %w", err)
+		}
+		if record, err = gomigratedirectus.ReadUndoRecord(ctx, store, name); err != nil {
+			return fmt.Errorf("Undo failed: %w", err)
+		}
+		location = store.Location(name)
+	} else {
+		store, err := gomigratedirectus.OpenStore(*backups.dir)
+		if err != nil {
+			return fmt.Errorf("Undo failed: invalid --backup-dir: %w", err)
+		}
+		record, location, err = gomigratedirectus.LatestUndoRecord(ctx, store, client.URL)
+		if err != nil {
+			return fmt.Errorf("Undo failed: %w", err)
+		}
+		location = store.Location(location)
+	}
+	if err := gomigratedirectus.CheckUndo(ctx, client, record); err != nil {
+		return fmt.Errorf("Undo failed: %w", err)
+	}
+	slog.Info("target schema matches the undo record", "path", location, "target_hash", record.TargetHash, "recorded_at", record.CreatedAt)
+
+	summary := gomigratedirectus.SummarizeDiff(record.Diff)
+	cmd.report.Changed, cmd.report.Summary = true, &summary
+	cmd.report.DestructiveChanges = gomigratedirectus.FindDestructiveChanges(record.Diff)
+	if err := safety.check(record.Diff); err != nil {
+		return fmt.Errorf("Undo failed: %w", err)
+	}
+	if !*yes {
+		ok, err := confirmChanges(os.Stdin, os.Stderr, cmd.color(os.Stderr))(ctx, gomigratedirectus.RedactURL(client.URL), record.Diff, summary)
+		if err != nil {
+			return fmt.Errorf("Undo failed: %w", err)
+		}
+		if !ok {
+			return fmt.Errorf("Undo aborted: %w", gomigratedirectus.ErrNotConfirmed)
+		}
+	}
+	var backup *gomigratedirectus.Snapshot
+	if cmd.report.BackupPath, backup, err = backups.backup(ctx, client); err != nil {
+		return fmt.Errorf("Undo failed: %w", err)
+	}
+	slog.Info("applying undo", "path", location, "summary", summary.String())
+	progress := newProgress(cmd)
+	progress.handle(&gomigratedirectus.ApplyStarted{})
+	err = gomigratedirectus.ApplyUndo(ctx, client, record)
+	progress.stop()
+	if err != nil {
+		return fmt.Errorf("Undo failed: %w", backups.restore(ctx, client, backup, err, cmd.report))
+	}
+	cmd.report.Applied = true
+	slog.Info("undo applied", "request_id", client.LastRequestID())
+	backups.recordUndo(ctx, client, backup, cmd.report)
+	return nil
+}
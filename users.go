@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// userFlags configures the provisioning of users after a migration. The
+// password for created users is read from USER_PASSWORD only, to keep it out
+// of the process list.
+type userFlags struct {
+	sync      *bool
+	roles     *[]string
+	emails    *[]string
+	invite    *bool
+	inviteURL *string
+}
+
+// addUserFlags registers --with-users, --user-role, --user-email,
+// --invite-users and --invite-url.
+func addUserFlags(cmd *command) userFlags {
+	return userFlags{
+		sync:      cmd.Bool("with-users", "SYNC_USERS", false, "also create the selected non-admin base users that the target does not have"),
+		roles:     cmd.Strings("user-role", "USER_ROLES", "provision the users of this base role"),
+		emails:    cmd.Strings("user-email", "USER_EMAILS", "provision the base user with this email"),
+		invite:    cmd.Bool("invite-users", "INVITE_USERS", false, "send Directus invite emails instead of setting passwords"),
+		inviteURL: cmd.String("invite-url", "INVITE_URL", "", "page the invite emails link to"),
+	}
+}
+
+// apply copies the flags to opts. Generated passwords are only printed in
+// text output, so JSON output needs USER_PASSWORD or invites.
+func (f userFlags) apply(opts *gomigratedirectus.MigrationOptions, jsonOutput bool) error {
+	opts.SyncUsers = *f.sync
+	opts.UserRoles = *f.roles
+	opts.UserEmails = *f.emails
+	opts.UserPassword = os.Getenv("USER_PASSWORD")
+	opts.InviteUsers = *f.invite
+	opts.InviteURL = *f.inviteURL
+	if !opts.SyncUsers {
+		return nil
+	}
+	if len(opts.UserRoles) == 0 && len(opts.UserEmails) == 0 {
+		return fmt.Errorf("--with-users needs --user-role or --user-email")
+	}
+	if jsonOutput && !opts.InviteUsers && opts.UserPassword == "" {
+		return fmt.Errorf("generated user passwords are only printed with --output text, set USER_PASSWORD or use --invite-users")
+	}
+	return nil
+}
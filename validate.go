@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// runValidate checks a snapshot file, or the live snapshot of the base
+// project when no file is given, and fails when it has problems:
+//
+//	validate [--snapshot file | --url url --token token]
+func runValidate(ctx context.Context, args []string) (err error) {
+	cmd := newCommand("validate")
+	defer func() { err = cmd.finish(err) }()
+	path := cmd.String("snapshot", "", "", "snapshot file to validate (default: live snapshot of the base project)")
+	cmd.addLoadFlags()
+	base := addClientFlags(cmd, "", "BASE")
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	var snapshot *gomigratedirectus.Snapshot
+	if *path != "" {
+		var err error
+		if snapshot, err = cmd.loadSnapshot(*path); err != nil {
+			return fmt.Errorf("Validation failed: %w", err)
+		}
+	} else {
+		if err := cmd.require(base); err != nil {
+			return err
+		}
+		client, err := base.newClient()
+		if err != nil {
+			return err
+		}
+		if snapshot, err = client.GetSnapshot(ctx); err != nil {
+			return fmt.Errorf("Validation failed: %w", err)
+		}
+	}
+
+	var problems []gomigratedirectus.ValidationProblem
+	for _, validate := range []func(*gomigratedirectus.Snapshot) error{gomigratedirectus.ValidateSnapshot, gomigratedirectus.ValidateRelations} {
+		var invalid *gomigratedirectus.ValidationError
+		if err := validate(snapshot); errors.As(err, &invalid) {
+			// ValidateRelations repeats the unknown collections and fields
+			// ValidateSnapshot already reported.
+			for _, problem := range invalid.Problems {
+				if !slices.ContainsFunc(problems, func(p gomigratedirectus.ValidationProblem) bool { return p.Path == problem.Path }) {
+					problems = append(problems, problem)
+				}
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(problems) > 0 {
+		return &gomigratedirectus.ValidationError{Problems: problems}
+	}
+	slog.Info("snapshot is valid")
+	return nil
+}
+
+// addRelationsFlag registers --lenient-relations on commands that diff a
+// snapshot.
+func addRelationsFlag(cmd *command) *bool {
+	return cmd.Bool("lenient-relations", "LENIENT_RELATIONS", false, "warn about relation integrity problems of the base snapshot instead of failing")
+}
+
+// checkRelations checks snapshot with ValidateRelations before it is diffed,
+// only logging the problems with lenient.
+func checkRelations(snapshot *gomigratedirectus.Snapshot, lenient bool) error {
+	err := gomigratedirectus.ValidateRelations(snapshot)
+	var invalid *gomigratedirectus.ValidationError
+	if !lenient || !errors.As(err, &invalid) {
+		return err
+	}
+	for _, problem := range invalid.Problems {
+		slog.Warn("relation integrity problem", "path", problem.Path, "problem", problem.Message)
+	}
+	return nil
+}
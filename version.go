@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// runVersion prints the version, commit, build date and Go version of the
+// binary:
+//
+//	version [--output json]
+//
+// --version is a shorthand for it. Like completion, it neither loads the env
+// file nor the config file, so it works anywhere.
+func runVersion(_ context.Context, args []string) (err error) {
+	cmd := newCommand("version")
+	defer func() { err = cmd.finish(err) }()
+	cmd.standalone = true
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	if positional := cmd.flags.Args(); len(positional) > 0 {
+		return fmt.Errorf("unexpected argument %q", positional[0])
+	}
+
+	info := gomigratedirectus.GetBuildInfo()
+	cmd.report.Build = &info
+	fmt.Fprintf(cmd.stdout, "go-mirgrate-directus %s\n", info.Version)
+	commit := orUnknown(info.Commit)
+	if info.Modified {
+		commit += " (modified)"
+	}
+	fmt.Fprintf(cmd.stdout, "commit: %s\n", commit)
+	fmt.Fprintf(cmd.stdout, "built:  %s\n", orUnknown(info.BuildDate))
+	fmt.Fprintf(cmd.stdout, "go:     %s\n", info.GoVersion)
+	return nil
+}
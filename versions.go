@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// runVersions runs the pre-flight version check of migrate on its own and
+// prints the Directus version and database vendor of both projects:
+//
+//	versions [--base-url url] [--base-token token] [--target-url url] [--target-token token]
+//
+// It fails when the versions or vendors are incompatible.
+func runVersions(ctx context.Context, args []string) (err error) {
+	cmd := newCommand("versions")
+	defer func() { err = cmd.finish(err) }()
+	base := addClientFlags(cmd, "base", "BASE")
+	target := addClientFlags(cmd, "target", "TARGET")
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	if err := cmd.require(base, target); err != nil {
+		return err
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	baseClient, err := base.newClient()
+	if err != nil {
+		return err
+	}
+	targetClient, err := target.newClient()
+	if err != nil {
+		return err
+	}
+
+	baseInfo, targetInfo, err := gomigratedirectus.CheckVersions(ctx, baseClient, targetClient)
+	if baseInfo != nil {
+		cmd.report.BaseServer, cmd.report.TargetServer = baseInfo, targetInfo
+		fmt.Fprintf(cmd.stdout, "base:   Directus %s (%s)\n", orUnknown(baseInfo.Version), orUnknown(baseInfo.Vendor))
+		fmt.Fprintf(cmd.stdout, "target: Directus %s (%s)\n", orUnknown(targetInfo.Version), orUnknown(targetInfo.Vendor))
+	}
+	return err
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// runWatch keeps the target project in sync with the base project, polling
+// the base snapshot and migrating whenever it changed:
+//
+//	watch [--base-url url] [--base-token token] [--target-url url] [--target-token token]
+//	      [--interval duration] [--max-runs n] [--force] [--dry-run]
+//	      [--include pattern]... [--exclude pattern]...
+//	      [--no-backup] [--backup-dir dir|url] [--keep-backups n] [--rollback]
+//	      [--backup-repo [--backup-env env]]
+//	      [--allow-destructive] [--max-deletions n]
+//	      [--record-history ...] [--lock ...] [--strict-hooks]
+//	      [--cache-file file] [--no-cache]
+//	      [--metrics-addr addr]
+//
+// Changes are applied without confirmation, but destructive ones are still
+// refused unless --allow-destructive is given. Every sync is logged; a failed
+// one is retried by the next poll. While the base is unreachable the polls
+// back off up to five minutes apart. Interrupting the command lets a running
+// sync finish before it exits. With --metrics-addr, Prometheus metrics of the
+// syncs are served at /metrics. The targets found in sync are remembered in
+// memory, or in --cache-file across runs, so that a sync skips the diff and
+// the apply while the target has not changed; --no-cache turns that off.
+func runWatch(ctx context.Context, args []string) (err error) {
+	cmd := newCommand("watch")
+	defer func() { err = cmd.finish(err) }()
+	base := addClientFlags(cmd, "base", "BASE")
+	target := addClientFlags(cmd, "target", "TARGET")
+	interval := cmd.Duration("interval", "WATCH_INTERVAL", gomigratedirectus.DefaultWatchInterval, "time between two polls of the base snapshot")
+	maxRuns := cmd.Int("max-runs", "WATCH_MAX_RUNS", 0, "exit after this many polls, 0 to watch until interrupted")
+	force := cmd.Bool("force", "FORCE", false, "migrate even if Directus versions differ")
+	dryRun := cmd.Bool("dry-run", "DRY_RUN", false, "only print the diff of every change")
+	backups := addBackupFlags(cmd)
+	safety := addSafetyFlags(cmd)
+	filters := addFilterFlags(cmd)
+	history := addHistoryFlags(cmd)
+	locks := addLockFlags(cmd)
+	cache := addCacheFlags(cmd)
+	hooks := addHookFlags(cmd)
+	metrics := addMetricsFlags(cmd)
+	if err := cmd.parse(args); err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return fmt.Errorf("invalid --interval %s, expected a positive duration", *interval)
+	}
+	if err := cmd.require(base, target); err != nil {
+		return err
+	}
+	ctx, cancel := cmd.context(ctx)
+	defer cancel()
+
+	baseClient, err := base.newClient()
+	if err != nil {
+		return err
+	}
+	targetClient, err := target.newClient()
+	if err != nil {
+		return err
+	}
+	hooks.add(cmd, targetClient, *target.environment)
+	opts := gomigratedirectus.WatchOptions{
+		Interval: *interval,
+		MaxRuns:  *maxRuns,
+		Migration: gomigratedirectus.MigrationOptions{
+			Force:  *force,
+			DryRun: *dryRun,
+			Output: cmd.stdout,
+			Color:  cmd.color(os.Stdout),
+		},
+	}
+	if err := backups.apply(&opts.Migration); err != nil {
+		return err
+	}
+	safety.apply(&opts.Migration)
+	filters.apply(&opts.Migration)
+	history.apply(&opts.Migration)
+	locks.apply(&opts.Migration)
+	hooks.apply(&opts.Migration)
+	if err := cache.apply(&opts.Migration, true); err != nil {
+		return fmt.Errorf("Watch failed: %w", err)
+	}
+	stop, err := metrics.serve(&opts.Migration, baseClient, targetClient)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	if err := cmd.trace(ctx, &opts.Migration); err != nil {
+		return fmt.Errorf("Watch failed: %w", err)
+	}
+	if err := gomigratedirectus.Watch(ctx, baseClient, targetClient, opts); err != nil {
+		return fmt.Errorf("Watch failed: %w", err)
+	}
+	return nil
+}
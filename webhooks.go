@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	gomigratedirectus "github.com/SymphonyIceAttack/go-mirgrate-directus/go-mirgrate-directus"
+)
+
+// webhookFlags configures the sync of legacy webhooks after a migration.
+type webhookFlags struct {
+	sync  *bool
+	prune *string
+	urls  *[]string
+}
+
+// addWebhookFlags registers --with-webhooks, --prune-webhooks and
+// --webhook-url.
+func addWebhookFlags(cmd *command) webhookFlags {
+	return webhookFlags{
+		sync:  cmd.Bool("with-webhooks", "SYNC_WEBHOOKS", false, "also sync legacy webhooks, matched by name"),
+		prune: cmd.String("prune-webhooks", "PRUNE_WEBHOOKS", string(gomigratedirectus.WebhookPruneNone), "what to do with target-only webhooks: none, deactivate or delete"),
+		urls:  cmd.Strings("webhook-url", "WEBHOOK_URLS", "replace part of base webhook URLs on the target, as old=new"),
+	}
+}
+
+// apply copies the flags to opts.
+func (f webhookFlags) apply(opts *gomigratedirectus.MigrationOptions) error {
+	opts.SyncWebhooks = *f.sync
+	opts.PruneWebhooks = gomigratedirectus.WebhookPrunePolicy(strings.ToLower(*f.prune))
+	switch opts.PruneWebhooks {
+	case gomigratedirectus.WebhookPruneNone, gomigratedirectus.WebhookPruneDeactivate, gomigratedirectus.WebhookPruneDelete:
+	default:
+		return fmt.Errorf("invalid --prune-webhooks %q, expected none, deactivate or delete", *f.prune)
+	}
+	for _, mapping := range *f.urls {
+		from, to, ok := strings.Cut(mapping, "=")
+		if !ok || from == "" {
+			return fmt.Errorf("invalid --webhook-url %q, expected old=new", mapping)
+		}
+		if opts.WebhookURLs == nil {
+			opts.WebhookURLs = map[string]string{}
+		}
+		opts.WebhookURLs[from] = to
+	}
+	return nil
+}